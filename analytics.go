@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+const analyticsTopN = 10
+
+// analyticsStopWords are left out of the most-used words.
+var analyticsStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true,
+	"by": true, "for": true, "from": true, "has": true, "have": true, "i": true, "in": true, "is": true,
+	"it": true, "its": true, "my": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "we": true, "were": true, "will": true, "with": true, "you": true,
+}
+
+type postAnalytics struct {
+	UserID         string         `json:"userId"`
+	TotalPosts     int            `json:"totalPosts"`
+	PostsByHour    [24]int        `json:"postsByHour"`
+	PostsByWeekday map[string]int `json:"postsByWeekday"`
+	AverageLength  float64        `json:"averageLength"`
+	AverageWords   float64        `json:"averageWords"`
+	TopTags        []tagCount     `json:"topTags"`
+	TopWords       []wordCount    `json:"topWords"`
+}
+
+type wordCount struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// postStats is what a single post adds to its author's analytics.
+type postStats struct {
+	hash    [32]byte
+	hour    int
+	weekday time.Weekday
+	length  int
+	words   map[string]int
+	nWords  int
+	tags    []string
+}
+
+func newPostStats(post database.Post) postStats {
+	stats := postStats{
+		hash:    sha256.Sum256([]byte(post.CreatedAt.String() + "\x00" + post.Text + "\x00" + strings.Join(post.Tags, ","))),
+		hour:    post.CreatedAt.UTC().Hour(),
+		weekday: post.CreatedAt.UTC().Weekday(),
+		length:  utf8.RuneCountInString(post.Text),
+		words:   map[string]int{},
+		tags:    post.Tags,
+	}
+	for _, word := range strings.FieldsFunc(strings.ToLower(post.Text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	}) {
+		word = strings.Trim(word, "'")
+		if word == "" {
+			continue
+		}
+		stats.nWords++
+		if utf8.RuneCountInString(word) > 2 && !analyticsStopWords[word] {
+			stats.words[word]++
+		}
+	}
+	return stats
+}
+
+// userAnalytics holds running totals for one user. Posts are added and
+// removed one at a time, so a request only pays for posts that changed
+// since the previous one.
+type userAnalytics struct {
+	posts  map[string]postStats
+	hours  [24]int
+	days   [7]int
+	length int
+	nWords int
+	words  map[string]int
+	tags   map[string]int
+}
+
+func newUserAnalytics() *userAnalytics {
+	return &userAnalytics{
+		posts: map[string]postStats{},
+		words: map[string]int{},
+		tags:  map[string]int{},
+	}
+}
+
+func (ua *userAnalytics) apply(id string, stats postStats, sign int) {
+	if sign > 0 {
+		ua.posts[id] = stats
+	} else {
+		delete(ua.posts, id)
+	}
+	ua.hours[stats.hour] += sign
+	ua.days[stats.weekday] += sign
+	ua.length += sign * stats.length
+	ua.nWords += sign * stats.nWords
+	for word, n := range stats.words {
+		ua.words[word] += sign * n
+		if ua.words[word] == 0 {
+			delete(ua.words, word)
+		}
+	}
+	for _, tag := range stats.tags {
+		ua.tags[tag] += sign
+		if ua.tags[tag] == 0 {
+			delete(ua.tags, tag)
+		}
+	}
+}
+
+// sync brings the totals in line with the user's current posts.
+func (ua *userAnalytics) sync(posts []database.Post) {
+	current := make(map[string]bool, len(posts))
+	for _, post := range posts {
+		current[post.ID] = true
+		stats := newPostStats(post)
+		if old, ok := ua.posts[post.ID]; ok {
+			if old.hash == stats.hash {
+				continue
+			}
+			ua.apply(post.ID, old, -1)
+		}
+		ua.apply(post.ID, stats, 1)
+	}
+	for id, old := range ua.posts {
+		if !current[id] {
+			ua.apply(id, old, -1)
+		}
+	}
+}
+
+func (ua *userAnalytics) report(userID string) postAnalytics {
+	report := postAnalytics{
+		UserID:         userID,
+		TotalPosts:     len(ua.posts),
+		PostsByHour:    ua.hours,
+		PostsByWeekday: map[string]int{},
+		TopTags:        []tagCount{},
+		TopWords:       []wordCount{},
+	}
+	for day, n := range ua.days {
+		report.PostsByWeekday[time.Weekday(day).String()] = n
+	}
+	if report.TotalPosts > 0 {
+		report.AverageLength = float64(ua.length) / float64(report.TotalPosts)
+		report.AverageWords = float64(ua.nWords) / float64(report.TotalPosts)
+	}
+	for tag, n := range ua.tags {
+		report.TopTags = append(report.TopTags, tagCount{Tag: tag, Count: n})
+	}
+	sort.Slice(report.TopTags, func(i, j int) bool {
+		if report.TopTags[i].Count != report.TopTags[j].Count {
+			return report.TopTags[i].Count > report.TopTags[j].Count
+		}
+		return report.TopTags[i].Tag < report.TopTags[j].Tag
+	})
+	if len(report.TopTags) > analyticsTopN {
+		report.TopTags = report.TopTags[:analyticsTopN]
+	}
+	for word, n := range ua.words {
+		report.TopWords = append(report.TopWords, wordCount{Word: word, Count: n})
+	}
+	sort.Slice(report.TopWords, func(i, j int) bool {
+		if report.TopWords[i].Count != report.TopWords[j].Count {
+			return report.TopWords[i].Count > report.TopWords[j].Count
+		}
+		return report.TopWords[i].Word < report.TopWords[j].Word
+	})
+	if len(report.TopWords) > analyticsTopN {
+		report.TopWords = report.TopWords[:analyticsTopN]
+	}
+	return report
+}
+
+// analyticsCache keeps the running totals of every user asked about.
+type analyticsCache struct {
+	mu    sync.Mutex
+	users map[string]*userAnalytics
+}
+
+func newAnalyticsCache() *analyticsCache {
+	return &analyticsCache{users: map[string]*userAnalytics{}}
+}
+
+func (c *analyticsCache) report(userID string, posts []database.Post) postAnalytics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ua, ok := c.users[userID]
+	if !ok {
+		ua = newUserAnalytics()
+		c.users[userID] = ua
+	}
+	ua.sync(posts)
+	return ua.report(userID)
+}
+
+func (apiCfg apiConfig) handlerPostAnalytics(w http.ResponseWriter, r *http.Request) {
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}/posts/analytics"))
+		return
+	}
+
+	// check user exists
+	user, err := apiCfg.users().Get(ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// build report, from the posts the user logged in with r sees
+	posts, err := apiCfg.postsFor(r).ByAuthor(user.ID, "", "")
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	if len(posts) == 0 {
+		// keep the cached totals for the viewers who see the posts
+		respondWithJSON(w, http.StatusOK, newUserAnalytics().report(user.ID))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, apiCfg.analytics.report(user.ID, posts))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestAnalyticsIncremental(t *testing.T) {
+	monday := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+	posts := []database.Post{
+		{ID: "1", CreatedAt: monday, Text: "Shipping the new release today", Tags: []string{"go", "release"}},
+		{ID: "2", CreatedAt: monday.Add(26 * time.Hour), Text: "The release broke, fixing the release", Tags: []string{"go"}},
+		{ID: "3", CreatedAt: monday.Add(2 * time.Hour), Text: "Lunch"},
+	}
+	cache := newAnalyticsCache()
+	report := cache.report("u", posts)
+	if report.TotalPosts != 3 || report.PostsByHour[9] != 1 || report.PostsByHour[11] != 2 {
+		t.Errorf("unexpected totals: %+v", report)
+	}
+	if report.PostsByWeekday["Monday"] != 2 || report.PostsByWeekday["Tuesday"] != 1 {
+		t.Errorf("got weekdays %v", report.PostsByWeekday)
+	}
+	if report.TopWords[0] != (wordCount{Word: "release", Count: 3}) {
+		t.Errorf("got top words %v", report.TopWords)
+	}
+	if report.TopTags[0] != (tagCount{Tag: "go", Count: 2}) {
+		t.Errorf("got top tags %v", report.TopTags)
+	}
+
+	// edit one post and delete another, the cached totals must match a
+	// report computed from scratch
+	posts[0].Text = "Shipping today"
+	posts[0].Tags = nil
+	posts = posts[:2]
+	incremental := cache.report("u", posts)
+	fresh := newAnalyticsCache().report("u", posts)
+	if !reflect.DeepEqual(incremental, fresh) {
+		t.Errorf("got %+v, want %+v", incremental, fresh)
+	}
+}
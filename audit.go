@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/audit"
+)
+
+var apiVersionPattern = regexp.MustCompile(`^v[0-9]+$`)
+
+// auditMiddleware records every write request in the audit log once it
+// completes, whether or not it succeeded. The actor is the user
+// sessionMiddleware found.
+func auditMiddleware(auditLog *audit.Log, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		resource, resourceID := auditResource(r.URL.Path)
+		err := auditLog.Append(audit.Entry{
+			Time:       time.Now().UTC(),
+			RequestID:  requestIDFromContext(r.Context()),
+			Actor:      userIDFromContext(r.Context()),
+			IP:         clientIP(r),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Resource:   resource,
+			ResourceID: resourceID,
+			Status:     recorder.status,
+		})
+		if err != nil {
+			log.Printf("audit log: %v", err)
+		}
+	})
+}
+
+// clientIP returns the address of the client that sent a request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// auditResource splits a path like /v1/posts/{id}/media into the resource
+// ("posts") and its ID. Admin endpoints are resources of their own, e.g.
+// "admin/import".
+func auditResource(path string) (string, string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 1 && apiVersionPattern.MatchString(segments[0]) {
+		segments = segments[1:]
+	}
+	if segments[0] == "admin" && len(segments) > 1 {
+		segments = append([]string{"admin/" + segments[1]}, segments[2:]...)
+	}
+	if len(segments) > 2 && segments[1] == "by-email" {
+		segments = append(segments[:1], segments[2:]...)
+	}
+	if len(segments) == 1 {
+		return segments[0], ""
+	}
+	return segments[0], segments[1]
+}
+
+// handlerAdminAudit lists audit log entries, newest first, filtered by
+// ?actor=, ?resource= and the RFC 3339 times ?since= and ?until=.
+func (apiCfg apiConfig) handlerAdminAudit(w http.ResponseWriter, r *http.Request) {
+	// get params
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:    query.Get("actor"),
+		Resource: query.Get("resource"),
+	}
+	var err error
+	for _, param := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		v := query.Get(param.name)
+		if v == "" {
+			continue
+		}
+		*param.t, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, validationFailed(errors.New(param.name+" must be an RFC 3339 time")))
+			return
+		}
+	}
+	pg, err := apiCfg.pagination.parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// return entries
+	entries, err := apiCfg.audit.Query(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	respondWithJSON(w, http.StatusOK, paginate(w, r, entries, pg))
+}
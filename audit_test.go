@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/audit"
+)
+
+func TestAuditResource(t *testing.T) {
+	var tests = []struct {
+		path               string
+		expectedResource   string
+		expectedResourceID string
+	}{
+		{"/users", "users", ""},
+		{"/v1/posts/123", "posts", "123"},
+		{"/posts/123/media", "posts", "123"},
+		{"/users/by-email/test@example.com", "users", "test@example.com"},
+		{"/admin/import", "admin/import", ""},
+		{"/admin/replication/promote", "admin/replication", "promote"},
+	}
+	for _, tt := range tests {
+		resource, resourceID := auditResource(tt.path)
+		if resource != tt.expectedResource || resourceID != tt.expectedResourceID {
+			t.Errorf("%s: got %s %s, want %s %s", tt.path, resource, resourceID, tt.expectedResource, tt.expectedResourceID)
+		}
+	}
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	auditLog := audit.NewLog(filepath.Join(t.TempDir(), "audit.log"))
+	handler := auditMiddleware(auditLog, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		r := httptest.NewRequest(method, "/posts/123", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		if method == http.MethodDelete {
+			r = r.WithContext(withUserID(r.Context(), "user-1"))
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	entries, err := auditLog.Query(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want the 2 writes", len(entries))
+	}
+	if entries[0].Actor != "" || entries[0].IP != "192.0.2.1" {
+		t.Errorf("anonymous write: got %+v", entries[0])
+	}
+	got := entries[1]
+	if got.Method != http.MethodDelete || got.Actor != "user-1" || got.IP != "192.0.2.1" || got.Resource != "posts" || got.ResourceID != "123" || got.Status != http.StatusCreated {
+		t.Errorf("got %+v", got)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/events"
+)
+
+// badgeRule awards a badge once a user's posts meet its condition.
+type badgeRule struct {
+	name        string
+	description string
+	earned      func(user database.User, posts []database.Post) bool
+}
+
+var badgeRules = []badgeRule{
+	{
+		name:        "first-post",
+		description: "Wrote a first post",
+		earned:      func(user database.User, posts []database.Post) bool { return len(posts) >= 1 },
+	},
+	{
+		name:        "100-posts",
+		description: "Wrote 100 posts",
+		earned:      func(user database.User, posts []database.Post) bool { return len(posts) >= 100 },
+	},
+	{
+		name:        "7-day-streak",
+		description: "Posted 7 days in a row",
+		earned: func(user database.User, posts []database.Post) bool {
+			return computeStreak(posts, userLocation(user), time.Now()).Longest >= 7
+		},
+	},
+}
+
+type userBadge struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	AwardedAt   time.Time `json:"awardedAt"`
+}
+
+// jobAwardBadges evaluates the badge rules for a user, see awardBadgesJob.
+const jobAwardBadges = "badges.award"
+
+type awardBadgesJob struct {
+	TenantID string `json:"tenantId,omitempty"`
+	UserID   string `json:"userId"`
+}
+
+// subscribeBadges evaluates the badge rules whenever a post is written and
+// announces awarded badges. With a job queue, the rules are evaluated in
+// the background instead of in the request writing the post.
+func (apiCfg apiConfig) subscribeBadges(bus *events.Bus) {
+	bus.Subscribe(eventPostCreated, func(event events.Event) {
+		userID := event.Data.(database.Post).UserID
+		if apiCfg.jobs == nil {
+			err := apiCfg.awardBadges(userID)
+			if err != nil {
+				log.Printf("badges: %v", err)
+			}
+			return
+		}
+		_, err := apiCfg.jobs.Enqueue(context.Background(), jobAwardBadges, awardBadgesJob{TenantID: apiCfg.tenantID, UserID: userID})
+		if err != nil {
+			log.Printf("badges: %v", err)
+		}
+	})
+	bus.Subscribe(eventBadgeAwarded, func(event events.Event) {
+		badge := event.Data.(database.Badge)
+		log.Printf("user %s was awarded badge %s", badge.UserID, badge.Name)
+	})
+}
+
+// runAwardBadgesJob runs jobAwardBadges against the tenant the post was
+// written in.
+func (apiCfg apiConfig) runAwardBadgesJob(ctx context.Context, payload json.RawMessage) error {
+	job := awardBadgesJob{}
+	err := json.Unmarshal(payload, &job)
+	if err != nil {
+		return err
+	}
+	t, err := apiCfg.tenants.get(job.TenantID)
+	if err != nil {
+		return err
+	}
+	return t.apiCfg.awardBadges(job.UserID)
+}
+
+func (apiCfg apiConfig) awardBadges(userID string) error {
+	held, err := apiCfg.dbClient.GetBadges(userID)
+	if err != nil {
+		return err
+	}
+	if len(held) == len(badgeRules) {
+		return nil
+	}
+	holds := map[string]bool{}
+	for _, badge := range held {
+		holds[badge.Name] = true
+	}
+	user, err := apiCfg.dbClient.GetUser(userID)
+	if errors.Is(err, database.ErrNotFound) {
+		// deleted since writing the post
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	posts, err := apiCfg.dbClient.GetPosts(userID)
+	if err != nil {
+		return err
+	}
+	for _, rule := range badgeRules {
+		if holds[rule.name] || !rule.earned(user, posts) {
+			continue
+		}
+		_, err = apiCfg.dbClient.AwardBadge(userID, rule.name)
+		if err != nil && !errors.Is(err, database.ErrAlreadyExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (apiCfg apiConfig) handlerGetBadges(w http.ResponseWriter, r *http.Request) {
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}/badges"))
+		return
+	}
+
+	// check user exists
+	user, err := apiCfg.users().Get(ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// return badges
+	badges, err := apiCfg.dbClient.GetBadges(user.ID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	descriptions := map[string]string{}
+	for _, rule := range badgeRules {
+		descriptions[rule.name] = rule.description
+	}
+	res := []userBadge{}
+	for _, badge := range badges {
+		res = append(res, userBadge{Name: badge.Name, Description: descriptions[badge.Name], AwardedAt: badge.AwardedAt})
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
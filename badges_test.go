@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/events"
+	"github.com/firyx/boot.dev-api-backend/internal/jobs"
+)
+
+func TestAwardBadges(t *testing.T) {
+	bus := events.NewBus()
+	c := database.NewMemoryClient().WithCommitHook(publishMutations(bus))
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{dbClient: c, usersPrefix: "/users"}
+	apiCfg.subscribeBadges(bus)
+	awarded := []string{}
+	bus.Subscribe(eventBadgeAwarded, func(event events.Event) {
+		awarded = append(awarded, event.Data.(database.Badge).Name)
+	})
+
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = c.CreatePost(user.ID, "hello", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(awarded) != 1 || awarded[0] != "first-post" {
+		t.Errorf("got %v awarded, want [first-post]", awarded)
+	}
+
+	w := httptest.NewRecorder()
+	apiCfg.endpointUsersHandler(w, httptest.NewRequest(http.MethodGet, "/users/test@example.com/badges", nil))
+	badges := []userBadge{}
+	err = json.NewDecoder(w.Body).Decode(&badges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(badges) != 1 || badges[0].Description != "Wrote a first post" {
+		t.Errorf("got %d %+v, want the first-post badge", w.Code, badges)
+	}
+}
+
+func TestAwardBadgesJob(t *testing.T) {
+	c := database.NewMemoryClient()
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := jobs.NewQueue(c, jobs.Options{PollInterval: 5 * time.Millisecond})
+	main := newTenant(apiConfig{
+		usersPrefix: "/users",
+		jobs:        queue,
+		pagination:  paginationConfig{defaultLimit: 20, maxLimit: 100},
+	}, "", c)
+	apiCfg := main.apiCfg
+	apiCfg.tenants = newTenants(main, t.TempDir(), "")
+	queue.Handle(jobAwardBadges, apiCfg.runAwardBadgesJob)
+
+	user, err := apiCfg.dbClient.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = apiCfg.dbClient.CreatePost(user.ID, "hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	badges, err := c.GetBadges(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(badges) != 0 {
+		t.Errorf("got %d badges before the job ran, want 0", len(badges))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = queue.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		all, err := c.GetJobs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) == 1 && all[0].Status == database.JobDone {
+			break
+		}
+	}
+	badges, err = c.GetBadges(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(badges) != 1 || badges[0].Name != "first-post" {
+		t.Errorf("got %+v, want the first-post badge", badges)
+	}
+
+	w := httptest.NewRecorder()
+	apiCfg.handlerAdminJobs(w, httptest.NewRequest(http.MethodGet, "/admin/jobs?status=done", nil))
+	jobs := []database.Job{}
+	err = json.NewDecoder(w.Body).Decode(&jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Kind != jobAwardBadges {
+		t.Errorf("got %+v, want the done badge job", jobs)
+	}
+}
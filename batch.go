@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxBatchSize bounds the sub-requests of a batch, which hold the
+// connection until they all ran.
+const maxBatchSize = 20
+
+// errBatchFailed rolls back an atomic batch.
+var errBatchFailed = errors.New("a request of the batch failed")
+
+// batchRequest is one of the requests of a batch. Paths are relative to
+// the API version, e.g. /users/{id}, a /v1 prefix is ignored.
+type batchRequest struct {
+	// ID is chosen by the client and returned with the response, to match
+	// them up.
+	ID     string          `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// batchResponse is the response to a sub-request. Bodies that aren't JSON
+// are kept as a string.
+type batchResponse struct {
+	ID     string          `json:"id,omitempty"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// batchParams is the object form of a batch, which can be atomic.
+type batchParams struct {
+	// Atomic stops at the first request failing and rolls back the database
+	// writes of the ones before it.
+	Atomic   bool           `json:"atomic"`
+	Requests []batchRequest `json:"requests"`
+}
+
+// batchResult answers the object form of a batch.
+type batchResult struct {
+	Responses  []batchResponse `json:"responses"`
+	RolledBack bool            `json:"rolledBack,omitempty"`
+}
+
+// batchRecorder captures the response of a sub-request.
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *batchRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *batchRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *batchRecorder) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(p)
+}
+
+// batchHandler runs batches against the handlers of mux, the API version
+// the batch was sent to.
+func (apiCfg apiConfig) batchHandler(mux http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerBatch(w, r, mux)
+	}
+}
+
+// handlerBatch runs the sub-requests of a batch one after the other, with
+// the headers of the batch, and returns each one's status and body. The
+// batch is either a list of requests, where a failing one doesn't stop the
+// ones after it, or an object which can make the batch atomic.
+func (apiCfg apiConfig) handlerBatch(w http.ResponseWriter, r *http.Request, mux http.Handler) {
+	// get params
+	decoder := json.NewDecoder(r.Body)
+	raw := json.RawMessage{}
+	err := decoder.Decode(&raw)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	params := batchParams{}
+	isObject := bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{"))
+	if isObject {
+		err = json.Unmarshal(raw, &params)
+	} else {
+		err = json.Unmarshal(raw, &params.Requests)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check sub-requests
+	if len(params.Requests) == 0 || len(params.Requests) > maxBatchSize {
+		respondWithError(w, http.StatusBadRequest, validationFailed(fmt.Errorf("a batch must have 1 to %d requests", maxBatchSize)))
+		return
+	}
+	for i, sub := range params.Requests {
+		if sub.Method == "" || !strings.HasPrefix(sub.Path, "/") {
+			respondWithError(w, http.StatusBadRequest, validationFailed(fmt.Errorf("request %d needs a method and a path starting with /", i)))
+			return
+		}
+		params.Requests[i].Path = strings.TrimPrefix(sub.Path, "/"+latestAPIVersion)
+		if params.Requests[i].Path == "/batch" || strings.HasPrefix(params.Requests[i].Path, "/batch?") {
+			respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("batches can't be nested")))
+			return
+		}
+	}
+
+	// run sub-requests
+	responses := make([]batchResponse, len(params.Requests))
+	if !params.Atomic {
+		for i, sub := range params.Requests {
+			responses[i] = runBatchRequest(r.Context(), r, mux, sub)
+		}
+		if !isObject {
+			respondWithJSON(w, http.StatusOK, responses)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, batchResult{Responses: responses})
+		return
+	}
+
+	// run atomically, the requests after a failing one aren't run
+	failed := -1
+	err = apiCfg.dbClient.Transaction(r.Context(), func(ctx context.Context) error {
+		for i, sub := range params.Requests {
+			responses[i] = runBatchRequest(ctx, r, mux, sub)
+			if responses[i].Status >= http.StatusBadRequest {
+				failed = i
+				return errBatchFailed
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		respondWithDBError(w, err)
+		return
+	}
+	if failed >= 0 {
+		for i := failed + 1; i < len(params.Requests); i++ {
+			responses[i] = batchResponse{
+				ID:     params.Requests[i].ID,
+				Status: http.StatusFailedDependency,
+				Body:   jsonString(fmt.Sprintf("not run: request %d failed", failed)),
+			}
+		}
+	}
+	respondWithJSON(w, http.StatusOK, batchResult{Responses: responses, RolledBack: failed >= 0})
+}
+
+// runBatchRequest runs a sub-request against mux with the headers of the
+// batch. Its database writes are part of the transaction of ctx, if any.
+func runBatchRequest(ctx context.Context, r *http.Request, mux http.Handler, sub batchRequest) batchResponse {
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(sub.Method), sub.Path, bytes.NewReader(sub.Body))
+	if err != nil {
+		return batchResponse{ID: sub.ID, Status: http.StatusBadRequest, Body: jsonString(err.Error())}
+	}
+	for key, values := range r.Header {
+		if key != "Content-Length" {
+			req.Header[key] = values
+		}
+	}
+	if len(sub.Body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.RemoteAddr = r.RemoteAddr
+	rec := &batchRecorder{header: http.Header{}}
+	mux.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	response := batchResponse{ID: sub.ID, Status: rec.status}
+	if body := bytes.TrimSpace(rec.body.Bytes()); json.Valid(body) {
+		response.Body = body
+	} else if len(body) > 0 {
+		response.Body = jsonString(string(body))
+	}
+	return response
+}
+
+func jsonString(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/audit"
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/events"
+)
+
+func TestBatch(t *testing.T) {
+	apiCfg := apiConfig{
+		dbClient:    database.NewMemoryClient(),
+		auth:        testAuth,
+		usersPrefix: "/users",
+		postsprefix: "/posts",
+	}
+	handler := apiCfg.v1().handler
+
+	var tests = []struct {
+		name             string
+		body             string
+		expectedStatus   int
+		expectedStatuses []int
+	}{
+		{
+			name:             "sequential requests",
+			body:             `[{"method":"POST","path":"/users","body":{"email":"a@example.com","password":"12345","name":"A","age":20}},{"method":"POST","path":"/v1/login","body":{"email":"a@example.com","password":"12345"}},{"method":"GET","path":"/nowhere"}]`,
+			expectedStatus:   200,
+			expectedStatuses: []int{201, 200, 404},
+		},
+		{
+			name:             "failures don't stop the batch",
+			body:             `[{"method":"POST","path":"/users","body":{"email":"a@example.com","password":"12345","name":"A","age":20}},{"method":"DELETE","path":"/login"}]`,
+			expectedStatus:   200,
+			expectedStatuses: []int{409, 405},
+		},
+		{name: "empty batch", body: `[]`, expectedStatus: 400},
+		{name: "missing method", body: `[{"path":"/users"}]`, expectedStatus: 400},
+		{name: "relative path", body: `[{"method":"GET","path":"users"}]`, expectedStatus: 400},
+		{name: "nested batch", body: `[{"method":"POST","path":"/v1/batch","body":[]}]`, expectedStatus: 400},
+		{name: "object without requests", body: `{"method":"GET","path":"/users"}`, expectedStatus: 400},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(tt.body))
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+			continue
+		}
+		if tt.expectedStatus != 200 {
+			continue
+		}
+		responses := []batchResponse{}
+		err := json.NewDecoder(w.Body).Decode(&responses)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(responses) != len(tt.expectedStatuses) {
+			t.Errorf("%s: got %d responses, want %d", tt.name, len(responses), len(tt.expectedStatuses))
+			continue
+		}
+		for i, response := range responses {
+			if response.Status != tt.expectedStatuses[i] {
+				t.Errorf("%s: request %d: got status %d, want %d: %s", tt.name, i, response.Status, tt.expectedStatuses[i], response.Body)
+			}
+			if len(response.Body) == 0 || !json.Valid(response.Body) {
+				t.Errorf("%s: request %d: got body %q", tt.name, i, response.Body)
+			}
+		}
+	}
+}
+
+func TestAtomicBatch(t *testing.T) {
+	bus := events.NewBus()
+	c := database.NewMemoryClient().WithCommitHook(publishMutations(bus))
+	// subscribers write through clients outside of the batch's transaction
+	bus.Subscribe(eventPostCreated, func(event events.Event) {
+		post := event.Data.(database.Post)
+		_, err := c.CreateNotification(database.Notification{UserID: post.UserID, Type: notifyMention, SubjectID: post.ID})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	apiCfg := apiConfig{
+		dbClient:    c,
+		auth:        testAuth,
+		usersPrefix: "/users",
+		postsprefix: "/posts",
+	}
+	handler := apiCfg.v1().handler
+	user, err := c.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.Sign(apiCfg.auth.secret, auth.NewClaims(user.ID, time.Now(), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name               string
+		body               string
+		expectedStatuses   []int
+		expectedRolledBack bool
+		expectedPosts      int
+	}{
+		{
+			name:             "committed",
+			body:             `{"atomic":true,"requests":[{"id":"a","method":"POST","path":"/posts","body":{"userId":"` + user.ID + `","text":"one"}},{"id":"b","method":"POST","path":"/v1/posts","body":{"userId":"` + user.ID + `","text":"two"}}]}`,
+			expectedStatuses: []int{201, 201},
+			expectedPosts:    2,
+		},
+		{
+			name:               "rolled back",
+			body:               `{"atomic":true,"requests":[{"id":"a","method":"POST","path":"/posts","body":{"userId":"` + user.ID + `","text":"three"}},{"id":"b","method":"POST","path":"/posts","body":{"userEmail":"nobody@example.com","text":"four"}},{"id":"c","method":"GET","path":"/tags"}]}`,
+			expectedStatuses:   []int{201, 404, 424},
+			expectedRolledBack: true,
+			expectedPosts:      2,
+		},
+		{
+			name:             "not atomic",
+			body:             `{"requests":[{"id":"a","method":"POST","path":"/posts","body":{"userId":"` + user.ID + `","text":"three"}},{"id":"b","method":"POST","path":"/posts","body":{"userEmail":"nobody@example.com","text":"four"}}]}`,
+			expectedStatuses: []int{201, 404},
+			expectedPosts:    3,
+		},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(tt.body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got status %d: %s", tt.name, w.Code, w.Body)
+			continue
+		}
+		result := batchResult{}
+		err := json.NewDecoder(w.Body).Decode(&result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.RolledBack != tt.expectedRolledBack || len(result.Responses) != len(tt.expectedStatuses) {
+			t.Errorf("%s: got %+v", tt.name, result)
+			continue
+		}
+		for i, response := range result.Responses {
+			if response.ID != string(rune('a'+i)) || response.Status != tt.expectedStatuses[i] {
+				t.Errorf("%s: response %d: got %s with status %d, want %c with %d", tt.name, i, response.ID, response.Status, 'a'+i, tt.expectedStatuses[i])
+			}
+		}
+		posts, err := c.GetPosts(user.ID)
+		if err != nil || len(posts) != tt.expectedPosts {
+			t.Errorf("%s: got %d posts, %v, want %d", tt.name, len(posts), err, tt.expectedPosts)
+		}
+		// rolled back posts weren't announced
+		notifications, err := c.GetNotifications(user.ID)
+		if err != nil || len(notifications) != tt.expectedPosts {
+			t.Errorf("%s: got %d notifications, %v, want %d", tt.name, len(notifications), err, tt.expectedPosts)
+		}
+	}
+}
+
+func TestBatchChargesAndAuditsEachRequest(t *testing.T) {
+	auditLog := audit.NewLog(filepath.Join(t.TempDir(), "audit.log"))
+	apiCfg := apiConfig{
+		dbClient:    database.NewMemoryClient(),
+		auth:        testAuth,
+		usersPrefix: "/users",
+		postsprefix: "/posts",
+		audit:       auditLog,
+		throttle:    newCostThrottle(11, map[string]int{"/tags": 5}),
+	}
+	handler := apiCfg.v1().handler
+	batch := func(body string) []batchResponse {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+		responses := []batchResponse{}
+		err := json.NewDecoder(w.Body).Decode(&responses)
+		if err != nil {
+			t.Fatalf("got status %d: %v", w.Code, err)
+		}
+		return responses
+	}
+
+	// two users cost 1 each and are audited, the tags 5 each until the
+	// budget is spent
+	responses := batch(`[{"method":"POST","path":"/users","body":{"email":"a@example.com","password":"12345","age":20}},{"method":"POST","path":"/users","body":{"email":"b@example.com","password":"12345","age":20}},{"method":"GET","path":"/tags"},{"method":"GET","path":"/v1/tags"}]`)
+	expected := []int{201, 201, 200, 429}
+	for i, response := range responses {
+		if response.Status != expected[i] {
+			t.Errorf("request %d: got status %d, want %d: %s", i, response.Status, expected[i], response.Body)
+		}
+	}
+	entries, err := auditLog.Query(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Resource != "users" || entries[1].Status != 201 {
+		t.Errorf("got audit entries %+v, want one per user created", entries)
+	}
+}
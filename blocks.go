@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+)
+
+// handlerBlockUser hides the posts of a user from the logged in user.
+func (apiCfg apiConfig) handlerBlockUser(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{email}/block"))
+		return
+	}
+
+	// block user
+	block, err := apiCfg.users().Block(userID, ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, block)
+}
+
+// handlerUnblockUser shows the posts of a user blocked by the logged in
+// user again.
+func (apiCfg apiConfig) handlerUnblockUser(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{email}/block"))
+		return
+	}
+
+	// unblock user
+	err = apiCfg.users().Unblock(userID, ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// postsFor returns the post service listing posts for the user logged in
+// with r, if any, leaving out those of the users they blocked.
+func (apiCfg apiConfig) postsFor(r *http.Request) service.PostService {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		return apiCfg.posts()
+	}
+	return apiCfg.posts().ForViewer(userID)
+}
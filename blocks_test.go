@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestBlockUser(t *testing.T) {
+	c := database.NewMemoryClient()
+	_, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := c.CreateUser("other@example.com", "12345", "Other", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreatePost(other.ID, "hello", []string{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		postsprefix: "/posts",
+		pagination:  paginationConfig{defaultLimit: 20, maxLimit: 100},
+		auth:        testAuth,
+	}
+	token := mediaTestLogin(t, apiCfg, "test@example.com")
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		if strings.HasPrefix(path, "/posts") {
+			apiCfg.endpointPostsHandler(w, r)
+		} else {
+			apiCfg.endpointUsersHandler(w, r)
+		}
+		return w
+	}
+	countPosts := func(token string) int {
+		w := request(http.MethodGet, "/posts?tag=go", token)
+		posts := []database.Post{}
+		err := json.NewDecoder(w.Body).Decode(&posts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(posts)
+	}
+
+	var tests = []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "block without session", method: "POST", path: "/users/other@example.com/block", expectedStatus: 401},
+		{name: "block missing user", method: "POST", path: "/users/nobody@example.com/block", token: token, expectedStatus: 404},
+		{name: "block self", method: "POST", path: "/users/test@example.com/block", token: token, expectedStatus: 400},
+		{name: "unblock before blocking", method: "DELETE", path: "/users/other@example.com/block", token: token, expectedStatus: 404},
+		{name: "block", method: "POST", path: "/users/other@example.com/block", token: token, expectedStatus: 201},
+		{name: "block twice", method: "POST", path: "/users/other@example.com/block", token: token, expectedStatus: 201},
+		{name: "get block", method: "GET", path: "/users/other@example.com/block", token: token, expectedStatus: 405},
+	}
+	for _, tt := range tests {
+		w := request(tt.method, tt.path, tt.token)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+
+	// the blocker no longer sees the posts, anonymous visitors still do
+	if n := countPosts(token); n != 0 {
+		t.Errorf("blocker sees %d posts, want none", n)
+	}
+	if n := countPosts(""); n != 1 {
+		t.Errorf("anonymous visitor sees %d posts, want 1", n)
+	}
+	w := request(http.MethodDelete, "/users/other@example.com/block", token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unblock: got status %d: %s", w.Code, w.Body)
+	}
+	if n := countPosts(token); n != 1 {
+		t.Errorf("after unblocking, blocker sees %d posts, want 1", n)
+	}
+}
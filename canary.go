@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+)
+
+const canaryHeader = "X-Canary"
+
+// canary sends a share of the traffic, or requests that opt in with the
+// X-Canary header, to a candidate handler set (e.g. one backed by a new
+// storage implementation). Safe requests sent to the candidate are replayed
+// against the primary handlers too, so divergent results can be logged.
+type canary struct {
+	primary   http.Handler
+	candidate http.Handler
+	// percent of requests without an X-Canary header routed to the candidate.
+	percent float64
+}
+
+func (c canary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !c.useCandidate(r) {
+		w.Header().Set(canaryHeader, "primary")
+		c.primary.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set(canaryHeader, "candidate")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		c.candidate.ServeHTTP(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	candidate := httptest.NewRecorder()
+	c.candidate.ServeHTTP(candidate, cloneRequest(r, body))
+	primary := httptest.NewRecorder()
+	c.primary.ServeHTTP(primary, cloneRequest(r, body))
+	if primary.Code != candidate.Code || !bytes.Equal(primary.Body.Bytes(), candidate.Body.Bytes()) {
+		log.Printf("request_id=%s canary divergence on %s %s: primary %d %s, candidate %d %s",
+			requestIDFromContext(r.Context()), r.Method, r.URL.Path,
+			primary.Code, truncate(primary.Body.String(), 200),
+			candidate.Code, truncate(candidate.Body.String(), 200))
+	}
+
+	for key, values := range candidate.Header() {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(candidate.Code)
+	w.Write(candidate.Body.Bytes())
+}
+
+func (c canary) useCandidate(r *http.Request) bool {
+	if v := r.Header.Get(canaryHeader); v != "" {
+		forced, err := strconv.ParseBool(v)
+		if err == nil {
+			return forced
+		}
+	}
+	return c.percent > 0 && rand.Float64()*100 < c.percent
+}
+
+func cloneRequest(r *http.Request, body []byte) *http.Request {
+	clone := r.Clone(r.Context())
+	clone.Body = io.NopCloser(bytes.NewReader(body))
+	return clone
+}
+
+// withCanary wraps every primary version that also has a candidate version
+// of the same name.
+func withCanary(primary, candidate []apiVersion, percent float64) []apiVersion {
+	candidates := map[string]http.Handler{}
+	for _, v := range candidate {
+		candidates[v.name] = v.handler
+	}
+	versions := []apiVersion{}
+	for _, v := range primary {
+		if handler, ok := candidates[v.name]; ok {
+			v.handler = canary{primary: v.handler, candidate: handler, percent: percent}
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCanary(t *testing.T) {
+	calls := map[string]int{}
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls[name]++
+			body, _ := io.ReadAll(r.Body)
+			w.Write([]byte(name + string(body)))
+		})
+	}
+	c := canary{primary: handler("primary"), candidate: handler("candidate")}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	var tests = []struct {
+		method         string
+		header         string
+		expectedBody   string
+		expectedCalls  map[string]int
+		expectedLogged bool
+	}{
+		{method: http.MethodGet, expectedBody: "primary!", expectedCalls: map[string]int{"primary": 1}},
+		{method: http.MethodGet, header: "true", expectedBody: "candidate!", expectedCalls: map[string]int{"primary": 1, "candidate": 1}, expectedLogged: true},
+		{method: http.MethodPost, header: "1", expectedBody: "candidate!", expectedCalls: map[string]int{"candidate": 1}},
+		{method: http.MethodPost, header: "false", expectedBody: "primary!", expectedCalls: map[string]int{"primary": 1}},
+	}
+	for _, tt := range tests {
+		calls = map[string]int{}
+		logs.Reset()
+		req := httptest.NewRequest(tt.method, "/users", strings.NewReader("!"))
+		if tt.header != "" {
+			req.Header.Set(canaryHeader, tt.header)
+		}
+		w := httptest.NewRecorder()
+		c.ServeHTTP(w, req)
+		if w.Body.String() != tt.expectedBody {
+			t.Errorf("got %q, want %q", w.Body.String(), tt.expectedBody)
+		}
+		for name, n := range tt.expectedCalls {
+			if calls[name] != n {
+				t.Errorf("%s %s: got %d %s calls, want %d", tt.method, tt.header, calls[name], name, n)
+			}
+		}
+		if logged := strings.Contains(logs.String(), "divergence"); logged != tt.expectedLogged {
+			t.Errorf("%s %s: got divergence logged %v, want %v", tt.method, tt.header, logged, tt.expectedLogged)
+		}
+	}
+}
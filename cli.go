@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/replication"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+)
+
+// command is a node of the CLI tree. Leaf commands have run, the others
+// dispatch to their subcommands.
+type command struct {
+	name        string
+	summary     string
+	run         func(cfg config, args []string) error
+	subcommands []command
+}
+
+var cliOut io.Writer = os.Stdout
+
+func cliCommands() command {
+	return command{
+		name: os.Args[0],
+		subcommands: []command{
+			{name: "serve", summary: "start the API server (default)", run: runServe},
+			{name: "user", summary: "manage users", subcommands: []command{
+				{name: "create", summary: "create a user", run: runUserCreate},
+				{name: "delete", summary: "delete a user", run: runUserDelete},
+				{name: "list", summary: "list users", run: runUserList},
+				{name: "unlock", summary: "unlock an account locked after failed logins", run: runUserUnlock},
+			}},
+			{name: "post", summary: "inspect posts", subcommands: []command{
+				{name: "list", summary: "list posts", run: runPostList},
+			}},
+			{name: "db", summary: "maintain the database file", subcommands: []command{
+				{name: "compact", summary: "drop orphaned records and rewrite the file", run: runDBCompact},
+				{name: "verify", summary: "check the database for inconsistencies", run: runDBVerify},
+				{name: "restore", summary: "restore the database to a point in time", run: runRestoreCommand},
+				{name: "seed", summary: "fill the database with fake users and posts", run: runDBSeed},
+			}},
+		},
+	}
+}
+
+func runCLI(cfg config, args []string) error {
+	if len(args) == 0 {
+		return runServer(cfg)
+	}
+	if cfg.dbBackend == "memory" && args[0] != "serve" {
+		return errors.New("DB_BACKEND=memory only applies to serve, the other commands work on the database file")
+	}
+	return cliCommands().dispatch(cfg, args, nil)
+}
+
+func runServe(cfg config, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.BoolVar(&cfg.forceStart, "force", false, "start even if the database doesn't match its checksum")
+	flags.StringVar(&cfg.addr, "addr", cfg.addr, "address to serve the API on, e.g. 0.0.0.0:8080")
+	flags.StringVar(&cfg.adminAddr, "admin-addr", cfg.adminAddr, "private address to serve /admin, /metrics and /debug on")
+	flags.StringVar(&cfg.grpcAddr, "grpc-addr", cfg.grpcAddr, "address to serve the gRPC API on, e.g. 0.0.0.0:9000")
+	listeners := listenerFlag{}
+	flags.Var(&listeners, "listen", "serve route sets on an address, e.g. api@0.0.0.0:8080 or admin@127.0.0.1:9090, can be repeated")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(listeners) > 0 {
+		cfg.listeners = listeners
+	}
+	return runServer(cfg)
+}
+
+func (c command) dispatch(cfg config, args []string, path []string) error {
+	path = append(path, c.name)
+	if c.run != nil {
+		return c.run(cfg, args)
+	}
+	if len(args) > 0 {
+		for _, sub := range c.subcommands {
+			if sub.name == args[0] {
+				return sub.dispatch(cfg, args[1:], path)
+			}
+		}
+	}
+	c.usage(path)
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		return nil
+	}
+	return fmt.Errorf("unknown command: %s", strings.Join(append(path, args[0]), " "))
+}
+
+func (c command) usage(path []string) {
+	fmt.Fprintf(os.Stderr, "usage: %s <command>\n\ncommands:\n", strings.Join(path, " "))
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	for _, sub := range c.subcommands {
+		fmt.Fprintf(w, "  %s\t%s\n", sub.name, sub.summary)
+	}
+	w.Flush()
+}
+
+// openCLIDatabase opens the database for a command. On a primary, writes are
+// appended to the replication journal so secondaries pick them up.
+func openCLIDatabase(cfg config) (database.Client, error) {
+	c, err := openDatabase(cfg.dbBackend, cfg.dbPath, cfg.walEnabled)
+	if err != nil {
+		return database.Client{}, err
+	}
+	if cfg.replicationRole == string(replication.RoleSecondary) {
+		return database.Client{}, errors.New("refusing to modify a secondary, run the command on the primary")
+	}
+	if cfg.replicationRole == string(replication.RolePrimary) {
+		journal, err := replication.OpenLog(cfg.replicationLog)
+		if err != nil {
+			return database.Client{}, err
+		}
+		c = c.WithMutationHook(func(mutations []database.Mutation) {
+			_, err := journal.Append(mutations)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		})
+	}
+	return c, nil
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(cliOut)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func runUserCreate(cfg config, args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the new user")
+	password := flags.String("password", "", "password of the new user")
+	name := flags.String("name", "", "name of the new user")
+	age := flags.Int("age", 0, "age of the new user")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	err = service.ValidateUser(*email, *password, *age)
+	if err != nil {
+		return err
+	}
+	c, err := openCLIDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	hash, tag, err := cfg.passwordHasher.Hash(*password)
+	if err != nil {
+		return err
+	}
+	user, err := c.CreateUser(*email, hash, *name, *age)
+	if err != nil {
+		return err
+	}
+	user, err = c.SetPassword(user.ID, hash, tag)
+	if err != nil {
+		return err
+	}
+	return printJSON(user)
+}
+
+func runUserDelete(cfg config, args []string) error {
+	flags := flag.NewFlagSet("user delete", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the user to delete")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	c, err := openCLIDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	user, err := c.GetUserByEmail(*email)
+	if err != nil {
+		return err
+	}
+	err = c.DeleteUser(user.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cliOut, "deleted %s\n", *email)
+	return nil
+}
+
+func runUserUnlock(cfg config, args []string) error {
+	flags := flag.NewFlagSet("user unlock", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the user to unlock")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	c, err := openCLIDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	user, err := c.GetUserByEmail(*email)
+	if err != nil {
+		return err
+	}
+	err = c.SaveLoginAttempts(database.LoginAttempts{UserID: user.ID})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cliOut, "unlocked %s\n", *email)
+	return nil
+}
+
+func runUserList(cfg config, args []string) error {
+	flags := flag.NewFlagSet("user list", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	users, err := database.NewClient(cfg.dbPath).GetAllUsers()
+	if err != nil {
+		return err
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	w := tabwriter.NewWriter(cliOut, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tNAME\tAGE\tCREATED")
+	for _, user := range users {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", user.ID, user.Email, user.Name, user.Age, user.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+func runPostList(cfg config, args []string) error {
+	flags := flag.NewFlagSet("post list", flag.ContinueOnError)
+	userEmail := flags.String("user", "", "only list posts by this user")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	c := database.NewClient(cfg.dbPath)
+	users, err := c.GetAllUsers()
+	if err != nil {
+		return err
+	}
+	emails := map[string]string{}
+	for _, user := range users {
+		emails[user.ID] = user.Email
+	}
+	var posts []database.Post
+	if *userEmail != "" {
+		var user database.User
+		user, err = c.GetUserByEmail(*userEmail)
+		if err != nil {
+			return err
+		}
+		posts, err = c.GetPosts(user.ID)
+	} else {
+		posts, err = c.GetAllPosts()
+	}
+	if err != nil {
+		return err
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.Before(posts[j].CreatedAt)
+	})
+	w := tabwriter.NewWriter(cliOut, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tCREATED\tTEXT")
+	for _, post := range posts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", post.ID, emails[post.UserID], post.CreatedAt.Format("2006-01-02 15:04"), truncate(post.Text, 40))
+	}
+	return w.Flush()
+}
+
+func runDBCompact(cfg config, args []string) error {
+	c, err := openCLIDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	report, err := c.Compact()
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+func runDBVerify(cfg config, args []string) error {
+	c := database.NewClient(cfg.dbPath)
+	integrity := c.Integrity()
+	if !integrity.OK {
+		return fmt.Errorf("integrity check failed: %s", integrity.Error)
+	}
+	problems, err := c.Verify()
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(cliOut, problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+	fmt.Fprintln(cliOut, "ok")
+	return nil
+}
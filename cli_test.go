@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+)
+
+func TestCLIUserCommands(t *testing.T) {
+	var out bytes.Buffer
+	cliOut = &out
+	defer func() { cliOut = os.Stdout }()
+	cfg := config{dbPath: filepath.Join(t.TempDir(), "db.json")}
+
+	err := runCLI(cfg, []string{"user", "create", "-email", "test@example.com", "-password", "12345", "-age", "18"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runCLI(cfg, []string{"user", "create", "-email", "young@example.com", "-password", "12345", "-age", "16"})
+	if err == nil {
+		t.Errorf("expected ineligible user to be rejected")
+	}
+
+	out.Reset()
+	err = runCLI(cfg, []string{"user", "list"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "test@example.com") || strings.Contains(out.String(), "young@example.com") {
+		t.Errorf("unexpected user list:\n%s", out.String())
+	}
+
+	out.Reset()
+	err = runCLI(cfg, []string{"db", "verify"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = runCLI(cfg, []string{"user", "rename"})
+	if err == nil {
+		t.Errorf("expected an unknown command error")
+	}
+}
+
+func TestSeedRecordsDeterministic(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := seedRecords(42, 10, 3, now)
+	b := seedRecords(42, 10, 3, now)
+	if len(a) != len(b) {
+		t.Fatalf("got %d and %d records, want the same count", len(a), len(b))
+	}
+	for i := range a {
+		if !reflect.DeepEqual(a[i], b[i]) {
+			t.Errorf("record %d differs between runs", i)
+		}
+	}
+	for _, record := range a {
+		if record.User != nil {
+			if err := service.ValidateUser(record.User.Email, record.User.Password, record.User.Age); err != nil {
+				t.Errorf("seeded user %s isn't eligible: %v", record.User.Email, err)
+			}
+		}
+	}
+}
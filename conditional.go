@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// notModified sets Last-Modified to when the resource of a GET or HEAD
+// request last changed and answers 304 Not Modified if it didn't change
+// since the request's If-Modified-Since. It reports whether it answered, so
+// handlers can skip building the response. HTTP dates have no fractions of
+// seconds, so changes in the second of If-Modified-Since go unnoticed, like
+// with http.ServeContent. Listings such as GET /posts don't use it: deleting
+// or hiding a post changes them without making any listed post newer.
+func notModified(w http.ResponseWriter, r *http.Request, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead || modified.IsZero() {
+		return false
+	}
+	modified = modified.UTC().Truncate(time.Second)
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.After(since) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// userModified is when the responses about user that carry their streak
+// last changed: the streak also changes at midnight in their time zone.
+func userModified(user database.User, now time.Time) time.Time {
+	loc := userLocation(user)
+	y, m, d := now.In(loc).Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	if midnight.After(user.UpdatedAt) {
+		return midnight
+	}
+	return user.UpdatedAt
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 30, 15, 500, time.UTC)
+	var tests = []struct {
+		name                 string
+		method               string
+		ifModifiedSince      string
+		expectedNotModified  bool
+		expectedLastModified string
+	}{
+		{name: "unconditional", method: http.MethodGet, expectedLastModified: "Wed, 01 May 2024 12:30:15 GMT"},
+		{name: "same second", method: http.MethodGet, ifModifiedSince: "Wed, 01 May 2024 12:30:15 GMT", expectedNotModified: true, expectedLastModified: "Wed, 01 May 2024 12:30:15 GMT"},
+		{name: "later", method: http.MethodHead, ifModifiedSince: "Thu, 02 May 2024 00:00:00 GMT", expectedNotModified: true, expectedLastModified: "Wed, 01 May 2024 12:30:15 GMT"},
+		{name: "earlier", method: http.MethodGet, ifModifiedSince: "Wed, 01 May 2024 12:30:14 GMT", expectedLastModified: "Wed, 01 May 2024 12:30:15 GMT"},
+		{name: "invalid date", method: http.MethodGet, ifModifiedSince: "yesterday", expectedLastModified: "Wed, 01 May 2024 12:30:15 GMT"},
+		{name: "write", method: http.MethodPut, ifModifiedSince: "Thu, 02 May 2024 00:00:00 GMT"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, "/users/ann", nil)
+		if tt.ifModifiedSince != "" {
+			r.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+		}
+		got := notModified(w, r, modified)
+		if got != tt.expectedNotModified || (got && w.Code != http.StatusNotModified) {
+			t.Errorf("%s: got %v with status %d, want %v", tt.name, got, w.Code, tt.expectedNotModified)
+		}
+		if lastModified := w.Header().Get("Last-Modified"); lastModified != tt.expectedLastModified {
+			t.Errorf("%s: got Last-Modified %q, want %q", tt.name, lastModified, tt.expectedLastModified)
+		}
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	c := database.NewMemoryClient()
+	past := time.Now().UTC().Add(-2 * time.Hour)
+	user := database.User{Email: "ann@example.com", Name: "Ann", Age: 18, CreatedAt: past}
+	errs, err := c.Import([]database.ImportRecord{{User: &user}})
+	if err != nil || errs[0] != nil {
+		t.Fatal(err, errs)
+	}
+	apiCfg := apiConfig{dbClient: c, auth: authConfig{secret: []byte("secret")}, usersPrefix: "/users", postsprefix: "/posts", pagination: paginationConfig{defaultLimit: 20, maxLimit: 100}}
+	token, err := auth.Sign(apiCfg.auth.secret, auth.NewClaims(user.ID, time.Now(), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(handler http.HandlerFunc, path, since string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		if since != "" {
+			r.Header.Set("If-Modified-Since", since)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	for _, path := range []string{"/users/" + user.ID, "/users/" + user.ID + "/profile", "/users/" + user.ID + "/settings"} {
+		w := get(apiCfg.endpointUsersHandler, path, "")
+		lastModified := w.Header().Get("Last-Modified")
+		if w.Code != http.StatusOK || lastModified == "" {
+			t.Fatalf("GET %s: got status %d with Last-Modified %q", path, w.Code, lastModified)
+		}
+		if w := get(apiCfg.endpointUsersHandler, path, lastModified); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("GET %s unchanged: got status %d: %s", path, w.Code, w.Body)
+		}
+	}
+
+	// changes are newer than what clients have
+	since := get(apiCfg.endpointUsersHandler, "/users/"+user.ID+"/settings", "").Header().Get("Last-Modified")
+	_, err = c.UpdateUserSettings(user.ID, database.UserSettings{Timezone: "Europe/Paris"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get(apiCfg.endpointUsersHandler, "/users/"+user.ID+"/settings", since); w.Code != http.StatusOK {
+		t.Errorf("GET settings after an update: got status %d", w.Code)
+	}
+
+	// posts too
+	post := database.Post{Text: "hello", CreatedAt: past}
+	errs, err = c.Import([]database.ImportRecord{{Post: &post, PostAuthorEmail: user.Email}})
+	if err != nil || errs[0] != nil {
+		t.Fatal(err, errs)
+	}
+	revisions := "/posts/" + post.ID + "/revisions"
+	since = get(apiCfg.endpointPostsHandler, revisions, "").Header().Get("Last-Modified")
+	if w := get(apiCfg.endpointPostsHandler, revisions, since); w.Code != http.StatusNotModified {
+		t.Errorf("GET revisions unchanged: got status %d", w.Code)
+	}
+	_, err = c.UpdatePost(post.ID, "hello again", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get(apiCfg.endpointPostsHandler, revisions, since); w.Code != http.StatusOK {
+		t.Errorf("GET revisions after an update: got status %d", w.Code)
+	}
+
+	// listings always answer, a deleted post wouldn't make them newer
+	r := httptest.NewRequest(http.MethodGet, "/posts", strings.NewReader(`{"userId": "`+user.ID+`"}`))
+	r.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	w := httptest.NewRecorder()
+	apiCfg.endpointPostsHandler(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Last-Modified") != "" {
+		t.Errorf("GET /posts: got status %d with Last-Modified %q", w.Code, w.Header().Get("Last-Modified"))
+	}
+}
@@ -0,0 +1,786 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/bundle"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/iprep"
+	"github.com/firyx/boot.dev-api-backend/internal/passhash"
+	"github.com/firyx/boot.dev-api-backend/internal/pwned"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+	"github.com/firyx/boot.dev-api-backend/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type config struct {
+	addr string
+	// adminAddr serves the admin routes, off the public listener.
+	adminAddr string
+	// grpcAddr serves the gRPC API, which is off when it's empty.
+	grpcAddr string
+	// listeners overrides addr with several listeners, each serving its own
+	// route sets.
+	listeners []listener
+	dbPath    string
+	// dbBackend is "file", or "memory" to keep every database in memory
+	// for tests and demos.
+	dbBackend string
+	// walEnabled logs writes to DB_PATH.wal before applying them.
+	walEnabled bool
+	// forceStart is set by serve -force and starts the server even if the
+	// database doesn't match its checksum.
+	forceStart bool
+	// shutdownTimeout is how long requests in flight get to finish on
+	// SIGTERM, e.g. once a restarted process took over the listeners.
+	shutdownTimeout time.Duration
+	pidFile         string
+
+	tlsCertFile      string
+	tlsKeyFile       string
+	tlsDomains       string
+	tlsCacheDir      string
+	httpRedirectAddr string
+
+	auditLog string
+
+	backupDir      string
+	backupGzip     bool
+	backupMaxFiles int
+	backupMaxAge   time.Duration
+
+	tenantsDir       string
+	tenantBaseDomain string
+
+	jobWorkers      int
+	jobMaxAttempts  int
+	jobBackoff      time.Duration
+	jobMaxBackoff   time.Duration
+	jobPollInterval time.Duration
+	jobRetention    time.Duration
+
+	smtpAddr        string
+	smtpUsername    string
+	smtpPassword    string
+	smtpFrom        string
+	smtpPoolSize    int
+	smtpIdleTimeout time.Duration
+	smtpTimeout     time.Duration
+
+	// translateProvider is empty to disable translation, mock or
+	// libretranslate.
+	translateProvider  string
+	translateURL       string
+	translateAPIKey    string
+	translateCacheSize int
+
+	// moderationRejectWords and moderationFlagWords are word list files.
+	moderationRejectWords string
+	moderationFlagWords   string
+	moderationAPIURL      string
+	moderationAPIKey      string
+	moderationAPITimeout  time.Duration
+
+	// signupHoneypotFields are hidden fields of the signup form, which
+	// people leave empty.
+	signupHoneypotFields []string
+	signupMinFillTime    time.Duration
+	// signupReviewScore and signupRejectScore hold or refuse signups with a
+	// bot score at least as high, 0 turns them off.
+	signupReviewScore float64
+	signupRejectScore float64
+
+	jwtSecret          []byte
+	sessionTTL         time.Duration
+	loginMaxFailures   int
+	loginFailureWindow time.Duration
+	loginLockout       time.Duration
+	totpIssuer         string
+	// passwordPolicy applies to the main database, tenants set their own.
+	passwordPolicy    database.PasswordPolicy
+	passwordBreachURL string
+	// passwordHasher hashes new passwords, and rehashes older ones at login.
+	passwordHasher passhash.Hasher
+
+	oauthGoogleClientID     string
+	oauthGoogleClientSecret string
+	oauthGitHubClientID     string
+	oauthGitHubClientSecret string
+	oauthRedirectBaseURL    string
+
+	logFile           string
+	logStdout         bool
+	logMaxSizeMB      int
+	logRotateInterval time.Duration
+	logMaxBackups     int
+	logMaxAge         time.Duration
+
+	// recoverPanics turns panics into 500 responses. Without it, panics
+	// reach net/http, which logs them and drops the connection.
+	recoverPanics bool
+	panicLogStack bool
+
+	// otlpEndpoint is the OTLP/HTTP traces URL, empty when tracing is off.
+	otlpEndpoint     string
+	otlpHeaders      map[string]string
+	otelServiceName  string
+	traceSampleRatio float64
+
+	// metricsSnapshotFile is empty when snapshots are only kept in memory,
+	// for GET /admin/metrics/history.
+	metricsSnapshotFile       string
+	metricsSnapshotInterval   time.Duration
+	metricsHistorySize        int
+	metricsSnapshotMaxSizeMB  int
+	metricsSnapshotMaxBackups int
+
+	deadLinkInterval         time.Duration
+	leaderboardInterval      time.Duration
+	searchRebuildInterval    time.Duration
+	existenceRebuildInterval time.Duration
+	streakCheckInterval      time.Duration
+	compactInterval          time.Duration
+	loginPurgeInterval       time.Duration
+	statsInterval            time.Duration
+
+	pageSizeDefault int
+	pageSizeMax     int
+
+	// postLimits apply to every tenant, on top of their content policy.
+	postLimits         service.PostLimits
+	bodyMaxSizeKB      int
+	adminBodyMaxSizeMB int
+
+	throttleBudget     int
+	throttleRouteCosts map[string]int
+
+	// geoIPCountryCSV and ipBlocklists are files the IP policy looks
+	// addresses up in.
+	geoIPCountryCSV string
+	ipBlocklists    []string
+	ipPolicy        iprep.Policy
+
+	mediaStorage       string
+	mediaDir           string
+	mediaMaxSizeMB     int
+	mediaAllowedTypes  []string
+	mediaPresignExpiry time.Duration
+	attachmentQuotaMB  int
+	s3                 storage.S3Config
+
+	replicationRole         string
+	replicationPrimaryURL   string
+	replicationLog          string
+	replicationPollInterval time.Duration
+	// the lease coordinating a primary and its standbys
+	replicationLeaseFile     string
+	replicationNodeID        string
+	replicationLeaseTTL      time.Duration
+	replicationCheckInterval time.Duration
+	replicationFailAfter     int
+
+	canaryDBPath  string
+	canaryPercent float64
+	rollouts      map[string]rollout
+
+	sentryDSN         string
+	sentryEnvironment string
+	release           string
+
+	sampleRate       float64
+	sampleRouteRates map[string]float64
+	sampleFile       string
+	sampleMaxSizeMB  int
+	sampleMaxFiles   int
+
+	exportPassphrase  string
+	exportSigningKey  ed25519.PrivateKey
+	exportTrustedKeys []ed25519.PublicKey
+
+	syncConflicts conflictStrategy
+}
+
+func loadConfig() (config, error) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	values, err := readConfigFile(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return config{}, fmt.Errorf("CONFIG_FILE: %w", err)
+	}
+	configFile = values
+	defer func() { configFile = nil }()
+
+	cfg := config{}
+	cfg.addr = envString("ADDR", "localhost:8080")
+	cfg.adminAddr = envString("ADMIN_ADDR", "localhost:9090")
+	cfg.grpcAddr = getenv("GRPC_ADDR")
+	// e.g. LISTEN="api@0.0.0.0:8080 admin@127.0.0.1:9090"
+	if cfg.listeners, err = parseListeners(getenv("LISTEN")); err != nil {
+		return config{}, fmt.Errorf("invalid LISTEN: %w", err)
+	}
+	if cfg.shutdownTimeout, err = envDuration("SHUTDOWN_TIMEOUT", 30*time.Second); err != nil {
+		return config{}, err
+	}
+	cfg.pidFile = getenv("PID_FILE")
+	cfg.dbPath = envString("DB_PATH", "./db.json")
+	cfg.dbBackend = envString("DB_BACKEND", "file")
+	if cfg.dbBackend != "file" && cfg.dbBackend != "memory" {
+		return config{}, fmt.Errorf("DB_BACKEND must be file or memory, got %q", cfg.dbBackend)
+	}
+	if cfg.walEnabled, err = envBool("WAL_ENABLED", true); err != nil {
+		return config{}, err
+	}
+	cfg.tlsCertFile = getenv("TLS_CERT_FILE")
+	cfg.tlsKeyFile = getenv("TLS_KEY_FILE")
+	cfg.tlsDomains = getenv("TLS_DOMAINS")
+	cfg.tlsCacheDir = envString("TLS_CACHE_DIR", "./certs")
+	cfg.httpRedirectAddr = getenv("HTTP_REDIRECT_ADDR")
+	if cfg.tlsDomains != "" && cfg.httpRedirectAddr == "" {
+		// Let's Encrypt http-01 challenges always arrive on port 80
+		cfg.httpRedirectAddr = ":80"
+	}
+	cfg.auditLog = envString("AUDIT_LOG", "./audit.log")
+	cfg.backupDir = envString("BACKUP_DIR", "./backups")
+	if cfg.backupGzip, err = envBool("BACKUP_GZIP", true); err != nil {
+		return config{}, err
+	}
+	if cfg.backupMaxFiles, err = envInt("BACKUP_MAX_FILES", 10); err != nil {
+		return config{}, err
+	}
+	if cfg.backupMaxAge, err = envDuration("BACKUP_MAX_AGE", 0); err != nil {
+		return config{}, err
+	}
+	cfg.tenantsDir = envString("TENANTS_DIR", "./tenants")
+	// e.g. api.example.com serves tenant acme at acme.api.example.com
+	cfg.tenantBaseDomain = strings.ToLower(getenv("TENANT_BASE_DOMAIN"))
+	if cfg.jobWorkers, err = envInt("JOB_WORKERS", 4); err != nil {
+		return config{}, err
+	}
+	if cfg.jobMaxAttempts, err = envInt("JOB_MAX_ATTEMPTS", 5); err != nil {
+		return config{}, err
+	}
+	if cfg.jobBackoff, err = envDuration("JOB_BACKOFF", 10*time.Second); err != nil {
+		return config{}, err
+	}
+	if cfg.jobMaxBackoff, err = envDuration("JOB_MAX_BACKOFF", time.Hour); err != nil {
+		return config{}, err
+	}
+	if cfg.jobPollInterval, err = envDuration("JOB_POLL_INTERVAL", 5*time.Second); err != nil {
+		return config{}, err
+	}
+	if cfg.jobRetention, err = envDuration("JOB_RETENTION", 7*24*time.Hour); err != nil {
+		return config{}, err
+	}
+	// emails are only sent with an SMTP server, e.g. smtp.example.com:587
+	cfg.smtpAddr = getenv("SMTP_ADDR")
+	cfg.smtpUsername = getenv("SMTP_USERNAME")
+	cfg.smtpPassword = getenv("SMTP_PASSWORD")
+	cfg.smtpFrom = getenv("SMTP_FROM")
+	if cfg.smtpAddr != "" && cfg.smtpFrom == "" {
+		return config{}, fmt.Errorf("SMTP_FROM is required with SMTP_ADDR")
+	}
+	if cfg.smtpPoolSize, err = envInt("SMTP_POOL_SIZE", 4); err != nil {
+		return config{}, err
+	}
+	if cfg.smtpIdleTimeout, err = envDuration("SMTP_IDLE_TIMEOUT", time.Minute); err != nil {
+		return config{}, err
+	}
+	if cfg.smtpTimeout, err = envDuration("SMTP_TIMEOUT", 30*time.Second); err != nil {
+		return config{}, err
+	}
+	cfg.translateProvider = getenv("TRANSLATE_PROVIDER")
+	cfg.translateURL = getenv("TRANSLATE_URL")
+	cfg.translateAPIKey = getenv("TRANSLATE_API_KEY")
+	if cfg.translateCacheSize, err = envInt("TRANSLATE_CACHE_SIZE", 1000); err != nil {
+		return config{}, err
+	}
+	cfg.moderationRejectWords = getenv("MODERATION_REJECT_WORDS")
+	cfg.moderationFlagWords = getenv("MODERATION_FLAG_WORDS")
+	// a service answering {"text": ...} with {"action": "allow", "flag" or
+	// "reject", "reason": ...}
+	cfg.moderationAPIURL = getenv("MODERATION_API_URL")
+	cfg.moderationAPIKey = getenv("MODERATION_API_KEY")
+	if cfg.moderationAPITimeout, err = envDuration("MODERATION_API_TIMEOUT", 5*time.Second); err != nil {
+		return config{}, err
+	}
+	cfg.signupHoneypotFields = envList("SIGNUP_HONEYPOT_FIELDS")
+	if cfg.signupMinFillTime, err = envDuration("SIGNUP_MIN_FILL_TIME", 3*time.Second); err != nil {
+		return config{}, err
+	}
+	if cfg.signupReviewScore, err = envFloat("SIGNUP_REVIEW_SCORE", 0); err != nil {
+		return config{}, err
+	}
+	if cfg.signupRejectScore, err = envFloat("SIGNUP_REJECT_SCORE", 0); err != nil {
+		return config{}, err
+	}
+	if cfg.signupReviewScore < 0 || cfg.signupReviewScore > 1 || cfg.signupRejectScore < 0 || cfg.signupRejectScore > 1 {
+		return config{}, fmt.Errorf("SIGNUP_REVIEW_SCORE and SIGNUP_REJECT_SCORE must be between 0 and 1")
+	}
+	cfg.jwtSecret = []byte(getenv("JWT_SECRET"))
+	if cfg.sessionTTL, err = envDuration("SESSION_TTL", 24*time.Hour); err != nil {
+		return config{}, err
+	}
+	if cfg.loginMaxFailures, err = envInt("LOGIN_MAX_FAILURES", 5); err != nil {
+		return config{}, err
+	}
+	if cfg.loginFailureWindow, err = envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute); err != nil {
+		return config{}, err
+	}
+	if cfg.loginLockout, err = envDuration("LOGIN_LOCKOUT", 15*time.Minute); err != nil {
+		return config{}, err
+	}
+	// shown next to the account in authenticator apps
+	cfg.totpIssuer = envString("TOTP_ISSUER", "boot.dev API")
+	if cfg.passwordPolicy.MinLength, err = envInt("PASSWORD_MIN_LENGTH", 0); err != nil {
+		return config{}, err
+	}
+	if err = parsePasswordClasses(getenv("PASSWORD_REQUIRE"), &cfg.passwordPolicy); err != nil {
+		return config{}, err
+	}
+	if cfg.passwordPolicy.RejectBreached, err = envBool("PASSWORD_REJECT_BREACHED", false); err != nil {
+		return config{}, err
+	}
+	// a mirror of the Pwned Passwords API, for tenants rejecting breached
+	// passwords too
+	cfg.passwordBreachURL = envString("PASSWORD_BREACH_URL", pwned.DefaultURL)
+	cfg.passwordHasher.Algorithm = envString("PASSWORD_HASH", passhash.Bcrypt)
+	if err = passhash.CheckAlgorithm(cfg.passwordHasher.Algorithm); err != nil {
+		return config{}, fmt.Errorf("PASSWORD_HASH: %w", err)
+	}
+	if cfg.passwordHasher.BcryptCost, err = envInt("PASSWORD_BCRYPT_COST", bcrypt.DefaultCost); err != nil {
+		return config{}, err
+	}
+	if cfg.passwordHasher.BcryptCost < bcrypt.MinCost || cfg.passwordHasher.BcryptCost > bcrypt.MaxCost {
+		return config{}, fmt.Errorf("PASSWORD_BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	// scrypt's N is 2^PASSWORD_SCRYPT_COST
+	scryptCost, err := envInt("PASSWORD_SCRYPT_COST", 15)
+	if err != nil {
+		return config{}, err
+	}
+	if scryptCost < 10 || scryptCost > 24 {
+		return config{}, fmt.Errorf("PASSWORD_SCRYPT_COST must be between 10 and 24")
+	}
+	cfg.passwordHasher.Scrypt = passhash.ScryptParams{N: 1 << scryptCost, R: 8, P: 1}
+	argon2Memory, err := envInt("PASSWORD_ARGON2_MEMORY_MIB", int(passhash.DefaultArgon2.Memory/1024))
+	if err != nil {
+		return config{}, err
+	}
+	if argon2Memory < 8 || argon2Memory > 4096 {
+		return config{}, fmt.Errorf("PASSWORD_ARGON2_MEMORY_MIB must be between 8 and 4096")
+	}
+	argon2Time, err := envInt("PASSWORD_ARGON2_TIME", int(passhash.DefaultArgon2.Time))
+	if err != nil {
+		return config{}, err
+	}
+	if argon2Time < 1 || argon2Time > 100 {
+		return config{}, fmt.Errorf("PASSWORD_ARGON2_TIME must be between 1 and 100")
+	}
+	cfg.passwordHasher.Argon2 = passhash.Argon2Params{
+		Time:    uint32(argon2Time),
+		Memory:  uint32(argon2Memory) * 1024,
+		Threads: passhash.DefaultArgon2.Threads,
+	}
+	// changing or removing the pepper locks out users whose passwords were
+	// hashed with it
+	cfg.passwordHasher.Pepper = []byte(getenv("PASSWORD_PEPPER"))
+	cfg.oauthGoogleClientID = getenv("OAUTH_GOOGLE_CLIENT_ID")
+	cfg.oauthGoogleClientSecret = getenv("OAUTH_GOOGLE_CLIENT_SECRET")
+	cfg.oauthGitHubClientID = getenv("OAUTH_GITHUB_CLIENT_ID")
+	cfg.oauthGitHubClientSecret = getenv("OAUTH_GITHUB_CLIENT_SECRET")
+	// the public URL of this API, registered with the providers
+	cfg.oauthRedirectBaseURL = strings.TrimSuffix(getenv("OAUTH_REDIRECT_BASE_URL"), "/")
+	cfg.logFile = getenv("LOG_FILE")
+	if cfg.logStdout, err = envBool("LOG_STDOUT", true); err != nil {
+		return config{}, err
+	}
+	if cfg.logMaxSizeMB, err = envInt("LOG_MAX_SIZE_MB", 100); err != nil {
+		return config{}, err
+	}
+	if cfg.logRotateInterval, err = envDuration("LOG_ROTATE_INTERVAL", 24*time.Hour); err != nil {
+		return config{}, err
+	}
+	if cfg.logMaxBackups, err = envInt("LOG_MAX_BACKUPS", 7); err != nil {
+		return config{}, err
+	}
+	if cfg.logMaxAge, err = envDuration("LOG_MAX_AGE", 30*24*time.Hour); err != nil {
+		return config{}, err
+	}
+	if cfg.recoverPanics, err = envBool("RECOVER_PANICS", true); err != nil {
+		return config{}, err
+	}
+	if cfg.panicLogStack, err = envBool("PANIC_LOG_STACK", true); err != nil {
+		return config{}, err
+	}
+	// the standard OpenTelemetry variables, the base endpoint gets the
+	// traces path appended
+	cfg.otlpEndpoint = getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if base := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); cfg.otlpEndpoint == "" && base != "" {
+		cfg.otlpEndpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if cfg.otlpHeaders, err = parseOTLPHeaders(getenv("OTEL_EXPORTER_OTLP_HEADERS")); err != nil {
+		return config{}, err
+	}
+	cfg.otelServiceName = envString("OTEL_SERVICE_NAME", "boot.dev-api-backend")
+	if cfg.traceSampleRatio, err = envFloat("OTEL_TRACES_SAMPLER_ARG", 1); err != nil {
+		return config{}, err
+	}
+	if cfg.traceSampleRatio < 0 || cfg.traceSampleRatio > 1 {
+		return config{}, fmt.Errorf("OTEL_TRACES_SAMPLER_ARG must be between 0 and 1")
+	}
+	cfg.metricsSnapshotFile = getenv("METRICS_SNAPSHOT_FILE")
+	if cfg.metricsSnapshotInterval, err = envDuration("METRICS_SNAPSHOT_INTERVAL", time.Minute); err != nil {
+		return config{}, err
+	}
+	if cfg.metricsHistorySize, err = envInt("METRICS_HISTORY_SIZE", 60); err != nil {
+		return config{}, err
+	}
+	if cfg.metricsHistorySize < 1 {
+		return config{}, fmt.Errorf("METRICS_HISTORY_SIZE must be positive")
+	}
+	if cfg.metricsSnapshotMaxSizeMB, err = envInt("METRICS_SNAPSHOT_MAX_SIZE_MB", 10); err != nil {
+		return config{}, err
+	}
+	if cfg.metricsSnapshotMaxBackups, err = envInt("METRICS_SNAPSHOT_MAX_BACKUPS", 5); err != nil {
+		return config{}, err
+	}
+	if cfg.deadLinkInterval, err = envDuration("DEAD_LINK_CHECK_INTERVAL", time.Hour); err != nil {
+		return config{}, err
+	}
+	if cfg.leaderboardInterval, err = envDuration("LEADERBOARD_INTERVAL", 5*time.Minute); err != nil {
+		return config{}, err
+	}
+	if cfg.searchRebuildInterval, err = envDuration("SEARCH_REBUILD_INTERVAL", 10*time.Minute); err != nil {
+		return config{}, err
+	}
+	if cfg.existenceRebuildInterval, err = envDuration("EXISTENCE_FILTER_REBUILD_INTERVAL", time.Hour); err != nil {
+		return config{}, err
+	}
+	if cfg.streakCheckInterval, err = envDuration("STREAK_CHECK_INTERVAL", 15*time.Minute); err != nil {
+		return config{}, err
+	}
+	if cfg.compactInterval, err = envDuration("DB_COMPACT_INTERVAL", 24*time.Hour); err != nil {
+		return config{}, err
+	}
+	if cfg.loginPurgeInterval, err = envDuration("LOGIN_PURGE_INTERVAL", time.Hour); err != nil {
+		return config{}, err
+	}
+	if cfg.statsInterval, err = envDuration("STATS_INTERVAL", 24*time.Hour); err != nil {
+		return config{}, err
+	}
+	// 0 disables throttling
+	if cfg.throttleBudget, err = envInt("THROTTLE_BUDGET", 600); err != nil {
+		return config{}, err
+	}
+	if cfg.throttleRouteCosts, err = parseRouteCosts(envString("THROTTLE_ROUTE_COSTS", "/search=5,/admin/users.csv=20,/admin/posts.csv=20,/admin/export.bundle=50")); err != nil {
+		return config{}, fmt.Errorf("invalid THROTTLE_ROUTE_COSTS: %w", err)
+	}
+	// e.g. a DB-IP country lite CSV, and Spamhaus DROP lists
+	cfg.geoIPCountryCSV = getenv("GEOIP_COUNTRY_CSV")
+	cfg.ipBlocklists = envList("IP_BLOCKLISTS")
+	if cfg.ipPolicy, err = parseIPPolicy(); err != nil {
+		return config{}, err
+	}
+	if cfg.pageSizeDefault, err = envInt("PAGE_SIZE_DEFAULT", 20); err != nil {
+		return config{}, err
+	}
+	if cfg.pageSizeMax, err = envInt("PAGE_SIZE_MAX", 100); err != nil {
+		return config{}, err
+	}
+	if cfg.pageSizeDefault < 1 || cfg.pageSizeDefault > cfg.pageSizeMax {
+		return config{}, fmt.Errorf("PAGE_SIZE_DEFAULT must be between 1 and PAGE_SIZE_MAX (%d)", cfg.pageSizeMax)
+	}
+	// 0 disables each limit
+	if cfg.postLimits.MaxLength, err = envInt("POST_MAX_LENGTH", 10000); err != nil {
+		return config{}, err
+	}
+	if cfg.postLimits.PerDay, err = envInt("POST_MAX_PER_DAY", 100); err != nil {
+		return config{}, err
+	}
+	// media uploads have limits of their own, admin imports and restores
+	// send whole databases
+	if cfg.bodyMaxSizeKB, err = envInt("BODY_MAX_SIZE_KB", 1024); err != nil {
+		return config{}, err
+	}
+	if cfg.adminBodyMaxSizeMB, err = envInt("ADMIN_BODY_MAX_SIZE_MB", 256); err != nil {
+		return config{}, err
+	}
+	cfg.mediaStorage = envString("MEDIA_STORAGE", "local")
+	if cfg.mediaStorage != "local" && cfg.mediaStorage != "s3" {
+		return config{}, fmt.Errorf("MEDIA_STORAGE must be local or s3, got %q", cfg.mediaStorage)
+	}
+	cfg.mediaDir = envString("MEDIA_DIR", "./media")
+	if cfg.mediaMaxSizeMB, err = envInt("MEDIA_MAX_SIZE_MB", 10); err != nil {
+		return config{}, err
+	}
+	cfg.mediaAllowedTypes = strings.Split(envString("MEDIA_ALLOWED_TYPES", "image/jpeg,image/png,image/gif,image/webp"), ",")
+	if cfg.mediaPresignExpiry, err = envDuration("MEDIA_PRESIGN_EXPIRY", 15*time.Minute); err != nil {
+		return config{}, err
+	}
+	if cfg.attachmentQuotaMB, err = envInt("MESSAGE_ATTACHMENT_QUOTA_MB", 100); err != nil {
+		return config{}, err
+	}
+	cfg.s3 = storage.S3Config{
+		Endpoint:        envString("S3_ENDPOINT", "https://s3.amazonaws.com"),
+		Bucket:          getenv("S3_BUCKET"),
+		Region:          envString("S3_REGION", "us-east-1"),
+		AccessKeyID:     getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: getenv("S3_SECRET_ACCESS_KEY"),
+	}
+	if cfg.s3.PathStyle, err = envBool("S3_PATH_STYLE", false); err != nil {
+		return config{}, err
+	}
+	cfg.replicationRole = getenv("REPLICATION_ROLE")
+	// the primary's admin listener, e.g. http://10.0.0.1:9090
+	cfg.replicationPrimaryURL = strings.TrimSuffix(getenv("REPLICATION_PRIMARY_URL"), "/")
+	cfg.replicationLog = envString("REPLICATION_LOG", "./db.replication.log")
+	if cfg.replicationPollInterval, err = envDuration("REPLICATION_POLL_INTERVAL", time.Second); err != nil {
+		return config{}, err
+	}
+	cfg.replicationLeaseFile = getenv("REPLICATION_LEASE_FILE")
+	hostname, _ := os.Hostname()
+	cfg.replicationNodeID = envString("REPLICATION_NODE_ID", hostname)
+	if cfg.replicationLeaseTTL, err = envDuration("REPLICATION_LEASE_TTL", 15*time.Second); err != nil {
+		return config{}, err
+	}
+	if cfg.replicationCheckInterval, err = envDuration("REPLICATION_CHECK_INTERVAL", 5*time.Second); err != nil {
+		return config{}, err
+	}
+	if cfg.replicationFailAfter, err = envInt("REPLICATION_FAILOVER_CHECKS", 3); err != nil {
+		return config{}, err
+	}
+	if cfg.replicationRole == "standby" && cfg.replicationLeaseFile == "" {
+		return config{}, fmt.Errorf("REPLICATION_LEASE_FILE is required for a standby")
+	}
+	if cfg.replicationLeaseFile != "" && cfg.replicationNodeID == "" {
+		return config{}, fmt.Errorf("REPLICATION_NODE_ID is required with REPLICATION_LEASE_FILE")
+	}
+	// the primary renews its lease every check
+	if cfg.replicationCheckInterval <= 0 || cfg.replicationLeaseTTL <= cfg.replicationCheckInterval {
+		return config{}, fmt.Errorf("REPLICATION_LEASE_TTL must be longer than REPLICATION_CHECK_INTERVAL")
+	}
+	if cfg.replicationFailAfter < 1 {
+		return config{}, fmt.Errorf("REPLICATION_FAILOVER_CHECKS must be positive")
+	}
+	cfg.canaryDBPath = getenv("CANARY_DB_PATH")
+	if cfg.canaryPercent, err = envFloat("CANARY_PERCENT", 0); err != nil {
+		return config{}, err
+	}
+	if cfg.rollouts, err = parseRollouts(getenv("ROLLOUTS")); err != nil {
+		return config{}, fmt.Errorf("invalid ROLLOUTS: %w", err)
+	}
+	cfg.sentryDSN = getenv("SENTRY_DSN")
+	cfg.sentryEnvironment = envString("SENTRY_ENVIRONMENT", "production")
+	cfg.release = getenv("RELEASE")
+	if cfg.sampleRate, err = envFloat("SAMPLE_RATE", 0); err != nil {
+		return config{}, err
+	}
+	if cfg.sampleRouteRates, err = parseSampleRates(getenv("SAMPLE_ROUTE_RATES")); err != nil {
+		return config{}, err
+	}
+	cfg.sampleFile = envString("SAMPLE_FILE", "./samples/requests.log")
+	if cfg.sampleMaxSizeMB, err = envInt("SAMPLE_MAX_SIZE_MB", 10); err != nil {
+		return config{}, err
+	}
+	if cfg.sampleMaxFiles, err = envInt("SAMPLE_MAX_FILES", 5); err != nil {
+		return config{}, err
+	}
+	cfg.exportPassphrase = getenv("EXPORT_PASSPHRASE")
+	// e.g. EXPORT_SIGNING_KEY=$(head -c 32 /dev/urandom | base64)
+	if v := getenv("EXPORT_SIGNING_KEY"); v != "" {
+		if cfg.exportSigningKey, err = bundle.ParsePrivateKey(v); err != nil {
+			return config{}, fmt.Errorf("invalid EXPORT_SIGNING_KEY: %w", err)
+		}
+	}
+	if cfg.exportTrustedKeys, err = bundle.ParsePublicKeys(getenv("EXPORT_TRUSTED_KEYS")); err != nil {
+		return config{}, fmt.Errorf("invalid EXPORT_TRUSTED_KEYS: %w", err)
+	}
+	if cfg.syncConflicts, err = parseConflictStrategy(envString("SYNC_CONFLICT_STRATEGY", string(lastWriteWins))); err != nil {
+		return config{}, fmt.Errorf("invalid SYNC_CONFLICT_STRATEGY: %w", err)
+	}
+	if len(cfg.exportTrustedKeys) == 0 && cfg.exportSigningKey != nil {
+		// bundles exported by this instance can always be imported back
+		cfg.exportTrustedKeys = []ed25519.PublicKey{cfg.exportSigningKey.Public().(ed25519.PublicKey)}
+	}
+	return cfg, nil
+}
+
+var (
+	// configMu keeps reloads from loading the config concurrently.
+	configMu sync.Mutex
+	// configFile holds the values of CONFIG_FILE while the config loads.
+	configFile map[string]string
+)
+
+// getenv returns the value of key in CONFIG_FILE, or else in the
+// environment. The file wins, so editing it and reloading changes settings
+// the environment set at startup.
+func getenv(key string) string {
+	if v, ok := configFile[key]; ok {
+		return v
+	}
+	return os.Getenv(key)
+}
+
+// readConfigFile reads KEY=value lines, like an env file. Lines starting
+// with "#" are comments, and values may be quoted.
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: want KEY=value", i+1)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func envString(key, fallback string) string {
+	if v := getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
+
+func envInt(key string, fallback int) (int, error) {
+	v := getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return i, nil
+}
+
+func envFloat(key string, fallback float64) (float64, error) {
+	v := getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// envList splits a comma-separated list, leaving out empty items.
+func envList(key string) []string {
+	list := []string{}
+	for _, item := range strings.Split(getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseOTLPHeaders reads a list like "api-key=secret,tenant=a%20b", with
+// URL-encoded values.
+func parseOTLPHeaders(list string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: want key=value, got %q", item)
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+		}
+		headers[strings.TrimSpace(key)] = value
+	}
+	return headers, nil
+}
+
+// parseIPPolicy reads the countries to block or challenge, like
+// GEO_BLOCK_COUNTRIES=KP,IR, and the action for blocklisted addresses.
+func parseIPPolicy() (iprep.Policy, error) {
+	policy := iprep.Policy{Countries: map[string]iprep.Action{}}
+	for _, country := range envList("GEO_CHALLENGE_COUNTRIES") {
+		policy.Countries[strings.ToUpper(country)] = iprep.Challenge
+	}
+	for _, country := range envList("GEO_BLOCK_COUNTRIES") {
+		policy.Countries[strings.ToUpper(country)] = iprep.Block
+	}
+	var err error
+	policy.Listed, err = iprep.ParseAction(envString("IP_BLOCKLIST_ACTION", "block"))
+	if err != nil {
+		return iprep.Policy{}, fmt.Errorf("invalid IP_BLOCKLIST_ACTION: %w", err)
+	}
+	return policy, nil
+}
+
+// parsePasswordClasses sets the character classes a password policy
+// requires from a list like "lower,upper,digit,symbol".
+func parsePasswordClasses(v string, policy *database.PasswordPolicy) error {
+	for _, class := range strings.Split(v, ",") {
+		switch strings.TrimSpace(class) {
+		case "":
+		case "lower":
+			policy.RequireLower = true
+		case "upper":
+			policy.RequireUpper = true
+		case "digit":
+			policy.RequireDigit = true
+		case "symbol":
+			policy.RequireSymbol = true
+		default:
+			return fmt.Errorf("invalid PASSWORD_REQUIRE: %q isn't lower, upper, digit or symbol", class)
+		}
+	}
+	return nil
+}
+
+func envBool(key string, fallback bool) (bool, error) {
+	v := getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// dashboardPage shows dashboardData, refreshed every few seconds. It has no
+// external assets so it works on private networks.
+//
+//go:embed dashboard/index.html
+var dashboardPage []byte
+
+// dashboardMaxErrors bounds the recent errors shown on the dashboard.
+const dashboardMaxErrors = 20
+
+// dashboardData is what GET /admin/dashboard shows, read from the metrics
+// history, the job queue and the database.
+type dashboardData struct {
+	Time     time.Time        `json:"time"`
+	Queue    queueDepth       `json:"queue"`
+	Errors   []recentError    `json:"errors"`
+	Requests []requestRate    `json:"requests"`
+	Storage  dashboardStorage `json:"storage"`
+}
+
+// queueDepth counts the background jobs by status, and the jobs waiting to
+// run by kind.
+type queueDepth struct {
+	Pending int            `json:"pending"`
+	Running int            `json:"running"`
+	Failed  int            `json:"failed"`
+	Kinds   map[string]int `json:"kinds"`
+}
+
+// recentError is the last error of a job, failed or waiting for a retry.
+type recentError struct {
+	Time    time.Time          `json:"time"`
+	JobID   string             `json:"jobId"`
+	Kind    string             `json:"kind"`
+	Status  database.JobStatus `json:"status"`
+	Message string             `json:"message"`
+}
+
+// requestRate is the rate of requests between two metrics snapshots, and of
+// those answered with a 5xx.
+type requestRate struct {
+	Time            time.Time `json:"time"`
+	PerSecond       float64   `json:"perSecond"`
+	ErrorsPerSecond float64   `json:"errorsPerSecond"`
+}
+
+type dashboardStorage struct {
+	Database  int64                    `json:"database"`
+	Media     int64                    `json:"media"`
+	AuditLog  int64                    `json:"auditLog"`
+	WAL       int64                    `json:"wal"`
+	Integrity database.IntegrityStatus `json:"integrity"`
+}
+
+func (apiCfg apiConfig) handlerAdminDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
+
+// dashboardDataHandler serves the dashboard's figures with the metrics
+// snapshots kept in history.
+func (apiCfg apiConfig) dashboardDataHandler(history *metricsHistory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerAdminDashboardData(w, r, history)
+	}
+}
+
+// handlerAdminDashboardData returns the dashboard's figures. Request rates
+// cover the metrics snapshots kept in history.
+func (apiCfg apiConfig) handlerAdminDashboardData(w http.ResponseWriter, r *http.Request, history *metricsHistory) {
+	data := dashboardData{Time: time.Now().UTC(), Requests: requestRates(history.last(history.size))}
+
+	// read the queue
+	jobs, err := apiCfg.dbClient.GetJobs()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	data.Queue, data.Errors = summarizeJobs(jobs, dashboardMaxErrors)
+
+	// measure storage
+	colls, err := apiCfg.dbClient.Collections()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	usage, err := measureStorage(colls, 0)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	data.Storage.Database = usage.Database
+	data.Storage.Media = usage.Media.Bytes
+	if apiCfg.audit != nil {
+		data.Storage.AuditLog, err = apiCfg.audit.Size()
+	}
+	if err == nil {
+		data.Storage.WAL, err = fileSize(apiCfg.dbClient.WALPath())
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	data.Storage.Integrity = apiCfg.dbClient.Integrity()
+	respondWithJSON(w, http.StatusOK, data)
+}
+
+// summarizeJobs counts jobs by status and returns the latest errors of
+// jobs, newest first.
+func summarizeJobs(jobs []database.Job, maxErrors int) (queueDepth, []recentError) {
+	queue := queueDepth{Kinds: map[string]int{}}
+	errs := []recentError{}
+	for _, job := range jobs {
+		switch job.Status {
+		case database.JobPending:
+			queue.Pending++
+			queue.Kinds[job.Kind]++
+		case database.JobRunning:
+			queue.Running++
+		case database.JobFailed:
+			queue.Failed++
+		}
+		if job.LastError != "" && job.Status != database.JobDone {
+			errs = append(errs, recentError{Time: job.UpdatedAt, JobID: job.ID, Kind: job.Kind, Status: job.Status, Message: job.LastError})
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Time.After(errs[j].Time)
+	})
+	if len(errs) > maxErrors {
+		errs = errs[:maxErrors]
+	}
+	return queue, errs
+}
+
+// requestRates returns the request rates between consecutive snapshots,
+// oldest first.
+func requestRates(snapshots []metricsSnapshot) []requestRate {
+	rates := []requestRate{}
+	for i := 1; i < len(snapshots); i++ {
+		seconds := snapshots[i].Time.Sub(snapshots[i-1].Time).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+		requests, errs := requestTotals(snapshots[i])
+		previousRequests, previousErrs := requestTotals(snapshots[i-1])
+		rates = append(rates, requestRate{
+			Time:            snapshots[i].Time,
+			PerSecond:       float64(requests-previousRequests) / seconds,
+			ErrorsPerSecond: float64(errs-previousErrs) / seconds,
+		})
+	}
+	return rates
+}
+
+// requestTotals returns the requests counted in a snapshot, and those
+// answered with a 5xx.
+func requestTotals(snapshot metricsSnapshot) (int64, int64) {
+	var requests, errs int64
+	for _, count := range snapshot.Requests {
+		requests += count.Count
+		if count.Status >= 500 {
+			errs += count.Count
+		}
+	}
+	return requests, errs
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestAdminDashboard(t *testing.T) {
+	c := database.NewMemoryClient()
+	now := time.Now().UTC()
+	for _, job := range []struct {
+		kind      string
+		status    database.JobStatus
+		lastError string
+	}{
+		{kind: jobSendEmail, status: database.JobPending},
+		{kind: jobSendEmail, status: database.JobPending, lastError: "connection refused"},
+		{kind: "export", status: database.JobRunning},
+		{kind: "export", status: database.JobFailed, lastError: "disk full"},
+		{kind: "export", status: database.JobDone, lastError: "timeout"},
+	} {
+		created, err := c.CreateJob(job.kind, nil, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		created.Status, created.LastError = job.status, job.lastError
+		err = c.UpdateJob(created)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := newMetricsHistory(3, nil)
+	for i, counts := range [][]requestCount{
+		{{Method: "GET", Status: 200, Count: 10}},
+		{{Method: "GET", Status: 200, Count: 30}, {Method: "GET", Status: 500, Count: 10}},
+	} {
+		err := history.record(metricsSnapshot{Time: now.Add(time.Duration(i) * 10 * time.Second), Requests: counts})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	apiCfg := apiConfig{dbClient: c}
+
+	w := httptest.NewRecorder()
+	apiCfg.handlerAdminDashboard(w, httptest.NewRequest(http.MethodGet, "/admin/dashboard", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") || !strings.Contains(w.Body.String(), "dashboard/data") {
+		t.Errorf("got status %d with %q, want the dashboard page", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	w = httptest.NewRecorder()
+	apiCfg.dashboardDataHandler(history)(w, httptest.NewRequest(http.MethodGet, "/admin/dashboard/data", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	data := dashboardData{}
+	err := json.NewDecoder(w.Body).Decode(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Queue.Pending != 2 || data.Queue.Running != 1 || data.Queue.Failed != 1 || data.Queue.Kinds[jobSendEmail] != 2 {
+		t.Errorf("got queue %+v, want 2 emails pending, 1 running and 1 failed", data.Queue)
+	}
+	messages := map[string]bool{}
+	for _, e := range data.Errors {
+		messages[e.Message] = true
+	}
+	if len(data.Errors) != 2 || !messages["connection refused"] || !messages["disk full"] {
+		t.Errorf("got errors %+v, want those of the retried and failed jobs", data.Errors)
+	}
+	if len(data.Requests) != 1 || data.Requests[0].PerSecond != 3 || data.Requests[0].ErrorsPerSecond != 1 {
+		t.Errorf("got request rates %+v, want 3/s with 1 error/s", data.Requests)
+	}
+	if !data.Storage.Integrity.OK || data.Storage.Database == 0 {
+		t.Errorf("got storage %+v, want a healthy, measured database", data.Storage)
+	}
+}
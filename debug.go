@@ -0,0 +1,16 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// registerDebugRoutes serves the runtime profiles under /debug/pprof/. They
+// expose internals, so they only belong on a private listener.
+func registerDebugRoutes(serveMux *http.ServeMux) {
+	serveMux.HandleFunc("/debug/pprof/", pprof.Index)
+	serveMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	serveMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	serveMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	serveMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// deprecationMaxClients bounds the memory used by the report, later
+	// clients are counted together.
+	deprecationMaxClients = 1000
+	deprecationOtherAgent = "(other)"
+	maxUserAgentLength    = 200
+)
+
+// deprecationTracker counts the calls to the unversioned legacy routes by
+// route and client, so they can be removed once nothing calls them. Clients
+// don't have API keys, so they are told apart by their User-Agent.
+type deprecationTracker struct {
+	since time.Time
+	now   func() time.Time
+
+	mu    sync.Mutex
+	usage map[deprecationKey]*deprecatedRouteUsage
+}
+
+type deprecationKey struct {
+	route     string
+	userAgent string
+}
+
+type deprecatedRouteUsage struct {
+	Route     string    `json:"route"`
+	UserAgent string    `json:"userAgent"`
+	Requests  int       `json:"requests"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+type deprecationReport struct {
+	// Since is when counting started, the report doesn't survive restarts.
+	Since time.Time              `json:"since"`
+	Usage []deprecatedRouteUsage `json:"usage"`
+}
+
+func newDeprecationTracker() *deprecationTracker {
+	return &deprecationTracker{
+		since: time.Now().UTC(),
+		now:   time.Now,
+		usage: map[deprecationKey]*deprecatedRouteUsage{},
+	}
+}
+
+// record counts a call to the legacy route. A nil tracker records nothing.
+func (d *deprecationTracker) record(route, userAgent string) {
+	if d == nil {
+		return
+	}
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	now := d.now().UTC()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := deprecationKey{route: route, userAgent: userAgent}
+	usage, ok := d.usage[key]
+	if !ok && len(d.usage) >= deprecationMaxClients {
+		key.userAgent = deprecationOtherAgent
+		usage, ok = d.usage[key]
+	}
+	if !ok {
+		usage = &deprecatedRouteUsage{Route: key.route, UserAgent: key.userAgent, FirstSeen: now}
+		d.usage[key] = usage
+	}
+	usage.Requests++
+	usage.LastSeen = now
+}
+
+// report returns the usage, most recently seen first.
+func (d *deprecationTracker) report() deprecationReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	report := deprecationReport{Since: d.since, Usage: []deprecatedRouteUsage{}}
+	for _, usage := range d.usage {
+		report.Usage = append(report.Usage, *usage)
+	}
+	sort.Slice(report.Usage, func(i, j int) bool {
+		if !report.Usage[i].LastSeen.Equal(report.Usage[j].LastSeen) {
+			return report.Usage[i].LastSeen.After(report.Usage[j].LastSeen)
+		}
+		if report.Usage[i].Route != report.Usage[j].Route {
+			return report.Usage[i].Route < report.Usage[j].Route
+		}
+		return report.Usage[i].UserAgent < report.Usage[j].UserAgent
+	})
+	return report
+}
+
+func (apiCfg apiConfig) handlerAdminDeprecations(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, apiCfg.deprecations.report())
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/jobs"
+	"github.com/firyx/boot.dev-api-backend/internal/mail"
+)
+
+// emailFiles holds the email templates, see mail.Templates for the layout.
+//
+//go:embed emails
+var emailFiles embed.FS
+
+// jobSendEmail delivers a queued email, see sendEmailJob.
+const jobSendEmail = "email.send"
+
+type sendEmailJob struct {
+	EmailID string `json:"emailId"`
+}
+
+var errEmailDisabled = apiError{Code: codeNotImplemented, Message: "email is disabled, set SMTP_ADDR to send email"}
+
+// mailer renders emails from templates and sends them through the job
+// queue. Every email is recorded in the main database, whichever tenant it
+// was sent for, so its delivery can be followed from GET /admin/emails.
+type mailer struct {
+	db        database.Client
+	templates *mail.Templates
+	// pool is nil when SMTP_ADDR isn't set, emails aren't sent then.
+	pool        *mail.Pool
+	jobs        *jobs.Queue
+	maxAttempts int
+	// writes serializes updates to the email records, the database doesn't
+	// stop concurrent writes from undoing each other.
+	writes sync.Mutex
+}
+
+func newMailer(cfg config, db database.Client, queue *jobs.Queue) (*mailer, error) {
+	files, err := fs.Sub(emailFiles, "emails")
+	if err != nil {
+		return nil, err
+	}
+	templates, err := mail.ParseTemplates(files)
+	if err != nil {
+		return nil, err
+	}
+	m := &mailer{db: db, templates: templates, jobs: queue, maxAttempts: cfg.jobMaxAttempts}
+	if cfg.smtpAddr == "" {
+		return m, nil
+	}
+	m.pool, err = mail.NewPool(mail.Options{
+		Addr:        cfg.smtpAddr,
+		Username:    cfg.smtpUsername,
+		Password:    cfg.smtpPassword,
+		From:        cfg.smtpFrom,
+		Size:        cfg.smtpPoolSize,
+		IdleTimeout: cfg.smtpIdleTimeout,
+		Timeout:     cfg.smtpTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (apiCfg apiConfig) emailEnabled() bool {
+	return apiCfg.mailer != nil && apiCfg.mailer.pool != nil
+}
+
+// sendEmail queues the template rendered with data for delivery to to.
+func (apiCfg apiConfig) sendEmail(to, template string, data interface{}) (database.Email, error) {
+	if !apiCfg.emailEnabled() {
+		return database.Email{}, errEmailDisabled
+	}
+	return apiCfg.mailer.send(apiCfg.dbClient.Context(), apiCfg.tenantID, to, template, data)
+}
+
+// sendWelcomeEmail welcomes a user who signed up, when email is enabled.
+func (apiCfg apiConfig) sendWelcomeEmail(user database.User) {
+	if !apiCfg.emailEnabled() {
+		return
+	}
+	_, err := apiCfg.sendEmail(user.Email, "welcome", map[string]interface{}{
+		"Name":  user.Name,
+		"Email": user.Email,
+	})
+	if err != nil {
+		log.Printf("welcome email: %v", err)
+	}
+}
+
+// send stores the email, and queues or delivers it, as part of the database
+// transaction of ctx, if any.
+func (m *mailer) send(ctx context.Context, tenantID, to, template string, data interface{}) (database.Email, error) {
+	// render now so bad data fails the caller rather than the job
+	msg, err := m.templates.Render(template, data)
+	if err != nil {
+		return database.Email{}, err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return database.Email{}, err
+	}
+	m.writes.Lock()
+	email, err := m.db.WithContext(ctx).CreateEmail(database.Email{
+		TenantID: tenantID,
+		To:       to,
+		Template: template,
+		Subject:  msg.Subject,
+		Data:     raw,
+	})
+	m.writes.Unlock()
+	if err != nil {
+		return database.Email{}, err
+	}
+	if m.jobs == nil {
+		// delivered even if the client goes away meanwhile
+		return email, m.deliver(context.WithoutCancel(ctx), email)
+	}
+	_, err = m.jobs.Enqueue(ctx, jobSendEmail, sendEmailJob{EmailID: email.ID})
+	return email, err
+}
+
+func (m *mailer) runSendEmailJob(ctx context.Context, payload json.RawMessage) error {
+	job := sendEmailJob{}
+	err := json.Unmarshal(payload, &job)
+	if err != nil {
+		return err
+	}
+	email, err := m.db.GetEmail(job.EmailID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if email.Status != database.EmailQueued {
+		// sent before the job could be marked done
+		return nil
+	}
+	return m.deliver(ctx, email)
+}
+
+// deliver sends email and records the outcome. It's marked failed once it
+// ran out of attempts.
+func (m *mailer) deliver(ctx context.Context, email database.Email) error {
+	var data interface{}
+	err := json.Unmarshal(email.Data, &data)
+	if err != nil {
+		return err
+	}
+	msg, err := m.templates.Render(email.Template, data)
+	if err == nil {
+		msg.To = email.To
+		err = m.pool.Send(ctx, msg)
+	}
+
+	email.Attempts++
+	if err == nil {
+		now := time.Now().UTC()
+		email.Status = database.EmailSent
+		email.SentAt = &now
+		email.LastError = ""
+	} else {
+		email.LastError = err.Error()
+		if email.Attempts >= m.maxAttempts {
+			email.Status = database.EmailFailed
+		}
+	}
+	m.writes.Lock()
+	updateErr := m.db.WithContext(ctx).UpdateEmail(email)
+	m.writes.Unlock()
+	return errors.Join(err, updateErr)
+}
+
+// handlerAdminEmails lists sent and queued emails, newest first, filtered
+// by ?status=, ?template= and ?tenant=.
+func (apiCfg apiConfig) handlerAdminEmails(w http.ResponseWriter, r *http.Request) {
+	// get params
+	query := r.URL.Query()
+	status := database.EmailStatus(query.Get("status"))
+	switch status {
+	case "", database.EmailQueued, database.EmailSent, database.EmailFailed:
+	default:
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("status must be queued, sent or failed")))
+		return
+	}
+	template := query.Get("template")
+	_, filterTenant := query["tenant"]
+	tenantID := query.Get("tenant")
+	pg, err := apiCfg.pagination.parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// return emails
+	all, err := apiCfg.mailer.db.GetEmails()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	emails := []database.Email{}
+	for _, email := range all {
+		if (status == "" || email.Status == status) && (template == "" || email.Template == template) && (!filterTenant || email.TenantID == tenantID) {
+			emails = append(emails, email)
+		}
+	}
+	respondWithJSON(w, http.StatusOK, paginate(w, r, emails, pg))
+}
+
+// adminEmailRoutes are the routes below /admin/emails/.
+var adminEmailRoutes = newRoutes([]route{
+	{http.MethodGet, "/templates", apiConfig.handlerAdminEmailTemplates},
+	{http.MethodPost, "/templates/{name}/test", apiConfig.handlerAdminTestEmail},
+	{http.MethodGet, "/{id}", apiConfig.handlerAdminGetEmail},
+})
+
+func (apiCfg apiConfig) endpointAdminEmailHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(adminEmailRoutes, "/admin/emails", w, r)
+}
+
+// handlerAdminGetEmail returns one email with its delivery status.
+func (apiCfg apiConfig) handlerAdminGetEmail(w http.ResponseWriter, r *http.Request) {
+	// check path
+	id, err := trimPrefix(r.URL.Path, "/admin/emails/", "not a valid URL: %s{id}")
+	if err != nil || id == "" || strings.Contains(id, "/") {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /admin/emails/{id}"))
+		return
+	}
+
+	// return email
+	email, err := apiCfg.mailer.db.GetEmail(id)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, email)
+}
+
+type emailTemplate struct {
+	Name string `json:"name"`
+	// Sample is the data test emails are rendered with.
+	Sample json.RawMessage `json:"sample,omitempty"`
+}
+
+func (apiCfg apiConfig) handlerAdminEmailTemplates(w http.ResponseWriter, r *http.Request) {
+	templates := []emailTemplate{}
+	for _, name := range apiCfg.mailer.templates.Names() {
+		templates = append(templates, emailTemplate{Name: name, Sample: apiCfg.mailer.templates.Sample(name)})
+	}
+	respondWithJSON(w, http.StatusOK, templates)
+}
+
+// handlerAdminTestEmail sends a template to an address, rendered with the
+// template's sample data unless data is given.
+func (apiCfg apiConfig) handlerAdminTestEmail(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		To   string          `json:"to"`
+		Data json.RawMessage `json:"data"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	// check path
+	name, err := trimPrefix(r.URL.Path, "/admin/emails/templates/", "not a valid URL: %s{name}/test")
+	name = strings.TrimSuffix(name, "/test")
+	if err != nil || name == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /admin/emails/templates/{name}/test"))
+		return
+	}
+
+	// check template
+	if !apiCfg.mailer.templates.Has(name) {
+		respondWithError(w, http.StatusNotFound, apiError{Code: codeNotFound, Message: "template doesn't exist"})
+		return
+	}
+	if _, err := netmail.ParseAddress(params.To); err != nil {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("to must be an email address")))
+		return
+	}
+	raw := params.Data
+	if len(raw) == 0 {
+		raw = apiCfg.mailer.templates.Sample(name)
+	}
+	var data interface{} = map[string]interface{}{}
+	if len(raw) > 0 {
+		err = json.Unmarshal(raw, &data)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, validationFailed(err))
+			return
+		}
+	}
+	if _, err := apiCfg.mailer.templates.Render(name, data); err != nil {
+		respondWithError(w, http.StatusBadRequest, validationFailed(err))
+		return
+	}
+
+	// queue email
+	email, err := apiCfg.sendEmail(params.To, name, data)
+	if errors.Is(err, errEmailDisabled) {
+		respondWithError(w, http.StatusNotImplemented, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, email)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/mail"
+)
+
+func newTestMailer(t *testing.T, cfg config) *mailer {
+	c := database.NewMemoryClient()
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newMailer(cfg, c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestEmailTemplatesRenderSamples(t *testing.T) {
+	m := newTestMailer(t, config{})
+	for _, name := range m.templates.Names() {
+		var data interface{}
+		err := json.Unmarshal(m.templates.Sample(name), &data)
+		if err != nil {
+			t.Errorf("%s: sample: %v", name, err)
+			continue
+		}
+		msg, err := m.templates.Render(name, data)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if msg.Subject == "" || msg.Text == "" || msg.HTML == "" {
+			t.Errorf("%s: got %+v, want a subject, text and HTML", name, msg)
+		}
+	}
+}
+
+func TestDeliverRecordsAttempts(t *testing.T) {
+	// nothing listens on the address once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	m := newTestMailer(t, config{jobMaxAttempts: 2})
+	m.pool, err = mail.NewPool(mail.Options{Addr: listener.Addr().String(), From: "no-reply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	email, err := m.send(context.Background(), "acme", "ada@example.com", "welcome", map[string]interface{}{"Name": "Ada", "Email": "ada@example.com"})
+	if err == nil {
+		t.Fatal("expected sending to an unreachable server to fail")
+	}
+	var tests = []struct {
+		status   database.EmailStatus
+		attempts int
+	}{
+		{database.EmailQueued, 1},
+		{database.EmailFailed, 2},
+	}
+	for i, tt := range tests {
+		if i > 0 {
+			if err := m.deliver(context.Background(), email); err == nil {
+				t.Fatal("expected sending to an unreachable server to fail")
+			}
+		}
+		email, err = m.db.GetEmail(email.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if email.Status != tt.status || email.Attempts != tt.attempts || email.LastError == "" {
+			t.Errorf("got status %s after %d attempts (%q), want %s after %d", email.Status, email.Attempts, email.LastError, tt.status, tt.attempts)
+		}
+	}
+	if email.TenantID != "acme" || email.Subject != "Welcome, Ada!" {
+		t.Errorf("got tenant %q and subject %q, want acme and Welcome, Ada!", email.TenantID, email.Subject)
+	}
+}
+
+func TestAdminTestEmail(t *testing.T) {
+	apiCfg := apiConfig{mailer: newTestMailer(t, config{})}
+
+	var tests = []struct {
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{"/admin/emails/templates/missing/test", `{"to": "ada@example.com"}`, http.StatusNotFound},
+		{"/admin/emails/templates/welcome/test", `{"to": "not an address"}`, http.StatusBadRequest},
+		{"/admin/emails/templates/welcome/test", `{"to": "ada@example.com", "data": {"Name": "Ada"}}`, http.StatusBadRequest},
+		{"/admin/emails/templates/welcome/test", `{"to": "ada@example.com"}`, http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		apiCfg.endpointAdminEmailHandler(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+		if w.Code != tt.expectedStatus {
+			t.Errorf("POST %s %s: got status %d, want %d: %s", tt.path, tt.body, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	apiCfg.endpointAdminEmailHandler(w, httptest.NewRequest(http.MethodGet, "/admin/emails/templates", nil))
+	templates := []emailTemplate{}
+	err := json.NewDecoder(w.Body).Decode(&templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, template := range templates {
+		names = append(names, template.Name)
+	}
+	expected := "new_login password_reset streak_at_risk verify_recovery_email welcome"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("got templates %v, want %s", names, expected)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/errreport"
+)
+
+type contextKey string
+
+const userIDContextKey contextKey = "userID"
+
+// withUserID attaches the ID of the user making the request to ctx, so error
+// reports can name the affected user.
+func withUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDContextKey, userID)
+}
+
+func userIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDContextKey).(string)
+	return userID
+}
+
+// sessionMiddleware attaches the user whose session token came with a
+// request to its context, for the error reports and the audit log. Requests
+// without a valid session go through as they are, handlers still check
+// sessions themselves.
+func (apiCfg apiConfig) sessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if userID, err := apiCfg.authenticatedUserID(r); err == nil {
+			r = r.WithContext(withUserID(r.Context(), userID))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type errorReporting struct {
+	reporter errreport.Reporter
+	release  string
+}
+
+// middleware reports 5xx responses. Panics are reported by panicRecovery.
+func (e errorReporting) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &errorRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status >= 500 {
+			e.report(r, errreport.LevelError, recorder.errorMessage(), "")
+		}
+	})
+}
+
+func (e errorReporting) report(r *http.Request, level errreport.Level, message, stack string) {
+	e.reporter.Report(r.Context(), errreport.Event{
+		Time:    time.Now().UTC(),
+		Level:   level,
+		Message: message,
+		Stack:   stack,
+		Release: e.release,
+		UserID:  userIDFromContext(r.Context()),
+		Request: r,
+		Tags:    map[string]string{"request_id": requestIDFromContext(r.Context())},
+	})
+}
+
+// errorRecorder keeps the body of 5xx responses so the error message can be
+// reported.
+type errorRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *errorRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *errorRecorder) Write(p []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.status >= 500 {
+		r.body.Write(p)
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *errorRecorder) errorMessage() string {
+	body := errorBody{}
+	err := json.Unmarshal(r.body.Bytes(), &body)
+	if err != nil || body.Message == "" {
+		return fmt.Sprintf("%d %s", r.status, http.StatusText(r.status))
+	}
+	return body.Message
+}
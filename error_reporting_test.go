@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/errreport"
+)
+
+type fakeReporter struct {
+	events []errreport.Event
+}
+
+func (f *fakeReporter) Report(ctx context.Context, event errreport.Event) {
+	f.events = append(f.events, event)
+}
+
+func TestErrorReportingMiddleware(t *testing.T) {
+	var tests = []struct {
+		handler        http.HandlerFunc
+		expectedStatus int
+		expectedEvents int
+		expectedLevel  errreport.Level
+		expectedMsg    string
+	}{
+		{
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				respondWithJSON(w, http.StatusOK, struct{}{})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				respondWithError(w, http.StatusBadRequest, errors.New("bad"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				respondWithError(w, http.StatusInternalServerError, errors.New("disk full"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedEvents: 1,
+			expectedLevel:  errreport.LevelError,
+			expectedMsg:    "disk full",
+		},
+	}
+	for _, tt := range tests {
+		reporter := &fakeReporter{}
+		handler := errorReporting{reporter: reporter, release: "test"}.middleware(tt.handler)
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req = req.WithContext(withUserID(req.Context(), "test@example.com"))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.expectedStatus {
+			t.Errorf("got status %d, want %d", w.Code, tt.expectedStatus)
+		}
+		if len(reporter.events) != tt.expectedEvents {
+			t.Errorf("got %d events, want %d", len(reporter.events), tt.expectedEvents)
+			continue
+		}
+		if tt.expectedEvents == 0 {
+			continue
+		}
+		event := reporter.events[0]
+		if event.Level != tt.expectedLevel || event.Message != tt.expectedMsg {
+			t.Errorf("got %s %q, want %s %q", event.Level, event.Message, tt.expectedLevel, tt.expectedMsg)
+		}
+		if event.UserID != "test@example.com" || event.Release != "test" {
+			t.Errorf("missing context in event: %+v", event)
+		}
+	}
+}
+
+func TestErrorReportsNameTheUser(t *testing.T) {
+	c := database.NewMemoryClient()
+	user, err := c.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{dbClient: c, auth: authConfig{secret: []byte("secret")}}
+	token, err := auth.Sign(apiCfg.auth.secret, auth.NewClaims(user.ID, time.Now(), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter := &fakeReporter{}
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondWithError(w, http.StatusInternalServerError, errors.New("disk full"))
+	})
+	handler := apiCfg.sessionMiddleware(errorReporting{reporter: reporter}.middleware(failing))
+
+	for _, tt := range []struct {
+		name     string
+		token    string
+		expected string
+	}{
+		{name: "logged in", token: token, expected: user.ID},
+		{name: "invalid token", token: "invalid", expected: ""},
+		{name: "anonymous", expected: ""},
+	} {
+		reporter.events = nil
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if len(reporter.events) != 1 || reporter.events[0].UserID != tt.expected {
+			t.Errorf("%s: got events %+v, want one for user %q", tt.name, reporter.events, tt.expected)
+		}
+	}
+}
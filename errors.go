@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+type errorCode string
+
+const (
+	codeInvalidRequest     errorCode = "INVALID_REQUEST"
+	codeInvalidPath        errorCode = "INVALID_PATH"
+	codeValidationFailed   errorCode = "VALIDATION_FAILED"
+	codeMethodNotSupported errorCode = "METHOD_NOT_SUPPORTED"
+	codeNotFound           errorCode = "NOT_FOUND"
+	codeUserNotFound       errorCode = "USER_NOT_FOUND"
+	codePostNotFound       errorCode = "POST_NOT_FOUND"
+	codeRevisionNotFound   errorCode = "REVISION_NOT_FOUND"
+	codeConflict           errorCode = "CONFLICT"
+	codeUserAlreadyExists  errorCode = "USER_ALREADY_EXISTS"
+	codePageSizeTooLarge   errorCode = "PAGE_SIZE_TOO_LARGE"
+	codeMediaTooLarge      errorCode = "MEDIA_TOO_LARGE"
+	codeRequestTooLarge    errorCode = "REQUEST_TOO_LARGE"
+	codePostTooLong        errorCode = "POST_TOO_LONG"
+	codePostRejected       errorCode = "POST_REJECTED"
+	codeUnsupportedMedia   errorCode = "UNSUPPORTED_MEDIA_TYPE"
+	codeNotImplemented     errorCode = "NOT_IMPLEMENTED"
+	codeInvalidCredentials errorCode = "INVALID_CREDENTIALS"
+	codeAccountLocked      errorCode = "ACCOUNT_LOCKED"
+	codeUserSuspended      errorCode = "USER_SUSPENDED"
+	codeSignupRejected     errorCode = "SIGNUP_REJECTED"
+	codeSignupPending      errorCode = "SIGNUP_PENDING_REVIEW"
+	codeTOTPRequired       errorCode = "TOTP_REQUIRED"
+	codeInvalidToken       errorCode = "INVALID_TOKEN"
+	codePasswordPolicy     errorCode = "PASSWORD_POLICY_VIOLATED"
+	codeUnauthorized       errorCode = "UNAUTHORIZED"
+	codeForbidden          errorCode = "FORBIDDEN"
+	codeTenantNotFound     errorCode = "TENANT_NOT_FOUND"
+	codeTooManyRequests    errorCode = "TOO_MANY_REQUESTS"
+	codeRequestBlocked     errorCode = "REQUEST_BLOCKED"
+	codePostQuotaExceeded  errorCode = "POST_QUOTA_EXCEEDED"
+	codeAttachmentQuota    errorCode = "ATTACHMENT_QUOTA_EXCEEDED"
+	codeInternal           errorCode = "INTERNAL_ERROR"
+	codeInvalidConfig      errorCode = "INVALID_CONFIG"
+	codeSyncTokenExpired   errorCode = "SYNC_TOKEN_EXPIRED"
+)
+
+type errorBody struct {
+	Code      errorCode   `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+}
+
+// apiError is an error with a machine readable code for clients.
+type apiError struct {
+	Code    errorCode
+	Message string
+	Details interface{}
+}
+
+func (e apiError) Error() string {
+	return e.Message
+}
+
+var (
+	errMethodNotSupported = apiError{Code: codeMethodNotSupported, Message: "method not supported"}
+	errUserNotFound       = apiError{Code: codeUserNotFound, Message: "user doesn't exist"}
+	errUserAlreadyExists  = apiError{Code: codeUserAlreadyExists, Message: "user with that email already exists"}
+	errPostNotFound       = apiError{Code: codePostNotFound, Message: "post with that id doesn't exist"}
+	errRevisionNotFound   = apiError{Code: codeRevisionNotFound, Message: "post has no revision with that number"}
+)
+
+func invalidPath(message string) apiError {
+	return apiError{Code: codeInvalidPath, Message: message}
+}
+
+func validationFailed(err error) apiError {
+	return apiError{Code: codeValidationFailed, Message: err.Error()}
+}
+
+func respondWithError(w http.ResponseWriter, code int, err error) {
+	// handlers fail decoding bodies cut off by bodyLimitMiddleware as bad
+	// requests
+	if tooLarge := tooLargeError(err); tooLarge != nil && code == http.StatusBadRequest {
+		code, err = http.StatusRequestEntityTooLarge, tooLarge
+	}
+	body := errorBody{
+		Code:      errorCodeFor(code, err),
+		Message:   err.Error(),
+		RequestID: w.Header().Get(requestIDHeader),
+	}
+	apiErr := apiError{}
+	if errors.As(err, &apiErr) {
+		body.Details = apiErr.Details
+	}
+	respondWithJSON(w, code, body)
+}
+
+// respondWithDBError maps database errors to the matching HTTP status, so a
+// missing record is a 404 and a conflicting one a 409.
+func respondWithDBError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		respondWithError(w, http.StatusNotFound, err)
+	case errors.Is(err, database.ErrAlreadyExists):
+		respondWithError(w, http.StatusConflict, err)
+	default:
+		respondWithError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func errorCodeFor(status int, err error) errorCode {
+	apiErr := apiError{}
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return codeNotFound
+	case errors.Is(err, database.ErrAlreadyExists):
+		return codeConflict
+	}
+	switch status {
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	}
+	if status >= 500 {
+		return codeInternal
+	}
+	return codeInvalidRequest
+}
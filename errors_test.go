@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestRespondWithError(t *testing.T) {
+	var tests = []struct {
+		respond        func(w http.ResponseWriter)
+		expectedStatus int
+		expectedCode   errorCode
+	}{
+		{
+			respond: func(w http.ResponseWriter) {
+				respondWithError(w, http.StatusNotFound, errUserNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   codeUserNotFound,
+		},
+		{
+			respond: func(w http.ResponseWriter) {
+				respondWithError(w, http.StatusBadRequest, errors.New("unexpected EOF"))
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+		},
+		{
+			respond: func(w http.ResponseWriter) {
+				respondWithDBError(w, fmt.Errorf("lookup: %w", database.ErrNotFound))
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   codeNotFound,
+		},
+		{
+			respond: func(w http.ResponseWriter) {
+				respondWithDBError(w, fmt.Errorf("insert: %w", database.ErrAlreadyExists))
+			},
+			expectedStatus: http.StatusConflict,
+			expectedCode:   codeConflict,
+		},
+		{
+			respond: func(w http.ResponseWriter) {
+				respondWithDBError(w, errors.New("disk full"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   codeInternal,
+		},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.respond(w)
+		body := errorBody{}
+		err := json.Unmarshal(w.Body.Bytes(), &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != tt.expectedStatus || body.Code != tt.expectedCode {
+			t.Errorf("got %d %s, want %d %s", w.Code, body.Code, tt.expectedStatus, tt.expectedCode)
+		}
+		if body.Message == "" {
+			t.Errorf("missing message for %s", body.Code)
+		}
+	}
+}
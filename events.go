@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/events"
+)
+
+// Events published on the bus. Data is the record the event is about, for
+// deletions only its ID is set.
+const (
+	eventUserCreated  = "user.created"
+	eventUserUpdated  = "user.updated"
+	eventUserDeleted  = "user.deleted"
+	eventPostCreated  = "post.created"
+	eventPostUpdated  = "post.updated"
+	eventPostDeleted  = "post.deleted"
+	eventBadgeAwarded = "badge.awarded"
+	// follows are updated when a pending one is approved
+	eventFollowCreated  = "follow.created"
+	eventFollowUpdated  = "follow.updated"
+	eventMessageCreated = "message.created"
+)
+
+// publishMutations is a database commit hook turning written records into
+// events, so subscribers see writes from every handler without each one
+// publishing them.
+func publishMutations(bus *events.Bus) func([]database.Mutation) {
+	return func(mutations []database.Mutation) {
+		for _, mutation := range mutations {
+			event, ok, err := mutationEvent(mutation)
+			if err != nil {
+				log.Printf("events: %s %s: %v", mutation.Collection, mutation.Key, err)
+				continue
+			}
+			if ok {
+				bus.Publish(event)
+			}
+		}
+	}
+}
+
+func mutationEvent(mutation database.Mutation) (events.Event, bool, error) {
+	// records put back as they were aren't news
+	if mutation.Restored {
+		return events.Event{}, false, nil
+	}
+	created := mutation.Previous == ""
+	deleted := mutation.Value == nil
+	var event events.Event
+	var err error
+	switch mutation.Collection {
+	case "users":
+		user := database.User{ID: mutation.Key}
+		event.Type = pickEvent(created, deleted, eventUserCreated, eventUserUpdated, eventUserDeleted)
+		if !deleted {
+			err = json.Unmarshal(mutation.Value, &user)
+		}
+		event.Data = user
+	case "posts":
+		post := database.Post{ID: mutation.Key}
+		event.Type = pickEvent(created, deleted, eventPostCreated, eventPostUpdated, eventPostDeleted)
+		if !deleted {
+			err = json.Unmarshal(mutation.Value, &post)
+		}
+		event.Data = post
+	case "badges":
+		if !created || deleted {
+			return events.Event{}, false, nil
+		}
+		badge := database.Badge{}
+		err = json.Unmarshal(mutation.Value, &badge)
+		event = events.Event{Type: eventBadgeAwarded, Data: badge}
+	case "follows":
+		if deleted {
+			return events.Event{}, false, nil
+		}
+		follow := database.Follow{}
+		err = json.Unmarshal(mutation.Value, &follow)
+		event = events.Event{Type: eventFollowUpdated, Data: follow}
+		if created {
+			event.Type = eventFollowCreated
+		}
+	case "messages":
+		if !created || deleted {
+			return events.Event{}, false, nil
+		}
+		message := database.Message{}
+		err = json.Unmarshal(mutation.Value, &message)
+		event = events.Event{Type: eventMessageCreated, Data: message}
+	default:
+		return events.Event{}, false, nil
+	}
+	return event, err == nil, err
+}
+
+func pickEvent(created, deleted bool, createdType, updatedType, deletedType string) string {
+	switch {
+	case deleted:
+		return deletedType
+	case created:
+		return createdType
+	}
+	return updatedType
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/firyx/boot.dev-api-backend/internal/bloom"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+const (
+	// existenceFalsePositiveRate is the share of checks for missing records
+	// that still read the database.
+	existenceFalsePositiveRate = 0.01
+	// existenceMinCapacity leaves room for new records between rebuilds.
+	existenceMinCapacity = 1024
+)
+
+// existenceFilter answers userExists and postExists from memory when the
+// record is definitely missing. Like the search index, writes through the
+// API update it and the scheduler rebuilds it. Deleted records stay in the
+// filter until then, which only costs a database read.
+type existenceFilter struct {
+	// mu stops a rebuild from dropping a write made while it was reading
+	// the database.
+	mu     sync.RWMutex
+	emails *bloom.Filter
+	posts  *bloom.Filter
+}
+
+func newExistenceFilter() *existenceFilter {
+	return &existenceFilter{}
+}
+
+func (f *existenceFilter) rebuild(c database.Client) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	users, err := c.GetAllUsers()
+	if err != nil {
+		log.Printf("existence filter: %v", err)
+		return
+	}
+	posts, err := c.GetAllPosts()
+	if err != nil {
+		log.Printf("existence filter: %v", err)
+		return
+	}
+	emails := bloom.New(existenceCapacity(len(users)), existenceFalsePositiveRate)
+	for _, user := range users {
+		emails.Add(user.Email)
+	}
+	postIDs := bloom.New(existenceCapacity(len(posts)), existenceFalsePositiveRate)
+	for _, post := range posts {
+		postIDs.Add(post.ID)
+	}
+	f.emails = emails
+	f.posts = postIDs
+}
+
+func existenceCapacity(n int) int {
+	if 2*n < existenceMinCapacity {
+		return existenceMinCapacity
+	}
+	return 2 * n
+}
+
+// applyMutations is the database mutation hook adding new records.
+func (f *existenceFilter) applyMutations(mutations []database.Mutation) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.emails == nil {
+		return
+	}
+	for _, mutation := range mutations {
+		if mutation.Value == nil {
+			continue
+		}
+		switch mutation.Collection {
+		case "users":
+			user := database.User{}
+			err := json.Unmarshal(mutation.Value, &user)
+			if err != nil {
+				log.Printf("existence filter: user %s: %v", mutation.Key, err)
+				continue
+			}
+			f.emails.Add(user.Email)
+		case "posts":
+			f.posts.Add(mutation.Key)
+		}
+	}
+}
+
+// MayHaveUser is false only if no user has the email. Before the first
+// rebuild, anything may exist.
+func (f *existenceFilter) MayHaveUser(email string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.emails == nil || f.emails.MayContain(email)
+}
+
+func (f *existenceFilter) MayHavePost(id string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.posts == nil || f.posts.MayContain(id)
+}
+
+// existenceFilterTrusted reports whether negative answers of the filter can
+// be trusted. Replicated writes skip the mutation hooks, so they can't on a
+// secondary. Promotion rebuilds the filter.
+func (apiCfg apiConfig) existenceFilterTrusted() bool {
+	return apiCfg.exists != nil && (apiCfg.replication == nil || apiCfg.replication.IsPrimary())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestExistenceFilter(t *testing.T) {
+	raw := database.NewMemoryClient()
+	err := raw.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists := newExistenceFilter()
+	c := raw.WithMutationHook(exists.applyMutations)
+	apiCfg := apiConfig{dbClient: c, exists: exists}
+
+	// nothing is known missing before the first rebuild
+	if !exists.MayHaveUser("test@example.com") {
+		t.Errorf("got a negative answer before the first rebuild")
+	}
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists.rebuild(c)
+	post, err := c.CreatePost(user.ID, "hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name     string
+		exists   bool
+		expected bool
+	}{
+		{name: "user from rebuild", exists: found(apiCfg.users().Get("test@example.com")), expected: true},
+		{name: "missing user", exists: found(apiCfg.users().Get("nobody@example.com")), expected: false},
+		{name: "post from hook", exists: found(apiCfg.posts().Get(post.ID)), expected: true},
+		{name: "missing post", exists: found(apiCfg.posts().Get("0b4a1d6e-8c1f-4f5e-9a57-5f1a8d0f6b2c")), expected: false},
+	}
+	for _, tt := range tests {
+		if tt.exists != tt.expected {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.exists, tt.expected)
+		}
+	}
+	if exists.MayHaveUser("nobody@example.com") {
+		t.Errorf("got a false positive for nobody@example.com, pick another email")
+	}
+
+	// lookups trust negative answers without reading the database, so a user
+	// written behind the filter's back isn't found
+	_, err = raw.CreateUser("ghost@example.com", "12345", "Ghost", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists.MayHaveUser("ghost@example.com") {
+		t.Fatalf("got a false positive for ghost@example.com, pick another email")
+	}
+	if found(apiCfg.users().Get("by-email/ghost@example.com")) {
+		t.Errorf("lookup read the database for a user the filter doesn't know")
+	}
+}
+
+func found[T any](_ T, err error) bool {
+	return err == nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// parseFields reads the sparse fieldset of ?fields=email,name,createdAt.
+func parseFields(query string) map[string]bool {
+	fields := map[string]bool{}
+	for _, field := range strings.Split(query, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields[field] = true
+		}
+	}
+	return fields
+}
+
+// selectFields keeps only fields of a JSON object, or of each object of a
+// JSON array. Fields the objects don't have are ignored, and other values
+// are left as they are, like everything when fields is empty.
+func selectFields(response []byte, fields map[string]bool) ([]byte, error) {
+	trimmed := bytes.TrimSpace(response)
+	if len(trimmed) == 0 || len(fields) == 0 {
+		return response, nil
+	}
+	switch trimmed[0] {
+	case '{':
+		object := map[string]json.RawMessage{}
+		err := json.Unmarshal(trimmed, &object)
+		if err != nil {
+			return nil, err
+		}
+		for key := range object {
+			if !fields[key] {
+				delete(object, key)
+			}
+		}
+		return json.Marshal(object)
+	case '[':
+		items := []json.RawMessage{}
+		err := json.Unmarshal(trimmed, &items)
+		if err != nil {
+			return nil, err
+		}
+		for i, item := range items {
+			items[i], err = selectFields(item, fields)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(items)
+	default:
+		return response, nil
+	}
+}
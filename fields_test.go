@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSparseFields(t *testing.T) {
+	handler := responseFormatMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			respondWithError(w, http.StatusNotFound, errMethodNotSupported)
+			return
+		}
+		user := map[string]interface{}{"id": "1", "email": "ann@example.com", "name": "Ann", "age": 18}
+		if r.URL.Path == "/users" {
+			respondWithJSON(w, http.StatusOK, []interface{}{user, user})
+			return
+		}
+		respondWithJSON(w, http.StatusOK, user)
+	}))
+
+	var tests = []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{method: http.MethodGet, path: "/user", expected: `{"age":18,"email":"ann@example.com","id":"1","name":"Ann"}`},
+		{method: http.MethodGet, path: "/user?fields=", expected: `{"age":18,"email":"ann@example.com","id":"1","name":"Ann"}`},
+		{method: http.MethodGet, path: "/user?fields=email,name", expected: `{"email":"ann@example.com","name":"Ann"}`},
+		{method: http.MethodGet, path: "/user?fields=name,+missing", expected: `{"name":"Ann"}`},
+		{method: http.MethodGet, path: "/users?fields=id", expected: `[{"id":"1"},{"id":"1"}]`},
+		{method: http.MethodPost, path: "/user?fields=id", expected: `{"age":18,"email":"ann@example.com","id":"1","name":"Ann"}`},
+		// errors are never filtered
+		{method: http.MethodGet, path: "/missing?fields=id", expected: `{"code":"METHOD_NOT_SUPPORTED","message":"method not supported"}`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Body.String() != tt.expected {
+			t.Errorf("%s %s: got %s, want %s", tt.method, tt.path, w.Body, tt.expected)
+		}
+	}
+}
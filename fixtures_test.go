@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/fixtures"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the fixtures from the responses")
+
+// TestFixtures runs the cases of testdata/fixtures, each file against a new
+// server. Run it with -update after changing a response on purpose.
+func TestFixtures(t *testing.T) {
+	files, err := fixtures.Load(filepath.Join("testdata", "fixtures", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		file := file
+		t.Run(strings.TrimSuffix(filepath.Base(file.Path), ".yaml"), func(t *testing.T) {
+			runFixtures(t, file.Cases)
+		})
+	}
+}
+
+func runFixtures(t *testing.T, cases []fixtures.Case) {
+	ts := newTestServer(t, "memory")
+	// vars are filled in from responses and replace {name} in later cases
+	vars := map[string]string{}
+	expand := func(s string) string {
+		for name, value := range vars {
+			s = strings.ReplaceAll(s, "{"+name+"}", value)
+		}
+		return s
+	}
+
+	for _, c := range cases {
+		srv := ts.api
+		if c.Admin {
+			srv = ts.admin
+		}
+		body := ""
+		switch b := c.Request.Body.(type) {
+		case nil:
+		case string:
+			body = b
+		default:
+			data, err := json.Marshal(b)
+			if err != nil {
+				t.Fatalf("%s: %v", c.Name, err)
+			}
+			body = string(data)
+		}
+		req, err := http.NewRequest(c.Request.Method, srv.URL+expand(c.Request.Path), strings.NewReader(expand(body)))
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name, err)
+		}
+		if token := expand(c.Request.Token); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		for name, value := range c.Request.Headers {
+			req.Header.Set(name, expand(value))
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name, err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name, err)
+		}
+
+		if resp.StatusCode != c.Expect.Status {
+			t.Errorf("%s: got status %d, want %d: %s", c.Name, resp.StatusCode, c.Expect.Status, data)
+			continue
+		}
+		// bodies that aren't JSON are compared as text
+		var actual interface{} = string(data)
+		if json.Valid(data) {
+			actual = nil
+			json.Unmarshal(data, &actual)
+		}
+		if c.Expect.Body != nil {
+			for _, mismatch := range fixtures.Match(expandValue(c.Expect.Body, expand), actual, true) {
+				t.Errorf("%s: %s", c.Name, mismatch)
+			}
+		}
+		if c.Expect.Golden != "" {
+			checkGolden(t, c.Name, filepath.Join("testdata", "golden", c.Expect.Golden), actual)
+		}
+		for name, field := range c.Save {
+			fields, _ := actual.(map[string]interface{})
+			value, ok := fields[field].(string)
+			if !ok {
+				t.Fatalf("%s: response has no %s: %s", c.Name, field, data)
+			}
+			vars[name] = value
+		}
+	}
+}
+
+// expandValue replaces the vars in the strings of an expected body.
+func expandValue(value interface{}, expand func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return expand(v)
+	case map[string]interface{}:
+		expanded := map[string]interface{}{}
+		for key, field := range v {
+			expanded[key] = expandValue(field, expand)
+		}
+		return expanded
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		for i, item := range v {
+			expanded[i] = expandValue(item, expand)
+		}
+		return expanded
+	}
+	return value
+}
+
+// checkGolden compares a response to its golden file, or rewrites the file
+// with -update.
+func checkGolden(t *testing.T, name, path string, actual interface{}) {
+	t.Helper()
+	if *updateGolden {
+		data, err := json.MarshalIndent(fixtures.Redact(actual), "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, append(data, '\n'), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("%s: %v, run the test with -update to create it", name, err)
+		return
+	}
+	var golden interface{}
+	err = json.NewDecoder(bytes.NewReader(data)).Decode(&golden)
+	if err != nil {
+		t.Errorf("%s: %s: %v", name, path, err)
+		return
+	}
+	for _, mismatch := range fixtures.Match(golden, actual, false) {
+		t.Errorf("%s: %s doesn't match: %s", name, path, mismatch)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// meFollowRequestsRoutes are the routes below /me/follow-requests.
+var meFollowRequestsRoutes = newRoutes([]route{
+	{http.MethodGet, "", apiConfig.handlerGetFollowRequests},
+	{http.MethodPost, "/{follower-id}/accept", apiConfig.handlerAnswerFollowRequest},
+	{http.MethodPost, "/{follower-id}/reject", apiConfig.handlerAnswerFollowRequest},
+})
+
+func (apiCfg apiConfig) endpointMeFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(meFollowRequestsRoutes, "/me/follow-requests", w, r)
+}
+
+// handlerFollowUser makes the logged in user follow another. Following a
+// private user is pending until they accept.
+func (apiCfg apiConfig) handlerFollowUser(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{email}/follow"))
+		return
+	}
+
+	// follow user, or ask to
+	follow, err := apiCfg.users().Follow(userID, ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, follow)
+}
+
+// handlerUnfollowUser stops the logged in user following another, or
+// withdraws their request to.
+func (apiCfg apiConfig) handlerUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{email}/follow"))
+		return
+	}
+
+	// unfollow user
+	err = apiCfg.users().Unfollow(userID, ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// handlerGetFollowRequests lists the pending requests to follow the logged
+// in user, oldest first.
+func (apiCfg apiConfig) handlerGetFollowRequests(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	if r.URL.Path != "/me/follow-requests" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /me/follow-requests"))
+		return
+	}
+
+	// collect requests
+	requests, err := apiCfg.users().FollowRequests(userID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, requests)
+}
+
+// handlerAnswerFollowRequest accepts or rejects a request to follow the
+// logged in user.
+func (apiCfg apiConfig) handlerAnswerFollowRequest(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	rest, err := trimPrefix(r.URL.Path, "/me/follow-requests/", "not a valid URL: %s{follower-id}/accept")
+	followerID, action, ok := strings.Cut(rest, "/")
+	if err != nil || !ok || followerID == "" || (action != "accept" && action != "reject") {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /me/follow-requests/{follower-id}/accept or /reject"))
+		return
+	}
+
+	// answer request
+	if action == "reject" {
+		err = apiCfg.users().RejectFollower(userID, followerID)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, struct{}{})
+		return
+	}
+	follow, err := apiCfg.users().AcceptFollower(userID, followerID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, follow)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestFollowRequests(t *testing.T) {
+	c := database.NewMemoryClient()
+	private, err := c.CreateUser("private@example.com", "12345", "Private", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower, err := c.CreateUser("follower@example.com", "12345", "Follower", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.SetUserPrivate(private.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		auth:        testAuth,
+	}
+	privateToken := mediaTestLogin(t, apiCfg, private.Email)
+	followerToken := mediaTestLogin(t, apiCfg, follower.Email)
+
+	var tests = []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "follow without session", method: "POST", path: "/users/private@example.com/follow", expectedStatus: 401},
+		{name: "follow self", method: "POST", path: "/users/follower@example.com/follow", token: followerToken, expectedStatus: 400},
+		{name: "accept missing request", method: "POST", path: "/me/follow-requests/" + follower.ID + "/accept", token: privateToken, expectedStatus: 404},
+		{name: "ask to follow", method: "POST", path: "/users/private@example.com/follow", token: followerToken, expectedStatus: 201},
+		{name: "list requests", method: "GET", path: "/me/follow-requests", token: privateToken, expectedStatus: 200},
+		{name: "answer with unknown action", method: "POST", path: "/me/follow-requests/" + follower.ID + "/ignore", token: privateToken, expectedStatus: 404},
+		{name: "accept request of another user", method: "POST", path: "/me/follow-requests/" + private.ID + "/accept", token: followerToken, expectedStatus: 404},
+		{name: "accept request", method: "POST", path: "/me/follow-requests/" + follower.ID + "/accept", token: privateToken, expectedStatus: 200},
+		{name: "reject accepted request", method: "POST", path: "/me/follow-requests/" + follower.ID + "/reject", token: privateToken, expectedStatus: 404},
+		{name: "unfollow", method: "DELETE", path: "/users/private@example.com/follow", token: followerToken, expectedStatus: 200},
+		{name: "unfollow twice", method: "DELETE", path: "/users/private@example.com/follow", token: followerToken, expectedStatus: 404},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		if strings.HasPrefix(tt.path, "/me/") {
+			apiCfg.endpointMeFollowRequestsHandler(w, r)
+		} else {
+			apiCfg.endpointUsersHandler(w, r)
+		}
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+}
+
+func TestPrivatePostsHidden(t *testing.T) {
+	c := database.NewMemoryClient()
+	private, err := c.CreateUser("private@example.com", "12345", "Private", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower, err := c.CreateUser("follower@example.com", "12345", "Follower", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, err := c.CreateUser("stranger@example.com", "12345", "Stranger", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := c.CreatePost(private.ID, "secret plans at https://example.com/gone", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.SetPostDeadLinks(post.ID, []string{"https://example.com/gone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.SetUserPrivate(private.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.FollowUser(follower.ID, private.ID, database.FollowApproved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		postsprefix: "/posts",
+		analytics:   newAnalyticsCache(),
+		pagination:  paginationConfig{defaultLimit: 20, maxLimit: 100},
+		auth:        authConfig{secret: []byte("secret")},
+	}
+	token := func(user database.User) string {
+		token, err := auth.Sign(apiCfg.auth.secret, auth.NewClaims(user.ID, time.Now(), time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	var tests = []struct {
+		name     string
+		path     string
+		body     string
+		token    string
+		expected bool
+	}{
+		{name: "revisions anonymously", path: "/posts/" + post.ID + "/revisions"},
+		{name: "revisions as a stranger", path: "/posts/" + post.ID + "/revisions", token: token(stranger)},
+		{name: "revisions as a follower", path: "/posts/" + post.ID + "/revisions", token: token(follower), expected: true},
+		{name: "revisions as the author", path: "/posts/" + post.ID + "/revisions", token: token(private), expected: true},
+		{name: "analytics anonymously", path: "/users/" + private.ID + "/posts/analytics"},
+		{name: "analytics as a stranger", path: "/users/" + private.ID + "/posts/analytics", token: token(stranger)},
+		{name: "analytics as a follower", path: "/users/" + private.ID + "/posts/analytics", token: token(follower), expected: true},
+		{name: "analytics anonymously after a follower", path: "/users/" + private.ID + "/posts/analytics"},
+		{name: "dead links anonymously", path: "/posts/deadlinks", body: `{"userId": "` + private.ID + `"}`},
+		{name: "dead links as a stranger", path: "/posts/deadlinks", body: `{"userId": "` + private.ID + `"}`, token: token(stranger)},
+		{name: "dead links as the author", path: "/posts/deadlinks", body: `{"userId": "` + private.ID + `"}`, token: token(private), expected: true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tt.path, strings.NewReader(tt.body))
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		if strings.HasPrefix(tt.path, "/users/") {
+			apiCfg.endpointUsersHandler(w, r)
+		} else {
+			apiCfg.endpointPostsHandler(w, r)
+		}
+		if w.Code != http.StatusOK && w.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d: %s", tt.name, w.Code, w.Body)
+			continue
+		}
+		// "plans" is among the most used words and "gone" among the dead
+		// links, both only for viewers who see the post
+		shown := strings.Contains(w.Body.String(), "plans") || strings.Contains(w.Body.String(), "gone")
+		if shown != tt.expected {
+			t.Errorf("%s: got post content shown %v, want %v: %s", tt.name, shown, tt.expected, w.Body)
+		}
+	}
+}
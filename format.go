@@ -0,0 +1,114 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// responseEncoder serializes responses in a format clients can negotiate
+// with the Accept header. Every format starts from the JSON of the
+// response, so handlers only ever call respondWithJSON.
+type responseEncoder interface {
+	encode(w *formatWriter, code int, payload interface{}, response []byte) ([]byte, error)
+}
+
+// responseEncoders are the formats served besides plain JSON, by media
+// type.
+var responseEncoders = map[string]responseEncoder{
+	jsonAPIMediaType:  jsonAPIEncoder{},
+	"application/xml": xmlEncoder{},
+	"text/xml":        xmlEncoder{},
+}
+
+// formatWriter carries how a request wants responses formatted to
+// respondWithJSON: a sparse fieldset, and the format it negotiated.
+type formatWriter struct {
+	http.ResponseWriter
+	url    *url.URL
+	fields map[string]bool
+	// mediaType is empty for plain JSON.
+	mediaType string
+}
+
+// responseFormatMiddleware reads how clients want responses: GET and HEAD
+// requests pick the top-level attributes with ?fields=email,name,createdAt,
+// and the Accept header picks a format from responseEncoders. It wraps the
+// writer handlers get, so it must be the innermost middleware.
+func responseFormatMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fw := &formatWriter{ResponseWriter: w, url: r.URL, mediaType: negotiateMediaType(r.Header.Get("Accept"))}
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			fw.fields = parseFields(r.URL.Query().Get("fields"))
+		}
+		if len(fw.fields) == 0 && fw.mediaType == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(fw, r)
+	})
+}
+
+// format rewrites a response marshalled from payload.
+func (w *formatWriter) format(code int, payload interface{}, response []byte) ([]byte, error) {
+	encoder := responseEncoders[w.mediaType]
+	if encoder == nil {
+		// errors keep all their fields
+		if code >= 300 {
+			return response, nil
+		}
+		return selectFields(response, w.fields)
+	}
+	contentType := w.mediaType
+	if strings.HasSuffix(contentType, "xml") {
+		contentType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	return encoder.encode(w, code, payload, response)
+}
+
+// negotiateMediaType returns the media type of responseEncoders preferred
+// in an Accept header, or "" when plain JSON is preferred or none is
+// accepted. Like the JSON:API specification says, its media type doesn't
+// count when sent with parameters other than a quality.
+func negotiateMediaType(accept string) string {
+	type candidate struct {
+		mediaType string
+		quality   float64
+	}
+	candidates := []candidate{}
+	for _, accepted := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			delete(params, "q")
+		}
+		if mediaType == jsonAPIMediaType && len(params) > 0 {
+			continue
+		}
+		if _, ok := responseEncoders[mediaType]; ok || mediaType == "application/json" || mediaType == "*/*" {
+			candidates = append(candidates, candidate{mediaType: mediaType, quality: quality})
+		}
+	}
+	// the first of equally preferred types wins
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+	if len(candidates) == 0 || candidates[0].quality <= 0 {
+		return ""
+	}
+	if _, ok := responseEncoders[candidates[0].mediaType]; !ok {
+		return ""
+	}
+	return candidates[0].mediaType
+}
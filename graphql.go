@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/graphql"
+)
+
+// handlerGraphQL serves POST /graphql, a GraphQL view of the users and
+// posts served by the REST handlers. Requests go through the same
+// middleware, and a session token authenticates mutations just like it does
+// for REST.
+func (apiCfg apiConfig) handlerGraphQL(w http.ResponseWriter, r *http.Request) {
+	// get params
+	decoder := json.NewDecoder(r.Body)
+	req := graphql.Request{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check session, anonymous requests can still query
+	ctx := context.WithValue(r.Context(), graphQLRequestContextKey, r)
+	if userID, err := apiCfg.authenticatedUserID(r); err == nil {
+		ctx = withUserID(ctx, userID)
+	}
+
+	// run query, requests that don't parse or validate are rejected as a whole
+	resp := apiCfg.graphQLSchema().Execute(ctx, req)
+	if resp.Data == nil {
+		respondWithJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// graphQLRequestContextKey holds the HTTP request of a GraphQL request, for
+// resolvers that check more than its session.
+const graphQLRequestContextKey contextKey = "graphQLRequest"
+
+// graphQLSchema exposes users and posts with their relationships. Resolvers
+// go through the same services as the REST handlers.
+func (apiCfg apiConfig) graphQLSchema() *graphql.Schema {
+	user := &graphql.Object{Name: "User", Fields: map[string]*graphql.Field{
+		"id":        {},
+		"email":     {},
+		"username":  {},
+		"name":      {},
+		"age":       {},
+		"private":   {},
+		"createdAt": {},
+		"updatedAt": {},
+		"bio":       {},
+		"location":  {},
+		"website":   {},
+		"avatarUrl": {},
+	}}
+	post := &graphql.Object{Name: "Post", Fields: map[string]*graphql.Field{
+		"id":        {},
+		"userId":    {},
+		"text":      {},
+		"tags":      {},
+		"media":     {},
+		"mentions":  {},
+		"createdAt": {},
+		"updatedAt": {},
+		"author": {Type: user, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return apiCfg.users().Author(p.Source.(database.Post).UserID, "")
+		}},
+	}}
+	pageArgs := []graphql.Argument{{Name: "limit", Type: "Int"}, {Name: "offset", Type: "Int"}}
+	user.Fields["posts"] = &graphql.Field{Type: post, List: true, Args: append([]graphql.Argument{{Name: "tag", Type: "String"}}, pageArgs...), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		tag, _ := p.Args["tag"].(string)
+		posts, err := apiCfg.posts().ForViewer(userIDFromContext(p.Context)).ByAuthor(p.Source.(database.User).ID, "", tag)
+		if err != nil {
+			return nil, err
+		}
+		pg, err := apiCfg.graphQLPage(p.Args)
+		if err != nil {
+			return nil, err
+		}
+		return pageOf(posts, pg), nil
+	}}
+	postArgs := []graphql.Argument{{Name: "text", Type: "String!"}, {Name: "tags", Type: "[String!]"}}
+
+	return &graphql.Schema{
+		Query: &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+			"me": {Type: user, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				userID := userIDFromContext(p.Context)
+				if userID == "" {
+					return nil, errUnauthorized
+				}
+				return apiCfg.users().Get(userID)
+			}},
+			"user": {Type: user, Args: []graphql.Argument{{Name: "id", Type: "ID"}, {Name: "email", Type: "String"}, {Name: "username", Type: "String"}}, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				ref, _ := p.Args["id"].(string)
+				if email, ok := p.Args["email"].(string); ok {
+					ref = "by-email/" + email
+				}
+				if username, ok := p.Args["username"].(string); ok {
+					ref = "@" + username
+				}
+				return apiCfg.users().Get(ref)
+			}},
+			"users": {Type: user, List: true, Args: pageArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				users, err := apiCfg.users().All()
+				if err != nil {
+					return nil, err
+				}
+				pg, err := apiCfg.graphQLPage(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				return pageOf(users, pg), nil
+			}},
+			"post": {Type: post, Args: []graphql.Argument{{Name: "id", Type: "ID!"}}, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return apiCfg.posts().ForViewer(userIDFromContext(p.Context)).Get(p.Args["id"].(string))
+			}},
+			"posts": {Type: post, List: true, Args: append([]graphql.Argument{{Name: "tag", Type: "String"}}, pageArgs...), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				tag, _ := p.Args["tag"].(string)
+				posts, err := apiCfg.posts().ForViewer(userIDFromContext(p.Context)).All(tag)
+				if err != nil {
+					return nil, err
+				}
+				pg, err := apiCfg.graphQLPage(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				return pageOf(posts, pg), nil
+			}},
+		}},
+		Mutation: &graphql.Object{Name: "Mutation", Fields: map[string]*graphql.Field{
+			"createUser": {Type: user, Args: []graphql.Argument{{Name: "email", Type: "String!"}, {Name: "password", Type: "String!"}, {Name: "name", Type: "String"}, {Name: "username", Type: "String"}, {Name: "age", Type: "Int!"}, {Name: "bio", Type: "String"}, {Name: "location", Type: "String"}, {Name: "website", Type: "String"}, {Name: "formToken", Type: "String"}}, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				name, _ := p.Args["name"].(string)
+				username, _ := p.Args["username"].(string)
+				formToken, _ := p.Args["formToken"].(string)
+				profile := database.Profile{}
+				profile.Bio, _ = p.Args["bio"].(string)
+				profile.Location, _ = p.Args["location"].(string)
+				profile.Website, _ = p.Args["website"].(string)
+				// signups are checked like REST ones, a mutation has no
+				// honeypot fields
+				r := p.Context.Value(graphQLRequestContextKey).(*http.Request)
+				created, _, err := apiCfg.signUp(r, nil, formToken, p.Args["email"].(string), p.Args["password"].(string), name, username, p.Args["age"].(int), profile)
+				if err != nil {
+					return nil, err
+				}
+				return created, nil
+			}},
+			"createPost": {Type: post, Args: postArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				userID := userIDFromContext(p.Context)
+				if userID == "" {
+					return nil, errUnauthorized
+				}
+				return apiCfg.posts().Create(userID, "", p.Args["text"].(string), graphQLStrings(p.Args["tags"]))
+			}},
+			"updatePost": {Type: post, Args: append([]graphql.Argument{{Name: "id", Type: "ID!"}}, postArgs...), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				existing, err := apiCfg.ownPost(p)
+				if err != nil {
+					return nil, err
+				}
+				return apiCfg.posts().Update(existing.ID, existing.UserID, p.Args["text"].(string), graphQLStrings(p.Args["tags"]))
+			}},
+			"deletePost": {Args: []graphql.Argument{{Name: "id", Type: "ID!"}}, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				existing, err := apiCfg.ownPost(p)
+				if err != nil {
+					return nil, err
+				}
+				err = apiCfg.posts().Delete(existing.ID, existing.UserID)
+				if err != nil {
+					return nil, err
+				}
+				return true, nil
+			}},
+		}},
+	}
+}
+
+// ownPost returns the post named by the id argument if it belongs to the
+// logged in user.
+func (apiCfg apiConfig) ownPost(p graphql.ResolveParams) (database.Post, error) {
+	userID := userIDFromContext(p.Context)
+	if userID == "" {
+		return database.Post{}, errUnauthorized
+	}
+	return apiCfg.posts().Authored(p.Args["id"].(string), userID)
+}
+
+// graphQLPage reads the limit and offset arguments with the same limits as
+// the query parameters of the REST endpoints.
+func (apiCfg apiConfig) graphQLPage(args map[string]interface{}) (page, error) {
+	pg := page{limit: apiCfg.pagination.defaultLimit}
+	if limit, ok := args["limit"].(int); ok {
+		if limit < 1 {
+			return page{}, validationFailed(errors.New("limit must be a positive integer"))
+		}
+		if limit > apiCfg.pagination.maxLimit {
+			return page{}, apiError{Code: codePageSizeTooLarge, Message: fmt.Sprintf("limit must be at most %d", apiCfg.pagination.maxLimit)}
+		}
+		pg.limit = limit
+	}
+	if offset, ok := args["offset"].(int); ok {
+		if offset < 0 {
+			return page{}, validationFailed(errors.New("offset must be a non-negative integer"))
+		}
+		pg.offset = offset
+	}
+	return pg, nil
+}
+
+func pageOf[T any](items []T, pg page) []T {
+	if pg.offset >= len(items) {
+		return []T{}
+	}
+	end := pg.offset + pg.limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[pg.offset:end]
+}
+
+func graphQLStrings(value interface{}) []string {
+	list, _ := value.([]interface{})
+	strs := []string{}
+	for _, item := range list {
+		strs = append(strs, item.(string))
+	}
+	return strs
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestGraphQL(t *testing.T) {
+	c := database.NewMemoryClient()
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ann, err := c.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := c.CreateUser("bob@example.com", "12345", "Bob", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobsPost, err := c.CreatePost(bob.ID, "hi from bob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	carol, err := c.CreateUser("carol@example.com", "12345", "Carol", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.SetUserPrivate(carol.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	carolsPost, err := c.CreatePost(carol.ID, "followers only", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:   c,
+		pagination: paginationConfig{defaultLimit: 10, maxLimit: 10},
+		auth:       authConfig{secret: []byte("secret")},
+	}
+	token, err := auth.Sign(apiCfg.auth.secret, auth.NewClaims(ann.ID, time.Now(), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	carolsToken, err := auth.Sign(apiCfg.auth.secret, auth.NewClaims(carol.ID, time.Now(), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name           string
+		token          string
+		query          string
+		expectedStatus int
+		expected       string
+	}{
+		{
+			name:           "create post",
+			token:          token,
+			query:          `mutation { createPost(text: "hello", tags: ["Go"]) { text tags author { name } } }`,
+			expectedStatus: 200,
+			expected:       `{"data":{"createPost":{"text":"hello","tags":["go"],"author":{"name":"Ann"}}}}`,
+		},
+		{
+			name:           "relationships",
+			query:          `{ user(email: "ann@example.com") { name posts { text } } }`,
+			expectedStatus: 200,
+			expected:       `{"data":{"user":{"name":"Ann","posts":[{"text":"hello"}]}}}`,
+		},
+		{
+			name:           "private post",
+			token:          token,
+			query:          `{ post(id: "` + carolsPost.ID + `") { text } }`,
+			expectedStatus: 200,
+			expected:       `{"data":{"post":null},"errors":[{"message":"post with that id doesn't exist","locations":[{"line":1,"column":3}],"path":["post"]}]}`,
+		},
+		{
+			name:           "private post of the viewer",
+			token:          carolsToken,
+			query:          `{ post(id: "` + carolsPost.ID + `") { text } }`,
+			expectedStatus: 200,
+			expected:       `{"data":{"post":{"text":"followers only"}}}`,
+		},
+		{
+			name:           "paginated users",
+			query:          `{ users(limit: 1, offset: 1) { email } }`,
+			expectedStatus: 200,
+			expected:       `{"data":{"users":[{"email":"bob@example.com"}]}}`,
+		},
+		{
+			name:           "mutations need a session",
+			query:          `mutation { createPost(text: "anonymous") { id } }`,
+			expectedStatus: 200,
+			expected:       `{"data":{"createPost":null},"errors":[{"message":"missing or invalid session token","locations":[{"line":1,"column":12}],"path":["createPost"]}]}`,
+		},
+		{
+			name:           "only the author changes a post",
+			token:          token,
+			query:          `mutation { deletePost(id: "` + bobsPost.ID + `") }`,
+			expectedStatus: 200,
+			expected:       `{"data":{"deletePost":null},"errors":[{"message":"users can only change their own posts","locations":[{"line":1,"column":12}],"path":["deletePost"]}]}`,
+		},
+		{
+			name:           "passwords aren't exposed",
+			query:          `{ me { password } }`,
+			expectedStatus: 400,
+			expected:       `{"errors":[{"message":"cannot query field \"password\" on type \"User\"","locations":[{"line":1,"column":8}]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		body, err := json.Marshal(map[string]string{"query": tt.query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		apiCfg.handlerGraphQL(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.expectedStatus)
+		}
+		if w.Body.String() != tt.expected {
+			t.Errorf("%s: got %s, want %s", tt.name, w.Body, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/audit"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/errreport"
+	"github.com/firyx/boot.dev-api-backend/internal/grpcapi"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer serves UserService and PostService of
+// internal/grpcapi/api.proto on addr. Like the GraphQL resolvers, the
+// methods go through the same services and checks as the REST handlers.
+// gRPC runs over HTTP/2 without TLS, as one more server of serveAll, so it's
+// shut down and handed over on restarts like the others.
+//
+// The middleware of wrap that answers requests itself would answer calls
+// with JSON, so interceptors recover panics, report errors, audit writes,
+// throttle callers and refuse writes on read-only replicas instead. Calls
+// run on goroutines of their own, so their panics are recovered even
+// without RECOVER_PANICS. Calls aren't served per tenant.
+func (apiCfg apiConfig) grpcServer(addr string, recovery panicRecovery, maxMessageSize int) *http.Server {
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(
+		recovery.grpcInterceptor,
+		recovery.errors.grpcInterceptor,
+		apiCfg.grpcAuditInterceptor,
+		apiCfg.grpcThrottleInterceptor,
+		apiCfg.grpcReadOnlyInterceptor,
+	)}
+	if maxMessageSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(maxMessageSize))
+	}
+	srv := grpc.NewServer(opts...)
+	grpcapi.RegisterUserServiceServer(srv, grpcUsers{apiCfg: apiCfg})
+	grpcapi.RegisterPostServiceServer(srv, grpcPosts{apiCfg: apiCfg})
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Server{
+		Handler:     srv,
+		Addr:        addr,
+		Protocols:   protocols,
+		ReadTimeout: 30 * time.Second,
+	}
+}
+
+// grpcReads are the methods that don't write.
+var grpcReads = map[string]bool{
+	grpcapi.UserService_GetUser_FullMethodName:   true,
+	grpcapi.PostService_ListPosts_FullMethodName: true,
+}
+
+// grpcResources are the audit resources of the services.
+var grpcResources = map[string]string{
+	grpcapi.UserService_ServiceDesc.ServiceName: "users",
+	grpcapi.PostService_ServiceDesc.ServiceName: "posts",
+}
+
+// grpcInterceptor recovers panics like middleware, answering Internal.
+func (p panicRecovery) grpcInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		stack := string(debug.Stack())
+		if p.logStack {
+			log.Printf("panic serving %s (request %s): %v\n%s", info.FullMethod, requestIDFromContext(ctx), rec, stack)
+		} else {
+			log.Printf("panic serving %s (request %s): %v", info.FullMethod, requestIDFromContext(ctx), rec)
+		}
+		if p.metrics != nil {
+			p.metrics.observePanic()
+		}
+		p.errors.report(grpcRequest(ctx), errreport.LevelFatal, fmt.Sprintf("panic: %v", rec), stack)
+		resp, err = nil, status.Error(codes.Internal, errInternal.Error())
+	}()
+	return handler(ctx, req)
+}
+
+// grpcInterceptor reports the calls that fail with an internal error, as
+// middleware does 5xx responses.
+func (e errorReporting) grpcInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if code := status.Code(err); code == codes.Internal || code == codes.Unknown {
+		e.report(grpcRequest(ctx), errreport.LevelError, status.Convert(err).Message(), "")
+	}
+	return resp, err
+}
+
+// grpcAuditInterceptor records the calls that write in the audit log, with
+// the status REST would have responded with.
+func (apiCfg apiConfig) grpcAuditInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if grpcReads[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	resp, err := handler(ctx, req)
+	service, _, _ := strings.Cut(strings.TrimPrefix(info.FullMethod, "/"), "/")
+	resourceID := ""
+	switch req := req.(type) {
+	case interface{ GetRef() string }:
+		resourceID = req.GetRef()
+	case interface{ GetId() string }:
+		resourceID = req.GetId()
+	}
+	r := grpcRequest(ctx)
+	err2 := apiCfg.audit.Append(audit.Entry{
+		Time:       time.Now().UTC(),
+		RequestID:  requestIDFromContext(ctx),
+		Actor:      userIDFromContext(ctx),
+		IP:         clientIP(r),
+		Method:     r.Method,
+		Path:       info.FullMethod,
+		Resource:   grpcResources[service],
+		ResourceID: resourceID,
+		Status:     grpcHTTPStatus(status.Code(err)),
+	})
+	if err2 != nil {
+		log.Printf("audit log: %v", err2)
+	}
+	return resp, err
+}
+
+// grpcThrottleInterceptor charges calls to the caller's budget like
+// throttleMiddleware, a call costing the weight of its full method name.
+func (apiCfg apiConfig) grpcThrottleInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	t := apiCfg.throttle
+	if t.limit() == 0 {
+		return handler(ctx, req)
+	}
+	caller := "addr:" + clientIP(grpcRequest(ctx))
+	if userID := userIDFromContext(ctx); userID != "" {
+		caller = "user:" + userID
+	}
+	if ok, _, _ := t.spend(caller, t.cost(info.FullMethod)); !ok {
+		return nil, status.Error(codes.ResourceExhausted, errBudgetExceeded.Message)
+	}
+	return handler(ctx, req)
+}
+
+// grpcReadOnlyInterceptor refuses writes on read-only replicas, like
+// readOnlyReplicaMiddleware.
+func (apiCfg apiConfig) grpcReadOnlyInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !grpcReads[info.FullMethod] && !apiCfg.acceptsWrites() {
+		return nil, status.Error(codes.Unavailable, errReadOnlyReplica.Message)
+	}
+	return handler(ctx, req)
+}
+
+// grpcRequest turns the metadata of a call into the HTTP request the session
+// and signup checks read.
+func grpcRequest(ctx context.Context) *http.Request {
+	method, _ := grpc.Method(ctx)
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, method, nil)
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		for _, value := range values {
+			r.Header.Add(key, value)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+	return r
+}
+
+// grpcAuthenticatedUserID returns the ID of the user whose session token
+// came with a call.
+func (apiCfg apiConfig) grpcAuthenticatedUserID(ctx context.Context) (string, error) {
+	userID, err := apiCfg.authenticatedUserID(grpcRequest(ctx))
+	if err != nil {
+		return "", status.Error(codes.Unauthenticated, err.Error())
+	}
+	return userID, nil
+}
+
+// grpcCodes are the codes of the statuses REST responds with.
+var grpcCodes = map[int]codes.Code{
+	http.StatusOK:                    codes.OK,
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusRequestEntityTooLarge: codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.AlreadyExists,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+}
+
+// grpcError turns an error of the services into a status, with the code
+// matching the status REST responds with.
+func grpcError(err error) error {
+	if errors.Is(err, errSignupRejected) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	httpStatus, err := serviceError(err)
+	if httpStatus == 0 {
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			httpStatus = http.StatusNotFound
+		case errors.Is(err, database.ErrAlreadyExists):
+			httpStatus = http.StatusConflict
+		default:
+			httpStatus = http.StatusInternalServerError
+		}
+	}
+	code, ok := grpcCodes[httpStatus]
+	if !ok {
+		code = codes.Internal
+	}
+	return status.Error(code, err.Error())
+}
+
+// grpcHTTPStatus returns the status REST responds with for a code.
+func grpcHTTPStatus(code codes.Code) int {
+	for httpStatus, c := range grpcCodes {
+		// both 400 and 413 are InvalidArgument
+		if c == code && httpStatus != http.StatusRequestEntityTooLarge {
+			return httpStatus
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+func grpcUser(user database.User, viewerID string) *grpcapi.User {
+	user = userForViewer(user, viewerID)
+	return &grpcapi.User{
+		Id:            user.ID,
+		Email:         user.Email,
+		Username:      user.Username,
+		Name:          user.Name,
+		Age:           int32(user.Age),
+		Private:       user.Private,
+		Bio:           user.Bio,
+		Location:      user.Location,
+		Website:       user.Website,
+		AvatarUrl:     user.AvatarURL,
+		RecoveryEmail: user.RecoveryEmail,
+		CreatedAt:     timestamppb.New(user.CreatedAt),
+		UpdatedAt:     timestamppb.New(user.UpdatedAt),
+	}
+}
+
+func grpcPost(post database.Post) *grpcapi.Post {
+	return &grpcapi.Post{
+		Id:        post.ID,
+		UserId:    post.UserID,
+		Text:      post.Text,
+		Tags:      post.Tags,
+		Media:     post.Media,
+		Mentions:  post.Mentions,
+		CreatedAt: timestamppb.New(post.CreatedAt),
+		UpdatedAt: timestamppb.New(post.UpdatedAt),
+	}
+}
+
+type grpcUsers struct {
+	grpcapi.UnimplementedUserServiceServer
+	apiCfg apiConfig
+}
+
+func (s grpcUsers) CreateUser(ctx context.Context, req *grpcapi.CreateUserRequest) (*grpcapi.CreateUserResponse, error) {
+	profile := database.Profile{Bio: req.Bio, Location: req.Location, Website: req.Website}
+	// calls have no honeypot fields
+	user, pending, err := s.apiCfg.signUp(grpcRequest(ctx), nil, req.FormToken, req.Email, req.Password, req.Name, req.Username, int(req.Age), profile)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &grpcapi.CreateUserResponse{User: grpcUser(user, user.ID), Pending: pending}, nil
+}
+
+func (s grpcUsers) GetUser(ctx context.Context, req *grpcapi.GetUserRequest) (*grpcapi.User, error) {
+	user, err := s.apiCfg.users().Get(req.Ref)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	viewerID, _ := s.apiCfg.authenticatedUserID(grpcRequest(ctx))
+	return grpcUser(user, viewerID), nil
+}
+
+func (s grpcUsers) UpdateUser(ctx context.Context, req *grpcapi.UpdateUserRequest) (*grpcapi.User, error) {
+	userID, err := s.apiCfg.grpcAuthenticatedUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	profile := database.Profile{Bio: req.Bio, Location: req.Location, Website: req.Website}
+	user, err := s.apiCfg.users().Update(req.Ref, userID, req.Email, req.Password, req.Name, req.Username, int(req.Age), profile)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return grpcUser(user, userID), nil
+}
+
+func (s grpcUsers) DeleteUser(ctx context.Context, req *grpcapi.DeleteUserRequest) (*grpcapi.DeleteUserResponse, error) {
+	userID, err := s.apiCfg.grpcAuthenticatedUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.apiCfg.users().Delete(req.Ref, userID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &grpcapi.DeleteUserResponse{}, nil
+}
+
+type grpcPosts struct {
+	grpcapi.UnimplementedPostServiceServer
+	apiCfg apiConfig
+}
+
+func (s grpcPosts) CreatePost(ctx context.Context, req *grpcapi.CreatePostRequest) (*grpcapi.CreatePostResponse, error) {
+	userID, err := s.apiCfg.grpcAuthenticatedUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	post, err := s.apiCfg.posts().Create(userID, "", req.Text, req.Tags)
+	pendingErr := service.PostPendingError{}
+	if errors.As(err, &pendingErr) {
+		pending := pendingErr.Post
+		return &grpcapi.CreatePostResponse{Post: grpcPost(database.Post{
+			ID:        pending.ID,
+			CreatedAt: pending.CreatedAt,
+			UserID:    pending.UserID,
+			Text:      pending.Text,
+			Tags:      pending.Tags,
+			Mentions:  pending.Mentions,
+		}), Pending: true}, nil
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &grpcapi.CreatePostResponse{Post: grpcPost(post)}, nil
+}
+
+func (s grpcPosts) ListPosts(ctx context.Context, req *grpcapi.ListPostsRequest) (*grpcapi.ListPostsResponse, error) {
+	posts := s.apiCfg.postsFor(grpcRequest(ctx))
+	var found []database.Post
+	var err error
+	if req.UserId == "" && req.UserEmail == "" && req.Tag != "" {
+		found, err = posts.All(req.Tag)
+	} else {
+		found, err = posts.ByAuthor(req.UserId, req.UserEmail, req.Tag)
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &grpcapi.ListPostsResponse{}
+	for _, post := range found {
+		resp.Posts = append(resp.Posts, grpcPost(post))
+	}
+	return resp, nil
+}
+
+func (s grpcPosts) UpdatePost(ctx context.Context, req *grpcapi.UpdatePostRequest) (*grpcapi.Post, error) {
+	userID, err := s.apiCfg.grpcAuthenticatedUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	post, err := s.apiCfg.posts().Update(req.Id, userID, req.Text, req.Tags)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return grpcPost(post), nil
+}
+
+func (s grpcPosts) DeletePost(ctx context.Context, req *grpcapi.DeletePostRequest) (*grpcapi.DeletePostResponse, error) {
+	userID, err := s.apiCfg.grpcAuthenticatedUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.apiCfg.posts().Delete(req.Id, userID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &grpcapi.DeletePostResponse{}, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/audit"
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/botcheck"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/errreport"
+	"github.com/firyx/boot.dev-api-backend/internal/grpcapi"
+	"github.com/firyx/boot.dev-api-backend/internal/replication"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcTestConfig returns the config of a test server and the log its
+// errors are reported to.
+func grpcTestConfig(t *testing.T) (apiConfig, *fakeReporter) {
+	t.Helper()
+	apiCfg := apiConfig{
+		dbClient: database.NewMemoryClient(),
+		auth:     authConfig{secret: []byte("secret")},
+		signup:   signupConfig{checker: botcheck.Checker{MinFillTime: 3 * time.Second}},
+		audit:    audit.NewLog(filepath.Join(t.TempDir(), "audit.log")),
+		throttle: newCostThrottle(0, nil),
+	}
+	return apiCfg, &fakeReporter{}
+}
+
+// serveGRPC serves apiCfg over gRPC with the middleware newServer adds and
+// connects to it.
+func serveGRPC(t *testing.T, apiCfg apiConfig, reporter *fakeReporter) *grpc.ClientConn {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := apiCfg.grpcServer(l.Addr().String(), panicRecovery{errors: errorReporting{reporter: reporter}}, 0)
+	srv.Handler = requestIDMiddleware(apiCfg.sessionMiddleware(srv.Handler))
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// grpcAs returns a context whose calls come with a session of userID.
+func grpcAs(t *testing.T, apiCfg apiConfig, userID string) context.Context {
+	t.Helper()
+	token, err := auth.Sign(apiCfg.auth.secret, auth.NewClaims(userID, time.Now(), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func wantCode(t *testing.T, name string, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Errorf("%s: got %v, want %s", name, err, code)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	apiCfg, reporter := grpcTestConfig(t)
+	c := apiCfg.dbClient
+	conn := serveGRPC(t, apiCfg, reporter)
+	users := grpcapi.NewUserServiceClient(conn)
+	posts := grpcapi.NewPostServiceClient(conn)
+	ctx := context.Background()
+	as := func(userID string) context.Context {
+		return grpcAs(t, apiCfg, userID)
+	}
+
+	// signups go through the same checks as REST ones
+	created, err := users.CreateUser(ctx, &grpcapi.CreateUserRequest{Email: "ann@example.com", Password: "12345", Name: "Ann", Username: "ann", Age: 18})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ann := created.User
+	if ann.Username != "ann" || created.Pending {
+		t.Errorf("created %+v", created)
+	}
+	signups, err := c.GetSignups("")
+	if err != nil || len(signups) != 1 {
+		t.Errorf("got signups %+v, %v", signups, err)
+	}
+	_, err = users.CreateUser(ctx, &grpcapi.CreateUserRequest{Email: "ann@example.com", Password: "12345", Age: 18})
+	wantCode(t, "existing user", err, codes.AlreadyExists)
+	_, err = users.CreateUser(ctx, &grpcapi.CreateUserRequest{Email: "kid@example.com", Password: "12345", Age: 12})
+	wantCode(t, "ineligible age", err, codes.InvalidArgument)
+	bob, err := c.CreateUser("bob@example.com", "12345", "Bob", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := users.GetUser(ctx, &grpcapi.GetUserRequest{Ref: "@ann"})
+	if err != nil || got.Id != ann.Id {
+		t.Errorf("get user: got %+v, %v", got, err)
+	}
+	_, err = users.GetUser(ctx, &grpcapi.GetUserRequest{Ref: "@nobody"})
+	wantCode(t, "unknown user", err, codes.NotFound)
+
+	update := &grpcapi.UpdateUserRequest{Ref: ann.Id, Password: "12345", Name: "Annie", Age: 19}
+	_, err = users.UpdateUser(ctx, update)
+	wantCode(t, "update without a session", err, codes.Unauthenticated)
+	_, err = users.UpdateUser(as(bob.ID), update)
+	wantCode(t, "update someone else", err, codes.PermissionDenied)
+	got, err = users.UpdateUser(as(ann.Id), update)
+	if err != nil || got.Name != "Annie" || got.Age != 19 {
+		t.Errorf("update user: got %+v, %v", got, err)
+	}
+
+	post, err := posts.CreatePost(as(ann.Id), &grpcapi.CreatePostRequest{Text: "hello", Tags: []string{"Go"}})
+	if err != nil || post.Pending || post.Post.UserId != ann.Id {
+		t.Fatalf("create post: got %+v, %v", post, err)
+	}
+	_, err = posts.CreatePost(ctx, &grpcapi.CreatePostRequest{Text: "anonymous"})
+	wantCode(t, "post without a session", err, codes.Unauthenticated)
+	listed, err := posts.ListPosts(ctx, &grpcapi.ListPostsRequest{Tag: "go"})
+	if err != nil || len(listed.Posts) != 1 || listed.Posts[0].Text != "hello" {
+		t.Errorf("list posts: got %+v, %v", listed, err)
+	}
+	_, err = posts.UpdatePost(as(bob.ID), &grpcapi.UpdatePostRequest{Id: post.Post.Id, Text: "hijacked"})
+	wantCode(t, "update someone else's post", err, codes.PermissionDenied)
+	_, err = posts.DeletePost(as(bob.ID), &grpcapi.DeletePostRequest{Id: post.Post.Id})
+	wantCode(t, "delete someone else's post", err, codes.PermissionDenied)
+	_, err = posts.DeletePost(as(ann.Id), &grpcapi.DeletePostRequest{Id: post.Post.Id})
+	if err != nil {
+		t.Errorf("delete post: %v", err)
+	}
+
+	_, err = users.DeleteUser(as(bob.ID), &grpcapi.DeleteUserRequest{Ref: ann.Id})
+	wantCode(t, "delete someone else", err, codes.PermissionDenied)
+	_, err = users.DeleteUser(as(ann.Id), &grpcapi.DeleteUserRequest{Ref: ann.Id})
+	if err != nil {
+		t.Errorf("delete user: %v", err)
+	}
+}
+
+func TestGRPCMiddleware(t *testing.T) {
+	apiCfg, reporter := grpcTestConfig(t)
+	ann, err := apiCfg.dbClient.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "db.json")
+	log, err := replication.OpenLog(path + ".replication.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondary, err := replication.NewNode(log, database.NewClient(path), replication.RoleSecondary, "http://primary.example.com", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica := apiCfg
+	replica.replication = secondary
+	users := grpcapi.NewUserServiceClient(serveGRPC(t, replica, reporter))
+
+	// replicas serve reads and refuse writes
+	_, err = users.GetUser(context.Background(), &grpcapi.GetUserRequest{Ref: ann.ID})
+	wantCode(t, "read on a replica", err, codes.OK)
+	update := &grpcapi.UpdateUserRequest{Ref: ann.ID, Password: "12345", Name: "Annie", Age: 19}
+	_, err = users.UpdateUser(grpcAs(t, apiCfg, ann.ID), update)
+	wantCode(t, "write on a replica", err, codes.Unavailable)
+
+	// writes are audited with the user making them
+	users = grpcapi.NewUserServiceClient(serveGRPC(t, apiCfg, reporter))
+	_, err = users.UpdateUser(grpcAs(t, apiCfg, ann.ID), update)
+	wantCode(t, "write", err, codes.OK)
+	entries, err := apiCfg.audit.Query(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want the 2 writes", len(entries))
+	}
+	got := entries[1]
+	if got.Actor != ann.ID || got.IP != "127.0.0.1" || got.RequestID == "" || got.Path != grpcapi.UserService_UpdateUser_FullMethodName || got.Resource != "users" || got.ResourceID != ann.ID || got.Status != http.StatusOK {
+		t.Errorf("got %+v", got)
+	}
+	if entries[0].Status != http.StatusServiceUnavailable {
+		t.Errorf("refused write: got %+v", entries[0])
+	}
+
+	// callers over their budget are throttled
+	apiCfg.throttle.configure(1, nil)
+	_, err = users.GetUser(context.Background(), &grpcapi.GetUserRequest{Ref: ann.ID})
+	wantCode(t, "within the budget", err, codes.OK)
+	_, err = users.GetUser(context.Background(), &grpcapi.GetUserRequest{Ref: ann.ID})
+	wantCode(t, "over the budget", err, codes.ResourceExhausted)
+
+	// panics are recovered and reported
+	recovery := panicRecovery{errors: errorReporting{reporter: reporter}}
+	_, err = recovery.grpcInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: grpcapi.UserService_GetUser_FullMethodName}, func(ctx context.Context, req any) (any, error) {
+		panic("boom")
+	})
+	wantCode(t, "panic", err, codes.Internal)
+	if len(reporter.events) != 1 || reporter.events[0].Level != errreport.LevelFatal {
+		t.Errorf("got reports %+v", reporter.events)
+	}
+}
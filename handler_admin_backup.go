@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/backup"
+)
+
+var errSnapshotNotFound = apiError{Code: codeNotFound, Message: "snapshot doesn't exist"}
+
+type restoreResult struct {
+	Snapshot string `json:"snapshot"`
+	// Backup is the snapshot taken of the database before the restore, to
+	// undo it.
+	Backup  string `json:"backup"`
+	Changes int    `json:"changes"`
+}
+
+// adminBackupRoutes are the routes of /admin/backup.
+var adminBackupRoutes = newRoutes([]route{
+	{http.MethodGet, "", apiConfig.handlerGetBackups},
+	{http.MethodPost, "", apiConfig.handlerCreateBackup},
+})
+
+func (apiCfg apiConfig) endpointAdminBackupHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(adminBackupRoutes, "/admin/backup", w, r)
+}
+
+// handlerGetBackups lists the snapshots, newest first.
+func (apiCfg apiConfig) handlerGetBackups(w http.ResponseWriter, r *http.Request) {
+	snapshots, err := apiCfg.backups.List()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, snapshots)
+}
+
+func (apiCfg apiConfig) handlerCreateBackup(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := apiCfg.createBackup(time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, snapshot)
+}
+
+func (apiCfg apiConfig) createBackup(now time.Time) (backup.Snapshot, error) {
+	data, err := apiCfg.dbClient.Snapshot()
+	if err != nil {
+		return backup.Snapshot{}, err
+	}
+	return apiCfg.backups.Create(data, now)
+}
+
+func (apiCfg apiConfig) handlerRestoreBackup(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		Snapshot string `json:"snapshot"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if params.Snapshot == "" {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("snapshot can't be empty")))
+		return
+	}
+
+	// secondaries follow the primary
+	if !apiCfg.acceptsWrites() {
+		respondWithError(w, http.StatusConflict, errors.New("restore must run on the primary"))
+		return
+	}
+
+	// read snapshot
+	data, err := apiCfg.backups.Read(params.Snapshot)
+	if errors.Is(err, backup.ErrInvalidName) {
+		respondWithError(w, http.StatusBadRequest, validationFailed(err))
+		return
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, errSnapshotNotFound)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// back up the current state, then swap the snapshot in
+	current, err := apiCfg.createBackup(time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	mutations, err := apiCfg.dbClient.Restore(data)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	apiCfg.leaderboards.recompute(apiCfg.dbClient)
+	respondWithJSON(w, http.StatusOK, restoreResult{
+		Snapshot: params.Snapshot,
+		Backup:   current.Name,
+		Changes:  len(mutations),
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/backup"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	c := database.NewClient(filepath.Join(dir, "db.json"))
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:     c,
+		leaderboards: &leaderboards{},
+		backups:      backup.Store{Dir: filepath.Join(dir, "backups"), Gzip: true},
+	}
+	_, err = c.CreateUser("kept@example.com", "12345", "Kept", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	apiCfg.endpointAdminBackupHandler(w, httptest.NewRequest(http.MethodPost, "/admin/backup", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("backup: got status %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	snapshot := backup.Snapshot{}
+	err = json.NewDecoder(w.Body).Decode(&snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a bad write after the backup
+	_, err = c.CreateUser("bad@example.com", "12345", "Bad", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		body           string
+		expectedStatus int
+	}{
+		{body: `{}`, expectedStatus: http.StatusBadRequest},
+		{body: `{"snapshot": "../db.json"}`, expectedStatus: http.StatusBadRequest},
+		{body: `{"snapshot": "db-20000101T000000.000000000.json"}`, expectedStatus: http.StatusNotFound},
+		{body: `{"snapshot": "` + snapshot.Name + `"}`, expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		apiCfg.handlerRestoreBackup(w, httptest.NewRequest(http.MethodPost, "/admin/restore", strings.NewReader(tt.body)))
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.body, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+
+	_, err = c.GetUserByEmail("bad@example.com")
+	if err == nil {
+		t.Errorf("got the user created after the backup, want it gone")
+	}
+	_, err = c.GetUserByEmail("kept@example.com")
+	if err != nil {
+		t.Errorf("got %v for the user in the backup", err)
+	}
+	snapshots, err := apiCfg.backups.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the restore backed up the state it replaced
+	if len(snapshots) != 2 {
+		t.Errorf("got %d snapshots, want 2", len(snapshots))
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/bundle"
+)
+
+// bundleConfig holds the keys used to seal exports and to check bundles
+// before they're imported.
+type bundleConfig struct {
+	options     bundle.Options
+	trustedKeys []ed25519.PublicKey
+}
+
+// handlerExportBundle exports every user and post in the format accepted by
+// /admin/import, sealed into a bundle.
+func (apiCfg apiConfig) handlerExportBundle(w http.ResponseWriter, r *http.Request) {
+	type export struct {
+		Users []importUser `json:"users"`
+		Posts []importPost `json:"posts"`
+	}
+
+	// collect records
+	users, err := apiCfg.dbClient.GetAllUsers()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	posts, err := apiCfg.dbClient.GetAllPosts()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.Before(posts[j].CreatedAt)
+	})
+	data := export{Users: []importUser{}, Posts: []importPost{}}
+	for _, user := range users {
+		data.Users = append(data.Users, importUser{
+			ID:                user.ID,
+			Email:             user.Email,
+			Password:          user.Password,
+			PasswordAlgorithm: user.PasswordAlgorithm,
+			Name:              user.Name,
+			Age:               user.Age,
+			CreatedAt:         user.CreatedAt,
+		})
+	}
+	for _, post := range posts {
+		data.Posts = append(data.Posts, importPost{
+			ID:        post.ID,
+			UserID:    post.UserID,
+			Text:      post.Text,
+			Tags:      post.Tags,
+			CreatedAt: post.CreatedAt,
+		})
+	}
+
+	// seal bundle
+	payload, err := json.Marshal(data)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sealed, err := bundle.Seal(payload, apiCfg.bundles.options)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	filename := fmt.Sprintf("export-%s.bundle", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", bundle.MediaType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(sealed)
+}
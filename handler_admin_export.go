@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+type csvColumn[T any] struct {
+	name  string
+	value func(T) string
+}
+
+var userCSVColumns = []csvColumn[database.User]{
+	{"id", func(u database.User) string { return u.ID }},
+	{"email", func(u database.User) string { return u.Email }},
+	{"username", func(u database.User) string { return u.Username }},
+	{"name", func(u database.User) string { return u.Name }},
+	{"age", func(u database.User) string { return strconv.Itoa(u.Age) }},
+	{"createdAt", func(u database.User) string { return u.CreatedAt.Format(time.RFC3339) }},
+}
+
+var postCSVColumns = []csvColumn[database.Post]{
+	{"id", func(p database.Post) string { return p.ID }},
+	{"userId", func(p database.Post) string { return p.UserID }},
+	{"text", func(p database.Post) string { return p.Text }},
+	{"tags", func(p database.Post) string { return strings.Join(p.Tags, " ") }},
+	{"createdAt", func(p database.Post) string { return p.CreatedAt.Format(time.RFC3339) }},
+	{"deadLinks", func(p database.Post) string {
+		if p.Metadata == nil {
+			return ""
+		}
+		return strings.Join(p.Metadata.DeadLinks, " ")
+	}},
+}
+
+func (apiCfg apiConfig) handlerExportUsersCSV(w http.ResponseWriter, r *http.Request) {
+	// check columns
+	columns, err := selectCSVColumns(userCSVColumns, r.URL.Query().Get("columns"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// stream users
+	users, err := apiCfg.dbClient.GetAllUsers()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	respondWithCSV(w, "users.csv", columns, users)
+}
+
+func (apiCfg apiConfig) handlerExportPostsCSV(w http.ResponseWriter, r *http.Request) {
+	// check columns
+	columns, err := selectCSVColumns(postCSVColumns, r.URL.Query().Get("columns"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// stream posts
+	posts, err := apiCfg.dbClient.GetAllPosts()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.Before(posts[j].CreatedAt)
+	})
+	respondWithCSV(w, "posts.csv", columns, posts)
+}
+
+// selectCSVColumns picks the columns named in the comma separated list, in
+// the requested order. An empty list selects every column.
+func selectCSVColumns[T any](available []csvColumn[T], list string) ([]csvColumn[T], error) {
+	if list == "" {
+		return available, nil
+	}
+	columns := []csvColumn[T]{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, column := range available {
+			if column.name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+	}
+	return columns, nil
+}
+
+func respondWithCSV[T any](w http.ResponseWriter, filename string, columns []csvColumn[T], rows []T) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = column.name
+	}
+	writer.Write(record)
+	for _, row := range rows {
+		for i, column := range columns {
+			record[i] = csvCell(column.value(row))
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+}
+
+// csvCell keeps spreadsheets from running values users wrote, like names or
+// post texts starting with =, as formulas: they get a leading quote, which
+// spreadsheets hide.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
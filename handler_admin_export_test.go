@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestExportCSV(t *testing.T) {
+	c := database.NewMemoryClient()
+	user, err := c.CreateUser("ann@example.com", "12345", "=HYPERLINK(\"https://example.com\")", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"+1 to this", "-2", "@everyone", "\tindented", "\rreturn", "plain - text = fine"} {
+		_, err = c.CreatePost(user.ID, text, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	apiCfg := apiConfig{dbClient: c}
+
+	var tests = []struct {
+		name           string
+		handler        http.HandlerFunc
+		path           string
+		expectedStatus int
+		expected       [][]string
+	}{
+		{name: "selected columns in order", handler: apiCfg.handlerExportUsersCSV, path: "/admin/users.csv?columns=name,email", expectedStatus: http.StatusOK, expected: [][]string{
+			{"name", "email"},
+			{"'=HYPERLINK(\"https://example.com\")", "ann@example.com"},
+		}},
+		{name: "unknown column", handler: apiCfg.handlerExportUsersCSV, path: "/admin/users.csv?columns=name,password", expectedStatus: http.StatusBadRequest},
+		{name: "post texts", handler: apiCfg.handlerExportPostsCSV, path: "/admin/posts.csv?columns=text", expectedStatus: http.StatusOK, expected: [][]string{
+			{"text"},
+			{"'\tindented"},
+			{"'\rreturn"},
+			{"'+1 to this"},
+			{"'-2"},
+			{"'@everyone"},
+			{"plain - text = fine"},
+		}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		tt.handler(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+			continue
+		}
+		if tt.expected == nil {
+			continue
+		}
+		records, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		// posts created in the same instant come in any order
+		sort.Slice(records[1:], func(i, j int) bool {
+			return records[1+i][0] < records[1+j][0]
+		})
+		if !reflect.DeepEqual(records, tt.expected) {
+			t.Errorf("%s: got %q, want %q", tt.name, records, tt.expected)
+		}
+	}
+}
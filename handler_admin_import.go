@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/bundle"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/passhash"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+)
+
+type importUser struct {
+	ID       string `json:"id"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// PasswordAlgorithm is empty for passwords that aren't hashed yet, they
+	// are hashed with the configured algorithm on import.
+	PasswordAlgorithm string    `json:"passwordAlgorithm,omitempty"`
+	Name              string    `json:"name"`
+	Age               int       `json:"age"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+type importPost struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	UserEmail string    `json:"userEmail"`
+	Text      string    `json:"text"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type importResult struct {
+	Index   int    `json:"index"`
+	Type    string `json:"type"`
+	Key     string `json:"key,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+type importReport struct {
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Results  []importResult `json:"results"`
+}
+
+func (apiCfg apiConfig) handlerImport(w http.ResponseWriter, r *http.Request) {
+	// get params
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	var parsed []parsedImportRecord
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == bundle.MediaType {
+		body, err = bundle.Open(body, apiCfg.bundles.options.Passphrase, apiCfg.bundles.trustedKeys)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, validationFailed(err))
+			return
+		}
+		parsed, err = parseImportJSON(body)
+	} else if mediaType == "application/x-ndjson" || mediaType == "application/ndjson" {
+		parsed, err = parseImportNDJSON(body)
+	} else {
+		parsed, err = parseImportJSON(body)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate records, only valid ones reach the database
+	records := []database.ImportRecord{}
+	indexes := []int{}
+	for i := range parsed {
+		record, err := parsed[i].record(apiCfg.passwords)
+		if err != nil {
+			parsed[i].Error = err.Error()
+			continue
+		}
+		records = append(records, record)
+		indexes = append(indexes, i)
+	}
+
+	// write records
+	errs, err := apiCfg.dbClient.Import(records)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	report := importReport{Results: []importResult{}}
+	for j, i := range indexes {
+		if errs[j] != nil {
+			parsed[i].Error = errs[j].Error()
+			continue
+		}
+		if records[j].Post != nil {
+			parsed[i].Key = records[j].Post.ID
+		}
+		parsed[i].Success = true
+	}
+	for _, result := range parsed {
+		if result.Success {
+			report.Imported++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result.importResult)
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+type parsedImportRecord struct {
+	importResult
+	user *importUser
+	post *importPost
+}
+
+func (p parsedImportRecord) record(hasher passhash.Hasher) (database.ImportRecord, error) {
+	if p.Error != "" {
+		return database.ImportRecord{}, errors.New(p.Error)
+	}
+	switch {
+	case p.user != nil:
+		err := service.ValidateUser(p.user.Email, p.user.Password, p.user.Age)
+		if err == nil {
+			err = passhash.CheckTag(p.user.PasswordAlgorithm)
+		}
+		if err != nil {
+			return database.ImportRecord{}, err
+		}
+		password, algorithm := p.user.Password, p.user.PasswordAlgorithm
+		if algorithm == passhash.Plain {
+			password, algorithm, err = hasher.Hash(password)
+			if err != nil {
+				return database.ImportRecord{}, err
+			}
+		}
+		return database.ImportRecord{User: &database.User{
+			ID:                p.user.ID,
+			CreatedAt:         p.user.CreatedAt.UTC(),
+			Email:             p.user.Email,
+			Password:          password,
+			PasswordAlgorithm: algorithm,
+			Name:              p.user.Name,
+			Age:               p.user.Age,
+		}}, nil
+	case p.post != nil:
+		if p.post.UserID == "" && p.post.UserEmail == "" {
+			return database.ImportRecord{}, errors.New("userId or userEmail is required")
+		}
+		if p.post.Text == "" {
+			return database.ImportRecord{}, errors.New("text can't be empty")
+		}
+		tags, err := service.NormalizeTags(p.post.Tags)
+		if err != nil {
+			return database.ImportRecord{}, err
+		}
+		return database.ImportRecord{
+			Post: &database.Post{
+				ID:        p.post.ID,
+				CreatedAt: p.post.CreatedAt.UTC(),
+				UserID:    p.post.UserID,
+				Text:      p.post.Text,
+				Tags:      tags,
+			},
+			PostAuthorEmail: p.post.UserEmail,
+		}, nil
+	}
+	return database.ImportRecord{}, errors.New("empty record")
+}
+
+// parseImportJSON parses a {"users": [...], "posts": [...]} document. Users
+// are imported before posts so posts can reference users from the same file.
+func parseImportJSON(body []byte) ([]parsedImportRecord, error) {
+	type parameters struct {
+		Users []json.RawMessage `json:"users"`
+		Posts []json.RawMessage `json:"posts"`
+	}
+	params := parameters{}
+	err := json.Unmarshal(body, &params)
+	if err != nil {
+		return nil, err
+	}
+	records := []parsedImportRecord{}
+	for _, raw := range params.Users {
+		records = append(records, parseImportRecord(len(records), "user", raw))
+	}
+	for _, raw := range params.Posts {
+		records = append(records, parseImportRecord(len(records), "post", raw))
+	}
+	return records, nil
+}
+
+// parseImportNDJSON parses one {"type": "user"|"post", ...} object per line.
+func parseImportNDJSON(body []byte) ([]parsedImportRecord, error) {
+	records := []parsedImportRecord{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		header := struct {
+			Type string `json:"type"`
+		}{}
+		err := json.Unmarshal(line, &header)
+		if err != nil {
+			records = append(records, parsedImportRecord{importResult: importResult{
+				Index: len(records),
+				Error: err.Error(),
+			}})
+			continue
+		}
+		records = append(records, parseImportRecord(len(records), header.Type, line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func parseImportRecord(index int, recordType string, raw []byte) parsedImportRecord {
+	record := parsedImportRecord{importResult: importResult{Index: index, Type: recordType}}
+	var err error
+	switch recordType {
+	case "user":
+		record.user = &importUser{}
+		err = json.Unmarshal(raw, record.user)
+		record.Key = record.user.Email
+	case "post":
+		record.post = &importPost{}
+		err = json.Unmarshal(raw, record.post)
+		record.Key = record.post.ID
+	default:
+		err = fmt.Errorf("unknown record type %q", recordType)
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
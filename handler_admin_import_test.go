@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/passhash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestParseImportNDJSON(t *testing.T) {
+	body := []byte(`{"type":"user","email":"test@example.com","password":"12345","age":18}
+
+{"type":"post","userEmail":"test@example.com","text":"hello"}
+not json
+{"type":"comment"}
+`)
+	records, err := parseImportNDJSON(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		recordType string
+		key        string
+		hasErr     bool
+	}{
+		{recordType: "user", key: "test@example.com"},
+		{recordType: "post"},
+		{hasErr: true},
+		{recordType: "comment", hasErr: true},
+	}
+	if len(records) != len(tests) {
+		t.Fatalf("got %d records, want %d", len(records), len(tests))
+	}
+	for i, tt := range tests {
+		record := records[i]
+		if record.Index != i {
+			t.Errorf("got index %d, want %d", record.Index, i)
+		}
+		if record.Type != tt.recordType {
+			t.Errorf("got type %s, want %s", record.Type, tt.recordType)
+		}
+		if record.Key != tt.key {
+			t.Errorf("got key %s, want %s", record.Key, tt.key)
+		}
+		if (record.Error != "") != tt.hasErr {
+			t.Errorf("got error %q, want error: %v", record.Error, tt.hasErr)
+		}
+	}
+}
+
+func TestImportRecordHashesPasswords(t *testing.T) {
+	hasher := passhash.Hasher{BcryptCost: bcrypt.MinCost}
+	tests := []struct {
+		name      string
+		user      importUser
+		algorithm string
+	}{
+		{name: "plain text", user: importUser{Email: "ann@example.com", Password: "12345", Age: 18}, algorithm: passhash.Bcrypt},
+		{name: "hashed", user: importUser{Email: "bob@example.com", Password: "$2a$04$hash", PasswordAlgorithm: passhash.Bcrypt, Age: 18}, algorithm: passhash.Bcrypt},
+	}
+	for _, tt := range tests {
+		record, err := parsedImportRecord{user: &tt.user}.record(hasher)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		user := record.User
+		if user.PasswordAlgorithm != tt.algorithm {
+			t.Errorf("%s: got algorithm %q, want %q", tt.name, user.PasswordAlgorithm, tt.algorithm)
+		}
+		if tt.user.PasswordAlgorithm != passhash.Plain {
+			if user.Password != tt.user.Password {
+				t.Errorf("%s: got password %q, want the imported hash", tt.name, user.Password)
+			}
+			continue
+		}
+		if user.Password == tt.user.Password {
+			t.Errorf("%s: password is stored in plain text", tt.name)
+		}
+		if ok, err := hasher.Verify(tt.user.Password, user.Password, user.PasswordAlgorithm); !ok || err != nil {
+			t.Errorf("%s: password doesn't verify: %v", tt.name, err)
+		}
+	}
+}
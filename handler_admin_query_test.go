@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestAdminQuery(t *testing.T) {
+	c := database.NewMemoryClient()
+	for _, name := range []string{"Ann", "Bob", "Anna"} {
+		_, err := c.CreateUser(strings.ToLower(name)+"@example.com", "12345", name, 18)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	apiCfg := apiConfig{
+		dbClient:   c,
+		pagination: paginationConfig{defaultLimit: 1, maxLimit: 100},
+	}
+	var tests = []struct {
+		name     string
+		path     string
+		body     string
+		code     int
+		expected int
+		total    string
+	}{
+		{name: "every record", path: "/admin/query?limit=10", body: `{"collection": "users"}`, code: http.StatusOK, expected: 3, total: "3"},
+		{name: "filtered", path: "/admin/query?limit=10", body: `{"collection": "users", "filter": "name ~ \"ann\""}`, code: http.StatusOK, expected: 2, total: "2"},
+		{name: "paginated", path: "/admin/query", body: `{"collection": "users", "filter": "age == 18"}`, code: http.StatusOK, expected: 1, total: "3"},
+		{name: "empty collection", path: "/admin/query", body: `{"collection": "posts"}`, code: http.StatusOK, expected: 0, total: "0"},
+		{name: "unknown collection", path: "/admin/query", body: `{"collection": "comments"}`, code: http.StatusNotFound},
+		{name: "missing collection", path: "/admin/query", body: `{}`, code: http.StatusBadRequest},
+		{name: "syntax error", path: "/admin/query", body: `{"collection": "users", "filter": "name ~"}`, code: http.StatusBadRequest},
+		{name: "redacted field", path: "/admin/query", body: `{"collection": "users", "filter": "password > \"a\""}`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			apiCfg.handlerAdminQuery(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if w.Code != tt.code {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			if strings.Contains(w.Body.String(), "password") {
+				t.Errorf("passwords weren't redacted: %s", w.Body)
+			}
+			matches := []struct {
+				Key    string        `json:"key"`
+				Record database.User `json:"record"`
+			}{}
+			err := json.NewDecoder(w.Body).Decode(&matches)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(matches) != tt.expected {
+				t.Errorf("got %d records, want %d", len(matches), tt.expected)
+			}
+			for _, match := range matches {
+				if match.Key != match.Record.ID {
+					t.Errorf("got key %q for record %q", match.Key, match.Record.ID)
+				}
+			}
+			if got := w.Header().Get(totalCountHeader); got != tt.total {
+				t.Errorf("got total %s, want %s", got, tt.total)
+			}
+		})
+	}
+}
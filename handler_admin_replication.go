@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const codeReadOnlyReplica errorCode = "READ_ONLY_REPLICA"
+
+var errReadOnlyReplica = apiError{Code: codeReadOnlyReplica, Message: "this instance is a read-only replica"}
+
+func (apiCfg apiConfig) handlerReplicationStatus(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, apiCfg.replication.Status())
+}
+
+func (apiCfg apiConfig) handlerReplicationLog(w http.ResponseWriter, r *http.Request) {
+	// get params
+	query := r.URL.Query()
+	after, err := strconv.ParseInt(query.Get("after"), 10, 64)
+	if err != nil && query.Get("after") != "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("after must be an offset"))
+		return
+	}
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			respondWithError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+			return
+		}
+	}
+
+	// return entries
+	type response struct {
+		Entries interface{} `json:"entries"`
+		Last    int64       `json:"last"`
+	}
+	entries, err := apiCfg.replication.Log().Read(after, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		Entries: entries,
+		Last:    apiCfg.replication.Log().LastOffset(),
+	})
+}
+
+func (apiCfg apiConfig) handlerPromote(w http.ResponseWriter, r *http.Request) {
+	err := apiCfg.replication.Promote()
+	if err != nil {
+		respondWithError(w, http.StatusConflict, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, apiCfg.replication.Status())
+}
+
+// readOnlyReplicaMiddleware rejects writes to the public API while this
+// instance is a secondary. Admin endpoints stay available, so the instance
+// can still be inspected and promoted.
+func (apiCfg apiConfig) readOnlyReplicaMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if apiCfg.replication.IsPrimary() || strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		respondWithError(w, http.StatusServiceUnavailable, errReadOnlyReplica)
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/stats"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+	defaultStatsTop  = 10
+	maxStatsTop      = 100
+)
+
+// parseStatsOptions reads the days and top query parameters, within their
+// limits.
+func parseStatsOptions(r *http.Request) (stats.Options, error) {
+	opts := stats.Options{Days: defaultStatsDays, Top: defaultStatsTop}
+	for _, param := range []struct {
+		name  string
+		max   int
+		value *int
+	}{
+		{name: "days", max: maxStatsDays, value: &opts.Days},
+		{name: "top", max: maxStatsTop, value: &opts.Top},
+	} {
+		v := r.URL.Query().Get(param.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > param.max {
+			return stats.Options{}, validationFailed(fmt.Errorf("%s must be an integer from 1 to %d", param.name, param.max))
+		}
+		*param.value = n
+	}
+	return opts, nil
+}
+
+// handlerAdminStats returns the totals, daily signups and posts, and top
+// posters the operations dashboard charts.
+func (apiCfg apiConfig) handlerAdminStats(w http.ResponseWriter, r *http.Request) {
+	// get params
+	opts, err := parseStatsOptions(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// aggregate
+	dashboard, err := stats.Compute(apiCfg.dbClient, time.Now(), opts)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, dashboard)
+}
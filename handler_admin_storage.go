@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// storageUsage is where the bytes kept by the server go. Record sizes are
+// those of their JSON in the database file.
+type storageUsage struct {
+	// Database is the size of every record, Collections of those of each
+	// collection.
+	Database    int64            `json:"database"`
+	Collections map[string]int64 `json:"collections"`
+	Users       int64            `json:"users"`
+	// Posts counts revisions and posts held for review along with posts.
+	Posts    int64         `json:"posts"`
+	Media    mediaUsage    `json:"media"`
+	AuditLog int64         `json:"auditLog"`
+	Journals journalsUsage `json:"journals"`
+	TopUsers []userStorage `json:"topUsers"`
+}
+
+// mediaUsage is the size of the uploaded files, as recorded when they were
+// uploaded.
+type mediaUsage struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// journalsUsage is the size of the write-ahead log and the replication
+// journal, 0 when they're off.
+type journalsUsage struct {
+	WAL         int64 `json:"wal"`
+	Replication int64 `json:"replication"`
+}
+
+// userStorage is the size of what a user wrote and uploaded.
+type userStorage struct {
+	UserID string `json:"userId"`
+	Email  string `json:"email"`
+	Posts  int64  `json:"posts"`
+	Media  int64  `json:"media"`
+	Total  int64  `json:"total"`
+}
+
+// handlerAdminStorage breaks down the storage used, with the users using
+// the most, to guide retention and quota settings.
+func (apiCfg apiConfig) handlerAdminStorage(w http.ResponseWriter, r *http.Request) {
+	// get params
+	top := defaultStatsTop
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxStatsTop {
+			respondWithError(w, http.StatusBadRequest, validationFailed(fmt.Errorf("top must be an integer from 1 to %d", maxStatsTop)))
+			return
+		}
+		top = n
+	}
+
+	// measure the database
+	colls, err := apiCfg.dbClient.Collections()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	usage, err := measureStorage(colls, top)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// measure the files next to it
+	if apiCfg.audit != nil {
+		usage.AuditLog, err = apiCfg.audit.Size()
+	}
+	if err == nil {
+		usage.Journals.WAL, err = fileSize(apiCfg.dbClient.WALPath())
+	}
+	if err == nil && apiCfg.replication != nil {
+		usage.Journals.Replication, err = apiCfg.replication.Log().Size()
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, usage)
+}
+
+// measureStorage sizes the collections of a database, and what the top
+// users in it use.
+func measureStorage(colls map[string]map[string]json.RawMessage, top int) (storageUsage, error) {
+	usage := storageUsage{Collections: map[string]int64{}, TopUsers: []userStorage{}}
+	for name, records := range colls {
+		for _, record := range records {
+			usage.Collections[name] += int64(len(record))
+		}
+		usage.Database += usage.Collections[name]
+	}
+	usage.Users = usage.Collections["users"]
+	usage.Posts = usage.Collections["posts"] + usage.Collections["postRevisions"] + usage.Collections["pendingPosts"]
+
+	// attribute posts and media to users
+	byUser := map[string]*userStorage{}
+	userStorageOf := func(userID string) *userStorage {
+		if byUser[userID] == nil {
+			byUser[userID] = &userStorage{UserID: userID}
+		}
+		return byUser[userID]
+	}
+	authors := map[string]string{}
+	for _, name := range []string{"posts", "pendingPosts"} {
+		for id, record := range colls[name] {
+			post := database.Post{}
+			err := json.Unmarshal(record, &post)
+			if err != nil {
+				return storageUsage{}, err
+			}
+			authors[id] = post.UserID
+			userStorageOf(post.UserID).Posts += int64(len(record))
+		}
+	}
+	for postID, record := range colls["postRevisions"] {
+		if userID, ok := authors[postID]; ok {
+			userStorageOf(userID).Posts += int64(len(record))
+		}
+	}
+	for _, record := range colls["media"] {
+		media := database.Media{}
+		err := json.Unmarshal(record, &media)
+		if err != nil {
+			return storageUsage{}, err
+		}
+		usage.Media.Files++
+		usage.Media.Bytes += media.Size
+		// avatars have a user, attachments a post
+		userID := media.UserID
+		if userID == "" {
+			userID = authors[media.PostID]
+		}
+		if userID != "" {
+			userStorageOf(userID).Media += media.Size
+		}
+	}
+
+	// rank users
+	for userID, consumer := range byUser {
+		user := database.User{}
+		record, ok := colls["users"][userID]
+		if !ok {
+			continue
+		}
+		err := json.Unmarshal(record, &user)
+		if err != nil {
+			return storageUsage{}, err
+		}
+		consumer.Email = user.Email
+		consumer.Total = consumer.Posts + consumer.Media
+		usage.TopUsers = append(usage.TopUsers, *consumer)
+	}
+	sort.Slice(usage.TopUsers, func(i, j int) bool {
+		if usage.TopUsers[i].Total != usage.TopUsers[j].Total {
+			return usage.TopUsers[i].Total > usage.TopUsers[j].Total
+		}
+		return usage.TopUsers[i].Email < usage.TopUsers[j].Email
+	})
+	if len(usage.TopUsers) > top {
+		usage.TopUsers = usage.TopUsers[:top]
+	}
+	return usage, nil
+}
+
+// fileSize returns the size of the file at path, 0 for no path or a file
+// not written yet.
+func fileSize(path string) (int64, error) {
+	if path == "" {
+		return 0, nil
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/audit"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestAdminStorage(t *testing.T) {
+	c := database.NewMemoryClient()
+	ann, err := c.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := c.CreateUser("bob@example.com", "12345", "Bob", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateUser("eve@example.com", "12345", "Eve", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := c.CreatePost(ann.ID, "hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.AddMedia(post.ID, database.Media{ID: "photo", Filename: "photo.png", ContentType: "image/png", Size: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = c.SetAvatar(bob.ID, database.Media{ID: "avatar", Filename: "avatar.png", ContentType: "image/png", Size: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog := audit.NewLog(filepath.Join(t.TempDir(), "audit.log"))
+	err = auditLog.Append(audit.Entry{IP: "127.0.0.1", Method: "POST", Path: "/v1/users", Resource: "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{dbClient: c, audit: auditLog}
+
+	w := httptest.NewRecorder()
+	apiCfg.handlerAdminStorage(w, httptest.NewRequest(http.MethodGet, "/admin/storage?top=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	usage := storageUsage{}
+	err = json.NewDecoder(w.Body).Decode(&usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Users == 0 || usage.Posts == 0 || usage.Users != usage.Collections["users"] {
+		t.Errorf("got users %d and posts %d bytes, want both counted", usage.Users, usage.Posts)
+	}
+	total := int64(0)
+	for _, size := range usage.Collections {
+		total += size
+	}
+	if usage.Database != total {
+		t.Errorf("got database %d bytes, want the sum of collections %d", usage.Database, total)
+	}
+	if usage.Media != (mediaUsage{Files: 2, Bytes: 6000}) {
+		t.Errorf("got media %+v, want 2 files of 6000 bytes", usage.Media)
+	}
+	if usage.AuditLog == 0 {
+		t.Error("audit log isn't counted")
+	}
+	if len(usage.TopUsers) != 2 {
+		t.Fatalf("got top users %+v, want 2", usage.TopUsers)
+	}
+	if got := usage.TopUsers[0]; got.Email != "bob@example.com" || got.Media != 5000 || got.Posts != 0 || got.Total != 5000 {
+		t.Errorf("got first %+v, want bob with his avatar", got)
+	}
+	if got := usage.TopUsers[1]; got.Email != "ann@example.com" || got.Media != 1000 || got.Posts == 0 || got.Total != got.Posts+1000 {
+		t.Errorf("got second %+v, want ann with her post and photo", got)
+	}
+
+	w = httptest.NewRecorder()
+	apiCfg.handlerAdminStorage(w, httptest.NewRequest(http.MethodGet, "/admin/storage?top=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("top=0: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/linkcheck"
+)
+
+type deadLinksReport struct {
+	UserID         string          `json:"userId"`
+	UserEmail      string          `json:"userEmail"`
+	TotalDeadLinks int             `json:"totalDeadLinks"`
+	Posts          []deadLinksPost `json:"posts"`
+}
+
+type deadLinksPost struct {
+	PostID    string    `json:"postId"`
+	DeadLinks []string  `json:"deadLinks"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+func (apiCfg apiConfig) handlerDeadLinksReport(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		UserID    string `json:"userId"`
+		UserEmail string `json:"userEmail"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check page
+	pg, err := apiCfg.pagination.parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check user exists
+	user, err := apiCfg.users().Author(params.UserID, params.UserEmail)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// build report, from the posts the user logged in with r sees
+	posts, err := apiCfg.postsFor(r).ByAuthor(user.ID, "", "")
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	report := deadLinksReport{
+		UserID:    user.ID,
+		UserEmail: user.Email,
+		Posts:     []deadLinksPost{},
+	}
+	for _, post := range posts {
+		if post.Metadata == nil || len(post.Metadata.DeadLinks) == 0 {
+			continue
+		}
+		report.TotalDeadLinks += len(post.Metadata.DeadLinks)
+		report.Posts = append(report.Posts, deadLinksPost{
+			PostID:    post.ID,
+			DeadLinks: post.Metadata.DeadLinks,
+			CheckedAt: post.Metadata.LinksCheckedAt,
+		})
+	}
+	sort.Slice(report.Posts, func(i, j int) bool {
+		return report.Posts[i].PostID < report.Posts[j].PostID
+	})
+	report.Posts = paginate(w, r, report.Posts, pg)
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+func (apiCfg apiConfig) checkDeadLinks(ctx context.Context, checker linkcheck.Checker) {
+	if apiCfg.replication != nil && !apiCfg.replication.IsPrimary() {
+		// secondaries get link check results from the primary
+		return
+	}
+	posts, err := apiCfg.dbClient.GetAllPosts()
+	if err != nil {
+		log.Printf("dead link checker: %v", err)
+		return
+	}
+	for _, post := range posts {
+		if len(linkcheck.ExtractURLs(post.Text)) == 0 {
+			continue
+		}
+		deadLinks := checker.DeadLinks(ctx, post.Text)
+		if post.Metadata != nil && reflect.DeepEqual(post.Metadata.DeadLinks, deadLinks) {
+			continue
+		}
+		_, err := apiCfg.dbClient.SetPostDeadLinks(post.ID, deadLinks)
+		if err != nil {
+			log.Printf("dead link checker: %v", err)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/firyx/boot.dev-api-backend/internal/openapi"
+)
+
+func (apiCfg apiConfig) handlerGetChangelog(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Releases []openapi.Release `json:"releases"`
+	}
+	specs, err := openapi.LoadSpecs()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		Releases: openapi.Changelog(specs),
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+type healthDetails struct {
+	Database database.IntegrityStatus `json:"database"`
+}
+
+type healthResponse struct {
+	Status  string        `json:"status"`
+	Details healthDetails `json:"details"`
+}
+
+func (apiCfg apiConfig) handlerHealthz(w http.ResponseWriter, r *http.Request) {
+	health := healthResponse{
+		Status: "ok",
+		Details: healthDetails{
+			Database: apiCfg.dbClient.Integrity(),
+		},
+	}
+	if !health.Details.Database.OK {
+		health.Status = "degraded"
+		respondWithJSON(w, http.StatusServiceUnavailable, health)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, health)
+}
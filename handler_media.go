@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/router"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+	"github.com/firyx/boot.dev-api-backend/internal/storage"
+	"github.com/google/uuid"
+)
+
+// mediaConfig holds where uploads are stored and what is accepted. Uploaded
+// files aren't replicated, secondaries need a shared storage backend.
+type mediaConfig struct {
+	store        storage.Backend
+	maxSize      int64
+	allowedTypes map[string]bool
+	// presignExpiry is how long direct upload and download URLs stay valid
+	// when store is a storage.Presigner, and how long message attachment
+	// download URLs stay valid.
+	presignExpiry time.Duration
+	// attachmentQuota bounds the total size of the files attached to the
+	// messages of a conversation.
+	attachmentQuota int64
+}
+
+var errDirectUploadsUnsupported = apiError{Code: codeNotImplemented, Message: "direct uploads need an object storage backend, upload through /posts/{post-id}/media"}
+
+var errInvalidUploadToken = apiError{Code: codeInvalidToken, Message: "upload token is invalid or expired, or for another upload"}
+
+// mediaUploadGrace is how long after its upload URL expires a direct upload
+// can still be completed.
+const mediaUploadGrace = time.Hour
+
+// mediaRoutes are the routes below /media.
+var mediaRoutes = newRoutes([]route{
+	{http.MethodGet, "/{media-id}", apiConfig.handlerGetMedia},
+})
+
+func (apiCfg apiConfig) endpointMediaHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(mediaRoutes, "/media", w, r)
+}
+
+// handlerUploadMedia accepts a multipart upload with the file in the "file"
+// field. The content type is sniffed from the file rather than trusted from
+// the client.
+func (apiCfg apiConfig) handlerUploadMedia(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	id, err := getPostUuid(apiCfg, r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /posts/{post-id}/media"))
+		return
+	}
+
+	// check post is by the user logged in
+	_, err = apiCfg.posts().Authored(id, userID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// store file
+	upload, ok := apiCfg.storeUpload(w, r, apiCfg.media.maxSize, apiCfg.checkMediaType)
+	if !ok {
+		return
+	}
+
+	// record media
+	media, err := apiCfg.dbClient.AddMedia(id, upload)
+	if err != nil {
+		apiCfg.deleteMediaFile(upload.ID)
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, media)
+}
+
+// storeUpload stores the file in the "file" field of a multipart upload,
+// sniffing its content type rather than trusting the client. Files over
+// maxSize bytes, or whose type checkType rejects, aren't stored; a nil
+// checkType accepts any type. It returns the media to record, or responds
+// with the error and returns false.
+func (apiCfg apiConfig) storeUpload(w http.ResponseWriter, r *http.Request, maxSize int64, checkType func(contentType string) error) (database.Media, bool) {
+	// get file, leaving room for the multipart headers
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1024*1024)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return database.Media{}, false
+	}
+	var part io.ReadCloser
+	filename := ""
+	for {
+		p, err := reader.NextPart()
+		if err != nil {
+			respondWithUploadError(w, uploadError(err, "missing \"file\" field"))
+			return database.Media{}, false
+		}
+		if p.FormName() == "file" {
+			part = p
+			filename = filepath.Base(p.FileName())
+			break
+		}
+		p.Close()
+	}
+	defer part.Close()
+
+	// check type
+	buffered := bufio.NewReaderSize(part, 512)
+	head, err := buffered.Peek(512)
+	if err != nil && err != io.EOF {
+		respondWithUploadError(w, uploadError(err, ""))
+		return database.Media{}, false
+	}
+	contentType := http.DetectContentType(head)
+	if checkType != nil {
+		err = checkType(contentType)
+		if err != nil {
+			respondWithUploadError(w, err)
+			return database.Media{}, false
+		}
+	}
+
+	// store file, one byte over the limit is enough to reject it
+	mediaID := uuid.NewString()
+	size, err := apiCfg.media.store.Put(mediaID, io.LimitReader(buffered, maxSize+1))
+	if err == nil && size > maxSize {
+		err = errMediaTooLarge(maxSize)
+	}
+	if err != nil {
+		apiCfg.deleteMediaFile(mediaID)
+		respondWithUploadError(w, uploadError(err, ""))
+		return database.Media{}, false
+	}
+	return database.Media{
+		ID:          mediaID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+	}, true
+}
+
+type mediaUpload struct {
+	MediaID string `json:"mediaId"`
+	// Token is sent back to complete the upload, so only media IDs handed
+	// out for the post are recorded.
+	Token     string            `json:"token"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// handlerCreateMediaUpload hands out a pre-signed URL the client uploads the
+// file to directly, so large files never pass through the API server. The
+// upload is recorded once the client calls handlerCompleteMediaUpload.
+func (apiCfg apiConfig) handlerCreateMediaUpload(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ContentType string `json:"contentType"`
+		Size        int64  `json:"size"`
+	}
+
+	presigner, ok := apiCfg.media.store.(storage.Presigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, errDirectUploadsUnsupported)
+		return
+	}
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	id, err := getPostUuid(apiCfg, r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /posts/{post-id}/media/uploads"))
+		return
+	}
+
+	// get params
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check post is by the user logged in
+	_, err = apiCfg.posts().Authored(id, userID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// check file, the size is checked again once uploaded
+	err = apiCfg.checkMedia(params.ContentType, params.Size)
+	if err != nil {
+		respondWithUploadError(w, err)
+		return
+	}
+
+	// sign upload
+	mediaID := uuid.NewString()
+	url, err := presigner.PresignPut(mediaID, params.ContentType, apiCfg.media.presignExpiry)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	now := time.Now().UTC()
+	token, err := auth.Sign(apiCfg.mediaUploadSecret(), auth.NewClaims(mediaUploadSubject(id, mediaID), now, apiCfg.media.presignExpiry+mediaUploadGrace))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, mediaUpload{
+		MediaID:   mediaID,
+		Token:     token,
+		Method:    http.MethodPut,
+		URL:       url,
+		Headers:   map[string]string{"Content-Type": params.ContentType},
+		ExpiresAt: now.Add(apiCfg.media.presignExpiry),
+	})
+}
+
+// handlerCompleteMediaUpload records a file uploaded to a pre-signed URL,
+// given the token handed out with the URL. Files that turn out too large are
+// deleted.
+func (apiCfg apiConfig) handlerCompleteMediaUpload(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Filename string `json:"filename"`
+	}
+
+	presigner, ok := apiCfg.media.store.(storage.Presigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, errDirectUploadsUnsupported)
+		return
+	}
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	id, err := getPostUuid(apiCfg, r)
+	mediaID := router.Param(r, "media-id")
+	if err != nil || mediaID == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /posts/{post-id}/media/uploads/{media-id}"))
+		return
+	}
+
+	// get params, the filename is optional
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check post is by the user logged in
+	_, err = apiCfg.posts().Authored(id, userID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// check the upload was handed out for this post
+	claims, err := auth.Verify(apiCfg.mediaUploadSecret(), params.Token, time.Now())
+	if err != nil || claims.Subject != mediaUploadSubject(id, mediaID) {
+		respondWithError(w, http.StatusBadRequest, errInvalidUploadToken)
+		return
+	}
+
+	// check upload
+	info, err := presigner.Stat(mediaID)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, apiError{Code: codeNotFound, Message: "nothing was uploaded for that media id"})
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = apiCfg.checkMedia(info.ContentType, info.Size)
+	if err != nil {
+		apiCfg.deleteMediaFile(mediaID)
+		respondWithUploadError(w, err)
+		return
+	}
+
+	// record media
+	media, err := apiCfg.dbClient.AddMedia(id, database.Media{
+		ID:          mediaID,
+		Filename:    filepath.Base(params.Filename),
+		ContentType: info.ContentType,
+		Size:        info.Size,
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, media)
+}
+
+// mediaUploadSecret signs direct upload tokens with a key of their own, so
+// they can't pass as session tokens.
+func (apiCfg apiConfig) mediaUploadSecret() []byte {
+	return append([]byte("media-upload:"), apiCfg.auth.secret...)
+}
+
+func mediaUploadSubject(postID, mediaID string) string {
+	return postID + "/" + mediaID
+}
+
+// checkMediaType checks the sniffed type of a file uploaded through the API.
+func (apiCfg apiConfig) checkMediaType(contentType string) error {
+	return apiCfg.checkMedia(contentType, 0)
+}
+
+// checkMedia checks the type and size a client declared for a direct upload.
+func (apiCfg apiConfig) checkMedia(contentType string, size int64) error {
+	if !apiCfg.media.allowedTypes[contentType] {
+		return apiError{
+			Code:    codeUnsupportedMedia,
+			Message: fmt.Sprintf("files of type %s aren't accepted", contentType),
+			Details: map[string][]string{"allowedTypes": sortedKeys(apiCfg.media.allowedTypes)},
+		}
+	}
+	if policy := apiCfg.settings.get().ContentPolicy; !service.MediaTypeAllowed(policy, contentType) {
+		return apiError{
+			Code:    codeUnsupportedMedia,
+			Message: fmt.Sprintf("files of type %s aren't accepted here", contentType),
+			Details: map[string][]string{"allowedTypes": policy.AllowedMediaTypes},
+		}
+	}
+	if size > apiCfg.media.maxSize {
+		return errMediaTooLarge(apiCfg.media.maxSize)
+	}
+	return nil
+}
+
+func (apiCfg apiConfig) handlerGetMedia(w http.ResponseWriter, r *http.Request) {
+	// check path
+	id, err := routeParam(r, "media-id", "not a valid URL: %s/{media-id}", "/media")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /media/{media-id}"))
+		return
+	}
+
+	// check media exists, message attachments are only served to the users
+	// of their conversation
+	media, err := apiCfg.dbClient.GetMedia(id)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if media.MessageID != "" {
+		respondWithError(w, http.StatusNotFound, apiError{Code: codeNotFound, Message: fmt.Sprintf("media with id %s doesn't exist", id)})
+		return
+	}
+
+	// object storage serves the file itself
+	if presigner, ok := apiCfg.media.store.(storage.Presigner); ok {
+		url, err := presigner.PresignGet(media.ID, apiCfg.media.presignExpiry)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	}
+
+	// serve file, media never changes once uploaded
+	apiCfg.serveMediaFile(w, media, "inline", "public, max-age=31536000, immutable")
+}
+
+// serveMediaFile writes the stored file of media with the given
+// Content-Disposition type and Cache-Control header.
+func (apiCfg apiConfig) serveMediaFile(w http.ResponseWriter, media database.Media, disposition, cacheControl string) {
+	file, err := apiCfg.media.store.Get(media.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", media.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(media.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", cacheControl)
+	if media.Filename != "" {
+		disposition += fmt.Sprintf("; filename=%q", media.Filename)
+	}
+	w.Header().Set("Content-Disposition", disposition)
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, file)
+}
+
+// deleteMediaFile removes stored files whose upload didn't complete, or
+// whose post was deleted.
+func (apiCfg apiConfig) deleteMediaFile(id string) {
+	err := apiCfg.media.store.Delete(id)
+	if err != nil {
+		log.Printf("deleting media %s: %v", id, err)
+	}
+}
+
+func errMediaTooLarge(maxSize int64) apiError {
+	return apiError{
+		Code:    codeMediaTooLarge,
+		Message: fmt.Sprintf("files can be at most %d bytes", maxSize),
+		Details: map[string]int64{"maxSize": maxSize},
+	}
+}
+
+// uploadError turns errors from reading the request body into API errors,
+// using message for a body that ended before the file.
+func uploadError(err error, message string) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return errMediaTooLarge(maxBytesErr.Limit - 1024*1024)
+	}
+	if err == io.EOF && message != "" {
+		return validationFailed(errors.New(message))
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return validationFailed(errors.New("upload ended early"))
+	}
+	return err
+}
+
+func respondWithUploadError(w http.ResponseWriter, err error) {
+	var apiErr apiError
+	if !errors.As(err, &apiErr) {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if apiErr.Code == codeMediaTooLarge {
+		respondWithError(w, http.StatusRequestEntityTooLarge, apiErr)
+		return
+	}
+	if apiErr.Code == codeUnsupportedMedia {
+		respondWithError(w, http.StatusUnsupportedMediaType, apiErr)
+		return
+	}
+	respondWithError(w, http.StatusBadRequest, apiErr)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/storage"
+)
+
+func TestHandlerUploadMedia(t *testing.T) {
+	dir := t.TempDir()
+	c := database.NewClient(filepath.Join(dir, "db.json"))
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateUser("other@example.com", "12345", "Other", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := c.CreatePost(user.ID, "hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewLocalDisk(filepath.Join(dir, "media"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		postsprefix: "/posts",
+		media: mediaConfig{
+			store:        store,
+			maxSize:      64,
+			allowedTypes: map[string]bool{"image/png": true},
+		},
+		auth: testAuth,
+	}
+	author, other := mediaTestLogin(t, apiCfg, "test@example.com"), mediaTestLogin(t, apiCfg, "other@example.com")
+
+	png := []byte("\x89PNG\r\n\x1a\n")
+	var tests = []struct {
+		name           string
+		token          string
+		content        []byte
+		expectedStatus int
+	}{
+		{name: "logged out", content: png, expectedStatus: http.StatusUnauthorized},
+		{name: "someone else's post", token: other, content: png, expectedStatus: http.StatusForbidden},
+		{name: "png", token: author, content: png, expectedStatus: http.StatusCreated},
+		{name: "text", token: author, content: []byte("hello"), expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "too large", token: author, content: append(png, make([]byte, 64)...), expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		part, err := form.CreateFormFile("file", tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(tt.content)
+		form.Close()
+		r := httptest.NewRequest(http.MethodPost, "/posts/"+post.ID+"/media", body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		apiCfg.endpointPostsHandler(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+
+	post, err = c.GetPost(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(post.Media) != 1 {
+		t.Fatalf("got %d media, want 1", len(post.Media))
+	}
+	w := httptest.NewRecorder()
+	apiCfg.endpointMediaHandler(w, httptest.NewRequest(http.MethodGet, "/media/"+post.Media[0], nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || !bytes.Equal(w.Body.Bytes(), png) {
+		t.Errorf("got %d %s %q, want the uploaded png", w.Code, w.Header().Get("Content-Type"), w.Body.Bytes())
+	}
+}
+
+// testAuth is the auth config of handler tests, whose users log in with
+// mediaTestLogin.
+var testAuth = authConfig{secret: []byte("secret"), sessionTTL: time.Hour, maxFailures: 3}
+
+// mediaTestLogin logs in the user with email and the password 12345, and
+// returns their session token.
+func mediaTestLogin(t *testing.T, apiCfg apiConfig, email string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	apiCfg.handlerLogin(w, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email": "`+email+`", "password": "12345"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: got status %d: %s", w.Code, w.Body)
+	}
+	s := session{}
+	err := json.NewDecoder(w.Body).Decode(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Token
+}
+
+// fakeS3 keeps objects in memory and ignores signatures.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = data
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+	case http.MethodHead, http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[r.URL.Path])
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestHandlerDirectMediaUpload(t *testing.T) {
+	c := database.NewClient(filepath.Join(t.TempDir(), "db.json"))
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateUser("other@example.com", "12345", "Other", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := c.CreatePost(user.ID, "hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPost, err := c.CreatePost(user.ID, "hello again", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeS3{objects: map[string][]byte{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	store, err := storage.NewS3(storage.S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "media",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		postsprefix: "/posts",
+		media: mediaConfig{
+			store:         store,
+			maxSize:       64,
+			allowedTypes:  map[string]bool{"image/png": true},
+			presignExpiry: time.Minute,
+		},
+		auth: testAuth,
+	}
+	author, other := mediaTestLogin(t, apiCfg, "test@example.com"), mediaTestLogin(t, apiCfg, "other@example.com")
+	request := func(path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		apiCfg.endpointPostsHandler(w, r)
+		return w
+	}
+	png := []byte("\x89PNG\r\n\x1a\n")
+	if w := request("/posts/"+post.ID+"/media/uploads", "", `{"contentType": "image/png", "size": 8}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("logged out: got status %d, want 401", w.Code)
+	}
+	if w := request("/posts/"+post.ID+"/media/uploads", other, `{"contentType": "image/png", "size": 8}`); w.Code != http.StatusForbidden {
+		t.Errorf("someone else's post: got status %d, want 403", w.Code)
+	}
+
+	var tests = []struct {
+		name             string
+		contentType      string
+		content          []byte
+		expectedStatus   int
+		expectedComplete int
+	}{
+		{name: "png", contentType: "image/png", content: png, expectedStatus: http.StatusCreated, expectedComplete: http.StatusCreated},
+		{name: "text", contentType: "text/plain", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "too large", contentType: "image/png", content: make([]byte, 65), expectedStatus: http.StatusCreated, expectedComplete: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		// ask for an upload URL, declaring a small size
+		w := request("/posts/"+post.ID+"/media/uploads", author, `{"contentType": "`+tt.contentType+`", "size": 8}`)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+			continue
+		}
+		if w.Code != http.StatusCreated {
+			continue
+		}
+		upload := mediaUpload{}
+		err = json.NewDecoder(w.Body).Decode(&upload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// upload straight to storage
+		r, err := http.NewRequest(upload.Method, upload.URL, bytes.NewReader(tt.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", upload.Headers["Content-Type"])
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		w = request("/posts/"+post.ID+"/media/uploads/"+upload.MediaID, author, `{"token": "`+upload.Token+`", "filename": "a.png"}`)
+		if w.Code != tt.expectedComplete {
+			t.Errorf("%s: got status %d completing, want %d: %s", tt.name, w.Code, tt.expectedComplete, w.Body)
+		}
+	}
+
+	// only media IDs handed out for the post are recorded
+	w := request("/posts/"+post.ID+"/media/uploads", author, `{"contentType": "image/png", "size": 8}`)
+	upload := mediaUpload{}
+	err = json.NewDecoder(w.Body).Decode(&upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.objects["/media/"+upload.MediaID] = png
+	fake.types["/media/"+upload.MediaID] = "image/png"
+	var completions = []struct {
+		name  string
+		path  string
+		token string
+		body  string
+		code  int
+	}{
+		{name: "logged out", path: "/posts/" + post.ID + "/media/uploads/" + upload.MediaID, body: `{"token": "` + upload.Token + `"}`, code: http.StatusUnauthorized},
+		{name: "no token", path: "/posts/" + post.ID + "/media/uploads/" + upload.MediaID, token: author, body: `{}`, code: http.StatusBadRequest},
+		{name: "other media", path: "/posts/" + post.ID + "/media/uploads/0b4a1d6e-8c1f-4f5e-9a57-5f1a8d0f6b2c", token: author, body: `{"token": "` + upload.Token + `"}`, code: http.StatusBadRequest},
+		{name: "other post", path: "/posts/" + otherPost.ID + "/media/uploads/" + upload.MediaID, token: author, body: `{"token": "` + upload.Token + `"}`, code: http.StatusBadRequest},
+	}
+	for _, tt := range completions {
+		if w := request(tt.path, tt.token, tt.body); w.Code != tt.code {
+			t.Errorf("completing %s: got status %d, want %d: %s", tt.name, w.Code, tt.code, w.Body)
+		}
+	}
+	delete(fake.objects, "/media/"+upload.MediaID)
+
+	post, err = c.GetPost(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(post.Media) != 1 {
+		t.Fatalf("got %d media, want 1", len(post.Media))
+	}
+	if len(fake.objects) != 1 {
+		t.Errorf("got %d stored files, want the rejected one deleted", len(fake.objects))
+	}
+	w = httptest.NewRecorder()
+	apiCfg.endpointMediaHandler(w, httptest.NewRequest(http.MethodGet, "/media/"+post.Media[0], nil))
+	if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), server.URL+"/media/"+post.Media[0]+"?") {
+		t.Errorf("got %d %s, want a redirect to storage", w.Code, w.Header().Get("Location"))
+	}
+}
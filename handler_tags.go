@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// handlerTagCounts returns every tag with its number of posts, most used
+// first, for building tag clouds.
+func (apiCfg apiConfig) handlerTagCounts(w http.ResponseWriter, r *http.Request) {
+	counts, err := apiCfg.dbClient.TagCounts()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	tags := make([]tagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, tagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	respondWithJSON(w, http.StatusOK, tags)
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testServer runs the whole server, with every route and middleware,
+// against a temporary directory.
+type testServer struct {
+	t     *testing.T
+	api   *httptest.Server
+	admin *httptest.Server
+}
+
+func newTestServer(t *testing.T, backend string) *testServer {
+	t.Helper()
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	cfg.addr = "api"
+	cfg.adminAddr = "admin"
+	cfg.listeners = nil
+	cfg.dbBackend = backend
+	cfg.dbPath = filepath.Join(dir, "db.json")
+	cfg.auditLog = filepath.Join(dir, "audit.log")
+	cfg.backupDir = filepath.Join(dir, "backups")
+	cfg.tenantsDir = filepath.Join(dir, "tenants")
+	cfg.mediaDir = filepath.Join(dir, "media")
+	cfg.mediaStorage = "local"
+	cfg.replicationRole = ""
+	cfg.canaryDBPath = ""
+	cfg.sampleRate = 0
+	cfg.sampleRouteRates = nil
+	cfg.throttleBudget = 0
+	cfg.jwtSecret = []byte("secret")
+	cfg.translateProvider = "mock"
+	// scheduled jobs would race the requests under test
+	cfg.deadLinkInterval = 0
+	cfg.leaderboardInterval = 0
+	cfg.searchRebuildInterval = 0
+	cfg.existenceRebuildInterval = 0
+	cfg.streakCheckInterval = 0
+	cfg.compactInterval = 0
+	cfg.loginPurgeInterval = 0
+	cfg.statsInterval = 0
+
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.stop)
+	ts := &testServer{
+		t:     t,
+		api:   httptest.NewServer(s.servers[0].Handler),
+		admin: httptest.NewServer(s.servers[1].Handler),
+	}
+	t.Cleanup(ts.api.Close)
+	t.Cleanup(ts.admin.Close)
+	return ts
+}
+
+// do sends a request and returns the response with its body read.
+func (ts *testServer) do(srv *httptest.Server, method, path, token, contentType, body string) (*http.Response, []byte) {
+	ts.t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return resp, data
+}
+
+func TestIntegration(t *testing.T) {
+	for _, backend := range []string{"file", "memory"} {
+		t.Run(backend, func(t *testing.T) {
+			testIntegration(t, backend)
+		})
+	}
+}
+
+func testIntegration(t *testing.T, backend string) {
+	ts := newTestServer(t, backend)
+	// vars are filled in from responses and replace {name} in later steps
+	vars := map[string]string{}
+	expand := func(s string) string {
+		for name, value := range vars {
+			s = strings.ReplaceAll(s, "{"+name+"}", value)
+		}
+		return s
+	}
+
+	var tests = []struct {
+		name   string
+		admin  bool
+		method string
+		path   string
+		// auth sends the session token saved as {token}, or the one saved as
+		// the var named by as
+		auth           bool
+		as             string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedCode   errorCode
+		// save maps a var name to a top level field of the response
+		save map[string]string
+	}{
+		// users
+		{name: "create user", method: "POST", path: "/v1/users", body: `{"email":"ann@example.com","password":"12345","name":"Ann","username":"ann","age":18}`, expectedStatus: 201, save: map[string]string{"user": "id"}},
+		{name: "create second user", method: "POST", path: "/v1/users", body: `{"email":"bob@example.com","password":"12345","name":"Bob","age":30}`, expectedStatus: 201, save: map[string]string{"bob": "id"}},
+		{name: "create duplicate user", method: "POST", path: "/v1/users", body: `{"email":"ann@example.com","password":"12345","age":18}`, expectedStatus: 409, expectedCode: codeUserAlreadyExists},
+		{name: "create user with taken username", method: "POST", path: "/v1/users", body: `{"email":"carol@example.com","password":"12345","username":"Ann","age":18}`, expectedStatus: 409, expectedCode: codeConflict},
+		{name: "create user with invalid username", method: "POST", path: "/v1/users", body: `{"email":"carol@example.com","password":"12345","username":"a b","age":18}`, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "create underage user", method: "POST", path: "/v1/users", body: `{"email":"kid@example.com","password":"12345","age":16}`, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "create user with bad JSON", method: "POST", path: "/v1/users", body: `{`, expectedStatus: 400, expectedCode: codeInvalidRequest},
+		{name: "get user by ID", method: "GET", path: "/v1/users/{user}", expectedStatus: 200},
+		{name: "get user by email", method: "GET", path: "/v1/users/by-email/ann@example.com", expectedStatus: 200},
+		{name: "get user by username", method: "GET", path: "/v1/users/@ann", expectedStatus: 200},
+		{name: "get missing username", method: "GET", path: "/v1/users/@nobody", expectedStatus: 404, expectedCode: codeUserNotFound},
+		{name: "get sparse user", method: "GET", path: "/v1/users/{user}?fields=email,name", expectedStatus: 200},
+		{name: "get missing user", method: "GET", path: "/v1/users/nobody@example.com", expectedStatus: 404, expectedCode: codeUserNotFound},
+		{name: "get user without ID", method: "GET", path: "/v1/users/", expectedStatus: 405, expectedCode: codeMethodNotSupported},
+		{name: "get unknown user route", method: "GET", path: "/v1/users/{user}/unknown", expectedStatus: 404, expectedCode: codeNotFound},
+		{name: "get user profile by email", method: "GET", path: "/v1/users/by-email/ann@example.com/profile", expectedStatus: 200},
+		{name: "log in", method: "POST", path: "/v1/login", body: `{"email":"ann@example.com","password":"12345"}`, expectedStatus: 200, save: map[string]string{"token": "token"}},
+		{name: "log in as second user", method: "POST", path: "/v1/login", body: `{"email":"bob@example.com","password":"12345"}`, expectedStatus: 200, save: map[string]string{"bobToken": "token"}},
+		{name: "update user without session", method: "PUT", path: "/v1/users/{user}", body: `{"password":"12345","name":"Ann B","age":19}`, expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "update someone else", method: "PUT", path: "/v1/users/{user}", as: "bobToken", body: `{"password":"12345","name":"Ann B","age":19}`, expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "update user", method: "PUT", path: "/v1/users/{user}", auth: true, body: `{"password":"12345","name":"Ann B","age":19}`, expectedStatus: 200},
+		{name: "update missing user", method: "PUT", path: "/v1/users/nobody@example.com", auth: true, body: `{"password":"12345","age":19}`, expectedStatus: 404, expectedCode: codeUserNotFound},
+		{name: "patch someone else", method: "PATCH", path: "/v1/users/{user}", as: "bobToken", body: `{"bio":"Gopher"}`, expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "patch user profile", method: "PATCH", path: "/v1/users/{user}", auth: true, body: `{"bio":"Gopher","website":"https://example.com"}`, expectedStatus: 200},
+		{name: "patch user with invalid website", method: "PATCH", path: "/v1/users/{user}", auth: true, body: `{"website":"example.com"}`, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "get public profile", method: "GET", path: "/v1/users/{user}/profile", expectedStatus: 200},
+		{name: "get public profile by username", method: "GET", path: "/v1/users/@ann/profile", expectedStatus: 200},
+		{name: "pick username", method: "PATCH", path: "/v1/users/{bob}", as: "bobToken", body: `{"username":"bob"}`, expectedStatus: 200},
+		{name: "upload avatar without session", method: "POST", path: "/v1/users/{user}/avatar", contentType: "multipart/form-data; boundary=b", body: "--b\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.gif\"\r\n\r\nGIF89a\x01\x00\x01\x00\r\n--b--\r\n", expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "upload someone else's avatar", method: "POST", path: "/v1/users/{user}/avatar", as: "bobToken", contentType: "multipart/form-data; boundary=b", body: "--b\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.gif\"\r\n\r\nGIF89a\x01\x00\x01\x00\r\n--b--\r\n", expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "upload avatar", method: "POST", path: "/v1/users/{user}/avatar", auth: true, contentType: "multipart/form-data; boundary=b", body: "--b\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.gif\"\r\n\r\nGIF89a\x01\x00\x01\x00\r\n--b--\r\n", expectedStatus: 201},
+		{name: "unsupported users method", method: "PATCH", path: "/v1/users", expectedStatus: 405, expectedCode: codeMethodNotSupported},
+		{name: "users methods", method: "OPTIONS", path: "/v1/users", expectedStatus: 204},
+		{name: "user headers", method: "HEAD", path: "/v1/users/{user}", auth: true, expectedStatus: 200},
+		{name: "get settings without session", method: "GET", path: "/v1/users/{user}/settings", expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "get someone else's settings", method: "GET", path: "/v1/users/{user}/settings", as: "bobToken", expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "get settings", method: "GET", path: "/v1/users/{user}/settings", auth: true, expectedStatus: 200},
+		{name: "update settings without session", method: "PUT", path: "/v1/users/{user}/settings", body: `{"timezone":"Europe/Paris"}`, expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "update someone else's settings", method: "PUT", path: "/v1/users/{user}/settings", as: "bobToken", body: `{"timezone":"Europe/Paris"}`, expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "update settings", method: "PUT", path: "/v1/users/{user}/settings", auth: true, body: `{"timezone":"Europe/Paris"}`, expectedStatus: 200},
+		{name: "get badges", method: "GET", path: "/v1/users/{user}/badges", expectedStatus: 200},
+
+		// sessions
+		{name: "log in with wrong password", method: "POST", path: "/v1/login", body: `{"email":"ann@example.com","password":"wrong"}`, expectedStatus: 401, expectedCode: codeInvalidCredentials},
+		{name: "set up 2FA without session", method: "POST", path: "/v1/users/{user}/2fa/setup", expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "list sessions", method: "GET", path: "/v1/me/sessions", auth: true, expectedStatus: 200},
+		{name: "list sessions without session", method: "GET", path: "/v1/me/sessions", expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "log out without session", method: "POST", path: "/v1/logout", expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "signup form token", method: "GET", path: "/v1/signup/form-token", expectedStatus: 200},
+		{name: "list logins", method: "GET", path: "/v1/me/logins", auth: true, expectedStatus: 200},
+		{name: "list login alerts", method: "GET", path: "/v1/me/logins?alerts=true", auth: true, expectedStatus: 200},
+		{name: "list logins without session", method: "GET", path: "/v1/me/logins", expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "batch", method: "POST", path: "/v1/batch", auth: true, body: `[{"method":"GET","path":"/v1/me/logins"},{"method":"GET","path":"/v1/users/{user}"}]`, expectedStatus: 200},
+		{name: "block self", method: "POST", path: "/v1/users/{user}/block", auth: true, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "unblock user not blocked", method: "DELETE", path: "/v1/users/{user}/block", auth: true, expectedStatus: 404, expectedCode: codeNotFound},
+		{name: "sync from scratch", method: "GET", path: "/v1/sync", auth: true, expectedStatus: 200},
+		{name: "sync with an expired token", method: "GET", path: "/v1/sync?since=0123456789abcdef.1", expectedStatus: 410, expectedCode: codeSyncTokenExpired},
+		{name: "push sync edits without since", method: "POST", path: "/v1/sync", auth: true, body: `{"posts":[]}`, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "follow self", method: "POST", path: "/v1/users/{user}/follow", auth: true, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "list follow requests", method: "GET", path: "/v1/me/follow-requests", auth: true, expectedStatus: 200},
+		{name: "accept missing follow request", method: "POST", path: "/v1/me/follow-requests/{user}/accept", auth: true, expectedStatus: 404, expectedCode: codeNotFound},
+		{name: "send message", method: "POST", path: "/v1/messages", auth: true, body: `{"recipient":"bob@example.com","text":"hi"}`, expectedStatus: 201, save: map[string]string{"message": "id"}},
+		{name: "send message to self", method: "POST", path: "/v1/messages", auth: true, body: `{"recipient":"{user}","text":"hi"}`, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "get conversation", method: "GET", path: "/v1/messages?with=bob@example.com", auth: true, expectedStatus: 200},
+		{name: "count unread messages", method: "GET", path: "/v1/messages/unread", auth: true, expectedStatus: 200},
+		{name: "read own message", method: "POST", path: "/v1/messages/{message}/read", auth: true, expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "list notifications", method: "GET", path: "/v1/notifications?unread=true", auth: true, expectedStatus: 200},
+		{name: "read notifications", method: "POST", path: "/v1/notifications/read", auth: true, body: `{"ids":[]}`, expectedStatus: 200},
+		{name: "list notifications without session", method: "GET", path: "/v1/notifications", expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "atomic batch", method: "POST", path: "/v1/batch", auth: true, body: `{"atomic":true,"requests":[{"id":"logins","method":"GET","path":"/v1/me/logins"},{"id":"user","method":"GET","path":"/v1/users/{user}"}]}`, expectedStatus: 200},
+		{name: "nested batch", method: "POST", path: "/v1/batch", body: `[{"method":"POST","path":"/batch"}]`, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "set recovery email without SMTP", method: "PUT", path: "/v1/users/{user}/recovery-email", auth: true, body: `{"email":"ann@backup.example.com"}`, expectedStatus: 501, expectedCode: codeNotImplemented},
+		{name: "set someone else's recovery email", method: "PUT", path: "/v1/users/{bob}/recovery-email", auth: true, body: `{"email":"ann@backup.example.com"}`, expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "verify recovery email with wrong token", method: "POST", path: "/v1/recovery-email/verify", auth: true, body: `{"token":"wrong"}`, expectedStatus: 400, expectedCode: codeInvalidToken},
+		{name: "request password reset without SMTP", method: "POST", path: "/v1/password-reset", body: `{"email":"ann@example.com"}`, expectedStatus: 501, expectedCode: codeNotImplemented},
+		{name: "reset password with wrong token", method: "POST", path: "/v1/password-reset/confirm", body: `{"token":"wrong","password":"54321"}`, expectedStatus: 400, expectedCode: codeInvalidToken},
+		{name: "set up 2FA for someone else", method: "POST", path: "/v1/users/{bob}/2fa/setup", auth: true, expectedStatus: 403, expectedCode: codeForbidden},
+
+		// posts
+		{name: "create post", method: "POST", path: "/v1/posts", auth: true, body: `{"userId":"{user}","text":"hello gophers","tags":["Go"]}`, expectedStatus: 201, save: map[string]string{"post": "id"}},
+		{name: "create post without session", method: "POST", path: "/v1/posts", body: `{"userId":"{user}","text":"hi"}`, expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "create post as someone else", method: "POST", path: "/v1/posts", auth: true, body: `{"userEmail":"bob@example.com","text":"hi"}`, expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "create post by email", method: "POST", path: "/v1/posts", as: "bobToken", body: `{"userEmail":"bob@example.com","text":"hi"}`, expectedStatus: 201},
+		{name: "create post mentioning a user", method: "POST", path: "/v1/posts", as: "bobToken", body: `{"text":"thanks @ann@example.com"}`, expectedStatus: 201},
+		{name: "create post mentioning a username", method: "POST", path: "/v1/posts", auth: true, body: `{"userId":"{user}","text":"thanks @bob"}`, expectedStatus: 201},
+		{name: "create post mentioning a missing user", method: "POST", path: "/v1/posts", as: "bobToken", body: `{"userEmail":"bob@example.com","text":"thanks @nobody@example.com"}`, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "create post for missing user", method: "POST", path: "/v1/posts", auth: true, body: `{"userEmail":"nobody@example.com","text":"hi"}`, expectedStatus: 404, expectedCode: codeUserNotFound},
+		{name: "create post with invalid tag", method: "POST", path: "/v1/posts", auth: true, body: `{"userId":"{user}","text":"hi","tags":["two words"]}`, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "list posts of user", method: "GET", path: "/v1/posts", body: `{"userId":"{user}"}`, expectedStatus: 200},
+		{name: "list posts by tag", method: "GET", path: "/v1/posts?tag=go", expectedStatus: 200},
+		{name: "list posts without user", method: "GET", path: "/v1/posts", expectedStatus: 400},
+		{name: "list posts with too large page", method: "GET", path: "/v1/posts?tag=go&limit=100000", expectedStatus: 400, expectedCode: codePageSizeTooLarge},
+		{name: "list posts by cursor", method: "GET", path: "/v1/posts?tag=go&limit=1&cursor=", expectedStatus: 200},
+		{name: "list posts with invalid cursor", method: "GET", path: "/v1/posts?tag=go&cursor=nope", expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "update post without session", method: "PUT", path: "/v1/posts/{post}", body: `{"text":"hello again","tags":["go"]}`, expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "update someone else's post", method: "PUT", path: "/v1/posts/{post}", as: "bobToken", body: `{"text":"hello again","tags":["go"]}`, expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "update post", method: "PUT", path: "/v1/posts/{post}", auth: true, body: `{"text":"hello again","tags":["go"]}`, expectedStatus: 200},
+		{name: "update missing post", method: "PUT", path: "/v1/posts/0b4a1d6e-8c1f-4f5e-9a57-5f1a8d0f6b2c", auth: true, body: `{"text":"x"}`, expectedStatus: 404, expectedCode: codePostNotFound},
+		{name: "update post without ID", method: "PUT", path: "/v1/posts/", body: `{"text":"x"}`, expectedStatus: 405, expectedCode: codeMethodNotSupported},
+		{name: "unsupported posts method", method: "PATCH", path: "/v1/posts", expectedStatus: 405, expectedCode: codeMethodNotSupported},
+		{name: "upload media without session", method: "POST", path: "/v1/posts/{post}/media", contentType: "multipart/form-data; boundary=b", body: "--b\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.gif\"\r\n\r\nGIF89a\x01\x00\x01\x00\r\n--b--\r\n", expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "upload media to someone else's post", method: "POST", path: "/v1/posts/{post}/media", as: "bobToken", contentType: "multipart/form-data; boundary=b", body: "--b\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.gif\"\r\n\r\nGIF89a\x01\x00\x01\x00\r\n--b--\r\n", expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "upload media", method: "POST", path: "/v1/posts/{post}/media", auth: true, contentType: "multipart/form-data; boundary=b", body: "--b\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.gif\"\r\n\r\nGIF89a\x01\x00\x01\x00\r\n--b--\r\n", expectedStatus: 201, save: map[string]string{"media": "id"}},
+		{name: "upload media without a file", method: "POST", path: "/v1/posts/{post}/media", auth: true, contentType: "multipart/form-data; boundary=b", body: "--b--\r\n", expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "upload media to missing post", method: "POST", path: "/v1/posts/0b4a1d6e-8c1f-4f5e-9a57-5f1a8d0f6b2c/media", auth: true, expectedStatus: 404, expectedCode: codePostNotFound},
+		{name: "get media", method: "GET", path: "/v1/media/{media}", expectedStatus: 200},
+		{name: "get missing media", method: "GET", path: "/v1/media/0b4a1d6e-8c1f-4f5e-9a57-5f1a8d0f6b2c", expectedStatus: 404},
+		{name: "translate post", method: "GET", path: "/v1/posts/{post}/translate?to=fr", expectedStatus: 200},
+		{name: "translate post without a language", method: "GET", path: "/v1/posts/{post}/translate", expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "translate missing post", method: "GET", path: "/v1/posts/0b4a1d6e-8c1f-4f5e-9a57-5f1a8d0f6b2c/translate?to=fr", expectedStatus: 404, expectedCode: codePostNotFound},
+		{name: "post revisions", method: "GET", path: "/v1/posts/{post}/revisions", expectedStatus: 200},
+		{name: "revisions of missing post", method: "GET", path: "/v1/posts/0b4a1d6e-8c1f-4f5e-9a57-5f1a8d0f6b2c/revisions", expectedStatus: 404, expectedCode: codePostNotFound},
+		{name: "revert post without session", method: "POST", path: "/v1/posts/{post}/revert/1", expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "revert post to missing revision", method: "POST", path: "/v1/posts/{post}/revert/9", auth: true, expectedStatus: 404, expectedCode: codeRevisionNotFound},
+		{name: "revert post to invalid revision", method: "POST", path: "/v1/posts/{post}/revert/first", auth: true, expectedStatus: 400, expectedCode: codeInvalidPath},
+		{name: "revert post", method: "POST", path: "/v1/posts/{post}/revert/1", auth: true, expectedStatus: 200},
+		{name: "dead links", method: "GET", path: "/v1/posts/deadlinks", body: `{"userId":"{user}"}`, expectedStatus: 200},
+		{name: "post analytics", method: "GET", path: "/v1/users/{user}/posts/analytics", expectedStatus: 200},
+
+		// discovery
+		{name: "tags", method: "GET", path: "/v1/tags", expectedStatus: 200},
+		{name: "tags headers", method: "HEAD", path: "/v1/tags", expectedStatus: 200},
+		{name: "tags methods", method: "OPTIONS", path: "/v1/tags", expectedStatus: 204},
+		{name: "search", method: "GET", path: "/v1/search?q=gophers", expectedStatus: 200},
+		{name: "search without query", method: "GET", path: "/v1/search", expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "leaderboard", method: "GET", path: "/v1/leaderboards/posters", expectedStatus: 200},
+		{name: "graphql", method: "POST", path: "/v1/graphql", body: `{"query":"{ post(id: \"{post}\") { text author { name } } }"}`, expectedStatus: 200},
+		{name: "graphql mutation with session", method: "POST", path: "/v1/graphql", auth: true, body: `{"query":"mutation { createPost(text: \"via graphql\") { id } }"}`, expectedStatus: 200},
+		{name: "invalid graphql", method: "POST", path: "/v1/graphql", body: `{"query":"{ nope }"}`, expectedStatus: 400},
+		{name: "legacy path", method: "GET", path: "/users/{user}", expectedStatus: 200},
+		{name: "unsupported API version", method: "GET", path: "/v9/users/{user}", expectedStatus: 404},
+
+		// service routes
+		{name: "healthz", method: "GET", path: "/healthz", expectedStatus: 200},
+		{name: "version", method: "GET", path: "/version", expectedStatus: 200},
+		{name: "changelog", method: "GET", path: "/docs/changelog", expectedStatus: 200},
+
+		// admin routes are only on the admin listener
+		{name: "metrics", admin: true, method: "GET", path: "/metrics", expectedStatus: 200},
+		{name: "admin jobs", admin: true, method: "GET", path: "/admin/jobs", expectedStatus: 200},
+		{name: "admin tasks", admin: true, method: "GET", path: "/admin/tasks", expectedStatus: 200},
+		{name: "admin emails", admin: true, method: "GET", path: "/admin/emails", expectedStatus: 200},
+		{name: "admin email templates", admin: true, method: "GET", path: "/admin/emails/templates", expectedStatus: 200},
+		{name: "admin audit", admin: true, method: "GET", path: "/admin/audit", expectedStatus: 200},
+		{name: "admin users CSV", admin: true, method: "GET", path: "/admin/users.csv", expectedStatus: 200},
+		{name: "admin posts CSV", admin: true, method: "GET", path: "/admin/posts.csv", expectedStatus: 200},
+		{name: "admin deprecations", admin: true, method: "GET", path: "/admin/deprecations", expectedStatus: 200},
+		{name: "admin tenants", admin: true, method: "GET", path: "/admin/tenants", expectedStatus: 200},
+		{name: "admin create backup", admin: true, method: "POST", path: "/admin/backup", expectedStatus: 201},
+		{name: "admin list backups", admin: true, method: "GET", path: "/admin/backup", expectedStatus: 200},
+		{name: "admin unlock user", admin: true, method: "POST", path: "/admin/users/{user}/unlock", expectedStatus: 200},
+		{name: "admin dashboard", admin: true, method: "GET", path: "/admin/dashboard", expectedStatus: 200},
+		{name: "admin dashboard data", admin: true, method: "GET", path: "/admin/dashboard/data", expectedStatus: 200},
+		{name: "admin storage", admin: true, method: "GET", path: "/admin/storage?top=5", expectedStatus: 200},
+		{name: "admin query", admin: true, method: "POST", path: "/admin/query?limit=5", body: `{"collection":"users","filter":"name == \"Ann\" or age >= 30"}`, expectedStatus: 200},
+		{name: "admin query redacted field", admin: true, method: "POST", path: "/admin/query", body: `{"collection":"users","filter":"password ~ \"a\""}`, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "admin suspensions", admin: true, method: "GET", path: "/admin/suspensions", expectedStatus: 200},
+		{name: "admin moderation queue", admin: true, method: "GET", path: "/admin/moderation", expectedStatus: 200},
+		{name: "admin stats", admin: true, method: "GET", path: "/admin/stats?days=7&top=5", expectedStatus: 200},
+		{name: "admin stats with too many days", admin: true, method: "GET", path: "/admin/stats?days=1000", expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "admin pending signups", admin: true, method: "GET", path: "/admin/signups?status=pending", expectedStatus: 200},
+		{name: "admin metrics history", admin: true, method: "GET", path: "/admin/metrics/history", expectedStatus: 200},
+		{name: "admin reload config", admin: true, method: "POST", path: "/admin/reload", expectedStatus: 200},
+		{name: "admin restart needs POST", admin: true, method: "GET", path: "/admin/restart", expectedStatus: 405, expectedCode: codeMethodNotSupported},
+		{name: "admin ban without reason", admin: true, method: "POST", path: "/admin/users/{user}/ban", body: `{}`, expectedStatus: 400, expectedCode: codeValidationFailed},
+		{name: "admin revoke tokens", admin: true, method: "POST", path: "/admin/users/{user}/revoke-tokens", body: `{"reason":"testing"}`, expectedStatus: 200},
+		{name: "revoked token", method: "GET", path: "/v1/me/sessions", auth: true, expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "log in again", method: "POST", path: "/v1/login", body: `{"email":"ann@example.com","password":"12345"}`, expectedStatus: 200, save: map[string]string{"token": "token"}},
+		{name: "admin route on the API listener", method: "GET", path: "/admin/jobs", expectedStatus: 404},
+		{name: "API route on the admin listener", admin: true, method: "GET", path: "/v1/tags", expectedStatus: 404},
+
+		// deletes
+		{name: "delete post without session", method: "DELETE", path: "/v1/posts/{post}", expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "delete someone else's post", method: "DELETE", path: "/v1/posts/{post}", as: "bobToken", expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "delete post", method: "DELETE", path: "/v1/posts/{post}", auth: true, expectedStatus: 200},
+		{name: "delete deleted post", method: "DELETE", path: "/v1/posts/{post}", auth: true, expectedStatus: 404, expectedCode: codePostNotFound},
+		{name: "delete user without session", method: "DELETE", path: "/v1/users/{user}", expectedStatus: 401, expectedCode: codeUnauthorized},
+		{name: "delete someone else", method: "DELETE", path: "/v1/users/{user}", as: "bobToken", expectedStatus: 403, expectedCode: codeForbidden},
+		{name: "delete user", method: "DELETE", path: "/v1/users/{user}", auth: true, expectedStatus: 200},
+		{name: "get deleted user", method: "GET", path: "/v1/users/{user}", expectedStatus: 404, expectedCode: codeUserNotFound},
+	}
+	for _, tt := range tests {
+		srv := ts.api
+		if tt.admin {
+			srv = ts.admin
+		}
+		token := ""
+		if tt.auth {
+			token = vars["token"]
+		}
+		if tt.as != "" {
+			token = vars[tt.as]
+		}
+		resp, body := ts.do(srv, tt.method, expand(tt.path), token, tt.contentType, expand(tt.body))
+		if resp.StatusCode != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, resp.StatusCode, tt.expectedStatus, body)
+			continue
+		}
+		if tt.expectedCode != "" {
+			errBody := errorBody{}
+			err := json.Unmarshal(body, &errBody)
+			if err != nil || errBody.Code != tt.expectedCode {
+				t.Errorf("%s: got error code %q, want %q: %s", tt.name, errBody.Code, tt.expectedCode, body)
+			}
+		}
+		if len(tt.save) > 0 {
+			fields := map[string]interface{}{}
+			err := json.Unmarshal(body, &fields)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			for name, field := range tt.save {
+				value, ok := fields[field].(string)
+				if !ok {
+					t.Fatalf("%s: response has no %s: %s", tt.name, field, body)
+				}
+				vars[name] = value
+			}
+		}
+	}
+}
+
+func TestHeadAndOptions(t *testing.T) {
+	ts := newTestServer(t, "memory")
+	for _, tt := range []struct {
+		srv  *httptest.Server
+		path string
+	}{
+		{srv: ts.api, path: "/v1/tags"},
+		{srv: ts.api, path: "/v1/search?q=gophers"},
+		{srv: ts.api, path: "/version"},
+		{srv: ts.admin, path: "/admin/stats"},
+	} {
+		get, getBody := ts.do(tt.srv, "GET", tt.path, "", "", "")
+		head, headBody := ts.do(tt.srv, "HEAD", tt.path, "", "", "")
+		if get.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: got status %d: %s", tt.path, get.StatusCode, getBody)
+		}
+		if head.StatusCode != http.StatusOK || len(headBody) != 0 {
+			t.Errorf("HEAD %s: got status %d with %d bytes, want 200 without body", tt.path, head.StatusCode, len(headBody))
+		}
+		for _, key := range []string{"Content-Type", "Content-Length"} {
+			if head.Header.Get(key) != get.Header.Get(key) {
+				t.Errorf("HEAD %s: got %s %q, want %q as GET", tt.path, key, head.Header.Get(key), get.Header.Get(key))
+			}
+		}
+
+		options, _ := ts.do(tt.srv, "OPTIONS", tt.path, "", "", "")
+		if options.StatusCode != http.StatusNoContent || options.Header.Get("Allow") != "GET, HEAD, OPTIONS" {
+			t.Errorf("OPTIONS %s: got status %d with Allow %q", tt.path, options.StatusCode, options.Header.Get("Allow"))
+		}
+	}
+}
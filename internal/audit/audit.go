@@ -0,0 +1,120 @@
+// Package audit keeps an append-only record of who changed what through the
+// API.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is one write request.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+	// Actor is the ID of the logged in user who made the request, empty for
+	// anonymous requests, and IP the client's address.
+	Actor  string `json:"actor"`
+	IP     string `json:"ip,omitempty"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Resource is the kind of record written, e.g. "posts", and ResourceID
+	// the record, if the path names one.
+	Resource   string `json:"resource"`
+	ResourceID string `json:"resourceId,omitempty"`
+	Status     int    `json:"status"`
+}
+
+// Filter selects entries. Zero fields match everything.
+type Filter struct {
+	Actor    string
+	Resource string
+	Since    time.Time
+	Until    time.Time
+}
+
+func (f Filter) Match(entry Entry) bool {
+	if f.Actor != "" && entry.Actor != f.Actor {
+		return false
+	}
+	if f.Resource != "" && entry.Resource != f.Resource {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Log is a file of entries, one JSON document per line. Entries are only
+// ever appended.
+type Log struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewLog(path string) *Log {
+	return &Log{path: path}
+}
+
+func (l *Log) Append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// Size returns the size of the log file in bytes, 0 before the first
+// entry.
+func (l *Log) Size() (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	info, err := os.Stat(l.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Query returns the entries matching filter, oldest first.
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	entries := []Entry{}
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry := Entry{}
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, err
+		}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogQuery(t *testing.T) {
+	l := NewLog(filepath.Join(t.TempDir(), "audit.log"))
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: start, Actor: "alice", Method: "POST", Resource: "users"},
+		{Time: start.Add(time.Hour), Actor: "bob", Method: "POST", Resource: "posts"},
+		{Time: start.Add(2 * time.Hour), Actor: "alice", Method: "DELETE", Resource: "posts", ResourceID: "1"},
+	}
+	for _, entry := range entries {
+		err := l.Append(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		name     string
+		filter   Filter
+		expected int
+	}{
+		{name: "all", filter: Filter{}, expected: 3},
+		{name: "actor", filter: Filter{Actor: "alice"}, expected: 2},
+		{name: "resource", filter: Filter{Resource: "posts"}, expected: 2},
+		{name: "actor and resource", filter: Filter{Actor: "alice", Resource: "posts"}, expected: 1},
+		{name: "since", filter: Filter{Since: start.Add(time.Hour)}, expected: 2},
+		{name: "until is exclusive", filter: Filter{Until: start.Add(time.Hour)}, expected: 1},
+	}
+	for _, tt := range tests {
+		got, err := l.Query(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != tt.expected {
+			t.Errorf("%s: got %d entries, want %d", tt.name, len(got), tt.expected)
+		}
+	}
+
+	empty, err := NewLog(filepath.Join(t.TempDir(), "missing.log")).Query(Filter{})
+	if err != nil || len(empty) != 0 {
+		t.Errorf("got %v, %v, want no entries from a missing file", empty, err)
+	}
+}
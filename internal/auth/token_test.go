@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	token, err := Sign(secret, NewClaims("user-1", now, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+
+	var tests = []struct {
+		name        string
+		secret      []byte
+		token       string
+		now         time.Time
+		expectedErr error
+	}{
+		{name: "valid", secret: secret, token: token, now: now.Add(time.Minute)},
+		{name: "expired", secret: secret, token: token, now: now.Add(time.Hour), expectedErr: ErrExpiredToken},
+		{name: "wrong secret", secret: []byte("other"), token: token, now: now, expectedErr: ErrInvalidToken},
+		{name: "tampered", secret: secret, token: tampered, now: now, expectedErr: ErrInvalidToken},
+		{name: "garbage", secret: secret, token: "abc", now: now, expectedErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		claims, err := Verify(tt.secret, tt.token, tt.now)
+		if !errors.Is(err, tt.expectedErr) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.expectedErr)
+		}
+		if err == nil && claims.Subject != "user-1" {
+			t.Errorf("%s: got subject %q, want user-1", tt.name, claims.Subject)
+		}
+	}
+}
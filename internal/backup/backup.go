@@ -0,0 +1,181 @@
+// Package backup keeps timestamped snapshots of the database file in a
+// directory.
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	prefix     = "db-"
+	ext        = ".json"
+	gzipExt    = ".json.gz"
+	timeFormat = "20060102T150405.000000000"
+)
+
+// ErrInvalidName is returned for names that aren't snapshots of a Store.
+var ErrInvalidName = errors.New("not a snapshot name")
+
+// Store writes snapshots to Dir and removes the ones past its retention.
+// Zero values disable the corresponding limit.
+type Store struct {
+	Dir string
+	// Gzip compresses new snapshots.
+	Gzip bool
+	// MaxBackups is the number of snapshots to keep.
+	MaxBackups int
+	// MaxAge removes snapshots older than this.
+	MaxAge time.Duration
+}
+
+// Snapshot describes a snapshot file.
+type Snapshot struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Compressed bool      `json:"compressed"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Create writes data to a new snapshot taken at now, then applies the
+// retention policy.
+func (s Store) Create(data []byte, now time.Time) (Snapshot, error) {
+	err := os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	name := prefix + now.UTC().Format(timeFormat) + ext
+	if s.Gzip {
+		name = prefix + now.UTC().Format(timeFormat) + gzipExt
+		buf := &bytes.Buffer{}
+		zw := gzip.NewWriter(buf)
+		_, err = zw.Write(data)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		err = zw.Close()
+		if err != nil {
+			return Snapshot{}, err
+		}
+		data = buf.Bytes()
+	}
+	// a partial snapshot must never look complete
+	tmp := filepath.Join(s.Dir, "."+name+".tmp")
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	err = os.Rename(tmp, filepath.Join(s.Dir, name))
+	if err != nil {
+		os.Remove(tmp)
+		return Snapshot{}, err
+	}
+	err = s.prune(now)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("removing old snapshots: %w", err)
+	}
+	return Snapshot{Name: name, Size: int64(len(data)), Compressed: s.Gzip, CreatedAt: now.UTC()}, nil
+}
+
+// List returns the snapshots, newest first.
+func (s Store) List() ([]Snapshot, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []Snapshot{}
+	for _, entry := range entries {
+		snapshot, err := parseName(entry.Name())
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Size = info.Size()
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// Read returns the uncompressed contents of the named snapshot.
+func (s Store) Read(name string) ([]byte, error) {
+	snapshot, err := parseName(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	if !snapshot.Compressed {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", name, err)
+	}
+	defer zr.Close()
+	data, err = io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// parseName also rejects names that could point outside the directory.
+func parseName(name string) (Snapshot, error) {
+	snapshot := Snapshot{Name: name}
+	stamp, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return Snapshot{}, ErrInvalidName
+	}
+	if trimmed, ok := strings.CutSuffix(stamp, gzipExt); ok {
+		stamp = trimmed
+		snapshot.Compressed = true
+	} else if stamp, ok = strings.CutSuffix(stamp, ext); !ok {
+		return Snapshot{}, ErrInvalidName
+	}
+	createdAt, err := time.Parse(timeFormat, stamp)
+	if err != nil {
+		return Snapshot{}, ErrInvalidName
+	}
+	snapshot.CreatedAt = createdAt
+	return snapshot, nil
+}
+
+func (s Store) prune(now time.Time) error {
+	snapshots, err := s.List()
+	if err != nil {
+		return err
+	}
+	for i, snapshot := range snapshots {
+		expired := s.MaxBackups > 0 && i >= s.MaxBackups
+		if s.MaxAge > 0 && now.Sub(snapshot.CreatedAt) > s.MaxAge {
+			expired = true
+		}
+		if !expired {
+			continue
+		}
+		err := os.Remove(filepath.Join(s.Dir, snapshot.Name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package backup
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		s := Store{Dir: t.TempDir(), Gzip: compressed, MaxBackups: 2}
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < 3; i++ {
+			_, err := s.Create([]byte{'0' + byte(i)}, start.Add(time.Duration(i)*time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		snapshots, err := s.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snapshots) != 2 {
+			t.Fatalf("gzip %v: got %d snapshots, want 2", compressed, len(snapshots))
+		}
+		if snapshots[0].Compressed != compressed {
+			t.Errorf("gzip %v: got compressed %v", compressed, snapshots[0].Compressed)
+		}
+		data, err := s.Read(snapshots[0].Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "2" {
+			t.Errorf("gzip %v: got newest snapshot %q, want %q", compressed, data, "2")
+		}
+	}
+}
+
+func TestStoreMaxAge(t *testing.T) {
+	s := Store{Dir: t.TempDir(), MaxAge: time.Hour}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := s.Create([]byte("old"), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Create([]byte("new"), start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Errorf("got %d snapshots, want 1", len(snapshots))
+	}
+}
+
+func TestStoreReadInvalidName(t *testing.T) {
+	s := Store{Dir: t.TempDir()}
+	var tests = []string{"../db.json", "db.json", "db-20240101T000000.000000000.json/../x", "db-yesterday.json"}
+	for _, name := range tests {
+		_, err := s.Read(name)
+		if !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%q: got %v, want ErrInvalidName", name, err)
+		}
+	}
+}
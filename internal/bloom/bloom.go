@@ -0,0 +1,67 @@
+// Package bloom implements a Bloom filter: a compact set that can answer
+// "definitely not present" or "maybe present", never giving false
+// negatives.
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// Filter is not safe for concurrent use.
+type Filter struct {
+	bits []uint64
+	// m is the number of bits and k the number of hashes per key.
+	m uint64
+	k uint64
+}
+
+// New returns a filter sized for n keys at the given false positive rate,
+// e.g. 0.01 for 1%. Adding more keys than n raises the rate.
+func New(n int, falsePositiveRate float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+func (f *Filter) Add(key string) {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain reports whether key may have been added. False means it
+// definitely wasn't.
+func (f *Filter) MayContain(key string) bool {
+	h1, h2 := hashes(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hashes derives the k bit positions from two hashes of the key, as in
+// Kirsch and Mitzenmacher's "Less Hashing, Same Performance".
+func hashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h.Write([]byte{0})
+	h2 := h.Sum64()
+	// an even step would only ever visit half the bits of an even m
+	return h1, h2 | 1
+}
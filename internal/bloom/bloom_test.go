@@ -0,0 +1,28 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f := New(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add("member-" + strconv.Itoa(i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !f.MayContain("member-" + strconv.Itoa(i)) {
+			t.Fatalf("got a false negative for member-%d", i)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if f.MayContain("other-" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	// 1% expected, allow some slack
+	if falsePositives > 200 {
+		t.Errorf("got %d false positives in 10000, want about 100", falsePositives)
+	}
+}
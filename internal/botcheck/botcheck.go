@@ -0,0 +1,96 @@
+// Package botcheck scores how likely a form submission is automated, from
+// signals like filled honeypot fields and forms sent back faster than
+// people type.
+package botcheck
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signal names.
+const (
+	// Honeypot is set when a hidden field people never see was filled in.
+	Honeypot = "honeypot"
+	// TooFast is set when the form came back sooner than people fill it.
+	TooFast = "too-fast"
+	// NoFormToken is set when the submission can't be timed because it
+	// doesn't carry a valid form token.
+	NoFormToken  = "no-form-token"
+	NoUserAgent  = "no-user-agent"
+	BotUserAgent = "bot-user-agent"
+)
+
+// weights add up to the score of a submission, capped at 1.
+var weights = map[string]float64{
+	Honeypot:     1,
+	TooFast:      0.6,
+	NoFormToken:  0.3,
+	NoUserAgent:  0.2,
+	BotUserAgent: 0.4,
+}
+
+// botUserAgents are substrings of the user agents of HTTP libraries,
+// crawlers and headless browsers, matched ignoring case.
+var botUserAgents = []string{
+	"bot", "crawler", "spider", "curl/", "wget/", "python-requests", "python-urllib",
+	"go-http-client", "okhttp", "scrapy", "headlesschrome", "phantomjs",
+}
+
+// Submission is what's known of a submitted form.
+type Submission struct {
+	// Honeypots are the values of the hidden fields, empty unless a bot
+	// filled them in.
+	Honeypots []string
+	// FormAge is how long ago the form was served, zero when it's unknown.
+	FormAge   time.Duration
+	UserAgent string
+}
+
+// Result is the score of a submission, from 0 for a person to 1 for a bot,
+// and the signals it's made of.
+type Result struct {
+	Score   float64  `json:"score"`
+	Signals []string `json:"signals"`
+}
+
+type Checker struct {
+	// MinFillTime is the shortest time people take to fill the form.
+	MinFillTime time.Duration
+}
+
+func (c Checker) Check(s Submission) Result {
+	signals := []string{}
+	for _, value := range s.Honeypots {
+		if strings.TrimSpace(value) != "" {
+			signals = append(signals, Honeypot)
+			break
+		}
+	}
+	if s.FormAge == 0 {
+		signals = append(signals, NoFormToken)
+	} else if s.FormAge < c.MinFillTime {
+		signals = append(signals, TooFast)
+	}
+	userAgent := strings.ToLower(s.UserAgent)
+	if userAgent == "" {
+		signals = append(signals, NoUserAgent)
+	}
+	for _, bot := range botUserAgents {
+		if strings.Contains(userAgent, bot) {
+			signals = append(signals, BotUserAgent)
+			break
+		}
+	}
+
+	sort.Strings(signals)
+	result := Result{Signals: signals}
+	for _, signal := range signals {
+		result.Score += weights[signal]
+	}
+	// rounded so sums like 0.4+0.3 read well
+	result.Score = math.Min(math.Round(result.Score*100)/100, 1)
+	return result
+}
@@ -0,0 +1,52 @@
+package botcheck
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	checker := Checker{MinFillTime: 3 * time.Second}
+	browser := "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"
+
+	var tests = []struct {
+		name       string
+		submission Submission
+		expected   Result
+	}{
+		{
+			name:       "person",
+			submission: Submission{Honeypots: []string{""}, FormAge: time.Minute, UserAgent: browser},
+			expected:   Result{Signals: []string{}},
+		},
+		{
+			name:       "filled honeypot",
+			submission: Submission{Honeypots: []string{"", "http://spam.example.com"}, FormAge: time.Minute, UserAgent: browser},
+			expected:   Result{Score: 1, Signals: []string{Honeypot}},
+		},
+		{
+			name:       "too fast",
+			submission: Submission{FormAge: time.Second, UserAgent: browser},
+			expected:   Result{Score: 0.6, Signals: []string{TooFast}},
+		},
+		{
+			name:       "script",
+			submission: Submission{UserAgent: "python-requests/2.31.0"},
+			expected:   Result{Score: 0.7, Signals: []string{BotUserAgent, NoFormToken}},
+		},
+		{
+			name:       "everything",
+			submission: Submission{Honeypots: []string{"x"}, FormAge: time.Millisecond},
+			expected:   Result{Score: 1, Signals: []string{Honeypot, NoUserAgent, TooFast}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checker.Check(tt.submission)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
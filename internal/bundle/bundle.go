@@ -0,0 +1,195 @@
+// Package bundle seals exports into a self-describing envelope that can be
+// encrypted with a passphrase (AES-256-GCM, key derived with scrypt) and
+// signed with Ed25519, so backups can be stored off-site and checked before
+// they're imported.
+package bundle
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// MediaType is the Content-Type of a sealed bundle.
+	MediaType = "application/vnd.bootdev.bundle+json"
+
+	formatVersion = 1
+)
+
+var (
+	ErrUnsigned           = errors.New("bundle isn't signed")
+	ErrBadSignature       = errors.New("bundle signature doesn't match a trusted key")
+	ErrPassphraseRequired = errors.New("bundle is encrypted, a passphrase is required")
+	ErrDecrypt            = errors.New("can't decrypt bundle, wrong passphrase or corrupted data")
+)
+
+type envelope struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Encrypted bool      `json:"encrypted"`
+	Salt      []byte    `json:"salt,omitempty"`
+	Nonce     []byte    `json:"nonce,omitempty"`
+	Payload   []byte    `json:"payload"`
+	PublicKey []byte    `json:"publicKey,omitempty"`
+	Signature []byte    `json:"signature,omitempty"`
+}
+
+// Options control how Seal protects the payload. Both are optional.
+type Options struct {
+	Passphrase string
+	SigningKey ed25519.PrivateKey
+}
+
+// Seal wraps payload in a bundle, encrypting and signing it as configured.
+func Seal(payload []byte, opts Options) ([]byte, error) {
+	env := envelope{
+		Version:   formatVersion,
+		CreatedAt: time.Now().UTC(),
+		Payload:   payload,
+	}
+	if opts.Passphrase != "" {
+		env.Encrypted = true
+		env.Salt = make([]byte, 16)
+		_, err := rand.Read(env.Salt)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := newAEAD(opts.Passphrase, env.Salt)
+		if err != nil {
+			return nil, err
+		}
+		env.Nonce = make([]byte, aead.NonceSize())
+		_, err = rand.Read(env.Nonce)
+		if err != nil {
+			return nil, err
+		}
+		env.Payload = aead.Seal(nil, env.Nonce, payload, nil)
+	}
+	if opts.SigningKey != nil {
+		env.PublicKey = opts.SigningKey.Public().(ed25519.PublicKey)
+		env.Signature = ed25519.Sign(opts.SigningKey, env.signedData())
+	}
+	return json.Marshal(env)
+}
+
+// Open verifies and decrypts a bundle. When trusted is non-empty the bundle
+// must be signed by one of the keys; the public key stored in the bundle is
+// never trusted on its own.
+func Open(data []byte, passphrase string, trusted []ed25519.PublicKey) ([]byte, error) {
+	env := envelope{}
+	err := json.Unmarshal(data, &env)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if env.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", env.Version)
+	}
+	if len(trusted) > 0 {
+		if env.Signature == nil {
+			return nil, ErrUnsigned
+		}
+		if !env.verify(trusted) {
+			return nil, ErrBadSignature
+		}
+	}
+	if !env.Encrypted {
+		return env.Payload, nil
+	}
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	aead, err := newAEAD(passphrase, env.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	payload, err := aead.Open(nil, env.Nonce, env.Payload, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return payload, nil
+}
+
+func (env envelope) verify(trusted []ed25519.PublicKey) bool {
+	for _, key := range trusted {
+		if ed25519.Verify(key, env.signedData(), env.Signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// signedData covers every field that affects how the payload is read, so
+// none of them can be swapped without invalidating the signature.
+func (env envelope) signedData() []byte {
+	encode := base64.StdEncoding.EncodeToString
+	return []byte(strings.Join([]string{
+		fmt.Sprintf("bundle-v%d", env.Version),
+		env.CreatedAt.Format(time.RFC3339Nano),
+		fmt.Sprint(env.Encrypted),
+		encode(env.Salt),
+		encode(env.Nonce),
+		encode(env.Payload),
+	}, "\n"))
+}
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ParsePrivateKey decodes a base64 Ed25519 seed (32 bytes) or full private
+// key (64 bytes).
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, fmt.Errorf("expected %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+}
+
+// ParsePublicKeys decodes a comma separated list of base64 Ed25519 public
+// keys.
+func ParsePublicKeys(s string) ([]ed25519.PublicKey, error) {
+	keys := []ed25519.PublicKey{}
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("expected %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+		}
+		keys = append(keys, ed25519.PublicKey(raw))
+	}
+	return keys, nil
+}
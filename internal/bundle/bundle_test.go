@@ -0,0 +1,76 @@
+package bundle
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(`{"users":[]}`)
+
+	var tests = []struct {
+		name       string
+		opts       Options
+		passphrase string
+		trusted    []ed25519.PublicKey
+		wantErr    error
+	}{
+		{"plain", Options{}, "", nil, nil},
+		{"encrypted", Options{Passphrase: "secret"}, "secret", nil, nil},
+		{"wrong passphrase", Options{Passphrase: "secret"}, "guess", nil, ErrDecrypt},
+		{"missing passphrase", Options{Passphrase: "secret"}, "", nil, ErrPassphraseRequired},
+		{"signed", Options{SigningKey: priv}, "", []ed25519.PublicKey{otherPub, pub}, nil},
+		{"untrusted signer", Options{SigningKey: priv}, "", []ed25519.PublicKey{otherPub}, ErrBadSignature},
+		{"unsigned", Options{}, "", []ed25519.PublicKey{pub}, ErrUnsigned},
+		{"signed and encrypted", Options{Passphrase: "secret", SigningKey: priv}, "secret", []ed25519.PublicKey{pub}, nil},
+	}
+	for _, tt := range tests {
+		sealed, err := Seal(payload, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Open(sealed, tt.passphrase, tt.trusted)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && string(got) != string(payload) {
+			t.Errorf("%s: got payload %s, want %s", tt.name, got, payload)
+		}
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Seal([]byte(`{"users":[]}`), Options{SigningKey: priv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := envelope{}
+	err = json.Unmarshal(sealed, &env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Payload = []byte(`{"users":[{}]}`)
+	tampered, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Open(tampered, "", []ed25519.PublicKey{pub})
+	if !errors.Is(err, ErrBadSignature) {
+		t.Errorf("got %v, want %v", err, ErrBadSignature)
+	}
+}
@@ -0,0 +1,246 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrChecksumMismatch means the database file changed outside of the client,
+// e.g. by a partial write or a manual edit.
+var ErrChecksumMismatch = errors.New("database checksum mismatch")
+
+// Checksum is stored next to the database file and updated on every write.
+type Checksum struct {
+	SHA256    string         `json:"sha256"`
+	Records   map[string]int `json:"records"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+}
+
+type IntegrityStatus struct {
+	OK       bool           `json:"ok"`
+	Checksum string         `json:"checksum,omitempty"`
+	Records  map[string]int `json:"records,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+func (c Client) checksumPath() string {
+	return c.path + ".sum"
+}
+
+func newChecksum(data []byte) (Checksum, error) {
+	colls, err := parseCollections(data)
+	if err != nil {
+		return Checksum{}, err
+	}
+	sum := sha256.Sum256(data)
+	checksum := Checksum{
+		SHA256:    hex.EncodeToString(sum[:]),
+		Records:   map[string]int{},
+		UpdatedAt: time.Now().UTC(),
+	}
+	for name, records := range colls {
+		checksum.Records[name] = len(records)
+	}
+	return checksum, nil
+}
+
+func (c Client) readChecksum() (Checksum, error) {
+	data, err := os.ReadFile(c.checksumPath())
+	if err != nil {
+		return Checksum{}, err
+	}
+	checksum := Checksum{}
+	err = json.Unmarshal(data, &checksum)
+	return checksum, err
+}
+
+func (c Client) writeChecksum(data []byte) error {
+	checksum, err := newChecksum(data)
+	if err != nil {
+		return err
+	}
+	sumData, err := json.Marshal(checksum)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.checksumPath(), sumData)
+}
+
+// readFile reads the database file and verifies it against its checksum.
+// Files written before checksums existed have no checksum file and are read
+// unverified until their next write.
+func (c Client) readFile() ([]byte, error) {
+	if c.memory != nil {
+		return c.memory.read()
+	}
+	c.files.RLock()
+	defer c.files.RUnlock()
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := c.readChecksum()
+	if errors.Is(err, os.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading database checksum: %w", err)
+	}
+	err = checksum.verify(data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// writeFile writes the database file and its checksum. With a write-ahead
+// log, the changed records are logged first and the write is only
+// committed once both files are written, then the log is checkpointed if it
+// grew too large.
+func (c Client) writeFile(data []byte) error {
+	if c.memory != nil {
+		defer c.reads.forget()
+		return c.memory.write(data)
+	}
+	c.files.Lock()
+	defer c.files.Unlock()
+	if c.wal == nil {
+		return c.replaceFile(data)
+	}
+	// the current file isn't verified, a crash may have left it unchecked
+	old, err := os.ReadFile(c.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	mutations, err := diffCollections(old, data)
+	if err != nil {
+		return err
+	}
+	if len(mutations) == 0 {
+		return c.replaceFile(data)
+	}
+	seq, err := c.wal.begin(mutations)
+	if err != nil {
+		return fmt.Errorf("write-ahead log: %w", err)
+	}
+	err = c.replaceFile(data)
+	if err != nil {
+		return err
+	}
+	err = c.wal.commit(seq)
+	if err != nil {
+		return err
+	}
+	return c.wal.checkpoint(data)
+}
+
+// replaceFile writes the database file and its checksum. The file is
+// replaced in one step, so a crash never leaves half of it behind. Callers
+// hold c.files.
+func (c Client) replaceFile(data []byte) error {
+	// reads in flight may predate this write
+	defer c.reads.forget()
+	err := writeFileAtomic(c.path, data)
+	if err != nil {
+		return err
+	}
+	return c.writeChecksum(data)
+}
+
+// writeFileAtomic writes data to a temporary file, syncs it and renames it
+// over path.
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	err = errors.Join(err, file.Close())
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func (checksum Checksum) verify(data []byte) error {
+	actual, err := newChecksum(data)
+	if err != nil {
+		return err
+	}
+	if actual.SHA256 != checksum.SHA256 {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, checksum.SHA256, actual.SHA256)
+	}
+	for name, count := range checksum.Records {
+		if actual.Records[name] != count {
+			return fmt.Errorf("%w: expected %d %s, got %d", ErrChecksumMismatch, count, name, actual.Records[name])
+		}
+	}
+	return nil
+}
+
+// Integrity checks the database file against its checksum. A missing
+// checksum file counts as a failure here, unlike in readFile.
+func (c Client) Integrity() IntegrityStatus {
+	if c.memory != nil {
+		// nothing can change the records behind the client's back
+		data, err := c.memory.read()
+		if err != nil {
+			return IntegrityStatus{Error: err.Error()}
+		}
+		checksum, err := newChecksum(data)
+		if err != nil {
+			return IntegrityStatus{Error: err.Error()}
+		}
+		return IntegrityStatus{OK: true, Checksum: checksum.SHA256, Records: checksum.Records}
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return IntegrityStatus{Error: err.Error()}
+	}
+	checksum, err := c.readChecksum()
+	if err != nil {
+		return IntegrityStatus{Error: fmt.Sprintf("reading database checksum: %v", err)}
+	}
+	err = checksum.verify(data)
+	if err != nil {
+		return IntegrityStatus{Error: err.Error()}
+	}
+	return IntegrityStatus{
+		OK:       true,
+		Checksum: checksum.SHA256,
+		Records:  checksum.Records,
+	}
+}
+
+// Snapshot returns the contents of the database file after checking them
+// against the checksum.
+func (c Client) Snapshot() ([]byte, error) {
+	return c.readFile()
+}
+
+// ResetChecksum accepts the current contents of the database file as valid.
+func (c Client) ResetChecksum() error {
+	if c.memory != nil {
+		return nil
+	}
+	c.files.Lock()
+	defer c.files.Unlock()
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	return c.writeChecksum(data)
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	c := NewClient(filepath.Join(t.TempDir(), "db.json"))
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateUser("a@example.com", "password", "a", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := c.Integrity()
+	if !status.OK || status.Records["users"] != 1 {
+		t.Errorf("got %+v, want ok with 1 user", status)
+	}
+
+	// edit the file behind the client's back
+	err = os.WriteFile(c.path, []byte(`{"users":{},"posts":{}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Integrity().OK {
+		t.Errorf("got ok after external edit, want mismatch")
+	}
+	_, err = c.GetUserByEmail("a@example.com")
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("got %v, want %v", err, ErrChecksumMismatch)
+	}
+
+	err = c.ResetChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := c.Integrity(); !status.OK {
+		t.Errorf("got %+v after reset, want ok", status)
+	}
+}
+
+func TestEnsureDBChecksumsExistingFile(t *testing.T) {
+	c := NewClient(filepath.Join(t.TempDir(), "db.json"))
+	err := os.WriteFile(c.path, []byte(`{"users":{},"posts":{}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := c.Integrity(); !status.OK {
+		t.Errorf("got %+v, want ok", status)
+	}
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// PostCursor is the position of a post in the order posts are listed in:
+// newest first, posts created at the same time by ID. Every post has its
+// own position, so pages continuing after a cursor neither repeat nor skip
+// posts when others are created meanwhile.
+type PostCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Cursor returns the position of p.
+func (p Post) Cursor() PostCursor {
+	return PostCursor{CreatedAt: p.CreatedAt, ID: p.ID}
+}
+
+// before reports whether c comes before other in the listing order.
+func (c PostCursor) before(other PostCursor) bool {
+	if !c.CreatedAt.Equal(other.CreatedAt) {
+		return c.CreatedAt.After(other.CreatedAt)
+	}
+	return c.ID < other.ID
+}
+
+// PostQuery selects the posts IteratePosts walks.
+type PostQuery struct {
+	// UserID keeps the posts of one user, empty for every user's.
+	UserID string
+	// ExceptUserIDs leaves out the posts of some users, e.g. suspended ones.
+	ExceptUserIDs map[string]bool
+	// Tag keeps the posts carrying a normalized tag, empty for all posts.
+	Tag string
+	// After starts after a post, nil from the newest.
+	After *PostCursor
+}
+
+// PostIterator walks posts in listing order.
+type PostIterator struct {
+	posts []Post
+}
+
+// Next returns the next post, and false once there are none left.
+func (it *PostIterator) Next() (Post, bool) {
+	if len(it.posts) == 0 {
+		return Post{}, false
+	}
+	post := it.posts[0]
+	it.posts = it.posts[1:]
+	return post, true
+}
+
+// IteratePosts walks the posts selected by query, newest first, as they
+// were when it was called.
+func (c Client) IteratePosts(query PostQuery) (*PostIterator, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	posts := []Post{}
+	add := func(post Post) {
+		if query.UserID != "" && post.UserID != query.UserID {
+			return
+		}
+		if query.ExceptUserIDs[post.UserID] {
+			return
+		}
+		if query.After != nil && !query.After.before(post.Cursor()) {
+			return
+		}
+		posts = append(posts, post)
+	}
+	if query.Tag != "" {
+		for _, id := range db.postIDsByTag[query.Tag] {
+			add(db.Posts[id])
+		}
+	} else {
+		for _, post := range db.Posts {
+			add(post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Cursor().before(posts[j].Cursor())
+	})
+	return &PostIterator{posts: posts}, nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIteratePosts(t *testing.T) {
+	c := NewMemoryClient()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ann := User{ID: "ann", Email: "ann@example.com"}
+	bob := User{ID: "bob", Email: "bob@example.com"}
+	records := []ImportRecord{{User: &ann}, {User: &bob}}
+	// c and d were created at the same time, the ID orders them
+	for _, post := range []Post{
+		{ID: "a", UserID: "ann", CreatedAt: now, Tags: []string{"go"}},
+		{ID: "b", UserID: "bob", CreatedAt: now.Add(time.Minute)},
+		{ID: "d", UserID: "ann", CreatedAt: now.Add(2 * time.Minute), Tags: []string{"go"}},
+		{ID: "c", UserID: "bob", CreatedAt: now.Add(2 * time.Minute), Tags: []string{"go"}},
+	} {
+		post := post
+		records = append(records, ImportRecord{Post: &post})
+	}
+	_, err := c.Import(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name     string
+		query    PostQuery
+		expected []string
+	}{
+		{name: "all", query: PostQuery{}, expected: []string{"c", "d", "b", "a"}},
+		{name: "after a tie", query: PostQuery{After: &PostCursor{CreatedAt: now.Add(2 * time.Minute), ID: "c"}}, expected: []string{"d", "b", "a"}},
+		{name: "after a deleted post", query: PostQuery{After: &PostCursor{CreatedAt: now.Add(90 * time.Second), ID: "x"}}, expected: []string{"b", "a"}},
+		{name: "user", query: PostQuery{UserID: "ann"}, expected: []string{"d", "a"}},
+		{name: "tag", query: PostQuery{Tag: "go", After: &PostCursor{CreatedAt: now.Add(2 * time.Minute), ID: "d"}}, expected: []string{"a"}},
+	}
+	for _, tt := range tests {
+		it, err := c.IteratePosts(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for post, ok := it.Next(); ok; post, ok = it.Next() {
+			got = append(got, post.ID)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
@@ -1,41 +1,499 @@
 package database
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Client struct {
-	path string
+	path       string
+	onMutation func([]Mutation)
+	// reads coalesces concurrent GetUser, GetPost and GetPosts calls.
+	reads *flightGroup
+	// files keeps the database file, its checksum and the write-ahead log
+	// in step when several goroutines write.
+	files *sync.RWMutex
+	// writes serializes the read, change and write of a record, see update.
+	writes *sync.Mutex
+	// transactions holds the writers outside of a transaction back until it
+	// ends, see Transaction.
+	transactions *sync.Mutex
+	// onCommit is called with the records changed once they're committed,
+	// see WithCommitHook.
+	onCommit func([]Mutation)
+	wal      *writeAheadLog
+	// memory holds the database instead of the file at path, see
+	// NewMemoryClient.
+	memory *memoryStore
+	// ctx carries the span reads and writes are traced under, and the
+	// transaction they're part of, see WithContext.
+	ctx context.Context
 }
 
 type databaseSchema struct {
-	Users map[string]User `json:"users"`
-	Posts map[string]Post `json:"posts"`
+	Users  map[string]User  `json:"users"`
+	Posts  map[string]Post  `json:"posts"`
+	Media  map[string]Media `json:"media"`
+	Badges map[string]Badge `json:"badges"`
+	// LoginAttempts and TwoFactor are keyed by user ID.
+	LoginAttempts map[string]LoginAttempts `json:"loginAttempts"`
+	TwoFactor     map[string]TwoFactor     `json:"twoFactor"`
+	// Identities are keyed by provider and subject, see identityKey.
+	Identities map[string]Identity `json:"identities"`
+	// Tenants are only kept in the main database. Each tenant's users and
+	// posts live in a database file of its own.
+	Tenants map[string]Tenant `json:"tenants"`
+	Jobs    map[string]Job    `json:"jobs"`
+	// Emails are only kept in the main database, for every tenant.
+	Emails map[string]Email `json:"emails"`
+	// PostRevisions are keyed by post ID, only edited posts have them.
+	PostRevisions map[string][]PostRevision `json:"postRevisions"`
+	Sessions      map[string]Session        `json:"sessions"`
+	LoginEvents   map[string]LoginEvent     `json:"loginEvents"`
+	// EmailTokens are keyed by their hash.
+	EmailTokens map[string]EmailToken `json:"emailTokens"`
+	// RevokedTokens are keyed by the ID of the session token.
+	RevokedTokens map[string]RevokedToken `json:"revokedTokens"`
+	// Suspensions are keyed by user ID, a user has one at most.
+	Suspensions map[string]Suspension `json:"suspensions"`
+	// PendingPosts were flagged by moderation, they become posts once an
+	// admin approves them.
+	PendingPosts map[string]PendingPost `json:"pendingPosts"`
+	// Signups are keyed by user ID, users created before signups were
+	// scored have none.
+	Signups map[string]Signup `json:"signups"`
+	// Blocks are keyed by blocker and blocked user, and Follows by follower
+	// and followed user, see userPairKey.
+	Blocks   map[string]Block   `json:"blocks"`
+	Follows  map[string]Follow  `json:"follows"`
+	Messages map[string]Message `json:"messages"`
+	// Notifications are kept per user up to maxNotificationsPerUser.
+	Notifications map[string]Notification `json:"notifications"`
+
+	// userIDs maps emails to user IDs, userIDsByUsername usernames to user
+	// IDs, and postIDsByTag maps tags to the posts carrying them. messageIDsByConversation maps conversations, see
+	// conversationKey, to their messages oldest first, and
+	// unreadMessageIDs maps users to the messages they haven't read. All
+	// are rebuilt on every read.
+	userIDs                  map[string]string
+	userIDsByUsername        map[string]string
+	postIDsByTag             map[string][]string
+	messageIDsByConversation map[string][]string
+	unreadMessageIDs         map[string][]string
 }
 
 type User struct {
+	ID        string    `json:"id"`
 	CreatedAt time.Time `json:"createdAt"`
+	// UpdatedAt is when the user or the set of their posts last changed,
+	// their streak counts the posts.
+	UpdatedAt time.Time `json:"updatedAt"`
 	Email     string    `json:"email"`
-	Password  string    `json:"password"`
-	Name      string    `json:"name"`
-	Age       int       `json:"age"`
+	// Username is the user's unique handle, lowercase. Users created before
+	// usernames have none until they pick one.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// PasswordAlgorithm tags how Password was hashed, it's empty for
+	// passwords stored before they were hashed.
+	PasswordAlgorithm string       `json:"passwordAlgorithm,omitempty"`
+	Name              string       `json:"name"`
+	Age               int          `json:"age"`
+	Settings          UserSettings `json:"settings"`
+	Profile
+	// RecoveryEmail can receive password resets once verified, for when
+	// the user can't read Email anymore.
+	RecoveryEmail         string `json:"recoveryEmail,omitempty"`
+	RecoveryEmailVerified bool   `json:"recoveryEmailVerified,omitempty"`
+	// Private users' posts are only shown to the followers they approved.
+	Private bool `json:"private,omitempty"`
+}
+
+// Profile is what users tell others about themselves.
+type Profile struct {
+	Bio      string `json:"bio,omitempty"`
+	Location string `json:"location,omitempty"`
+	Website  string `json:"website,omitempty"`
+	// AvatarURL is an external image, or /media/{id} for an uploaded one.
+	AvatarURL string `json:"avatarUrl,omitempty"`
+}
+
+// UserSettings are preferences users choose for themselves.
+type UserSettings struct {
+	// Timezone is an IANA time zone name, empty meaning UTC.
+	Timezone string `json:"timezone,omitempty"`
 }
 
 type Post struct {
+	ID        string        `json:"id"`
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+	UserID    string        `json:"userId"`
+	Text      string        `json:"text"`
+	Tags      []string      `json:"tags,omitempty"`
+	Media     []string      `json:"media,omitempty"`
+	Metadata  *PostMetadata `json:"metadata,omitempty"`
+	// Mentions are the IDs of the users mentioned when the post was
+	// written.
+	Mentions []string `json:"mentions,omitempty"`
+}
+
+// PendingPost is a post held for review. Approving it creates the post with
+// the same ID and creation time.
+type PendingPost struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UserID    string    `json:"userId"`
+	Text      string    `json:"text"`
+	Tags      []string  `json:"tags,omitempty"`
+	Mentions  []string  `json:"mentions,omitempty"`
+	// Reason is why moderation flagged the post.
+	Reason string `json:"reason"`
+}
+
+// PostRevision is one version of a post's text, kept when the post is
+// edited. Revisions are numbered from 1, the post as first written.
+type PostRevision struct {
+	Number    int       `json:"number"`
+	Text      string    `json:"text"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type PostMetadata struct {
+	DeadLinks      []string  `json:"deadLinks"`
+	LinksCheckedAt time.Time `json:"linksCheckedAt"`
+}
+
+// Media describes a file attached to a post or a direct message, or a
+// user's avatar. The file itself lives in a storage backend under the media
+// ID.
+type Media struct {
+	ID     string `json:"id"`
+	PostID string `json:"postId,omitempty"`
+	// UserID is only set for avatars.
+	UserID string `json:"userId,omitempty"`
+	// MessageID is only set for message attachments, which only the users
+	// of the conversation can download.
+	MessageID   string    `json:"messageId,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+}
+
+// Badge is an achievement awarded to a user. A user holds each badge at
+// most once.
+type Badge struct {
 	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	Name      string    `json:"name"`
+	AwardedAt time.Time `json:"awardedAt"`
+}
+
+// LoginAttempts tracks the recent failed logins of a user, to lock the
+// account when someone keeps guessing its password.
+type LoginAttempts struct {
+	UserID      string      `json:"userId"`
+	Failures    []time.Time `json:"failures"`
+	LockedUntil time.Time   `json:"lockedUntil"`
+}
+
+// TwoFactor is a user's TOTP enrollment. It only applies at login once
+// Enabled, after the user proved their authenticator app works.
+type TwoFactor struct {
+	UserID  string `json:"userId"`
+	Secret  string `json:"secret"`
+	Enabled bool   `json:"enabled"`
+	// RecoveryCodes are SHA-256 hashes of the unused recovery codes.
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+}
+
+// Identity links an account at an OAuth provider to a user.
+type Identity struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	UserID   string    `json:"userId"`
+	LinkedAt time.Time `json:"linkedAt"`
+}
+
+// Session is a login, identified in the tokens issued for it. Deleting it
+// revokes those tokens.
+type Session struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	// Device is the user agent that logged in.
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	// TokenID is the ID of the token issued for the session, to revoke it.
+	TokenID string `json:"tokenId,omitempty"`
+}
+
+// maxLoginEventsPerUser bounds the login history kept for each user, the
+// oldest events are dropped first.
+const maxLoginEventsPerUser = 100
+
+// LoginEvent is a successful login, kept as the user's login history.
+type LoginEvent struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	// Method is "password" or the OAuth provider logged in with.
+	Method string `json:"method"`
+	IP     string `json:"ip"`
+	Device string `json:"device"`
+	// Network is the IP prefix the login came from, standing in for its
+	// location.
+	Network string `json:"network"`
+	// NewDevice and NewNetwork are set when the user never logged in from
+	// the device or network before.
+	NewDevice  bool      `json:"newDevice"`
+	NewNetwork bool      `json:"newNetwork"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// EmailToken is a single-use secret emailed to a user, proving they can
+// read the address it was sent to. Only its SHA-256 hash is stored.
+type EmailToken struct {
+	Hash   string `json:"hash"`
+	UserID string `json:"userId"`
+	// Purpose is what the token can be used for, e.g. a password reset.
+	Purpose   string    `json:"purpose"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// RevokedToken is a session token rejected before it expires, e.g. after
+// its user logged out. It's kept until the token expires.
+type RevokedToken struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	// Reason is why the token was revoked, e.g. "logout".
+	Reason    string    `json:"reason"`
+	RevokedAt time.Time `json:"revokedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Suspension keeps a user from logging in and hides their posts until it
+// expires. Bans are permanent suspensions.
+type Suspension struct {
+	UserID    string    `json:"userId"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+	Permanent bool      `json:"permanent"`
+	// ExpiresAt is zero for permanent suspensions.
+	ExpiresAt time.Time `json:"expiresAt"`
+	// AppealNotes record the user's appeal and how it was handled, oldest
+	// first.
+	AppealNotes []AppealNote `json:"appealNotes,omitempty"`
+}
+
+// Active reports whether s is in effect at now.
+func (s Suspension) Active(now time.Time) bool {
+	return s.Permanent || now.Before(s.ExpiresAt)
+}
+
+// Block hides the posts of a user from another.
+type Block struct {
+	BlockerID string    `json:"blockerId"`
+	BlockedID string    `json:"blockedId"`
 	CreatedAt time.Time `json:"createdAt"`
-	UserEmail string    `json:"userEmail"`
+}
+
+// Follow statuses. Following a private user takes their approval.
+const (
+	FollowPending  = "pending"
+	FollowApproved = "approved"
+)
+
+type Follow struct {
+	FollowerID string    `json:"followerId"`
+	FolloweeID string    `json:"followeeId"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Message is a direct message from one user to another. ReadAt is nil until
+// the recipient reads it.
+type Message struct {
+	ID          string `json:"id"`
+	SenderID    string `json:"senderId"`
+	RecipientID string `json:"recipientId"`
+	Text        string `json:"text"`
+	// Attachments are the IDs of the media attached to the message.
+	Attachments []string   `json:"attachments,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ReadAt      *time.Time `json:"readAt,omitempty"`
+}
+
+// maxNotificationsPerUser bounds the notifications kept for each user, the
+// oldest are dropped first.
+const maxNotificationsPerUser = 500
+
+// Notification tells a user about something another user did. SubjectID is
+// the post or message it's about, if any. ReadAt is nil until the user
+// reads it.
+type Notification struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"userId"`
+	Type      string     `json:"type"`
+	ActorID   string     `json:"actorId"`
+	SubjectID string     `json:"subjectId,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ReadAt    *time.Time `json:"readAt,omitempty"`
+}
+
+type AppealNote struct {
 	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Signup statuses.
+const (
+	SignupAccepted = "accepted"
+	// SignupPending accounts can't log in until an admin approves them.
+	SignupPending = "pending"
+)
+
+// Signup records how likely the creation of an account was automated.
+type Signup struct {
+	UserID    string    `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Score goes from 0 for a person to 1 for a bot.
+	Score   float64  `json:"score"`
+	Signals []string `json:"signals"`
+	Status  string   `json:"status"`
+}
+
+// Tenant is an isolated community served by the same API.
+type Tenant struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Settings  TenantSettings `json:"settings"`
+}
+
+// TenantSettings are chosen by the operators of a tenant.
+type TenantSettings struct {
+	ContentPolicy  ContentPolicy  `json:"contentPolicy"`
+	PasswordPolicy PasswordPolicy `json:"passwordPolicy"`
+}
+
+// ContentPolicy restricts what can be posted in a tenant. The zero value
+// allows anything the API accepts elsewhere.
+type ContentPolicy struct {
+	// MaxLength is the most characters a post may have, 0 for no limit.
+	MaxLength int `json:"maxLength,omitempty"`
+	// AllowedMediaTypes narrows the media types accepted by the server,
+	// empty keeping all of them.
+	AllowedMediaTypes []string `json:"allowedMediaTypes,omitempty"`
+	// Links is "allow", the default, or "deny" to reject posts with links.
+	Links string `json:"links,omitempty"`
+	// Profanity is "off", the default, "lenient" to reject the strongest
+	// words or "strict" to reject milder ones too.
+	Profanity string `json:"profanity,omitempty"`
+}
+
+// PasswordPolicy sets the rules new passwords must follow. The zero value
+// only requires a password.
+type PasswordPolicy struct {
+	// MinLength is the fewest characters a password may have.
+	MinLength int `json:"minLength,omitempty"`
+	// The Require fields each ask for at least one character of a class.
+	RequireLower  bool `json:"requireLower,omitempty"`
+	RequireUpper  bool `json:"requireUpper,omitempty"`
+	RequireDigit  bool `json:"requireDigit,omitempty"`
+	RequireSymbol bool `json:"requireSymbol,omitempty"`
+	// RejectBreached rejects passwords known from data breaches.
+	RejectBreached bool `json:"rejectBreached,omitempty"`
+}
+
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// Job is a unit of background work, run by internal/jobs. Pending jobs run
+// once RunAt has passed.
+type Job struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Status    JobStatus       `json:"status"`
+	Attempts  int             `json:"attempts"`
+	RunAt     time.Time       `json:"runAt"`
+	LastError string          `json:"lastError,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+type EmailStatus string
+
+const (
+	EmailQueued EmailStatus = "queued"
+	EmailSent   EmailStatus = "sent"
+	EmailFailed EmailStatus = "failed"
+)
+
+// Email is a message rendered from a template, tracked from the moment it's
+// queued until it's delivered or given up on.
+type Email struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenantId,omitempty"`
+	To       string `json:"to"`
+	Template string `json:"template"`
+	Subject  string `json:"subject"`
+	// Data is what the template was rendered with, kept to render it again
+	// when the message is sent.
+	Data      json.RawMessage `json:"data,omitempty"`
+	Status    EmailStatus     `json:"status"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"lastError,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	SentAt    *time.Time      `json:"sentAt,omitempty"`
+}
+
+func identityKey(provider, subject string) string {
+	return provider + ":" + subject
+}
+
+// userPairKey keys the records one user keeps about another, like blocks
+// and follows.
+func userPairKey(fromID, toID string) string {
+	return fromID + ":" + toID
+}
+
+// conversationKey keys the messages between two users, whichever sent
+// them.
+func conversationKey(userID, otherID string) string {
+	if otherID < userID {
+		userID, otherID = otherID, userID
+	}
+	return userPairKey(userID, otherID)
 }
 
 func NewClient(path string) Client {
 	return Client{
-		path: path,
+		path:         path,
+		reads:        newFlightGroup(),
+		files:        &sync.RWMutex{},
+		writes:       &sync.Mutex{},
+		transactions: &sync.Mutex{},
 	}
 }
 
@@ -43,15 +501,19 @@ func (c Client) createDB() error {
 	emptyDB := databaseSchema{
 		Users: map[string]User{},
 		Posts: map[string]Post{},
+		Media: map[string]Media{},
 	}
 	data, err := json.Marshal(emptyDB)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(c.path, data, 0600)
+	return c.writeFile(data)
 }
 
 func (c Client) EnsureDB() error {
+	if c.memory != nil {
+		return nil
+	}
 	// check if db exists
 	data, err := os.ReadFile(c.path)
 	dbExists := true
@@ -82,19 +544,96 @@ func (c Client) EnsureDB() error {
 	if err != nil {
 		return err
 	}
-	return nil
+	err = c.migrateUserIDs(data)
+	if err != nil {
+		return fmt.Errorf("migrating user IDs: %w", err)
+	}
+
+	// checksum files written before checksums existed
+	_, err = c.readChecksum()
+	if errors.Is(err, os.ErrNotExist) {
+		return c.writeChecksum(data)
+	}
+	return err
 }
 
-func (c Client) updateDB(db databaseSchema) error {
-	data, err := json.Marshal(db)
+// update reads the database, lets fn change it and writes it back unless fn
+// returns an error. Writers are serialized from the read to the write, so
+// concurrent changes aren't lost. The hooks run once the write lock is
+// released, as their subscribers write to the database too.
+func (c Client) update(fn func(db *databaseSchema) error) (err error) {
+	span := c.startSpan("update")
+	defer func() {
+		span.SetError(err)
+		span.Finish()
+	}()
+	mutations, err := c.write(func(old []byte) ([]byte, error) {
+		db := &databaseSchema{}
+		err := json.Unmarshal(old, db)
+		if err != nil {
+			return nil, err
+		}
+		db.ensureCollections()
+		err = fn(db)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(db)
+	})
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(c.path, data, 0600)
+	c.mutated(mutations)
+	return nil
 }
 
-func (c Client) readDB() (databaseSchema, error) {
-	data, err := os.ReadFile(c.path)
+// write replaces the contents of the database with what change makes of
+// them, holding the write lock, and returns the changed records when there's
+// a hook or a transaction to tell. Callers run the hooks with mutated.
+// Writes outside of a transaction wait for the one running to end.
+func (c Client) write(change func(old []byte) ([]byte, error)) ([]Mutation, error) {
+	tx := c.transaction()
+	if tx == nil {
+		c.transactions.Lock()
+		defer c.transactions.Unlock()
+	}
+	c.writes.Lock()
+	defer c.writes.Unlock()
+	old, err := c.readFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := change(old)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(old, data) {
+		return nil, nil
+	}
+	err = c.writeFile(data)
+	if err != nil {
+		return nil, err
+	}
+	if c.onMutation == nil && c.onCommit == nil && tx == nil {
+		return nil, nil
+	}
+	mutations, err := diffCollections(old, data)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		tx.touch(mutations)
+	}
+	return mutations, nil
+}
+
+func (c Client) readDB() (_ databaseSchema, err error) {
+	span := c.startSpan("readDB")
+	defer func() {
+		span.SetError(err)
+		span.Finish()
+	}()
+	data, err := c.readFile()
 	if err != nil {
 		return databaseSchema{}, err
 	}
@@ -103,148 +642,2156 @@ func (c Client) readDB() (databaseSchema, error) {
 	if err != nil {
 		return databaseSchema{}, err
 	}
+	db.ensureCollections()
 	return *db, nil
 }
 
-func (c Client) CreateUser(email, password, name string, age int) (User, error) {
-	db, err := c.readDB()
-	if err != nil {
-		return User{}, err
+// ensureCollections creates the sections missing from older or partial
+// database files, so writes never hit a nil map, and builds the email index.
+// Users and posts stored before updates were tracked were last updated when
+// they were created.
+func (db *databaseSchema) ensureCollections() {
+	if db.Users == nil {
+		db.Users = map[string]User{}
 	}
-	if _, ok := db.Users[email]; ok {
-		return User{}, fmt.Errorf("user with email %s already exists", email)
+	if db.Posts == nil {
+		db.Posts = map[string]Post{}
 	}
-	user := User{
-		CreatedAt: time.Now().UTC(),
-		Email:     email,
-		Password:  password,
-		Name:      name,
-		Age:       age,
+	if db.Media == nil {
+		db.Media = map[string]Media{}
 	}
-	db.Users[email] = user
-	err = c.updateDB(db)
-	if err != nil {
-		return User{}, err
+	if db.Badges == nil {
+		db.Badges = map[string]Badge{}
 	}
-	return user, nil
+	if db.LoginAttempts == nil {
+		db.LoginAttempts = map[string]LoginAttempts{}
+	}
+	if db.TwoFactor == nil {
+		db.TwoFactor = map[string]TwoFactor{}
+	}
+	if db.Identities == nil {
+		db.Identities = map[string]Identity{}
+	}
+	if db.Tenants == nil {
+		db.Tenants = map[string]Tenant{}
+	}
+	if db.Jobs == nil {
+		db.Jobs = map[string]Job{}
+	}
+	if db.Emails == nil {
+		db.Emails = map[string]Email{}
+	}
+	if db.PostRevisions == nil {
+		db.PostRevisions = map[string][]PostRevision{}
+	}
+	if db.Sessions == nil {
+		db.Sessions = map[string]Session{}
+	}
+	if db.LoginEvents == nil {
+		db.LoginEvents = map[string]LoginEvent{}
+	}
+	if db.EmailTokens == nil {
+		db.EmailTokens = map[string]EmailToken{}
+	}
+	if db.RevokedTokens == nil {
+		db.RevokedTokens = map[string]RevokedToken{}
+	}
+	if db.Suspensions == nil {
+		db.Suspensions = map[string]Suspension{}
+	}
+	if db.PendingPosts == nil {
+		db.PendingPosts = map[string]PendingPost{}
+	}
+	if db.Signups == nil {
+		db.Signups = map[string]Signup{}
+	}
+	if db.Blocks == nil {
+		db.Blocks = map[string]Block{}
+	}
+	if db.Follows == nil {
+		db.Follows = map[string]Follow{}
+	}
+	if db.Messages == nil {
+		db.Messages = map[string]Message{}
+	}
+	if db.Notifications == nil {
+		db.Notifications = map[string]Notification{}
+	}
+	db.userIDs = make(map[string]string, len(db.Users))
+	db.userIDsByUsername = map[string]string{}
+	for id, user := range db.Users {
+		if user.UpdatedAt.IsZero() {
+			user.UpdatedAt = user.CreatedAt
+			db.Users[id] = user
+		}
+		db.userIDs[user.Email] = id
+		if user.Username != "" {
+			db.userIDsByUsername[user.Username] = id
+		}
+	}
+	db.postIDsByTag = map[string][]string{}
+	for id, post := range db.Posts {
+		if post.UpdatedAt.IsZero() {
+			post.UpdatedAt = post.CreatedAt
+			db.Posts[id] = post
+		}
+		for _, tag := range post.Tags {
+			db.postIDsByTag[tag] = append(db.postIDsByTag[tag], id)
+		}
+	}
+	db.indexMessages()
 }
 
-func (c Client) UpdateUser(email, password, name string, age int) (User, error) {
-	db, err := c.readDB()
-	if err != nil {
-		return User{}, err
+func (db *databaseSchema) indexMessages() {
+	messages := make([]Message, 0, len(db.Messages))
+	for _, message := range db.Messages {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].CreatedAt.Equal(messages[j].CreatedAt) {
+			return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+		}
+		return messages[i].ID < messages[j].ID
+	})
+	db.messageIDsByConversation = map[string][]string{}
+	db.unreadMessageIDs = map[string][]string{}
+	for _, message := range messages {
+		key := conversationKey(message.SenderID, message.RecipientID)
+		db.messageIDsByConversation[key] = append(db.messageIDsByConversation[key], message.ID)
+		if message.ReadAt == nil {
+			db.unreadMessageIDs[message.RecipientID] = append(db.unreadMessageIDs[message.RecipientID], message.ID)
+		}
+	}
+}
+
+func (db databaseSchema) userByEmail(email string) (User, bool) {
+	id, ok := db.userIDs[email]
+	if !ok {
+		return User{}, false
 	}
-	user, ok := db.Users[email]
+	user, ok := db.Users[id]
+	return user, ok
+}
+
+func (db databaseSchema) userByUsername(username string) (User, bool) {
+	id, ok := db.userIDsByUsername[username]
 	if !ok {
-		return User{}, fmt.Errorf("user with email %s doesn't exist", email)
+		return User{}, false
+	}
+	user, ok := db.Users[id]
+	return user, ok
+}
+
+func (db *databaseSchema) putUser(user User) {
+	if old, ok := db.Users[user.ID]; ok && old.Email != user.Email {
+		delete(db.userIDs, old.Email)
+	}
+	if old, ok := db.Users[user.ID]; ok && old.Username != user.Username {
+		delete(db.userIDsByUsername, old.Username)
+	}
+	db.Users[user.ID] = user
+	db.userIDs[user.Email] = user.ID
+	if user.Username != "" {
+		db.userIDsByUsername[user.Username] = user.ID
 	}
-	oldEmail := user.Email
-	user.Email = email
-	user.Password = password
-	user.Name = name
-	user.Age = age
-	db.Users[email] = user
-	if oldEmail != email {
-		delete(db.Users, oldEmail)
+}
+
+// touchUser marks the user with the given ID updated at t, if they exist.
+func (db *databaseSchema) touchUser(id string, t time.Time) {
+	if user, ok := db.Users[id]; ok {
+		user.UpdatedAt = t
+		db.Users[id] = user
 	}
-	err = c.updateDB(db)
+}
+
+func (c Client) CreateUser(email, password, name string, age int) (User, error) {
+	return c.InsertUser(User{Email: email, Password: password, Name: name, Age: age})
+}
+
+// InsertUser creates user unless another user has their email or username.
+// Its ID and creation and update times are filled in.
+func (c Client) InsertUser(user User) (User, error) {
+	err := c.update(func(db *databaseSchema) error {
+		if _, ok := db.userByEmail(user.Email); ok {
+			return alreadyExistsf("user with email %s already exists", user.Email)
+		}
+		if _, ok := db.userByUsername(user.Username); ok && user.Username != "" {
+			return recordError{kind: ErrUsernameTaken, msg: fmt.Sprintf("username %s is taken", user.Username)}
+		}
+		user.ID = uuid.NewString()
+		user.CreatedAt = time.Now().UTC()
+		user.UpdatedAt = user.CreatedAt
+		db.putUser(user)
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
 	return user, nil
 }
 
-func (c Client) GetUser(email string) (User, error) {
-	db, err := c.readDB()
+// UpdateUser replaces the fields of the user with the given ID. Posts
+// reference users by ID, so changing the email doesn't touch them.
+func (c Client) UpdateUser(id, email, password, name string, age int) (User, error) {
+	var user User
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		user, ok = db.Users[id]
+		if !ok {
+			return notFoundf("user with id %s doesn't exist", id)
+		}
+		if other, ok := db.userByEmail(email); ok && other.ID != id {
+			return alreadyExistsf("user with email %s already exists", email)
+		}
+		user.Email = email
+		user.Password = password
+		user.Name = name
+		user.Age = age
+		user.UpdatedAt = time.Now().UTC()
+		db.putUser(user)
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
-	user, ok := db.Users[email]
-	if !ok {
-		return User{}, fmt.Errorf("user with email %s doesn't exist", email)
-	}
 	return user, nil
 }
 
-func (c Client) DeleteUser(email string) error {
-	db, err := c.readDB()
+// ReplaceUser stores user over the user with its ID unless another user
+// has their email or username, checked in the same write. The creation time
+// is kept and the update time set.
+func (c Client) ReplaceUser(user User) (User, error) {
+	err := c.update(func(db *databaseSchema) error {
+		old, ok := db.Users[user.ID]
+		if !ok {
+			return notFoundf("user with id %s doesn't exist", user.ID)
+		}
+		if other, ok := db.userByEmail(user.Email); ok && other.ID != user.ID {
+			return alreadyExistsf("user with email %s already exists", user.Email)
+		}
+		if other, ok := db.userByUsername(user.Username); ok && other.ID != user.ID && user.Username != "" {
+			return recordError{kind: ErrUsernameTaken, msg: fmt.Sprintf("username %s is taken", user.Username)}
+		}
+		user.CreatedAt = old.CreatedAt
+		user.UpdatedAt = time.Now().UTC()
+		db.putUser(user)
+		return nil
+	})
 	if err != nil {
-		return err
+		return User{}, err
 	}
-	_, ok := db.Users[email]
-	if !ok {
-		return fmt.Errorf("user with email %s doesn't exist", email)
+	return user, nil
+}
+
+func (c Client) UpdateUserSettings(id string, settings UserSettings) (User, error) {
+	var user User
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		user, ok = db.Users[id]
+		if !ok {
+			return notFoundf("user with id %s doesn't exist", id)
+		}
+		user.Settings = settings
+		user.UpdatedAt = time.Now().UTC()
+		db.putUser(user)
+		return nil
+	})
+	if err != nil {
+		return User{}, err
 	}
-	delete(db.Users, email)
-	err = c.updateDB(db)
+	return user, nil
+}
+
+func (c Client) UpdateUserProfile(id string, profile Profile) (User, error) {
+	var user User
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		user, ok = db.Users[id]
+		if !ok {
+			return notFoundf("user with id %s doesn't exist", id)
+		}
+		user.Profile = profile
+		user.UpdatedAt = time.Now().UTC()
+		db.putUser(user)
+		return nil
+	})
 	if err != nil {
-		return err
+		return User{}, err
 	}
-	return nil
+	return user, nil
 }
 
-func (c Client) CreatePost(userEmail, text string) (Post, error) {
-	db, err := c.readDB()
+// SetUsername changes the username of a user, an empty username removes
+// it. Usernames are compared as given, callers lowercase them.
+func (c Client) SetUsername(id, username string) (User, error) {
+	var user User
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		user, ok = db.Users[id]
+		if !ok {
+			return notFoundf("user with id %s doesn't exist", id)
+		}
+		if other, ok := db.userByUsername(username); ok && other.ID != id {
+			return recordError{kind: ErrUsernameTaken, msg: fmt.Sprintf("username %s is taken", username)}
+		}
+		user.Username = username
+		user.UpdatedAt = time.Now().UTC()
+		db.putUser(user)
+		return nil
+	})
 	if err != nil {
-		return Post{}, err
+		return User{}, err
 	}
-	_, err = c.GetUser(userEmail)
+	return user, nil
+}
+
+// SetUserPrivate makes the posts of a user visible to their approved
+// followers only, or to everyone again.
+func (c Client) SetUserPrivate(id string, private bool) (User, error) {
+	var user User
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		user, ok = db.Users[id]
+		if !ok {
+			return notFoundf("user with id %s doesn't exist", id)
+		}
+		user.Private = private
+		user.UpdatedAt = time.Now().UTC()
+		db.putUser(user)
+		return nil
+	})
 	if err != nil {
-		return Post{}, err
+		return User{}, err
 	}
-	id := uuid.NewString()
-	post := Post{
-		ID: id,
-		CreatedAt: time.Now().UTC(),
-		UserEmail: userEmail,
-		Text: text,
+	return user, nil
+}
+
+// SetPassword replaces the password hash of a user and the tag of the
+// algorithm that made it.
+func (c Client) SetPassword(id, hash, algorithm string) (User, error) {
+	var user User
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		user, ok = db.Users[id]
+		if !ok {
+			return notFoundf("user with id %s doesn't exist", id)
+		}
+		user.Password = hash
+		user.PasswordAlgorithm = algorithm
+		user.UpdatedAt = time.Now().UTC()
+		db.putUser(user)
+		return nil
+	})
+	if err != nil {
+		return User{}, err
 	}
-	db.Posts[id] = post
-	err = c.updateDB(db)
+	return user, nil
+}
+
+// SetRecoveryEmail changes the recovery email of a user, an empty email
+// removes it.
+func (c Client) SetRecoveryEmail(id, email string, verified bool) (User, error) {
+	var user User
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		user, ok = db.Users[id]
+		if !ok {
+			return notFoundf("user with id %s doesn't exist", id)
+		}
+		user.RecoveryEmail = email
+		user.RecoveryEmailVerified = verified && email != ""
+		user.UpdatedAt = time.Now().UTC()
+		db.putUser(user)
+		return nil
+	})
 	if err != nil {
-		return Post{}, err
+		return User{}, err
 	}
-	return post, nil
+	return user, nil
 }
 
-func (c Client) GetPost(id string) (Post, error) {
+// GetUserByRecoveryEmail finds the user who verified email as their
+// recovery email.
+func (c Client) GetUserByRecoveryEmail(email string) (User, error) {
 	db, err := c.readDB()
 	if err != nil {
-		return Post{}, err
+		return User{}, err
 	}
-	post, ok := db.Posts[id]
-	if !ok {
-		return Post{}, fmt.Errorf("post with id %s doesn't exist", id)
+	for _, user := range db.Users {
+		if user.RecoveryEmailVerified && strings.EqualFold(user.RecoveryEmail, email) {
+			return user, nil
+		}
 	}
-	return post, nil
+	return User{}, notFoundf("no user recovers their account with %s", email)
+}
+
+func (c Client) GetUser(id string) (User, error) {
+	v, err := c.reads.do("user:"+id, func() (interface{}, error) {
+		db, err := c.readDB()
+		if err != nil {
+			return User{}, err
+		}
+		user, ok := db.Users[id]
+		if !ok {
+			return User{}, notFoundf("user with id %s doesn't exist", id)
+		}
+		return user, nil
+	})
+	return v.(User), err
 }
 
-func (c Client) GetPosts(userEmail string) ([]Post, error) {
+func (c Client) GetUserByEmail(email string) (User, error) {
 	db, err := c.readDB()
 	if err != nil {
-		return nil, err
+		return User{}, err
 	}
-	userPosts := []Post{}
-	for _, post := range db.Posts {
-		if post.UserEmail == userEmail {
-			userPosts = append(userPosts, post)
-		}
+	user, ok := db.userByEmail(email)
+	if !ok {
+		return User{}, notFoundf("user with email %s doesn't exist", email)
 	}
-	return userPosts, nil
+	return user, nil
 }
 
-func (c Client) DeletePost(id string) error {
+func (c Client) GetUserByUsername(username string) (User, error) {
 	db, err := c.readDB()
 	if err != nil {
-		return err
+		return User{}, err
 	}
-	if _, ok := db.Posts[id]; !ok {
-		return fmt.Errorf("post with id %s doesn't exist", id)
+	user, ok := db.userByUsername(username)
+	if !ok {
+		return User{}, notFoundf("user with username %s doesn't exist", username)
 	}
-	delete(db.Posts, id)
-	err = c.updateDB(db)
+	return user, nil
+}
+
+func (c Client) GetAllUsers() ([]User, error) {
+	db, err := c.readDB()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	users := []User{}
+	for _, user := range db.Users {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (c Client) DeleteUser(id string) error {
+	return c.update(func(db *databaseSchema) error {
+		_, ok := db.Users[id]
+		if !ok {
+			return notFoundf("user with id %s doesn't exist", id)
+		}
+		delete(db.Users, id)
+		delete(db.LoginAttempts, id)
+		delete(db.TwoFactor, id)
+		for key, identity := range db.Identities {
+			if identity.UserID == id {
+				delete(db.Identities, key)
+			}
+		}
+		for sessionID, session := range db.Sessions {
+			if session.UserID == id {
+				delete(db.Sessions, sessionID)
+			}
+		}
+		for eventID, event := range db.LoginEvents {
+			if event.UserID == id {
+				delete(db.LoginEvents, eventID)
+			}
+		}
+		for hash, token := range db.EmailTokens {
+			if token.UserID == id {
+				delete(db.EmailTokens, hash)
+			}
+		}
+		delete(db.Suspensions, id)
+		for postID, post := range db.PendingPosts {
+			if post.UserID == id {
+				delete(db.PendingPosts, postID)
+			}
+		}
+		delete(db.Signups, id)
+		for key, block := range db.Blocks {
+			if block.BlockerID == id || block.BlockedID == id {
+				delete(db.Blocks, key)
+			}
+		}
+		for key, follow := range db.Follows {
+			if follow.FollowerID == id || follow.FolloweeID == id {
+				delete(db.Follows, key)
+			}
+		}
+		for messageID, message := range db.Messages {
+			if message.SenderID == id || message.RecipientID == id {
+				delete(db.Messages, messageID)
+			}
+		}
+		for notificationID, notification := range db.Notifications {
+			if notification.UserID == id || notification.ActorID == id {
+				delete(db.Notifications, notificationID)
+			}
+		}
+		return nil
+	})
+}
+
+func (c Client) CreatePost(userID, text string, tags []string) (Post, error) {
+	return c.InsertPost(Post{UserID: userID, Text: text, Tags: tags})
+}
+
+// InsertPost creates post. Its ID and creation and update times are filled
+// in.
+func (c Client) InsertPost(post Post) (Post, error) {
+	err := c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[post.UserID]; !ok {
+			return notFoundf("user with id %s doesn't exist", post.UserID)
+		}
+		post.ID = uuid.NewString()
+		post.CreatedAt = time.Now().UTC()
+		post.UpdatedAt = post.CreatedAt
+		db.Posts[post.ID] = post
+		db.touchUser(post.UserID, post.UpdatedAt)
+		return nil
+	})
+	if err != nil {
+		return Post{}, err
+	}
+	return post, nil
+}
+
+// CreatePendingPost holds a post for review. Its ID and creation time are
+// filled in.
+func (c Client) CreatePendingPost(post PendingPost) (PendingPost, error) {
+	err := c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[post.UserID]; !ok {
+			return notFoundf("user with id %s doesn't exist", post.UserID)
+		}
+		post.ID = uuid.NewString()
+		post.CreatedAt = time.Now().UTC()
+		db.PendingPosts[post.ID] = post
+		return nil
+	})
+	if err != nil {
+		return PendingPost{}, err
+	}
+	return post, nil
+}
+
+// GetPendingPosts returns the posts held for review, oldest first.
+func (c Client) GetPendingPosts() ([]PendingPost, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	posts := []PendingPost{}
+	for _, post := range db.PendingPosts {
+		posts = append(posts, post)
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.Before(posts[j].CreatedAt)
+	})
+	return posts, nil
+}
+
+// ApprovePendingPost turns a post held for review into a post.
+func (c Client) ApprovePendingPost(id string) (Post, error) {
+	var post Post
+	err := c.update(func(db *databaseSchema) error {
+		pending, ok := db.PendingPosts[id]
+		if !ok {
+			return notFoundf("pending post with id %s doesn't exist", id)
+		}
+		post = Post{
+			ID:        pending.ID,
+			CreatedAt: pending.CreatedAt,
+			UpdatedAt: time.Now().UTC(),
+			UserID:    pending.UserID,
+			Text:      pending.Text,
+			Tags:      pending.Tags,
+			Mentions:  pending.Mentions,
+		}
+		delete(db.PendingPosts, id)
+		db.Posts[id] = post
+		db.touchUser(post.UserID, post.UpdatedAt)
+		return nil
+	})
+	if err != nil {
+		return Post{}, err
+	}
+	return post, nil
+}
+
+// DeletePendingPost rejects a post held for review.
+func (c Client) DeletePendingPost(id string) error {
+	return c.update(func(db *databaseSchema) error {
+		if _, ok := db.PendingPosts[id]; !ok {
+			return notFoundf("pending post with id %s doesn't exist", id)
+		}
+		delete(db.PendingPosts, id)
+		return nil
+	})
+}
+
+// RecordSignup stores the signals of a user's signup. Its creation time is
+// filled in.
+func (c Client) RecordSignup(signup Signup) (Signup, error) {
+	err := c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[signup.UserID]; !ok {
+			return notFoundf("user with id %s doesn't exist", signup.UserID)
+		}
+		signup.CreatedAt = time.Now().UTC()
+		db.Signups[signup.UserID] = signup
+		return nil
+	})
+	if err != nil {
+		return Signup{}, err
+	}
+	return signup, nil
+}
+
+func (c Client) GetSignup(userID string) (Signup, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return Signup{}, err
+	}
+	signup, ok := db.Signups[userID]
+	if !ok {
+		return Signup{}, notFoundf("signup of user with id %s doesn't exist", userID)
+	}
+	return signup, nil
+}
+
+// GetSignups returns the signups with the given status, every signup when
+// it's empty, oldest first.
+func (c Client) GetSignups(status string) ([]Signup, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	signups := []Signup{}
+	for _, signup := range db.Signups {
+		if status == "" || signup.Status == status {
+			signups = append(signups, signup)
+		}
+	}
+	sort.Slice(signups, func(i, j int) bool {
+		return signups[i].CreatedAt.Before(signups[j].CreatedAt)
+	})
+	return signups, nil
+}
+
+// SetSignupStatus accepts or holds the signup of a user.
+func (c Client) SetSignupStatus(userID, status string) (Signup, error) {
+	var signup Signup
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		signup, ok = db.Signups[userID]
+		if !ok {
+			return notFoundf("signup of user with id %s doesn't exist", userID)
+		}
+		signup.Status = status
+		db.Signups[userID] = signup
+		return nil
+	})
+	if err != nil {
+		return Signup{}, err
+	}
+	return signup, nil
+}
+
+func (c Client) GetPost(id string) (Post, error) {
+	v, err := c.reads.do("post:"+id, func() (interface{}, error) {
+		db, err := c.readDB()
+		if err != nil {
+			return Post{}, err
+		}
+		post, ok := db.Posts[id]
+		if !ok {
+			return Post{}, notFoundf("post with id %s doesn't exist", id)
+		}
+		return post, nil
+	})
+	return v.(Post), err
+}
+
+// GetPosts returns the posts of a user, in no particular order.
+func (c Client) GetPosts(userID string) ([]Post, error) {
+	v, err := c.reads.do("posts:"+userID, func() (interface{}, error) {
+		db, err := c.readDB()
+		if err != nil {
+			return []Post(nil), err
+		}
+		userPosts := []Post{}
+		for _, post := range db.Posts {
+			if post.UserID == userID {
+				userPosts = append(userPosts, post)
+			}
+		}
+		return userPosts, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// callers sort the feed, so each gets its own slice
+	return append([]Post{}, v.([]Post)...), nil
+}
+
+func (c Client) GetAllPosts() ([]Post, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	posts := []Post{}
+	for _, post := range db.Posts {
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+func (c Client) UpdatePost(id, text string, tags []string) (Post, error) {
+	var post Post
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		post, ok = db.Posts[id]
+		if !ok {
+			return notFoundf("post with id %s doesn't exist", id)
+		}
+		if text != post.Text || !equalStrings(tags, post.Tags) {
+			revisions := db.postRevisions(post)
+			post.UpdatedAt = time.Now().UTC()
+			db.PostRevisions[id] = append(revisions, PostRevision{
+				Number:    len(revisions) + 1,
+				Text:      text,
+				Tags:      tags,
+				CreatedAt: post.UpdatedAt,
+			})
+		}
+		post.Text = text
+		post.Tags = tags
+		db.Posts[id] = post
+		return nil
+	})
+	if err != nil {
+		return Post{}, err
+	}
+	return post, nil
+}
+
+// GetPostRevisions returns every version of a post, oldest first. The last
+// one is the current text.
+func (c Client) GetPostRevisions(id string) ([]PostRevision, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	post, ok := db.Posts[id]
+	if !ok {
+		return nil, notFoundf("post with id %s doesn't exist", id)
+	}
+	return db.postRevisions(post), nil
+}
+
+// postRevisions returns the revisions of a post, starting them for posts
+// that were never edited.
+func (db databaseSchema) postRevisions(post Post) []PostRevision {
+	if revisions, ok := db.PostRevisions[post.ID]; ok {
+		return revisions
+	}
+	return []PostRevision{{Number: 1, Text: post.Text, Tags: post.Tags, CreatedAt: post.CreatedAt}}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Client) GetPostsByTag(tag string) ([]Post, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	posts := []Post{}
+	for _, id := range db.postIDsByTag[tag] {
+		posts = append(posts, db.Posts[id])
+	}
+	return posts, nil
+}
+
+// TagCounts returns the number of posts carrying each tag.
+func (c Client) TagCounts() (map[string]int, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(db.postIDsByTag))
+	for tag, ids := range db.postIDsByTag {
+		counts[tag] = len(ids)
+	}
+	return counts, nil
+}
+
+func (c Client) SetPostDeadLinks(id string, deadLinks []string) (Post, error) {
+	var post Post
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		post, ok = db.Posts[id]
+		if !ok {
+			return notFoundf("post with id %s doesn't exist", id)
+		}
+		post.Metadata = &PostMetadata{
+			DeadLinks:      deadLinks,
+			LinksCheckedAt: time.Now().UTC(),
+		}
+		post.UpdatedAt = post.Metadata.LinksCheckedAt
+		db.Posts[id] = post
+		return nil
+	})
+	if err != nil {
+		return Post{}, err
+	}
+	return post, nil
+}
+
+func (c Client) DeletePost(id string) error {
+	return c.update(func(db *databaseSchema) error {
+		post, ok := db.Posts[id]
+		if !ok {
+			return notFoundf("post with id %s doesn't exist", id)
+		}
+		for _, mediaID := range post.Media {
+			delete(db.Media, mediaID)
+		}
+		delete(db.Posts, id)
+		delete(db.PostRevisions, id)
+		db.touchUser(post.UserID, time.Now().UTC())
+		return nil
+	})
+}
+
+// AddMedia records a file attached to a post. The ID, post ID and creation
+// time of media are filled in.
+func (c Client) AddMedia(postID string, media Media) (Media, error) {
+	err := c.update(func(db *databaseSchema) error {
+		post, ok := db.Posts[postID]
+		if !ok {
+			return notFoundf("post with id %s doesn't exist", postID)
+		}
+		if media.ID == "" {
+			media.ID = uuid.NewString()
+		}
+		if _, ok := db.Media[media.ID]; ok {
+			return alreadyExistsf("media with id %s already exists", media.ID)
+		}
+		media.PostID = postID
+		media.CreatedAt = time.Now().UTC()
+		db.Media[media.ID] = media
+		post.Media = append(post.Media, media.ID)
+		post.UpdatedAt = media.CreatedAt
+		db.Posts[postID] = post
+		return nil
+	})
+	if err != nil {
+		return Media{}, err
+	}
+	return media, nil
+}
+
+// SetAvatar records an uploaded avatar of a user and points the user's
+// avatar URL at it. The ID and creation time of media are filled in. It
+// returns the ID of the avatar it replaced, whose file the caller deletes.
+func (c Client) SetAvatar(userID string, media Media) (User, string, error) {
+	var user User
+	var previous string
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		user, ok = db.Users[userID]
+		if !ok {
+			return notFoundf("user with id %s doesn't exist", userID)
+		}
+		if _, ok := db.Media[media.ID]; ok {
+			return alreadyExistsf("media with id %s already exists", media.ID)
+		}
+		for id, m := range db.Media {
+			if m.UserID == userID {
+				previous = id
+				delete(db.Media, id)
+			}
+		}
+		media.PostID = ""
+		media.UserID = userID
+		media.CreatedAt = time.Now().UTC()
+		db.Media[media.ID] = media
+		user.AvatarURL = "/media/" + media.ID
+		user.UpdatedAt = time.Now().UTC()
+		db.putUser(user)
+		return nil
+	})
+	if err != nil {
+		return User{}, "", err
+	}
+	return user, previous, nil
+}
+
+func (c Client) GetMedia(id string) (Media, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return Media{}, err
+	}
+	media, ok := db.Media[id]
+	if !ok {
+		return Media{}, notFoundf("media with id %s doesn't exist", id)
+	}
+	return media, nil
+}
+
+// AwardBadge gives the user the named badge, or returns an error wrapping
+// ErrAlreadyExists if they already hold it.
+func (c Client) AwardBadge(userID, name string) (Badge, error) {
+	var badge Badge
+	err := c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[userID]; !ok {
+			return notFoundf("user with id %s doesn't exist", userID)
+		}
+		for _, badge := range db.Badges {
+			if badge.UserID == userID && badge.Name == name {
+				return alreadyExistsf("user %s already holds badge %s", userID, name)
+			}
+		}
+		badge = Badge{
+			ID:        uuid.NewString(),
+			UserID:    userID,
+			Name:      name,
+			AwardedAt: time.Now().UTC(),
+		}
+		db.Badges[badge.ID] = badge
+		return nil
+	})
+	if err != nil {
+		return Badge{}, err
+	}
+	return badge, nil
+}
+
+// GetBadges returns the badges of a user, oldest first.
+func (c Client) GetBadges(userID string) ([]Badge, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	badges := []Badge{}
+	for _, badge := range db.Badges {
+		if badge.UserID == userID {
+			badges = append(badges, badge)
+		}
+	}
+	sort.Slice(badges, func(i, j int) bool {
+		return badges[i].AwardedAt.Before(badges[j].AwardedAt)
+	})
+	return badges, nil
+}
+
+// GetLoginAttempts returns the failed logins of a user, with no failures if
+// there weren't any.
+func (c Client) GetLoginAttempts(userID string) (LoginAttempts, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return LoginAttempts{}, err
+	}
+	attempts, ok := db.LoginAttempts[userID]
+	if !ok {
+		return LoginAttempts{UserID: userID}, nil
+	}
+	return attempts, nil
+}
+
+// SaveLoginAttempts stores the failed logins of a user. Attempts without
+// failures or lock are removed.
+func (c Client) SaveLoginAttempts(attempts LoginAttempts) error {
+	return c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[attempts.UserID]; !ok {
+			return notFoundf("user with id %s doesn't exist", attempts.UserID)
+		}
+		if len(attempts.Failures) == 0 && attempts.LockedUntil.IsZero() {
+			if _, ok := db.LoginAttempts[attempts.UserID]; !ok {
+				return nil
+			}
+			delete(db.LoginAttempts, attempts.UserID)
+		} else {
+			db.LoginAttempts[attempts.UserID] = attempts
+		}
+		return nil
+	})
+}
+
+// PurgeLoginAttempts forgets failures before failedBefore and drops
+// records left without failures or a lock still in effect at now. It returns
+// how many records were dropped.
+func (c Client) PurgeLoginAttempts(failedBefore, now time.Time) (int, error) {
+	var purged int
+	err := c.update(func(db *databaseSchema) error {
+		for userID, attempts := range db.LoginAttempts {
+			recent := []time.Time{}
+			for _, failure := range attempts.Failures {
+				if !failure.Before(failedBefore) {
+					recent = append(recent, failure)
+				}
+			}
+			if len(recent) == 0 && !attempts.LockedUntil.After(now) {
+				delete(db.LoginAttempts, userID)
+				purged++
+				continue
+			}
+			if len(recent) != len(attempts.Failures) {
+				attempts.Failures = recent
+				db.LoginAttempts[userID] = attempts
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (c Client) GetTwoFactor(userID string) (TwoFactor, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return TwoFactor{}, err
+	}
+	tf, ok := db.TwoFactor[userID]
+	if !ok {
+		return TwoFactor{}, notFoundf("user %s hasn't set up two-factor authentication", userID)
+	}
+	return tf, nil
+}
+
+func (c Client) SaveTwoFactor(tf TwoFactor) error {
+	return c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[tf.UserID]; !ok {
+			return notFoundf("user with id %s doesn't exist", tf.UserID)
+		}
+		db.TwoFactor[tf.UserID] = tf
+		return nil
+	})
+}
+
+// GetIdentity returns the link of an OAuth provider account to a user.
+func (c Client) GetIdentity(provider, subject string) (Identity, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return Identity{}, err
+	}
+	identity, ok := db.Identities[identityKey(provider, subject)]
+	if !ok {
+		return Identity{}, notFoundf("%s account %s isn't linked to a user", provider, subject)
+	}
+	return identity, nil
+}
+
+// LinkIdentity links an OAuth provider account to an existing user. An
+// account links to at most one user.
+func (c Client) LinkIdentity(provider, subject, userID string) (Identity, error) {
+	var identity Identity
+	err := c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[userID]; !ok {
+			return notFoundf("user with id %s doesn't exist", userID)
+		}
+		key := identityKey(provider, subject)
+		if _, ok := db.Identities[key]; ok {
+			return alreadyExistsf("%s account %s is already linked", provider, subject)
+		}
+		identity = Identity{
+			Provider: provider,
+			Subject:  subject,
+			UserID:   userID,
+			LinkedAt: time.Now().UTC(),
+		}
+		db.Identities[key] = identity
+		return nil
+	})
+	if err != nil {
+		return Identity{}, err
+	}
+	return identity, nil
+}
+
+// CreateSession records a login. The ID, creation and last use times of
+// session are filled in.
+func (c Client) CreateSession(session Session) (Session, error) {
+	err := c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[session.UserID]; !ok {
+			return notFoundf("user with id %s doesn't exist", session.UserID)
+		}
+		session.ID = uuid.NewString()
+		session.CreatedAt = time.Now().UTC()
+		session.LastUsedAt = session.CreatedAt
+		db.Sessions[session.ID] = session
+		return nil
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+func (c Client) GetSession(id string) (Session, error) {
+	v, err := c.reads.do("session:"+id, func() (interface{}, error) {
+		db, err := c.readDB()
+		if err != nil {
+			return Session{}, err
+		}
+		session, ok := db.Sessions[id]
+		if !ok {
+			return Session{}, notFoundf("session %s doesn't exist", id)
+		}
+		return session, nil
+	})
+	return v.(Session), err
+}
+
+// GetSessions returns the sessions of a user, most recently used first.
+func (c Client) GetSessions(userID string) ([]Session, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	sessions := []Session{}
+	for _, session := range db.Sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+	return sessions, nil
+}
+
+// TouchSession records that a session was used at the given time.
+func (c Client) TouchSession(id string, at time.Time) error {
+	return c.update(func(db *databaseSchema) error {
+		session, ok := db.Sessions[id]
+		if !ok {
+			return notFoundf("session %s doesn't exist", id)
+		}
+		session.LastUsedAt = at
+		db.Sessions[id] = session
+		return nil
+	})
+}
+
+func (c Client) DeleteSession(id string) error {
+	return c.update(func(db *databaseSchema) error {
+		if _, ok := db.Sessions[id]; !ok {
+			return notFoundf("session %s doesn't exist", id)
+		}
+		delete(db.Sessions, id)
+		return nil
+	})
+}
+
+// PurgeSessions drops the sessions expired at now and returns how many
+// there were.
+func (c Client) PurgeSessions(now time.Time) (int, error) {
+	var purged int
+	err := c.update(func(db *databaseSchema) error {
+		for id, session := range db.Sessions {
+			if !session.ExpiresAt.After(now) {
+				delete(db.Sessions, id)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// RevokeToken adds a token to the revocation list. The revocation time of
+// token is filled in.
+func (c Client) RevokeToken(token RevokedToken) (RevokedToken, error) {
+	err := c.update(func(db *databaseSchema) error {
+		token.RevokedAt = time.Now().UTC()
+		db.RevokedTokens[token.ID] = token
+		return nil
+	})
+	if err != nil {
+		return RevokedToken{}, err
+	}
+	return token, nil
+}
+
+// GetRevokedTokens returns the revocation list.
+func (c Client) GetRevokedTokens() ([]RevokedToken, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	tokens := []RevokedToken{}
+	for _, token := range db.RevokedTokens {
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// PurgeRevokedTokens drops the revoked tokens expired at now, which are
+// rejected anyway, and returns how many there were.
+func (c Client) PurgeRevokedTokens(now time.Time) (int, error) {
+	var purged int
+	err := c.update(func(db *databaseSchema) error {
+		for id, token := range db.RevokedTokens {
+			if !token.ExpiresAt.After(now) {
+				delete(db.RevokedTokens, id)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// SuspendUser stores the suspension of a user, replacing the one they had.
+// Its creation time is filled in.
+func (c Client) SuspendUser(suspension Suspension) (Suspension, error) {
+	err := c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[suspension.UserID]; !ok {
+			return notFoundf("user with id %s doesn't exist", suspension.UserID)
+		}
+		suspension.CreatedAt = time.Now().UTC()
+		db.Suspensions[suspension.UserID] = suspension
+		return nil
+	})
+	if err != nil {
+		return Suspension{}, err
+	}
+	return suspension, nil
+}
+
+// GetSuspension returns the suspension of a user, expired or not.
+func (c Client) GetSuspension(userID string) (Suspension, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return Suspension{}, err
+	}
+	suspension, ok := db.Suspensions[userID]
+	if !ok {
+		return Suspension{}, notFoundf("user with id %s isn't suspended", userID)
+	}
+	return suspension, nil
+}
+
+// GetSuspensions returns every suspension, newest first.
+func (c Client) GetSuspensions() ([]Suspension, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	suspensions := []Suspension{}
+	for _, suspension := range db.Suspensions {
+		suspensions = append(suspensions, suspension)
+	}
+	sort.Slice(suspensions, func(i, j int) bool {
+		return suspensions[i].CreatedAt.After(suspensions[j].CreatedAt)
+	})
+	return suspensions, nil
+}
+
+// AddAppealNote appends a note to the suspension of a user.
+func (c Client) AddAppealNote(userID, text string) (Suspension, error) {
+	var suspension Suspension
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		suspension, ok = db.Suspensions[userID]
+		if !ok {
+			return notFoundf("user with id %s isn't suspended", userID)
+		}
+		suspension.AppealNotes = append(suspension.AppealNotes, AppealNote{Text: text, CreatedAt: time.Now().UTC()})
+		db.Suspensions[userID] = suspension
+		return nil
+	})
+	if err != nil {
+		return Suspension{}, err
+	}
+	return suspension, nil
+}
+
+// LiftSuspension reinstates a suspended user.
+func (c Client) LiftSuspension(userID string) error {
+	return c.update(func(db *databaseSchema) error {
+		if _, ok := db.Suspensions[userID]; !ok {
+			return notFoundf("user with id %s isn't suspended", userID)
+		}
+		delete(db.Suspensions, userID)
+		return nil
+	})
+}
+
+// PurgeSuspensions lifts the suspensions expired at now, and returns how
+// many there were.
+func (c Client) PurgeSuspensions(now time.Time) (int, error) {
+	var purged int
+	err := c.update(func(db *databaseSchema) error {
+		for userID, suspension := range db.Suspensions {
+			if !suspension.Active(now) {
+				delete(db.Suspensions, userID)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// BlockUser records that a user blocked another. Blocking a user twice
+// keeps the first block.
+func (c Client) BlockUser(blockerID, blockedID string) (Block, error) {
+	var block Block
+	err := c.update(func(db *databaseSchema) error {
+		for _, id := range []string{blockerID, blockedID} {
+			if _, ok := db.Users[id]; !ok {
+				return notFoundf("user with id %s doesn't exist", id)
+			}
+		}
+		key := userPairKey(blockerID, blockedID)
+		if existing, ok := db.Blocks[key]; ok {
+			block = existing
+			return nil
+		}
+		block = Block{BlockerID: blockerID, BlockedID: blockedID, CreatedAt: time.Now().UTC()}
+		db.Blocks[key] = block
+		return nil
+	})
+	if err != nil {
+		return Block{}, err
+	}
+	return block, nil
+}
+
+// UnblockUser removes the block of a user by another.
+func (c Client) UnblockUser(blockerID, blockedID string) error {
+	return c.update(func(db *databaseSchema) error {
+		key := userPairKey(blockerID, blockedID)
+		if _, ok := db.Blocks[key]; !ok {
+			return notFoundf("user with id %s didn't block user with id %s", blockerID, blockedID)
+		}
+		delete(db.Blocks, key)
+		return nil
+	})
+}
+
+// GetBlocks returns the blocks made by a user, newest first.
+func (c Client) GetBlocks(blockerID string) ([]Block, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	blocks := []Block{}
+	for _, block := range db.Blocks {
+		if block.BlockerID == blockerID {
+			blocks = append(blocks, block)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].CreatedAt.After(blocks[j].CreatedAt)
+	})
+	return blocks, nil
+}
+
+// FollowUser records that a user follows another, with the given status.
+// Following a user twice keeps the first follow.
+func (c Client) FollowUser(followerID, followeeID, status string) (Follow, error) {
+	var follow Follow
+	err := c.update(func(db *databaseSchema) error {
+		for _, id := range []string{followerID, followeeID} {
+			if _, ok := db.Users[id]; !ok {
+				return notFoundf("user with id %s doesn't exist", id)
+			}
+		}
+		key := userPairKey(followerID, followeeID)
+		if existing, ok := db.Follows[key]; ok {
+			follow = existing
+			return nil
+		}
+		follow = Follow{FollowerID: followerID, FolloweeID: followeeID, Status: status, CreatedAt: time.Now().UTC()}
+		db.Follows[key] = follow
+		return nil
+	})
+	if err != nil {
+		return Follow{}, err
+	}
+	return follow, nil
+}
+
+// SetFollowStatus changes the status of a follow, e.g. approving it.
+func (c Client) SetFollowStatus(followerID, followeeID, status string) (Follow, error) {
+	var follow Follow
+	err := c.update(func(db *databaseSchema) error {
+		key := userPairKey(followerID, followeeID)
+		var ok bool
+		follow, ok = db.Follows[key]
+		if !ok {
+			return notFoundf("user with id %s doesn't follow user with id %s", followerID, followeeID)
+		}
+		follow.Status = status
+		db.Follows[key] = follow
+		return nil
+	})
+	if err != nil {
+		return Follow{}, err
+	}
+	return follow, nil
+}
+
+// UnfollowUser removes a follow, or a request to follow, of a user.
+func (c Client) UnfollowUser(followerID, followeeID string) error {
+	return c.update(func(db *databaseSchema) error {
+		key := userPairKey(followerID, followeeID)
+		if _, ok := db.Follows[key]; !ok {
+			return notFoundf("user with id %s doesn't follow user with id %s", followerID, followeeID)
+		}
+		delete(db.Follows, key)
+		return nil
+	})
+}
+
+// GetFollowers returns the follows of a user, pending or not, oldest
+// first.
+func (c Client) GetFollowers(followeeID string) ([]Follow, error) {
+	return c.follows(func(follow Follow) bool { return follow.FolloweeID == followeeID })
+}
+
+// GetFollowing returns the follows made by a user, pending or not, oldest
+// first.
+func (c Client) GetFollowing(followerID string) ([]Follow, error) {
+	return c.follows(func(follow Follow) bool { return follow.FollowerID == followerID })
+}
+
+func (c Client) follows(keep func(Follow) bool) ([]Follow, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	follows := []Follow{}
+	for _, follow := range db.Follows {
+		if keep(follow) {
+			follows = append(follows, follow)
+		}
+	}
+	sort.Slice(follows, func(i, j int) bool {
+		return follows[i].CreatedAt.Before(follows[j].CreatedAt)
+	})
+	return follows, nil
+}
+
+// CreateMessage sends a message from one user to another.
+func (c Client) CreateMessage(senderID, recipientID, text string) (Message, error) {
+	var message Message
+	err := c.update(func(db *databaseSchema) error {
+		for _, id := range []string{senderID, recipientID} {
+			if _, ok := db.Users[id]; !ok {
+				return notFoundf("user with id %s doesn't exist", id)
+			}
+		}
+		message = Message{
+			ID:          uuid.NewString(),
+			SenderID:    senderID,
+			RecipientID: recipientID,
+			Text:        text,
+			CreatedAt:   time.Now().UTC(),
+		}
+		db.Messages[message.ID] = message
+		return nil
+	})
+	if err != nil {
+		return Message{}, err
+	}
+	return message, nil
+}
+
+func (c Client) GetMessage(id string) (Message, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return Message{}, err
+	}
+	message, ok := db.Messages[id]
+	if !ok {
+		return Message{}, notFoundf("message with id %s doesn't exist", id)
+	}
+	return message, nil
+}
+
+// GetConversation returns the messages between two users, oldest first.
+func (c Client) GetConversation(userID, otherID string) ([]Message, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	ids := db.messageIDsByConversation[conversationKey(userID, otherID)]
+	messages := make([]Message, 0, len(ids))
+	for _, id := range ids {
+		messages = append(messages, db.Messages[id])
+	}
+	return messages, nil
+}
+
+// AddAttachment records a file attached to a message. The ID, message ID and
+// creation time of media are filled in.
+func (c Client) AddAttachment(messageID string, media Media) (Media, error) {
+	err := c.update(func(db *databaseSchema) error {
+		message, ok := db.Messages[messageID]
+		if !ok {
+			return notFoundf("message with id %s doesn't exist", messageID)
+		}
+		if media.ID == "" {
+			media.ID = uuid.NewString()
+		}
+		if _, ok := db.Media[media.ID]; ok {
+			return alreadyExistsf("media with id %s already exists", media.ID)
+		}
+		media.MessageID = messageID
+		media.CreatedAt = time.Now().UTC()
+		db.Media[media.ID] = media
+		message.Attachments = append(message.Attachments, media.ID)
+		db.Messages[messageID] = message
+		return nil
+	})
+	if err != nil {
+		return Media{}, err
+	}
+	return media, nil
+}
+
+// GetAttachmentsSize returns the total size of the files attached to the
+// messages between two users.
+func (c Client) GetAttachmentsSize(userID, otherID string) (int64, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, id := range db.messageIDsByConversation[conversationKey(userID, otherID)] {
+		for _, mediaID := range db.Messages[id].Attachments {
+			size += db.Media[mediaID].Size
+		}
+	}
+	return size, nil
+}
+
+// GetUnreadMessageCounts returns how many messages a user hasn't read,
+// by sender ID.
+func (c Client) GetUnreadMessageCounts(recipientID string) (map[string]int, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, id := range db.unreadMessageIDs[recipientID] {
+		counts[db.Messages[id].SenderID]++
+	}
+	return counts, nil
+}
+
+// ReadMessage marks a message as read at the given time, along with the
+// earlier messages its recipient got from the same sender, and returns it.
+// Messages already read keep their time.
+func (c Client) ReadMessage(id string, at time.Time) (Message, error) {
+	var read Message
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		read, ok = db.Messages[id]
+		if !ok {
+			return notFoundf("message with id %s doesn't exist", id)
+		}
+		for _, unreadID := range db.unreadMessageIDs[read.RecipientID] {
+			message := db.Messages[unreadID]
+			if message.SenderID != read.SenderID || message.CreatedAt.After(read.CreatedAt) {
+				continue
+			}
+			message.ReadAt = &at
+			db.Messages[unreadID] = message
+		}
+		read = db.Messages[id]
+		return nil
+	})
+	if err != nil {
+		return Message{}, err
+	}
+	return read, nil
+}
+
+// CreateLoginEvent adds a login to the history of its user, dropping the
+// oldest ones past maxLoginEventsPerUser. The ID and creation time of event
+// are filled in.
+func (c Client) CreateLoginEvent(event LoginEvent) (LoginEvent, error) {
+	err := c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[event.UserID]; !ok {
+			return notFoundf("user with id %s doesn't exist", event.UserID)
+		}
+		event.ID = uuid.NewString()
+		event.CreatedAt = time.Now().UTC()
+		db.LoginEvents[event.ID] = event
+		history := db.loginEvents(event.UserID)
+		for len(history) > maxLoginEventsPerUser {
+			delete(db.LoginEvents, history[len(history)-1].ID)
+			history = history[:len(history)-1]
+		}
+		return nil
+	})
+	if err != nil {
+		return LoginEvent{}, err
+	}
+	return event, nil
+}
+
+// GetLoginEvents returns the login history of a user, newest first.
+func (c Client) GetLoginEvents(userID string) ([]LoginEvent, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	return db.loginEvents(userID), nil
+}
+
+func (db databaseSchema) loginEvents(userID string) []LoginEvent {
+	events := []LoginEvent{}
+	for _, event := range db.LoginEvents {
+		if event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].CreatedAt.Equal(events[j].CreatedAt) {
+			return events[i].CreatedAt.After(events[j].CreatedAt)
+		}
+		return events[i].ID < events[j].ID
+	})
+	return events
+}
+
+// CreateNotification adds a notification for its user, dropping the oldest
+// ones past maxNotificationsPerUser. The ID and creation time of
+// notification are filled in.
+func (c Client) CreateNotification(notification Notification) (Notification, error) {
+	err := c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[notification.UserID]; !ok {
+			return notFoundf("user with id %s doesn't exist", notification.UserID)
+		}
+		notification.ID = uuid.NewString()
+		notification.CreatedAt = time.Now().UTC()
+		db.Notifications[notification.ID] = notification
+		notifications := db.notifications(notification.UserID)
+		for len(notifications) > maxNotificationsPerUser {
+			delete(db.Notifications, notifications[len(notifications)-1].ID)
+			notifications = notifications[:len(notifications)-1]
+		}
+		return nil
+	})
+	if err != nil {
+		return Notification{}, err
+	}
+	return notification, nil
+}
+
+// GetNotifications returns the notifications of a user, newest first.
+func (c Client) GetNotifications(userID string) ([]Notification, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	return db.notifications(userID), nil
+}
+
+// ReadNotifications marks notifications of a user as read at the given
+// time, all of them when ids is empty, and returns how many weren't read
+// yet. IDs of other users' notifications are ignored.
+func (c Client) ReadNotifications(userID string, ids []string, at time.Time) (int, error) {
+	var read int
+	err := c.update(func(db *databaseSchema) error {
+		only := map[string]bool{}
+		for _, id := range ids {
+			only[id] = true
+		}
+		for _, notification := range db.notifications(userID) {
+			if notification.ReadAt != nil || (len(only) > 0 && !only[notification.ID]) {
+				continue
+			}
+			notification.ReadAt = &at
+			db.Notifications[notification.ID] = notification
+			read++
+		}
+		return nil
+	})
+	return read, err
+}
+
+func (db databaseSchema) notifications(userID string) []Notification {
+	notifications := []Notification{}
+	for _, notification := range db.Notifications {
+		if notification.UserID == userID {
+			notifications = append(notifications, notification)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		if !notifications[i].CreatedAt.Equal(notifications[j].CreatedAt) {
+			return notifications[i].CreatedAt.After(notifications[j].CreatedAt)
+		}
+		return notifications[i].ID < notifications[j].ID
+	})
+	return notifications
+}
+
+func (c Client) CreateEmailToken(token EmailToken) error {
+	return c.update(func(db *databaseSchema) error {
+		if _, ok := db.Users[token.UserID]; !ok {
+			return notFoundf("user with id %s doesn't exist", token.UserID)
+		}
+		db.EmailTokens[token.Hash] = token
+		return nil
+	})
+}
+
+// UseEmailToken consumes the token with hash, if it is for purpose and
+// hasn't expired at now.
+func (c Client) UseEmailToken(hash, purpose string, now time.Time) (EmailToken, error) {
+	var token EmailToken
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		token, ok = db.EmailTokens[hash]
+		if !ok || token.Purpose != purpose || !token.ExpiresAt.After(now) {
+			return notFoundf("token doesn't exist or expired")
+		}
+		delete(db.EmailTokens, hash)
+		return nil
+	})
+	if err != nil {
+		return EmailToken{}, err
+	}
+	return token, nil
+}
+
+// PurgeEmailTokens drops the tokens expired at now and returns how many.
+func (c Client) PurgeEmailTokens(now time.Time) (int, error) {
+	var purged int
+	err := c.update(func(db *databaseSchema) error {
+		for hash, token := range db.EmailTokens {
+			if !token.ExpiresAt.After(now) {
+				delete(db.EmailTokens, hash)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (c Client) CreateTenant(id, name string) (Tenant, error) {
+	var tenant Tenant
+	err := c.update(func(db *databaseSchema) error {
+		if _, ok := db.Tenants[id]; ok {
+			return alreadyExistsf("tenant %s already exists", id)
+		}
+		tenant = Tenant{
+			ID:        id,
+			Name:      name,
+			CreatedAt: time.Now().UTC(),
+		}
+		db.Tenants[id] = tenant
+		return nil
+	})
+	if err != nil {
+		return Tenant{}, err
+	}
+	return tenant, nil
+}
+
+func (c Client) GetTenant(id string) (Tenant, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return Tenant{}, err
+	}
+	tenant, ok := db.Tenants[id]
+	if !ok {
+		return Tenant{}, notFoundf("tenant %s doesn't exist", id)
+	}
+	return tenant, nil
+}
+
+func (c Client) UpdateTenantSettings(id string, settings TenantSettings) (Tenant, error) {
+	var tenant Tenant
+	err := c.update(func(db *databaseSchema) error {
+		var ok bool
+		tenant, ok = db.Tenants[id]
+		if !ok {
+			return notFoundf("tenant %s doesn't exist", id)
+		}
+		tenant.Settings = settings
+		db.Tenants[id] = tenant
+		return nil
+	})
+	if err != nil {
+		return Tenant{}, err
+	}
+	return tenant, nil
+}
+
+// GetTenants returns every tenant ordered by ID.
+func (c Client) GetTenants() ([]Tenant, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	tenants := []Tenant{}
+	for _, tenant := range db.Tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].ID < tenants[j].ID
+	})
+	return tenants, nil
+}
+
+func (c Client) CreateJob(kind string, payload json.RawMessage, runAt time.Time) (Job, error) {
+	var job Job
+	err := c.update(func(db *databaseSchema) error {
+		now := time.Now().UTC()
+		job = Job{
+			ID:        uuid.NewString(),
+			Kind:      kind,
+			Payload:   payload,
+			Status:    JobPending,
+			RunAt:     runAt.UTC(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		db.Jobs[job.ID] = job
+		return nil
+	})
+	if err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+func (c Client) UpdateJob(job Job) error {
+	return c.update(func(db *databaseSchema) error {
+		if _, ok := db.Jobs[job.ID]; !ok {
+			return notFoundf("job %s doesn't exist", job.ID)
+		}
+		job.UpdatedAt = time.Now().UTC()
+		db.Jobs[job.ID] = job
+		return nil
+	})
+}
+
+// GetJobs returns every job, newest first.
+func (c Client) GetJobs() ([]Job, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	jobs := []Job{}
+	for _, job := range db.Jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// DeleteFinishedJobs removes done and failed jobs last updated before
+// cutoff and returns how many there were.
+func (c Client) DeleteFinishedJobs(cutoff time.Time) (int, error) {
+	var deleted int
+	err := c.update(func(db *databaseSchema) error {
+		for id, job := range db.Jobs {
+			if (job.Status == JobDone || job.Status == JobFailed) && job.UpdatedAt.Before(cutoff) {
+				delete(db.Jobs, id)
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// CreateEmail stores a queued email.
+func (c Client) CreateEmail(email Email) (Email, error) {
+	err := c.update(func(db *databaseSchema) error {
+		now := time.Now().UTC()
+		email.ID = uuid.NewString()
+		email.Status = EmailQueued
+		email.CreatedAt = now
+		email.UpdatedAt = now
+		db.Emails[email.ID] = email
+		return nil
+	})
+	if err != nil {
+		return Email{}, err
+	}
+	return email, nil
+}
+
+func (c Client) UpdateEmail(email Email) error {
+	return c.update(func(db *databaseSchema) error {
+		if _, ok := db.Emails[email.ID]; !ok {
+			return notFoundf("email %s doesn't exist", email.ID)
+		}
+		email.UpdatedAt = time.Now().UTC()
+		db.Emails[email.ID] = email
+		return nil
+	})
+}
+
+func (c Client) GetEmail(id string) (Email, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return Email{}, err
+	}
+	email, ok := db.Emails[id]
+	if !ok {
+		return Email{}, notFoundf("email %s doesn't exist", id)
+	}
+	return email, nil
+}
+
+// GetEmails returns every email, newest first.
+func (c Client) GetEmails() ([]Email, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	emails := []Email{}
+	for _, email := range db.Emails {
+		emails = append(emails, email)
+	}
+	sort.Slice(emails, func(i, j int) bool {
+		return emails[i].CreatedAt.After(emails[j].CreatedAt)
+	})
+	return emails, nil
+}
+
+type ImportRecord struct {
+	User *User
+	Post *Post
+	// PostAuthorEmail identifies the author of a post without a UserID,
+	// which may be a user imported earlier in the same batch.
+	PostAuthorEmail string
+}
+
+// Import writes all records using a single read and a single write of the
+// database file. It returns one error per record (nil on success); records
+// that fail are skipped without aborting the rest of the import.
+func (c Client) Import(records []ImportRecord) ([]error, error) {
+	var errs []error
+	err := c.update(func(db *databaseSchema) error {
+		errs = make([]error, len(records))
+		for i, record := range records {
+			switch {
+			case record.User != nil:
+				user := *record.User
+				if _, ok := db.userByEmail(user.Email); ok {
+					errs[i] = alreadyExistsf("user with email %s already exists", user.Email)
+					continue
+				}
+				if user.ID == "" {
+					user.ID = uuid.NewString()
+				}
+				if _, ok := db.Users[user.ID]; ok {
+					errs[i] = alreadyExistsf("user with id %s already exists", user.ID)
+					continue
+				}
+				if _, ok := db.userByUsername(user.Username); ok && user.Username != "" {
+					errs[i] = alreadyExistsf("username %s is taken", user.Username)
+					continue
+				}
+				if user.CreatedAt.IsZero() {
+					user.CreatedAt = time.Now().UTC()
+				}
+				if user.UpdatedAt.IsZero() {
+					user.UpdatedAt = user.CreatedAt
+				}
+				db.putUser(user)
+				*record.User = user
+			case record.Post != nil:
+				post := *record.Post
+				if post.UserID == "" {
+					author, ok := db.userByEmail(record.PostAuthorEmail)
+					if !ok {
+						errs[i] = notFoundf("user with email %s doesn't exist", record.PostAuthorEmail)
+						continue
+					}
+					post.UserID = author.ID
+				}
+				if _, ok := db.Users[post.UserID]; !ok {
+					errs[i] = notFoundf("user with id %s doesn't exist", post.UserID)
+					continue
+				}
+				if post.ID == "" {
+					post.ID = uuid.NewString()
+				}
+				if _, ok := db.Posts[post.ID]; ok {
+					errs[i] = alreadyExistsf("post with id %s already exists", post.ID)
+					continue
+				}
+				if post.CreatedAt.IsZero() {
+					post.CreatedAt = time.Now().UTC()
+				}
+				if post.UpdatedAt.IsZero() {
+					post.UpdatedAt = post.CreatedAt
+				}
+				db.Posts[post.ID] = post
+				db.touchUser(post.UserID, time.Now().UTC())
+				*record.Post = post
+			default:
+				errs[i] = fmt.Errorf("empty record")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+type CompactReport struct {
+	Users        int `json:"users"`
+	Posts        int `json:"posts"`
+	OrphanPosts  int `json:"orphanPosts"`
+	OrphanMedia  int `json:"orphanMedia"`
+	OrphanBadges int `json:"orphanBadges"`
+	// OrphanRevisions counts posts whose revisions were removed.
+	OrphanRevisions int `json:"orphanRevisions"`
+	BytesBefore     int `json:"bytesBefore"`
+	BytesAfter      int `json:"bytesAfter"`
+}
+
+// hasOwner reports whether the post or message of media, or the user of an
+// avatar, exists.
+func (db databaseSchema) hasOwner(media Media) bool {
+	if media.UserID != "" {
+		_, ok := db.Users[media.UserID]
+		return ok
+	}
+	if media.MessageID != "" {
+		_, ok := db.Messages[media.MessageID]
+		return ok
+	}
+	_, ok := db.Posts[media.PostID]
+	return ok
+}
+
+// Compact removes posts and badges whose user no longer exists, media and
+// revisions whose post or user no longer exists, and rewrites the file.
+func (c Client) Compact() (CompactReport, error) {
+	report := CompactReport{}
+	mutations, err := c.write(func(old []byte) ([]byte, error) {
+		db := &databaseSchema{}
+		err := json.Unmarshal(old, db)
+		if err != nil {
+			return nil, err
+		}
+		db.ensureCollections()
+		report = CompactReport{BytesBefore: len(old)}
+		for id, post := range db.Posts {
+			if _, ok := db.Users[post.UserID]; !ok {
+				delete(db.Posts, id)
+				report.OrphanPosts++
+			}
+		}
+		for id, media := range db.Media {
+			if !db.hasOwner(media) {
+				delete(db.Media, id)
+				report.OrphanMedia++
+			}
+		}
+		for id := range db.PostRevisions {
+			if _, ok := db.Posts[id]; !ok {
+				delete(db.PostRevisions, id)
+				report.OrphanRevisions++
+			}
+		}
+		for id, badge := range db.Badges {
+			if _, ok := db.Users[badge.UserID]; !ok {
+				delete(db.Badges, id)
+				report.OrphanBadges++
+			}
+		}
+		report.Users = len(db.Users)
+		report.Posts = len(db.Posts)
+		data, err := json.Marshal(db)
+		report.BytesAfter = len(data)
+		return data, err
+	})
+	if err != nil {
+		return CompactReport{}, err
+	}
+	c.mutated(mutations)
+	return report, nil
+}
+
+// Verify returns a description of every inconsistency in the database.
+func (c Client) Verify() ([]string, error) {
+	db, err := c.readDB()
+	if err != nil {
+		return nil, err
+	}
+	problems := []string{}
+	emails := map[string]string{}
+	for id, user := range db.Users {
+		if user.ID != id {
+			problems = append(problems, fmt.Sprintf("user %s is stored under key %s", user.ID, id))
+		}
+		if other, ok := emails[user.Email]; ok {
+			problems = append(problems, fmt.Sprintf("users %s and %s share email %s", other, id, user.Email))
+		}
+		emails[user.Email] = id
+		if user.CreatedAt.IsZero() {
+			problems = append(problems, fmt.Sprintf("user %s has no creation time", id))
+		}
+	}
+	for id, post := range db.Posts {
+		if post.ID != id {
+			problems = append(problems, fmt.Sprintf("post %s is stored under key %s", post.ID, id))
+		}
+		if _, ok := db.Users[post.UserID]; !ok {
+			problems = append(problems, fmt.Sprintf("post %s belongs to missing user %s", id, post.UserID))
+		}
+		if post.CreatedAt.IsZero() {
+			problems = append(problems, fmt.Sprintf("post %s has no creation time", id))
+		}
+		for _, mediaID := range post.Media {
+			if _, ok := db.Media[mediaID]; !ok {
+				problems = append(problems, fmt.Sprintf("post %s references missing media %s", id, mediaID))
+			}
+		}
+	}
+	for id, media := range db.Media {
+		if media.UserID != "" && !db.hasOwner(media) {
+			problems = append(problems, fmt.Sprintf("avatar %s belongs to missing user %s", id, media.UserID))
+		} else if !db.hasOwner(media) {
+			problems = append(problems, fmt.Sprintf("media %s belongs to missing post %s", id, media.PostID))
+		}
+	}
+	for id, badge := range db.Badges {
+		if _, ok := db.Users[badge.UserID]; !ok {
+			problems = append(problems, fmt.Sprintf("badge %s belongs to missing user %s", id, badge.UserID))
+		}
+	}
+	for key, identity := range db.Identities {
+		if _, ok := db.Users[identity.UserID]; !ok {
+			problems = append(problems, fmt.Sprintf("identity %s belongs to missing user %s", key, identity.UserID))
+		}
+	}
+	sort.Strings(problems)
+	return problems, nil
 }
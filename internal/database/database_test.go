@@ -0,0 +1,188 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestTagIndex(t *testing.T) {
+	c := NewClient(filepath.Join(t.TempDir(), "db.json"))
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.CreateUser("a@example.com", "12345", "A", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := c.CreatePost(user.ID, "first", []string{"go", "backend"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreatePost(user.ID, "second", []string{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.UpdatePost(first.ID, "first", []string{"go", "testing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := c.TagCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{"go": 2, "testing": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("got %v, want %v", counts, expected)
+	}
+	posts, err := c.GetPostsByTag("testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].ID != first.ID {
+		t.Errorf("got %+v, want post %s", posts, first.ID)
+	}
+}
+
+func TestPostRevisions(t *testing.T) {
+	c := NewMemoryClient()
+	user, err := c.CreateUser("a@example.com", "12345", "A", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := c.CreatePost(user.ID, "first", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edits := []struct {
+		text string
+		tags []string
+	}{
+		{text: "second"},
+		// unchanged, no revision
+		{text: "second"},
+		{text: "second", tags: []string{"go"}},
+	}
+	for _, edit := range edits {
+		_, err = c.UpdatePost(post.ID, edit.text, edit.tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	revisions, err := c.GetPostRevisions(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, rev := range revisions {
+		got = append(got, fmt.Sprintf("%d:%s%v", rev.Number, rev.Text, rev.Tags))
+	}
+	expected := []string{"1:first[]", "2:second[]", "3:second[go]"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+
+	err = c.DeletePost(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetPostRevisions(post.ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("revisions of a deleted post: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestUpdatedAt(t *testing.T) {
+	c := NewMemoryClient()
+	user, err := c.CreateUser("a@example.com", "12345", "A", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.UpdatedAt.Equal(user.CreatedAt) {
+		t.Errorf("got a new user updated at %v, created at %v", user.UpdatedAt, user.CreatedAt)
+	}
+	updated, err := c.UpdateUserSettings(user.ID, UserSettings{Timezone: "Europe/Paris"})
+	if err != nil || !updated.UpdatedAt.After(user.UpdatedAt) {
+		t.Errorf("got %v %v, want the settings update later", updated.UpdatedAt, err)
+	}
+
+	// the set of posts of a user is part of the user
+	post, err := c.CreatePost(user.ID, "first", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, _ = c.GetUser(user.ID)
+	if !post.UpdatedAt.Equal(post.CreatedAt) || !user.UpdatedAt.Equal(post.CreatedAt) {
+		t.Errorf("got post updated at %v, user at %v, want %v", post.UpdatedAt, user.UpdatedAt, post.CreatedAt)
+	}
+	unchanged, err := c.UpdatePost(post.ID, "first", nil)
+	if err != nil || !unchanged.UpdatedAt.Equal(post.UpdatedAt) {
+		t.Errorf("got %v %v for an unchanged post, want %v", unchanged.UpdatedAt, err, post.UpdatedAt)
+	}
+	edited, err := c.UpdatePost(post.ID, "second", nil)
+	if err != nil || !edited.UpdatedAt.After(post.UpdatedAt) {
+		t.Errorf("got %v %v for an edited post, want it later", edited.UpdatedAt, err)
+	}
+	err = c.DeletePost(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, _ := c.GetUser(user.ID)
+	if !deleted.UpdatedAt.After(user.UpdatedAt) {
+		t.Errorf("got user updated at %v after deleting a post, want after %v", deleted.UpdatedAt, user.UpdatedAt)
+	}
+
+	// records stored before were last updated when created
+	path := filepath.Join(t.TempDir(), "db.json")
+	err = os.WriteFile(path, []byte(`{"users":{"u1":{"id":"u1","createdAt":"2024-05-01T12:00:00Z","email":"b@example.com"}},"posts":{"p1":{"id":"p1","createdAt":"2024-05-02T12:00:00Z","userId":"u1"}}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = NewClient(path)
+	legacyUser, err := c.GetUser("u1")
+	if err != nil || !legacyUser.UpdatedAt.Equal(legacyUser.CreatedAt) {
+		t.Errorf("got %v %v, want the creation time", legacyUser.UpdatedAt, err)
+	}
+	legacyPost, err := c.GetPost("p1")
+	if err != nil || !legacyPost.UpdatedAt.Equal(legacyPost.CreatedAt) {
+		t.Errorf("got %v %v, want the creation time", legacyPost.UpdatedAt, err)
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	for name, c := range map[string]Client{
+		"file":   NewClient(filepath.Join(t.TempDir(), "db.json")),
+		"memory": NewMemoryClient(),
+	} {
+		err := c.EnsureDB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := c.CreateUser(fmt.Sprintf("user%d@example.com", i), "12345", "A", 20)
+				if err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		users, err := c.GetAllUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 50 {
+			t.Errorf("%s: got %d users, want 50", name, len(users))
+		}
+	}
+}
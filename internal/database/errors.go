@@ -0,0 +1,37 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is wrapped by errors about missing records.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is wrapped by errors about conflicting records.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrUsernameTaken is wrapped by errors about users whose username
+	// another user has. It wraps ErrAlreadyExists.
+	ErrUsernameTaken = fmt.Errorf("username %w", ErrAlreadyExists)
+)
+
+type recordError struct {
+	kind error
+	msg  string
+}
+
+func (e recordError) Error() string {
+	return e.msg
+}
+
+func (e recordError) Unwrap() error {
+	return e.kind
+}
+
+func notFoundf(format string, a ...interface{}) error {
+	return recordError{kind: ErrNotFound, msg: fmt.Sprintf(format, a...)}
+}
+
+func alreadyExistsf(format string, a ...interface{}) error {
+	return recordError{kind: ErrAlreadyExists, msg: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// memoryStore holds the records of a database kept in memory instead of a
+// file. It's lost when the process exits.
+type memoryStore struct {
+	mu    sync.RWMutex
+	colls collections
+}
+
+// NewMemoryClient returns a client for a new, empty database kept in
+// memory, for tests and demos. There's no file to checksum, so Integrity
+// always passes, and WithWAL shouldn't be used with it.
+func NewMemoryClient() Client {
+	c := NewClient("")
+	c.memory = &memoryStore{colls: collections{}}
+	return c
+}
+
+// InMemory reports whether the database is kept in memory rather than in a
+// file.
+func (c Client) InMemory() bool {
+	return c.memory != nil
+}
+
+// read returns the records as the contents of a database file.
+func (m *memoryStore) read() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return json.Marshal(m.colls)
+}
+
+// write replaces the records with the ones in data, the contents of a
+// database file.
+func (m *memoryStore) write(data []byte) error {
+	colls, err := parseCollections(data)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.colls = colls
+	return nil
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestMemoryClient(t *testing.T) {
+	mutations := []Mutation{}
+	c := NewMemoryClient().WithMutationHook(func(m []Mutation) {
+		mutations = append(mutations, m...)
+	})
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := c.CreatePost(user.ID, "hello", []string{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetUserByEmail("test@example.com")
+	if err != nil || got.ID != user.ID {
+		t.Errorf("got %+v, %v, want the created user", got, err)
+	}
+	// the post updates its author
+	if len(mutations) != 3 {
+		t.Errorf("got %d mutations, want 3", len(mutations))
+	}
+	if integrity := c.Integrity(); !integrity.OK || integrity.Records["users"] != 1 || integrity.Records["posts"] != 1 {
+		t.Errorf("got integrity %+v, want 1 user and 1 post", integrity)
+	}
+
+	// a snapshot restores like a database file
+	snapshot, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.DeletePost(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetPost(post.ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound after deleting the post", err)
+	}
+	restored, err := c.Restore(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetPost(post.ID)
+	if err != nil {
+		t.Errorf("got %v, want the post back after restoring", err)
+	}
+	for _, mutation := range restored {
+		if !mutation.Restored {
+			t.Errorf("got %+v, want restored records marked", mutation)
+		}
+	}
+
+	// clients are independent
+	other := NewMemoryClient()
+	users, err := other.GetAllUsers()
+	if err != nil || len(users) != 0 {
+		t.Errorf("got %d users, %v, want an empty database", len(users), err)
+	}
+}
+
+func TestMemoryClientConcurrentReads(t *testing.T) {
+	c := NewMemoryClient()
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.GetUser(user.ID)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
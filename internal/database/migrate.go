@@ -0,0 +1,61 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// userIDNamespace derives the IDs of users migrated from email keys. The IDs
+// are deterministic so every replica of a database migrates to the same IDs.
+var userIDNamespace = uuid.MustParse("6f0c3b8e-2f4d-4c55-9a8e-0d5b1f6a7c21")
+
+// migrateUserIDs rewrites databases from before users had IDs: users are
+// re-keyed from their email to a new ID and posts reference that ID instead
+// of the author's email. data is written back only if something changed.
+func (c Client) migrateUserIDs(data []byte) error {
+	type legacyPost struct {
+		Post
+		UserEmail string `json:"userEmail"`
+	}
+	legacy := struct {
+		Users map[string]User       `json:"users"`
+		Posts map[string]legacyPost `json:"posts"`
+	}{}
+	err := json.Unmarshal(data, &legacy)
+	if err != nil {
+		return err
+	}
+
+	migrated := false
+	db := databaseSchema{Users: map[string]User{}, Posts: map[string]Post{}}
+	for key, user := range legacy.Users {
+		if user.ID == "" {
+			if user.Email == "" {
+				user.Email = key
+			}
+			user.ID = uuid.NewSHA1(userIDNamespace, []byte(user.Email)).String()
+			migrated = true
+		}
+		db.Users[user.ID] = user
+	}
+	db.ensureCollections()
+	for id, post := range legacy.Posts {
+		if post.UserID == "" && post.UserEmail != "" {
+			// posts of missing users keep an empty UserID, like other orphans
+			if user, ok := db.userByEmail(post.UserEmail); ok {
+				post.Post.UserID = user.ID
+			}
+			migrated = true
+		}
+		db.Posts[id] = post.Post
+	}
+	if !migrated {
+		return nil
+	}
+	data, err = json.Marshal(db)
+	if err != nil {
+		return err
+	}
+	return c.writeFile(data)
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateUserIDs(t *testing.T) {
+	legacy := `{
+		"users": {"a@example.com": {"email": "a@example.com", "name": "A", "age": 20}},
+		"posts": {
+			"p1": {"id": "p1", "userEmail": "a@example.com", "text": "hello"},
+			"p2": {"id": "p2", "userEmail": "gone@example.com", "text": "orphan"}
+		}
+	}`
+	c := NewClient(filepath.Join(t.TempDir(), "db.json"))
+	err := os.WriteFile(c.path, []byte(legacy), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := c.GetUserByEmail("a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == "" || user.Name != "A" {
+		t.Errorf("got %+v, want a migrated user", user)
+	}
+	posts, err := c.GetPosts(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].ID != "p1" {
+		t.Errorf("got %+v, want post p1", posts)
+	}
+
+	// migrating twice, e.g. on a replica, gives the same IDs
+	other := NewClient(filepath.Join(t.TempDir(), "db.json"))
+	err = os.WriteFile(other.path, []byte(legacy), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = other.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.GetUser(user.ID); err != nil {
+		t.Errorf("got %v, want the same user ID on both databases", err)
+	}
+}
+
+func TestUpdateUserEmail(t *testing.T) {
+	c := NewClient(filepath.Join(t.TempDir(), "db.json"))
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := c.CreateUser("a@example.com", "12345", "A", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateUser("b@example.com", "12345", "B", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := c.CreatePost(a.ID, "hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.UpdateUser(a.ID, "b@example.com", "12345", "A", 20)
+	if err == nil {
+		t.Errorf("expected taking another user's email to fail")
+	}
+	_, err = c.UpdateUser(a.ID, "new@example.com", "12345", "A", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetUserByEmail("a@example.com"); err == nil {
+		t.Errorf("old email still resolves")
+	}
+	user, err := c.GetUserByEmail("new@example.com")
+	if err != nil || user.ID != a.ID {
+		t.Errorf("got %+v, %v, want user %s", user, err, a.ID)
+	}
+	got, err := c.GetPost(post.ID)
+	if err != nil || got.UserID != a.ID {
+		t.Errorf("got %+v, %v, want post still owned by %s", got, err, a.ID)
+	}
+}
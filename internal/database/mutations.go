@@ -0,0 +1,302 @@
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Mutation is a change to a single record, as seen in the database file. A
+// nil Value deletes the record. Previous is the HashValue of the record being
+// replaced (empty if there was none), so a replica can detect that its copy
+// diverged before applying the change. Restored marks records put back as
+// they were, by a rollback or Restore, rather than written anew.
+type Mutation struct {
+	Collection string          `json:"collection"`
+	Key        string          `json:"key"`
+	Value      json.RawMessage `json:"value,omitempty"`
+	Previous   string          `json:"previous,omitempty"`
+	Restored   bool            `json:"restored,omitempty"`
+}
+
+// collections is the raw view of the database file: every top-level section
+// is a map of records keyed by ID.
+type collections map[string]map[string]json.RawMessage
+
+// WithMutationHook returns a copy of the client that calls fn with the
+// records changed by every successful write, after any hooks already set.
+func (c Client) WithMutationHook(fn func([]Mutation)) Client {
+	previous := c.onMutation
+	if previous == nil {
+		c.onMutation = fn
+		return c
+	}
+	c.onMutation = func(mutations []Mutation) {
+		previous(mutations)
+		fn(mutations)
+	}
+	return c
+}
+
+// WithCommitHook returns a copy of the client that calls fn with the
+// records changed by every write once it's committed, after any hooks
+// already set. Writes made as part of a transaction are committed when it
+// ends without an error, those it rolls back never are.
+func (c Client) WithCommitHook(fn func([]Mutation)) Client {
+	previous := c.onCommit
+	if previous == nil {
+		c.onCommit = fn
+		return c
+	}
+	c.onCommit = func(mutations []Mutation) {
+		previous(mutations)
+		fn(mutations)
+	}
+	return c
+}
+
+// mutated runs the hooks with the records a write changed: the mutation
+// hook right away, the commit hook once the write is committed.
+func (c Client) mutated(mutations []Mutation) {
+	if len(mutations) == 0 {
+		return
+	}
+	if c.onMutation != nil {
+		c.onMutation(mutations)
+	}
+	if c.onCommit == nil {
+		return
+	}
+	if tx := c.transaction(); tx != nil {
+		tx.onCommit(func() { c.onCommit(mutations) })
+		return
+	}
+	c.onCommit(mutations)
+}
+
+func HashValue(value []byte) string {
+	if value == nil {
+		return ""
+	}
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:16])
+}
+
+// apply sets or deletes the records of mutations, in order.
+func (colls collections) apply(mutations []Mutation) {
+	for _, mutation := range mutations {
+		records, ok := colls[mutation.Collection]
+		if !ok {
+			records = map[string]json.RawMessage{}
+			colls[mutation.Collection] = records
+		}
+		if mutation.Value == nil {
+			delete(records, mutation.Key)
+			continue
+		}
+		records[mutation.Key] = mutation.Value
+	}
+}
+
+// Collection returns the records of the named collection as stored in the
+// database file, keyed by ID.
+func (c Client) Collection(name string) (map[string]json.RawMessage, error) {
+	colls, err := c.Collections()
+	if err != nil {
+		return nil, err
+	}
+	records, ok := colls[name]
+	if !ok {
+		return nil, notFoundf("collection %q doesn't exist", name)
+	}
+	return records, nil
+}
+
+// Collections returns every collection of the database file by name, as
+// stored. Collections the file doesn't have yet are empty.
+func (c Client) Collections() (map[string]map[string]json.RawMessage, error) {
+	empty := databaseSchema{}
+	empty.ensureCollections()
+	known, err := json.Marshal(empty)
+	if err != nil {
+		return nil, err
+	}
+	names, err := parseCollections(known)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.readFile()
+	if err != nil {
+		return nil, err
+	}
+	colls, err := parseCollections(data)
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string]map[string]json.RawMessage, len(names))
+	for name := range names {
+		all[name] = colls[name]
+		if all[name] == nil {
+			all[name] = map[string]json.RawMessage{}
+		}
+	}
+	return all, nil
+}
+
+func parseCollections(data []byte) (collections, error) {
+	colls := collections{}
+	if len(data) == 0 {
+		return colls, nil
+	}
+	err := json.Unmarshal(data, &colls)
+	if err != nil {
+		return nil, err
+	}
+	return colls, nil
+}
+
+func diffCollections(oldData, newData []byte) ([]Mutation, error) {
+	oldColls, err := parseCollections(oldData)
+	if err != nil {
+		return nil, err
+	}
+	newColls, err := parseCollections(newData)
+	if err != nil {
+		return nil, err
+	}
+	mutations := []Mutation{}
+	for name, records := range newColls {
+		for key, value := range records {
+			previous, ok := oldColls[name][key]
+			if ok && bytes.Equal(previous, value) {
+				continue
+			}
+			mutation := Mutation{Collection: name, Key: key, Value: value}
+			if ok {
+				mutation.Previous = HashValue(previous)
+			}
+			mutations = append(mutations, mutation)
+		}
+	}
+	for name, records := range oldColls {
+		for key, previous := range records {
+			if _, ok := newColls[name][key]; ok {
+				continue
+			}
+			mutations = append(mutations, Mutation{Collection: name, Key: key, Previous: HashValue(previous)})
+		}
+	}
+	sort.Slice(mutations, func(i, j int) bool {
+		if mutations[i].Collection != mutations[j].Collection {
+			return mutations[i].Collection < mutations[j].Collection
+		}
+		return mutations[i].Key < mutations[j].Key
+	})
+	return mutations, nil
+}
+
+// ApplyMutations writes mutations received from another instance without
+// triggering the mutation hook. Mutations whose Previous hash doesn't match
+// the local record are still applied, and returned as conflicts.
+func (c Client) ApplyMutations(mutations []Mutation) ([]Mutation, error) {
+	conflicts := []Mutation{}
+	_, err := c.write(func(data []byte) ([]byte, error) {
+		colls, err := parseCollections(data)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = []Mutation{}
+		for _, mutation := range mutations {
+			current, exists := colls[mutation.Collection][mutation.Key]
+			if (exists && HashValue(current) != mutation.Previous) || (!exists && mutation.Previous != "") {
+				conflicts = append(conflicts, mutation)
+			}
+			colls.apply([]Mutation{mutation})
+		}
+		return json.Marshal(colls)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// ReplayMutations builds the contents of a database file by applying batches
+// of mutations, in order, to an empty database.
+func ReplayMutations(batches [][]Mutation) ([]byte, error) {
+	colls := collections{}
+	for _, mutations := range batches {
+		colls.apply(mutations)
+	}
+	data, err := json.Marshal(colls)
+	if err != nil {
+		return nil, err
+	}
+	db := &databaseSchema{}
+	err = json.Unmarshal(data, db)
+	if err != nil {
+		return nil, err
+	}
+	db.ensureCollections()
+	return json.Marshal(db)
+}
+
+// DiffAgainst returns the mutations that would turn the current database
+// into data. The current file isn't checked against its checksum, so a
+// corrupted database can still be restored.
+func (c Client) DiffAgainst(data []byte) ([]Mutation, error) {
+	if c.memory != nil {
+		current, err := c.memory.read()
+		if err != nil {
+			return nil, err
+		}
+		return diffCollections(current, data)
+	}
+	current, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+	return diffCollections(current, data)
+}
+
+// replace writes data over the database, which may be corrupted, and returns
+// the changed records.
+func (c Client) replace(data []byte) ([]Mutation, error) {
+	if c.transaction() == nil {
+		c.transactions.Lock()
+		defer c.transactions.Unlock()
+	}
+	c.writes.Lock()
+	defer c.writes.Unlock()
+	mutations, err := c.DiffAgainst(data)
+	if err != nil {
+		return nil, err
+	}
+	for i := range mutations {
+		mutations[i].Restored = true
+	}
+	return mutations, c.writeFile(data)
+}
+
+// Restore replaces the database with data. The changed records go through
+// the hooks like any other write, marked Restored.
+func (c Client) Restore(data []byte) ([]Mutation, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil, errors.New("not a database: want a JSON object")
+	}
+	err := json.Unmarshal(data, &databaseSchema{})
+	if err != nil {
+		return nil, fmt.Errorf("not a database: %w", err)
+	}
+	mutations, err := c.replace(data)
+	if err != nil {
+		return nil, err
+	}
+	c.mutated(mutations)
+	return mutations, nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMutationHookAndApply(t *testing.T) {
+	dir := t.TempDir()
+	mutations := []Mutation{}
+	primary := NewClient(filepath.Join(dir, "primary.json")).WithMutationHook(func(m []Mutation) {
+		mutations = append(mutations, m...)
+	})
+	replica := NewClient(filepath.Join(dir, "replica.json"))
+	for _, c := range []Client{primary, replica} {
+		err := c.EnsureDB()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	created, err := primary.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = primary.UpdateUser(created.ID, "test@example.com", "12345", "Renamed", 19)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mutations) != 2 {
+		t.Fatalf("got %d mutations, want 2", len(mutations))
+	}
+	if mutations[0].Previous != "" || mutations[1].Previous != HashValue(mutations[0].Value) {
+		t.Errorf("unexpected previous hashes: %+v", mutations)
+	}
+
+	conflicts, err := replica.ApplyMutations(mutations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("got %d conflicts, want 0", len(conflicts))
+	}
+	user, err := replica.GetUserByEmail("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Renamed" || user.Age != 19 {
+		t.Errorf("replica has %+v", user)
+	}
+
+	// applying the update again no longer matches the replica's copy
+	conflicts, err = replica.ApplyMutations(mutations[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 {
+		t.Errorf("got %d conflicts, want 1", len(conflicts))
+	}
+
+	err = primary.DeleteUser(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conflicts, err = replica.ApplyMutations(mutations[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("got %d conflicts, want 0", len(conflicts))
+	}
+	_, err = replica.GetUser(created.ID)
+	if err == nil {
+		t.Errorf("user wasn't deleted on the replica")
+	}
+}
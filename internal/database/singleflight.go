@@ -0,0 +1,64 @@
+package database
+
+import "sync"
+
+// flightGroup coalesces concurrent reads of the same key, so a burst of
+// identical requests reads the database file once. It works like
+// golang.org/x/sync/singleflight, with forget dropping every read in flight
+// once the file changes.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+	// dups counts the callers that joined instead of reading
+	dups int
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: map[string]*flight{}}
+}
+
+// do calls fn, unless a call for key is already in flight, in which case it
+// waits for that call and returns its result. Callers share the result, so
+// they must not modify it.
+func (g *flightGroup) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	if g == nil {
+		return fn()
+	}
+	g.mu.Lock()
+	if f, ok := g.flights[key]; ok {
+		f.dups++
+		g.mu.Unlock()
+		<-f.done
+		return f.value, f.err
+	}
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	f.value, f.err = fn()
+	g.mu.Lock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	g.mu.Unlock()
+	close(f.done)
+	return f.value, f.err
+}
+
+// forget makes later calls read again instead of joining reads that may
+// have started before a write. Callers already waiting still get the old
+// result, which was current when they asked.
+func (g *flightGroup) forget() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	g.flights = map[string]*flight{}
+	g.mu.Unlock()
+}
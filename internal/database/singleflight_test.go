@@ -0,0 +1,91 @@
+package database
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFlightGroupCoalesces(t *testing.T) {
+	g := newFlightGroup()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var calls int32
+	fn := func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return "value", nil
+	}
+
+	// the first call is in flight before the others join it
+	var wg sync.WaitGroup
+	results := make([]interface{}, 10)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = g.do("key", fn)
+	}()
+	<-started
+	for i := 1; i < len(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.do("key", fn)
+		}(i)
+	}
+	for joined := false; !joined; {
+		g.mu.Lock()
+		joined = g.flights["key"].dups == len(results)-1
+		g.mu.Unlock()
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("got %d calls, want 1", calls)
+	}
+	for i, result := range results {
+		if result != "value" {
+			t.Errorf("caller %d: got %v, want value", i, result)
+		}
+	}
+}
+
+func TestClientReadsAfterWrite(t *testing.T) {
+	c := NewClient(filepath.Join(t.TempDir(), "db.json"))
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.GetUser(user.ID)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, err = c.UpdateUser(user.ID, "test@example.com", "12345", "Renamed", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Renamed" {
+		t.Errorf("got name %q after the update, want Renamed", got.Name)
+	}
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/firyx/boot.dev-api-backend/internal/tracing"
+)
+
+// WithContext returns a client tracing its reads and writes of the
+// database under the span of ctx, if it has one, and writing as part of
+// the transaction of ctx, if there's one.
+func (c Client) WithContext(ctx context.Context) Client {
+	c.ctx = ctx
+	return c
+}
+
+// Context returns the context of WithContext, or context.Background() if
+// c has none.
+func (c Client) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// startSpan begins a span for a read or write of the database, tagged with
+// the Client method doing it. It returns nil when c isn't traced.
+func (c Client) startSpan(name string) *tracing.Span {
+	_, span := tracing.StartChild(c.ctx, "database."+name, tracing.KindClient)
+	if span == nil {
+		return nil
+	}
+	span.SetAttribute("db.operation", operation())
+	if c.memory != nil {
+		span.SetAttribute("db.system", "memory")
+	} else {
+		span.SetAttribute("db.system", "file")
+	}
+	return span
+}
+
+// operation returns the name of the exported Client method up the stack,
+// like "CreateUser".
+func operation() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if _, method, ok := strings.Cut(frame.Function, ".Client."); ok && method != "" && !strings.Contains(method, ".") && unicode.IsUpper(rune(method[0])) {
+			return method
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type transactionKey struct{}
+
+// transaction tracks the records written as part of a Transaction.
+type transaction struct {
+	// files identifies the database, shared by the copies of its client.
+	files *sync.RWMutex
+
+	mu      sync.Mutex
+	touched map[[2]string]bool
+	// commits run the commit hook for the writes once they're committed.
+	commits []func()
+}
+
+func (tx *transaction) touch(mutations []Mutation) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	for _, mutation := range mutations {
+		tx.touched[[2]string{mutation.Collection, mutation.Key}] = true
+	}
+}
+
+func (tx *transaction) onCommit(commit func()) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.commits = append(tx.commits, commit)
+}
+
+// Transaction runs fn as a single change to the database: when fn returns
+// an error, the records written through a client bound to the context fn
+// gets, with WithContext, are put back as they were before. Writes through
+// other clients wait for the transaction to end, so fn must not make any,
+// and the commit hook only sees the writes of fn once they're committed.
+func (c Client) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if c.transaction() != nil {
+		return errors.New("transactions can't be nested")
+	}
+	tx, err := c.runTransaction(ctx, fn)
+	if err != nil {
+		return err
+	}
+	// once other writers are let through, the hooks write too
+	for _, commit := range tx.commits {
+		commit()
+	}
+	return nil
+}
+
+// runTransaction runs fn holding back the writers outside of it, and rolls
+// back its writes when it fails.
+func (c Client) runTransaction(ctx context.Context, fn func(ctx context.Context) error) (*transaction, error) {
+	c.transactions.Lock()
+	defer c.transactions.Unlock()
+	snapshot, err := c.readFile()
+	if err != nil {
+		return nil, err
+	}
+	tx := &transaction{files: c.files, touched: map[[2]string]bool{}}
+	ctx = context.WithValue(ctx, transactionKey{}, tx)
+	err = fn(ctx)
+	if err == nil {
+		return tx, nil
+	}
+	rollbackErr := c.WithContext(ctx).rollback(tx, snapshot)
+	if rollbackErr != nil {
+		return nil, errors.Join(err, fmt.Errorf("rolling back: %w", rollbackErr))
+	}
+	return nil, err
+}
+
+// transaction returns the transaction c writes as part of, if any.
+func (c Client) transaction() *transaction {
+	if c.ctx == nil {
+		return nil
+	}
+	tx, _ := c.ctx.Value(transactionKey{}).(*transaction)
+	if tx == nil || tx.files != c.files {
+		return nil
+	}
+	return tx
+}
+
+// rollback puts the records touched by tx back as they were in snapshot.
+// The changes go through the mutation hook marked Restored, so replicas and
+// caches are rolled back too. c writes as part of tx, so the commit hook
+// never sees them.
+func (c Client) rollback(tx *transaction, snapshot []byte) error {
+	before, err := parseCollections(snapshot)
+	if err != nil {
+		return err
+	}
+	mutations := []Mutation{}
+	_, err = c.write(func(data []byte) ([]byte, error) {
+		colls, err := parseCollections(data)
+		if err != nil {
+			return nil, err
+		}
+		tx.mu.Lock()
+		for record := range tx.touched {
+			current, exists := colls[record[0]][record[1]]
+			previous := before[record[0]][record[1]]
+			if bytes.Equal(current, previous) {
+				continue
+			}
+			mutation := Mutation{Collection: record[0], Key: record[1], Value: previous, Restored: true}
+			if exists {
+				mutation.Previous = HashValue(current)
+			}
+			mutations = append(mutations, mutation)
+		}
+		tx.mu.Unlock()
+		if len(mutations) == 0 {
+			return data, nil
+		}
+		sort.Slice(mutations, func(i, j int) bool {
+			if mutations[i].Collection != mutations[j].Collection {
+				return mutations[i].Collection < mutations[j].Collection
+			}
+			return mutations[i].Key < mutations[j].Key
+		})
+		colls.apply(mutations)
+		return json.Marshal(colls)
+	})
+	if err != nil {
+		return err
+	}
+	c.mutated(mutations)
+	return nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransaction(t *testing.T) {
+	for _, backend := range []string{"file", "memory"} {
+		t.Run(backend, func(t *testing.T) {
+			c := NewMemoryClient()
+			if backend == "file" {
+				c = NewClient(filepath.Join(t.TempDir(), "db.json"))
+				err := c.EnsureDB()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			mutations := []Mutation{}
+			c = c.WithMutationHook(func(m []Mutation) {
+				mutations = append(mutations, m...)
+			})
+			committed := []Mutation{}
+			c = c.WithCommitHook(func(m []Mutation) {
+				committed = append(committed, m...)
+			})
+			user, err := c.CreateUser("ann@example.com", "12345", "Ann", 18)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// committed
+			err = c.Transaction(context.Background(), func(ctx context.Context) error {
+				_, err := c.WithContext(ctx).UpdateUser(user.ID, user.Email, user.Password, "Ann B", 19)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(committed) != 2 || committed[1].Key != user.ID {
+				t.Errorf("got committed %+v, want the user created and updated", committed)
+			}
+
+			// rolled back, keeping the write made outside of it, which waits
+			// for the transaction to end
+			errFailed := errors.New("failed")
+			var other User
+			otherErr := make(chan error, 1)
+			err = c.Transaction(context.Background(), func(ctx context.Context) error {
+				tx := c.WithContext(ctx)
+				_, err := tx.UpdateUser(user.ID, user.Email, user.Password, "Ann C", 20)
+				if err != nil {
+					return err
+				}
+				_, err = tx.CreatePost(user.ID, "hello", nil)
+				if err != nil {
+					return err
+				}
+				go func() {
+					var err error
+					other, err = c.CreateUser("bob@example.com", "12345", "Bob", 30)
+					otherErr <- err
+				}()
+				select {
+				case err := <-otherErr:
+					t.Errorf("write outside of the transaction didn't wait for it: %v", err)
+				case <-time.After(50 * time.Millisecond):
+				}
+				return errFailed
+			})
+			if !errors.Is(err, errFailed) {
+				t.Fatalf("got %v, want the error of the transaction", err)
+			}
+			err = <-otherErr
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.GetUser(user.ID)
+			if err != nil || got.Name != "Ann B" || got.Age != 19 {
+				t.Errorf("got %+v, %v, want the committed update", got, err)
+			}
+			posts, err := c.GetPosts(user.ID)
+			if err != nil || len(posts) != 0 {
+				t.Errorf("got posts %+v, %v, want the post rolled back", posts, err)
+			}
+			_, err = c.GetUser(other.ID)
+			if err != nil {
+				t.Errorf("user created outside of the transaction: %v", err)
+			}
+			// the rollback went through the mutation hook before the other
+			// write: the post was deleted again
+			last := mutations[len(mutations)-3 : len(mutations)-1]
+			if last[0].Collection != "posts" || last[0].Value != nil || last[1].Collection != "users" || last[1].Key != user.ID || !last[0].Restored || !last[1].Restored {
+				t.Errorf("got mutations %+v, want the post and user restored", last)
+			}
+			// the commit hook only saw the other write
+			if len(committed) != 3 || committed[2].Key != other.ID {
+				t.Errorf("got committed %+v, want the rolled back writes left out", committed)
+			}
+
+			err = c.Transaction(context.Background(), func(ctx context.Context) error {
+				return c.WithContext(ctx).Transaction(ctx, func(context.Context) error { return nil })
+			})
+			if err == nil {
+				t.Error("expected an error for a nested transaction")
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// walEntry is a line of the write-ahead log. A write is logged with its
+// mutations before the database file changes, and logged again with Commit
+// set once the file and its checksum are written. A checkpoint holds every
+// record of the database, and replaces the entries before it.
+type walEntry struct {
+	Seq        int64      `json:"seq"`
+	Time       time.Time  `json:"time,omitempty"`
+	Mutations  []Mutation `json:"mutations,omitempty"`
+	Commit     bool       `json:"commit,omitempty"`
+	Checkpoint bool       `json:"checkpoint,omitempty"`
+}
+
+// walCheckpointSize is how much the write-ahead log grows past its last
+// checkpoint before it's checkpointed again.
+const walCheckpointSize = 8 << 20
+
+// writeAheadLog is an append-only file of walEntry lines.
+type writeAheadLog struct {
+	path string
+	// limit is how many bytes may follow the checkpoint, see
+	// walCheckpointSize.
+	limit int64
+
+	mu   sync.Mutex
+	last int64
+	// size is the size of the log and base the size of its checkpoint.
+	size int64
+	base int64
+}
+
+// WithWAL returns a copy of the client that logs every write to a
+// write-ahead log at path before applying it. Call RecoverWAL before
+// serving to finish writes interrupted by a crash. The log is checkpointed
+// as it grows, so it keeps the history of the database since the last
+// checkpoint only.
+func (c Client) WithWAL(path string) Client {
+	c.wal = &writeAheadLog{path: path, limit: walCheckpointSize}
+	return c
+}
+
+// WALPath returns the path of the write-ahead log, or "" without one.
+func (c Client) WALPath() string {
+	if c.wal == nil {
+		return ""
+	}
+	return c.wal.path
+}
+
+// append adds entry to the log, synced to disk if sync is set.
+func (l *writeAheadLog) append(entry walEntry, sync bool) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	n, err := file.Write(append(data, '\n'))
+	l.size += int64(n)
+	if err == nil && sync {
+		err = file.Sync()
+	}
+	return errors.Join(err, file.Close())
+}
+
+// begin logs mutations that are about to be written and returns their
+// sequence number.
+func (l *writeAheadLog) begin(mutations []Mutation) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := walEntry{Seq: l.last + 1, Time: time.Now().UTC(), Mutations: mutations}
+	err := l.append(entry, true)
+	if err != nil {
+		return 0, err
+	}
+	l.last = entry.Seq
+	return entry.Seq, nil
+}
+
+// commit logs that the write with sequence number seq is in the database
+// file. It isn't synced: if it's lost in a crash, recovery applies the write
+// again, which is harmless.
+func (l *writeAheadLog) commit(seq int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.append(walEntry{Seq: seq, Commit: true}, false)
+}
+
+// checkpoint replaces the log with a single entry holding every record of
+// data, the contents of the database file, once the log has grown past its
+// limit. Every logged write must be committed.
+func (l *writeAheadLog) checkpoint(data []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size-l.base <= l.limit {
+		return nil
+	}
+	mutations, err := diffCollections(nil, data)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(walEntry{Seq: l.last, Time: time.Now().UTC(), Mutations: mutations, Checkpoint: true})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	err = writeFileAtomic(l.path, line)
+	if err != nil {
+		return err
+	}
+	l.size = int64(len(line))
+	l.base = l.size
+	return nil
+}
+
+// scan calls fn with every complete entry and returns the size of the log
+// up to the end of the last one. Anything after that is a line still being
+// appended, or torn by a crash.
+func (l *writeAheadLog) scan(fn func(walEntry)) (int64, error) {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var size int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		entry := walEntry{}
+		err = json.Unmarshal(line, &entry)
+		if err != nil {
+			return 0, err
+		}
+		size += int64(len(line))
+		fn(entry)
+	}
+}
+
+func truncateAfter(path string, size int64) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil || info.Size() == size {
+		return err
+	}
+	return os.Truncate(path, size)
+}
+
+// RecoverWAL applies the logged writes that never committed, in order, and
+// returns how many there were. The database file may or may not contain
+// them, setting the same records again is harmless.
+func (c Client) RecoverWAL() (int, error) {
+	if c.wal == nil {
+		return 0, nil
+	}
+	pending := []walEntry{}
+	committed := map[int64]bool{}
+	size, err := c.wal.scan(func(entry walEntry) {
+		switch {
+		case entry.Checkpoint:
+			// the records of a checkpoint are in the database file already
+			c.wal.last = entry.Seq
+		case entry.Commit:
+			committed[entry.Seq] = true
+		default:
+			pending = append(pending, entry)
+			c.wal.last = entry.Seq
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	// a torn line was never applied, cut it off so appends start on a new line
+	err = truncateAfter(c.wal.path, size)
+	if err != nil {
+		return 0, err
+	}
+	c.wal.size = size
+	recovered := 0
+	for _, entry := range pending {
+		if committed[entry.Seq] {
+			continue
+		}
+		// the file may be torn between writes, so it isn't verified
+		data, err := os.ReadFile(c.path)
+		if err != nil {
+			return recovered, err
+		}
+		colls, err := parseCollections(data)
+		if err != nil {
+			return recovered, err
+		}
+		colls.apply(entry.Mutations)
+		data, err = json.Marshal(colls)
+		if err != nil {
+			return recovered, err
+		}
+		err = c.replaceFile(data)
+		if err != nil {
+			return recovered, err
+		}
+		err = c.wal.commit(entry.Seq)
+		if err != nil {
+			return recovered, err
+		}
+		recovered++
+	}
+	return recovered, nil
+}
+
+// ReplayWAL rebuilds the database as it was at time t from the writes logged
+// up to then, starting from the last checkpoint. Like the replication
+// journal, it is only accurate if the log covers the database's whole
+// history since the checkpoint, and times before the checkpoint can't be
+// rebuilt.
+func (c Client) ReplayWAL(t time.Time) ([]byte, error) {
+	if c.wal == nil {
+		return nil, errors.New("no write-ahead log configured")
+	}
+	batches := [][]Mutation{}
+	var start time.Time
+	_, err := c.wal.scan(func(entry walEntry) {
+		switch {
+		case entry.Checkpoint:
+			start = entry.Time
+			batches = [][]Mutation{entry.Mutations}
+		case !entry.Commit && !entry.Time.After(t):
+			batches = append(batches, entry.Mutations)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t.Before(start) {
+		return nil, fmt.Errorf("the write-ahead log only goes back to %s", start.Format(time.RFC3339))
+	}
+	return ReplayMutations(batches)
+}
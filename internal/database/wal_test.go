@@ -0,0 +1,138 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWALRecover(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db.json")
+	c := NewClient(path).WithWAL(path + ".wal")
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := c.CreateUser("kept@example.com", "12345", "Kept", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// crash after logging a write but before applying it, and while logging
+	// the next one
+	lost := User{ID: "5d1b5a7e-7d4f-4c1a-9f7e-2b2f0c6f6a11", Email: "lost@example.com", Name: "Lost"}
+	value, err := json.Marshal(lost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.wal.begin([]Mutation{{Collection: "users", Key: lost.ID, Value: value}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path+".wal", os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteString(`{"seq":3,"mutat`)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewClient(path).WithWAL(path + ".wal")
+	recovered, err := restarted.RecoverWAL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered != 1 {
+		t.Errorf("got %d recovered writes, want 1", recovered)
+	}
+	for _, id := range []string{kept.ID, lost.ID} {
+		_, err = restarted.GetUser(id)
+		if err != nil {
+			t.Errorf("user %s: %v", id, err)
+		}
+	}
+	if integrity := restarted.Integrity(); !integrity.OK {
+		t.Errorf("got integrity error %s after recovery", integrity.Error)
+	}
+
+	// the log is usable again and replays to the current database
+	_, err = restarted.CreateUser("after@example.com", "12345", "After", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered, err = NewClient(path).WithWAL(path + ".wal").RecoverWAL()
+	if err != nil || recovered != 0 {
+		t.Errorf("got %d recovered writes and error %v on a clean log, want 0 and none", recovered, err)
+	}
+	replayed, err := restarted.ReplayWAL(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	drift, err := restarted.DiffAgainst(replayed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift) != 0 {
+		t.Errorf("got %d records differing between the replayed log and the database, want 0", len(drift))
+	}
+}
+
+func TestWALCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	c := NewClient(path).WithWAL(path + ".wal")
+	c.wal.limit = 4 << 10
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.CreateUser("a@example.com", "12345", "A", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	var largest int64
+	for i := 0; i < 200; i++ {
+		_, err = c.UpdateUserSettings(user.ID, UserSettings{Timezone: fmt.Sprintf("Etc/GMT+%d", i%12)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path + ".wal")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > largest {
+			largest = info.Size()
+		}
+	}
+	// a checkpoint plus the limit plus the entries of one write
+	if largest > 8<<10 {
+		t.Errorf("got a write-ahead log of %d bytes, want it checkpointed at 4 KiB", largest)
+	}
+
+	// the log still replays to the current database, but no longer covers the
+	// first writes
+	replayed, err := c.ReplayWAL(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	drift, err := c.DiffAgainst(replayed)
+	if err != nil || len(drift) != 0 {
+		t.Errorf("got %d records differing between the replayed log and the database, and error %v", len(drift), err)
+	}
+	_, err = c.ReplayWAL(before)
+	if err == nil {
+		t.Error("got no error replaying to before the checkpoint")
+	}
+
+	// a checkpoint is nothing to recover
+	recovered, err := NewClient(path).WithWAL(path + ".wal").RecoverWAL()
+	if err != nil || recovered != 0 {
+		t.Errorf("got %d recovered writes and error %v after a checkpoint, want 0 and none", recovered, err)
+	}
+}
@@ -0,0 +1,49 @@
+package errreport
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+type Level string
+
+const (
+	LevelError Level = "error"
+	LevelFatal Level = "fatal"
+)
+
+// Event is a single error occurrence with the context it happened in.
+type Event struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	// Stack is the goroutine stack trace for panics, empty otherwise.
+	Stack   string
+	Release string
+	UserID  string
+	Request *http.Request
+	Tags    map[string]string
+}
+
+// Reporter sends events to an error tracking backend. Implementations must be
+// safe for concurrent use and must not block the caller for long.
+type Reporter interface {
+	Report(ctx context.Context, event Event)
+}
+
+// LogReporter writes events to the standard logger. It is the default when
+// no error tracking backend is configured.
+type LogReporter struct{}
+
+func (LogReporter) Report(ctx context.Context, event Event) {
+	path := ""
+	if event.Request != nil {
+		path = event.Request.Method + " " + event.Request.URL.Path
+	}
+	log.Printf("%s: %s [%s] release=%s user=%s tags=%v", event.Level, event.Message, path, event.Release, event.UserID, event.Tags)
+	if event.Stack != "" {
+		log.Print(event.Stack)
+	}
+}
@@ -0,0 +1,154 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SentryReporter sends events to Sentry's store API. Events are delivered in
+// the background so reporting never slows down the request being handled.
+type SentryReporter struct {
+	storeURL    string
+	auth        string
+	environment string
+	client      *http.Client
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       Level             `json:"level"`
+	Platform    string            `json:"platform"`
+	Message     string            `json:"message"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	User        *sentryUser       `json:"user,omitempty"`
+	Request     *sentryRequest    `json:"request,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+	Exception   *sentryExceptions `json:"exception,omitempty"`
+}
+
+type sentryUser struct {
+	ID string `json:"id"`
+}
+
+type sentryRequest struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Query   string            `json:"query_string,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// NewSentryReporter parses a DSN of the form
+// https://<public key>@<host>/<project id>.
+func NewSentryReporter(dsn, environment string) (*SentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, errors.New("sentry dsn is missing the public key")
+	}
+	projectID := strings.Trim(u.Path, "/")
+	if projectID == "" {
+		return nil, errors.New("sentry dsn is missing the project id")
+	}
+	return &SentryReporter{
+		storeURL:    fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, projectID),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=boot.dev-api-backend/1.0, sentry_key=%s", u.User.Username()),
+		environment: environment,
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+func (s *SentryReporter) Report(ctx context.Context, event Event) {
+	payload := s.newEvent(event)
+	go func() {
+		err := s.send(payload)
+		if err != nil {
+			log.Printf("sentry: %v", err)
+		}
+	}()
+}
+
+func (s *SentryReporter) newEvent(event Event) sentryEvent {
+	id := make([]byte, 16)
+	rand.Read(id)
+	payload := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   event.Time.UTC().Format(time.RFC3339),
+		Level:       event.Level,
+		Platform:    "go",
+		Message:     event.Message,
+		Release:     event.Release,
+		Environment: s.environment,
+		Tags:        event.Tags,
+		Exception: &sentryExceptions{Values: []sentryException{{
+			Type:  string(event.Level),
+			Value: event.Message,
+		}}},
+	}
+	if event.UserID != "" {
+		payload.User = &sentryUser{ID: event.UserID}
+	}
+	if event.Stack != "" {
+		payload.Extra = map[string]string{"stack": event.Stack}
+	}
+	if r := event.Request; r != nil {
+		headers := map[string]string{}
+		for _, key := range []string{"User-Agent", "Content-Type", "X-Request-Id"} {
+			if v := r.Header.Get(key); v != "" {
+				headers[key] = v
+			}
+		}
+		payload.Request = &sentryRequest{
+			URL:     "http://" + r.Host + r.URL.Path,
+			Method:  r.Method,
+			Query:   r.URL.RawQuery,
+			Headers: headers,
+		}
+	}
+	return payload
+}
+
+func (s *SentryReporter) send(payload sentryEvent) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.storeURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
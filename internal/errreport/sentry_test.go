@@ -0,0 +1,78 @@
+package errreport
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSentryReporter(t *testing.T) {
+	var tests = []struct {
+		dsn      string
+		storeURL string
+		hasErr   bool
+	}{
+		{
+			dsn:      "https://abc123@o1.ingest.sentry.io/42",
+			storeURL: "https://o1.ingest.sentry.io/api/42/store/",
+		},
+		{
+			dsn:    "https://o1.ingest.sentry.io/42",
+			hasErr: true,
+		},
+		{
+			dsn:    "https://abc123@o1.ingest.sentry.io/",
+			hasErr: true,
+		},
+	}
+	for _, tt := range tests {
+		s, err := NewSentryReporter(tt.dsn, "test")
+		if (err != nil) != tt.hasErr {
+			t.Errorf("%s: got error %v, want error: %v", tt.dsn, err, tt.hasErr)
+			continue
+		}
+		if err == nil && s.storeURL != tt.storeURL {
+			t.Errorf("got %s, want %s", s.storeURL, tt.storeURL)
+		}
+	}
+}
+
+func TestSentryReporterSend(t *testing.T) {
+	received := make(chan sentryEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("X-Sentry-Auth"), "sentry_key=abc123") {
+			t.Errorf("missing sentry key in %q", r.Header.Get("X-Sentry-Auth"))
+		}
+		event := sentryEvent{}
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer srv.Close()
+
+	dsn := strings.Replace(srv.URL, "http://", "http://abc123@", 1) + "/7"
+	s, err := NewSentryReporter(dsn, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/users/test@example.com", nil)
+	s.Report(req.Context(), Event{
+		Time:    time.Now(),
+		Level:   LevelError,
+		Message: "boom",
+		Release: "v1.2.3",
+		UserID:  "test@example.com",
+		Request: req,
+	})
+
+	select {
+	case event := <-received:
+		if event.Message != "boom" || event.Release != "v1.2.3" || event.User == nil || event.User.ID != "test@example.com" {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not delivered")
+	}
+}
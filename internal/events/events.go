@@ -0,0 +1,60 @@
+// Package events is an in-process publish/subscribe bus, so features can
+// react to what happens elsewhere without the code doing it knowing about
+// them.
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type Event struct {
+	Type string
+	Time time.Time
+	// Data is the record the event is about, its type depends on Type.
+	Data interface{}
+}
+
+type Handler func(Event)
+
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: map[string][]Handler{}}
+}
+
+// Subscribe calls fn with every event of the given type published from now
+// on.
+func (b *Bus) Subscribe(eventType string, fn Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], fn)
+}
+
+// Publish calls the handlers subscribed to the event's type in the order
+// they subscribed, before returning. Handlers may publish events
+// themselves. A panicking handler is logged and doesn't stop the others.
+func (b *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	b.mu.RLock()
+	handlers := b.handlers[event.Type]
+	b.mu.RUnlock()
+	for _, fn := range handlers {
+		call(fn, event)
+	}
+}
+
+func call(fn Handler, event Event) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("events: %s handler panicked: %v", event.Type, v)
+		}
+	}()
+	fn(event)
+}
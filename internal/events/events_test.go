@@ -0,0 +1,34 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBusPublish(t *testing.T) {
+	bus := NewBus()
+	got := []string{}
+	bus.Subscribe("post.created", func(e Event) {
+		got = append(got, "first "+e.Data.(string))
+		bus.Publish(Event{Type: "badge.awarded", Data: "badge"})
+	})
+	bus.Subscribe("post.created", func(e Event) {
+		panic("broken handler")
+	})
+	bus.Subscribe("post.created", func(e Event) {
+		got = append(got, "third "+e.Data.(string))
+	})
+	bus.Subscribe("badge.awarded", func(e Event) {
+		if e.Time.IsZero() {
+			t.Error("event has no time")
+		}
+		got = append(got, "awarded "+e.Data.(string))
+	})
+
+	bus.Publish(Event{Type: "post.created", Data: "post"})
+	bus.Publish(Event{Type: "post.deleted", Data: "post"})
+	expected := []string{"first post", "awarded badge", "third post"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
@@ -0,0 +1,289 @@
+// Package fixtures describes API behaviors declaratively: YAML files list
+// requests with the status and JSON body expected back, the body either
+// inline or in a golden file. Expected bodies may use matchers for values
+// that change from run to run, like IDs and timestamps.
+package fixtures
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Case is one request and what's expected of its response.
+type Case struct {
+	Name string `json:"name"`
+	// Admin sends the request to the admin listener.
+	Admin   bool    `json:"admin"`
+	Request Request `json:"request"`
+	Expect  Expect  `json:"expect"`
+	// Save maps a variable name to a top level field of the response, for
+	// later cases to use as {name}.
+	Save map[string]string `json:"save"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Token is sent as a bearer token when set.
+	Token   string            `json:"token"`
+	Headers map[string]string `json:"headers"`
+	// Body is sent as is when it's a string, and as JSON otherwise.
+	Body interface{} `json:"body"`
+}
+
+type Expect struct {
+	Status int `json:"status"`
+	// Body must match the response, which may have fields it doesn't list.
+	Body interface{} `json:"body"`
+	// Golden names a file the whole response must match, relative to the
+	// golden directory.
+	Golden string `json:"golden"`
+}
+
+// File is a fixture file, its cases run in order against the same server.
+type File struct {
+	Path  string
+	Cases []Case
+}
+
+// Load reads the fixture files matching pattern, in name order.
+func Load(pattern string) ([]File, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	files := []File{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		cases, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		files = append(files, File{Path: path, Cases: cases})
+	}
+	return files, nil
+}
+
+// Parse reads the list of cases of a fixture file.
+func Parse(data []byte) ([]Case, error) {
+	value, err := ParseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := value.([]interface{}); !ok {
+		return nil, fmt.Errorf("want a list of cases")
+	}
+	// the cases are decoded like JSON, so unknown fields are typos
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(encoded)))
+	decoder.DisallowUnknownFields()
+	cases := []Case{}
+	err = decoder.Decode(&cases)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range cases {
+		switch {
+		case c.Name == "":
+			return nil, fmt.Errorf("case %d has no name", i+1)
+		case c.Request.Method == "" || c.Request.Path == "":
+			return nil, fmt.Errorf("%s: request needs a method and a path", c.Name)
+		case c.Expect.Status == 0:
+			return nil, fmt.Errorf("%s: expect needs a status", c.Name)
+		}
+	}
+	return cases, nil
+}
+
+// Matchers stand for values that change from run to run.
+const (
+	MatchAny    = "$any"
+	MatchString = "$string"
+	MatchNumber = "$number"
+	MatchBool   = "$bool"
+	MatchUUID   = "$uuid"
+	MatchTime   = "$time"
+	// MatchToken is any non-empty opaque string, like a session token.
+	MatchToken = "$token"
+	// MatchHash is a salted password hash, like "$2a$10$...".
+	MatchHash = "$hash"
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	jwtPattern  = regexp.MustCompile(`^[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+$`)
+	hashPattern = regexp.MustCompile(`^\$[a-z0-9-]+\$[^$]*\$.+`)
+)
+
+// Match compares a response body to what's expected of it, returning a
+// description of each mismatch. Objects must have the same fields, unless
+// partial is set: then the response may have more.
+func Match(expected, actual interface{}, partial bool) []string {
+	m := matcher{partial: partial}
+	m.match("$", expected, actual)
+	return m.mismatches
+}
+
+type matcher struct {
+	partial    bool
+	mismatches []string
+}
+
+func (m *matcher) fail(path, format string, args ...interface{}) {
+	m.mismatches = append(m.mismatches, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (m *matcher) match(path string, expected, actual interface{}) {
+	switch want := expected.(type) {
+	case string:
+		m.matchString(path, want, actual)
+	case map[string]interface{}:
+		got, ok := actual.(map[string]interface{})
+		if !ok {
+			m.fail(path, "got %s, want an object", describe(actual))
+			return
+		}
+		for _, key := range sortedKeys(want) {
+			value, ok := got[key]
+			if !ok {
+				m.fail(path+"."+key, "missing")
+				continue
+			}
+			m.match(path+"."+key, want[key], value)
+		}
+		if m.partial {
+			return
+		}
+		for _, key := range sortedKeys(got) {
+			if _, ok := want[key]; !ok {
+				m.fail(path+"."+key, "unexpected field")
+			}
+		}
+	case []interface{}:
+		got, ok := actual.([]interface{})
+		if !ok {
+			m.fail(path, "got %s, want an array", describe(actual))
+			return
+		}
+		if len(got) != len(want) {
+			m.fail(path, "got %d items, want %d", len(got), len(want))
+			return
+		}
+		for i := range want {
+			m.match(fmt.Sprintf("%s[%d]", path, i), want[i], got[i])
+		}
+	default:
+		if expected != actual {
+			m.fail(path, "got %s, want %s", describe(actual), describe(expected))
+		}
+	}
+}
+
+func (m *matcher) matchString(path, want string, actual interface{}) {
+	s, isString := actual.(string)
+	var ok bool
+	switch want {
+	case MatchAny:
+		ok = actual != nil
+	case MatchString:
+		ok = isString
+	case MatchNumber:
+		_, ok = actual.(float64)
+	case MatchBool:
+		_, ok = actual.(bool)
+	case MatchUUID:
+		ok = isString && uuidPattern.MatchString(s)
+	case MatchTime:
+		_, err := time.Parse(time.RFC3339Nano, s)
+		ok = isString && err == nil
+	case MatchToken:
+		ok = isString && s != ""
+	case MatchHash:
+		ok = isString && hashPattern.MatchString(s)
+	default:
+		if strings.HasPrefix(want, "$") && !strings.HasPrefix(want, "$$") {
+			m.fail(path, "unknown matcher %s", want)
+			return
+		}
+		// "$$" escapes a string starting with "$"
+		if strings.HasPrefix(want, "$$") {
+			want = want[1:]
+		}
+		if !isString || s != want {
+			m.fail(path, "got %s, want %s", describe(actual), describe(want))
+		}
+		return
+	}
+	if !ok {
+		m.fail(path, "got %s, want %s", describe(actual), want)
+	}
+}
+
+// Redact replaces the values of a response that change from run to run
+// with matchers, for it to be saved as a golden file.
+func Redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := map[string]interface{}{}
+		for key, field := range v {
+			redacted[key] = Redact(field)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = Redact(item)
+		}
+		return redacted
+	case string:
+		if uuidPattern.MatchString(v) {
+			return MatchUUID
+		}
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return MatchTime
+		}
+		if jwtPattern.MatchString(v) {
+			return MatchToken
+		}
+		if hashPattern.MatchString(v) {
+			return MatchHash
+		}
+		if strings.HasPrefix(v, "$") {
+			return "$" + v
+		}
+	}
+	return value
+}
+
+func describe(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	if len(data) > 80 {
+		return string(data[:77]) + "..."
+	}
+	return string(data)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,98 @@
+package fixtures
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases, err := Parse([]byte(`
+- name: create user
+  request:
+    method: POST
+    path: /v1/users
+    body:
+      email: ann@example.com
+      age: 18
+  expect:
+    status: 201
+    body:
+      id: $uuid
+  save:
+    user: id
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 1 || cases[0].Expect.Status != 201 || cases[0].Save["user"] != "id" {
+		t.Errorf("got %+v", cases)
+	}
+
+	for _, yaml := range []string{
+		"name: not a list\n",
+		"- request: {\"method\": \"GET\", \"path\": \"/\"}\n  expect: {\"status\": 200}\n",
+		"- name: no status\n  request: {\"method\": \"GET\", \"path\": \"/\"}\n",
+		"- name: typo\n  request: {\"method\": \"GET\", \"path\": \"/\"}\n  expect: {\"status\": 200}\n  sav: {}\n",
+	} {
+		_, err := Parse([]byte(yaml))
+		if err == nil {
+			t.Errorf("%q: expected an error", yaml)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	actual := map[string]interface{}{}
+	err := json.Unmarshal([]byte(`{
+		"id": "0b4a1d6e-8c1f-4f5e-9a57-5f1a8d0f6b2c",
+		"createdAt": "2024-01-01T00:00:00.123Z",
+		"name": "Ann",
+		"price": "$5",
+		"age": 18,
+		"tags": ["go"],
+		"token": "eyJhbGciOi.eyJzdWIiOi.c2lnbmF0dXJl",
+		"password": "$2a$10$ZjyjqepVF5dvOKRe/WZ.f.tbT.ArsOSYkxbq.8GVB/2XlC3Fk1aNi"
+	}`), &actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name       string
+		expected   string
+		partial    bool
+		mismatches []string
+	}{
+		{name: "matchers", expected: `{"id": "$uuid", "createdAt": "$time", "name": "$string", "price": "$$5", "age": "$number", "tags": ["go"], "token": "$token", "password": "$hash"}`},
+		{name: "partial", expected: `{"name": "Ann"}`, partial: true},
+		{name: "unexpected fields", expected: `{"name": "Ann", "age": 18, "tags": "$any", "id": "$any", "createdAt": "$any", "price": "$any", "password": "$any"}`, mismatches: []string{"$.token: unexpected field"}},
+		{name: "wrong values", expected: `{"name": "Bob", "age": "$bool", "tags": [], "nope": 1}`, partial: true, mismatches: []string{
+			`$.age: got 18, want $bool`,
+			`$.name: got "Ann", want "Bob"`,
+			`$.nope: missing`,
+			`$.tags: got 1 items, want 0`,
+		}},
+		{name: "unknown matcher", expected: `{"name": "$name"}`, partial: true, mismatches: []string{"$.name: unknown matcher $name"}},
+	}
+	for _, tt := range tests {
+		var expected interface{}
+		err := json.Unmarshal([]byte(tt.expected), &expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Match(expected, actual, tt.partial)
+		if strings.Join(got, "\n") != strings.Join(tt.mismatches, "\n") {
+			t.Errorf("%s: got mismatches %q, want %q", tt.name, got, tt.mismatches)
+		}
+	}
+
+	// a redacted response matches itself and keeps the values that don't change
+	redacted := Redact(actual).(map[string]interface{})
+	if mismatches := Match(redacted, actual, false); len(mismatches) > 0 {
+		t.Errorf("redacted response doesn't match: %q", mismatches)
+	}
+	if redacted["id"] != MatchUUID || redacted["createdAt"] != MatchTime || redacted["token"] != MatchToken || redacted["password"] != MatchHash || redacted["name"] != "Ann" || redacted["price"] != "$$5" {
+		t.Errorf("got redacted %v", redacted)
+	}
+}
@@ -0,0 +1,306 @@
+package fixtures
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseYAML parses the subset of YAML fixtures are written in: block
+// mappings and sequences indented with spaces, plain, quoted and literal
+// ("|") scalars, and flow collections written as JSON on a single line.
+// Mappings become map[string]interface{} and numbers float64, like
+// encoding/json does.
+func ParseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for i, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimRight(text, " \r")
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	p.skip()
+	if p.pos < len(p.lines) && p.lines[p.pos].text == "---" {
+		p.pos++
+		p.skip()
+	}
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	value, err := p.node(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skip()
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return value, nil
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// skip moves past blank and comment lines.
+func (p *yamlParser) skip() {
+	for p.pos < len(p.lines) && (p.lines[p.pos].text == "" || strings.HasPrefix(p.lines[p.pos].text, "#")) {
+		p.pos++
+	}
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// node parses the mapping or sequence starting at the current line.
+func (p *yamlParser) node(indent int) (interface{}, error) {
+	if isSeqItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	items := []interface{}{}
+	for p.skip(); p.pos < len(p.lines); p.skip() {
+		line := p.lines[p.pos]
+		if line.indent < indent || (line.indent == indent && !isSeqItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+		content := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if content == "" {
+			p.pos++
+			item, err := p.nested(indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		if _, _, ok := splitKey(content); ok || isSeqItem(content) {
+			// the item is a block starting on the same line as the "-"
+			p.lines[p.pos] = yamlLine{num: line.num, indent: line.indent + len(line.text) - len(content), text: content}
+			item, err := p.node(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		p.pos++
+		item, err := scalar(content, line.num)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := map[string]interface{}{}
+	for p.skip(); p.pos < len(p.lines); p.skip() {
+		line := p.lines[p.pos]
+		if line.indent < indent || (line.indent == indent && isSeqItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+		key, rest, ok := splitKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", line.num)
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		p.pos++
+		var value interface{}
+		var err error
+		switch rest {
+		case "":
+			value, err = p.nested(indent)
+		case "|", "|-":
+			value = p.literal(indent, rest == "|")
+		default:
+			value, err = scalar(rest, line.num)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// nested parses the block under a key or "-" with nothing after it, which
+// is null when there's none. A sequence may sit at the key's indentation.
+func (p *yamlParser) nested(indent int) (interface{}, error) {
+	p.skip()
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent || (next.indent == indent && isSeqItem(next.text)) {
+		return p.node(next.indent)
+	}
+	return nil, nil
+}
+
+// literal reads the lines of a "|" block scalar, keeping their newlines and
+// the indentation past the first line's.
+func (p *yamlParser) literal(indent int, keepNewline bool) string {
+	lines := []string{}
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if line.text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if line.indent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		if line.indent < blockIndent {
+			break
+		}
+		lines = append(lines, strings.Repeat(" ", line.indent-blockIndent)+line.text)
+	}
+	// trailing blank lines belong to whatever comes next
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		p.pos--
+	}
+	text := strings.Join(lines, "\n")
+	if keepNewline {
+		text += "\n"
+	}
+	return text
+}
+
+// splitKey splits a "key: value" line, the key possibly quoted.
+func splitKey(text string) (string, string, bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, `'`) {
+		end := closingQuote(text)
+		if end < 0 {
+			return "", "", false
+		}
+		key, err := unquote(text[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		rest := text[end+1:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(stripComment(rest[1:])), true
+	}
+	if strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") || strings.HasPrefix(text, "#") {
+		return "", "", false
+	}
+	if strings.HasSuffix(text, ":") && !strings.Contains(text, ": ") {
+		return text[:len(text)-1], "", true
+	}
+	key, rest, ok := strings.Cut(text, ": ")
+	if !ok || key == "" {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(stripComment(rest)), true
+}
+
+// closingQuote returns the index of the quote closing the string text
+// starts with, or -1.
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripComment removes a " #" comment following a plain value. Quoted
+// values and flow collections may contain "#" themselves.
+func stripComment(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return text
+	}
+	switch text[0] {
+	case '"', '\'':
+		if end := closingQuote(text); end >= 0 {
+			return text[:end+1]
+		}
+		return text
+	case '{', '[':
+		return text
+	}
+	if i := strings.Index(text, " #"); i >= 0 {
+		return strings.TrimSpace(text[:i])
+	}
+	return text
+}
+
+func unquote(text string) (string, error) {
+	if strings.HasPrefix(text, "'") {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	return strconv.Unquote(text)
+}
+
+func scalar(text string, num int) (interface{}, error) {
+	text = stripComment(text)
+	switch {
+	case text == "" || text == "~" || text == "null":
+		return nil, nil
+	case text == "true":
+		return true, nil
+	case text == "false":
+		return false, nil
+	case text[0] == '"' || text[0] == '\'':
+		if closingQuote(text) != len(text)-1 {
+			return nil, fmt.Errorf("line %d: unterminated string", num)
+		}
+		s, err := unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", num, err)
+		}
+		return s, nil
+	case text[0] == '{' || text[0] == '[':
+		var value interface{}
+		err := json.Unmarshal([]byte(text), &value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: flow collections must be JSON: %w", num, err)
+		}
+		return value, nil
+	}
+	if strings.ContainsRune("+-.0123456789", rune(text[0])) {
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f, nil
+		}
+	}
+	return text, nil
+}
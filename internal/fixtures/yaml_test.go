@@ -0,0 +1,63 @@
+package fixtures
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	var tests = []struct {
+		name string
+		yaml string
+		want interface{}
+	}{
+		{name: "empty", yaml: "# nothing\n", want: nil},
+		{name: "scalars", yaml: "a: text # comment\nb: 12\nc: true\nd: null\ne: \"quoted # not a comment\"\nf: 'it''s'\ng: /v1/users?q=a:b\n", want: map[string]interface{}{
+			"a": "text", "b": 12.0, "c": true, "d": nil, "e": "quoted # not a comment", "f": "it's", "g": "/v1/users?q=a:b",
+		}},
+		{name: "nested", yaml: "---\nrequest:\n  method: GET\n  headers:\n    Accept: text/csv\nexpect:\n  status: 200\n", want: map[string]interface{}{
+			"request": map[string]interface{}{"method": "GET", "headers": map[string]interface{}{"Accept": "text/csv"}},
+			"expect":  map[string]interface{}{"status": 200.0},
+		}},
+		{name: "sequence of mappings", yaml: "- name: a\n  tags:\n  - go\n  - rust\n-\n  name: b\n- plain\n", want: []interface{}{
+			map[string]interface{}{"name": "a", "tags": []interface{}{"go", "rust"}},
+			map[string]interface{}{"name": "b"},
+			"plain",
+		}},
+		{name: "nested sequences", yaml: "- - 1\n  - 2\n- []\n", want: []interface{}{
+			[]interface{}{1.0, 2.0},
+			[]interface{}{},
+		}},
+		{name: "flow JSON", yaml: `body: {"email": "ann@example.com", "tags": ["#go"]}` + "\n", want: map[string]interface{}{
+			"body": map[string]interface{}{"email": "ann@example.com", "tags": []interface{}{"#go"}},
+		}},
+		{name: "literal", yaml: "a: |\n  line one\n    indented\n\n  # kept\n\nb: |-\n  no newline\n", want: map[string]interface{}{
+			"a": "line one\n  indented\n\n# kept\n",
+			"b": "no newline",
+		}},
+	}
+	for _, tt := range tests {
+		got, err := ParseYAML([]byte(tt.yaml))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, yaml := range []string{
+		"a: 1\n  b: 2\n",
+		"a: 1\na: 2\n",
+		"\ta: 1\n",
+		"just text\n",
+		"a: {not json}\n",
+		"a: \"unterminated\n",
+	} {
+		_, err := ParseYAML([]byte(yaml))
+		if err == nil {
+			t.Errorf("%q: expected an error", yaml)
+		}
+	}
+}
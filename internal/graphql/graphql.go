@@ -0,0 +1,481 @@
+// Package graphql executes GraphQL queries and mutations against a schema of
+// objects whose fields are resolved by plain Go functions. It covers the
+// subset of the language clients need to fetch records and their
+// relationships: operations, variables, aliases and arguments. Fragments,
+// directives and introspection aren't supported.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Schema holds the root objects. Mutation is optional.
+type Schema struct {
+	Query    *Object
+	Mutation *Object
+}
+
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+// Field is a field of an object. A field with a nil Type is a scalar and
+// its value is returned as JSON. List fields resolve to a slice.
+type Field struct {
+	Type *Object
+	List bool
+	Args []Argument
+	// Resolve returns the field's value. When nil, the value is read from
+	// the source's struct field with the same JSON name, or its map key.
+	Resolve func(p ResolveParams) (interface{}, error)
+}
+
+// Argument declares an argument and its input type, e.g. "ID!" or
+// "[String!]". Int, Float, String, ID and Boolean are the known types.
+type Argument struct {
+	Name string
+	Type string
+}
+
+type ResolveParams struct {
+	Context context.Context
+	// Source is the value of the parent field, nil for root fields.
+	Source interface{}
+	Args   map[string]interface{}
+}
+
+// Request is a GraphQL request as sent over HTTP.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response is the result of a request. Data is nil when the request
+// couldn't be executed at all, e.g. because it doesn't parse.
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type Error struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Execute runs the requested operation. Resolver errors don't fail the
+// request: the field is returned as null and the error listed with its path.
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return Response{Errors: []*Error{toError(err)}}
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return Response{Errors: []*Error{toError(err)}}
+	}
+	root := s.Query
+	if op.Type == "mutation" {
+		root = s.Mutation
+	}
+	if root == nil {
+		return Response{Errors: []*Error{{Message: op.Type + " operations are not supported"}}}
+	}
+	variables, errs := coerceVariables(op.Variables, req.Variables)
+	if len(errs) > 0 {
+		return Response{Errors: errs}
+	}
+	errs = validateSelections(root, op.SelectionSet, variables)
+	if len(errs) > 0 {
+		return Response{Errors: errs}
+	}
+	e := &executor{ctx: ctx, variables: variables}
+	data := e.executeSelections(root, nil, op.SelectionSet, nil)
+	return Response{Data: data, Errors: e.errors}
+}
+
+func (doc *Document) operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, &Error{Message: "operationName is required for documents with several operations"}
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("unknown operation %q", name)}
+}
+
+func toError(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return &Error{Message: err.Error()}
+}
+
+func coerceVariables(defs []VariableDefinition, values map[string]interface{}) (map[string]interface{}, []*Error) {
+	variables := map[string]interface{}{}
+	errs := []*Error{}
+	for _, def := range defs {
+		value, ok := values[def.Name]
+		if !ok && def.HasDefault {
+			value = def.Default
+		}
+		coerced, err := coerce(def.Type, value)
+		if err != nil {
+			errs = append(errs, &Error{Message: fmt.Sprintf("variable $%s: %v", def.Name, err)})
+			continue
+		}
+		variables[def.Name] = coerced
+	}
+	return variables, errs
+}
+
+// coerce checks an input value against a type and normalizes it, e.g.
+// turning JSON numbers into ints for Int arguments.
+func coerce(typ string, value interface{}) (interface{}, error) {
+	if inner, ok := strings.CutSuffix(typ, "!"); ok {
+		if value == nil {
+			return nil, fmt.Errorf("expected %s, got null", typ)
+		}
+		return coerce(inner, value)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	if strings.HasPrefix(typ, "[") && strings.HasSuffix(typ, "]") {
+		inner := typ[1 : len(typ)-1]
+		list, ok := value.([]interface{})
+		if !ok {
+			// a single value is read as a list of one
+			list = []interface{}{value}
+		}
+		coerced := make([]interface{}, 0, len(list))
+		for _, item := range list {
+			c, err := coerce(inner, item)
+			if err != nil {
+				return nil, err
+			}
+			coerced = append(coerced, c)
+		}
+		return coerced, nil
+	}
+	switch typ {
+	case "Int":
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case float64:
+			if v == float64(int(v)) {
+				return int(v), nil
+			}
+		}
+	case "Float":
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+	case "String":
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case "ID":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case int:
+			return strconv.Itoa(v), nil
+		}
+	case "Boolean":
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %s", typ)
+	}
+	return nil, fmt.Errorf("expected %s, got %v", typ, value)
+}
+
+// substitute replaces the variables in an argument value with their values.
+func substitute(value interface{}, variables map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case variable:
+		return variables[string(v)]
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = substitute(item, variables)
+		}
+		return list
+	case map[string]interface{}:
+		object := map[string]interface{}{}
+		for key, item := range v {
+			object[key] = substitute(item, variables)
+		}
+		return object
+	}
+	return value
+}
+
+// undefinedVariable returns the first variable used in value that the
+// operation doesn't define.
+func undefinedVariable(value interface{}, variables map[string]interface{}) (string, bool) {
+	switch v := value.(type) {
+	case variable:
+		_, ok := variables[string(v)]
+		return string(v), !ok
+	case []interface{}:
+		for _, item := range v {
+			if name, ok := undefinedVariable(item, variables); ok {
+				return name, true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if name, ok := undefinedVariable(item, variables); ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// validateSelections checks that every selected field and argument exists,
+// before anything is resolved.
+func validateSelections(obj *Object, selections []*Selection, variables map[string]interface{}) []*Error {
+	errs := []*Error{}
+	fail := func(sel *Selection, format string, args ...interface{}) {
+		errs = append(errs, &Error{
+			Message:   fmt.Sprintf(format, args...),
+			Locations: []Location{{Line: sel.Line, Column: sel.Column}},
+		})
+	}
+	seen := map[string]bool{}
+	for _, sel := range selections {
+		if seen[sel.ResponseKey()] {
+			fail(sel, "field %q is selected more than once", sel.ResponseKey())
+			continue
+		}
+		seen[sel.ResponseKey()] = true
+		if sel.Name == "__typename" {
+			if sel.SelectionSet != nil || sel.Arguments != nil {
+				fail(sel, "field \"__typename\" takes no arguments or selections")
+			}
+			continue
+		}
+		field, ok := obj.Fields[sel.Name]
+		if !ok {
+			fail(sel, "cannot query field %q on type %q", sel.Name, obj.Name)
+			continue
+		}
+		declared := map[string]string{}
+		for _, arg := range field.Args {
+			declared[arg.Name] = arg.Type
+		}
+		for name, value := range sel.Arguments {
+			typ, ok := declared[name]
+			if !ok {
+				fail(sel, "unknown argument %q on field %q", name, sel.Name)
+				continue
+			}
+			if v, ok := undefinedVariable(value, variables); ok {
+				fail(sel, "variable $%s is not defined", v)
+				continue
+			}
+			_, err := coerce(typ, substitute(value, variables))
+			if err != nil {
+				fail(sel, "argument %q on field %q: %v", name, sel.Name, err)
+			}
+		}
+		for _, arg := range field.Args {
+			if _, ok := sel.Arguments[arg.Name]; !ok && strings.HasSuffix(arg.Type, "!") {
+				fail(sel, "field %q requires argument %q", sel.Name, arg.Name)
+			}
+		}
+		switch {
+		case field.Type == nil && sel.SelectionSet != nil:
+			fail(sel, "field %q is a scalar and takes no selections", sel.Name)
+		case field.Type != nil && sel.SelectionSet == nil:
+			fail(sel, "field %q of type %q needs a selection of subfields", sel.Name, field.Type.Name)
+		case field.Type != nil:
+			errs = append(errs, validateSelections(field.Type, sel.SelectionSet, variables)...)
+		}
+	}
+	return errs
+}
+
+type executor struct {
+	ctx       context.Context
+	variables map[string]interface{}
+	errors    []*Error
+}
+
+func (e *executor) executeSelections(obj *Object, source interface{}, selections []*Selection, path []interface{}) *orderedMap {
+	result := &orderedMap{values: map[string]interface{}{}}
+	for _, sel := range selections {
+		key := sel.ResponseKey()
+		fieldPath := append(append([]interface{}{}, path...), key)
+		if sel.Name == "__typename" {
+			result.set(key, obj.Name)
+			continue
+		}
+		field := obj.Fields[sel.Name]
+		args := map[string]interface{}{}
+		for _, arg := range field.Args {
+			value, ok := sel.Arguments[arg.Name]
+			if !ok {
+				continue
+			}
+			// already validated
+			args[arg.Name], _ = coerce(arg.Type, substitute(value, e.variables))
+		}
+		resolve := field.Resolve
+		if resolve == nil {
+			resolve = defaultResolver(sel.Name)
+		}
+		value, err := resolve(ResolveParams{Context: e.ctx, Source: source, Args: args})
+		if err != nil {
+			e.errors = append(e.errors, &Error{
+				Message:   err.Error(),
+				Locations: []Location{{Line: sel.Line, Column: sel.Column}},
+				Path:      fieldPath,
+			})
+			result.set(key, nil)
+			continue
+		}
+		result.set(key, e.complete(field, sel, value, fieldPath))
+	}
+	return result
+}
+
+// complete resolves the selections of object values.
+func (e *executor) complete(field *Field, sel *Selection, value interface{}, path []interface{}) interface{} {
+	if isNil(value) {
+		return nil
+	}
+	if field.Type == nil {
+		return value
+	}
+	if !field.List {
+		return e.executeSelections(field.Type, value, sel.SelectionSet, path)
+	}
+	items := reflect.ValueOf(value)
+	if items.Kind() != reflect.Slice {
+		e.errors = append(e.errors, &Error{Message: fmt.Sprintf("field %q didn't resolve to a list", sel.Name), Path: path})
+		return nil
+	}
+	list := make([]interface{}, items.Len())
+	for i := range list {
+		itemPath := append(append([]interface{}{}, path...), i)
+		item := items.Index(i).Interface()
+		if isNil(item) {
+			continue
+		}
+		list[i] = e.executeSelections(field.Type, item, sel.SelectionSet, itemPath)
+	}
+	return list
+}
+
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func defaultResolver(name string) func(p ResolveParams) (interface{}, error) {
+	return func(p ResolveParams) (interface{}, error) {
+		if m, ok := p.Source.(map[string]interface{}); ok {
+			return m[name], nil
+		}
+		v := reflect.ValueOf(p.Source)
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil, nil
+		}
+		return jsonField(v, name), nil
+	}
+}
+
+// jsonField returns the field of struct v encoded as name, looking into
+// embedded structs like encoding/json does.
+func jsonField(v reflect.Value, name string) interface{} {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == name {
+			return v.Field(i).Interface()
+		}
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			if value := jsonField(v.Field(i), name); value != nil {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+// orderedMap keeps the fields of a result in the order they were selected.
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (m *orderedMap) set(key string, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
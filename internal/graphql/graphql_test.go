@@ -0,0 +1,170 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type testAuthor struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type testBook struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	AuthorID string `json:"authorId"`
+}
+
+func testSchema() *Schema {
+	authors := map[string]testAuthor{"1": {ID: "1", Name: "Ann"}, "2": {ID: "2", Name: "Bob"}}
+	books := []testBook{{ID: "a", Title: "Go", AuthorID: "1"}, {ID: "b", Title: "Rust", AuthorID: "1"}}
+	author := &Object{Name: "Author", Fields: map[string]*Field{
+		"id":   {},
+		"name": {},
+	}}
+	book := &Object{Name: "Book", Fields: map[string]*Field{
+		"id":    {},
+		"title": {},
+		"author": {Type: author, Resolve: func(p ResolveParams) (interface{}, error) {
+			a, ok := authors[p.Source.(testBook).AuthorID]
+			if !ok {
+				return nil, nil
+			}
+			return a, nil
+		}},
+	}}
+	author.Fields["books"] = &Field{Type: book, List: true, Args: []Argument{{Name: "limit", Type: "Int"}}, Resolve: func(p ResolveParams) (interface{}, error) {
+		found := []testBook{}
+		for _, b := range books {
+			if b.AuthorID == p.Source.(testAuthor).ID {
+				found = append(found, b)
+			}
+		}
+		if limit, ok := p.Args["limit"].(int); ok && limit < len(found) {
+			found = found[:limit]
+		}
+		return found, nil
+	}}
+	return &Schema{
+		Query: &Object{Name: "Query", Fields: map[string]*Field{
+			"author": {Type: author, Args: []Argument{{Name: "id", Type: "ID!"}}, Resolve: func(p ResolveParams) (interface{}, error) {
+				a, ok := authors[p.Args["id"].(string)]
+				if !ok {
+					return nil, errors.New("author not found")
+				}
+				return a, nil
+			}},
+		}},
+		Mutation: &Object{Name: "Mutation", Fields: map[string]*Field{
+			"echo": {Args: []Argument{{Name: "words", Type: "[String!]!"}}, Resolve: func(p ResolveParams) (interface{}, error) {
+				return p.Args["words"], nil
+			}},
+		}},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	var tests = []struct {
+		name      string
+		req       Request
+		expected  string
+		requestOK bool
+	}{
+		{
+			name:      "nested fields in selection order",
+			req:       Request{Query: `{ author(id: "1") { name id books { title author { name } } } }`},
+			expected:  `{"data":{"author":{"name":"Ann","id":"1","books":[{"title":"Go","author":{"name":"Ann"}},{"title":"Rust","author":{"name":"Ann"}}]}}}`,
+			requestOK: true,
+		},
+		{
+			name: "variables, defaults and aliases",
+			req: Request{
+				Query:     `query Get($id: ID!, $limit: Int = 1) { a: author(id: $id) { __typename books(limit: $limit) { id } } }`,
+				Variables: map[string]interface{}{"id": "1"},
+			},
+			expected:  `{"data":{"a":{"__typename":"Author","books":[{"id":"a"}]}}}`,
+			requestOK: true,
+		},
+		{
+			name:      "resolver errors null the field",
+			req:       Request{Query: `{ author(id: "3") { name } }`},
+			expected:  `{"data":{"author":null},"errors":[{"message":"author not found","locations":[{"line":1,"column":3}],"path":["author"]}]}`,
+			requestOK: true,
+		},
+		{
+			name:      "mutation",
+			req:       Request{Query: `mutation { echo(words: "hi") }`},
+			expected:  `{"data":{"echo":["hi"]}}`,
+			requestOK: true,
+		},
+		{
+			name:     "unknown field",
+			req:      Request{Query: `{ author(id: "1") { email } }`},
+			expected: `{"errors":[{"message":"cannot query field \"email\" on type \"Author\"","locations":[{"line":1,"column":21}]}]}`,
+		},
+		{
+			name:     "missing argument",
+			req:      Request{Query: `{ author { name } }`},
+			expected: `{"errors":[{"message":"field \"author\" requires argument \"id\"","locations":[{"line":1,"column":3}]}]}`,
+		},
+		{
+			name:     "missing variable",
+			req:      Request{Query: `query($id: ID!) { author(id: $id) { name } }`},
+			expected: `{"errors":[{"message":"variable $id: expected ID!, got null"}]}`,
+		},
+		{
+			name:     "syntax error",
+			req:      Request{Query: `{ author(id: "1") { name }`},
+			expected: `{"errors":[{"message":"syntax error: unexpected end of document","locations":[{"line":1,"column":27}]}]}`,
+		},
+		{
+			name:     "fragments",
+			req:      Request{Query: `{ author(id: "1") { ...F } }`},
+			expected: `{"errors":[{"message":"syntax error: fragments are not supported","locations":[{"line":1,"column":21}]}]}`,
+		},
+	}
+	schema := testSchema()
+	for _, tt := range tests {
+		resp := schema.Execute(context.Background(), tt.req)
+		got, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.expected {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.expected)
+		}
+		if (resp.Data != nil) != tt.requestOK {
+			t.Errorf("%s: got data %v, want data: %v", tt.name, resp.Data != nil, tt.requestOK)
+		}
+	}
+}
+
+func TestParseOperations(t *testing.T) {
+	doc, err := Parse(`
+		# fetch two things
+		query First { a }
+		mutation Second($tags: [String!] = ["x", "y"]) { b(tags: $tags, n: -1.5e2) }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Operations) != 2 {
+		t.Fatalf("got %d operations, want 2", len(doc.Operations))
+	}
+	second := doc.Operations[1]
+	if second.Type != "mutation" || second.Name != "Second" {
+		t.Errorf("got %s %s, want mutation Second", second.Type, second.Name)
+	}
+	if len(second.Variables) != 1 || second.Variables[0].Type != "[String!]" || !second.Variables[0].HasDefault {
+		t.Errorf("got variables %+v", second.Variables)
+	}
+	if n := second.SelectionSet[0].Arguments["n"]; n != -150.0 {
+		t.Errorf("got n %v, want -150", n)
+	}
+	if _, err := doc.operation(""); err == nil {
+		t.Errorf("expected an error choosing between several operations")
+	}
+}
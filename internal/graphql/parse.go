@@ -0,0 +1,563 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Document is a parsed request holding one or more operations. Fragments,
+// directives and introspection aren't supported.
+type Document struct {
+	Operations []*Operation
+}
+
+type Operation struct {
+	// Type is "query" or "mutation".
+	Type         string
+	Name         string
+	Variables    []VariableDefinition
+	SelectionSet []*Selection
+}
+
+type VariableDefinition struct {
+	Name    string
+	Type    string
+	Default interface{}
+	// HasDefault tells an explicit null default from no default.
+	HasDefault bool
+}
+
+// Selection is one field of a selection set.
+type Selection struct {
+	Alias        string
+	Name         string
+	Arguments    map[string]interface{}
+	SelectionSet []*Selection
+	Line         int
+	Column       int
+}
+
+// ResponseKey is the name the field's value is returned under.
+func (s *Selection) ResponseKey() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+// variable is a reference to a request variable in an argument value.
+type variable string
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind   tokenKind
+	value  string
+	line   int
+	column int
+}
+
+type lexer struct {
+	src    string
+	pos    int
+	line   int
+	column int
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipIgnored()
+	tok := token{line: l.line, column: l.column}
+	if l.pos >= len(l.src) {
+		return tok, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("{}()[]:!$=@|&", c) >= 0:
+		tok.kind, tok.value = tokenPunct, string(c)
+		l.advance(1)
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		tok.kind, tok.value = tokenPunct, "..."
+		l.advance(3)
+	case c == '_' || isLetter(c):
+		start := l.pos
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.advance(1)
+		}
+		tok.kind, tok.value = tokenName, l.src[start:l.pos]
+	case c == '-' || isDigit(c):
+		start := l.pos
+		tok.kind = tokenInt
+		l.advance(1)
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			if c == '.' || c == 'e' || c == 'E' || ((c == '+' || c == '-') && tok.kind == tokenFloat) {
+				tok.kind = tokenFloat
+			} else if !isDigit(c) {
+				break
+			}
+			l.advance(1)
+		}
+		tok.value = l.src[start:l.pos]
+	case c == '"':
+		s, err := l.readString()
+		if err != nil {
+			return tok, err
+		}
+		tok.kind, tok.value = tokenString, s
+	default:
+		return tok, l.errorf(tok, "unexpected character %q", c)
+	}
+	return tok, nil
+}
+
+// skipIgnored skips whitespace, commas and comments.
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == '\n':
+			l.pos++
+			l.line++
+			l.column = 1
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			l.advance(1)
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.advance(1)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) readString() (string, error) {
+	start := token{line: l.line, column: l.column}
+	l.advance(1)
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.advance(1)
+			return b.String(), nil
+		case '\n':
+			return "", l.errorf(start, "unterminated string")
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return "", l.errorf(start, "unterminated string")
+			}
+			escaped := l.src[l.pos+1]
+			switch escaped {
+			case '"', '\\', '/':
+				b.WriteByte(escaped)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if l.pos+6 > len(l.src) {
+					return "", l.errorf(start, "invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(l.src[l.pos+2:l.pos+6], 16, 32)
+				if err != nil {
+					return "", l.errorf(start, "invalid unicode escape")
+				}
+				b.WriteRune(rune(code))
+				l.advance(4)
+			default:
+				return "", l.errorf(start, "invalid escape \\%c", escaped)
+			}
+			l.advance(2)
+		default:
+			b.WriteByte(c)
+			l.advance(1)
+		}
+	}
+	return "", l.errorf(start, "unterminated string")
+}
+
+func (l *lexer) advance(n int) {
+	l.pos += n
+	l.column += n
+}
+
+func (l *lexer) errorf(tok token, format string, args ...interface{}) error {
+	return &Error{
+		Message:   "syntax error: " + fmt.Sprintf(format, args...),
+		Locations: []Location{{Line: tok.line, Column: tok.column}},
+	}
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type parser struct {
+	lex lexer
+	tok token
+}
+
+// Parse parses a request document.
+func Parse(src string) (*Document, error) {
+	p := &parser{lex: lexer{src: src, line: 1, column: 1}}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{}
+	for p.tok.kind != tokenEOF {
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		doc.Operations = append(doc.Operations, op)
+	}
+	if len(doc.Operations) == 0 {
+		return nil, p.errorf("empty document")
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return p.lex.errorf(p.tok, format, args...)
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return p.errorf("unexpected end of document")
+	}
+	return p.errorf("unexpected %q", p.tok.value)
+}
+
+func (p *parser) peek(punct string) bool {
+	return p.tok.kind == tokenPunct && p.tok.value == punct
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.peek(punct) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) parseOperation() (*Operation, error) {
+	op := &Operation{Type: "query"}
+	if p.peek("{") {
+		selections, err := p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+		op.SelectionSet = selections
+		return op, nil
+	}
+	if p.tok.kind != tokenName {
+		return nil, p.unexpected()
+	}
+	switch p.tok.value {
+	case "query", "mutation":
+		op.Type = p.tok.value
+	case "fragment", "subscription":
+		return nil, p.errorf("%s is not supported", p.tok.value)
+	default:
+		return nil, p.unexpected()
+	}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokenName {
+		op.Name = p.tok.value
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		op.Variables, err = p.parseVariableDefinitions()
+		if err != nil {
+			return nil, err
+		}
+	}
+	op.SelectionSet, err = p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) parseVariableDefinitions() ([]VariableDefinition, error) {
+	err := p.expect("(")
+	if err != nil {
+		return nil, err
+	}
+	defs := []VariableDefinition{}
+	for !p.peek(")") {
+		err = p.expect("$")
+		if err != nil {
+			return nil, err
+		}
+		def := VariableDefinition{}
+		def.Name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect(":")
+		if err != nil {
+			return nil, err
+		}
+		def.Type, err = p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek("=") {
+			err = p.advance()
+			if err != nil {
+				return nil, err
+			}
+			def.Default, err = p.parseValue(true)
+			if err != nil {
+				return nil, err
+			}
+			def.HasDefault = true
+		}
+		defs = append(defs, def)
+	}
+	return defs, p.advance()
+}
+
+// parseType reads a type reference such as "[String!]!" back into its
+// canonical text.
+func (p *parser) parseType() (string, error) {
+	var typ string
+	if p.peek("[") {
+		err := p.advance()
+		if err != nil {
+			return "", err
+		}
+		inner, err := p.parseType()
+		if err != nil {
+			return "", err
+		}
+		err = p.expect("]")
+		if err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.peek("!") {
+		typ += "!"
+		return typ, p.advance()
+	}
+	return typ, nil
+}
+
+func (p *parser) parseSelectionSet() ([]*Selection, error) {
+	err := p.expect("{")
+	if err != nil {
+		return nil, err
+	}
+	selections := []*Selection{}
+	for !p.peek("}") {
+		if p.peek("...") {
+			return nil, p.errorf("fragments are not supported")
+		}
+		sel, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	if len(selections) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+	return selections, p.advance()
+}
+
+func (p *parser) parseField() (*Selection, error) {
+	sel := &Selection{Line: p.tok.line, Column: p.tok.column}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek(":") {
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+		sel.Alias = name
+		name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+	}
+	sel.Name = name
+	if p.peek("(") {
+		sel.Arguments, err = p.parseArguments()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("@") {
+		return nil, p.errorf("directives are not supported")
+	}
+	if p.peek("{") {
+		sel.SelectionSet, err = p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+func (p *parser) parseArguments() (map[string]interface{}, error) {
+	err := p.expect("(")
+	if err != nil {
+		return nil, err
+	}
+	args := map[string]interface{}{}
+	for !p.peek(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := args[name]; ok {
+			return nil, p.errorf("duplicate argument %q", name)
+		}
+		err = p.expect(":")
+		if err != nil {
+			return nil, err
+		}
+		args[name], err = p.parseValue(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return args, p.advance()
+}
+
+// parseValue reads an argument value. Variables aren't allowed in constant
+// values such as variable defaults. Enum values are read as strings.
+func (p *parser) parseValue(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokenPunct && tok.value == "$":
+		if constant {
+			return nil, p.errorf("variables are not allowed here")
+		}
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return variable(name), nil
+	case tok.kind == tokenPunct && tok.value == "[":
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.peek("]") {
+			value, err := p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, p.advance()
+	case tok.kind == tokenPunct && tok.value == "{":
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		object := map[string]interface{}{}
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			err = p.expect(":")
+			if err != nil {
+				return nil, err
+			}
+			object[name], err = p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return object, p.advance()
+	case tok.kind == tokenInt:
+		n, err := strconv.Atoi(tok.value)
+		if err != nil {
+			return nil, p.errorf("invalid int %s", tok.value)
+		}
+		return n, p.advance()
+	case tok.kind == tokenFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, p.errorf("invalid float %s", tok.value)
+		}
+		return f, p.advance()
+	case tok.kind == tokenString:
+		return tok.value, p.advance()
+	case tok.kind == tokenName:
+		var value interface{}
+		switch tok.value {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			value = tok.value
+		}
+		return value, p.advance()
+	}
+	return nil, p.unexpected()
+}
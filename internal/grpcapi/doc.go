@@ -0,0 +1,5 @@
+// Package grpcapi holds the gRPC services of api.proto, generated by
+// protoc-gen-go and protoc-gen-go-grpc.
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative api.proto
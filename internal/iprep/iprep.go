@@ -0,0 +1,220 @@
+// Package iprep looks up where a client address is and whether it's known
+// for abuse, through pluggable sources, and decides what to do with its
+// requests.
+package iprep
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Info is what the sources know about an address.
+type Info struct {
+	// Country is an ISO 3166-1 alpha-2 code like "FR", empty when unknown.
+	Country string
+	// Listed names the blocklist the address is on, empty when it's on none.
+	Listed string
+}
+
+// Source looks up addresses, e.g. in a GeoIP database or a blocklist.
+// Fields it doesn't know about are left empty.
+type Source interface {
+	Lookup(ctx context.Context, ip netip.Addr) (Info, error)
+}
+
+// Sources asks each source in turn, keeping the first answer for each
+// field.
+type Sources []Source
+
+func (s Sources) Lookup(ctx context.Context, ip netip.Addr) (Info, error) {
+	info := Info{}
+	for _, source := range s {
+		found, err := source.Lookup(ctx, ip)
+		if err != nil {
+			return Info{}, err
+		}
+		if info.Country == "" {
+			info.Country = found.Country
+		}
+		if info.Listed == "" {
+			info.Listed = found.Listed
+		}
+	}
+	return info, nil
+}
+
+type countryRange struct {
+	first, last netip.Addr
+	country     string
+}
+
+// CountryTable maps address ranges to countries.
+type CountryTable struct {
+	// ranges are sorted and don't overlap.
+	ranges []countryRange
+}
+
+// LoadCountryCSV reads a table of "first address,last address,country"
+// rows, the format of the free DB-IP and IP2Location country databases.
+func LoadCountryCSV(r io.Reader) (*CountryTable, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	t := &CountryTable{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: want first address, last address and country", line)
+		}
+		first, err := netip.ParseAddr(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		last, err := netip.ParseAddr(strings.TrimSpace(record[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		first, last = first.Unmap(), last.Unmap()
+		if first.Is4() != last.Is4() || last.Less(first) {
+			return nil, fmt.Errorf("line %d: invalid range %s-%s", line, first, last)
+		}
+		t.ranges = append(t.ranges, countryRange{first: first, last: last, country: strings.ToUpper(strings.TrimSpace(record[2]))})
+	}
+	sort.Slice(t.ranges, func(i, j int) bool {
+		return t.ranges[i].first.Less(t.ranges[j].first)
+	})
+	for i := 1; i < len(t.ranges); i++ {
+		if !t.ranges[i-1].last.Less(t.ranges[i].first) {
+			return nil, fmt.Errorf("ranges starting at %s and %s overlap", t.ranges[i-1].first, t.ranges[i].first)
+		}
+	}
+	return t, nil
+}
+
+// Lookup returns the country of ip.
+func (t *CountryTable) Lookup(ctx context.Context, ip netip.Addr) (Info, error) {
+	ip = ip.Unmap()
+	// the last range starting at or before ip
+	i := sort.Search(len(t.ranges), func(i int) bool {
+		return ip.Less(t.ranges[i].first)
+	}) - 1
+	if i < 0 || t.ranges[i].last.Less(ip) {
+		return Info{}, nil
+	}
+	return Info{Country: t.ranges[i].country}, nil
+}
+
+// Blocklist holds the address ranges of a list of known abusers, like
+// Spamhaus DROP.
+type Blocklist struct {
+	Name     string
+	prefixes []netip.Prefix
+}
+
+// ParseBlocklist reads one address or CIDR range per line. Comments start
+// with "#" or ";", and may follow a range.
+func ParseBlocklist(name string, r io.Reader) (*Blocklist, error) {
+	b := &Blocklist{Name: name}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text, _, _ = strings.Cut(text, ";")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		var prefix netip.Prefix
+		var err error
+		if strings.Contains(text, "/") {
+			prefix, err = netip.ParsePrefix(text)
+		} else {
+			var ip netip.Addr
+			ip, err = netip.ParseAddr(text)
+			prefix = netip.PrefixFrom(ip, ip.BitLen())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", name, line, err)
+		}
+		b.prefixes = append(b.prefixes, prefix.Masked())
+	}
+	return b, scanner.Err()
+}
+
+// Lookup reports ip as listed if a range of the blocklist contains it.
+func (b *Blocklist) Lookup(ctx context.Context, ip netip.Addr) (Info, error) {
+	ip = ip.Unmap()
+	for _, prefix := range b.prefixes {
+		if prefix.Contains(ip) {
+			return Info{Listed: b.Name}, nil
+		}
+	}
+	return Info{}, nil
+}
+
+// Action is what happens to a request.
+type Action string
+
+const (
+	Allow Action = ""
+	// Challenge lets the request through flagged, so clients can be asked
+	// to prove they're legitimate.
+	Challenge Action = "challenge"
+	Block     Action = "block"
+)
+
+// ParseAction parses "allow", "challenge" or "block".
+func ParseAction(s string) (Action, error) {
+	switch s {
+	case "allow":
+		return Allow, nil
+	case string(Challenge), string(Block):
+		return Action(s), nil
+	}
+	return Allow, fmt.Errorf("action must be allow, challenge or block, got %q", s)
+}
+
+var strictness = map[Action]int{Allow: 0, Challenge: 1, Block: 2}
+
+// stricter reports whether a is stricter than b.
+func (a Action) stricter(b Action) bool {
+	return strictness[a] > strictness[b]
+}
+
+// Policy decides what happens to requests by what's known of their address.
+type Policy struct {
+	// Countries maps country codes to their action, others are allowed.
+	Countries map[string]Action
+	// Listed applies to addresses on a blocklist.
+	Listed Action
+}
+
+// Decision is the action a policy took for an address, and why.
+type Decision struct {
+	Action Action
+	Reason string
+}
+
+// Decide returns the strictest action applying to an address.
+func (p Policy) Decide(info Info) Decision {
+	decision := Decision{}
+	if action := p.Countries[info.Country]; info.Country != "" && action.stricter(decision.Action) {
+		decision = Decision{Action: action, Reason: "country " + info.Country}
+	}
+	if info.Listed != "" && p.Listed.stricter(decision.Action) {
+		decision = Decision{Action: p.Listed, Reason: "listed on " + info.Listed}
+	}
+	return decision
+}
@@ -0,0 +1,90 @@
+package iprep
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	countries, err := LoadCountryCSV(strings.NewReader(`# first,last,country
+1.0.0.0,1.0.0.255,au
+2001:db8::,2001:db8::ffff,DE
+8.8.8.0,8.8.8.255,US
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drop, err := ParseBlocklist("drop", strings.NewReader(`; Spamhaus DROP style
+8.8.8.128/25 ; SBL1
+203.0.113.7
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := Sources{countries, drop}
+
+	var tests = []struct {
+		ip       string
+		expected Info
+	}{
+		{ip: "1.0.0.1", expected: Info{Country: "AU"}},
+		{ip: "1.0.1.0", expected: Info{}},
+		{ip: "0.255.255.255", expected: Info{}},
+		{ip: "::ffff:1.0.0.255", expected: Info{Country: "AU"}},
+		{ip: "2001:db8::1", expected: Info{Country: "DE"}},
+		{ip: "8.8.8.8", expected: Info{Country: "US"}},
+		{ip: "8.8.8.200", expected: Info{Country: "US", Listed: "drop"}},
+		{ip: "203.0.113.7", expected: Info{Listed: "drop"}},
+	}
+	for _, tt := range tests {
+		got, err := sources.Lookup(context.Background(), netip.MustParseAddr(tt.ip))
+		if err != nil {
+			t.Errorf("%s: %v", tt.ip, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%s: got %+v, want %+v", tt.ip, got, tt.expected)
+		}
+	}
+}
+
+func TestLoadCountryCSVErrors(t *testing.T) {
+	var tests = []string{
+		"1.0.0.0,1.0.0.255",
+		"1.0.0.255,1.0.0.0,AU",
+		"1.0.0.0,2001:db8::,AU",
+		"1.0.0.0,1.0.0.255,AU\n1.0.0.128,1.0.1.0,NZ",
+		"nope,1.0.0.255,AU",
+	}
+	for _, csv := range tests {
+		_, err := LoadCountryCSV(strings.NewReader(csv))
+		if err == nil {
+			t.Errorf("%q: got no error", csv)
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	policy := Policy{
+		Countries: map[string]Action{"KP": Block, "RU": Challenge},
+		Listed:    Challenge,
+	}
+	var tests = []struct {
+		info     Info
+		expected Decision
+	}{
+		{info: Info{}, expected: Decision{}},
+		{info: Info{Country: "FR"}, expected: Decision{}},
+		{info: Info{Country: "RU"}, expected: Decision{Action: Challenge, Reason: "country RU"}},
+		{info: Info{Country: "KP", Listed: "drop"}, expected: Decision{Action: Block, Reason: "country KP"}},
+		{info: Info{Country: "FR", Listed: "drop"}, expected: Decision{Action: Challenge, Reason: "listed on drop"}},
+	}
+	for _, tt := range tests {
+		got := policy.Decide(tt.info)
+		if got != tt.expected {
+			t.Errorf("%+v: got %+v, want %+v", tt.info, got, tt.expected)
+		}
+	}
+}
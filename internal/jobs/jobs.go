@@ -0,0 +1,216 @@
+// Package jobs runs background work outside of request handlers. Jobs are
+// stored in the database, so they survive restarts, and failed jobs are
+// retried with exponential backoff.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// Handler runs a job of one kind. Returning an error schedules a retry.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+type Options struct {
+	Workers int
+	// MaxAttempts is how many times a job runs before it's marked failed.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubling for every
+	// retry after that up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// PollInterval is how often the queue looks for jobs due for a retry.
+	PollInterval time.Duration
+	// Retention is how long finished jobs are kept for GET /admin/jobs.
+	Retention time.Duration
+}
+
+// Queue dispatches due jobs to a pool of workers.
+type Queue struct {
+	db   database.Client
+	opts Options
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+
+	wake chan struct{}
+	work chan database.Job
+}
+
+func NewQueue(db database.Client, opts Options) *Queue {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	return &Queue{
+		db:       db,
+		opts:     opts,
+		handlers: map[string]Handler{},
+		wake:     make(chan struct{}, 1),
+		work:     make(chan database.Job),
+	}
+}
+
+// Handle registers the handler for jobs of a kind.
+func (q *Queue) Handle(kind string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = h
+}
+
+// Enqueue stores a job to run as soon as a worker is free. It's stored as
+// part of the database transaction of ctx, if any.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload interface{}) (database.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return database.Job{}, err
+	}
+	job, err := q.db.WithContext(ctx).CreateJob(kind, data, time.Now())
+	if err != nil {
+		return database.Job{}, err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Start runs the dispatcher and workers until ctx is done. Jobs left
+// running by a previous process are run again.
+func (q *Queue) Start(ctx context.Context) error {
+	jobs, err := q.db.GetJobs()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.Status == database.JobRunning {
+			job.Status = database.JobPending
+			err = q.db.UpdateJob(job)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for i := 0; i < q.opts.Workers; i++ {
+		go q.worker(ctx)
+	}
+	go q.dispatch(ctx)
+	return nil
+}
+
+func (q *Queue) dispatch(ctx context.Context) {
+	ticker := time.NewTicker(q.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		q.dispatchDue(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// dispatchDue hands every due job to a worker, waiting for free workers.
+func (q *Queue) dispatchDue(ctx context.Context, now time.Time) {
+	jobs, err := q.db.GetJobs()
+	if err != nil {
+		log.Printf("jobs: %v", err)
+		return
+	}
+	// oldest first
+	for i := len(jobs) - 1; i >= 0; i-- {
+		job := jobs[i]
+		if job.Status != database.JobPending || job.RunAt.After(now) {
+			continue
+		}
+		job.Status = database.JobRunning
+		job.Attempts++
+		err = q.db.UpdateJob(job)
+		if err != nil {
+			log.Printf("jobs: %v", err)
+			return
+		}
+		select {
+		case q.work <- job:
+		case <-ctx.Done():
+			return
+		}
+	}
+	if q.opts.Retention > 0 {
+		_, err = q.db.DeleteFinishedJobs(now.Add(-q.opts.Retention))
+		if err != nil {
+			log.Printf("jobs: %v", err)
+		}
+	}
+}
+
+func (q *Queue) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-q.work:
+			q.finish(job, q.run(ctx, job), time.Now())
+		}
+	}
+}
+
+func (q *Queue) run(ctx context.Context, job database.Job) (err error) {
+	q.mu.Lock()
+	h, ok := q.handlers[job.Kind]
+	q.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no handler for jobs of kind %s", job.Kind)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, job.Payload)
+}
+
+// finish records the outcome of a run, scheduling a retry after a failure
+// unless the job is out of attempts.
+func (q *Queue) finish(job database.Job, err error, now time.Time) {
+	switch {
+	case err == nil:
+		job.Status = database.JobDone
+		job.LastError = ""
+	case job.Attempts >= q.opts.MaxAttempts:
+		job.Status = database.JobFailed
+		job.LastError = err.Error()
+		log.Printf("job %s (%s) failed after %d attempts: %v", job.ID, job.Kind, job.Attempts, err)
+	default:
+		job.Status = database.JobPending
+		job.LastError = err.Error()
+		job.RunAt = now.Add(q.opts.backoff(job.Attempts)).UTC()
+	}
+	updateErr := q.db.UpdateJob(job)
+	if updateErr != nil {
+		log.Printf("jobs: %v", updateErr)
+	}
+}
+
+// backoff returns the delay before retrying a job that ran attempts times.
+func (opts Options) backoff(attempts int) time.Duration {
+	d := opts.Backoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if opts.MaxBackoff > 0 && d >= opts.MaxBackoff {
+			return opts.MaxBackoff
+		}
+	}
+	return d
+}
@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestBackoff(t *testing.T) {
+	opts := Options{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	var tests = []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: time.Second},
+		{attempts: 2, expected: 2 * time.Second},
+		{attempts: 3, expected: 4 * time.Second},
+		{attempts: 4, expected: 5 * time.Second},
+		{attempts: 10, expected: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := opts.backoff(tt.attempts); got != tt.expected {
+			t.Errorf("attempt %d: got %v, want %v", tt.attempts, got, tt.expected)
+		}
+	}
+}
+
+func TestQueueRetries(t *testing.T) {
+	c := database.NewMemoryClient()
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := NewQueue(c, Options{
+		Workers:      2,
+		MaxAttempts:  3,
+		Backoff:      time.Millisecond,
+		MaxBackoff:   time.Millisecond,
+		PollInterval: 5 * time.Millisecond,
+	})
+	var calls int32
+	q.Handle("flaky", func(ctx context.Context, payload json.RawMessage) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = q.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flaky, err := q.Enqueue(context.Background(), "flaky", map[string]string{"key": "value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown, err := q.Enqueue(context.Background(), "unknown", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		id               string
+		expectedStatus   database.JobStatus
+		expectedAttempts int
+	}{
+		{id: flaky.ID, expectedStatus: database.JobDone, expectedAttempts: 3},
+		{id: unknown.ID, expectedStatus: database.JobFailed, expectedAttempts: 3},
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, tt := range tests {
+		job := database.Job{}
+		for time.Now().Before(deadline) {
+			job = findJob(t, c, tt.id)
+			if job.Status == tt.expectedStatus {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if job.Status != tt.expectedStatus || job.Attempts != tt.expectedAttempts {
+			t.Errorf("%s: got %s after %d attempts, want %s after %d", job.Kind, job.Status, job.Attempts, tt.expectedStatus, tt.expectedAttempts)
+		}
+	}
+}
+
+func findJob(t *testing.T, c database.Client, id string) database.Job {
+	jobs, err := c.GetJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	t.Fatalf("job %s doesn't exist", id)
+	return database.Job{}
+}
@@ -0,0 +1,75 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var urlRegexp = regexp.MustCompile(`https?://[^\s<>"'()]+`)
+
+type Checker struct {
+	client *http.Client
+}
+
+func NewChecker(timeout time.Duration) Checker {
+	return Checker{
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// ExtractURLs returns the unique http(s) URLs found in text, in order of
+// first appearance. Trailing punctuation is not considered part of a URL.
+func ExtractURLs(text string) []string {
+	urls := []string{}
+	seen := map[string]bool{}
+	for _, match := range urlRegexp.FindAllString(text, -1) {
+		url := strings.TrimRight(match, ".,;:!?")
+		if seen[url] {
+			continue
+		}
+		seen[url] = true
+		urls = append(urls, url)
+	}
+	return urls
+}
+
+// IsDead reports whether url can't be reached or answers with a client or
+// server error. Servers that don't support HEAD are retried with GET, and
+// rate limited responses are not treated as dead.
+func (c Checker) IsDead(ctx context.Context, url string) bool {
+	status, err := c.status(ctx, http.MethodHead, url)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = c.status(ctx, http.MethodGet, url)
+	}
+	if err != nil {
+		return true
+	}
+	return status >= 400 && status != http.StatusTooManyRequests
+}
+
+// DeadLinks checks every URL in text and returns the dead ones.
+func (c Checker) DeadLinks(ctx context.Context, text string) []string {
+	dead := []string{}
+	for _, url := range ExtractURLs(text) {
+		if c.IsDead(ctx, url) {
+			dead = append(dead, url)
+		}
+	}
+	return dead
+}
+
+func (c Checker) status(ctx context.Context, method, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,64 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExtractURLs(t *testing.T) {
+	var tests = []struct {
+		text     string
+		expected []string
+	}{
+		{
+			text:     "no links here",
+			expected: []string{},
+		},
+		{
+			text:     "see https://example.com/a, and http://example.org.",
+			expected: []string{"https://example.com/a", "http://example.org"},
+		},
+		{
+			text:     "(https://example.com) twice https://example.com",
+			expected: []string{"https://example.com"},
+		},
+	}
+	for _, tt := range tests {
+		urls := ExtractURLs(tt.text)
+		if !reflect.DeepEqual(urls, tt.expected) {
+			t.Errorf("got %v, want %v", urls, tt.expected)
+		}
+	}
+}
+
+func TestDeadLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		case "/busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewChecker(time.Second)
+	text := srv.URL + "/ok " + srv.URL + "/no-head " + srv.URL + "/busy " + srv.URL + "/missing"
+	dead := c.DeadLinks(context.Background(), text)
+	expected := []string{srv.URL + "/missing"}
+	if !reflect.DeepEqual(dead, expected) {
+		t.Errorf("got %v, want %v", dead, expected)
+	}
+}
@@ -0,0 +1,219 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	templates, err := ParseTemplates(fstest.MapFS{
+		"hello.txt":  {Data: []byte(`{{define "subject"}}Hello {{.Name}}{{end}}Hi {{.Name}}, welcome!`)},
+		"hello.html": {Data: []byte(`<p>Hi {{.Name}}, welcome!</p>`)},
+		"hello.json": {Data: []byte(`{"Name": "Ada"}`)},
+		"plain.txt":  {Data: []byte(`{{define "subject"}}Plain{{end}}Just text.`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(templates.Names(), ","); got != "hello,plain" {
+		t.Errorf("got names %s, want hello,plain", got)
+	}
+	if templates.Sample("hello") == nil || templates.Sample("plain") != nil {
+		t.Errorf("got samples %s and %s, want one for hello only", templates.Sample("hello"), templates.Sample("plain"))
+	}
+
+	var tests = []struct {
+		name    string
+		data    interface{}
+		want    Message
+		wantErr bool
+	}{
+		{"hello", map[string]string{"Name": "<b>"}, Message{Subject: "Hello <b>", Text: "Hi <b>, welcome!\n", HTML: "<p>Hi &lt;b&gt;, welcome!</p>"}, false},
+		{"plain", nil, Message{Subject: "Plain", Text: "Just text.\n"}, false},
+		{"hello", map[string]string{}, Message{}, true},
+		{"missing", nil, Message{}, true},
+	}
+	for _, tt := range tests {
+		got, err := templates.Render(tt.name, tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Render(%s) error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Render(%s) got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	_, err = ParseTemplates(fstest.MapFS{"nosubject.txt": {Data: []byte(`Hi`)}})
+	if err == nil {
+		t.Errorf("expected a template without a subject to be rejected")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data, err := Message{To: "ada@example.com", Subject: "Héllo", Text: "Hi", HTML: "<p>Hi</p>"}.encode("Example <no-reply@example.com>", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(data)
+	for _, want := range []string{
+		"From: Example <no-reply@example.com>\r\n",
+		"To: ada@example.com\r\n",
+		"Subject: =?utf-8?q?H=C3=A9llo?=\r\n",
+		"Date: Mon, 01 Jan 2024 00:00:00 +0000\r\n",
+		"@example.com>\r\n",
+		"Content-Type: multipart/alternative; boundary=",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Type: text/html; charset=utf-8",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message doesn't contain %q:\n%s", want, msg)
+		}
+	}
+	if strings.Index(msg, "text/plain") > strings.Index(msg, "text/html") {
+		t.Errorf("got the HTML part first, want it last")
+	}
+}
+
+func TestPoolReusesConnections(t *testing.T) {
+	server := startSMTPServer(t)
+	pool, err := NewPool(Options{Addr: server.addr, From: "no-reply@example.com", Size: 2, IdleTimeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	for i := 0; i < 3; i++ {
+		err = pool.Send(context.Background(), Message{To: "ada@example.com", Subject: "Hi", Text: "Hi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a refused recipient doesn't cost the connection
+	err = pool.Send(context.Background(), Message{To: "reject@example.com", Subject: "Hi", Text: "Hi"})
+	if !isReply(err) {
+		t.Errorf("got error %v, want the server's reply", err)
+	}
+	err = pool.Send(context.Background(), Message{To: "ada@example.com", Subject: "Hi", Text: "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.conns != 1 {
+		t.Errorf("got %d connections, want 1", server.conns)
+	}
+	if len(server.messages) != 4 {
+		t.Errorf("got %d messages, want 4", len(server.messages))
+	}
+}
+
+func TestPoolRedialsDroppedConnections(t *testing.T) {
+	server := startSMTPServer(t)
+	pool, err := NewPool(Options{Addr: server.addr, From: "no-reply@example.com", Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	err = pool.Send(context.Background(), Message{To: "ada@example.com", Subject: "Hi", Text: "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.dropAll()
+	err = pool.Send(context.Background(), Message{To: "ada@example.com", Subject: "Hi", Text: "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.conns != 2 || len(server.messages) != 2 {
+		t.Errorf("got %d connections and %d messages, want 2 and 2", server.conns, len(server.messages))
+	}
+}
+
+// smtpServer accepts every recipient but reject@example.com.
+type smtpServer struct {
+	addr string
+
+	mu       sync.Mutex
+	conns    int
+	open     []net.Conn
+	messages []string
+}
+
+func startSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s := &smtpServer{addr: listener.Addr().String()}
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.open = append(s.open, c)
+			s.mu.Unlock()
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) dropAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.open {
+		c.Close()
+	}
+	s.open = nil
+}
+
+func (s *smtpServer) serve(c net.Conn) {
+	defer c.Close()
+	tp := textproto.NewConn(c)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.Fields(line + " ")[0])
+		switch {
+		case verb == "EHLO" || verb == "HELO":
+			tp.PrintfLine("250 localhost")
+		case verb == "RCPT" && strings.Contains(line, "reject@"):
+			tp.PrintfLine("550 no such user")
+		case verb == "MAIL" || verb == "RCPT" || verb == "RSET" || verb == "NOOP":
+			tp.PrintfLine("250 OK")
+		case verb == "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case verb == "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
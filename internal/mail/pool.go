@@ -0,0 +1,224 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+type Options struct {
+	// Addr is the SMTP server, as host:port.
+	Addr     string
+	Username string
+	Password string
+	// From is the sender of every message, e.g. "Example <no-reply@example.com>".
+	From string
+	// Size is how many connections may be open at once.
+	Size int
+	// IdleTimeout closes connections left unused for that long.
+	IdleTimeout time.Duration
+	// Timeout bounds dialing and sending one message.
+	Timeout time.Duration
+}
+
+// Pool sends messages over a bounded set of SMTP connections, reusing idle
+// ones instead of dialing the server for every message.
+type Pool struct {
+	opts Options
+	host string
+	// sender is the address part of opts.From, used as the envelope sender.
+	sender string
+	slots  chan struct{}
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+type conn struct {
+	net      net.Conn
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+func NewPool(opts Options) (*Pool, error) {
+	host, _, err := net.SplitHostPort(opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address: %w", err)
+	}
+	from, err := netmail.ParseAddress(opts.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
+	}
+	if opts.Size < 1 {
+		opts.Size = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	return &Pool{
+		opts:   opts,
+		host:   host,
+		sender: from.Address,
+		slots:  make(chan struct{}, opts.Size),
+	}, nil
+}
+
+// Send delivers m, waiting for a free connection if all of them are busy.
+func (p *Pool) Send(ctx context.Context, m Message) error {
+	rcpt, err := netmail.ParseAddress(m.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+	data, err := m.encode(p.opts.From, time.Now())
+	if err != nil {
+		return err
+	}
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	c, reused, err := p.get()
+	if err != nil {
+		return err
+	}
+	err = p.send(c, rcpt.Address, data)
+	if err != nil && reused && !isReply(err) {
+		// the server may have dropped the idle connection, try a new one
+		c.client.Close()
+		c, err = p.dial()
+		if err != nil {
+			return err
+		}
+		err = p.send(c, rcpt.Address, data)
+	}
+	if err != nil && !isReply(err) {
+		c.client.Close()
+		return err
+	}
+	if err != nil {
+		// the server refused the message, the connection is still usable
+		if resetErr := c.client.Reset(); resetErr != nil {
+			c.client.Close()
+			return err
+		}
+	}
+	p.put(c)
+	return err
+}
+
+// Close closes the idle connections. Connections in use are closed as soon
+// as their message is sent.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, c := range p.idle {
+		c.quit()
+	}
+	p.idle = nil
+	return nil
+}
+
+// get returns the most recently used idle connection, or a new one.
+func (p *Pool) get() (c *conn, reused bool, err error) {
+	p.mu.Lock()
+	for len(p.idle) > 0 {
+		c = p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if p.opts.IdleTimeout > 0 && time.Since(c.lastUsed) > p.opts.IdleTimeout {
+			c.quit()
+			continue
+		}
+		p.mu.Unlock()
+		return c, true, nil
+	}
+	p.mu.Unlock()
+	c, err = p.dial()
+	return c, false, err
+}
+
+func (p *Pool) put(c *conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		c.quit()
+		return
+	}
+	c.lastUsed = time.Now()
+	p.idle = append(p.idle, c)
+}
+
+func (p *Pool) dial() (*conn, error) {
+	netConn, err := net.DialTimeout("tcp", p.opts.Addr, p.opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	netConn.SetDeadline(time.Now().Add(p.opts.Timeout))
+	client, err := smtp.NewClient(netConn, p.host)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: p.host})
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	if p.opts.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", p.opts.Username, p.opts.Password, p.host))
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return &conn{net: netConn, client: client}, nil
+}
+
+func (p *Pool) send(c *conn, to string, data []byte) error {
+	c.net.SetDeadline(time.Now().Add(p.opts.Timeout))
+	err := c.client.Mail(p.sender)
+	if err != nil {
+		return err
+	}
+	err = c.client.Rcpt(to)
+	if err != nil {
+		return err
+	}
+	w, err := c.client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (c *conn) quit() {
+	c.net.SetDeadline(time.Now().Add(time.Second))
+	if c.client.Quit() != nil {
+		c.client.Close()
+	}
+}
+
+// isReply reports whether err is the server's answer to a command, as
+// opposed to the connection failing.
+func isReply(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply)
+}
@@ -0,0 +1,128 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates renders messages from templates named after the file they're
+// read from:
+//
+//   - name.txt is the text body, and defines the subject in a "subject"
+//     block.
+//   - name.html is the optional HTML body.
+//   - name.json is optional sample data, used to send test messages.
+type Templates struct {
+	text    map[string]*texttemplate.Template
+	html    map[string]*htmltemplate.Template
+	samples map[string]json.RawMessage
+}
+
+// ParseTemplates reads the templates at the root of fsys.
+func ParseTemplates(fsys fs.FS) (*Templates, error) {
+	t := &Templates{
+		text:    map[string]*texttemplate.Template{},
+		html:    map[string]*htmltemplate.Template{},
+		samples: map[string]json.RawMessage{},
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := path.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		switch ext {
+		case ".txt":
+			tmpl, err := texttemplate.New(name).Option("missingkey=error").Parse(string(data))
+			if err != nil {
+				return nil, err
+			}
+			if tmpl.Lookup("subject") == nil {
+				return nil, fmt.Errorf("%s doesn't define a subject", entry.Name())
+			}
+			t.text[name] = tmpl
+		case ".html":
+			tmpl, err := htmltemplate.New(name).Option("missingkey=error").Parse(string(data))
+			if err != nil {
+				return nil, err
+			}
+			t.html[name] = tmpl
+		case ".json":
+			if !json.Valid(data) {
+				return nil, fmt.Errorf("%s isn't valid JSON", entry.Name())
+			}
+			t.samples[name] = data
+		}
+	}
+	for name := range t.html {
+		if t.text[name] == nil {
+			return nil, fmt.Errorf("%s.html has no %s.txt", name, name)
+		}
+	}
+	return t, nil
+}
+
+// Names returns the name of every template, sorted.
+func (t *Templates) Names() []string {
+	names := []string{}
+	for name := range t.text {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has reports whether the template name exists.
+func (t *Templates) Has(name string) bool {
+	return t.text[name] != nil
+}
+
+// Sample returns the sample data of a template, or nil if it has none.
+func (t *Templates) Sample(name string) json.RawMessage {
+	return t.samples[name]
+}
+
+// Render renders the template name with data, leaving the recipient unset.
+func (t *Templates) Render(name string, data interface{}) (Message, error) {
+	text, ok := t.text[name]
+	if !ok {
+		return Message{}, fmt.Errorf("template %s doesn't exist", name)
+	}
+	var subject, body bytes.Buffer
+	err := text.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return Message{}, err
+	}
+	err = text.Execute(&body, data)
+	if err != nil {
+		return Message{}, err
+	}
+	m := Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+	}
+	if html, ok := t.html[name]; ok {
+		var buf bytes.Buffer
+		err = html.Execute(&buf, data)
+		if err != nil {
+			return Message{}, err
+		}
+		m.HTML = buf.String()
+	}
+	return m, nil
+}
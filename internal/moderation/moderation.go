@@ -0,0 +1,140 @@
+// Package moderation checks the text of new posts through pluggable
+// filters: word lists, or an external moderation API.
+package moderation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// Action is what happens to a post.
+type Action string
+
+const (
+	Allow Action = "allow"
+	// Flag holds the post for an admin to review.
+	Flag   Action = "flag"
+	Reject Action = "reject"
+)
+
+var strictness = map[Action]int{Allow: 0, Flag: 1, Reject: 2}
+
+// Verdict is what a filter decided about a post, and why.
+type Verdict struct {
+	Action Action `json:"action"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Filter judges the text of a post.
+type Filter interface {
+	Check(ctx context.Context, text string) (Verdict, error)
+}
+
+// Pipeline runs filters in turn, returning the strictest verdict. It stops
+// at the first rejection.
+type Pipeline []Filter
+
+func (p Pipeline) Check(ctx context.Context, text string) (Verdict, error) {
+	verdict := Verdict{Action: Allow}
+	for _, filter := range p {
+		v, err := filter.Check(ctx, text)
+		if err != nil {
+			return Verdict{}, err
+		}
+		if strictness[v.Action] > strictness[verdict.Action] {
+			verdict = v
+		}
+		if verdict.Action == Reject {
+			break
+		}
+	}
+	return verdict, nil
+}
+
+// Wordlist rejects or flags posts containing listed words, ignoring case.
+type Wordlist struct {
+	Reject map[string]bool
+	Flag   map[string]bool
+}
+
+// ReadWords reads a word list, one word per line. Lines starting with "#"
+// are comments.
+func ReadWords(r io.Reader) (map[string]bool, error) {
+	words := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word != "" && !strings.HasPrefix(word, "#") {
+			words[word] = true
+		}
+	}
+	return words, scanner.Err()
+}
+
+func (l Wordlist) Check(ctx context.Context, text string) (Verdict, error) {
+	verdict := Verdict{Action: Allow}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if l.Reject[word] {
+			return Verdict{Action: Reject, Reason: fmt.Sprintf("contains %q", word)}, nil
+		}
+		if l.Flag[word] && verdict.Action == Allow {
+			verdict = Verdict{Action: Flag, Reason: fmt.Sprintf("contains %q", word)}
+		}
+	}
+	return verdict, nil
+}
+
+// API asks an external moderation service. It POSTs {"text": "..."} to URL
+// and expects a verdict back, like {"action": "flag", "reason": "spam"}.
+type API struct {
+	URL string
+	// APIKey is sent as a bearer token when set.
+	APIKey string
+	Client *http.Client
+}
+
+func (a API) Check(ctx context.Context, text string) (Verdict, error) {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return Verdict{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.APIKey)
+	}
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("moderation API: status %d", resp.StatusCode)
+	}
+	verdict := Verdict{}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&verdict)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("moderation API: %w", err)
+	}
+	if _, ok := strictness[verdict.Action]; !ok {
+		return Verdict{}, fmt.Errorf("moderation API: unknown action %q", verdict.Action)
+	}
+	return verdict, nil
+}
@@ -0,0 +1,84 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWordlist(t *testing.T) {
+	reject, err := ReadWords(strings.NewReader("# rejected\nViagra\n\ncasino\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := Wordlist{Reject: reject, Flag: map[string]bool{"crypto": true}}
+
+	var tests = []struct {
+		text     string
+		expected Verdict
+	}{
+		{text: "hello gophers", expected: Verdict{Action: Allow}},
+		{text: "Cheap VIAGRA!", expected: Verdict{Action: Reject, Reason: `contains "viagra"`}},
+		{text: "crypto is fun", expected: Verdict{Action: Flag, Reason: `contains "crypto"`}},
+		{text: "crypto casino", expected: Verdict{Action: Reject, Reason: `contains "casino"`}},
+		{text: "cryptography", expected: Verdict{Action: Allow}},
+	}
+	for _, tt := range tests {
+		got, err := words.Check(context.Background(), tt.text)
+		if err != nil || got != tt.expected {
+			t.Errorf("%q: got %+v, %v, want %+v", tt.text, got, err, tt.expected)
+		}
+	}
+}
+
+func TestAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		params := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&params)
+		switch params["text"] {
+		case "spam":
+			w.Write([]byte(`{"action": "flag", "reason": "spam"}`))
+		case "weird":
+			w.Write([]byte(`{"action": "delete"}`))
+		default:
+			w.Write([]byte(`{"action": "allow"}`))
+		}
+	}))
+	defer srv.Close()
+	api := API{URL: srv.URL, APIKey: "key"}
+	pipeline := Pipeline{Wordlist{Reject: map[string]bool{"casino": true}}, api}
+
+	var tests = []struct {
+		text      string
+		expected  Verdict
+		expectErr bool
+	}{
+		{text: "hello", expected: Verdict{Action: Allow}},
+		{text: "spam", expected: Verdict{Action: Flag, Reason: "spam"}},
+		{text: "weird", expectErr: true},
+		// rejected before asking the API
+		{text: "casino", expected: Verdict{Action: Reject, Reason: `contains "casino"`}},
+	}
+	for _, tt := range tests {
+		got, err := pipeline.Check(context.Background(), tt.text)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("%q: got error %v, want error %v", tt.text, err, tt.expectErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%q: got %+v, want %+v", tt.text, got, tt.expected)
+		}
+	}
+
+	_, err := API{URL: srv.URL}.Check(context.Background(), "hello")
+	if err == nil {
+		t.Error("got no error without the API key")
+	}
+}
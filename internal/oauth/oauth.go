@@ -0,0 +1,241 @@
+// Package oauth implements the OAuth 2.0 authorization code flow against
+// Google and GitHub, up to fetching the identity of the signed in user.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Identity is a user as known to a provider. Subject is the provider's
+// stable ID for the account, emails can change.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an OAuth 2.0 provider and the client registered with it.
+type Provider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	// EmailsURL lists the user's emails, for providers whose user info
+	// doesn't say whether the email is verified.
+	EmailsURL string
+	Scopes    []string
+	Client    *http.Client
+
+	parseUserInfo func(data []byte) (Identity, error)
+}
+
+// Google returns a provider using Google's OpenID Connect endpoints.
+func Google(clientID, clientSecret string) *Provider {
+	return &Provider{
+		Name:          "google",
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		AuthURL:       "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:      "https://oauth2.googleapis.com/token",
+		UserInfoURL:   "https://openidconnect.googleapis.com/v1/userinfo",
+		Scopes:        []string{"openid", "email", "profile"},
+		parseUserInfo: parseGoogleUserInfo,
+	}
+}
+
+// GitHub returns a provider using GitHub's OAuth app endpoints.
+func GitHub(clientID, clientSecret string) *Provider {
+	return &Provider{
+		Name:          "github",
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		AuthURL:       "https://github.com/login/oauth/authorize",
+		TokenURL:      "https://github.com/login/oauth/access_token",
+		UserInfoURL:   "https://api.github.com/user",
+		EmailsURL:     "https://api.github.com/user/emails",
+		Scopes:        []string{"read:user", "user:email"},
+		parseUserInfo: parseGitHubUserInfo,
+	}
+}
+
+// AuthCodeURL returns the provider's consent page URL. The provider sends
+// the user back to redirectURL with a code and the given state.
+func (p *Provider) AuthCodeURL(redirectURL, state string) string {
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.ClientID},
+		"redirect_uri":  {redirectURL},
+		"scope":         {strings.Join(p.Scopes, " ")},
+		"state":         {state},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + query.Encode()
+}
+
+// Exchange trades an authorization code for an access token. redirectURL
+// must be the one the code was requested with.
+func (p *Provider) Exchange(ctx context.Context, code, redirectURL string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub answers with a form encoded body otherwise
+	req.Header.Set("Accept", "application/json")
+	data, err := p.do(req)
+	if err != nil {
+		return "", fmt.Errorf("exchanging code: %w", err)
+	}
+	token := struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	err = json.Unmarshal(data, &token)
+	if err != nil {
+		return "", fmt.Errorf("exchanging code: %w", err)
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("exchanging code: %s: %s", token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("exchanging code: no access token in response")
+	}
+	return token.AccessToken, nil
+}
+
+// Identity fetches the user the access token belongs to.
+func (p *Provider) Identity(ctx context.Context, accessToken string) (Identity, error) {
+	data, err := p.get(ctx, p.UserInfoURL, accessToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("fetching user info: %w", err)
+	}
+	identity, err := p.parseUserInfo(data)
+	if err != nil {
+		return Identity{}, fmt.Errorf("fetching user info: %w", err)
+	}
+	identity.Provider = p.Name
+	if p.EmailsURL == "" {
+		return identity, nil
+	}
+
+	data, err = p.get(ctx, p.EmailsURL, accessToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("fetching emails: %w", err)
+	}
+	emails := []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}{}
+	err = json.Unmarshal(data, &emails)
+	if err != nil {
+		return Identity{}, fmt.Errorf("fetching emails: %w", err)
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+	return identity, nil
+}
+
+func (p *Provider) get(ctx context.Context, url, accessToken string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	return p.do(req)
+}
+
+func (p *Provider) do(req *http.Request) ([]byte, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, data)
+	}
+	return data, nil
+}
+
+func parseGoogleUserInfo(data []byte) (Identity, error) {
+	info := struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}{}
+	err := json.Unmarshal(data, &info)
+	if err != nil {
+		return Identity{}, err
+	}
+	if info.Sub == "" {
+		return Identity{}, errors.New("no subject in user info")
+	}
+	return Identity{
+		Subject:       info.Sub,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		Name:          info.Name,
+	}, nil
+}
+
+func parseGitHubUserInfo(data []byte) (Identity, error) {
+	info := struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}{}
+	err := json.Unmarshal(data, &info)
+	if err != nil {
+		return Identity{}, err
+	}
+	if info.ID == 0 {
+		return Identity{}, errors.New("no id in user info")
+	}
+	name := info.Name
+	if name == "" {
+		name = info.Login
+	}
+	// the email comes from the emails endpoint, which says if it's verified
+	return Identity{
+		Subject: strconv.FormatInt(info.ID, 10),
+		Name:    name,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAuthCodeURL(t *testing.T) {
+	p := Google("client", "secret")
+	u, err := url.Parse(p.AuthCodeURL("https://api.example.com/auth/google/callback", "xyz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	var tests = []struct {
+		key      string
+		expected string
+	}{
+		{key: "response_type", expected: "code"},
+		{key: "client_id", expected: "client"},
+		{key: "redirect_uri", expected: "https://api.example.com/auth/google/callback"},
+		{key: "scope", expected: "openid email profile"},
+		{key: "state", expected: "xyz"},
+	}
+	for _, tt := range tests {
+		if got := query.Get(tt.key); got != tt.expected {
+			t.Errorf("%s: got %q, want %q", tt.key, got, tt.expected)
+		}
+	}
+}
+
+func TestGitHubFlow(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good" || r.Form.Get("client_secret") != "secret" {
+			w.Write([]byte(`{"error": "bad_verification_code", "error_description": "The code passed is incorrect or expired."}`))
+			return
+		}
+		w.Write([]byte(`{"access_token": "token", "token_type": "bearer"}`))
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id": 42, "login": "gopher", "name": "", "email": null}`))
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"email": "old@example.com", "primary": false, "verified": true}, {"email": "gopher@example.com", "primary": true, "verified": true}]`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p := GitHub("client", "secret")
+	p.TokenURL = server.URL + "/token"
+	p.UserInfoURL = server.URL + "/user"
+	p.EmailsURL = server.URL + "/user/emails"
+
+	_, err := p.Exchange(context.Background(), "bad", "http://localhost/callback")
+	if err == nil {
+		t.Errorf("got no error exchanging a bad code")
+	}
+	token, err := p.Exchange(context.Background(), "good", "http://localhost/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := p.Identity(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Identity{Provider: "github", Subject: "42", Email: "gopher@example.com", EmailVerified: true, Name: "gopher"}
+	if identity != expected {
+		t.Errorf("got %+v, want %+v", identity, expected)
+	}
+}
@@ -0,0 +1,144 @@
+package openapi
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// specsFS holds one OpenAPI snapshot per release. Add a new snapshot to
+// specs/ whenever the API changes in a release.
+//
+//go:embed specs/*.json
+var specsFS embed.FS
+
+type Spec struct {
+	Info struct {
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+type Release struct {
+	Version          string   `json:"version"`
+	AddedEndpoints   []string `json:"addedEndpoints"`
+	RemovedEndpoints []string `json:"removedEndpoints"`
+	AddedFields      []string `json:"addedFields"`
+	RemovedFields    []string `json:"removedFields"`
+}
+
+// LoadSpecs reads the embedded snapshots ordered from oldest to newest.
+func LoadSpecs() ([]Spec, error) {
+	entries, err := specsFS.ReadDir("specs")
+	if err != nil {
+		return nil, err
+	}
+	specs := []Spec{}
+	for _, entry := range entries {
+		data, err := specsFS.ReadFile(path.Join("specs", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		spec := Spec{}
+		err = json.Unmarshal(data, &spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return compareVersions(specs[i].Info.Version, specs[j].Info.Version) < 0
+	})
+	return specs, nil
+}
+
+// Changelog lists what changed in every release, newest first. The oldest
+// snapshot is reported as adding everything it contains.
+func Changelog(specs []Spec) []Release {
+	releases := []Release{}
+	previous := Spec{}
+	for _, spec := range specs {
+		releases = append(releases, diff(previous, spec))
+		previous = spec
+	}
+	for i, j := 0, len(releases)-1; i < j; i, j = i+1, j-1 {
+		releases[i], releases[j] = releases[j], releases[i]
+	}
+	return releases
+}
+
+func diff(old, new Spec) Release {
+	oldEndpoints, newEndpoints := old.endpoints(), new.endpoints()
+	oldFields, newFields := old.fields(), new.fields()
+	return Release{
+		Version:          new.Info.Version,
+		AddedEndpoints:   missingFrom(oldEndpoints, newEndpoints),
+		RemovedEndpoints: missingFrom(newEndpoints, oldEndpoints),
+		AddedFields:      missingFrom(oldFields, newFields),
+		RemovedFields:    missingFrom(newFields, oldFields),
+	}
+}
+
+func (s Spec) endpoints() map[string]bool {
+	endpoints := map[string]bool{}
+	for p, operations := range s.Paths {
+		for method := range operations {
+			endpoints[strings.ToUpper(method)+" "+p] = true
+		}
+	}
+	return endpoints
+}
+
+func (s Spec) fields() map[string]bool {
+	fields := map[string]bool{}
+	for name, schema := range s.Components.Schemas {
+		for property := range schema.Properties {
+			fields[name+"."+property] = true
+		}
+	}
+	return fields
+}
+
+// missingFrom returns the sorted keys of b that aren't in a.
+func missingFrom(a, b map[string]bool) []string {
+	missing := []string{}
+	for key := range b {
+		if !a[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// compareVersions compares dotted numeric versions such as 1.10.0 and 1.9.2,
+// ignoring a leading "v".
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestChangelog(t *testing.T) {
+	parse := func(s string) Spec {
+		spec := Spec{}
+		err := json.Unmarshal([]byte(s), &spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return spec
+	}
+	old := parse(`{
+		"info": {"version": "1.9.0"},
+		"paths": {"/users": {"get": {}, "post": {}}},
+		"components": {"schemas": {"User": {"properties": {"email": {}, "age": {}}}}}
+	}`)
+	new := parse(`{
+		"info": {"version": "1.10.0"},
+		"paths": {"/users": {"post": {}}, "/posts": {"get": {}}},
+		"components": {"schemas": {"User": {"properties": {"email": {}, "name": {}}}}}
+	}`)
+
+	releases := Changelog([]Spec{old, new})
+	if len(releases) != 2 {
+		t.Fatalf("got %d releases, want 2", len(releases))
+	}
+	expected := Release{
+		Version:          "1.10.0",
+		AddedEndpoints:   []string{"GET /posts"},
+		RemovedEndpoints: []string{"GET /users"},
+		AddedFields:      []string{"User.name"},
+		RemovedFields:    []string{"User.age"},
+	}
+	if !reflect.DeepEqual(releases[0], expected) {
+		t.Errorf("got %+v, want %+v", releases[0], expected)
+	}
+	if releases[1].Version != "1.9.0" || len(releases[1].AddedEndpoints) != 2 {
+		t.Errorf("unexpected first release: %+v", releases[1])
+	}
+}
+
+func TestLoadSpecs(t *testing.T) {
+	specs, err := LoadSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(specs); i++ {
+		if compareVersions(specs[i-1].Info.Version, specs[i].Info.Version) >= 0 {
+			t.Errorf("specs out of order: %s before %s", specs[i-1].Info.Version, specs[i].Info.Version)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Package passhash hashes passwords for storage. Each hash is stored with a
+// tag naming the algorithm that made it, so the configured algorithm and
+// its cost can change without locking anyone out: older hashes still
+// verify, and NeedsRehash tells when to hash a password again at login.
+package passhash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Tags of the algorithms. Plain is the tag of passwords stored before they
+// were hashed, they verify until their next login rehashes them.
+const (
+	Plain    = ""
+	Bcrypt   = "bcrypt"
+	Scrypt   = "scrypt"
+	Argon2id = "argon2id"
+)
+
+// pepperSuffix ends the tags of hashes of peppered passwords.
+const pepperSuffix = "+pepper"
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrNoPepper         = errors.New("password was hashed with a pepper, but none is configured")
+	// ErrTooLong is returned for passwords bcrypt would truncate.
+	ErrTooLong = errors.New("password can't be longer than 72 bytes")
+)
+
+// ScryptParams are the cost of scrypt: N is a power of two.
+type ScryptParams struct {
+	N int
+	R int
+	P int
+}
+
+// DefaultScrypt is the cost recommended for interactive logins.
+var DefaultScrypt = ScryptParams{N: 1 << 15, R: 8, P: 1}
+
+const (
+	scryptSaltLength = 16
+	scryptKeyLength  = 32
+)
+
+// Argon2Params are the cost of argon2id: Memory is in KiB.
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// DefaultArgon2 is the second recommended option of RFC 9106, for memory
+// constrained servers.
+var DefaultArgon2 = Argon2Params{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Hasher hashes new passwords with the configured algorithm and verifies
+// those hashed with any algorithm.
+type Hasher struct {
+	// Algorithm hashes new passwords, Bcrypt when empty.
+	Algorithm string
+	// BcryptCost defaults to bcrypt.DefaultCost.
+	BcryptCost int
+	// Scrypt defaults to DefaultScrypt.
+	Scrypt ScryptParams
+	// Argon2 defaults to DefaultArgon2.
+	Argon2 Argon2Params
+	// Pepper is mixed into passwords before hashing when set. It's kept
+	// out of the database, so a leaked database alone can't be cracked.
+	Pepper []byte
+}
+
+// CheckAlgorithm returns an error for algorithms new passwords can't be
+// hashed with.
+func CheckAlgorithm(algorithm string) error {
+	if algorithm != Bcrypt && algorithm != Scrypt && algorithm != Argon2id {
+		return fmt.Errorf("%w: %q, want %s, %s or %s", ErrUnknownAlgorithm, algorithm, Bcrypt, Scrypt, Argon2id)
+	}
+	return nil
+}
+
+// CheckTag returns an error for tags of hashes that can't be verified.
+func CheckTag(tag string) error {
+	algorithm, _ := strings.CutSuffix(tag, pepperSuffix)
+	if algorithm == Plain && tag != Plain {
+		return fmt.Errorf("%w: %q", ErrUnknownAlgorithm, tag)
+	}
+	if algorithm == Plain {
+		return nil
+	}
+	return CheckAlgorithm(algorithm)
+}
+
+// Tag is the tag of the hashes h makes.
+func (h Hasher) Tag() string {
+	tag := h.algorithm()
+	if len(h.Pepper) > 0 {
+		tag += pepperSuffix
+	}
+	return tag
+}
+
+// Hash hashes password with a random salt, and returns the tag to store
+// with it.
+func (h Hasher) Hash(password string) (hash, tag string, err error) {
+	secret := h.pepper([]byte(password))
+	switch h.algorithm() {
+	case Bcrypt:
+		if len(secret) > 72 {
+			return "", "", ErrTooLong
+		}
+		b, err := bcrypt.GenerateFromPassword(secret, h.bcryptCost())
+		if err != nil {
+			return "", "", err
+		}
+		return string(b), h.Tag(), nil
+	case Scrypt:
+		params := h.scryptParams()
+		salt := make([]byte, scryptSaltLength)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return "", "", err
+		}
+		key, err := scrypt.Key(secret, salt, params.N, params.R, params.P, scryptKeyLength)
+		if err != nil {
+			return "", "", err
+		}
+		return encodeScrypt(params, salt, key), h.Tag(), nil
+	case Argon2id:
+		params := h.argon2Params()
+		salt := make([]byte, argon2SaltLength)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return "", "", err
+		}
+		key := argon2.IDKey(secret, salt, params.Time, params.Memory, params.Threads, argon2KeyLength)
+		return encodeArgon2(params, salt, key), h.Tag(), nil
+	default:
+		return "", "", CheckAlgorithm(h.Algorithm)
+	}
+}
+
+// Verify reports whether password matches a hash stored with tag.
+func (h Hasher) Verify(password, hash, tag string) (bool, error) {
+	err := CheckTag(tag)
+	if err != nil {
+		return false, err
+	}
+	secret := []byte(password)
+	algorithm, peppered := strings.CutSuffix(tag, pepperSuffix)
+	if peppered {
+		if len(h.Pepper) == 0 {
+			return false, ErrNoPepper
+		}
+		secret = h.pepper(secret)
+	}
+	switch algorithm {
+	case Bcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), secret)
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case Scrypt:
+		params, salt, key, err := decodeScrypt(hash)
+		if err != nil {
+			return false, err
+		}
+		got, err := scrypt.Key(secret, salt, params.N, params.R, params.P, len(key))
+		if err != nil {
+			return false, err
+		}
+		return subtle.ConstantTimeCompare(got, key) == 1, nil
+	case Argon2id:
+		params, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false, err
+		}
+		got := argon2.IDKey(secret, salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(got, key) == 1, nil
+	default:
+		return subtle.ConstantTimeCompare(secret, []byte(hash)) == 1, nil
+	}
+}
+
+// NeedsRehash reports whether a hash stored with tag wasn't made with the
+// algorithm, cost and pepper of h.
+func (h Hasher) NeedsRehash(hash, tag string) bool {
+	if tag != h.Tag() {
+		return true
+	}
+	switch h.algorithm() {
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.bcryptCost()
+	case Scrypt:
+		params, _, _, err := decodeScrypt(hash)
+		return err != nil || params != h.scryptParams()
+	case Argon2id:
+		params, _, _, err := decodeArgon2(hash)
+		return err != nil || params != h.argon2Params()
+	}
+	return true
+}
+
+func (h Hasher) algorithm() string {
+	if h.Algorithm == "" {
+		return Bcrypt
+	}
+	return h.Algorithm
+}
+
+func (h Hasher) bcryptCost() int {
+	if h.BcryptCost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return h.BcryptCost
+}
+
+func (h Hasher) scryptParams() ScryptParams {
+	if h.Scrypt == (ScryptParams{}) {
+		return DefaultScrypt
+	}
+	return h.Scrypt
+}
+
+func (h Hasher) argon2Params() Argon2Params {
+	if h.Argon2 == (Argon2Params{}) {
+		return DefaultArgon2
+	}
+	return h.Argon2
+}
+
+// pepper keys an HMAC of password with the pepper. Its base64 form fits in
+// the 72 bytes bcrypt hashes.
+func (h Hasher) pepper(password []byte) []byte {
+	if len(h.Pepper) == 0 {
+		return password
+	}
+	mac := hmac.New(sha256.New, h.Pepper)
+	mac.Write(password)
+	return []byte(base64.RawStdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// encodeScrypt formats a scrypt hash like the PHC string format:
+// $scrypt$n=32768,r=8,p=1$salt$key.
+func encodeScrypt(params ScryptParams, salt, key []byte) string {
+	return fmt.Sprintf("$scrypt$n=%d,r=%d,p=%d$%s$%s", params.N, params.R, params.P,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeScrypt(hash string) (ScryptParams, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[0] != "" || parts[1] != Scrypt {
+		return ScryptParams{}, nil, nil, errors.New("malformed scrypt hash")
+	}
+	params := ScryptParams{}
+	_, err := fmt.Sscanf(parts[2], "n=%d,r=%d,p=%d", &params.N, &params.R, &params.P)
+	if err != nil {
+		return ScryptParams{}, nil, nil, fmt.Errorf("malformed scrypt hash: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return ScryptParams{}, nil, nil, fmt.Errorf("malformed scrypt hash: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return ScryptParams{}, nil, nil, fmt.Errorf("malformed scrypt hash: %w", err)
+	}
+	return params, salt, key, nil
+}
+
+// encodeArgon2 formats an argon2id hash in the PHC string format used by
+// the reference implementation: $argon2id$v=19$m=65536,t=3,p=4$salt$key.
+func encodeArgon2(params Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != Argon2id {
+		return Argon2Params{}, nil, nil, errors.New("malformed argon2id hash")
+	}
+	version := 0
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+	if version != argon2.Version {
+		return Argon2Params{}, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	params := Argon2Params{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,134 @@
+package passhash
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheapScrypt keeps the tests fast, the costs don't change what they check.
+var (
+	cheapScrypt = ScryptParams{N: 1 << 4, R: 8, P: 1}
+	cheapArgon2 = Argon2Params{Time: 1, Memory: 64, Threads: 1}
+)
+
+func TestHashVerify(t *testing.T) {
+	var tests = []struct {
+		name   string
+		hasher Hasher
+		tag    string
+	}{
+		{name: "bcrypt", hasher: Hasher{BcryptCost: bcrypt.MinCost}, tag: "bcrypt"},
+		{name: "scrypt", hasher: Hasher{Algorithm: Scrypt, Scrypt: cheapScrypt}, tag: "scrypt"},
+		{name: "peppered bcrypt", hasher: Hasher{BcryptCost: bcrypt.MinCost, Pepper: []byte("pepper")}, tag: "bcrypt+pepper"},
+		{name: "peppered scrypt", hasher: Hasher{Algorithm: Scrypt, Scrypt: cheapScrypt, Pepper: []byte("pepper")}, tag: "scrypt+pepper"},
+		{name: "argon2id", hasher: Hasher{Algorithm: Argon2id, Argon2: cheapArgon2}, tag: "argon2id"},
+		{name: "peppered argon2id", hasher: Hasher{Algorithm: Argon2id, Argon2: cheapArgon2, Pepper: []byte("pepper")}, tag: "argon2id+pepper"},
+	}
+	for _, tt := range tests {
+		hash, tag, err := tt.hasher.Hash("correct horse")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tag != tt.tag {
+			t.Errorf("%s: got tag %q, want %q", tt.name, tag, tt.tag)
+		}
+		if hash == "correct horse" {
+			t.Errorf("%s: password stored as is", tt.name)
+		}
+		ok, err := tt.hasher.Verify("correct horse", hash, tag)
+		if err != nil || !ok {
+			t.Errorf("%s: right password: got %v, %v", tt.name, ok, err)
+		}
+		ok, err = tt.hasher.Verify("wrong horse", hash, tag)
+		if err != nil || ok {
+			t.Errorf("%s: wrong password: got %v, %v", tt.name, ok, err)
+		}
+		if tt.hasher.NeedsRehash(hash, tag) {
+			t.Errorf("%s: fresh hash needs rehash", tt.name)
+		}
+	}
+}
+
+func TestVerifyAcrossAlgorithms(t *testing.T) {
+	old := Hasher{BcryptCost: bcrypt.MinCost, Pepper: []byte("pepper")}
+	hash, tag, err := old.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// switching algorithm keeps old hashes working until they're rehashed
+	current := Hasher{Algorithm: Scrypt, Scrypt: cheapScrypt, Pepper: []byte("pepper")}
+	ok, err := current.Verify("correct horse", hash, tag)
+	if err != nil || !ok {
+		t.Errorf("got %v, %v", ok, err)
+	}
+	if !current.NeedsRehash(hash, tag) {
+		t.Error("bcrypt hash doesn't need rehash with scrypt configured")
+	}
+
+	// peppered hashes can't be checked without the pepper
+	_, err = Hasher{}.Verify("correct horse", hash, tag)
+	if !errors.Is(err, ErrNoPepper) {
+		t.Errorf("got %v, want %v", err, ErrNoPepper)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, _, err := Hasher{BcryptCost: bcrypt.MinCost}.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scryptHash, _, err := Hasher{Algorithm: Scrypt, Scrypt: cheapScrypt}.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon2Hash, _, err := Hasher{Algorithm: Argon2id, Argon2: cheapArgon2}.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name     string
+		hasher   Hasher
+		hash     string
+		tag      string
+		expected bool
+	}{
+		{name: "plain", hasher: Hasher{}, hash: "correct horse", tag: Plain, expected: true},
+		{name: "same bcrypt cost", hasher: Hasher{BcryptCost: bcrypt.MinCost}, hash: bcryptHash, tag: Bcrypt},
+		{name: "higher bcrypt cost", hasher: Hasher{BcryptCost: bcrypt.MinCost + 1}, hash: bcryptHash, tag: Bcrypt, expected: true},
+		{name: "same scrypt cost", hasher: Hasher{Algorithm: Scrypt, Scrypt: cheapScrypt}, hash: scryptHash, tag: Scrypt},
+		{name: "higher scrypt cost", hasher: Hasher{Algorithm: Scrypt, Scrypt: ScryptParams{N: 1 << 5, R: 8, P: 1}}, hash: scryptHash, tag: Scrypt, expected: true},
+		{name: "same argon2id cost", hasher: Hasher{Algorithm: Argon2id, Argon2: cheapArgon2}, hash: argon2Hash, tag: Argon2id},
+		{name: "more argon2id memory", hasher: Hasher{Algorithm: Argon2id, Argon2: Argon2Params{Time: 1, Memory: 128, Threads: 1}}, hash: argon2Hash, tag: Argon2id, expected: true},
+		{name: "bcrypt to argon2id", hasher: Hasher{Algorithm: Argon2id, Argon2: cheapArgon2}, hash: bcryptHash, tag: Bcrypt, expected: true},
+		{name: "pepper added", hasher: Hasher{BcryptCost: bcrypt.MinCost, Pepper: []byte("pepper")}, hash: bcryptHash, tag: Bcrypt, expected: true},
+	}
+	for _, tt := range tests {
+		if got := tt.hasher.NeedsRehash(tt.hash, tt.tag); got != tt.expected {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestCheckTag(t *testing.T) {
+	var tests = []struct {
+		tag   string
+		valid bool
+	}{
+		{Plain, true},
+		{"bcrypt", true},
+		{"scrypt+pepper", true},
+		{"argon2id", true},
+		{"argon2id+pepper", true},
+		{"+pepper", false},
+		{"md5", false},
+	}
+	for _, tt := range tests {
+		if err := CheckTag(tt.tag); (err == nil) != tt.valid {
+			t.Errorf("%q: got %v", tt.tag, err)
+		}
+	}
+}
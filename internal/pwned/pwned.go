@@ -0,0 +1,60 @@
+// Package pwned checks passwords against the Pwned Passwords range API.
+// Passwords never leave the server: only the first five characters of
+// their SHA-1 hash are sent, and the API answers with every hash sharing
+// them (k-anonymity).
+package pwned
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultURL is the public Pwned Passwords API.
+const DefaultURL = "https://api.pwnedpasswords.com"
+
+type Client struct {
+	// URL is the API's base URL, DefaultURL or a mirror of it.
+	URL    string
+	Client *http.Client
+}
+
+// Breached reports whether password appeared in a known data breach.
+func (c Client) Breached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.URL, "/")+"/range/"+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// padding hides how many hashes share the prefix from eavesdroppers
+	req.Header.Set("Add-Padding", "true")
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("pwned passwords: %s", resp.Status)
+	}
+
+	// each line is a hash suffix and how often it was seen, padding with 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return count != "0", nil
+		}
+	}
+	return false, scanner.Err()
+}
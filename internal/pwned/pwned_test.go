@@ -0,0 +1,38 @@
+package pwned
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBreached(t *testing.T) {
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/range/5BAA6" {
+			w.Write([]byte("0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n"))
+			return
+		}
+		w.Write([]byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n"))
+	}))
+	defer server.Close()
+	c := Client{URL: server.URL}
+
+	var tests = []struct {
+		password string
+		expected bool
+	}{
+		{"password", true},
+		{"correct horse battery staple", false},
+	}
+	for _, tt := range tests {
+		breached, err := c.Breached(context.Background(), tt.password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if breached != tt.expected {
+			t.Errorf("%q: got breached %v, want %v", tt.password, breached, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenField
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators are ordered so that longer ones are tried first.
+var operators = []string{"==", "!=", "<=", ">=", "<", ">", "~"}
+
+// tokenize splits a filter into tokens, ending with a tokenEnd.
+func tokenize(s string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")", pos: i})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, SyntaxError{Pos: i, Msg: "unterminated string"}
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, SyntaxError{Pos: i, Msg: "invalid string"}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i = end + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(s) && strings.IndexByte("0123456789.eE+-", s[end]) >= 0 {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: s[i:end], pos: i})
+			i = end
+		case isFieldByte(c):
+			end := i + 1
+			for end < len(s) && (isFieldByte(s[end]) || s[end] == '.' || (s[end] >= '0' && s[end] <= '9')) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenField, text: s[i:end], pos: i})
+			i = end
+		default:
+			operator := ""
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" {
+				return nil, SyntaxError{Pos: i, Msg: fmt.Sprintf("unexpected %q", c)}
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: operator, pos: i})
+			i += len(operator)
+		}
+	}
+	return append(tokens, token{kind: tokenEnd, text: "end of filter", pos: len(s)}), nil
+}
+
+func isFieldByte(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c))
+}
+
+// parser is a recursive descent parser, and binds not tighter than and,
+// and and tighter than or.
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+// keyword takes the next token if it's the keyword word.
+func (p *parser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokenField && t.text == word {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	for err == nil && p.keyword("or") {
+		var right node
+		right, err = p.and()
+		left = orNode{left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	for err == nil && p.keyword("and") {
+		var right node
+		right, err = p.unary()
+		left = andNode{left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *parser) unary() (node, error) {
+	if p.keyword("not") {
+		operand, err := p.unary()
+		return notNode{operand: operand}, err
+	}
+	if p.peek().kind != tokenOpen {
+		return p.comparison()
+	}
+	p.take()
+	inner, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.take(); t.kind != tokenClose {
+		return nil, SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected ) but got %q", t.text)}
+	}
+	return inner, nil
+}
+
+func (p *parser) comparison() (node, error) {
+	field := p.take()
+	if field.kind != tokenField {
+		return nil, SyntaxError{Pos: field.pos, Msg: fmt.Sprintf("expected a field but got %q", field.text)}
+	}
+	path := strings.Split(field.text, ".")
+	for _, name := range path {
+		if name == "" {
+			return nil, SyntaxError{Pos: field.pos, Msg: fmt.Sprintf("invalid field %q", field.text)}
+		}
+	}
+	op := p.take()
+	if op.kind != tokenOperator {
+		return nil, SyntaxError{Pos: op.pos, Msg: fmt.Sprintf("expected an operator but got %q", op.text)}
+	}
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := value.(string); op.text == "~" && !ok {
+		return nil, SyntaxError{Pos: op.pos, Msg: "~ only matches strings"}
+	}
+	return comparison{path: path, op: op.text, value: value}, nil
+}
+
+func (p *parser) value() (interface{}, error) {
+	t := p.take()
+	switch {
+	case t.kind == tokenString:
+		return t.text, nil
+	case t.kind == tokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("invalid number %q", t.text)}
+		}
+		return n, nil
+	case t.kind == tokenField && t.text == "true":
+		return true, nil
+	case t.kind == tokenField && t.text == "false":
+		return false, nil
+	case t.kind == tokenField && t.text == "null":
+		return nil, nil
+	}
+	return nil, SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected a value but got %q", t.text)}
+}
@@ -0,0 +1,221 @@
+// Package query is a small filter language matching JSON records, such as
+//
+//	age >= 18 and (name ~ "ann" or not private == true)
+//
+// Fields are dotted paths into the record, a field holding an array matches
+// when any of its elements does. Values are strings in double quotes,
+// numbers, true, false and null; missing fields are null. The operators are
+// ==, !=, <, <=, >, >= and ~, a case-insensitive substring match. Strings
+// order lexically, which orders RFC 3339 timestamps by time.
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Filter is a parsed filter. The zero Filter matches every record.
+type Filter struct {
+	root node
+}
+
+// SyntaxError is a filter that can't be parsed. Pos is the byte offset at
+// which parsing failed.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+// Parse parses a filter, an empty or blank one matches every record.
+func Parse(s string) (Filter, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return Filter{}, err
+	}
+	if len(tokens) == 1 {
+		return Filter{}, nil
+	}
+	p := parser{tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return Filter{}, err
+	}
+	if next := p.peek(); next.kind != tokenEnd {
+		return Filter{}, SyntaxError{Pos: next.pos, Msg: fmt.Sprintf("unexpected %q", next.text)}
+	}
+	return Filter{root: root}, nil
+}
+
+// Match reports whether the JSON record matches the filter.
+func (f Filter) Match(record []byte) (bool, error) {
+	if f.root == nil {
+		return true, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(record))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return false, err
+	}
+	return f.root.match(value), nil
+}
+
+// Fields returns the dotted paths of the fields the filter compares.
+func (f Filter) Fields() []string {
+	fields := []string{}
+	var walk func(n node)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case andNode:
+			walk(n.left)
+			walk(n.right)
+		case orNode:
+			walk(n.left)
+			walk(n.right)
+		case notNode:
+			walk(n.operand)
+		case comparison:
+			fields = append(fields, strings.Join(n.path, "."))
+		}
+	}
+	if f.root != nil {
+		walk(f.root)
+	}
+	return fields
+}
+
+type node interface {
+	match(record interface{}) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) match(record interface{}) bool {
+	return n.left.match(record) && n.right.match(record)
+}
+
+type orNode struct{ left, right node }
+
+func (n orNode) match(record interface{}) bool {
+	return n.left.match(record) || n.right.match(record)
+}
+
+type notNode struct{ operand node }
+
+func (n notNode) match(record interface{}) bool {
+	return !n.operand.match(record)
+}
+
+type comparison struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+func (c comparison) match(record interface{}) bool {
+	field := lookup(record, c.path)
+	elements, ok := field.([]interface{})
+	if !ok {
+		return c.compare(field)
+	}
+	// != holds when no element equals the value
+	if c.op == "!=" {
+		for _, element := range elements {
+			if !c.compare(element) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, element := range elements {
+		if c.compare(element) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare compares a single field value, values of different types are
+// only ever unequal.
+func (c comparison) compare(field interface{}) bool {
+	if c.op == "~" {
+		s, ok := field.(string)
+		return ok && strings.Contains(strings.ToLower(s), strings.ToLower(c.value.(string)))
+	}
+	order, comparable := compareValues(field, c.value)
+	switch c.op {
+	case "==":
+		return comparable && order == 0
+	case "!=":
+		return !comparable || order != 0
+	}
+	if !comparable || field == nil {
+		return false
+	}
+	switch c.op {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	}
+	return order >= 0
+}
+
+// compareValues orders a field value against a filter value, and reports
+// whether they're of the same type at all.
+func compareValues(field, value interface{}) (int, bool) {
+	switch value := value.(type) {
+	case nil:
+		return 0, field == nil
+	case bool:
+		b, ok := field.(bool)
+		if !ok || b == value {
+			return 0, ok
+		}
+		if value {
+			return -1, true
+		}
+		return 1, true
+	case string:
+		s, ok := field.(string)
+		return strings.Compare(s, value), ok
+	case float64:
+		n, ok := field.(json.Number)
+		if !ok {
+			return 0, false
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return 0, false
+		}
+		switch {
+		case f < value:
+			return -1, true
+		case f > value:
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// lookup follows path into record, returning nil when a field is missing.
+func lookup(record interface{}, path []string) interface{} {
+	for _, name := range path {
+		object, ok := record.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		record = object[name]
+	}
+	return record
+}
@@ -0,0 +1,127 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const record = `{
+	"name": "Ann Lee",
+	"age": 31,
+	"private": true,
+	"createdAt": "2024-03-01T10:00:00Z",
+	"tags": ["go", "web"],
+	"metadata": {"deadLinks": ["https://example.com"], "score": 0.5},
+	"bio": null
+}`
+
+func TestMatch(t *testing.T) {
+	var tests = []struct {
+		filter   string
+		expected bool
+	}{
+		{"", true},
+		{"   ", true},
+		{`name == "Ann Lee"`, true},
+		{`name != "Ann Lee"`, false},
+		{`name ~ "ann"`, true},
+		{`name ~ "bob"`, false},
+		{"age > 30", true},
+		{"age >= 31", true},
+		{"age < 31", false},
+		{"age <= 31.0", true},
+		{"age == 31", true},
+		{`age == "31"`, false},
+		{`age != "31"`, true},
+		{"private == true", true},
+		{"private == false", false},
+		{"bio == null", true},
+		{"missing == null", true},
+		{"missing != null", false},
+		{"missing > 1", false},
+		{`createdAt >= "2024-01-01"`, true},
+		{`createdAt < "2024-01-01"`, false},
+		{`tags == "go"`, true},
+		{`tags == "rust"`, false},
+		{`tags != "go"`, false},
+		{`tags != "rust"`, true},
+		{`tags ~ "WE"`, true},
+		{"metadata.score < 1", true},
+		{`metadata.deadLinks ~ "example"`, true},
+		{"name.first == null", true},
+		{"age > 30 and private == true", true},
+		{"age > 40 or private == true", true},
+		{"age > 40 and private == true", false},
+		{"not age > 40", true},
+		{"not not age > 40", false},
+		{`age > 40 or name ~ "ann" and private == false`, false},
+		{`(age > 40 or name ~ "ann") and not private == false`, true},
+		{"age>30 and(private==true)", true},
+		{"age == -1", false},
+	}
+	for _, tt := range tests {
+		filter, err := Parse(tt.filter)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.filter, err)
+			continue
+		}
+		got, err := filter.Match([]byte(record))
+		if err != nil {
+			t.Errorf("%q: %v", tt.filter, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%q: got %v, want %v", tt.filter, got, tt.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var tests = []struct {
+		filter string
+		pos    int
+	}{
+		{"age", 3},
+		{"age >", 5},
+		{"age > 1 and", 11},
+		{"age > 1 age < 2", 8},
+		{`name == "ann`, 8},
+		{"(age > 1", 8},
+		{"age = 1", 4},
+		{"age ~ 1", 4},
+		{"== 1", 0},
+		{"age > 1-", 6},
+		{"a..b == 1", 0},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.filter)
+		syntaxErr := SyntaxError{}
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q): got %v, want a syntax error", tt.filter, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.pos {
+			t.Errorf("Parse(%q): got error %q, want it at position %d", tt.filter, err, tt.pos)
+		}
+	}
+}
+
+func TestMatchInvalidRecord(t *testing.T) {
+	filter, _ := Parse("age > 1")
+	_, err := filter.Match([]byte("{"))
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestFields(t *testing.T) {
+	filter, err := Parse(`name ~ "ann" and not (metadata.score > 1 or name == "Bob")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"name", "metadata.score", "name"}
+	if got := filter.Fields(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
@@ -0,0 +1,117 @@
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// LeaseState is who holds the primary's lease, and until when.
+type LeaseState struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Lease is a file shared by the instances of a deployment, e.g. on an NFS
+// mount, naming the one allowed to accept writes. The primary renews it
+// while it's up; a standby takes it over only once it has expired, so two
+// instances never both act as primary.
+type Lease struct {
+	path   string
+	holder string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewLease(path, holder string, ttl time.Duration) *Lease {
+	return &Lease{path: path, holder: holder, ttl: ttl, now: time.Now}
+}
+
+// Acquire takes or renews the lease for another TTL. It fails when another
+// instance holds a lease that hasn't expired, returning who holds it.
+func (l *Lease) Acquire() (LeaseState, bool, error) {
+	unlock, err := l.lock()
+	if err != nil {
+		return LeaseState{}, false, err
+	}
+	defer unlock()
+	state, err := l.Read()
+	if err != nil {
+		return LeaseState{}, false, err
+	}
+	now := l.now().UTC()
+	if state.Holder != "" && state.Holder != l.holder && now.Before(state.ExpiresAt) {
+		return state, false, nil
+	}
+	state = LeaseState{Holder: l.holder, ExpiresAt: now.Add(l.ttl)}
+	return state, true, l.write(state)
+}
+
+// Release gives up the lease if this instance holds it, so a standby can
+// take over without waiting for it to expire.
+func (l *Lease) Release() error {
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	state, err := l.Read()
+	if err != nil || state.Holder != l.holder {
+		return err
+	}
+	return os.Remove(l.path)
+}
+
+// Read returns the current state of the lease, empty when nobody has taken
+// it yet.
+func (l *Lease) Read() (LeaseState, error) {
+	state := LeaseState{}
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return state, fmt.Errorf("lease %s: %w", l.path, err)
+	}
+	return state, nil
+}
+
+func (l *Lease) write(state LeaseState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// lock keeps other instances from changing the lease meanwhile. A lock left
+// behind by a crashed instance is broken once it's older than the TTL.
+func (l *Lease) lock() (func(), error) {
+	path := l.path + ".lock"
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		info, statErr := os.Stat(path)
+		if attempt > 0 || statErr != nil || l.now().Sub(info.ModTime()) < l.ttl {
+			return nil, fmt.Errorf("lease %s is locked by another instance", l.path)
+		}
+		os.Remove(path)
+	}
+}
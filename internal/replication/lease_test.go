@@ -0,0 +1,78 @@
+package replication
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "primary.lease")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	a, b := NewLease(path, "a", 10*time.Second), NewLease(path, "b", 10*time.Second)
+	a.now, b.now = clock, clock
+
+	_, ok, err := a.Acquire()
+	if err != nil || !ok {
+		t.Fatalf("a: got %v, %v, want the lease", ok, err)
+	}
+	state, ok, err := b.Acquire()
+	if err != nil || ok || state.Holder != "a" {
+		t.Fatalf("b: got %+v, %v, %v, want the lease held by a", state, ok, err)
+	}
+
+	// a renews before it expires
+	now = now.Add(5 * time.Second)
+	state, ok, err = a.Acquire()
+	if err != nil || !ok || !state.ExpiresAt.Equal(now.Add(10*time.Second)) {
+		t.Fatalf("a renewing: got %+v, %v, %v", state, ok, err)
+	}
+
+	// b takes over once it has expired
+	now = now.Add(11 * time.Second)
+	_, ok, err = b.Acquire()
+	if err != nil || !ok {
+		t.Fatalf("b after expiry: got %v, %v, want the lease", ok, err)
+	}
+	_, ok, err = a.Acquire()
+	if err != nil || ok {
+		t.Fatalf("a after b took over: got %v, %v, want the lease refused", ok, err)
+	}
+
+	// releasing someone else's lease leaves it in place
+	err = a.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err = a.Read()
+	if err != nil || state.Holder != "b" {
+		t.Fatalf("got %+v, %v, want the lease still held by b", state, err)
+	}
+	err = b.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok, err = a.Acquire()
+	if err != nil || !ok {
+		t.Fatalf("a after b released: got %v, %v, want the lease", ok, err)
+	}
+
+	// a lock left behind by a crashed instance is broken after the TTL
+	err = os.WriteFile(path+".lock", nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockedAt := time.Now()
+	now = lockedAt.Add(time.Second)
+	_, _, err = a.Acquire()
+	if err == nil {
+		t.Error("expected an error while the lease is locked")
+	}
+	now = lockedAt.Add(time.Minute)
+	_, ok, err = a.Acquire()
+	if err != nil || !ok {
+		t.Errorf("after the lock went stale: got %v, %v, want the lease", ok, err)
+	}
+}
@@ -0,0 +1,156 @@
+package replication
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// Entry is one database write. Offsets start at 1 and increase by one per
+// entry, so a replica can ask for everything after the last offset it
+// applied.
+type Entry struct {
+	Offset    int64               `json:"offset"`
+	Time      time.Time           `json:"time"`
+	Mutations []database.Mutation `json:"mutations"`
+}
+
+// Log is an append-only file of entries, one JSON document per line.
+type Log struct {
+	path string
+
+	mu   sync.Mutex
+	last int64
+}
+
+func OpenLog(path string) (*Log, error) {
+	l := &Log{path: path}
+	err := l.scan(func(entry Entry) bool {
+		l.last = entry.Offset
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Size returns the size of the log file in bytes, 0 before the first
+// entry.
+func (l *Log) Size() (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	info, err := os.Stat(l.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (l *Log) LastOffset() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last
+}
+
+// Append records mutations as the next entry.
+func (l *Log) Append(mutations []database.Mutation) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := Entry{
+		Offset:    l.last + 1,
+		Time:      time.Now().UTC(),
+		Mutations: mutations,
+	}
+	return entry, l.write(entry)
+}
+
+// AppendEntry records an entry received from the primary, keeping its offset.
+func (l *Log) AppendEntry(entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if entry.Offset != l.last+1 {
+		return fmt.Errorf("expected offset %d, got %d", l.last+1, entry.Offset)
+	}
+	return l.write(entry)
+}
+
+// Read returns up to limit entries with an offset greater than after.
+func (l *Log) Read(after int64, limit int) ([]Entry, error) {
+	entries := []Entry{}
+	err := l.scan(func(entry Entry) bool {
+		if entry.Offset > after {
+			entries = append(entries, entry)
+		}
+		return len(entries) < limit
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (l *Log) write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	l.last = entry.Offset
+	return nil
+}
+
+func (l *Log) scan(fn func(Entry) bool) error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		entry := Entry{}
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return err
+		}
+		if !fn(entry) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// Replay rebuilds the database as it was at time t from every entry logged
+// up to then. It is only accurate if the log covers the database's whole
+// history, starting from an empty database.
+func (l *Log) Replay(t time.Time) ([]byte, error) {
+	batches := [][]database.Mutation{}
+	err := l.scan(func(entry Entry) bool {
+		if entry.Time.After(t) {
+			return false
+		}
+		batches = append(batches, entry.Mutations)
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return database.ReplayMutations(batches)
+}
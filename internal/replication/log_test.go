@@ -0,0 +1,46 @@
+package replication
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replication.log")
+	l, err := OpenLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := l.Append([]database.Mutation{{Collection: "users", Key: "test@example.com"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := OpenLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.LastOffset() != 3 {
+		t.Errorf("got last offset %d, want 3", reopened.LastOffset())
+	}
+	entries, err := reopened.Read(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Offset != 2 {
+		t.Errorf("got %+v, want only offset 2", entries)
+	}
+
+	err = reopened.AppendEntry(Entry{Offset: 5})
+	if err == nil {
+		t.Errorf("expected an error for an offset gap")
+	}
+	err = reopened.AppendEntry(Entry{Offset: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,432 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+type Role string
+
+const (
+	RolePrimary   Role = "primary"
+	RoleSecondary Role = "secondary"
+	// RoleStandby follows the primary like a secondary, and takes over when
+	// the primary stops responding.
+	RoleStandby Role = "standby"
+)
+
+const (
+	maxConflicts = 100
+	batchSize    = 100
+)
+
+// Conflict is a mutation from the primary that didn't match the local copy
+// of the record. The primary's version always wins; conflicts are kept so
+// operators can inspect what was overwritten.
+type Conflict struct {
+	Offset   int64             `json:"offset"`
+	Mutation database.Mutation `json:"mutation"`
+	Time     time.Time         `json:"time"`
+}
+
+type Status struct {
+	Role       Role       `json:"role"`
+	Offset     int64      `json:"offset"`
+	PrimaryURL string     `json:"primaryUrl,omitempty"`
+	LastSyncAt *time.Time `json:"lastSyncAt,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+	Conflicts  []Conflict `json:"conflicts"`
+	// FailedChecks counts the primary's failed health checks in a row, on a
+	// standby.
+	FailedChecks int         `json:"failedChecks,omitempty"`
+	Lease        *LeaseState `json:"lease,omitempty"`
+}
+
+// Failover settings coordinate a primary and its standbys through a lease.
+type Failover struct {
+	Lease *Lease
+	// CheckInterval is how often a standby checks the primary's health, and
+	// how often the primary renews its lease.
+	CheckInterval time.Duration
+	// FailAfter is how many health checks in a row must fail before a
+	// standby takes over.
+	FailAfter int
+}
+
+// Node replicates database writes. A primary records every write in its log
+// and serves the log to secondaries; a secondary polls the primary's log and
+// applies the entries to its own database until it is promoted. A standby
+// also promotes itself when the primary fails its health checks.
+type Node struct {
+	log          *Log
+	db           database.Client
+	primaryURL   string
+	pollInterval time.Duration
+	client       *http.Client
+	failover     Failover
+	onPromote    func()
+
+	mu           sync.Mutex
+	role         Role
+	cancel       context.CancelFunc
+	stopWatch    context.CancelFunc
+	lastSyncAt   *time.Time
+	lastError    string
+	conflicts    []Conflict
+	failedChecks int
+	lease        *LeaseState
+}
+
+func NewNode(l *Log, db database.Client, role Role, primaryURL string, pollInterval time.Duration) (*Node, error) {
+	if role != RolePrimary && role != RoleSecondary && role != RoleStandby {
+		return nil, fmt.Errorf("unknown replication role: %s", role)
+	}
+	if role != RolePrimary && primaryURL == "" {
+		return nil, fmt.Errorf("a %s needs the primary's URL", role)
+	}
+	return &Node{
+		log:          l,
+		db:           db,
+		role:         role,
+		primaryURL:   primaryURL,
+		pollInterval: pollInterval,
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (n *Node) Log() *Log {
+	return n.log
+}
+
+func (n *Node) IsPrimary() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.role == RolePrimary
+}
+
+// EnableFailover coordinates the node with the others sharing the lease. It
+// must be called before Start, and is required for a standby.
+func (n *Node) EnableFailover(f Failover) {
+	n.failover = f
+}
+
+// OnPromote sets a function called once the node is promoted, to start what
+// only runs on the primary.
+func (n *Node) OnPromote(f func()) {
+	n.onPromote = f
+}
+
+// Start begins following the primary if the node is a secondary or a
+// standby, and watching the primary's health or renewing the lease when
+// failover is enabled.
+func (n *Node) Start() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.role == RoleStandby && n.failover.Lease == nil {
+		return errors.New("a standby needs a lease to take over")
+	}
+	if n.role != RolePrimary && n.cancel == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		n.cancel = cancel
+		go n.follow(ctx)
+	}
+	if n.failover.Lease != nil && n.stopWatch == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		n.stopWatch = cancel
+		go n.watch(ctx)
+	}
+	return nil
+}
+
+// Close stops replicating, releasing the lease if the node holds it.
+func (n *Node) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.cancel != nil {
+		n.cancel()
+		n.cancel = nil
+	}
+	if n.stopWatch != nil {
+		n.stopWatch()
+		n.stopWatch = nil
+	}
+	if n.role == RolePrimary && n.failover.Lease != nil {
+		return n.failover.Lease.Release()
+	}
+	return nil
+}
+
+// Record is the database mutation hook. Only a primary's writes are logged;
+// secondaries receive theirs from the primary.
+func (n *Node) Record(mutations []database.Mutation) {
+	if !n.IsPrimary() {
+		log.Printf("replication: local write on a secondary won't be replicated")
+		return
+	}
+	_, err := n.log.Append(mutations)
+	if err != nil {
+		log.Printf("replication: %v", err)
+	}
+}
+
+// Promote turns a secondary into a primary. It stops following the old
+// primary and continues the log from the last applied offset. With failover
+// enabled, the node must take the lease first.
+func (n *Node) Promote() error {
+	if n.IsPrimary() {
+		return errors.New("node is already the primary")
+	}
+	if n.failover.Lease != nil {
+		state, ok, err := n.failover.Lease.Acquire()
+		if err != nil {
+			return fmt.Errorf("lease: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("the lease is held by %s until %s", state.Holder, state.ExpiresAt.Format(time.RFC3339))
+		}
+		n.mu.Lock()
+		n.lease = &state
+		n.mu.Unlock()
+	}
+	n.mu.Lock()
+	if n.role == RolePrimary {
+		n.mu.Unlock()
+		return errors.New("node is already the primary")
+	}
+	if n.cancel != nil {
+		n.cancel()
+		n.cancel = nil
+	}
+	n.role = RolePrimary
+	n.failedChecks = 0
+	n.mu.Unlock()
+	if n.onPromote != nil {
+		n.onPromote()
+	}
+	return nil
+}
+
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	status := Status{
+		Role:       n.role,
+		Offset:     n.log.LastOffset(),
+		LastSyncAt: n.lastSyncAt,
+		LastError:  n.lastError,
+		Conflicts:  append([]Conflict{}, n.conflicts...),
+		Lease:      n.lease,
+	}
+	if n.role != RolePrimary {
+		status.PrimaryURL = n.primaryURL
+	}
+	if n.role == RoleStandby {
+		status.FailedChecks = n.failedChecks
+	}
+	return status
+}
+
+// watch renews the lease while the node is the primary. On a standby, it
+// checks the primary's health and takes over after too many failures.
+func (n *Node) watch(ctx context.Context) {
+	ticker := time.NewTicker(n.failover.CheckInterval)
+	defer ticker.Stop()
+	for {
+		n.mu.Lock()
+		role := n.role
+		n.mu.Unlock()
+		switch role {
+		case RolePrimary:
+			n.renewLease()
+		case RoleStandby:
+			n.checkPrimary(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// renewLease extends the primary's lease. A primary that finds the lease
+// taken over, e.g. after a network partition, stops accepting writes: a
+// standby has been promoted in its place.
+func (n *Node) renewLease() {
+	state, ok, err := n.failover.Lease.Acquire()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		log.Printf("replication: renewing the lease: %v", err)
+		n.lastError = err.Error()
+		return
+	}
+	n.lease = &state
+	if ok {
+		return
+	}
+	log.Printf("replication: %s took over the lease, refusing writes", state.Holder)
+	n.role = RoleSecondary
+	n.primaryURL = ""
+	n.lastError = fmt.Sprintf("lost the lease to %s", state.Holder)
+}
+
+// checkPrimary promotes the standby once the primary has failed enough
+// health checks in a row.
+func (n *Node) checkPrimary(ctx context.Context) {
+	err := n.checkHealth(ctx)
+	n.mu.Lock()
+	if err == nil {
+		n.failedChecks = 0
+		n.mu.Unlock()
+		return
+	}
+	n.failedChecks++
+	failed := n.failedChecks
+	n.mu.Unlock()
+	log.Printf("replication: primary health check %d/%d failed: %v", failed, n.failover.FailAfter, err)
+	if failed < n.failover.FailAfter {
+		return
+	}
+	err = n.Promote()
+	if err != nil {
+		log.Printf("replication: taking over: %v", err)
+		return
+	}
+	log.Printf("replication: took over as the primary at offset %d", n.log.LastOffset())
+}
+
+// checkHealth asks the primary for its replication status, which only
+// succeeds while it's up and still the primary.
+func (n *Node) checkHealth(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, n.failover.CheckInterval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.primaryURL+"/admin/replication/status", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("primary responded with %s", resp.Status)
+	}
+	status := Status{}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		return err
+	}
+	if status.Role != RolePrimary {
+		return fmt.Errorf("primary reports being a %s", status.Role)
+	}
+	return nil
+}
+
+func (n *Node) follow(ctx context.Context) {
+	ticker := time.NewTicker(n.pollInterval)
+	defer ticker.Stop()
+	for {
+		err := n.sync(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		n.mu.Lock()
+		if err != nil {
+			n.lastError = err.Error()
+		} else {
+			now := time.Now().UTC()
+			n.lastSyncAt = &now
+			n.lastError = ""
+		}
+		n.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync applies every entry the primary has after the local offset.
+func (n *Node) sync(ctx context.Context) error {
+	for {
+		entries, err := n.fetch(ctx, n.log.LastOffset())
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			err := n.apply(entry)
+			if err != nil {
+				return err
+			}
+		}
+		if len(entries) < batchSize {
+			return nil
+		}
+	}
+}
+
+func (n *Node) apply(entry Entry) error {
+	conflicts, err := n.db.ApplyMutations(entry.Mutations)
+	if err != nil {
+		return err
+	}
+	err = n.log.AppendEntry(entry)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, mutation := range conflicts {
+		log.Printf("replication: conflict on %s/%s at offset %d", mutation.Collection, mutation.Key, entry.Offset)
+		n.conflicts = append(n.conflicts, Conflict{Offset: entry.Offset, Mutation: mutation, Time: time.Now().UTC()})
+	}
+	if len(n.conflicts) > maxConflicts {
+		n.conflicts = n.conflicts[len(n.conflicts)-maxConflicts:]
+	}
+	return nil
+}
+
+func (n *Node) fetch(ctx context.Context, after int64) ([]Entry, error) {
+	query := url.Values{}
+	query.Set("after", strconv.FormatInt(after, 10))
+	query.Set("limit", strconv.Itoa(batchSize))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.primaryURL+"/admin/replication/log?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("primary responded with %s", resp.Status)
+	}
+	body := struct {
+		Entries []Entry `json:"entries"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, err
+	}
+	return body.Entries, nil
+}
@@ -0,0 +1,123 @@
+package replication
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestFailover(t *testing.T) {
+	dir := t.TempDir()
+	var healthy atomic.Bool
+	healthy.Store(true)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/admin/replication/status":
+			json.NewEncoder(w).Encode(Status{Role: RolePrimary})
+		case "/admin/replication/log":
+			json.NewEncoder(w).Encode(map[string]interface{}{"entries": []Entry{}})
+		}
+	}))
+	defer primary.Close()
+
+	leasePath := filepath.Join(dir, "primary.lease")
+	// the primary holds the lease, for a while
+	_, _, err := NewLease(leasePath, "primary", 500*time.Millisecond).Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := OpenLog(filepath.Join(dir, "replication.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	standby, err := NewNode(l, database.NewMemoryClient(), RoleStandby, primary.URL, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standby.EnableFailover(Failover{
+		Lease:         NewLease(leasePath, "standby", time.Second),
+		CheckInterval: 10 * time.Millisecond,
+		FailAfter:     3,
+	})
+	var promoted atomic.Bool
+	standby.OnPromote(func() { promoted.Store(true) })
+	err = standby.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer standby.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	if standby.IsPrimary() {
+		t.Fatal("standby took over from a healthy primary")
+	}
+
+	// it waits for the primary's lease to expire before taking over
+	healthy.Store(false)
+	time.Sleep(100 * time.Millisecond)
+	if standby.IsPrimary() {
+		t.Fatal("standby took over while the primary held the lease")
+	}
+	if standby.Status().FailedChecks < 3 {
+		t.Errorf("got %d failed checks, want at least 3", standby.Status().FailedChecks)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !standby.IsPrimary() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !standby.IsPrimary() || !promoted.Load() {
+		t.Fatal("standby didn't take over from a failed primary")
+	}
+	status := standby.Status()
+	if status.Lease == nil || status.Lease.Holder != "standby" {
+		t.Errorf("got lease %+v, want it held by the standby", status.Lease)
+	}
+
+	// the old primary refuses writes once it finds the lease taken over
+	oldLog, err := OpenLog(filepath.Join(dir, "old.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := NewNode(oldLog, database.NewMemoryClient(), RolePrimary, "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.EnableFailover(Failover{
+		Lease:         NewLease(leasePath, "primary", time.Second),
+		CheckInterval: 10 * time.Millisecond,
+		FailAfter:     3,
+	})
+	err = old.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	deadline = time.Now().Add(time.Second)
+	for old.IsPrimary() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if old.IsPrimary() {
+		t.Error("old primary still accepts writes after losing the lease")
+	}
+
+	// the new primary releases its lease when it stops
+	err = standby.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := NewLease(leasePath, "", time.Second).Read()
+	if err != nil || state.Holder != "" {
+		t.Errorf("got lease %+v, %v after closing, want it released", state, err)
+	}
+}
@@ -0,0 +1,169 @@
+package rotate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options control when a Writer rotates and which rotated files it keeps.
+// Zero values disable the corresponding limit.
+type Options struct {
+	// MaxSize rotates the file once it would grow past this many bytes.
+	MaxSize int64
+	// Interval rotates the file once it has been open for this long.
+	Interval time.Duration
+	// MaxBackups is the number of rotated files to keep.
+	MaxBackups int
+	// MaxAge removes rotated files older than this.
+	MaxAge time.Duration
+}
+
+// Writer is an io.Writer that appends to a file and rotates it according to
+// its Options. Rotated files get a timestamp suffix next to the original.
+type Writer struct {
+	path string
+	opts Options
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func NewWriter(path string, opts Options) *Writer {
+	return &Writer{
+		path: path,
+		opts: opts,
+	}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		err := w.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if w.shouldRotate(int64(len(p))) {
+		err := w.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *Writer) shouldRotate(n int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.opts.MaxSize > 0 && w.size+n > w.opts.MaxSize {
+		return true
+	}
+	return w.opts.Interval > 0 && time.Since(w.openedAt) >= w.opts.Interval
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *Writer) open() error {
+	err := os.MkdirAll(filepath.Dir(w.path), 0700)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.openedAt = info.ModTime()
+	if w.size == 0 {
+		w.openedAt = time.Now()
+	}
+	return nil
+}
+
+func (w *Writer) rotate() error {
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return err
+	}
+	err = os.Rename(w.path, w.backupName(time.Now().UTC()))
+	if err != nil {
+		return err
+	}
+	err = w.removeOldBackups()
+	if err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *Writer) backupName(t time.Time) string {
+	ext := filepath.Ext(w.path)
+	prefix := strings.TrimSuffix(w.path, ext)
+	return fmt.Sprintf("%s-%s%s", prefix, t.Format("20060102T150405.000000000"), ext)
+}
+
+func (w *Writer) backups() ([]string, error) {
+	ext := filepath.Ext(w.path)
+	prefix := strings.TrimSuffix(w.path, ext)
+	matches, err := filepath.Glob(prefix + "-*" + ext)
+	if err != nil {
+		return nil, err
+	}
+	// timestamps sort lexically, oldest first
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (w *Writer) removeOldBackups() error {
+	backups, err := w.backups()
+	if err != nil {
+		return err
+	}
+	for i, backup := range backups {
+		expired := w.opts.MaxBackups > 0 && len(backups)-i > w.opts.MaxBackups
+		if !expired && w.opts.MaxAge > 0 {
+			info, err := os.Stat(backup)
+			if err != nil {
+				return err
+			}
+			expired = time.Since(info.ModTime()) > w.opts.MaxAge
+		}
+		if !expired {
+			continue
+		}
+		err := os.Remove(backup)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package rotate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriterRotates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.log")
+	w := NewWriter(path, Options{MaxSize: 10, MaxBackups: 2})
+	defer w.Close()
+
+	for i := 0; i < 5; i++ {
+		_, err := w.Write([]byte("12345678\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := w.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("got %d backups, want 2", len(backups))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "12345678\n" {
+		t.Errorf("got %q, want %q", data, "12345678\n")
+	}
+}
+
+func TestWriterRotatesOnInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.log")
+	w := NewWriter(path, Options{Interval: time.Hour})
+	defer w.Close()
+
+	_, err := w.Write([]byte("first\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.openedAt = time.Now().Add(-2 * time.Hour)
+	_, err = w.Write([]byte("second\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := w.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups, want 1", len(backups))
+	}
+	data, err := os.ReadFile(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first\n" {
+		t.Errorf("got %q, want %q", data, "first\n")
+	}
+}
@@ -0,0 +1,271 @@
+// Package router matches requests against methods and path patterns with
+// named parameters, e.g. GET /users/{ref}/profile, and rejects conflicting
+// routes when they're added rather than when a request happens to reach
+// them. It tells paths no route matches from paths routed for other
+// methods, so callers can answer 404 Not Found and 405 Method Not Allowed
+// with an accurate Allow header. HEAD requests match GET routes, and every
+// path routed allows OPTIONS, answered by callers from the Allow list.
+//
+// Literal segments are reserved: where a literal and a parameter could both
+// match a segment, only the literal does, whatever the order the patterns
+// were added in. Adding /users/login next to /users/{ref} therefore takes
+// "login" away from the parameter, and /users/login/profile doesn't match.
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Params are the values of the parameters of a matched pattern, by name.
+type Params map[string]string
+
+// ErrNotFound is returned by Match when no pattern matches the path.
+var ErrNotFound = errors.New("no route matches the path")
+
+// MethodNotAllowedError is returned by Match when a pattern matches the
+// path but has no handler for the method, OPTIONS included.
+type MethodNotAllowedError struct {
+	// Allow are the methods the pattern has handlers for as listed by
+	// Allow.
+	Allow []string
+}
+
+func (e MethodNotAllowedError) Error() string {
+	return "method not allowed, allowed: " + strings.Join(e.Allow, ", ")
+}
+
+// Router maps methods and patterns to handlers of type H. Patterns are
+// empty, matching the empty path, or a slash followed by segments
+// separated by slashes, each either literal or a parameter like {id}. Add
+// routes before matching, a Router isn't safe for concurrent use while it
+// changes.
+type Router[H any] struct {
+	root node[H]
+}
+
+type node[H any] struct {
+	literals map[string]*node[H]
+	param    *node[H]
+	// paramName is the name of param, and origin the first pattern through
+	// it, reported in conflicts.
+	paramName string
+	origin    string
+	// pattern is the pattern ending here, with handlers by method.
+	pattern  string
+	handlers map[string]H
+}
+
+// ConflictError is returned when adding a route for a method and paths
+// already routed, or naming a parameter differently.
+type ConflictError struct {
+	Pattern  string
+	Existing string
+	Reason   string
+}
+
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("pattern %q conflicts with %q: %s", e.Pattern, e.Existing, e.Reason)
+}
+
+func New[H any]() *Router[H] {
+	return &Router[H]{}
+}
+
+// Add routes requests with method to paths matching pattern to handler.
+func (rt *Router[H]) Add(method, pattern string, handler H) error {
+	if method == "" {
+		return fmt.Errorf("pattern %q has no method", pattern)
+	}
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+	n := &rt.root
+	for _, seg := range segments {
+		name, isParam := paramName(seg)
+		if !isParam {
+			if n.literals == nil {
+				n.literals = map[string]*node[H]{}
+			}
+			if n.literals[seg] == nil {
+				n.literals[seg] = &node[H]{}
+			}
+			n = n.literals[seg]
+			continue
+		}
+		if n.param == nil {
+			n.param = &node[H]{}
+			n.paramName, n.origin = name, pattern
+		} else if n.paramName != name {
+			return ConflictError{Pattern: pattern, Existing: n.origin, Reason: fmt.Sprintf("{%s} is named {%s} there", name, n.paramName)}
+		}
+		n = n.param
+	}
+	if _, ok := n.handlers[method]; ok {
+		return ConflictError{Pattern: method + " " + pattern, Existing: method + " " + n.pattern, Reason: "both match the same requests"}
+	}
+	if n.handlers == nil {
+		n.handlers = map[string]H{}
+	}
+	n.pattern, n.handlers[method] = pattern, handler
+	return nil
+}
+
+// Handle is Add, panicking on invalid and conflicting patterns like
+// http.ServeMux does, for routes set up at startup.
+func (rt *Router[H]) Handle(method, pattern string, handler H) {
+	err := rt.Add(method, pattern, handler)
+	if err != nil {
+		panic("router: " + err.Error())
+	}
+}
+
+// Match returns the handler of the route matching method and path, and the
+// values of the parameters of its pattern. Parameters never match empty
+// segments, and HEAD requests match GET routes unless there's a HEAD
+// route. The error is ErrNotFound or a MethodNotAllowedError when no route
+// matches.
+func (rt *Router[H]) Match(method, path string) (H, Params, error) {
+	var none H
+	n := &rt.root
+	params := Params{}
+	if path != "" {
+		if !strings.HasPrefix(path, "/") {
+			return none, nil, ErrNotFound
+		}
+		for _, seg := range strings.Split(path[1:], "/") {
+			if next, ok := n.literals[seg]; ok {
+				n = next
+				continue
+			}
+			if n.param == nil || seg == "" {
+				return none, nil, ErrNotFound
+			}
+			params[n.paramName] = seg
+			n = n.param
+		}
+	}
+	if len(n.handlers) == 0 {
+		return none, nil, ErrNotFound
+	}
+	handler, ok := n.handlers[method]
+	if !ok && method == http.MethodHead {
+		handler, ok = n.handlers[http.MethodGet]
+	}
+	if !ok {
+		return none, nil, MethodNotAllowedError{Allow: Allow(n.methods()...)}
+	}
+	return handler, params, nil
+}
+
+// Allow returns methods for an Allow header: sorted, with HEAD if GET is
+// among them, and OPTIONS.
+func Allow(methods ...string) []string {
+	allow := map[string]bool{http.MethodOptions: true}
+	for _, method := range methods {
+		allow[method] = true
+		if method == http.MethodGet {
+			allow[http.MethodHead] = true
+		}
+	}
+	list := make([]string, 0, len(allow))
+	for method := range allow {
+		list = append(list, method)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (n *node[H]) methods() []string {
+	methods := make([]string, 0, len(n.handlers))
+	for method := range n.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Routes lists the routes added as "METHOD pattern", sorted with literals
+// before parameters.
+func (rt *Router[H]) Routes() []string {
+	routes := []string{}
+	var walk func(n *node[H])
+	walk = func(n *node[H]) {
+		for _, method := range n.methods() {
+			routes = append(routes, method+" "+n.pattern)
+		}
+		literals := make([]string, 0, len(n.literals))
+		for seg := range n.literals {
+			literals = append(literals, seg)
+		}
+		sort.Strings(literals)
+		for _, seg := range literals {
+			walk(n.literals[seg])
+		}
+		if n.param != nil {
+			walk(n.param)
+		}
+	}
+	walk(&rt.root)
+	return routes
+}
+
+func parsePattern(pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern %q doesn't start with /", pattern)
+	}
+	segments := strings.Split(pattern[1:], "/")
+	names := map[string]bool{}
+	for _, seg := range segments {
+		if seg == "" {
+			return nil, fmt.Errorf("pattern %q has an empty segment", pattern)
+		}
+		name, isParam := paramName(seg)
+		if !isParam && strings.ContainsAny(seg, "{}") {
+			return nil, fmt.Errorf("pattern %q has a segment %q that's neither literal nor a parameter", pattern, seg)
+		}
+		if !isParam {
+			continue
+		}
+		if names[name] {
+			return nil, fmt.Errorf("pattern %q has the parameter {%s} twice", pattern, name)
+		}
+		names[name] = true
+	}
+	return segments, nil
+}
+
+// paramName returns name for a segment {name}.
+func paramName(seg string) (string, bool) {
+	name, ok := strings.CutPrefix(seg, "{")
+	if !ok {
+		return "", false
+	}
+	name, ok = strings.CutSuffix(name, "}")
+	if !ok || name == "" || strings.ContainsAny(name, "{}") {
+		return "", false
+	}
+	return name, true
+}
+
+type paramsKey struct{}
+
+// WithParams returns r carrying params for the handler of the route.
+func WithParams(r *http.Request, params Params) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), paramsKey{}, params))
+}
+
+// Param returns the value of the parameter name of the route r matched,
+// empty if there's none.
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(Params)
+	return params[name]
+}
@@ -0,0 +1,161 @@
+package router
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	rt := New[string]()
+	for _, route := range [][2]string{
+		{"POST", ""},
+		{"GET", "/{ref}"},
+		{"PUT", "/{ref}"},
+		{"DELETE", "/{ref}"},
+		{"GET", "/{ref}/profile"},
+		{"GET", "/{ref}/posts/analytics"},
+		{"POST", "/login"},
+		{"POST", "/{ref}/revert/{revision}"},
+	} {
+		rt.Handle(route[0], route[1], route[0]+" "+route[1])
+	}
+	var tests = []struct {
+		method string
+		path   string
+		route  string
+		params Params
+		allow  []string
+	}{
+		{method: "POST", path: "", route: "POST ", params: Params{}},
+		{method: "GET", path: "/ann@example.com", route: "GET /{ref}", params: Params{"ref": "ann@example.com"}},
+		{method: "DELETE", path: "/ann", route: "DELETE /{ref}", params: Params{"ref": "ann"}},
+		{method: "GET", path: "/@ann/profile", route: "GET /{ref}/profile", params: Params{"ref": "@ann"}},
+		{method: "GET", path: "/ann/posts/analytics", route: "GET /{ref}/posts/analytics", params: Params{"ref": "ann"}},
+		{method: "POST", path: "/ann/revert/2", route: "POST /{ref}/revert/{revision}", params: Params{"ref": "ann", "revision": "2"}},
+		// literals are reserved
+		{method: "POST", path: "/login", route: "POST /login", params: Params{}},
+		{method: "GET", path: "/login", allow: []string{"OPTIONS", "POST"}},
+		// HEAD requests match GET routes
+		{method: "HEAD", path: "/ann/profile", route: "GET /{ref}/profile", params: Params{"ref": "ann"}},
+		{method: "HEAD", path: "/login", allow: []string{"OPTIONS", "POST"}},
+		{method: "OPTIONS", path: "/ann", allow: []string{"DELETE", "GET", "HEAD", "OPTIONS", "PUT"}},
+		{method: "OPTIONS", path: "/ann/unknown"},
+		{method: "GET", path: "/login/profile"},
+		// known paths, other methods
+		{method: "GET", path: "", allow: []string{"OPTIONS", "POST"}},
+		{method: "PATCH", path: "/ann", allow: []string{"DELETE", "GET", "HEAD", "OPTIONS", "PUT"}},
+		{method: "POST", path: "/ann/profile", allow: []string{"GET", "HEAD", "OPTIONS"}},
+		// unknown paths
+		{method: "GET", path: "/"},
+		{method: "GET", path: "/ann/"},
+		{method: "GET", path: "//profile"},
+		{method: "GET", path: "/ann/posts"},
+		{method: "GET", path: "/ann/profile/more"},
+		{method: "GET", path: "ann"},
+	}
+	for _, tt := range tests {
+		route, params, err := rt.Match(tt.method, tt.path)
+		switch {
+		case tt.params != nil:
+			if err != nil || route != tt.route || !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("%s %q: got %q %v %v, want %q %v", tt.method, tt.path, route, params, err, tt.route, tt.params)
+			}
+		case tt.allow != nil:
+			notAllowed := MethodNotAllowedError{}
+			if !errors.As(err, &notAllowed) || !reflect.DeepEqual(notAllowed.Allow, tt.allow) {
+				t.Errorf("%s %q: got %q %v, want %v allowed", tt.method, tt.path, route, err, tt.allow)
+			}
+		default:
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s %q: got %q %v, want %v", tt.method, tt.path, route, err, ErrNotFound)
+			}
+		}
+	}
+
+	want := []string{
+		"POST ",
+		"POST /login",
+		"DELETE /{ref}",
+		"GET /{ref}",
+		"PUT /{ref}",
+		"GET /{ref}/posts/analytics",
+		"GET /{ref}/profile",
+		"POST /{ref}/revert/{revision}",
+	}
+	if got := rt.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got routes %q, want %q", got, want)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	rt := New[int]()
+	rt.Handle("POST", "/{ref}/follow", 1)
+	rt.Handle("GET", "/{ref}", 2)
+	var tests = []struct {
+		method   string
+		pattern  string
+		conflict bool
+	}{
+		{method: "GET", pattern: "/{ref}", conflict: true},
+		{method: "POST", pattern: "/{ref}/follow", conflict: true},
+		{method: "GET", pattern: "/{id}", conflict: true},
+		{method: "POST", pattern: "/{id}/block", conflict: true},
+		{method: "DELETE", pattern: "/{ref}/follow"},
+		{method: "POST", pattern: "/{ref}/block"},
+		{method: "GET", pattern: "/follow"},
+		{method: "GET", pattern: ""},
+	}
+	for _, tt := range tests {
+		err := rt.Add(tt.method, tt.pattern, 0)
+		if conflict := errors.As(err, &ConflictError{}); conflict != tt.conflict || (!tt.conflict && err != nil) {
+			t.Errorf("%s %q: got %v, want conflict %v", tt.method, tt.pattern, err, tt.conflict)
+		}
+	}
+
+	for _, pattern := range []string{"users", "/", "/users/", "/a//b", "/{}", "/a{b}", "/{ref}/x/{ref}"} {
+		err := rt.Add("GET", pattern, 0)
+		if err == nil || errors.As(err, &ConflictError{}) {
+			t.Errorf("%q: got %v, want it invalid", pattern, err)
+		}
+	}
+	if err := rt.Add("", "/users", 0); err == nil {
+		t.Error("got no error for a route without method")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Handle didn't panic on a conflict")
+		}
+	}()
+	rt.Handle("GET", "/{id}", 3)
+}
+
+func TestParam(t *testing.T) {
+	r := httptest.NewRequest("GET", "/users/ann", nil)
+	if got := Param(r, "ref"); got != "" {
+		t.Errorf("got %q without params", got)
+	}
+	r = WithParams(r, Params{"ref": "ann"})
+	if got := Param(r, "ref"); got != "ann" {
+		t.Errorf("got %q, want ann", got)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	var tests = []struct {
+		methods []string
+		allow   []string
+	}{
+		{methods: nil, allow: []string{"OPTIONS"}},
+		{methods: []string{"POST"}, allow: []string{"OPTIONS", "POST"}},
+		{methods: []string{"PUT", "GET"}, allow: []string{"GET", "HEAD", "OPTIONS", "PUT"}},
+		{methods: []string{"GET", "HEAD", "OPTIONS"}, allow: []string{"GET", "HEAD", "OPTIONS"}},
+	}
+	for _, tt := range tests {
+		if got := Allow(tt.methods...); !reflect.DeepEqual(got, tt.allow) {
+			t.Errorf("%v: got %v, want %v", tt.methods, got, tt.allow)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package search is an in-memory inverted index ranking documents by
+// TF-IDF. Documents are added and removed one at a time, so the index can be
+// kept up to date as records are written.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// stopWords are too common to help ranking and aren't indexed.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true,
+	"by": true, "for": true, "from": true, "has": true, "have": true, "i": true, "in": true, "is": true,
+	"it": true, "its": true, "my": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "we": true, "were": true, "will": true, "with": true, "you": true,
+}
+
+// Document is a record to index. Kind tells records of different
+// collections apart, IDs only need to be unique within a kind.
+type Document struct {
+	Kind string
+	ID   string
+	Text string
+}
+
+type Result struct {
+	Kind  string
+	ID    string
+	Score float64
+}
+
+type docKey struct {
+	kind string
+	id   string
+}
+
+type Index struct {
+	mu sync.RWMutex
+	// postings maps each term to the documents containing it and how often.
+	postings map[string]map[docKey]int
+	// docs holds the terms of each document, to remove them again.
+	docs map[docKey]map[string]int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string]map[docKey]int{},
+		docs:     map[docKey]map[string]int{},
+	}
+}
+
+// Tokenize splits text into lowercase stemmed terms, leaving out stop words.
+func Tokenize(text string) []string {
+	terms := []string{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if stopWords[word] {
+			continue
+		}
+		terms = append(terms, Stem(word))
+	}
+	return terms
+}
+
+// Put indexes doc, replacing any document with the same kind and ID.
+func (ix *Index) Put(doc Document) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.put(doc)
+}
+
+func (ix *Index) put(doc Document) {
+	key := docKey{doc.Kind, doc.ID}
+	ix.remove(key)
+	terms := map[string]int{}
+	for _, term := range Tokenize(doc.Text) {
+		terms[term]++
+	}
+	for term, count := range terms {
+		if ix.postings[term] == nil {
+			ix.postings[term] = map[docKey]int{}
+		}
+		ix.postings[term][key] = count
+	}
+	ix.docs[key] = terms
+}
+
+func (ix *Index) Remove(kind, id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(docKey{kind, id})
+}
+
+func (ix *Index) remove(key docKey) {
+	for term := range ix.docs[key] {
+		delete(ix.postings[term], key)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.docs, key)
+}
+
+// Reset replaces the contents of the index with docs.
+func (ix *Index) Reset(docs []Document) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.postings = map[string]map[docKey]int{}
+	ix.docs = map[docKey]map[string]int{}
+	for _, doc := range docs {
+		ix.put(doc)
+	}
+}
+
+// Len returns the number of indexed documents.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+// Search returns the documents containing any of the terms of query, best
+// match first. A term scores (1 + ln tf) * ln(1 + N/df), and the sum over the
+// query terms is divided by the square root of the document length so long
+// documents don't win just by containing more words.
+func (ix *Index) Search(query string) []Result {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	n := float64(len(ix.docs))
+	scores := map[docKey]float64{}
+	seen := map[string]bool{}
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		postings := ix.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		idf := math.Log(1 + n/float64(len(postings)))
+		for key, tf := range postings {
+			scores[key] += (1 + math.Log(float64(tf))) * idf
+		}
+	}
+	results := make([]Result, 0, len(scores))
+	for key, score := range scores {
+		length := 0
+		for _, count := range ix.docs[key] {
+			length += count
+		}
+		results = append(results, Result{
+			Kind:  key.kind,
+			ID:    key.id,
+			Score: math.Round(score/math.Sqrt(float64(length))*1e4) / 1e4,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Kind != results[j].Kind {
+			return results[i].Kind < results[j].Kind
+		}
+		return results[i].ID < results[j].ID
+	})
+	return results
+}
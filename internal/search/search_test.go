@@ -0,0 +1,83 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	var tests = []struct {
+		word     string
+		expected string
+	}{
+		{"posts", "post"},
+		{"posted", "post"},
+		{"posting", "post"},
+		{"running", "run"},
+		{"hoping", "hope"},
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"agreed", "agree"},
+		{"falling", "fall"},
+		{"happy", "happi"},
+		{"sky", "sky"},
+		{"go", "go"},
+		{"café", "café"},
+	}
+	for _, tt := range tests {
+		if got := Stem(tt.word); got != tt.expected {
+			t.Errorf("Stem(%q): got %q, want %q", tt.word, got, tt.expected)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("The Gophers were running to the posts!")
+	expected := []string{"gopher", "run", "post"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
+
+func ids(results []Result) []string {
+	got := []string{}
+	for _, result := range results {
+		got = append(got, result.Kind+":"+result.ID)
+	}
+	return got
+}
+
+func TestIndexSearch(t *testing.T) {
+	ix := NewIndex()
+	ix.Put(Document{Kind: "post", ID: "1", Text: "learning go today"})
+	ix.Put(Document{Kind: "post", ID: "2", Text: "go go go, posting about go and rust and many other languages"})
+	ix.Put(Document{Kind: "post", ID: "3", Text: "rust is fun"})
+	ix.Put(Document{Kind: "user", ID: "a", Text: "Rusty Gopher"})
+
+	var tests = []struct {
+		query    string
+		expected []string
+	}{
+		{"go", []string{"post:2", "post:1"}},
+		{"rust", []string{"post:3", "post:2"}},
+		{"learned go", []string{"post:1", "post:2"}},
+		{"gophers", []string{"user:a"}},
+		{"the", []string{}},
+		{"python", []string{}},
+	}
+	for _, tt := range tests {
+		got := ids(ix.Search(tt.query))
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.expected)
+		}
+	}
+
+	ix.Put(Document{Kind: "post", ID: "1", Text: "learning rust today"})
+	ix.Remove("post", "3")
+	if got := ids(ix.Search("go")); !reflect.DeepEqual(got, []string{"post:2"}) {
+		t.Errorf("after update: got %v, want [post:2]", got)
+	}
+	if got := ix.Len(); got != 3 {
+		t.Errorf("got %d documents, want 3", got)
+	}
+}
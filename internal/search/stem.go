@@ -0,0 +1,126 @@
+package search
+
+import "strings"
+
+// Stem reduces an English word to its stem with step 1 of the Porter
+// algorithm, which folds plurals and -ed/-ing forms: "posts", "posted" and
+// "posting" all become "post". Words that aren't plain lowercase ASCII are
+// returned unchanged.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	return step1c(step1b(step1a(word)))
+}
+
+func step1a(w string) string {
+	switch {
+	case strings.HasSuffix(w, "sses"):
+		return w[:len(w)-2]
+	case strings.HasSuffix(w, "ies"):
+		return w[:len(w)-2]
+	case strings.HasSuffix(w, "ss"):
+		return w
+	case strings.HasSuffix(w, "s"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+func step1b(w string) string {
+	if strings.HasSuffix(w, "eed") {
+		if measure(w[:len(w)-3]) > 0 {
+			return w[:len(w)-1]
+		}
+		return w
+	}
+	for _, suffix := range []string{"ed", "ing"} {
+		stem := strings.TrimSuffix(w, suffix)
+		if stem != w && containsVowel(stem) {
+			return step1bFixup(stem)
+		}
+	}
+	return w
+}
+
+// step1bFixup restores the e or undoubles the consonant left behind by
+// removing -ed or -ing, e.g. "hoping" -> "hope", "running" -> "run".
+func step1bFixup(w string) string {
+	switch {
+	case strings.HasSuffix(w, "at"), strings.HasSuffix(w, "bl"), strings.HasSuffix(w, "iz"):
+		return w + "e"
+	case endsDoubleConsonant(w):
+		last := w[len(w)-1]
+		if last != 'l' && last != 's' && last != 'z' {
+			return w[:len(w)-1]
+		}
+	case measure(w) == 1 && endsCVC(w):
+		return w + "e"
+	}
+	return w
+}
+
+func step1c(w string) string {
+	if strings.HasSuffix(w, "y") && containsVowel(w[:len(w)-1]) {
+		return w[:len(w)-1] + "i"
+	}
+	return w
+}
+
+func isConsonant(w string, i int) bool {
+	switch w[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !isConsonant(w, i-1)
+	}
+	return true
+}
+
+// measure counts the vowel-consonant sequences in w, the m of the Porter
+// paper.
+func measure(w string) int {
+	m := 0
+	inVowels := false
+	for i := 0; i < len(w); i++ {
+		if isConsonant(w, i) {
+			if inVowels {
+				m++
+			}
+			inVowels = false
+		} else {
+			inVowels = true
+		}
+	}
+	return m
+}
+
+func containsVowel(w string) bool {
+	for i := 0; i < len(w); i++ {
+		if !isConsonant(w, i) {
+			return true
+		}
+	}
+	return false
+}
+
+func endsDoubleConsonant(w string) bool {
+	n := len(w)
+	return n >= 2 && w[n-1] == w[n-2] && isConsonant(w, n-1)
+}
+
+// endsCVC reports whether w ends consonant-vowel-consonant with the last
+// consonant not w, x or y, as in "hop" but not "snow".
+func endsCVC(w string) bool {
+	n := len(w)
+	if n < 3 || !isConsonant(w, n-3) || isConsonant(w, n-2) || !isConsonant(w, n-1) {
+		return false
+	}
+	last := w[n-1]
+	return last != 'w' && last != 'x' && last != 'y'
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// Block hides the posts of the user found by ref from the user with the
+// given ID.
+func (s UserService) Block(blockerID, ref string) (database.Block, error) {
+	blocked, err := s.Get(ref)
+	if err != nil {
+		return database.Block{}, err
+	}
+	if blocked.ID == blockerID {
+		return database.Block{}, invalid("users can't block themselves")
+	}
+	block, err := s.db.BlockUser(blockerID, blocked.ID)
+	return block, userError(err)
+}
+
+// Unblock shows the posts of the user found by ref to the user with the
+// given ID again.
+func (s UserService) Unblock(blockerID, ref string) error {
+	blocked, err := s.Get(ref)
+	if err != nil {
+		return err
+	}
+	err = s.db.UnblockUser(blockerID, blocked.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrUserNotBlocked
+	}
+	return err
+}
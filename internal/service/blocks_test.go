@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestPostServiceHidesBlockedUsers(t *testing.T) {
+	db := database.NewMemoryClient()
+	ann, err := db.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := db.CreateUser("bob@example.com", "12345", "Bob", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewUserService(db, nil)
+	posts := NewPostService(db, nil, nil)
+	blocked, err := posts.Create(ann.ID, "", "blocked", []string{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	visible, err := posts.Create(bob.ID, "", "visible", []string{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = users.Block(bob.ID, bob.ID)
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("block self: got %v, want a validation error", err)
+	}
+	_, err = users.Block(bob.ID, "nobody@example.com")
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("block missing user: got %v, want %v", err, ErrUserNotFound)
+	}
+	_, err = users.Block(bob.ID, "by-email/ann@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bob no longer sees ann's posts, everyone else still does
+	forBob := posts.ForViewer(bob.ID)
+	_, err = forBob.Get(blocked.ID)
+	if !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("get: got %v, want %v", err, ErrPostNotFound)
+	}
+	byAuthor, err := forBob.ByAuthor(ann.ID, "", "")
+	if err != nil || len(byAuthor) != 0 {
+		t.Errorf("by author: got %v, %v, want no posts", byAuthor, err)
+	}
+	all, err := forBob.All("go")
+	if err != nil || len(all) != 1 || all[0].ID != visible.ID {
+		t.Errorf("all: got %v, %v, want %s only", all, err, visible.ID)
+	}
+	it, err := forBob.Iterate("", "", "go", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, ok := it.Next()
+	if !ok || post.ID != visible.ID {
+		t.Errorf("iterate: got %v, want %s", post, visible.ID)
+	}
+	if _, ok := it.Next(); ok {
+		t.Error("iterate: got the post of a blocked user")
+	}
+	for name, service := range map[string]PostService{"anonymous": posts, "ann": posts.ForViewer(ann.ID)} {
+		all, err := service.All("go")
+		if err != nil || len(all) != 2 {
+			t.Errorf("all for %s: got %v, %v, want both posts", name, all, err)
+		}
+	}
+
+	// unblocking shows the posts again
+	err = users.Unblock(bob.ID, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = forBob.Get(blocked.ID)
+	if err != nil {
+		t.Errorf("get after unblocking: %v", err)
+	}
+	err = users.Unblock(bob.ID, ann.ID)
+	if !errors.Is(err, ErrUserNotBlocked) {
+		t.Errorf("unblock twice: got %v, want %v", err, ErrUserNotBlocked)
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// Follow makes the user with the given ID follow the user found by ref.
+// Following a private user is a request until they accept it.
+func (s UserService) Follow(followerID, ref string) (database.Follow, error) {
+	followee, err := s.Get(ref)
+	if err != nil {
+		return database.Follow{}, err
+	}
+	if followee.ID == followerID {
+		return database.Follow{}, invalid("users can't follow themselves")
+	}
+	status := database.FollowApproved
+	if followee.Private {
+		status = database.FollowPending
+	}
+	follow, err := s.db.FollowUser(followerID, followee.ID, status)
+	return follow, userError(err)
+}
+
+// Unfollow stops the user with the given ID following the user found by
+// ref, or withdraws their request to.
+func (s UserService) Unfollow(followerID, ref string) error {
+	followee, err := s.Get(ref)
+	if err != nil {
+		return err
+	}
+	err = s.db.UnfollowUser(followerID, followee.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrNotFollowing
+	}
+	return err
+}
+
+// FollowRequests returns the pending requests to follow the user with the
+// given ID, oldest first.
+func (s UserService) FollowRequests(userID string) ([]database.Follow, error) {
+	followers, err := s.db.GetFollowers(userID)
+	if err != nil {
+		return nil, err
+	}
+	requests := []database.Follow{}
+	for _, follow := range followers {
+		if follow.Status == database.FollowPending {
+			requests = append(requests, follow)
+		}
+	}
+	return requests, nil
+}
+
+// AcceptFollower approves a pending request of followerID to follow the
+// user with the given ID.
+func (s UserService) AcceptFollower(userID, followerID string) (database.Follow, error) {
+	_, err := s.followRequest(userID, followerID)
+	if err != nil {
+		return database.Follow{}, err
+	}
+	return s.db.SetFollowStatus(followerID, userID, database.FollowApproved)
+}
+
+// RejectFollower turns down a pending request of followerID to follow the
+// user with the given ID. They may ask again.
+func (s UserService) RejectFollower(userID, followerID string) error {
+	_, err := s.followRequest(userID, followerID)
+	if err != nil {
+		return err
+	}
+	return s.db.UnfollowUser(followerID, userID)
+}
+
+func (s UserService) followRequest(userID, followerID string) (database.Follow, error) {
+	requests, err := s.FollowRequests(userID)
+	if err != nil {
+		return database.Follow{}, err
+	}
+	for _, follow := range requests {
+		if follow.FollowerID == followerID {
+			return follow, nil
+		}
+	}
+	return database.Follow{}, ErrFollowRequestNotFound
+}
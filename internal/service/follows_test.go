@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestPrivateUsers(t *testing.T) {
+	db := database.NewMemoryClient()
+	ann, err := db.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := db.CreateUser("bob@example.com", "12345", "Bob", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewUserService(db, nil)
+	posts := NewPostService(db, nil, nil)
+	private, err := posts.Create(ann.ID, "", "private", []string{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	yes := true
+	_, err = users.Patch(ann.ID, ann.ID, UserPatch{Private: &yes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	countPosts := func(viewerID string) int {
+		all, err := posts.ForViewer(viewerID).All("go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(all)
+	}
+	if n := countPosts(""); n != 0 {
+		t.Errorf("anonymous visitor sees %d posts of a private user", n)
+	}
+	if n := countPosts(ann.ID); n != 1 {
+		t.Errorf("private user sees %d of their own posts, want 1", n)
+	}
+
+	// following a private user takes their approval
+	follow, err := users.Follow(bob.ID, ann.ID)
+	if err != nil || follow.Status != database.FollowPending {
+		t.Fatalf("follow: got %+v, %v, want a pending follow", follow, err)
+	}
+	if n := countPosts(bob.ID); n != 0 {
+		t.Errorf("pending follower sees %d posts", n)
+	}
+	requests, err := users.FollowRequests(ann.ID)
+	if err != nil || len(requests) != 1 || requests[0].FollowerID != bob.ID {
+		t.Errorf("follow requests: got %+v, %v, want bob's", requests, err)
+	}
+	_, err = users.AcceptFollower(ann.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countPosts(bob.ID); n != 1 {
+		t.Errorf("approved follower sees %d posts, want 1", n)
+	}
+	_, err = posts.ForViewer(bob.ID).Get(private.ID)
+	if err != nil {
+		t.Errorf("approved follower gets the post: %v", err)
+	}
+	_, err = posts.Get(private.ID)
+	if !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("anonymous get: got %v, want %v", err, ErrPostNotFound)
+	}
+	_, err = users.AcceptFollower(ann.ID, bob.ID)
+	if !errors.Is(err, ErrFollowRequestNotFound) {
+		t.Errorf("accept twice: got %v, want %v", err, ErrFollowRequestNotFound)
+	}
+
+	// rejected followers may ask again
+	err = users.Unfollow(bob.ID, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = users.Follow(bob.ID, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = users.RejectFollower(ann.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countPosts(bob.ID); n != 0 {
+		t.Errorf("rejected follower sees %d posts", n)
+	}
+	err = users.Unfollow(bob.ID, ann.ID)
+	if !errors.Is(err, ErrNotFollowing) {
+		t.Errorf("unfollow after rejection: got %v, want %v", err, ErrNotFollowing)
+	}
+
+	// following public users needs no approval
+	follow, err = users.Follow(ann.ID, bob.ID)
+	if err != nil || follow.Status != database.FollowApproved {
+		t.Errorf("follow public user: got %+v, %v, want an approved follow", follow, err)
+	}
+	_, err = users.Follow(ann.ID, ann.ID)
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("follow self: got %v, want a validation error", err)
+	}
+}
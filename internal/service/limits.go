@@ -0,0 +1,78 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// PostLimits are the server's hard limits on posting. Unlike content
+// policies, tenants can't change them. Zero fields don't limit.
+type PostLimits struct {
+	// MaxLength is the most characters a post may have.
+	MaxLength int
+	// PerDay is the most posts a user may create in 24 hours.
+	PerDay int
+}
+
+// PostTooLongError is returned for posts over PostLimits.MaxLength.
+type PostTooLongError struct {
+	MaxLength int
+}
+
+func (e PostTooLongError) Error() string {
+	return fmt.Sprintf("posts can be at most %d characters", e.MaxLength)
+}
+
+// PostQuotaError is returned once a user created PostLimits.PerDay posts
+// in the last 24 hours.
+type PostQuotaError struct {
+	PerDay int
+	// RetryAt is when enough of those posts left the window to post again.
+	RetryAt time.Time
+}
+
+func (e PostQuotaError) Error() string {
+	return fmt.Sprintf("users can create at most %d posts a day", e.PerDay)
+}
+
+// WithLimits returns a copy of s enforcing limits.
+func (s PostService) WithLimits(limits PostLimits) PostService {
+	s.limits = limits
+	return s
+}
+
+// checkLength checks the text of a post against the maximum length.
+func (s PostService) checkLength(text string) error {
+	if s.limits.MaxLength > 0 && utf8.RuneCountInString(text) > s.limits.MaxLength {
+		return PostTooLongError{MaxLength: s.limits.MaxLength}
+	}
+	return nil
+}
+
+// checkQuota checks that a user can create another post at now. Deleted
+// posts don't count.
+func (s PostService) checkQuota(userID string, now time.Time) error {
+	if s.limits.PerDay <= 0 {
+		return nil
+	}
+	posts, err := s.db.GetPosts(userID)
+	if err != nil {
+		return err
+	}
+	since := now.Add(-24 * time.Hour)
+	recent := []time.Time{}
+	for _, post := range posts {
+		if post.CreatedAt.After(since) {
+			recent = append(recent, post.CreatedAt)
+		}
+	}
+	if len(recent) < s.limits.PerDay {
+		return nil
+	}
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i].Before(recent[j])
+	})
+	return PostQuotaError{PerDay: s.limits.PerDay, RetryAt: recent[len(recent)-s.limits.PerDay].Add(24 * time.Hour)}
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestPostServiceLimits(t *testing.T) {
+	db := database.NewMemoryClient()
+	ann, err := db.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the content policy is checked after the hard limit
+	posts := NewPostService(db, nil, nil).
+		WithPolicy(database.ContentPolicy{MaxLength: 3}).
+		WithLimits(PostLimits{MaxLength: 5, PerDay: 2})
+
+	tooLong := PostTooLongError{}
+	_, err = posts.Create(ann.ID, "", strings.Repeat("é", 6), nil)
+	if !errors.As(err, &tooLong) || tooLong.MaxLength != 5 {
+		t.Errorf("creating a post over the limit: got %v, want a %T", err, tooLong)
+	}
+	_, err = posts.Create(ann.ID, "", "four", nil)
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("creating a post over the policy: got %v, want a validation error", err)
+	}
+
+	first, err := posts.Create(ann.ID, "", "one", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = posts.Create(ann.ID, "", "two", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = posts.Update(first.ID, ann.ID, strings.Repeat("a", 6), nil)
+	if !errors.As(err, &tooLong) {
+		t.Errorf("updating a post over the limit: got %v, want a %T", err, tooLong)
+	}
+	quota := PostQuotaError{}
+	_, err = posts.Create(ann.ID, "", "3", nil)
+	if !errors.As(err, &quota) {
+		t.Fatalf("creating a post over the quota: got %v, want a %T", err, quota)
+	}
+	if quota.PerDay != 2 || !quota.RetryAt.Equal(first.CreatedAt.Add(24*time.Hour)) {
+		t.Errorf("got %+v, want a retry once the first post is a day old", quota)
+	}
+
+	// the quota is a rolling window
+	err = posts.checkQuota(ann.ID, first.CreatedAt.Add(24*time.Hour))
+	if err != nil {
+		t.Errorf("a day after the first post: %v", err)
+	}
+}
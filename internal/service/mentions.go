@@ -0,0 +1,61 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// mentionPattern finds mentions in posts, of a username, "@ann", or of an
+// email, "@ann@example.com".
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.%+-]+@[\w-]+(?:\.[\w-]+)+|\w+)`)
+
+// Mentions returns the distinct usernames and emails mentioned in text, in
+// order.
+func Mentions(text string) []string {
+	refs := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			refs = append(refs, match[1])
+		}
+	}
+	return refs
+}
+
+// Mentioned returns the IDs of the users mentioned in text. Usernames,
+// compared case-insensitively, and emails must be those of users.
+func (s UserService) Mentioned(text string) ([]string, error) {
+	refs := Mentions(text)
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		var user database.User
+		var err error
+		if strings.Contains(ref, "@") {
+			user, err = s.userByEmail(ref)
+		} else {
+			user, err = s.db.GetUserByUsername(strings.ToLower(ref))
+		}
+		if err != nil {
+			return nil, mentionError(ref, userError(err))
+		}
+		if !seen[user.ID] {
+			seen[user.ID] = true
+			ids = append(ids, user.ID)
+		}
+	}
+	return ids, nil
+}
+
+func mentionError(ref string, err error) error {
+	if err == ErrUserNotFound {
+		return invalid("mentioned user @%s doesn't exist", ref)
+	}
+	return err
+}
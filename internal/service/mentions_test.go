@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestMentions(t *testing.T) {
+	var tests = []struct {
+		text     string
+		expected []string
+	}{
+		{"hello", []string{}},
+		{"thanks @ann@example.com!", []string{"ann@example.com"}},
+		{"@ann@example.com and @bob@example.co.uk.", []string{"ann@example.com", "bob@example.co.uk"}},
+		{"@ann@example.com @ann@example.com", []string{"ann@example.com"}},
+		{"hi @ann, @bob_smith.", []string{"ann", "bob_smith"}},
+		{"@ann.", []string{"ann"}},
+		{"mail ann@example.com or x@ann", []string{}},
+		{"@ @!", []string{}},
+	}
+	for _, tt := range tests {
+		if got := Mentions(tt.text); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Mentions(%q): got %v, want %v", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestMentioned(t *testing.T) {
+	db := database.NewMemoryClient()
+	ids := map[string]string{}
+	users := NewUserService(db, nil)
+	for _, u := range []struct{ email, name, username string }{
+		{"ann@example.com", "Ann", "ann"},
+		{"bob@example.com", "Bob", "bob"},
+		{"carol@example.com", "Carol", ""},
+	} {
+		user, err := users.Create(u.email, "12345", u.name, u.username, 18, database.Profile{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[u.email] = user.ID
+	}
+
+	var tests = []struct {
+		text     string
+		expected []string
+		invalid  bool
+	}{
+		{text: "no mentions"},
+		{text: "hi @ann and @ann@example.com", expected: []string{ids["ann@example.com"]}},
+		{text: "hi @ANN and @bob@example.com", expected: []string{ids["ann@example.com"], ids["bob@example.com"]}},
+		{text: "hi @carol@example.com", expected: []string{ids["carol@example.com"]}},
+		// names aren't usernames
+		{text: "hi @carol", invalid: true},
+		{text: "hi @dave@example.com", invalid: true},
+	}
+	for _, tt := range tests {
+		got, err := users.Mentioned(tt.text)
+		if tt.invalid {
+			if !errors.As(err, &ValidationError{}) {
+				t.Errorf("%q: got %v, want a validation error", tt.text, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		if len(got) != len(tt.expected) || (len(got) > 0 && !reflect.DeepEqual(got, tt.expected)) {
+			t.Errorf("%q: got %v, want %v", tt.text, got, tt.expected)
+		}
+	}
+
+	// posts keep who they mention, and can't mention unknown users
+	posts := NewPostService(db, nil, nil)
+	post, err := posts.Create(ids["bob@example.com"], "", "thanks @ann", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(post.Mentions, []string{ids["ann@example.com"]}) {
+		t.Errorf("got mentions %v, want ann", post.Mentions)
+	}
+	_, err = posts.Create(ids["bob@example.com"], "", "thanks @dave", nil)
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("got %v, want a validation error", err)
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// MaxMessageLength is how many characters a message can have.
+const MaxMessageLength = 2000
+
+// UnreadMessages counts the messages a user hasn't read, in total and by
+// sender ID.
+type UnreadMessages struct {
+	Total    int            `json:"total"`
+	BySender map[string]int `json:"bySender"`
+}
+
+// AttachmentQuotaError is returned once the files attached to the messages
+// of a conversation add up to Quota bytes.
+type AttachmentQuotaError struct {
+	Quota int64
+}
+
+func (e AttachmentQuotaError) Error() string {
+	return fmt.Sprintf("conversations can have at most %d bytes of attachments", e.Quota)
+}
+
+// SendMessage sends text from the user with the given ID to the user found
+// by ref.
+func (s UserService) SendMessage(senderID, ref, text string) (database.Message, error) {
+	if strings.TrimSpace(text) == "" {
+		return database.Message{}, invalid("text can't be empty")
+	}
+	if utf8.RuneCountInString(text) > MaxMessageLength {
+		return database.Message{}, invalid("messages can be at most %d characters", MaxMessageLength)
+	}
+	recipient, err := s.Get(ref)
+	if err != nil {
+		return database.Message{}, err
+	}
+	if recipient.ID == senderID {
+		return database.Message{}, invalid("users can't message themselves")
+	}
+	suspended, err := s.Suspended(senderID)
+	if err != nil {
+		return database.Message{}, err
+	}
+	if suspended {
+		return database.Message{}, ErrUserSuspended
+	}
+	for _, pair := range [][2]string{{senderID, recipient.ID}, {recipient.ID, senderID}} {
+		blocked, err := s.blocked(pair[0], pair[1])
+		if err != nil {
+			return database.Message{}, err
+		}
+		if blocked {
+			return database.Message{}, ErrRecipientBlocked
+		}
+	}
+	message, err := s.db.CreateMessage(senderID, recipient.ID, text)
+	return message, userError(err)
+}
+
+// Conversation returns the messages between the user with the given ID and
+// the user found by ref, oldest first.
+func (s UserService) Conversation(userID, ref string) ([]database.Message, error) {
+	other, err := s.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	return s.db.GetConversation(userID, other.ID)
+}
+
+// UnreadMessages counts the messages the user with the given ID hasn't
+// read.
+func (s UserService) UnreadMessages(userID string) (UnreadMessages, error) {
+	counts, err := s.db.GetUnreadMessageCounts(userID)
+	if err != nil {
+		return UnreadMessages{}, err
+	}
+	unread := UnreadMessages{BySender: counts}
+	for _, count := range counts {
+		unread.Total += count
+	}
+	return unread, nil
+}
+
+// ReadMessage marks a message to the user with the given ID as read, and
+// the earlier ones from the same sender with it.
+func (s UserService) ReadMessage(userID, messageID string) (database.Message, error) {
+	message, err := s.message(messageID)
+	if err != nil {
+		return database.Message{}, err
+	}
+	// senders may know the ID, other users don't learn it exists
+	switch userID {
+	case message.RecipientID:
+	case message.SenderID:
+		return database.Message{}, ErrNotMessageRecipient
+	default:
+		return database.Message{}, ErrMessageNotFound
+	}
+	message, err = s.db.ReadMessage(messageID, time.Now().UTC())
+	if errors.Is(err, database.ErrNotFound) {
+		return database.Message{}, ErrMessageNotFound
+	}
+	return message, err
+}
+
+// AttachmentRoom returns a message of the user with the given ID, checking
+// they can still attach files to it, and how many bytes of files its
+// conversation has room for under quota.
+func (s UserService) AttachmentRoom(userID, messageID string, quota int64) (database.Message, int64, error) {
+	message, err := s.message(messageID)
+	if err != nil {
+		return database.Message{}, 0, err
+	}
+	// recipients may know the ID, other users don't learn it exists
+	switch userID {
+	case message.SenderID:
+	case message.RecipientID:
+		return database.Message{}, 0, ErrNotMessageSender
+	default:
+		return database.Message{}, 0, ErrMessageNotFound
+	}
+	suspended, err := s.Suspended(userID)
+	if err != nil {
+		return database.Message{}, 0, err
+	}
+	if suspended {
+		return database.Message{}, 0, ErrUserSuspended
+	}
+	for _, pair := range [][2]string{{message.SenderID, message.RecipientID}, {message.RecipientID, message.SenderID}} {
+		blocked, err := s.blocked(pair[0], pair[1])
+		if err != nil {
+			return database.Message{}, 0, err
+		}
+		if blocked {
+			return database.Message{}, 0, ErrRecipientBlocked
+		}
+	}
+	used, err := s.db.GetAttachmentsSize(message.SenderID, message.RecipientID)
+	if err != nil {
+		return database.Message{}, 0, err
+	}
+	if used >= quota {
+		return database.Message{}, 0, AttachmentQuotaError{Quota: quota}
+	}
+	return message, quota - used, nil
+}
+
+// Attachment returns a file attached to a message sent or received by the
+// user with the given ID.
+func (s UserService) Attachment(userID, messageID, mediaID string) (database.Media, error) {
+	message, err := s.message(messageID)
+	if err != nil {
+		return database.Media{}, err
+	}
+	if userID != message.SenderID && userID != message.RecipientID {
+		return database.Media{}, ErrMessageNotFound
+	}
+	media, err := s.db.GetMedia(mediaID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && media.MessageID != message.ID) {
+		return database.Media{}, ErrAttachmentNotFound
+	}
+	return media, err
+}
+
+// message returns the message with the given ID.
+func (s UserService) message(id string) (database.Message, error) {
+	message, err := s.db.GetMessage(id)
+	if errors.Is(err, database.ErrNotFound) {
+		return database.Message{}, ErrMessageNotFound
+	}
+	return message, err
+}
+
+// blocked reports whether the user with blockerID blocked the user with
+// blockedID.
+func (s UserService) blocked(blockerID, blockedID string) (bool, error) {
+	blocks, err := s.db.GetBlocks(blockerID)
+	if err != nil {
+		return false, err
+	}
+	for _, block := range blocks {
+		if block.BlockedID == blockedID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
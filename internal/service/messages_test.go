@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestMessages(t *testing.T) {
+	db := database.NewMemoryClient()
+	ann, err := db.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := db.CreateUser("bob@example.com", "12345", "Bob", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewUserService(db, nil)
+
+	sent := []database.Message{}
+	for _, m := range []struct{ from, to, text string }{
+		{ann.ID, "bob@example.com", "hi"},
+		{ann.ID, bob.ID, "are you there?"},
+		{bob.ID, "ann@example.com", "yes"},
+	} {
+		message, err := users.SendMessage(m.from, m.to, m.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, message)
+	}
+	thread, err := users.Conversation(bob.ID, "ann@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thread) != 3 || thread[0].Text != "hi" || thread[2].Text != "yes" {
+		t.Errorf("got thread %+v, want the 3 messages oldest first", thread)
+	}
+	unread, err := users.UnreadMessages(bob.ID)
+	if err != nil || unread.Total != 2 || unread.BySender[ann.ID] != 2 {
+		t.Errorf("got unread %+v, %v, want 2 from ann", unread, err)
+	}
+
+	// reading a message reads the earlier ones too
+	_, err = users.ReadMessage(ann.ID, sent[1].ID)
+	if !errors.Is(err, ErrNotMessageRecipient) {
+		t.Errorf("sender reading: got %v, want %v", err, ErrNotMessageRecipient)
+	}
+	read, err := users.ReadMessage(bob.ID, sent[1].ID)
+	if err != nil || read.ReadAt == nil {
+		t.Fatalf("got %+v, %v, want a read message", read, err)
+	}
+	unread, err = users.UnreadMessages(bob.ID)
+	if err != nil || unread.Total != 0 {
+		t.Errorf("got unread %+v, %v, want none", unread, err)
+	}
+	unread, err = users.UnreadMessages(ann.ID)
+	if err != nil || unread.Total != 1 {
+		t.Errorf("got unread %+v, %v, want bob's reply", unread, err)
+	}
+
+	var tests = []struct {
+		name     string
+		to, text string
+		invalid  bool
+		err      error
+	}{
+		{name: "empty", to: bob.ID, text: "  ", invalid: true},
+		{name: "too long", to: bob.ID, text: strings.Repeat("a", MaxMessageLength+1), invalid: true},
+		{name: "themselves", to: ann.ID, text: "hi", invalid: true},
+		{name: "unknown", to: "nobody@example.com", text: "hi", err: ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		_, err := users.SendMessage(ann.ID, tt.to, tt.text)
+		if tt.invalid && !errors.As(err, &ValidationError{}) {
+			t.Errorf("%s: got %v, want a validation error", tt.name, err)
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	// blocks stop messages both ways
+	_, err = users.Block(bob.ID, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range [][2]string{{ann.ID, bob.ID}, {bob.ID, ann.ID}} {
+		_, err = users.SendMessage(pair[0], pair[1], "hi")
+		if !errors.Is(err, ErrRecipientBlocked) {
+			t.Errorf("got %v, want %v", err, ErrRecipientBlocked)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/moderation"
+)
+
+// PostRejectedError is returned for new posts moderation rejected.
+type PostRejectedError struct {
+	Reason string
+}
+
+func (e PostRejectedError) Error() string {
+	return "post rejected by moderation: " + e.Reason
+}
+
+// PostPendingError is returned for new posts moderation flagged. They're
+// held for an admin to review instead of being created.
+type PostPendingError struct {
+	Post database.PendingPost
+}
+
+func (e PostPendingError) Error() string {
+	return "post is held for review: " + e.Post.Reason
+}
+
+// WithModeration returns a copy of s checking new posts with filter.
+func (s PostService) WithModeration(filter moderation.Filter) PostService {
+	s.moderation = filter
+	return s
+}
+
+// moderate checks the text of a new post. Posts are held for review when
+// the filter fails, rather than let through or lost.
+func (s PostService) moderate(text string) moderation.Verdict {
+	if s.moderation == nil {
+		return moderation.Verdict{Action: moderation.Allow}
+	}
+	verdict, err := s.moderation.Check(context.Background(), text)
+	if err != nil {
+		return moderation.Verdict{Action: moderation.Flag, Reason: fmt.Sprintf("moderation failed: %v", err)}
+	}
+	return verdict
+}
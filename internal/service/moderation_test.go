@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/moderation"
+)
+
+type failingFilter struct{}
+
+func (failingFilter) Check(ctx context.Context, text string) (moderation.Verdict, error) {
+	return moderation.Verdict{}, errors.New("unavailable")
+}
+
+func TestPostServiceModeration(t *testing.T) {
+	db := database.NewMemoryClient()
+	ann, err := db.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := NewPostService(db, nil, nil).WithModeration(moderation.Wordlist{
+		Reject: map[string]bool{"casino": true},
+		Flag:   map[string]bool{"crypto": true},
+	})
+
+	_, err = posts.Create(ann.ID, "", "hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := PostRejectedError{}
+	_, err = posts.Create(ann.ID, "", "online casino", nil)
+	if !errors.As(err, &rejected) {
+		t.Errorf("rejected post: got %v, want a %T", err, rejected)
+	}
+	pending := PostPendingError{}
+	_, err = posts.Create(ann.ID, "", "buy crypto", []string{"Money"})
+	if !errors.As(err, &pending) {
+		t.Fatalf("flagged post: got %v, want a %T", err, pending)
+	}
+	if pending.Post.UserID != ann.ID || pending.Post.Tags[0] != "money" {
+		t.Errorf("got pending post %+v", pending.Post)
+	}
+
+	// posts are held for review when the filter fails
+	_, err = posts.WithModeration(failingFilter{}).Create(ann.ID, "", "hello again", nil)
+	if !errors.As(err, &pending) {
+		t.Errorf("post with a failing filter: got %v, want a %T", err, pending)
+	}
+
+	all, err := posts.All("")
+	if err != nil || len(all) != 1 {
+		t.Errorf("got posts %v, %v, want the allowed one only", all, err)
+	}
+	held, err := db.GetPendingPosts()
+	if err != nil || len(held) != 2 {
+		t.Errorf("got pending posts %v, %v, want 2", held, err)
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/passhash"
+)
+
+// BreachChecker tells whether a password is known from a data breach.
+type BreachChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+// PasswordViolation is a rule of the password policy a password breaks,
+// named like the policy field setting it.
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordError is returned for a new password breaking the password
+// policy, listing every rule it breaks.
+type PasswordError struct {
+	Violations []PasswordViolation
+}
+
+func (e PasswordError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidatePasswordPolicy checks the settings of a policy before it's saved.
+func ValidatePasswordPolicy(policy database.PasswordPolicy) error {
+	if policy.MinLength < 0 {
+		return invalid("minLength can't be negative")
+	}
+	return nil
+}
+
+// WithPasswordPolicy returns a copy of s enforcing policy on new passwords,
+// checking for breached passwords with breaches when the policy asks to.
+func (s UserService) WithPasswordPolicy(policy database.PasswordPolicy, breaches BreachChecker) UserService {
+	s.passwords = policy
+	s.breaches = breaches
+	return s
+}
+
+// CheckPassword checks a new password against the password policy. The
+// breach check only runs once the other rules pass, so rejected passwords
+// aren't sent anywhere.
+func (s UserService) CheckPassword(password string) error {
+	if password == "" {
+		return invalid("password can't be empty")
+	}
+	policy := s.passwords
+	violations := []PasswordViolation{}
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		violations = append(violations, PasswordViolation{Rule: "minLength", Message: fmt.Sprintf("password must be at least %d characters", policy.MinLength)})
+	}
+	classes := []struct {
+		required bool
+		rule     string
+		name     string
+		in       func(rune) bool
+	}{
+		{policy.RequireLower, "requireLower", "a lowercase letter", unicode.IsLower},
+		{policy.RequireUpper, "requireUpper", "an uppercase letter", unicode.IsUpper},
+		{policy.RequireDigit, "requireDigit", "a digit", unicode.IsDigit},
+		{policy.RequireSymbol, "requireSymbol", "a symbol", isSymbol},
+	}
+	for _, class := range classes {
+		if class.required && strings.IndexFunc(password, class.in) < 0 {
+			violations = append(violations, PasswordViolation{Rule: class.rule, Message: "password must contain " + class.name})
+		}
+	}
+	if len(violations) > 0 {
+		return PasswordError{Violations: violations}
+	}
+
+	if policy.RejectBreached && s.breaches != nil {
+		breached, err := s.breaches.Breached(context.Background(), password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return PasswordError{Violations: []PasswordViolation{{Rule: "rejectBreached", Message: "password appeared in a data breach, choose another one"}}}
+		}
+	}
+	return nil
+}
+
+// WithHasher returns a copy of s hashing new passwords with hasher.
+func (s UserService) WithHasher(hasher passhash.Hasher) UserService {
+	s.hasher = hasher
+	return s
+}
+
+// SetPassword hashes password and stores it as the password of the user
+// with id. Callers check it against the policy first.
+func (s UserService) SetPassword(id, password string) (database.User, error) {
+	hash, tag, err := s.hash(password)
+	if err != nil {
+		return database.User{}, err
+	}
+	return s.db.SetPassword(id, hash, tag)
+}
+
+// withPassword returns user with password hashed as their password, unless
+// it's their current one. New passwords are checked against the policy.
+func (s UserService) withPassword(user database.User, password string) (database.User, error) {
+	same, err := s.VerifyPassword(user, password)
+	if err != nil || same {
+		return user, err
+	}
+	err = s.CheckPassword(password)
+	if err != nil {
+		return database.User{}, err
+	}
+	user.Password, user.PasswordAlgorithm, err = s.hash(password)
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, nil
+}
+
+// VerifyPassword reports whether password is the password of user,
+// whichever algorithm hashed it.
+func (s UserService) VerifyPassword(user database.User, password string) (bool, error) {
+	return s.hasher.Verify(password, user.Password, user.PasswordAlgorithm)
+}
+
+// RehashPassword hashes the verified password of user again when the
+// configured algorithm, cost or pepper changed since it was hashed.
+func (s UserService) RehashPassword(user database.User, password string) (database.User, error) {
+	if !s.hasher.NeedsRehash(user.Password, user.PasswordAlgorithm) {
+		return user, nil
+	}
+	return s.SetPassword(user.ID, password)
+}
+
+func (s UserService) hash(password string) (string, string, error) {
+	hash, tag, err := s.hasher.Hash(password)
+	if errors.Is(err, passhash.ErrTooLong) {
+		return "", "", ValidationError{Err: err}
+	}
+	return hash, tag, err
+}
+
+// isSymbol reports whether r is neither a letter, a digit nor a space.
+func isSymbol(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/passhash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// breachList is a BreachChecker knowing a fixed list of passwords.
+type breachList map[string]bool
+
+func (l breachList) Breached(ctx context.Context, password string) (bool, error) {
+	return l[password], nil
+}
+
+func TestCheckPassword(t *testing.T) {
+	strict := database.PasswordPolicy{MinLength: 8, RequireLower: true, RequireUpper: true, RequireDigit: true, RequireSymbol: true, RejectBreached: true}
+	var tests = []struct {
+		policy   database.PasswordPolicy
+		password string
+		// rules is nil for a valid password
+		rules []string
+	}{
+		{policy: database.PasswordPolicy{}, password: "1"},
+		{policy: strict, password: "Tr0ub4dor&3"},
+		{policy: strict, password: "short", rules: []string{"minLength", "requireUpper", "requireDigit", "requireSymbol"}},
+		{policy: strict, password: "ÉCOLE123!", rules: []string{"requireLower"}},
+		{policy: strict, password: "Passw0rd!", rules: []string{"rejectBreached"}},
+		{policy: database.PasswordPolicy{MinLength: 8}, password: "Passw0rd!"},
+	}
+	users := NewUserService(database.NewMemoryClient(), nil)
+	for _, tt := range tests {
+		err := users.WithPasswordPolicy(tt.policy, breachList{"Passw0rd!": true}).CheckPassword(tt.password)
+		passwordErr := PasswordError{}
+		if tt.rules == nil {
+			if err != nil {
+				t.Errorf("%q: got %v, want no error", tt.password, err)
+			}
+			continue
+		}
+		if !errors.As(err, &passwordErr) {
+			t.Errorf("%q: got %v, want a password error", tt.password, err)
+			continue
+		}
+		rules := []string{}
+		for _, violation := range passwordErr.Violations {
+			rules = append(rules, violation.Rule)
+		}
+		if !reflect.DeepEqual(rules, tt.rules) {
+			t.Errorf("%q: got rules %v, want %v", tt.password, rules, tt.rules)
+		}
+	}
+}
+
+func TestUserServicePasswordPolicy(t *testing.T) {
+	db := database.NewMemoryClient()
+	users := NewUserService(db, nil).WithPasswordPolicy(database.PasswordPolicy{MinLength: 8}, nil)
+
+	_, err := users.Create("ann@example.com", "short", "Ann", "", 18, database.Profile{})
+	if !errors.As(err, &PasswordError{}) {
+		t.Errorf("creating with a short password: got %v, want a password error", err)
+	}
+	ann, err := users.Create("ann@example.com", "long enough", "Ann", "", 18, database.Profile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = users.Update(ann.ID, ann.ID, "", "short", "Ann", "", 18, database.Profile{})
+	if !errors.As(err, &PasswordError{}) {
+		t.Errorf("updating to a short password: got %v, want a password error", err)
+	}
+	short := "short"
+	_, err = users.Patch(ann.ID, ann.ID, UserPatch{Password: &short})
+	if !errors.As(err, &PasswordError{}) {
+		t.Errorf("patching to a short password: got %v, want a password error", err)
+	}
+	// passwords from before the policy are kept when other fields change
+	_, err = NewUserService(db, nil).WithPasswordPolicy(database.PasswordPolicy{MinLength: 20}, nil).Update(ann.ID, ann.ID, "", "long enough", "Ann B.", "", 18, database.Profile{})
+	if err != nil {
+		t.Errorf("updating the name: got %v, want no error", err)
+	}
+}
+
+func TestUserServicePasswordHashing(t *testing.T) {
+	db := database.NewMemoryClient()
+	users := NewUserService(db, nil).WithHasher(passhash.Hasher{BcryptCost: bcrypt.MinCost})
+
+	ann, err := users.Create("ann@example.com", "12345", "Ann", "", 18, database.Profile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ann.Password == "12345" || ann.PasswordAlgorithm != passhash.Bcrypt {
+		t.Fatalf("got password %q hashed with %q, want a bcrypt hash", ann.Password, ann.PasswordAlgorithm)
+	}
+
+	var tests = []struct {
+		name     string
+		password string
+		patch    bool
+		rehashed bool
+	}{
+		{name: "same password", password: "12345"},
+		{name: "new password", password: "54321", rehashed: true},
+		{name: "patched password", password: "abcde", patch: true, rehashed: true},
+	}
+	for _, tt := range tests {
+		before, err := db.GetUser(ann.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.patch {
+			_, err = users.Patch(ann.ID, ann.ID, UserPatch{Password: &tt.password})
+		} else {
+			_, err = users.Update(ann.ID, ann.ID, "", tt.password, "Ann B.", "", 18, database.Profile{})
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		after, err := db.GetUser(ann.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (after.Password != before.Password) != tt.rehashed {
+			t.Errorf("%s: got rehashed %v, want %v", tt.name, after.Password != before.Password, tt.rehashed)
+		}
+		ok, err := users.VerifyPassword(after, tt.password)
+		if err != nil || !ok {
+			t.Errorf("%s: verifying the password: got %v, %v", tt.name, ok, err)
+		}
+	}
+
+	// a new algorithm applies once the password is verified again
+	scrypt := users.WithHasher(passhash.Hasher{Algorithm: passhash.Scrypt, Scrypt: passhash.ScryptParams{N: 1 << 4, R: 8, P: 1}})
+	ann, err = db.GetUser(ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ann, err = scrypt.RehashPassword(ann, "abcde")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := scrypt.VerifyPassword(ann, "abcde")
+	if ann.PasswordAlgorithm != passhash.Scrypt || err != nil || !ok {
+		t.Errorf("got %q, %v, %v, want a verified scrypt hash", ann.PasswordAlgorithm, ok, err)
+	}
+}
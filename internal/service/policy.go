@@ -0,0 +1,102 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+const (
+	LinksAllow = "allow"
+	LinksDeny  = "deny"
+
+	ProfanityOff     = "off"
+	ProfanityLenient = "lenient"
+	ProfanityStrict  = "strict"
+)
+
+var linkPattern = regexp.MustCompile(`(?i)\b(https?://|www\.)\S`)
+
+// strongProfanity is rejected by lenient and strict policies, mildProfanity
+// only by strict ones.
+var (
+	strongProfanity = wordSet("fuck", "fucking", "motherfucker", "cunt", "shit", "bullshit", "asshole")
+	mildProfanity   = wordSet("damn", "crap", "bastard", "bitch", "piss", "dick", "ass")
+)
+
+func wordSet(words ...string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
+
+// ValidateContentPolicy checks the settings of a policy before it's saved.
+func ValidateContentPolicy(policy database.ContentPolicy) error {
+	if policy.MaxLength < 0 {
+		return invalid("maxLength can't be negative")
+	}
+	switch policy.Links {
+	case "", LinksAllow, LinksDeny:
+	default:
+		return invalid("links must be %s or %s", LinksAllow, LinksDeny)
+	}
+	switch policy.Profanity {
+	case "", ProfanityOff, ProfanityLenient, ProfanityStrict:
+	default:
+		return invalid("profanity must be %s, %s or %s", ProfanityOff, ProfanityLenient, ProfanityStrict)
+	}
+	for _, mediaType := range policy.AllowedMediaTypes {
+		if !strings.Contains(mediaType, "/") {
+			return invalid("invalid media type %q, e.g. image/png", mediaType)
+		}
+	}
+	return nil
+}
+
+// CheckText checks the text of a post against a policy.
+func CheckText(policy database.ContentPolicy, text string) error {
+	if policy.MaxLength > 0 && utf8.RuneCountInString(text) > policy.MaxLength {
+		return invalid("posts can be at most %d characters", policy.MaxLength)
+	}
+	if policy.Links == LinksDeny && linkPattern.MatchString(text) {
+		return invalid("posts can't contain links")
+	}
+	if word := profanity(policy.Profanity, text); word != "" {
+		return invalid("posts can't contain %q", word)
+	}
+	return nil
+}
+
+// MediaTypeAllowed reports whether a policy accepts media of the given type.
+func MediaTypeAllowed(policy database.ContentPolicy, contentType string) bool {
+	if len(policy.AllowedMediaTypes) == 0 {
+		return true
+	}
+	for _, allowed := range policy.AllowedMediaTypes {
+		if allowed == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// profanity returns the first word of text rejected at the given level.
+func profanity(level, text string) string {
+	if level != ProfanityLenient && level != ProfanityStrict {
+		return ""
+	}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		if strongProfanity[word] || (level == ProfanityStrict && mildProfanity[word]) {
+			return word
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestCheckText(t *testing.T) {
+	var tests = []struct {
+		policy    database.ContentPolicy
+		text      string
+		expectErr bool
+	}{
+		{policy: database.ContentPolicy{}, text: "anything goes, damn https://example.com"},
+		{policy: database.ContentPolicy{MaxLength: 5}, text: "héllo"},
+		{policy: database.ContentPolicy{MaxLength: 5}, text: "hello!", expectErr: true},
+		{policy: database.ContentPolicy{Links: LinksDeny}, text: "see https://example.com", expectErr: true},
+		{policy: database.ContentPolicy{Links: LinksDeny}, text: "see www.example.com", expectErr: true},
+		{policy: database.ContentPolicy{Links: LinksDeny}, text: "the www is big"},
+		{policy: database.ContentPolicy{Profanity: ProfanityLenient}, text: "Oh damn"},
+		{policy: database.ContentPolicy{Profanity: ProfanityLenient}, text: "oh SHIT!", expectErr: true},
+		{policy: database.ContentPolicy{Profanity: ProfanityStrict}, text: "Oh damn", expectErr: true},
+		{policy: database.ContentPolicy{Profanity: ProfanityStrict}, text: "a classic passage"},
+	}
+	for _, tt := range tests {
+		err := CheckText(tt.policy, tt.text)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("%+v %q: got error %v, want error %v", tt.policy, tt.text, err, tt.expectErr)
+		}
+		if err != nil && !errors.As(err, &ValidationError{}) {
+			t.Errorf("%+v %q: got %v, want a validation error", tt.policy, tt.text, err)
+		}
+	}
+}
+
+func TestValidateContentPolicy(t *testing.T) {
+	var tests = []struct {
+		policy    database.ContentPolicy
+		expectErr bool
+	}{
+		{policy: database.ContentPolicy{}},
+		{policy: database.ContentPolicy{MaxLength: 280, AllowedMediaTypes: []string{"image/png"}, Links: LinksDeny, Profanity: ProfanityStrict}},
+		{policy: database.ContentPolicy{MaxLength: -1}, expectErr: true},
+		{policy: database.ContentPolicy{Links: "nofollow"}, expectErr: true},
+		{policy: database.ContentPolicy{Profanity: "medium"}, expectErr: true},
+		{policy: database.ContentPolicy{AllowedMediaTypes: []string{"png"}}, expectErr: true},
+	}
+	for _, tt := range tests {
+		err := ValidateContentPolicy(tt.policy)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("%+v: got error %v, want error %v", tt.policy, err, tt.expectErr)
+		}
+	}
+}
+
+func TestPostServicePolicy(t *testing.T) {
+	db := database.NewMemoryClient()
+	ann, err := db.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := NewPostService(db, nil, nil).WithPolicy(database.ContentPolicy{MaxLength: 5})
+
+	post, err := posts.Create(ann.ID, "", "short", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = posts.Create(ann.ID, "", "too long", nil)
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("creating a long post: got %v, want a validation error", err)
+	}
+	_, err = posts.Update(post.ID, ann.ID, "too long", nil)
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("updating to a long post: got %v, want a validation error", err)
+	}
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/moderation"
+)
+
+type PostService struct {
+	db    database.Client
+	users UserService
+	// exists may be nil, checks then always read the database.
+	exists ExistenceFilter
+	// deleteMedia removes the stored file of a deleted post's media.
+	deleteMedia func(id string)
+	// policy is the content policy of the tenant posting.
+	policy database.ContentPolicy
+	limits PostLimits
+	// moderation may be nil, posts are then only checked against the
+	// policy.
+	moderation moderation.Filter
+	// viewerID is the user the posts are listed for, see ForViewer.
+	viewerID string
+}
+
+func NewPostService(db database.Client, exists ExistenceFilter, deleteMedia func(id string)) PostService {
+	return PostService{
+		db:          db,
+		users:       NewUserService(db, exists),
+		exists:      exists,
+		deleteMedia: deleteMedia,
+	}
+}
+
+// WithPolicy returns a copy of s checking posts against policy.
+func (s PostService) WithPolicy(policy database.ContentPolicy) PostService {
+	s.policy = policy
+	return s
+}
+
+// Create adds a post by the user with the given ID, or else the given email.
+// Posts flagged by moderation are held for review, with a PostPendingError.
+func (s PostService) Create(userID, email, text string, tags []string) (database.Post, error) {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return database.Post{}, ValidationError{Err: err}
+	}
+	err = s.checkLength(text)
+	if err != nil {
+		return database.Post{}, err
+	}
+	err = CheckText(s.policy, text)
+	if err != nil {
+		return database.Post{}, err
+	}
+	user, err := s.users.Author(userID, email)
+	if err != nil {
+		return database.Post{}, err
+	}
+	suspended, err := s.users.Suspended(user.ID)
+	if err != nil {
+		return database.Post{}, err
+	}
+	if suspended {
+		return database.Post{}, ErrUserSuspended
+	}
+	err = s.checkQuota(user.ID, time.Now())
+	if err != nil {
+		return database.Post{}, err
+	}
+	mentions, err := s.users.Mentioned(text)
+	if err != nil {
+		return database.Post{}, err
+	}
+	verdict := s.moderate(text)
+	switch verdict.Action {
+	case moderation.Reject:
+		return database.Post{}, PostRejectedError{Reason: verdict.Reason}
+	case moderation.Flag:
+		pending, err := s.db.CreatePendingPost(database.PendingPost{UserID: user.ID, Text: text, Tags: tags, Mentions: mentions, Reason: verdict.Reason})
+		if err != nil {
+			return database.Post{}, err
+		}
+		return database.Post{}, PostPendingError{Post: pending}
+	}
+	return s.db.InsertPost(database.Post{UserID: user.ID, Text: text, Tags: tags, Mentions: mentions})
+}
+
+// Get returns a post, unless its author is suspended or blocked by the
+// viewer. IDs the existence filter doesn't know aren't read.
+func (s PostService) Get(id string) (database.Post, error) {
+	if s.exists != nil && !s.exists.MayHavePost(id) {
+		return database.Post{}, ErrPostNotFound
+	}
+	post, err := s.db.GetPost(id)
+	if err != nil {
+		return database.Post{}, postError(err)
+	}
+	visible, err := s.visible(post.UserID)
+	if err != nil {
+		return database.Post{}, err
+	}
+	if !visible {
+		return database.Post{}, ErrPostNotFound
+	}
+	return post, nil
+}
+
+// ByAuthor returns the posts of the user with the given ID, or else the
+// given email, newest first. A non-empty tag only keeps posts carrying it.
+// Suspended users, and users blocked by the viewer, have none.
+func (s PostService) ByAuthor(userID, email, tag string) ([]database.Post, error) {
+	user, err := s.users.Author(userID, email)
+	if err != nil {
+		return nil, err
+	}
+	visible, err := s.visible(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return []database.Post{}, nil
+	}
+	posts, err := s.db.GetPosts(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if tag != "" {
+		posts = filterPostsByTag(posts, NormalizeTag(tag))
+	}
+	return newestFirst(posts), nil
+}
+
+// All returns every post carrying tag, or every post for an empty tag,
+// newest first, leaving out the posts of suspended users and of the users
+// the viewer blocked.
+func (s PostService) All(tag string) ([]database.Post, error) {
+	var posts []database.Post
+	var err error
+	if tag != "" {
+		posts, err = s.db.GetPostsByTag(NormalizeTag(tag))
+	} else {
+		posts, err = s.db.GetAllPosts()
+	}
+	if err != nil {
+		return nil, err
+	}
+	hidden, err := s.hiddenAuthors(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return newestFirst(withoutAuthors(posts, hidden)), nil
+}
+
+// Iterate walks the posts ByAuthor returns, or All returns when only a tag
+// is given, starting after a cursor when it's set.
+func (s PostService) Iterate(userID, email, tag string, after *database.PostCursor) (*database.PostIterator, error) {
+	hidden, err := s.hiddenAuthors(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	query := database.PostQuery{ExceptUserIDs: hidden, After: after}
+	if userID != "" || email != "" || tag == "" {
+		user, err := s.users.Author(userID, email)
+		if err != nil {
+			return nil, err
+		}
+		query.UserID = user.ID
+	}
+	if tag != "" {
+		query.Tag = NormalizeTag(tag)
+	}
+	return s.db.IteratePosts(query)
+}
+
+// Update replaces the text and tags of a post written by the given user.
+func (s PostService) Update(id, userID, text string, tags []string) (database.Post, error) {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return database.Post{}, ValidationError{Err: err}
+	}
+	err = s.checkLength(text)
+	if err != nil {
+		return database.Post{}, err
+	}
+	err = CheckText(s.policy, text)
+	if err != nil {
+		return database.Post{}, err
+	}
+	_, err = s.Authored(id, userID)
+	if err != nil {
+		return database.Post{}, err
+	}
+	post, err := s.db.UpdatePost(id, text, tags)
+	return post, postError(err)
+}
+
+// Delete removes a post written by the given user along with its media
+// files.
+func (s PostService) Delete(id, userID string) error {
+	post, err := s.Authored(id, userID)
+	if err != nil {
+		return err
+	}
+	err = s.db.DeletePost(id)
+	if err != nil {
+		return postError(err)
+	}
+	if s.deleteMedia != nil {
+		for _, mediaID := range post.Media {
+			s.deleteMedia(mediaID)
+		}
+	}
+	return nil
+}
+
+// Revisions returns every version of a post, oldest first, unless the
+// viewer doesn't see its author's posts.
+func (s PostService) Revisions(id string) ([]database.PostRevision, error) {
+	_, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := s.db.GetPostRevisions(id)
+	return revisions, postError(err)
+}
+
+// Revert restores the text and tags of an earlier revision of a post
+// written by the given user. The restored text becomes a new revision, so
+// the history is kept.
+func (s PostService) Revert(id string, number int, userID string) (database.Post, error) {
+	_, err := s.Authored(id, userID)
+	if err != nil {
+		return database.Post{}, err
+	}
+	revisions, err := s.db.GetPostRevisions(id)
+	if err != nil {
+		return database.Post{}, postError(err)
+	}
+	if number < 1 || number > len(revisions) {
+		return database.Post{}, ErrRevisionNotFound
+	}
+	revision := revisions[number-1]
+	return s.Update(id, userID, revision.Text, revision.Tags)
+}
+
+// Authored returns the post if it was written by the given user, who sees
+// it even when their account is private.
+func (s PostService) Authored(id, userID string) (database.Post, error) {
+	post, err := s.ForViewer(userID).Get(id)
+	if err != nil {
+		return database.Post{}, err
+	}
+	if post.UserID != userID {
+		return database.Post{}, ErrNotPostAuthor
+	}
+	return post, nil
+}
+
+func newestFirst(posts []database.Post) []database.Post {
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID < posts[j].ID
+	})
+	return posts
+}
+
+func postError(err error) error {
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrPostNotFound
+	}
+	return err
+}
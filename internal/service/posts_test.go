@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestPostService(t *testing.T) {
+	db := database.NewMemoryClient()
+	err := db.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ann, err := db.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := NewPostService(db, nil, nil)
+
+	first, err := posts.Create(ann.ID, "", "first", []string{"#Go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := posts.Create("", "ann@example.com", "second", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = posts.Create("", "nobody@example.com", "lost", nil)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("posting as a missing user: got %v, want %v", err, ErrUserNotFound)
+	}
+	_, err = posts.Create(ann.ID, "", "bad", []string{"two words"})
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("posting with an invalid tag: got %v, want a validation error", err)
+	}
+
+	var tests = []struct {
+		name     string
+		list     func() ([]database.Post, error)
+		expected []string
+	}{
+		{name: "by author", list: func() ([]database.Post, error) { return posts.ByAuthor(ann.ID, "", "") }, expected: []string{second.ID, first.ID}},
+		{name: "by author and tag", list: func() ([]database.Post, error) { return posts.ByAuthor("", "ann@example.com", "GO") }, expected: []string{first.ID}},
+		{name: "all", list: func() ([]database.Post, error) { return posts.All("") }, expected: []string{second.ID, first.ID}},
+		{name: "all by tag", list: func() ([]database.Post, error) { return posts.All("#go") }, expected: []string{first.ID}},
+	}
+	for _, tt := range tests {
+		got, err := tt.list()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		ids := []string{}
+		for _, post := range got {
+			ids = append(ids, post.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.expected) {
+			t.Errorf("%s: got %v, want %v", tt.name, ids, tt.expected)
+		}
+	}
+
+	_, err = posts.Authored(first.ID, "someone-else")
+	if !errors.Is(err, ErrNotPostAuthor) {
+		t.Errorf("got %v, want %v", err, ErrNotPostAuthor)
+	}
+	_, err = posts.Update("0b4a1d6e-8c1f-4f5e-9a57-5f1a8d0f6b2c", first.UserID, "text", nil)
+	if !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("updating a missing post: got %v, want %v", err, ErrPostNotFound)
+	}
+	_, err = posts.Update(first.ID, "someone-else", "text", nil)
+	if !errors.Is(err, ErrNotPostAuthor) {
+		t.Errorf("updating someone else's post: got %v, want %v", err, ErrNotPostAuthor)
+	}
+	err = posts.Delete(first.ID, "someone-else")
+	if !errors.Is(err, ErrNotPostAuthor) {
+		t.Errorf("deleting someone else's post: got %v, want %v", err, ErrNotPostAuthor)
+	}
+	err = posts.Delete(first.ID, first.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = posts.Get(first.ID)
+	if !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("getting a deleted post: got %v, want %v", err, ErrPostNotFound)
+	}
+}
+
+func TestPostServiceRevert(t *testing.T) {
+	db := database.NewMemoryClient()
+	ann, err := db.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := NewPostService(db, nil, nil)
+	post, err := posts.Create(ann.ID, "", "first", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = posts.Update(post.ID, ann.ID, "second", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = posts.Revert(post.ID, 1, "someone-else")
+	if !errors.Is(err, ErrNotPostAuthor) {
+		t.Errorf("reverting someone else's post: got %v, want %v", err, ErrNotPostAuthor)
+	}
+	_, err = posts.Revert(post.ID, 3, ann.ID)
+	if !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("reverting to a missing revision: got %v, want %v", err, ErrRevisionNotFound)
+	}
+	reverted, err := posts.Revert(post.ID, 1, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reverted.Text != "first" {
+		t.Errorf("got text %q, want first", reverted.Text)
+	}
+	revisions, err := posts.Revisions(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 || revisions[2].Text != "first" {
+		t.Errorf("got %+v, want the revert as revision 3", revisions)
+	}
+
+	// the history of private users is hidden like their posts, but they
+	// can still revert their own
+	_, err = db.SetUserPrivate(ann.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = posts.Revisions(post.ID)
+	if !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("revisions of a private user's post: got %v, want %v", err, ErrPostNotFound)
+	}
+	_, err = posts.ForViewer(ann.ID).Revisions(post.ID)
+	if err != nil {
+		t.Errorf("revisions of own post: %v", err)
+	}
+	_, err = posts.Revert(post.ID, 2, ann.ID)
+	if err != nil {
+		t.Errorf("reverting own post once private: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+const (
+	maxBioLength      = 280
+	maxLocationLength = 100
+)
+
+// ValidateProfile checks the profile fields a user can set.
+func ValidateProfile(profile database.Profile) error {
+	if utf8.RuneCountInString(profile.Bio) > maxBioLength {
+		return fmt.Errorf("bio can be at most %d characters", maxBioLength)
+	}
+	if utf8.RuneCountInString(profile.Location) > maxLocationLength {
+		return fmt.Errorf("location can be at most %d characters", maxLocationLength)
+	}
+	if profile.Website != "" && !isWebURL(profile.Website) {
+		return errors.New("website must be an http or https URL")
+	}
+	// uploaded avatars are served by the API itself
+	if profile.AvatarURL != "" && !isWebURL(profile.AvatarURL) && !strings.HasPrefix(profile.AvatarURL, "/media/") {
+		return errors.New("avatarUrl must be an http or https URL")
+	}
+	return nil
+}
+
+func isWebURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// UserPatch holds the fields of a user to change, nil fields are kept.
+type UserPatch struct {
+	Email     *string `json:"email"`
+	Username  *string `json:"username"`
+	Password  *string `json:"password"`
+	Name      *string `json:"name"`
+	Age       *int    `json:"age"`
+	Bio       *string `json:"bio"`
+	Location  *string `json:"location"`
+	Website   *string `json:"website"`
+	AvatarURL *string `json:"avatarUrl"`
+	Private   *bool   `json:"private"`
+}
+
+// Patch changes only the fields of the user with the given ID set in patch,
+// storing the user in one write once everything is checked.
+func (s UserService) Patch(ref, userID string, patch UserPatch) (database.User, error) {
+	user, err := s.Own(ref, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	password := user.Password
+	setString(&password, patch.Password)
+	setString(&user.Email, patch.Email)
+	setString(&user.Name, patch.Name)
+	if patch.Age != nil {
+		user.Age = *patch.Age
+	}
+	setString(&user.Bio, patch.Bio)
+	setString(&user.Location, patch.Location)
+	setString(&user.Website, patch.Website)
+	setString(&user.AvatarURL, patch.AvatarURL)
+	if patch.Private != nil {
+		user.Private = *patch.Private
+	}
+	err = ValidateUser(user.Email, password, user.Age)
+	if err == nil {
+		err = ValidateProfile(user.Profile)
+	}
+	if err != nil {
+		return database.User{}, ValidationError{Err: err}
+	}
+	if patch.Username != nil {
+		user.Username, err = s.checkUsername(user.ID, *patch.Username)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+	if patch.Password != nil {
+		user, err = s.withPassword(user, *patch.Password)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+	return s.replace(user)
+}
+
+func setString(field *string, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
@@ -0,0 +1,64 @@
+// Package service holds the business rules for users and posts: validation,
+// existence checks and who may change what. HTTP handlers, the GraphQL
+// resolvers and the gRPC services only map their requests onto these calls
+// and the errors back onto responses, so the rules can be tested without a
+// transport.
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUserNotFound      = errors.New("user doesn't exist")
+	ErrUserAlreadyExists = errors.New("user with that email already exists")
+	ErrPostNotFound      = errors.New("post with that id doesn't exist")
+	ErrNotPostAuthor     = errors.New("users can only change their own posts")
+	ErrNotAccountOwner   = errors.New("users can only change their own account")
+	ErrRevisionNotFound  = errors.New("post has no revision with that number")
+	ErrUserSuspended     = errors.New("user is suspended")
+	ErrUserNotBlocked    = errors.New("user isn't blocked")
+	ErrNotFollowing      = errors.New("user isn't followed")
+	// ErrFollowRequestNotFound is returned for accepting or rejecting a
+	// request that isn't pending.
+	ErrFollowRequestNotFound = errors.New("no pending request to follow from that user")
+	ErrMessageNotFound       = errors.New("message with that id doesn't exist")
+	// ErrNotMessageRecipient is returned for marking a message read by
+	// anyone but its recipient.
+	ErrNotMessageRecipient = errors.New("only the recipient can mark a message read")
+	// ErrRecipientBlocked is returned for messaging a user who blocked the
+	// sender, or whom the sender blocked.
+	ErrRecipientBlocked = errors.New("messages between users who blocked one another aren't allowed")
+	// ErrNotMessageSender is returned for attaching files to a message by
+	// anyone but its sender.
+	ErrNotMessageSender   = errors.New("only the sender can attach files to a message")
+	ErrAttachmentNotFound = errors.New("message has no attachment with that id")
+	ErrUsernameTaken      = errors.New("username is taken")
+)
+
+// ValidationError is returned for input breaking a rule, before anything is
+// written.
+type ValidationError struct {
+	Err error
+}
+
+func (e ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func invalid(format string, args ...interface{}) error {
+	return ValidationError{Err: fmt.Errorf(format, args...)}
+}
+
+// ExistenceFilter answers whether a record may exist without reading the
+// database. False answers must be certain, true answers are checked against
+// the database.
+type ExistenceFilter interface {
+	MayHaveUser(email string) bool
+	MayHavePost(id string) bool
+}
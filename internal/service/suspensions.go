@@ -0,0 +1,51 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// Suspended reports whether the user with the given ID is suspended or
+// banned now. Their posts are hidden meanwhile.
+func (s UserService) Suspended(id string) (bool, error) {
+	suspension, err := s.db.GetSuspension(id)
+	if errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return suspension.Active(time.Now()), nil
+}
+
+// suspendedUserIDs returns the users with a suspension in effect at now.
+// Expired ones count as lifted before the scheduler purges them.
+func suspendedUserIDs(db database.Client, now time.Time) (map[string]bool, error) {
+	suspensions, err := db.GetSuspensions()
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]bool{}
+	for _, suspension := range suspensions {
+		if suspension.Active(now) {
+			ids[suspension.UserID] = true
+		}
+	}
+	return ids, nil
+}
+
+// withoutAuthors leaves out the posts of the hidden users.
+func withoutAuthors(posts []database.Post, hidden map[string]bool) []database.Post {
+	if len(hidden) == 0 {
+		return posts
+	}
+	visible := make([]database.Post, 0, len(posts))
+	for _, post := range posts {
+		if !hidden[post.UserID] {
+			visible = append(visible, post)
+		}
+	}
+	return visible
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestPostServiceHidesSuspendedUsers(t *testing.T) {
+	db := database.NewMemoryClient()
+	ann, err := db.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := db.CreateUser("bob@example.com", "12345", "Bob", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := NewPostService(db, nil, nil)
+	hidden, err := posts.Create(ann.ID, "", "hidden", []string{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	visible, err := posts.Create(bob.ID, "", "visible", []string{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.SuspendUser(database.Suspension{UserID: ann.ID, Reason: "spam", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = posts.Get(hidden.ID)
+	if !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("get: got %v, want %v", err, ErrPostNotFound)
+	}
+	_, err = posts.Create(ann.ID, "", "more", nil)
+	if !errors.Is(err, ErrUserSuspended) {
+		t.Errorf("create: got %v, want %v", err, ErrUserSuspended)
+	}
+	byAuthor, err := posts.ByAuthor(ann.ID, "", "")
+	if err != nil || len(byAuthor) != 0 {
+		t.Errorf("by author: got %v, %v, want no posts", byAuthor, err)
+	}
+	all, err := posts.All("go")
+	if err != nil || len(all) != 1 || all[0].ID != visible.ID {
+		t.Errorf("all: got %v, %v, want %s only", all, err, visible.ID)
+	}
+	it, err := posts.Iterate("", "", "go", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, ok := it.Next()
+	if !ok || post.ID != visible.ID {
+		t.Errorf("iterate: got %v, want %s", post, visible.ID)
+	}
+	if _, ok := it.Next(); ok {
+		t.Error("iterate: got the post of a suspended user")
+	}
+
+	// expired suspensions stop applying before they're purged
+	_, err = db.SuspendUser(database.Suspension{UserID: ann.ID, Reason: "spam", ExpiresAt: time.Now().Add(-time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = posts.Get(hidden.ID)
+	if err != nil {
+		t.Errorf("get after the suspension expired: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+const maxTagsPerPost = 10
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// NormalizeTags lowercases and deduplicates tags, keeping their order.
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q, tags are up to 32 letters, digits, - or _", tag)
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTagsPerPost {
+		return nil, fmt.Errorf("a post can have at most %d tags", maxTagsPerPost)
+	}
+	if len(normalized) == 0 {
+		return nil, nil
+	}
+	return normalized, nil
+}
+
+func filterPostsByTag(posts []database.Post, tag string) []database.Post {
+	filtered := []database.Post{}
+	for _, post := range posts {
+		for _, t := range post.Tags {
+			if t == tag {
+				filtered = append(filtered, post)
+				break
+			}
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	var tests = []struct {
+		tags      []string
+		expected  []string
+		expectErr bool
+	}{
+		{tags: nil, expected: nil},
+		{tags: []string{"Golang", " #go ", "golang"}, expected: []string{"golang", "go"}},
+		{tags: []string{"web-dev", "c_plus_plus"}, expected: []string{"web-dev", "c_plus_plus"}},
+		{tags: []string{""}, expectErr: true},
+		{tags: []string{"two words"}, expectErr: true},
+		{tags: []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}, expectErr: true},
+	}
+	for _, test := range tests {
+		got, err := NormalizeTags(test.tags)
+		if (err != nil) != test.expectErr {
+			t.Errorf("%v: got error %v, want error %v", test.tags, err, test.expectErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%v: got %v, want %v", test.tags, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 30
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ValidateUsername checks a username: 3 to 30 lowercase letters, digits
+// and underscores, starting with a letter.
+func ValidateUsername(username string) error {
+	if len(username) < minUsernameLength || len(username) > maxUsernameLength {
+		return fmt.Errorf("username must be %d to %d characters", minUsernameLength, maxUsernameLength)
+	}
+	if !usernamePattern.MatchString(username) {
+		return errors.New("username can only have letters, digits and underscores, and must start with a letter")
+	}
+	return nil
+}
+
+// SetUsername changes the username of a user. Usernames are
+// case-insensitive and stored lowercase.
+func (s UserService) SetUsername(id, username string) (database.User, error) {
+	username, err := s.checkUsername(id, username)
+	if err != nil {
+		return database.User{}, err
+	}
+	user, err := s.db.SetUsername(id, username)
+	if errors.Is(err, database.ErrAlreadyExists) {
+		return database.User{}, ErrUsernameTaken
+	}
+	return user, userError(err)
+}
+
+// checkUsername returns username lowercased if it's valid and no user but
+// the one with the given ID has it. New users have no ID yet.
+func (s UserService) checkUsername(id, username string) (string, error) {
+	username = strings.ToLower(username)
+	err := ValidateUsername(username)
+	if err != nil {
+		return "", ValidationError{Err: err}
+	}
+	other, err := s.db.GetUserByUsername(username)
+	if err == nil && other.ID != id {
+		return "", ErrUsernameTaken
+	}
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return "", err
+	}
+	return username, nil
+}
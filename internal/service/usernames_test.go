@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestValidateUsername(t *testing.T) {
+	var tests = []struct {
+		username string
+		valid    bool
+	}{
+		{"ann", true},
+		{"ann_b2", true},
+		{"an", false},
+		{"a23456789012345678901234567890", true},
+		{"a234567890123456789012345678901", false},
+		{"2ann", false},
+		{"_ann", false},
+		{"ann.b", false},
+		{"Ann", false},
+		{"ann@example", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateUsername(tt.username); (err == nil) != tt.valid {
+			t.Errorf("%q: got %v, want valid %v", tt.username, err, tt.valid)
+		}
+	}
+}
+
+func TestUsernames(t *testing.T) {
+	users := NewUserService(database.NewMemoryClient(), nil)
+	ann, err := users.Create("ann@example.com", "12345", "Ann", "Ann_B", 18, database.Profile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ann.Username != "ann_b" {
+		t.Errorf("got username %q, want it lowercased", ann.Username)
+	}
+	_, err = users.Create("ann2@example.com", "12345", "Ann", "ANN_B", 18, database.Profile{})
+	if !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("got %v, want %v", err, ErrUsernameTaken)
+	}
+	if _, err := users.Get("ann2@example.com"); err == nil {
+		t.Error("user was created with a taken username")
+	}
+	_, err = users.Create("bob@example.com", "12345", "Bob", "b", 18, database.Profile{})
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("got %v, want a validation error", err)
+	}
+	bob, err := users.Create("bob@example.com", "12345", "Bob", "", 18, database.Profile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := users.Get("@ANN_B")
+	if err != nil || got.ID != ann.ID {
+		t.Errorf("got %v %v, want ann", got.ID, err)
+	}
+	_, err = users.Get("@nobody")
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("got %v, want %v", err, ErrUserNotFound)
+	}
+
+	// users pick or change their username later
+	username := "bob"
+	bob, err = users.Patch(bob.ID, bob.ID, UserPatch{Username: &username})
+	if err != nil || bob.Username != "bob" {
+		t.Errorf("got %q %v, want bob", bob.Username, err)
+	}
+	username = "ann_b"
+	_, err = users.Patch(bob.ID, bob.ID, UserPatch{Username: &username})
+	if !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("got %v, want %v", err, ErrUsernameTaken)
+	}
+	ann, err = users.Update(ann.ID, ann.ID, "", "12345", "Ann", "ann", 18, database.Profile{})
+	if err != nil || ann.Username != "ann" {
+		t.Errorf("got %q %v, want ann", ann.Username, err)
+	}
+	// the old username is free again
+	_, err = users.SetUsername(bob.ID, "ann_b")
+	if err != nil {
+		t.Errorf("got %v, want the old username free", err)
+	}
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/passhash"
+	"github.com/google/uuid"
+)
+
+type UserService struct {
+	db database.Client
+	// exists may be nil, checks then always read the database.
+	exists ExistenceFilter
+	// passwords is enforced on new passwords, breaches may be nil.
+	passwords database.PasswordPolicy
+	breaches  BreachChecker
+	hasher    passhash.Hasher
+}
+
+func NewUserService(db database.Client, exists ExistenceFilter) UserService {
+	return UserService{db: db, exists: exists}
+}
+
+// ValidateUser checks the fields every user needs.
+func ValidateUser(email, password string, age int) error {
+	if email == "" {
+		return errors.New("email can't be empty")
+	}
+	if password == "" {
+		return errors.New("password can't be empty")
+	}
+	if age < 18 {
+		return errors.New("age must be at least 18 years old")
+	}
+	return nil
+}
+
+// Create signs up a user. The username may be empty, users can pick one
+// later.
+func (s UserService) Create(email, password, name, username string, age int, profile database.Profile) (database.User, error) {
+	err := ValidateUser(email, password, age)
+	if err == nil {
+		err = ValidateProfile(profile)
+	}
+	if err != nil {
+		return database.User{}, ValidationError{Err: err}
+	}
+	err = s.CheckPassword(password)
+	if err != nil {
+		return database.User{}, err
+	}
+	if username != "" {
+		username, err = s.checkUsername("", username)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+	hash, tag, err := s.hash(password)
+	if err != nil {
+		return database.User{}, err
+	}
+	user, err := s.db.InsertUser(database.User{
+		Email:             email,
+		Password:          hash,
+		PasswordAlgorithm: tag,
+		Name:              name,
+		Age:               age,
+		Username:          username,
+		Profile:           profile,
+	})
+	if errors.Is(err, database.ErrUsernameTaken) {
+		return database.User{}, ErrUsernameTaken
+	}
+	if errors.Is(err, database.ErrAlreadyExists) {
+		return database.User{}, ErrUserAlreadyExists
+	}
+	return user, err
+}
+
+// Get finds a user by reference: "@{username}", "by-email/{email}", a user
+// ID, or an email for clients from before users had IDs.
+func (s UserService) Get(ref string) (database.User, error) {
+	var user database.User
+	var err error
+	if username, ok := strings.CutPrefix(ref, "@"); ok {
+		user, err = s.db.GetUserByUsername(strings.ToLower(username))
+	} else if email, ok := strings.CutPrefix(ref, "by-email/"); ok {
+		user, err = s.userByEmail(email)
+	} else if _, parseErr := uuid.Parse(ref); parseErr == nil {
+		user, err = s.db.GetUser(ref)
+	} else {
+		user, err = s.userByEmail(ref)
+	}
+	return user, userError(err)
+}
+
+// Author finds the user named in a posts request, preferring the ID.
+func (s UserService) Author(userID, email string) (database.User, error) {
+	var user database.User
+	var err error
+	if userID != "" {
+		user, err = s.db.GetUser(userID)
+	} else {
+		user, err = s.userByEmail(email)
+	}
+	return user, userError(err)
+}
+
+// All returns every user ordered by email.
+func (s UserService) All() ([]database.User, error) {
+	users, err := s.db.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+	return users, nil
+}
+
+// Update replaces the fields of the user with the given ID, an empty email
+// or username keeps the current one. Everything is checked before the user
+// is stored in one write.
+func (s UserService) Update(ref, userID, email, password, name, username string, age int, profile database.Profile) (database.User, error) {
+	user, err := s.Own(ref, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	if email == "" {
+		email = user.Email
+	}
+	err = ValidateUser(email, password, age)
+	if err == nil {
+		err = ValidateProfile(profile)
+	}
+	if err != nil {
+		return database.User{}, ValidationError{Err: err}
+	}
+	if username != "" {
+		user.Username, err = s.checkUsername(user.ID, username)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+	user, err = s.withPassword(user, password)
+	if err != nil {
+		return database.User{}, err
+	}
+	user.Email = email
+	user.Name = name
+	user.Age = age
+	user.Profile = profile
+	return s.replace(user)
+}
+
+// Delete removes the user with the given ID.
+func (s UserService) Delete(ref, userID string) error {
+	user, err := s.Own(ref, userID)
+	if err != nil {
+		return err
+	}
+	return s.db.DeleteUser(user.ID)
+}
+
+// Own returns the user found by reference if it's the user with the given
+// ID, the one changing it.
+func (s UserService) Own(ref, userID string) (database.User, error) {
+	user, err := s.Get(ref)
+	if err != nil {
+		return database.User{}, err
+	}
+	if user.ID != userID {
+		return database.User{}, ErrNotAccountOwner
+	}
+	return user, nil
+}
+
+// userByEmail reads the user with the email, unless the existence filter
+// knows no user has it.
+func (s UserService) userByEmail(email string) (database.User, error) {
+	if s.exists != nil && !s.exists.MayHaveUser(email) {
+		return database.User{}, database.ErrNotFound
+	}
+	return s.db.GetUserByEmail(email)
+}
+
+// replace stores the changed user, whose email and username may conflict
+// with another user's since they were checked.
+func (s UserService) replace(user database.User) (database.User, error) {
+	user, err := s.db.ReplaceUser(user)
+	if errors.Is(err, database.ErrUsernameTaken) {
+		return database.User{}, ErrUsernameTaken
+	}
+	if errors.Is(err, database.ErrAlreadyExists) {
+		return database.User{}, ErrUserAlreadyExists
+	}
+	return user, userError(err)
+}
+
+func userError(err error) error {
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
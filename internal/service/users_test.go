@@ -0,0 +1,274 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestValidateUser(t *testing.T) {
+	var tests = []struct {
+		email       string
+		password    string
+		age         int
+		expectedErr error
+	}{
+		{
+			email:       "test@example.com",
+			password:    "12345",
+			age:         18,
+			expectedErr: nil,
+		},
+		{
+			email:       "",
+			password:    "12345",
+			age:         18,
+			expectedErr: errors.New("email can't be empty"),
+		},
+		{
+			email:       "test@example.com",
+			password:    "",
+			age:         18,
+			expectedErr: errors.New("password can't be empty"),
+		},
+		{
+			email:       "test@example.com",
+			password:    "12345",
+			age:         16,
+			expectedErr: errors.New("age must be at least 18 years old"),
+		},
+	}
+	for _, tt := range tests {
+		err := ValidateUser(tt.email, tt.password, tt.age)
+		errString := ""
+		expectedErrString := ""
+		if err != nil {
+			errString = err.Error()
+		}
+		if tt.expectedErr != nil {
+			expectedErrString = tt.expectedErr.Error()
+		}
+		if errString != expectedErrString {
+			t.Errorf("got %s, want %s", errString, expectedErrString)
+		}
+	}
+}
+
+func TestUserService(t *testing.T) {
+	db := database.NewMemoryClient()
+	err := db.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewUserService(db, nil)
+	created, err := users.Create("test@example.com", "12345", "Test", "", 18, database.Profile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = users.Create("test@example.com", "12345", "Test", "", 18, database.Profile{})
+	if !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("creating a duplicate: got %v, want %v", err, ErrUserAlreadyExists)
+	}
+	_, err = users.Create("young@example.com", "12345", "Young", "", 16, database.Profile{})
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("creating an ineligible user: got %v, want a validation error", err)
+	}
+
+	for _, ref := range []string{created.ID, "by-email/test@example.com", "test@example.com"} {
+		user, err := users.Get(ref)
+		if err != nil || user.ID != created.ID {
+			t.Errorf("Get(%q): got %v, %v", ref, user.ID, err)
+		}
+	}
+
+	// an empty email keeps the current one
+	updated, err := users.Update(created.ID, created.ID, "", "12345", "Renamed", "", 19, database.Profile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Email != "test@example.com" || updated.Name != "Renamed" {
+		t.Errorf("got %+v", updated)
+	}
+
+	_, err = users.Update(created.ID, created.ID, "", "12345", "Renamed", "", 16, database.Profile{})
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("updating to an ineligible age: got %v, want a validation error", err)
+	}
+	_, err = users.Update(created.ID, created.ID, "", "", "Renamed", "", 19, database.Profile{})
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("updating without a password: got %v, want a validation error", err)
+	}
+
+	_, err = users.Update(created.ID, "someone-else", "", "12345", "Renamed", "", 19, database.Profile{})
+	if !errors.Is(err, ErrNotAccountOwner) {
+		t.Errorf("updating someone else: got %v, want %v", err, ErrNotAccountOwner)
+	}
+	err = users.Delete("test@example.com", "someone-else")
+	if !errors.Is(err, ErrNotAccountOwner) {
+		t.Errorf("deleting someone else: got %v, want %v", err, ErrNotAccountOwner)
+	}
+	err = users.Delete("test@example.com", created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = users.Get(created.ID)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("getting a deleted user: got %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+func TestUserServiceCreateConcurrently(t *testing.T) {
+	db := database.NewMemoryClient()
+	users := NewUserService(db, nil)
+	profile := database.Profile{Bio: "hi"}
+	var tests = []struct {
+		name        string
+		email       func(i int) string
+		username    func(i int) string
+		expectedErr error
+	}{
+		{
+			name:        "same email",
+			email:       func(int) string { return "same@example.com" },
+			username:    func(i int) string { return fmt.Sprintf("user%d", i) },
+			expectedErr: ErrUserAlreadyExists,
+		},
+		{
+			name:        "same username",
+			email:       func(i int) string { return fmt.Sprintf("user%d@example.com", i) },
+			username:    func(int) string { return "taken" },
+			expectedErr: ErrUsernameTaken,
+		},
+	}
+	for _, tt := range tests {
+		var wg sync.WaitGroup
+		errs := make([]error, 10)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = users.Create(tt.email(i), "12345", "Test", tt.username(i), 18, profile)
+			}(i)
+		}
+		wg.Wait()
+		created := 0
+		for _, err := range errs {
+			if err == nil {
+				created++
+			} else if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("%s: got %v, want %v", tt.name, err, tt.expectedErr)
+			}
+		}
+		if created != 1 {
+			t.Errorf("%s: created %d users, want 1", tt.name, created)
+		}
+	}
+	all, err := db.GetAllUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range all {
+		if user.PasswordAlgorithm == "" || user.Username == "" || user.Profile != profile {
+			t.Errorf("got a partly created user %+v", user)
+		}
+	}
+}
+
+func TestUserServiceUpdateConcurrently(t *testing.T) {
+	db := database.NewMemoryClient()
+	users := NewUserService(db, nil)
+	created := make([]database.User, 10)
+	for i := range created {
+		var err error
+		created[i], err = users.Create(fmt.Sprintf("user%d@example.com", i), "12345", "Test", "", 18, database.Profile{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every user renames themselves and takes the same username, only one
+	// gets it and the others keep all their fields
+	var wg sync.WaitGroup
+	errs := make([]error, len(created))
+	for i, user := range created {
+		wg.Add(1)
+		go func(i int, user database.User) {
+			defer wg.Done()
+			_, errs[i] = users.Update(user.ID, user.ID, "new"+user.Email, "12345", "Renamed", "taken", 19, database.Profile{Bio: "hi"})
+		}(i, user)
+	}
+	wg.Wait()
+	updated := 0
+	for i, err := range errs {
+		user, getErr := users.Get(created[i].ID)
+		if getErr != nil {
+			t.Fatal(getErr)
+		}
+		if err == nil {
+			updated++
+			continue
+		}
+		if !errors.Is(err, ErrUsernameTaken) {
+			t.Errorf("user %d: got %v, want %v", i, err, ErrUsernameTaken)
+		}
+		if user.Email != created[i].Email || user.Name != "Test" || user.Age != 18 || user.Bio != "" {
+			t.Errorf("user %d: got a partly updated user %+v", i, user)
+		}
+	}
+	if updated != 1 {
+		t.Errorf("updated %d users, want 1", updated)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	var tests = []struct {
+		profile   database.Profile
+		expectErr bool
+	}{
+		{profile: database.Profile{}},
+		{profile: database.Profile{Bio: "Gopher", Location: "Paris", Website: "https://example.com", AvatarURL: "http://example.com/a.png"}},
+		{profile: database.Profile{AvatarURL: "/media/0b4a1d6e-8c1f-4f5e-9a57-5f1a8d0f6b2c"}},
+		{profile: database.Profile{Bio: strings.Repeat("a", 281)}, expectErr: true},
+		{profile: database.Profile{Location: strings.Repeat("a", 101)}, expectErr: true},
+		{profile: database.Profile{Website: "example.com"}, expectErr: true},
+		{profile: database.Profile{Website: "javascript:alert(1)"}, expectErr: true},
+		{profile: database.Profile{AvatarURL: "ftp://example.com/a.png"}, expectErr: true},
+	}
+	for _, tt := range tests {
+		err := ValidateProfile(tt.profile)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("%+v: got error %v, want error %v", tt.profile, err, tt.expectErr)
+		}
+	}
+}
+
+func TestUserServicePatch(t *testing.T) {
+	db := database.NewMemoryClient()
+	users := NewUserService(db, nil)
+	created, err := users.Create("test@example.com", "12345", "Test", "", 18, database.Profile{Bio: "Gopher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	location, age := "Paris", 16
+	patched, err := users.Patch(created.ID, created.ID, UserPatch{Location: &location})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Bio != "Gopher" || patched.Location != "Paris" || patched.Name != "Test" || patched.Age != 18 {
+		t.Errorf("got %+v, want only the location changed", patched)
+	}
+	_, err = users.Patch(created.ID, created.ID, UserPatch{Age: &age})
+	if !errors.As(err, &ValidationError{}) {
+		t.Errorf("patching an ineligible age: got %v, want a validation error", err)
+	}
+	_, err = users.Patch("nobody@example.com", created.ID, UserPatch{Location: &location})
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("patching a missing user: got %v, want %v", err, ErrUserNotFound)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// ForViewer returns a copy of s listing posts as the user with the given ID
+// sees them: without those of the users they blocked, and with those of the
+// private users who approved them as a follower. An empty ID lists them as
+// anonymous visitors see them.
+func (s PostService) ForViewer(userID string) PostService {
+	s.viewerID = userID
+	return s
+}
+
+// hiddenAuthors returns the users whose posts the viewer doesn't see at
+// now: suspended ones, the ones the viewer blocked, and private ones who
+// didn't approve the viewer as a follower.
+func (s PostService) hiddenAuthors(now time.Time) (map[string]bool, error) {
+	hidden, err := suspendedUserIDs(s.db, now)
+	if err != nil {
+		return nil, err
+	}
+	approved, err := s.approvedFollowees()
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.db.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Private && user.ID != s.viewerID && !approved[user.ID] {
+			hidden[user.ID] = true
+		}
+	}
+	if s.viewerID == "" {
+		return hidden, nil
+	}
+	blocks, err := s.db.GetBlocks(s.viewerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		hidden[block.BlockedID] = true
+	}
+	return hidden, nil
+}
+
+// visible reports whether the viewer sees the posts of the given author.
+func (s PostService) visible(authorID string) (bool, error) {
+	suspended, err := s.users.Suspended(authorID)
+	if err != nil || suspended {
+		return false, err
+	}
+	if authorID == s.viewerID {
+		return true, nil
+	}
+	author, err := s.db.GetUser(authorID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return false, err
+	}
+	if author.Private {
+		approved, err := s.approvedFollowees()
+		if err != nil || !approved[authorID] {
+			return false, err
+		}
+	}
+	if s.viewerID == "" {
+		return true, nil
+	}
+	blocks, err := s.db.GetBlocks(s.viewerID)
+	if err != nil {
+		return false, err
+	}
+	for _, block := range blocks {
+		if block.BlockedID == authorID {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// approvedFollowees returns the users who approved the viewer as a
+// follower.
+func (s PostService) approvedFollowees() (map[string]bool, error) {
+	approved := map[string]bool{}
+	if s.viewerID == "" {
+		return approved, nil
+	}
+	following, err := s.db.GetFollowing(s.viewerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, follow := range following {
+		if follow.Status == database.FollowApproved {
+			approved[follow.FolloweeID] = true
+		}
+	}
+	return approved, nil
+}
@@ -0,0 +1,132 @@
+// Package stats aggregates the database into the counts and time series of
+// the operations dashboard.
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// Options picks the window of the time series and how many top posters
+// are listed.
+type Options struct {
+	// Days is the number of days in the time series, today included.
+	Days int
+	Top  int
+}
+
+// Totals counts the records of the database.
+type Totals struct {
+	Users             int `json:"users"`
+	Posts             int `json:"posts"`
+	PendingPosts      int `json:"pendingPosts"`
+	ActiveSuspensions int `json:"activeSuspensions"`
+}
+
+// Day is the count of one UTC day of a time series.
+type Day struct {
+	// Date is formatted as 2006-01-02.
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+type Poster struct {
+	UserID string `json:"userId"`
+	Name   string `json:"name"`
+	Posts  int    `json:"posts"`
+}
+
+type Stats struct {
+	ComputedAt time.Time `json:"computedAt"`
+	Totals     Totals    `json:"totals"`
+	// UsersPerDay and PostsPerDay have an entry for every day of the
+	// window, oldest first.
+	UsersPerDay []Day `json:"usersPerDay"`
+	PostsPerDay []Day `json:"postsPerDay"`
+	// TopPosters ranks the users who posted the most within the window.
+	TopPosters []Poster `json:"topPosters"`
+}
+
+// Compute aggregates the database of c as of now.
+func Compute(c database.Client, now time.Time, opts Options) (Stats, error) {
+	users, err := c.GetAllUsers()
+	if err != nil {
+		return Stats{}, err
+	}
+	posts, err := c.GetAllPosts()
+	if err != nil {
+		return Stats{}, err
+	}
+	pending, err := c.GetPendingPosts()
+	if err != nil {
+		return Stats{}, err
+	}
+	suspensions, err := c.GetSuspensions()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	now = now.UTC()
+	stats := Stats{
+		ComputedAt: now,
+		Totals: Totals{
+			Users:        len(users),
+			Posts:        len(posts),
+			PendingPosts: len(pending),
+		},
+		TopPosters: []Poster{},
+	}
+	for _, suspension := range suspensions {
+		if suspension.Active(now) {
+			stats.Totals.ActiveSuspensions++
+		}
+	}
+
+	// the window starts at midnight, Days-1 days ago
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := today.AddDate(0, 0, 1-opts.Days)
+	dayOf := func(t time.Time) (int, bool) {
+		t = t.UTC()
+		if t.Before(start) || t.After(now) {
+			return 0, false
+		}
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return int(day.Sub(start) / (24 * time.Hour)), true
+	}
+	usersPerDay, postsPerDay := make([]int, opts.Days), make([]int, opts.Days)
+	for _, user := range users {
+		if i, ok := dayOf(user.CreatedAt); ok {
+			usersPerDay[i]++
+		}
+	}
+	counts := map[string]int{}
+	for _, post := range posts {
+		if i, ok := dayOf(post.CreatedAt); ok {
+			postsPerDay[i]++
+			counts[post.UserID]++
+		}
+	}
+	for i := 0; i < opts.Days; i++ {
+		date := start.AddDate(0, 0, i).Format("2006-01-02")
+		stats.UsersPerDay = append(stats.UsersPerDay, Day{Date: date, Count: usersPerDay[i]})
+		stats.PostsPerDay = append(stats.PostsPerDay, Day{Date: date, Count: postsPerDay[i]})
+	}
+
+	for _, user := range users {
+		if counts[user.ID] > 0 {
+			stats.TopPosters = append(stats.TopPosters, Poster{UserID: user.ID, Name: user.Name, Posts: counts[user.ID]})
+		}
+	}
+	sort.Slice(stats.TopPosters, func(i, j int) bool {
+		if stats.TopPosters[i].Posts != stats.TopPosters[j].Posts {
+			return stats.TopPosters[i].Posts > stats.TopPosters[j].Posts
+		}
+		return stats.TopPosters[i].UserID < stats.TopPosters[j].UserID
+	})
+	if len(stats.TopPosters) > opts.Top {
+		stats.TopPosters = stats.TopPosters[:opts.Top]
+	}
+	return stats, nil
+}
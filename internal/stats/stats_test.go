@@ -0,0 +1,69 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestCompute(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	c := database.NewMemoryClient()
+	ann := &database.User{ID: "ann", Email: "ann@example.com", Name: "Ann", CreatedAt: now.Add(-10 * day)}
+	bob := &database.User{ID: "bob", Email: "bob@example.com", Name: "Bob", CreatedAt: now.Add(-2 * day)}
+	cat := &database.User{ID: "cat", Email: "cat@example.com", Name: "Cat", CreatedAt: now.Add(-time.Hour)}
+	records := []database.ImportRecord{{User: ann}, {User: bob}, {User: cat}}
+	for i, createdAt := range []time.Time{
+		now.Add(-9 * day), // before the window
+		now.Add(-2 * day),
+		now.Add(-time.Hour),
+	} {
+		records = append(records, database.ImportRecord{Post: &database.Post{UserID: "ann", CreatedAt: createdAt, Text: "post"}})
+		if i > 0 {
+			records = append(records, database.ImportRecord{Post: &database.Post{UserID: "bob", CreatedAt: createdAt, Text: "post"}})
+		}
+	}
+	records = append(records, database.ImportRecord{Post: &database.Post{UserID: "cat", CreatedAt: now.Add(-time.Minute), Text: "post"}})
+	errs, err := c.Import(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = c.SuspendUser(database.Suspension{UserID: "cat", Reason: "spam", ExpiresAt: now.Add(day)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := Compute(c, now, Options{Days: 3, Top: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Stats{
+		ComputedAt: now,
+		Totals:     Totals{Users: 3, Posts: 6, ActiveSuspensions: 1},
+		UsersPerDay: []Day{
+			{Date: "2024-03-08", Count: 1},
+			{Date: "2024-03-09", Count: 0},
+			{Date: "2024-03-10", Count: 1},
+		},
+		PostsPerDay: []Day{
+			{Date: "2024-03-08", Count: 2},
+			{Date: "2024-03-09", Count: 0},
+			{Date: "2024-03-10", Count: 3},
+		},
+		TopPosters: []Poster{
+			{UserID: "ann", Name: "Ann", Posts: 2},
+			{UserID: "bob", Name: "Bob", Posts: 2},
+		},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("got %+v, want %+v", stats, expected)
+	}
+}
@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+)
+
+// Presigner is implemented by backends that let clients upload and download
+// files directly, without the data passing through the API server.
+type Presigner interface {
+	// PresignPut returns a URL accepting a PUT of the file with the given
+	// content type until the URL expires.
+	PresignPut(key, contentType string, expires time.Duration) (string, error)
+	// PresignGet returns a URL serving the file until it expires.
+	PresignGet(key string, expires time.Duration) (string, error)
+	// Stat returns the size and content type of a stored file, or
+	// ErrNotFound.
+	Stat(key string) (Info, error)
+}
+
+type Info struct {
+	Size        int64
+	ContentType string
+}
+
+type S3Config struct {
+	// Endpoint is the base URL of the S3 API, e.g. https://s3.us-east-1.amazonaws.com
+	// or the URL of a compatible service such as MinIO.
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses the bucket as a path (endpoint/bucket/key) rather
+	// than a subdomain (bucket.endpoint/key). Most S3 compatible services
+	// need it.
+	PathStyle bool
+}
+
+// S3 stores files in an S3 compatible bucket. Requests are signed with AWS
+// Signature Version 4.
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("S3 storage needs a bucket and credentials")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &S3{
+		cfg:      cfg,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.cfg.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+	return &u
+}
+
+// Put buffers the file in memory, S3 needs the length of an upload up front.
+// Large files should be uploaded with PresignPut instead.
+func (s *S3) Put(key string, r io.Reader) (int64, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key).String(), bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", http.DetectContentType(data))
+	_, err = s.do(req)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3) Stat(key string) (Info, error) {
+	if err := checkKey(key); err != nil {
+		return Info{}, err
+	}
+	req, err := http.NewRequest(http.MethodHead, s.objectURL(key).String(), nil)
+	if err != nil {
+		return Info{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return Info{}, err
+	}
+	resp.Body.Close()
+	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return Info{}, fmt.Errorf("S3 returned an invalid Content-Length: %w", err)
+	}
+	return Info{Size: size, ContentType: resp.Header.Get("Content-Type")}, nil
+}
+
+func (s *S3) PresignPut(key, contentType string, expires time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	// signing the content type stops clients uploading something else
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	return s.presign(http.MethodPut, s.objectURL(key), headers, expires), nil
+}
+
+func (s *S3) PresignGet(key string, expires time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return s.presign(http.MethodGet, s.objectURL(key), http.Header{}, expires), nil
+}
+
+// do signs and sends req, turning error responses into errors. The caller
+// closes the body of successful responses.
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	s.sign(req, unsignedPayload, s.now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, body)
+	}
+	return resp, nil
+}
+
+// sign adds an Authorization header covering the host and every header
+// already set on req.
+func (s *S3) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format(amzDateFormat))
+	headers := req.Header.Clone()
+	headers.Set("Host", req.URL.Host)
+	signedHeaders, canonicalHeaders := canonicalizeHeaders(headers)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := s.scope(t)
+	signature := s.signature(t, scope, canonicalRequest)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func (s *S3) presign(method string, u *url.URL, headers http.Header, expires time.Duration) string {
+	t := s.now().UTC()
+	headers.Set("Host", u.Host)
+	signedHeaders, canonicalHeaders := canonicalizeHeaders(headers)
+	scope := s.scope(t)
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.cfg.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", t.Format(amzDateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI(u),
+		canonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", s.signature(t, scope, canonicalRequest))
+	signed := *u
+	signed.RawQuery = canonicalQuery(query)
+	return signed.String()
+}
+
+func (s *S3) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+func (s *S3) signature(t time.Time, scope, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format(amzDateFormat),
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func canonicalizeHeaders(headers http.Header) (signed, canonical string) {
+	names := []string{}
+	for name := range headers {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	lines := []string{}
+	for _, name := range names {
+		values := headers.Values(name)
+		for i := range values {
+			values[i] = strings.Join(strings.Fields(values[i]), " ")
+		}
+		lines = append(lines, name+":"+strings.Join(values, ","))
+	}
+	return strings.Join(names, ";"), strings.Join(lines, "\n") + "\n"
+}
+
+func canonicalURI(u *url.URL) string {
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	path := strings.Join(segments, "/")
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters of
+// RFC 3986, as Signature Version 4 requires.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
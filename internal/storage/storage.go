@@ -0,0 +1,93 @@
+// Package storage keeps uploaded files. Backends are addressed by opaque
+// keys chosen by the caller, so a local directory can later be swapped for
+// an object store such as S3 without touching the handlers.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// Backend stores files by key.
+type Backend interface {
+	// Put writes the contents of r under key and returns the number of bytes
+	// written. An existing file with the same key is replaced.
+	Put(key string, r io.Reader) (int64, error)
+	// Get opens the file stored under key, or returns ErrNotFound.
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the file stored under key. Missing files aren't an error.
+	Delete(key string) error
+}
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func checkKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	return nil
+}
+
+// LocalDisk stores files in a directory on the local filesystem.
+type LocalDisk struct {
+	dir string
+}
+
+func NewLocalDisk(dir string) (*LocalDisk, error) {
+	err := os.MkdirAll(dir, 0750)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalDisk{dir: dir}, nil
+}
+
+// Put writes to a temporary file first, so readers never see a partially
+// written file.
+func (d *LocalDisk) Put(key string, r io.Reader) (int64, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(d.dir, ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), filepath.Join(d.dir, key))
+}
+
+func (d *LocalDisk) Get(key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(d.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (d *LocalDisk) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(d.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalDisk(t *testing.T) {
+	d, err := NewLocalDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := d.Put("a.png", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("got %d bytes, want 5", n)
+	}
+	file, err := d.Get("a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || string(data) != "hello" {
+		t.Errorf("got %q, %v, want hello", data, err)
+	}
+
+	err = d.Delete("a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Get("a.png")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+	err = d.Delete("a.png")
+	if err != nil {
+		t.Errorf("deleting a missing file: %v", err)
+	}
+}
+
+func TestLocalDiskRejectsUnsafeKeys(t *testing.T) {
+	d, err := NewLocalDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "../escape", "a/b", ".hidden"} {
+		_, err := d.Put(key, strings.NewReader("x"))
+		if err == nil {
+			t.Errorf("%q: expected an invalid key error", key)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package totp implements time-based one-time passwords (RFC 6238) as used
+// by authenticator apps: HMAC-SHA1, 6 digits, 30 second steps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	digits = 6
+	step   = 30 * time.Second
+	// skew is how many steps either side of now are accepted, to allow for
+	// clock drift and slow typing.
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a random base32 encoded secret.
+func NewSecret() (string, error) {
+	key := make([]byte, 20)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(key), nil
+}
+
+// URI returns the otpauth:// URI authenticator apps import, usually from a
+// QR code.
+func URI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(digits))
+	query.Set("period", fmt.Sprint(int(step.Seconds())))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Code returns the code for secret at time t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return code(key, uint64(t.Unix())/uint64(step.Seconds())), nil
+}
+
+// Validate reports whether code is valid for secret around time t.
+func Validate(secret, code string, t time.Time) bool {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != digits {
+		return false
+	}
+	counter := uint64(t.Unix()) / uint64(step.Seconds())
+	valid := false
+	for i := -skew; i <= skew; i++ {
+		expected := codeAt(key, counter, i)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+func codeAt(key []byte, counter uint64, offset int) string {
+	if offset < 0 {
+		return code(key, counter-uint64(-offset))
+	}
+	return code(key, counter+uint64(offset))
+}
+
+// code is the HOTP value (RFC 4226) of key at counter.
+func code(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digits, value%1000000)
+}
@@ -0,0 +1,67 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The secret and expected codes are the SHA1 test vectors of RFC 6238,
+// truncated to 6 digits.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	var tests = []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.expected {
+			t.Errorf("%d: got %s, want %s", tt.unix, got, tt.expected)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	var tests = []struct {
+		name     string
+		code     string
+		expected bool
+	}{
+		{name: "current", code: "050471", expected: true},
+		{name: "previous step", code: "081804", expected: true},
+		{name: "wrong", code: "123456", expected: false},
+		{name: "too short", code: "50471", expected: false},
+	}
+	for _, tt := range tests {
+		if got := Validate(rfcSecret, tt.code, now); got != tt.expected {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+	old, err := Code(rfcSecret, now.Add(-2*step))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Validate(rfcSecret, old, now) {
+		t.Errorf("accepted a code two steps old")
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Example", "test@example.com", "ABC")
+	if !strings.HasPrefix(got, "otpauth://totp/Example:test@example.com?") || !strings.Contains(got, "secret=ABC") {
+		t.Errorf("got %s", got)
+	}
+}
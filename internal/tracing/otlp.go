@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// OTLP exports spans to a collector with the OTLP/HTTP protocol, encoded
+// as JSON.
+type OTLP struct {
+	// URL is the traces endpoint, like http://localhost:4318/v1/traces.
+	URL string
+	// Headers are sent with every export, e.g. for authentication.
+	Headers     map[string]string
+	ServiceName string
+	Client      *http.Client
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano uint64          `json:"startTimeUnixNano,string"`
+	EndTimeUnixNano   uint64          `json:"endTimeUnixNano,string"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+// otlpValue has one of its fields set. Integers are strings in OTLP/JSON.
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+// otlpStatus codes are 0 when unset and 2 for errors.
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func attributes(values map[string]interface{}) []otlpAttribute {
+	attrs := []otlpAttribute{}
+	for key, value := range values {
+		attr := otlpAttribute{Key: key}
+		switch v := value.(type) {
+		case string:
+			attr.Value.StringValue = &v
+		case int:
+			s := fmt.Sprint(v)
+			attr.Value.IntValue = &s
+		case int64:
+			s := fmt.Sprint(v)
+			attr.Value.IntValue = &s
+		case bool:
+			attr.Value.BoolValue = &v
+		default:
+			s := fmt.Sprint(v)
+			attr.Value.StringValue = &s
+		}
+		attrs = append(attrs, attr)
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Key < attrs[j].Key
+	})
+	return attrs
+}
+
+func (o OTLP) Export(ctx context.Context, spans []*Span) error {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: o.ServiceName}}
+	for _, span := range spans {
+		span.mu.Lock()
+		s := otlpSpan{
+			TraceID:           hex.EncodeToString(span.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.ID[:]),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: uint64(span.Start.UnixNano()),
+			EndTimeUnixNano:   uint64(span.End.UnixNano()),
+			Attributes:        attributes(span.Attributes),
+		}
+		if span.Err != nil {
+			s.Status = otlpStatus{Code: 2, Message: span.Err.Error()}
+		}
+		span.mu.Unlock()
+		if span.ParentID != (SpanID{}) {
+			s.ParentSpanID = hex.EncodeToString(span.ParentID[:])
+		}
+		scope.Spans = append(scope.Spans, s)
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attributes(map[string]interface{}{"service.name": o.ServiceName})},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range o.Headers {
+		req.Header.Set(key, value)
+	}
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector: status %d", resp.StatusCode)
+	}
+	return nil
+}
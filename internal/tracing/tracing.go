@@ -0,0 +1,308 @@
+// Package tracing records spans of work and exports them to an
+// OpenTelemetry collector over OTLP/HTTP, encoded as JSON. Spans travel in
+// contexts, and between services in W3C traceparent headers.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	mathrand "math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind tells what a span stands for, with the values of OTLP.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+// Exporter sends finished spans to a collector.
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Tracer starts root spans and hands finished ones to its exporter in
+// batches.
+type Tracer struct {
+	exporter Exporter
+	// ratio of traces started here that are sampled.
+	ratio float64
+
+	mu      sync.Mutex
+	pending []*Span
+	flush   chan struct{}
+	done    chan struct{}
+	stopped bool
+}
+
+// batchSize spans are exported as soon as they're finished, fewer wait
+// for the flush interval.
+const batchSize = 512
+
+// NewTracer exports the sampled spans every interval until it's closed.
+// ratio is the share of traces started here to sample, from 0 to 1.
+func NewTracer(exporter Exporter, ratio float64, interval time.Duration) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		ratio:    ratio,
+		flush:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go t.loop(interval)
+	return t
+}
+
+func (t *Tracer) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(t.done)
+	for {
+		select {
+		case <-ticker.C:
+		case _, ok := <-t.flush:
+			if !ok {
+				t.export()
+				return
+			}
+		}
+		t.export()
+	}
+}
+
+func (t *Tracer) export() {
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := t.exporter.Export(ctx, spans)
+	if err != nil {
+		log.Printf("tracing: exporting %d spans: %v", len(spans), err)
+	}
+}
+
+// Close exports the spans still waiting and stops the tracer.
+func (t *Tracer) Close() error {
+	t.mu.Lock()
+	if !t.stopped {
+		t.stopped = true
+		close(t.flush)
+	}
+	t.mu.Unlock()
+	<-t.done
+	return nil
+}
+
+func (t *Tracer) finished(span *Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	t.pending = append(t.pending, span)
+	if len(t.pending) >= batchSize {
+		select {
+		case t.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Span is a timed piece of work. A nil *Span does nothing, so code can be
+// traced whether tracing is on or not.
+type Span struct {
+	tracer  *Tracer
+	sampled bool
+
+	TraceID  TraceID
+	ID       SpanID
+	ParentID SpanID
+	Name     string
+	Kind     SpanKind
+	Start    time.Time
+
+	mu         sync.Mutex
+	End        time.Time
+	Attributes map[string]interface{}
+	// Err is set when the work failed.
+	Err error
+}
+
+// Start begins a root span, continuing the trace of parent when it's
+// valid, like one read from a traceparent header.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, parent SpanContext) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, ID: newSpanID(), Name: name, Kind: kind, Start: time.Now()}
+	if parent.Valid() {
+		span.TraceID, span.ParentID, span.sampled = parent.TraceID, parent.SpanID, parent.Sampled
+	} else {
+		span.TraceID = newTraceID()
+		span.sampled = mathrand.Float64() < t.ratio
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// StartChild begins a span under the one in ctx. It returns a nil span
+// when ctx has none, leaving untraced work untraced.
+func StartChild(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		tracer:   parent.tracer,
+		sampled:  parent.sampled,
+		TraceID:  parent.TraceID,
+		ID:       newSpanID(),
+		ParentID: parent.ID,
+		Name:     name,
+		Kind:     kind,
+		Start:    time.Now(),
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// SetAttribute records a string, int or bool about the work.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = map[string]interface{}{}
+	}
+	s.Attributes[key] = value
+}
+
+// SetError marks the work as failed, when err isn't nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err
+}
+
+// Finish ends the span, queueing it for export if it's sampled.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.End = time.Now()
+	s.mu.Unlock()
+	if s.sampled {
+		s.tracer.finished(s)
+	}
+}
+
+// Context returns what's propagated to other services.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: s.TraceID, SpanID: s.ID, Sampled: s.sampled}
+}
+
+type spanKey struct{}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span of ctx, nil when there's none.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SpanContext identifies a span across services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// ParseTraceparent reads a W3C traceparent header, like
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceparent(header string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", header)
+	}
+	sc := SpanContext{}
+	_, err1 := hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	_, err2 := hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	flags, err3 := hex.DecodeString(parts[3])
+	if err1 != nil || err2 != nil || err3 != nil || !sc.Valid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", header)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// Traceparent formats sc as a W3C traceparent header.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%x-%x-%s", sc.TraceID[:], sc.SpanID[:], flags)
+}
+
+func newTraceID() TraceID {
+	id := TraceID{}
+	for id == (TraceID{}) {
+		randomBytes(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	id := SpanID{}
+	for id == (SpanID{}) {
+		randomBytes(id[:])
+	}
+	return id
+}
+
+func randomBytes(b []byte) {
+	_, err := rand.Read(b)
+	if err != nil {
+		// fall back on the non-cryptographic source, IDs only need to be
+		// unique
+		for i := 0; i < len(b); i += 8 {
+			chunk := make([]byte, 8)
+			binary.LittleEndian.PutUint64(chunk, mathrand.Uint64())
+			copy(b[i:], chunk)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *recorder) Export(ctx context.Context, spans []*Span) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestTraceparent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Sampled || sc.Traceparent() != header {
+		t.Errorf("got %+v, formatted as %q", sc, sc.Traceparent())
+	}
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-zzf067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(invalid); err == nil {
+			t.Errorf("%q: got no error", invalid)
+		}
+	}
+}
+
+func TestTracer(t *testing.T) {
+	exported := &recorder{}
+	tracer := NewTracer(exported, 1, time.Hour)
+
+	// untraced work stays untraced
+	_, orphan := StartChild(context.Background(), "orphan", KindInternal)
+	orphan.SetAttribute("key", "value")
+	orphan.Finish()
+	if orphan != nil {
+		t.Error("got a span without a parent")
+	}
+
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := tracer.Start(context.Background(), "request", KindServer, parent)
+	_, child := StartChild(ctx, "query", KindClient)
+	child.SetError(errors.New("timeout"))
+	child.Finish()
+	root.Finish()
+	tracer.Close()
+
+	if len(exported.spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(exported.spans))
+	}
+	if root.TraceID != parent.TraceID || root.ParentID != parent.SpanID {
+		t.Errorf("root span didn't continue the trace: %+v", root.Context())
+	}
+	if child.TraceID != root.TraceID || child.ParentID != root.ID || child.Err == nil {
+		t.Errorf("got child span %+v", child)
+	}
+
+	// traces started here are sampled by ratio, callers' decisions stand
+	exported = &recorder{}
+	tracer = NewTracer(exported, 0, time.Hour)
+	_, span := tracer.Start(context.Background(), "dropped", KindServer, SpanContext{})
+	span.Finish()
+	_, span = tracer.Start(context.Background(), "kept", KindServer, parent)
+	span.Finish()
+	tracer.Close()
+	if len(exported.spans) != 1 || exported.spans[0].Name != "kept" {
+		t.Errorf("got %d spans exported with a 0 ratio, want the caller's sampled one", len(exported.spans))
+	}
+}
+
+func TestOTLP(t *testing.T) {
+	received := otlpRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Api-Key") != "secret" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer srv.Close()
+
+	tracer := NewTracer(OTLP{URL: srv.URL, Headers: map[string]string{"Api-Key": "secret"}, ServiceName: "api"}, 1, time.Hour)
+	ctx, root := tracer.Start(context.Background(), "HTTP GET", KindServer, SpanContext{})
+	root.SetAttribute("http.response.status_code", 200)
+	_, child := StartChild(ctx, "database.readDB", KindClient)
+	child.Finish()
+	root.Finish()
+	tracer.Close()
+
+	if len(received.ResourceSpans) != 1 || len(received.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("got %+v", received)
+	}
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].ParentSpanID != spans[1].SpanID || spans[1].ParentSpanID != "" || len(spans[0].TraceID) != 32 {
+		t.Errorf("got spans %+v", spans)
+	}
+	attr := spans[1].Attributes[0]
+	if attr.Key != "http.response.status_code" || attr.Value.IntValue == nil || *attr.Value.IntValue != "200" {
+		t.Errorf("got attribute %+v", attr)
+	}
+}
@@ -0,0 +1,79 @@
+package translate
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Cache remembers a provider's translations of each revision of a
+// document, evicting the least recently used ones past its size.
+type Cache struct {
+	provider Provider
+	size     int
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	// order holds the entries, most recently used first.
+	order *list.List
+}
+
+type cacheKey struct {
+	id       string
+	revision string
+	to       string
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	text string
+}
+
+func NewCache(provider Provider, size int) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		provider: provider,
+		size:     size,
+		entries:  map[cacheKey]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Translate returns the translation into to of text, the given revision of
+// the document id. cached is set when the provider wasn't asked.
+func (c *Cache) Translate(ctx context.Context, id, revision, text, to string) (translated string, cached bool, err error) {
+	key := cacheKey{id: id, revision: revision, to: to}
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		c.mu.Unlock()
+		return elem.Value.(*cacheEntry).text, true, nil
+	}
+	c.mu.Unlock()
+
+	translated, err = c.provider.Translate(ctx, text, to)
+	if err != nil {
+		return "", false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&cacheEntry{key: key, text: translated})
+	}
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	return translated, false, nil
+}
+
+// Len returns how many translations are cached.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,88 @@
+// Package translate translates text through a pluggable provider and
+// caches the results.
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrUnsupportedLanguage means the provider can't translate into the
+// requested language.
+var ErrUnsupportedLanguage = errors.New("unsupported language")
+
+// Provider translates text into the language to, an ISO 639-1 code like
+// "fr". The source language is detected by the provider.
+type Provider interface {
+	Translate(ctx context.Context, text, to string) (string, error)
+}
+
+// Mock prefixes text with the target language instead of translating it,
+// for development and tests without a translation service.
+type Mock struct{}
+
+func (Mock) Translate(ctx context.Context, text, to string) (string, error) {
+	return "[" + to + "] " + text, nil
+}
+
+// LibreTranslate translates through a LibreTranslate server.
+type LibreTranslate struct {
+	// URL is the server's base URL, e.g. https://libretranslate.example.com.
+	URL string
+	// APIKey is only needed by servers that require one.
+	APIKey string
+	Client *http.Client
+}
+
+func (lt LibreTranslate) Translate(ctx context.Context, text, to string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  "auto",
+		"target":  to,
+		"format":  "text",
+		"api_key": lt.APIKey,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(lt.URL, "/")+"/translate", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := lt.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	result := struct {
+		TranslatedText string `json:"translatedText"`
+		Error          string `json:"error"`
+	}{}
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return "", fmt.Errorf("libretranslate: status %d: %w", resp.StatusCode, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusBadRequest:
+		// e.g. "to" is not supported
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedLanguage, result.Error)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("libretranslate: status %d: %s", resp.StatusCode, result.Error)
+	}
+	return result.TranslatedText, nil
+}
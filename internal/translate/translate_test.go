@@ -0,0 +1,86 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// countingProvider counts the calls to Mock.
+type countingProvider struct {
+	calls int
+}
+
+func (p *countingProvider) Translate(ctx context.Context, text, to string) (string, error) {
+	p.calls++
+	return Mock{}.Translate(ctx, text, to)
+}
+
+func TestCache(t *testing.T) {
+	provider := &countingProvider{}
+	cache := NewCache(provider, 2)
+
+	var tests = []struct {
+		id, revision, text, to string
+		want                   string
+		wantCached             bool
+	}{
+		{"post", "1", "hello", "fr", "[fr] hello", false},
+		{"post", "1", "hello", "fr", "[fr] hello", true},
+		{"post", "1", "hello", "de", "[de] hello", false},
+		// a new revision isn't served the old translation
+		{"post", "2", "hi", "fr", "[fr] hi", false},
+		// the least recently used translation was evicted
+		{"post", "1", "hello", "fr", "[fr] hello", false},
+		{"post", "2", "hi", "fr", "[fr] hi", true},
+	}
+	for i, tt := range tests {
+		got, cached, err := cache.Translate(context.Background(), tt.id, tt.revision, tt.text, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want || cached != tt.wantCached {
+			t.Errorf("%d: got %q, cached %v, want %q, cached %v", i, got, cached, tt.want, tt.wantCached)
+		}
+	}
+	if provider.calls != 4 || cache.Len() != 2 {
+		t.Errorf("got %d calls and %d cached, want 4 and 2", provider.calls, cache.Len())
+	}
+}
+
+func TestLibreTranslate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := map[string]string{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil || r.URL.Path != "/translate" || params["api_key"] != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": "bad request"}`))
+			return
+		}
+		if params["target"] != "fr" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "` + params["target"] + ` is not supported"}`))
+			return
+		}
+		w.Write([]byte(`{"translatedText": "bonjour"}`))
+	}))
+	defer server.Close()
+
+	lt := LibreTranslate{URL: server.URL + "/", APIKey: "key"}
+	got, err := lt.Translate(context.Background(), "hello", "fr")
+	if err != nil || got != "bonjour" {
+		t.Errorf("got %q, %v, want bonjour", got, err)
+	}
+	_, err = lt.Translate(context.Background(), "hello", "xx")
+	if !errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("got %v, want ErrUnsupportedLanguage", err)
+	}
+	lt.APIKey = "wrong"
+	_, err = lt.Translate(context.Background(), "hello", "fr")
+	if err == nil || errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("got %v, want a provider error", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/iprep"
+)
+
+var errRequestBlocked = apiError{Code: codeRequestBlocked, Message: "requests from your network are blocked"}
+
+// challengeHeader flags the responses to requests the IP policy challenges,
+// for clients to ask for proof they're legitimate.
+const challengeHeader = "X-Challenge-Required"
+
+// ipFilter blocks or flags requests by what's known of their address. It
+// lets every request through while it has no source.
+type ipFilter struct {
+	mu     sync.RWMutex
+	source iprep.Source
+	policy iprep.Policy
+}
+
+// set replaces the sources and policy on reload.
+func (f *ipFilter) set(source iprep.Source, policy iprep.Policy) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.source = source
+	f.policy = policy
+}
+
+func (f *ipFilter) current() (iprep.Source, iprep.Policy) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.source, f.policy
+}
+
+// loadIPSources loads the GeoIP table and blocklists of cfg. It returns nil
+// when the policy has nothing to act on.
+func loadIPSources(cfg config) (iprep.Source, error) {
+	sources := iprep.Sources{}
+	if cfg.geoIPCountryCSV != "" {
+		f, err := os.Open(cfg.geoIPCountryCSV)
+		if err != nil {
+			return nil, fmt.Errorf("GEOIP_COUNTRY_CSV: %w", err)
+		}
+		defer f.Close()
+		countries, err := iprep.LoadCountryCSV(f)
+		if err != nil {
+			return nil, fmt.Errorf("GEOIP_COUNTRY_CSV: %w", err)
+		}
+		sources = append(sources, countries)
+	} else if len(cfg.ipPolicy.Countries) > 0 {
+		return nil, fmt.Errorf("GEOIP_COUNTRY_CSV is required to block or challenge countries")
+	}
+	for _, path := range cfg.ipBlocklists {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("IP_BLOCKLISTS: %w", err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		list, err := iprep.ParseBlocklist(name, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("IP_BLOCKLISTS: %w", err)
+		}
+		sources = append(sources, list)
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+	return sources, nil
+}
+
+// middleware looks up the client address of every request and applies the
+// policy, logging what it blocks and challenges. Requests are let through
+// when the lookup fails, so a broken source doesn't take the API down.
+func (f *ipFilter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source, policy := f.current()
+		if source == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip, err := netip.ParseAddr(clientIP(r))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+		info, err := source.Lookup(ctx, ip)
+		cancel()
+		if err != nil {
+			log.Printf("ip reputation: %s: %v", ip, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		decision := policy.Decide(info)
+		switch decision.Action {
+		case iprep.Block:
+			log.Printf("ip reputation: blocked %s %s from %s: %s", r.Method, r.URL.Path, ip, decision.Reason)
+			respondWithError(w, http.StatusForbidden, errRequestBlocked)
+			return
+		case iprep.Challenge:
+			log.Printf("ip reputation: challenged %s %s from %s: %s", r.Method, r.URL.Path, ip, decision.Reason)
+			w.Header().Set(challengeHeader, "true")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/iprep"
+)
+
+type failingSource struct{}
+
+func (failingSource) Lookup(ctx context.Context, ip netip.Addr) (iprep.Info, error) {
+	return iprep.Info{}, errors.New("lookup failed")
+}
+
+func TestIPFilter(t *testing.T) {
+	countries, err := iprep.LoadCountryCSV(strings.NewReader("1.0.0.0,1.0.0.255,KP\n2.0.0.0,2.0.0.255,RU\n3.0.0.0,3.0.0.255,FR\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drop, err := iprep.ParseBlocklist("drop", strings.NewReader("3.0.0.128/25\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := iprep.Policy{
+		Countries: map[string]iprep.Action{"KP": iprep.Block, "RU": iprep.Challenge},
+		Listed:    iprep.Block,
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondWithJSON(w, http.StatusOK, struct{}{})
+	})
+
+	var tests = []struct {
+		name              string
+		source            iprep.Source
+		remoteAddr        string
+		expectedStatus    int
+		expectedChallenge bool
+	}{
+		{name: "allowed country", source: countries, remoteAddr: "3.0.0.1:1234", expectedStatus: 200},
+		{name: "unknown country", source: countries, remoteAddr: "[2001:db8::1]:1234", expectedStatus: 200},
+		{name: "blocked country", source: countries, remoteAddr: "1.0.0.1:1234", expectedStatus: 403},
+		{name: "challenged country", source: countries, remoteAddr: "2.0.0.1:1234", expectedStatus: 200, expectedChallenge: true},
+		{name: "blocklisted", source: iprep.Sources{countries, drop}, remoteAddr: "3.0.0.200:1234", expectedStatus: 403},
+		{name: "failed lookup", source: failingSource{}, remoteAddr: "1.0.0.1:1234", expectedStatus: 200},
+	}
+	for _, tt := range tests {
+		f := &ipFilter{source: tt.source, policy: policy}
+		r := httptest.NewRequest(http.MethodGet, "/v1/posts", nil)
+		r.RemoteAddr = tt.remoteAddr
+		w := httptest.NewRecorder()
+		f.middleware(ok).ServeHTTP(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+		if challenged := w.Header().Get(challengeHeader) != ""; challenged != tt.expectedChallenge {
+			t.Errorf("%s: got challenge %v, want %v", tt.name, challenged, tt.expectedChallenge)
+		}
+	}
+}
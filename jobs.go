@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// handlerAdminJobs lists background jobs, newest first, filtered by
+// ?status= and ?kind=.
+func (apiCfg apiConfig) handlerAdminJobs(w http.ResponseWriter, r *http.Request) {
+	// get params
+	query := r.URL.Query()
+	status := database.JobStatus(query.Get("status"))
+	switch status {
+	case "", database.JobPending, database.JobRunning, database.JobDone, database.JobFailed:
+	default:
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("status must be pending, running, done or failed")))
+		return
+	}
+	kind := query.Get("kind")
+	pg, err := apiCfg.pagination.parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// return jobs
+	all, err := apiCfg.dbClient.GetJobs()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	jobs := []database.Job{}
+	for _, job := range all {
+		if (status == "" || job.Status == status) && (kind == "" || job.Kind == kind) {
+			jobs = append(jobs, job)
+		}
+	}
+	respondWithJSON(w, http.StatusOK, paginate(w, r, jobs, pg))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const jsonAPIMediaType = "application/vnd.api+json"
+
+// jsonAPITypes names the resource types whose Go type doesn't pluralize by
+// adding an s.
+var jsonAPITypes = map[string]string{
+	"Media":         "media",
+	"sessionInfo":   "sessions",
+	"publicProfile": "profiles",
+}
+
+// jsonAPIEncoder wraps responses in JSON:API documents.
+type jsonAPIEncoder struct{}
+
+func (jsonAPIEncoder) encode(w *formatWriter, code int, payload interface{}, response []byte) ([]byte, error) {
+	return w.jsonAPIDocument(code, payload, response)
+}
+
+// jsonAPIDocument is the top level of a JSON:API response.
+type jsonAPIDocument struct {
+	Data   interface{}            `json:"data,omitempty"`
+	Errors []jsonAPIError         `json:"errors,omitempty"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+	Links  map[string]string      `json:"links,omitempty"`
+}
+
+type jsonAPIResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    map[string]json.RawMessage     `json:"attributes,omitempty"`
+	Relationships map[string]jsonAPIRelationship `json:"relationships,omitempty"`
+}
+
+type jsonAPIRelationship struct {
+	Data jsonAPIIdentifier `json:"data"`
+}
+
+type jsonAPIIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type jsonAPIError struct {
+	Status string                 `json:"status"`
+	Code   errorCode              `json:"code"`
+	Title  string                 `json:"title"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+}
+
+// jsonAPIDocument wraps a response marshalled from payload in a JSON:API
+// document. Objects with an ID become resources, whose fields ending in
+// "Id" are relationships, other responses are kept as meta. Pagination
+// headers become links and the total in meta.
+func (w *formatWriter) jsonAPIDocument(code int, payload interface{}, response []byte) ([]byte, error) {
+	if body, ok := payload.(errorBody); ok {
+		apiErr := jsonAPIError{Status: strconv.Itoa(code), Code: body.Code, Title: body.Message, Meta: map[string]interface{}{}}
+		if body.Details != nil {
+			apiErr.Meta["details"] = body.Details
+		}
+		if body.RequestID != "" {
+			apiErr.Meta["requestId"] = body.RequestID
+		}
+		return json.Marshal(jsonAPIDocument{Errors: []jsonAPIError{apiErr}})
+	}
+
+	doc := jsonAPIDocument{
+		Meta:  map[string]interface{}{},
+		Links: map[string]string{"self": (&url.URL{Path: w.url.Path, RawQuery: w.url.RawQuery}).String()},
+	}
+	resourceType := jsonAPIType(payload, w.url.Path)
+	items := []json.RawMessage{}
+	object := map[string]json.RawMessage{}
+	if json.Unmarshal(response, &items) == nil {
+		resources := []jsonAPIResource{}
+		for _, item := range items {
+			resource, ok := w.jsonAPIResource(resourceType, item)
+			if !ok {
+				resources = nil
+				break
+			}
+			resources = append(resources, resource)
+		}
+		if resources != nil {
+			doc.Data = resources
+		} else {
+			doc.Meta["items"] = json.RawMessage(response)
+		}
+	} else if resource, ok := w.jsonAPIResource(resourceType, response); ok {
+		doc.Data = resource
+	} else if json.Unmarshal(response, &object) == nil {
+		for key, value := range object {
+			doc.Meta[key] = value
+		}
+	} else {
+		doc.Meta["value"] = json.RawMessage(response)
+	}
+
+	// pagination
+	if total, err := strconv.Atoi(w.Header().Get(totalCountHeader)); err == nil {
+		doc.Meta["total"] = total
+	}
+	if next := nextLink(w.Header().Get(linkHeader)); next != "" {
+		doc.Links["next"] = next
+	}
+	return json.Marshal(doc)
+}
+
+// jsonAPIResource makes a resource of a JSON object with an ID, keeping the
+// requested fields only.
+func (w *formatWriter) jsonAPIResource(resourceType string, item json.RawMessage) (jsonAPIResource, bool) {
+	object := map[string]json.RawMessage{}
+	if json.Unmarshal(item, &object) != nil {
+		return jsonAPIResource{}, false
+	}
+	rawID, ok := object["id"]
+	if !ok {
+		return jsonAPIResource{}, false
+	}
+	// IDs are strings in JSON:API
+	id := ""
+	if json.Unmarshal(rawID, &id) != nil {
+		id = string(rawID)
+	}
+	delete(object, "id")
+
+	resource := jsonAPIResource{
+		Type:          resourceType,
+		ID:            id,
+		Attributes:    map[string]json.RawMessage{},
+		Relationships: map[string]jsonAPIRelationship{},
+	}
+	for key, value := range object {
+		name := strings.TrimSuffix(key, "Id")
+		if len(w.fields) > 0 && !w.fields[key] && !w.fields[name] {
+			continue
+		}
+		relatedID := ""
+		if name != key && name != "" && json.Unmarshal(value, &relatedID) == nil && relatedID != "" {
+			resource.Relationships[name] = jsonAPIRelationship{Data: jsonAPIIdentifier{Type: name + "s", ID: relatedID}}
+			continue
+		}
+		resource.Attributes[key] = value
+	}
+	return resource, true
+}
+
+// jsonAPIType names the type of the resources in payload after its Go type,
+// e.g. "users" for a database.User or a slice of them. Unnamed types take
+// the name of the resource in path.
+func jsonAPIType(payload interface{}, path string) string {
+	t := reflect.TypeOf(payload)
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Name() == "" {
+		resource, _ := auditResource(path)
+		return resource
+	}
+	if name, ok := jsonAPITypes[t.Name()]; ok {
+		return name
+	}
+	name := strings.ToLower(t.Name()[:1]) + t.Name()[1:]
+	if strings.HasSuffix(name, "s") {
+		return name
+	}
+	return name + "s"
+}
+
+// nextLink returns the target of a Link header with rel="next".
+func nextLink(header string) string {
+	target, params, ok := strings.Cut(header, ";")
+	if !ok || !strings.Contains(params, `rel="next"`) {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(target), "<>")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestJSONAPIDocument(t *testing.T) {
+	posts := []database.Post{{ID: "p1", UserID: "u1", Text: "hello"}, {ID: "p2", UserID: "u1", Text: "again"}}
+	handler := responseFormatMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/posts":
+			respondWithJSON(w, http.StatusOK, paginate(w, r, posts, page{limit: 1}))
+		case "/posts/p1":
+			respondWithJSON(w, http.StatusOK, posts[0])
+		case "/login":
+			respondWithJSON(w, http.StatusOK, map[string]string{"token": "abc"})
+		default:
+			respondWithError(w, http.StatusNotFound, errPostNotFound)
+		}
+	}))
+
+	var tests = []struct {
+		path     string
+		accept   string
+		expected string
+	}{
+		{
+			path:     "/posts/p1",
+			accept:   "application/json",
+			expected: `{"id":"p1","createdAt":"0001-01-01T00:00:00Z","updatedAt":"0001-01-01T00:00:00Z","userId":"u1","text":"hello"}`,
+		},
+		{
+			path:     "/posts",
+			accept:   "application/vnd.api+json",
+			expected: `{"data":[{"type":"posts","id":"p1","attributes":{"createdAt":"0001-01-01T00:00:00Z","text":"hello","updatedAt":"0001-01-01T00:00:00Z"},"relationships":{"user":{"data":{"type":"users","id":"u1"}}}}],"meta":{"total":2},"links":{"next":"/posts?limit=1\u0026offset=1","self":"/posts"}}`,
+		},
+		{
+			path:     "/posts/p1?fields=text",
+			accept:   "text/html, application/vnd.api+json; q=0.9",
+			expected: `{"data":{"type":"posts","id":"p1","attributes":{"text":"hello"}},"links":{"self":"/posts/p1?fields=text"}}`,
+		},
+		{
+			path:     "/login",
+			accept:   "application/vnd.api+json",
+			expected: `{"meta":{"token":"abc"},"links":{"self":"/login"}}`,
+		},
+		{
+			path:     "/missing",
+			accept:   "application/vnd.api+json",
+			expected: `{"errors":[{"status":"404","code":"POST_NOT_FOUND","title":"post with that id doesn't exist"}]}`,
+		},
+		// media type parameters aren't JSON:API
+		{
+			path:     "/login",
+			accept:   "application/vnd.api+json; ext=bulk",
+			expected: `{"token":"abc"}`,
+		},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		r.Header.Set("Accept", tt.accept)
+		handler.ServeHTTP(w, r)
+		if w.Body.String() != tt.expected {
+			t.Errorf("GET %s (%s): got %s, want %s", tt.path, tt.accept, w.Body, tt.expected)
+		}
+		if !json.Valid(w.Body.Bytes()) {
+			t.Errorf("GET %s (%s): got invalid JSON", tt.path, tt.accept)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// leaderboardWindows are the periods users are ranked over. A zero duration
+// means all time.
+var leaderboardWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"daily", 24 * time.Hour},
+	{"weekly", 7 * 24 * time.Hour},
+	{"all-time", 0},
+}
+
+type leaderboardEntry struct {
+	Rank   int    `json:"rank"`
+	UserID string `json:"userId"`
+	Name   string `json:"name"`
+	Count  int    `json:"count"`
+}
+
+type leaderboard struct {
+	Board      string             `json:"board"`
+	Window     string             `json:"window"`
+	ComputedAt time.Time          `json:"computedAt"`
+	Entries    []leaderboardEntry `json:"entries"`
+}
+
+// leaderboards holds the rankings computed by the scheduler, so requests
+// never scan the whole database.
+type leaderboards struct {
+	mu         sync.RWMutex
+	computedAt time.Time
+	posters    map[string][]leaderboardEntry
+}
+
+func (lb *leaderboards) recompute(c database.Client) {
+	users, err := c.GetAllUsers()
+	if err != nil {
+		log.Printf("leaderboards: %v", err)
+		return
+	}
+	posts, err := c.GetAllPosts()
+	if err != nil {
+		log.Printf("leaderboards: %v", err)
+		return
+	}
+	now := time.Now().UTC()
+	posters := map[string][]leaderboardEntry{}
+	for _, window := range leaderboardWindows {
+		counts := map[string]int{}
+		for _, post := range posts {
+			if window.duration == 0 || now.Sub(post.CreatedAt) <= window.duration {
+				counts[post.UserID]++
+			}
+		}
+		posters[window.name] = rankUsers(users, counts)
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.computedAt = now
+	lb.posters = posters
+}
+
+// rankUsers orders users with a non-zero count, ties share a rank.
+func rankUsers(users []database.User, counts map[string]int) []leaderboardEntry {
+	entries := []leaderboardEntry{}
+	for _, user := range users {
+		if counts[user.ID] > 0 {
+			entries = append(entries, leaderboardEntry{UserID: user.ID, Name: user.Name, Count: counts[user.ID]})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].UserID < entries[j].UserID
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Count == entries[i-1].Count {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+	return entries
+}
+
+func (apiCfg apiConfig) handlerPostersLeaderboard(w http.ResponseWriter, r *http.Request) {
+	// get params
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "all-time"
+	}
+	pg, err := apiCfg.pagination.parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// compute on first use when the scheduler hasn't run yet
+	apiCfg.leaderboards.mu.RLock()
+	computed := !apiCfg.leaderboards.computedAt.IsZero()
+	apiCfg.leaderboards.mu.RUnlock()
+	if !computed {
+		apiCfg.leaderboards.recompute(apiCfg.dbClient)
+	}
+
+	// return board
+	apiCfg.leaderboards.mu.RLock()
+	entries, ok := apiCfg.leaderboards.posters[window]
+	board := leaderboard{
+		Board:      "posters",
+		Window:     window,
+		ComputedAt: apiCfg.leaderboards.computedAt,
+	}
+	apiCfg.leaderboards.mu.RUnlock()
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, validationFailed(fmt.Errorf("unknown window %q, use daily, weekly or all-time", window)))
+		return
+	}
+	board.Entries = paginate(w, r, entries, pg)
+	respondWithJSON(w, http.StatusOK, board)
+}
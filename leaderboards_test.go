@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestRankUsers(t *testing.T) {
+	users := []database.User{
+		{ID: "a", Name: "A"},
+		{ID: "b", Name: "B"},
+		{ID: "c", Name: "C"},
+		{ID: "d", Name: "D"},
+	}
+	counts := map[string]int{"a": 2, "b": 5, "c": 2}
+	expected := []leaderboardEntry{
+		{Rank: 1, UserID: "b", Name: "B", Count: 5},
+		{Rank: 2, UserID: "a", Name: "A", Count: 2},
+		{Rank: 2, UserID: "c", Name: "C", Count: 2},
+	}
+	got := rankUsers(users, counts)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, want %+v", got, expected)
+	}
+}
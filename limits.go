@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func errRequestTooLarge(maxBytes int64) apiError {
+	return apiError{
+		Code:    codeRequestTooLarge,
+		Message: fmt.Sprintf("request bodies can be at most %d bytes", maxBytes),
+		Details: map[string]int64{"maxBytes": maxBytes},
+	}
+}
+
+// bodyLimitMiddleware rejects request bodies over maxBytes, or over
+// adminMaxBytes for admin routes, which import and restore whole databases.
+// A limit of 0 disables it. Bodies announcing their length are rejected
+// right away, others once a handler reads past the limit, see
+// tooLargeError. Media uploads are left to their handlers, which size their
+// limits for files.
+func bodyLimitMiddleware(maxBytes, adminMaxBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := maxBytes
+		if strings.HasPrefix(r.URL.Path, "/admin/") {
+			limit = adminMaxBytes
+		}
+		if r.Body == nil || r.Body == http.NoBody || limit <= 0 || ownsBodyLimit(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > limit {
+			respondWithError(w, http.StatusRequestEntityTooLarge, errRequestTooLarge(limit))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ownsBodyLimit reports whether the handler of path limits bodies itself.
+func ownsBodyLimit(path string) bool {
+	return strings.HasSuffix(path, "/media") ||
+		strings.HasSuffix(path, "/avatar")
+}
+
+// tooLargeError returns the API error for a body read past the limit of
+// bodyLimitMiddleware, or nil for other errors.
+func tooLargeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return nil
+	}
+	return errRequestTooLarge(maxBytesErr.Limit)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	handler := bodyLimitMiddleware(16, 32, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := map[string]string{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, params)
+	}))
+
+	var tests = []struct {
+		name           string
+		path           string
+		body           string
+		chunked        bool
+		expectedStatus int
+		expectedCode   errorCode
+	}{
+		{name: "within limit", path: "/v1/posts", body: `{"text": "hi"}`, expectedStatus: 200},
+		{name: "over limit", path: "/v1/posts", body: `{"text": "hello, world"}`, expectedStatus: 413, expectedCode: codeRequestTooLarge},
+		{name: "over limit without length", path: "/v1/posts", body: `{"text": "hello, world"}`, chunked: true, expectedStatus: 413, expectedCode: codeRequestTooLarge},
+		{name: "invalid within limit", path: "/v1/posts", body: `{"text": `, expectedStatus: 400, expectedCode: codeInvalidRequest},
+		{name: "admin route", path: "/admin/import", body: `{"text": "hello, world"}`, expectedStatus: 200},
+		{name: "admin route over its limit", path: "/admin/restore", body: `{"text": "hello, world, hello again"}`, expectedStatus: 413, expectedCode: codeRequestTooLarge},
+		{name: "admin route over its limit without length", path: "/admin/query", body: `{"text": "hello, world, hello again"}`, chunked: true, expectedStatus: 413, expectedCode: codeRequestTooLarge},
+		{name: "media upload", path: "/v1/posts/1/media", body: `{"text": "hello, world, hello again"}`, expectedStatus: 200},
+	}
+	for _, tt := range tests {
+		var body io.Reader = strings.NewReader(tt.body)
+		if tt.chunked {
+			// hides the length from httptest.NewRequest
+			body = io.MultiReader(body)
+		}
+		r := httptest.NewRequest(http.MethodPost, tt.path, body)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+			continue
+		}
+		if tt.expectedCode != "" {
+			got := errorBody{}
+			err := json.NewDecoder(w.Body).Decode(&got)
+			if err != nil || got.Code != tt.expectedCode {
+				t.Errorf("%s: got code %q (%v), want %q", tt.name, got.Code, err, tt.expectedCode)
+			}
+		}
+	}
+}
+
+func TestPostQuota(t *testing.T) {
+	c := database.NewMemoryClient()
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		postsprefix: "/posts",
+		settings:    &tenantSettings{},
+		postLimits:  service.PostLimits{MaxLength: 10, PerDay: 1},
+		auth:        authConfig{secret: []byte("secret")},
+	}
+	token, err := auth.Sign(apiCfg.auth.secret, auth.NewClaims(user.ID, time.Now(), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedCode   errorCode
+	}{
+		{name: "too long", body: `{"userEmail": "test@example.com", "text": "far too long"}`, expectedStatus: 413, expectedCode: codePostTooLong},
+		{name: "first post", body: `{"userEmail": "test@example.com", "text": "hello"}`, expectedStatus: 201},
+		{name: "over quota", body: `{"userEmail": "test@example.com", "text": "again"}`, expectedStatus: 429, expectedCode: codePostQuotaExceeded},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(tt.body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		apiCfg.endpointPostsHandler(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+			continue
+		}
+		if tt.expectedCode == "" {
+			continue
+		}
+		got := errorBody{}
+		err := json.NewDecoder(w.Body).Decode(&got)
+		if err != nil || got.Code != tt.expectedCode {
+			t.Errorf("%s: got code %q (%v), want %q", tt.name, got.Code, err, tt.expectedCode)
+		}
+		if tt.expectedStatus == http.StatusTooManyRequests {
+			retryAfter := w.Header().Get("Retry-After")
+			if retryAfter == "" || retryAfter == "0" {
+				t.Errorf("%s: got Retry-After %q", tt.name, retryAfter)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// routeSets are the groups of routes a listener can serve. admin covers
+// /admin, /metrics and /debug.
+var routeSets = []string{"api", "admin"}
+
+// listener is an address to serve and the route sets served on it.
+type listener struct {
+	addr   string
+	routes []string
+}
+
+func (l listener) String() string {
+	return strings.Join(l.routes, "+") + "@" + l.addr
+}
+
+func (l listener) serves(routes string) bool {
+	for _, r := range l.routes {
+		if r == routes {
+			return true
+		}
+	}
+	return false
+}
+
+// parseListener parses routes@addr, e.g. api+admin@0.0.0.0:8080.
+func parseListener(s string) (listener, error) {
+	routes, addr, ok := strings.Cut(s, "@")
+	if !ok || routes == "" || addr == "" {
+		return listener{}, fmt.Errorf("listener %q isn't routes@addr", s)
+	}
+	l := listener{addr: addr}
+	for _, route := range strings.Split(routes, "+") {
+		if !isRouteSet(route) {
+			return listener{}, fmt.Errorf("unknown route set %q, want one of %s", route, strings.Join(routeSets, ", "))
+		}
+		l.routes = append(l.routes, route)
+	}
+	return l, nil
+}
+
+// parseListeners parses a space separated list of listeners.
+func parseListeners(s string) ([]listener, error) {
+	listeners := []listener{}
+	for _, field := range strings.Fields(s) {
+		l, err := parseListener(field)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func isRouteSet(name string) bool {
+	for _, routeSet := range routeSets {
+		if routeSet == name {
+			return true
+		}
+	}
+	return false
+}
+
+// listenerFlag collects repeated -listen flags.
+type listenerFlag []listener
+
+func (f *listenerFlag) String() string {
+	parts := []string{}
+	for _, l := range *f {
+		parts = append(parts, l.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f *listenerFlag) Set(s string) error {
+	l, err := parseListener(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, l)
+	return nil
+}
+
+// configuredListeners returns the listeners to serve. Without any configured,
+// addr serves the API and adminAddr the admin routes, which should only be
+// reachable from inside the network. Setting adminAddr to addr serves both
+// together.
+func configuredListeners(cfg config) []listener {
+	if len(cfg.listeners) > 0 {
+		return cfg.listeners
+	}
+	if cfg.adminAddr == cfg.addr {
+		return []listener{{addr: cfg.addr, routes: routeSets}}
+	}
+	return []listener{
+		{addr: cfg.addr, routes: []string{"api"}},
+		{addr: cfg.adminAddr, routes: []string{"admin"}},
+	}
+}
+
+// serveAll serves every server until one of them fails, or until a SIGINT
+// or SIGTERM, after which the requests in flight get SHUTDOWN_TIMEOUT to
+// finish. HTTPS applies to the first server only, the others are meant for
+// private interfaces. Listeners are taken over from the process this one
+// replaces, if any.
+func serveAll(servers []*http.Server, cfg config, h *handoff) error {
+	listeners := make([]net.Listener, len(servers))
+	for i, srv := range servers {
+		l, err := h.listen(srv.Addr)
+		if err != nil {
+			return err
+		}
+		listeners[i] = l
+	}
+	// the redirect listener is opened here too, to be passed on restarts
+	var redirectListener net.Listener
+	if cfg.httpRedirectAddr != "" && (cfg.tlsDomains != "" || cfg.tlsCertFile != "") {
+		var err error
+		redirectListener, err = h.listen(cfg.httpRedirectAddr)
+		if err != nil {
+			log.Printf("HTTP redirect listener: %v", err)
+		}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	errs := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func(i int, srv *http.Server) {
+			if i == 0 {
+				errs <- serve(srv, listeners[i], redirectListener, cfg)
+				return
+			}
+			errs <- srv.Serve(listeners[i])
+		}(i, srv)
+	}
+	err := h.ready()
+	if err != nil {
+		log.Printf("restart: %v", err)
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		log.Printf("%v received, finishing the requests in flight", sig)
+	}
+	// a restarted process sends the signal once it serves, and works the
+	// job queue and the scheduler from then on
+	h.stopBackground()
+	err = shutdown(servers, cfg.shutdownTimeout)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("requests still running after %s were cut off", cfg.shutdownTimeout)
+	}
+	return err
+}
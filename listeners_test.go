@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseListeners(t *testing.T) {
+	var tests = []struct {
+		input       string
+		expected    []listener
+		expectedErr bool
+	}{
+		{input: "", expected: []listener{}},
+		{input: "api@0.0.0.0:8080", expected: []listener{{addr: "0.0.0.0:8080", routes: []string{"api"}}}},
+		{
+			input: "api@:8080  admin+api@127.0.0.1:9090",
+			expected: []listener{
+				{addr: ":8080", routes: []string{"api"}},
+				{addr: "127.0.0.1:9090", routes: []string{"admin", "api"}},
+			},
+		},
+		{input: ":8080", expectedErr: true},
+		{input: "api@", expectedErr: true},
+		{input: "metrics@:9090", expectedErr: true},
+	}
+	for _, tt := range tests {
+		listeners, err := parseListeners(tt.input)
+		if tt.expectedErr {
+			if err == nil {
+				t.Errorf("%q: got no error, want one", tt.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: got error %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(listeners, tt.expected) {
+			t.Errorf("%q: got %v, want %v", tt.input, listeners, tt.expected)
+		}
+	}
+}
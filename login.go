@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/router"
+)
+
+// authConfig holds the session token secret and the lockout policy: an
+// account is locked for lockout after maxFailures failed logins within
+// failureWindow.
+type authConfig struct {
+	secret        []byte
+	sessionTTL    time.Duration
+	maxFailures   int
+	failureWindow time.Duration
+	lockout       time.Duration
+}
+
+var (
+	errInvalidCredentials = apiError{Code: codeInvalidCredentials, Message: "invalid email or password"}
+	errUnauthorized       = apiError{Code: codeUnauthorized, Message: "missing or invalid session token"}
+)
+
+type session struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	UserID    string    `json:"userId"`
+	SessionID string    `json:"sessionId"`
+}
+
+func (apiCfg apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		// LoginToken stands in for the email and password of a user
+		// finishing a provider login with their second factor
+		LoginToken string `json:"loginToken"`
+		secondFactorCodes
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check user exists, without telling callers whether it does
+	now := time.Now().UTC()
+	method := "password"
+	var user database.User
+	if params.LoginToken != "" {
+		user, method, err = apiCfg.oauthPendingUser(params.LoginToken, now)
+	} else {
+		user, err = apiCfg.dbClient.GetUserByEmail(params.Email)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, errInvalidCredentials)
+		return
+	}
+
+	// check account isn't locked
+	attempts, err := apiCfg.dbClient.GetLoginAttempts(user.ID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if now.Before(attempts.LockedUntil) {
+		respondWithAccountLocked(w, attempts.LockedUntil, now)
+		return
+	}
+
+	// check password, the provider vouched for users with a login token
+	users := apiCfg.users()
+	if params.LoginToken == "" {
+		ok, err := users.VerifyPassword(user, params.Password)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		if !ok {
+			apiCfg.respondWithLoginFailure(w, attempts, now)
+			return
+		}
+	}
+
+	// check user isn't suspended, only once they proved who they are
+	suspension, suspended, err := apiCfg.activeSuspension(user.ID, now)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if suspended {
+		respondWithError(w, http.StatusForbidden, suspendedError(suspension))
+		return
+	}
+
+	// check signup isn't waiting for review
+	pending, err := apiCfg.signupPending(user.ID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if pending {
+		respondWithError(w, http.StatusForbidden, errSignupPending)
+		return
+	}
+
+	// upgrade the hash when the configured algorithm or cost changed, the
+	// old one keeps working if that fails
+	if params.LoginToken == "" {
+		_, err = users.RehashPassword(user, params.Password)
+		if err != nil {
+			log.Printf("rehash password of user %s: %v", user.ID, err)
+		}
+	}
+
+	// start session
+	apiCfg.respondWithSession(w, r, user, method, params.secondFactorCodes, attempts, now)
+}
+
+// respondWithSession logs in the user who proved who they are with method,
+// once they pass checkSecondFactor: it clears their failed logins, records
+// the login and a session, and issues its token.
+func (apiCfg apiConfig) respondWithSession(w http.ResponseWriter, r *http.Request, user database.User, method string, codes secondFactorCodes, attempts database.LoginAttempts, now time.Time) {
+	if !apiCfg.checkSecondFactor(w, user.ID, codes, attempts, now) {
+		return
+	}
+	err := apiCfg.dbClient.SaveLoginAttempts(database.LoginAttempts{UserID: user.ID})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	apiCfg.recordLogin(r, user, method)
+
+	claims := auth.NewClaims(user.ID, now, apiCfg.auth.sessionTTL)
+	record, err := apiCfg.dbClient.CreateSession(database.Session{
+		UserID:    user.ID,
+		Device:    r.UserAgent(),
+		IP:        clientIP(r),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+		TokenID:   claims.ID,
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	claims.SessionID = record.ID
+	token, err := auth.Sign(apiCfg.auth.secret, claims)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, session{
+		Token:     token,
+		ExpiresAt: record.ExpiresAt,
+		UserID:    user.ID,
+		SessionID: record.ID,
+	})
+}
+
+// respondWithLoginFailure records a failed login and tells the client,
+// locking the account if that was one failure too many.
+func (apiCfg apiConfig) respondWithLoginFailure(w http.ResponseWriter, attempts database.LoginAttempts, now time.Time) {
+	attempts = apiCfg.auth.recordFailure(attempts, now)
+	err := apiCfg.dbClient.SaveLoginAttempts(attempts)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if now.Before(attempts.LockedUntil) {
+		log.Printf("locked user %s after %d failed logins", attempts.UserID, len(attempts.Failures))
+		respondWithAccountLocked(w, attempts.LockedUntil, now)
+		return
+	}
+	respondWithError(w, http.StatusUnauthorized, errInvalidCredentials)
+}
+
+// recordFailure adds a failed login, forgetting failures older than the
+// window, and locks the account once there are too many.
+func (a authConfig) recordFailure(attempts database.LoginAttempts, now time.Time) database.LoginAttempts {
+	recent := []time.Time{}
+	for _, failure := range attempts.Failures {
+		if now.Sub(failure) < a.failureWindow {
+			recent = append(recent, failure)
+		}
+	}
+	attempts.Failures = append(recent, now)
+	if len(attempts.Failures) >= a.maxFailures {
+		attempts.LockedUntil = now.Add(a.lockout)
+	}
+	return attempts
+}
+
+func respondWithAccountLocked(w http.ResponseWriter, lockedUntil, now time.Time) {
+	retryAfter := int(lockedUntil.Sub(now).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	respondWithError(w, http.StatusLocked, apiError{
+		Code:    codeAccountLocked,
+		Message: fmt.Sprintf("account locked after too many failed logins, try again in %d seconds", retryAfter),
+		Details: map[string]time.Time{"lockedUntil": lockedUntil},
+	})
+}
+
+// adminUsersRoutes are the routes below /admin/users.
+var adminUsersRoutes = newRoutes([]route{
+	{http.MethodPost, "/{id}/unlock", apiConfig.handlerAdminUnlockUser},
+	{http.MethodPost, "/{id}/revoke-tokens", apiConfig.handlerAdminRevokeTokens},
+	{http.MethodPost, "/{id}/suspend", func(apiCfg apiConfig, w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerAdminSuspendUser(w, r, false)
+	}},
+	{http.MethodPost, "/{id}/ban", func(apiCfg apiConfig, w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerAdminSuspendUser(w, r, true)
+	}},
+	{http.MethodPost, "/{id}/reinstate", apiConfig.handlerAdminReinstateUser},
+	{http.MethodPost, "/{id}/appeal-notes", apiConfig.handlerAdminAddAppealNote},
+})
+
+func (apiCfg apiConfig) endpointAdminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(adminUsersRoutes, "/admin/users", w, r)
+}
+
+// handlerAdminUnlockUser clears the failed logins of a locked account.
+func (apiCfg apiConfig) handlerAdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	// check path
+	ref := router.Param(r, "id")
+	if ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /admin/users/{id}/unlock"))
+		return
+	}
+
+	// check user exists
+	user, err := apiCfg.users().Get(ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// unlock user
+	err = apiCfg.dbClient.SaveLoginAttempts(database.LoginAttempts{UserID: user.ID})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// authenticatedUserID returns the user whose session token is sent as
+// "Authorization: Bearer <token>".
+func (apiCfg apiConfig) authenticatedUserID(r *http.Request) (string, error) {
+	claims, err := apiCfg.authenticatedSession(r)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+// authenticatedSession returns the claims of the session token sent with r,
+// if its session wasn't revoked.
+func (apiCfg apiConfig) authenticatedSession(r *http.Request) (auth.Claims, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return auth.Claims{}, errUnauthorized
+	}
+	now := time.Now().UTC()
+	claims, err := auth.Verify(apiCfg.auth.secret, token, now)
+	if err != nil {
+		return auth.Claims{}, errUnauthorized
+	}
+	err = apiCfg.checkNotRevoked(claims)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+	// tokens issued before sessions were recorded can't be revoked, they
+	// stay valid until they expire
+	if claims.SessionID == "" {
+		return claims, nil
+	}
+	record, err := apiCfg.dbClient.GetSession(claims.SessionID)
+	if err != nil || record.UserID != claims.Subject {
+		return auth.Claims{}, errUnauthorized
+	}
+	apiCfg.touchSession(record, now)
+	return claims, nil
+}
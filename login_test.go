@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/passhash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHandlerLoginLockout(t *testing.T) {
+	c := database.NewMemoryClient()
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		auth: authConfig{
+			secret:        []byte("secret"),
+			sessionTTL:    time.Hour,
+			maxFailures:   3,
+			failureWindow: time.Minute,
+			lockout:       time.Minute,
+		},
+	}
+
+	var tests = []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "unknown user", path: "/login", body: `{"email": "nobody@example.com", "password": "12345"}`, expectedStatus: http.StatusUnauthorized},
+		{name: "first failure", path: "/login", body: `{"email": "test@example.com", "password": "wrong"}`, expectedStatus: http.StatusUnauthorized},
+		{name: "second failure", path: "/login", body: `{"email": "test@example.com", "password": "wrong"}`, expectedStatus: http.StatusUnauthorized},
+		{name: "third failure locks", path: "/login", body: `{"email": "test@example.com", "password": "wrong"}`, expectedStatus: http.StatusLocked},
+		{name: "locked", path: "/login", body: `{"email": "test@example.com", "password": "12345"}`, expectedStatus: http.StatusLocked},
+		{name: "unlock unknown user", path: "/admin/users/nobody@example.com/unlock", expectedStatus: http.StatusNotFound},
+		{name: "unlock", path: "/admin/users/test@example.com/unlock", expectedStatus: http.StatusOK},
+		{name: "unlocked", path: "/login", body: `{"email": "test@example.com", "password": "12345"}`, expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		if tt.path == "/login" {
+			apiCfg.handlerLogin(w, r)
+		} else {
+			apiCfg.endpointAdminUsersHandler(w, r)
+		}
+		if w.Code != tt.expectedStatus {
+			t.Fatalf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+		if w.Code == http.StatusLocked && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: missing Retry-After header", tt.name)
+		}
+		if w.Code == http.StatusOK && tt.path == "/login" {
+			s := session{}
+			err = json.NewDecoder(w.Body).Decode(&s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := auth.Verify(apiCfg.auth.secret, s.Token, time.Now())
+			if err != nil || claims.Subject != user.ID {
+				t.Errorf("%s: got claims %+v, %v, want a token for %s", tt.name, claims, err, user.ID)
+			}
+		}
+	}
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	c := database.NewMemoryClient()
+	// stored before passwords were hashed
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient: c,
+		auth:     testAuth,
+	}
+
+	var tests = []struct {
+		name           string
+		hasher         passhash.Hasher
+		password       string
+		expectedStatus int
+		expectedTag    string
+	}{
+		{name: "wrong password keeps plain text", hasher: passhash.Hasher{BcryptCost: bcrypt.MinCost}, password: "wrong", expectedStatus: http.StatusUnauthorized, expectedTag: passhash.Plain},
+		{name: "plain text", hasher: passhash.Hasher{BcryptCost: bcrypt.MinCost}, password: "12345", expectedStatus: http.StatusOK, expectedTag: passhash.Bcrypt},
+		{name: "same algorithm", hasher: passhash.Hasher{BcryptCost: bcrypt.MinCost}, password: "12345", expectedStatus: http.StatusOK, expectedTag: passhash.Bcrypt},
+		{name: "new algorithm", hasher: passhash.Hasher{Algorithm: passhash.Scrypt, Scrypt: passhash.ScryptParams{N: 1 << 4, R: 8, P: 1}}, password: "12345", expectedStatus: http.StatusOK, expectedTag: passhash.Scrypt},
+		{name: "argon2id", hasher: passhash.Hasher{Algorithm: passhash.Argon2id, Argon2: passhash.Argon2Params{Time: 1, Memory: 64, Threads: 1}}, password: "12345", expectedStatus: http.StatusOK, expectedTag: passhash.Argon2id},
+		{name: "pepper added", hasher: passhash.Hasher{Algorithm: passhash.Scrypt, Scrypt: passhash.ScryptParams{N: 1 << 4, R: 8, P: 1}, Pepper: []byte("pepper")}, password: "12345", expectedStatus: http.StatusOK, expectedTag: "scrypt+pepper"},
+		{name: "pepper removed", hasher: passhash.Hasher{BcryptCost: bcrypt.MinCost}, password: "12345", expectedStatus: http.StatusInternalServerError, expectedTag: "scrypt+pepper"},
+	}
+	for _, tt := range tests {
+		apiCfg.passwords = tt.hasher
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email": "test@example.com", "password": "`+tt.password+`"}`))
+		apiCfg.handlerLogin(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+		user, err = c.GetUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.PasswordAlgorithm != tt.expectedTag {
+			t.Errorf("%s: got tag %q, want %q", tt.name, user.PasswordAlgorithm, tt.expectedTag)
+		}
+		if tt.expectedTag != passhash.Plain && user.Password == "12345" {
+			t.Errorf("%s: password stored as plain text", tt.name)
+		}
+	}
+}
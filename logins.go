@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// loginNetwork returns the prefix of ip, a /24 for IPv4 and a /48 for
+// IPv6, as a rough location: logins from the same place usually share it.
+func loginNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// recordLogin adds a login with r to the user's history and alerts them of
+// logins from a device or network they never used before. Failures are
+// logged, they don't fail the login.
+func (apiCfg apiConfig) recordLogin(r *http.Request, user database.User, method string) {
+	history, err := apiCfg.dbClient.GetLoginEvents(user.ID)
+	if err != nil {
+		log.Printf("login history: %v", err)
+		return
+	}
+	event := database.LoginEvent{
+		UserID:  user.ID,
+		Method:  method,
+		IP:      clientIP(r),
+		Device:  r.UserAgent(),
+		Network: loginNetwork(clientIP(r)),
+	}
+	// the first login has nothing to compare with
+	if len(history) > 0 {
+		event.NewDevice, event.NewNetwork = true, true
+		for _, previous := range history {
+			if previous.Device == event.Device {
+				event.NewDevice = false
+			}
+			if previous.Network == event.Network {
+				event.NewNetwork = false
+			}
+		}
+	}
+	event, err = apiCfg.dbClient.CreateLoginEvent(event)
+	if err != nil {
+		log.Printf("login history: %v", err)
+		return
+	}
+	if (event.NewDevice || event.NewNetwork) && apiCfg.emailEnabled() {
+		_, err = apiCfg.sendEmail(user.Email, "new_login", map[string]interface{}{
+			"Name":      user.Name,
+			"NewDevice": event.NewDevice,
+			"Device":    event.Device,
+			"IP":        event.IP,
+			"Time":      event.CreatedAt.Format(time.RFC1123),
+		})
+		if err != nil {
+			log.Printf("new login alert: %v", err)
+		}
+	}
+}
+
+// handlerGetLogins lists the authenticated user's logins, newest first.
+// With ?alerts=true only logins from new devices or networks are listed,
+// for clients to show them in the app.
+func (apiCfg apiConfig) handlerGetLogins(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check page
+	pg, err := apiCfg.pagination.parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// collect logins
+	history, err := apiCfg.dbClient.GetLoginEvents(userID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if r.URL.Query().Get("alerts") == "true" {
+		alerts := []database.LoginEvent{}
+		for _, event := range history {
+			if event.NewDevice || event.NewNetwork {
+				alerts = append(alerts, event)
+			}
+		}
+		history = alerts
+	}
+	respondWithJSON(w, http.StatusOK, paginate(w, r, history, pg))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestLoginNetwork(t *testing.T) {
+	var tests = []struct {
+		ip       string
+		expected string
+	}{
+		{"192.0.2.17", "192.0.2.0/24"},
+		{"2001:db8:1234:5678::1", "2001:db8:1234::/48"},
+		{"not an address", "not an address"},
+	}
+	for _, tt := range tests {
+		if got := loginNetwork(tt.ip); got != tt.expected {
+			t.Errorf("loginNetwork(%q): got %q, want %q", tt.ip, got, tt.expected)
+		}
+	}
+}
+
+func TestLoginHistory(t *testing.T) {
+	c := database.NewMemoryClient()
+	_, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:   c,
+		auth:       testAuth,
+		pagination: paginationConfig{defaultLimit: 20, maxLimit: 100},
+	}
+
+	var tests = []struct {
+		device     string
+		addr       string
+		newDevice  bool
+		newNetwork bool
+	}{
+		// nothing to compare the first login with
+		{device: "laptop", addr: "192.0.2.1:1234"},
+		{device: "laptop", addr: "192.0.2.2:1234"},
+		{device: "phone", addr: "192.0.2.3:1234", newDevice: true},
+		{device: "phone", addr: "198.51.100.1:1234", newNetwork: true},
+		{device: "tablet", addr: "203.0.113.1:1234", newDevice: true, newNetwork: true},
+	}
+	var s session
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email": "test@example.com", "password": "12345"}`))
+		r.Header.Set("User-Agent", tt.device)
+		r.RemoteAddr = tt.addr
+		apiCfg.handlerLogin(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("login: got status %d: %s", w.Code, w.Body)
+		}
+		err := json.NewDecoder(w.Body).Decode(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(path string) []database.LoginEvent {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Authorization", "Bearer "+s.Token)
+		apiCfg.handlerGetLogins(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: got status %d: %s", path, w.Code, w.Body)
+		}
+		events := []database.LoginEvent{}
+		err := json.NewDecoder(w.Body).Decode(&events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+	events := list("/me/logins")
+	if len(events) != len(tests) {
+		t.Fatalf("got %d logins, want %d", len(events), len(tests))
+	}
+	for i, tt := range tests {
+		// newest first
+		event := events[len(events)-1-i]
+		if event.Device != tt.device || event.NewDevice != tt.newDevice || event.NewNetwork != tt.newNetwork {
+			t.Errorf("login %d: got %+v, want device %s, new device %v, new network %v", i, event, tt.device, tt.newDevice, tt.newNetwork)
+		}
+	}
+	if alerts := list("/me/logins?alerts=true"); len(alerts) != 3 {
+		t.Errorf("got %d alerts, want 3", len(alerts))
+	}
+}
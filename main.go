@@ -4,113 +4,166 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/firyx/boot.dev-api-backend/internal/audit"
+	"github.com/firyx/boot.dev-api-backend/internal/backup"
 	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/jobs"
+	"github.com/firyx/boot.dev-api-backend/internal/moderation"
+	"github.com/firyx/boot.dev-api-backend/internal/passhash"
+	"github.com/firyx/boot.dev-api-backend/internal/replication"
+	"github.com/firyx/boot.dev-api-backend/internal/rotate"
+	"github.com/firyx/boot.dev-api-backend/internal/router"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+	"github.com/firyx/boot.dev-api-backend/internal/translate"
 )
 
-type errorBody struct {
-	Error string `json:"error"`
-}
-
 type apiConfig struct {
-	dbClient database.Client
-	usersPrefix string
-	postsprefix string
+	dbClient     database.Client
+	usersPrefix  string
+	postsprefix  string
+	buildInfo    buildInfo
+	replication  *replication.Node
+	bundles      bundleConfig
+	media        mediaConfig
+	pagination   paginationConfig
+	analytics    *analyticsCache
+	leaderboards *leaderboards
+	search       *searchIndex
+	changes      *changeJournal
+	// syncConflicts resolves offline edits of posts changed meanwhile.
+	syncConflicts conflictStrategy
+	exists        *existenceFilter
+	// revocations is nil in tests, the database is read then.
+	revocations *revocationList
+	audit       *audit.Log
+	throttle    *costThrottle
+	auth        authConfig
+	totpIssuer  string
+	oauth       oauthConfig
+	tenants     *tenants
+	// tenantID is empty for the main database.
+	tenantID string
+	settings *tenantSettings
+	// breaches is nil when passwords aren't checked against data breaches.
+	breaches   service.BreachChecker
+	passwords  passhash.Hasher
+	postLimits service.PostLimits
+	jobs       *jobs.Queue
+	scheduler  *scheduler
+	mailer     *mailer
+	// translator is nil when translation is disabled.
+	translator *translate.Cache
+	// moderation is nil when new posts are only checked against the
+	// content policy.
+	moderation moderation.Filter
+	signup     signupConfig
+	backups    backup.Store
+	// deprecations counts calls to the unversioned routes.
+	deprecations *deprecationTracker
+	// rollouts hides the routes not fully launched from most users.
+	rollouts *rollouts
 }
 
-
-
 func main() {
-	c := database.NewClient("./db.json")
-	c.EnsureDB()
-
-	apiCfg := apiConfig{
-		dbClient: c,
-		usersPrefix: "/users",
-		postsprefix: "/posts",
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
+	logCloser, err := setupLogging(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logCloser.Close()
 
-	serveMux := http.NewServeMux()
-
-	serveMux.HandleFunc(apiCfg.usersPrefix, apiCfg.endpointUsersHandler)
-    serveMux.HandleFunc(apiCfg.usersPrefix + "/", apiCfg.endpointUsersHandler)
-    serveMux.HandleFunc(apiCfg.postsprefix, apiCfg.endpointPostsHandler)
-    serveMux.HandleFunc(apiCfg.postsprefix + "/", apiCfg.endpointPostsHandler)
-
-	const addr = "localhost:8080"
-	srv := http.Server{
-		Handler:      serveMux,
-		Addr:         addr,
-		WriteTimeout: 30 * time.Second,
-		ReadTimeout:  30 * time.Second,
+	err = runCLI(cfg, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
 	}
-	srv.ListenAndServe()
+}
+
+// setupLogging points the standard logger at stdout, a rotating log file, or
+// both. The returned closer flushes the log file on shutdown.
+func setupLogging(cfg config) (io.Closer, error) {
+	if cfg.logFile == "" {
+		if !cfg.logStdout {
+			return nil, errors.New("LOG_STDOUT can't be disabled without a LOG_FILE")
+		}
+		log.SetOutput(os.Stdout)
+		return io.NopCloser(nil), nil
+	}
+	file := rotate.NewWriter(cfg.logFile, rotate.Options{
+		MaxSize:    int64(cfg.logMaxSizeMB) * 1024 * 1024,
+		Interval:   cfg.logRotateInterval,
+		MaxBackups: cfg.logMaxBackups,
+		MaxAge:     cfg.logMaxAge,
+	})
+	if cfg.logStdout {
+		log.SetOutput(io.MultiWriter(os.Stdout, file))
+	} else {
+		log.SetOutput(file)
+	}
+	return file, nil
 }
 
 func (apiCfg apiConfig) endpointPostsHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		// call GET handler
-		apiCfg.handlerRetrievePosts(w,r)
-	case http.MethodPost:
-		// call POST handler
-		apiCfg.handlerCreatePost(w, r)
-	case http.MethodPut:
-		// call PUT handler
-	case http.MethodDelete:
-		// call DELETE handler
-		apiCfg.handlerDeletePost(w, r)
-	default:
-		respondWithError(w, 404, errors.New("method not supported"))
-	}
+	apiCfg.serveRoute(postsRoutes, apiCfg.postsprefix, w, r)
 }
 
 func (apiCfg apiConfig) endpointUsersHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		// call GET handler
-		apiCfg.handlerGetUser(w,r)
-	case http.MethodPost:
-		// call POST handler
-		apiCfg.handlerCreateUser(w, r)
-	case http.MethodPut:
-		// call PUT handler
-		apiCfg.handlerUpdateUser(w, r)
-	case http.MethodDelete:
-		// call DELETE handler
-		apiCfg.handlerDeleteUser(w, r)
-	default:
-		respondWithError(w, 404, errors.New("method not supported"))
-	}
+	apiCfg.serveRoute(usersRoutes, apiCfg.usersPrefix, w, r)
 }
 
 func (apiCfg apiConfig) handlerCreatePost(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
 	// get params
 	type parameters struct {
-		UserEmail string `json:"userEmail"`
-		Text      string `json:"text"`
+		UserID    string   `json:"userId"`
+		UserEmail string   `json:"userEmail"`
+		Text      string   `json:"text"`
+		Tags      []string `json:"tags"`
 	}
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
+	err = decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err)
 		return
 	}
-	
-	// check user exists
-	if !userExists(apiCfg, params.UserEmail) {
-		respondWithError(w, http.StatusBadRequest, errors.New("user with that email doesn't exist"))
+
+	// users post as themselves, naming the author is optional
+	if params.UserID != "" || params.UserEmail != "" {
+		author, err := apiCfg.users().Author(params.UserID, params.UserEmail)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		if author.ID != userID {
+			respondWithError(w, http.StatusForbidden, errNotPostAuthor)
+			return
+		}
+	}
+
+	// create post, or hold it for review
+	post, err := apiCfg.posts().Create(userID, "", params.Text, params.Tags)
+	pendingErr := service.PostPendingError{}
+	if errors.As(err, &pendingErr) {
+		respondWithJSON(w, http.StatusAccepted, pendingErr.Post)
 		return
 	}
-
-	// create post
-	post, err := apiCfg.dbClient.CreatePost(params.UserEmail, params.Text)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err)
+		respondWithServiceError(w, err)
 		return
 	}
 	respondWithJSON(w, http.StatusCreated, post)
@@ -119,49 +172,114 @@ func (apiCfg apiConfig) handlerCreatePost(w http.ResponseWriter, r *http.Request
 func (apiCfg apiConfig) handlerRetrievePosts(w http.ResponseWriter, r *http.Request) {
 	// get params
 	type parameters struct {
+		UserID    string `json:"userId"`
 		UserEmail string `json:"userEmail"`
 	}
+	tag := r.URL.Query().Get("tag")
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	err := decoder.Decode(&params)
+	// the body is optional when filtering every user's posts by tag
+	if err != nil && !(errors.Is(err, io.EOF) && tag != "") {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check page
+	pg, err := apiCfg.pagination.parsePage(r)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err)
 		return
 	}
-	
-	// check user exists
-	if !userExists(apiCfg, params.UserEmail) {
-		respondWithError(w, http.StatusBadRequest, errors.New("user with that email doesn't exist"))
+
+	// continue after a cursor, which keeps pages stable while posts are
+	// created
+	if cursor, ok := r.URL.Query()["cursor"]; ok {
+		after, err := parsePostCursor(cursor[0])
+		if err == nil && pg.offset > 0 {
+			err = validationFailed(errors.New("offset can't be used with cursor"))
+		}
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		posts, err := apiCfg.postsFor(r).Iterate(params.UserID, params.UserEmail, tag, after)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, paginatePosts(w, r, posts, pg.limit))
 		return
 	}
 
-	// return posts
-	posts, err := apiCfg.dbClient.GetPosts(params.UserEmail)
+	// collect posts, newest first
+	var posts []database.Post
+	if params.UserID == "" && params.UserEmail == "" && tag != "" {
+		posts, err = apiCfg.postsFor(r).All(tag)
+	} else {
+		posts, err = apiCfg.postsFor(r).ByAuthor(params.UserID, params.UserEmail, tag)
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err)
+		respondWithServiceError(w, err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, posts)
+	respondWithJSON(w, http.StatusOK, paginate(w, r, posts, pg))
 }
 
-func (apiCfg apiConfig) handlerDeletePost(w http.ResponseWriter, r *http.Request) {
+func (apiCfg apiConfig) handlerUpdatePost(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// get params
+	type parameters struct {
+		Text string   `json:"text"`
+		Tags []string `json:"tags"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// check path
 	id, err := getPostUuid(apiCfg, r)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, errors.New("bad request, correct format is: /users/{post-id}"))
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /posts/{post-id}"))
 		return
 	}
 
-	// check post exists
-	if !postExists(apiCfg, id) {
-		respondWithError(w, http.StatusBadRequest, errors.New("post with that id doesn't exist"))
+	// update post
+	post, err := apiCfg.posts().Update(id, userID, params.Text, params.Tags)
+	if err != nil {
+		respondWithServiceError(w, err)
 		return
 	}
+	respondWithJSON(w, http.StatusOK, post)
+}
 
-	// delete post
-	err = apiCfg.dbClient.DeletePost(id)
+func (apiCfg apiConfig) handlerDeletePost(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err)
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	id, err := getPostUuid(apiCfg, r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /posts/{post-id}"))
+		return
+	}
+
+	// delete post and its media
+	err = apiCfg.posts().Delete(id, userID)
+	if err != nil {
+		respondWithServiceError(w, err)
 		return
 	}
 	respondWithJSON(w, http.StatusOK, struct{}{})
@@ -173,107 +291,167 @@ func (apiCfg apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request
 		Email    string `json:"email"`
 		Password string `json:"password"`
 		Name     string `json:"name"`
+		Username string `json:"username"`
 		Age      int    `json:"age"`
+		database.Profile
+		// FormToken comes from GET /signup/form-token, to time the form.
+		FormToken string `json:"formToken"`
 	}
 	decoder := json.NewDecoder(r.Body)
+	body := json.RawMessage{}
+	err := decoder.Decode(&body)
 	params := parameters{}
-	err := decoder.Decode(&params)
+	fields := map[string]json.RawMessage{}
+	if err == nil {
+		err = json.Unmarshal(body, &params)
+	}
+	if err == nil {
+		// honeypot fields aren't parameters
+		err = json.Unmarshal(body, &fields)
+	}
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	// check user doesn't exist
-	if userExists(apiCfg, params.Email) {
-		respondWithError(w, http.StatusBadRequest, errors.New("user with that email already exists"))
+	// create user, unless they look like a bot
+	user, pending, err := apiCfg.signUp(r, fields, params.FormToken, params.Email, params.Password, params.Name, params.Username, params.Age, params.Profile)
+	if errors.Is(err, errSignupRejected) {
+		respondWithError(w, http.StatusForbidden, err)
 		return
 	}
-
-	// create user
-	user, err := apiCfg.dbClient.CreateUser(params.Email, params.Password, params.Name, params.Age)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err)
+		respondWithServiceError(w, err)
 		return
 	}
-	respondWithJSON(w, http.StatusCreated, user)
+	if pending {
+		respondWithJSON(w, http.StatusAccepted, userForViewer(user, user.ID))
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, userForViewer(user, user.ID))
 }
 
 func (apiCfg apiConfig) handlerGetUser(w http.ResponseWriter, r *http.Request) {
 	// check path
-	email, err := getUserEmail(apiCfg, r)
+	ref, err := getUserRef(apiCfg, r)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, errors.New("bad request, correct format is: /users/{email}"))
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}, /users/@{username} or /users/by-email/{email}"))
 		return
 	}
 
 	// check user exists
-	if !userExists(apiCfg, email) {
-		respondWithError(w, http.StatusBadRequest, errors.New("user with that email doesn't exist"))
+	user, err := apiCfg.users().Get(ref)
+	if err != nil {
+		respondWithServiceError(w, err)
 		return
 	}
 
-	// return user
-	user, err := apiCfg.dbClient.GetUser(email)
+	// return user with their streak, unless the client has them already
+	viewerID, _ := apiCfg.authenticatedUserID(r)
+	now := time.Now()
+	if notModified(w, r, userModified(user, now)) {
+		return
+	}
+	posts, err := apiCfg.dbClient.GetPosts(user.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err)
+		respondWithDBError(w, err)
+		return
 	}
-	respondWithJSON(w, http.StatusOK, user)
+	respondWithJSON(w, http.StatusOK, userProfile{
+		User:   userForViewer(user, viewerID),
+		Streak: computeStreak(posts, userLocation(user), now),
+	})
 }
 
 func (apiCfg apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
 	// get params
 	type parameters struct {
+		Email    string `json:"email"`
 		Password string `json:"password"`
 		Name     string `json:"name"`
+		Username string `json:"username"`
 		Age      int    `json:"age"`
+		database.Profile
 	}
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
+	err = decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err)
 		return
 	}
 	// check path
-	email, err := getUserEmail(apiCfg, r)
+	ref, err := getUserRef(apiCfg, r)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, errors.New("bad request, correct format is: /users/{email}"))
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}, /users/@{username} or /users/by-email/{email}"))
 		return
 	}
 
-	// check user exists
-	if !userExists(apiCfg, email) {
-		respondWithError(w, http.StatusBadRequest, errors.New("user with that email doesn't exist"))
+	// update user
+	user, err := apiCfg.users().Update(ref, userID, params.Email, params.Password, params.Name, params.Username, params.Age, params.Profile)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, userForViewer(user, userID))
+}
+
+// handlerPatchUser changes only the fields sent, unlike PUT.
+func (apiCfg apiConfig) handlerPatchUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// get params
+	decoder := json.NewDecoder(r.Body)
+	params := service.UserPatch{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}, /users/@{username} or /users/by-email/{email}"))
 		return
 	}
 
 	// update user
-	user, err := apiCfg.dbClient.UpdateUser(email, params.Password, params.Name, params.Age)
+	user, err := apiCfg.users().Patch(ref, userID, params)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err)
+		respondWithServiceError(w, err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, user)
+	respondWithJSON(w, http.StatusOK, userForViewer(user, userID))
 }
 
 func (apiCfg apiConfig) handlerDeleteUser(w http.ResponseWriter, r *http.Request) {
-	// check path
-	email, err := getUserEmail(apiCfg, r)
+	userID, err := apiCfg.authenticatedUserID(r)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, errors.New("bad request, correct format is: /users/{email}"))
+		respondWithError(w, http.StatusUnauthorized, err)
 		return
 	}
 
-	// check user exists
-	if !userExists(apiCfg, email) {
-		respondWithError(w, http.StatusBadRequest, errors.New("user with that email doesn't exist"))
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}, /users/@{username} or /users/by-email/{email}"))
 		return
 	}
 
 	// delete user
-	err = apiCfg.dbClient.DeleteUser(email)
+	err = apiCfg.users().Delete(ref, userID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err)
+		respondWithServiceError(w, err)
 		return
 	}
 	respondWithJSON(w, http.StatusOK, struct{}{})
@@ -282,29 +460,26 @@ func (apiCfg apiConfig) handlerDeleteUser(w http.ResponseWriter, r *http.Request
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	response, err := json.Marshal(payload)
+	if fw, ok := w.(*formatWriter); ok && err == nil {
+		response, err = fw.format(code, payload, response)
+	}
 	if err != nil {
 		code = http.StatusInternalServerError
-		response = []byte(fmt.Sprintf("{\"error\":\"%s\"}", "error marshalling to JSON" + err.Error()))
+		response = []byte(fmt.Sprintf("{\"error\":\"%s\"}", "error marshalling to JSON"+err.Error()))
 	}
 	w.WriteHeader(code)
-    w.Write(response)
+	w.Write(response)
 }
 
-func respondWithError(w http.ResponseWriter, code int, err error) {
-	errorBody := errorBody{
-		Error: err.Error(),
+func getUserRef(apiCfg apiConfig, r *http.Request) (string, error) {
+	if email := router.Param(r, "email"); email != "" {
+		return "by-email/" + email, nil
 	}
-	respondWithJSON(w, code, errorBody)
-}
-
-func getUserEmail(apiCfg apiConfig, r *http.Request) (string, error) {
-	prefix := apiCfg.usersPrefix + "/"
-	return trimPrefix(r.URL.Path, prefix, "not a valid URL: %s{email}")
+	return routeParam(r, "ref", "not a valid URL: %s/{id}", apiCfg.usersPrefix)
 }
 
 func getPostUuid(apiConfig apiConfig, r *http.Request) (string, error) {
-	prefix := apiConfig.postsprefix + "/"
-	return trimPrefix(r.URL.Path, prefix, "not a valid URL: %s{post-id}")
+	return routeParam(r, "id", "not a valid URL: %s/{post-id}", apiConfig.postsprefix)
 }
 
 func trimPrefix(str, prefix, errMsg string) (string, error) {
@@ -314,13 +489,3 @@ func trimPrefix(str, prefix, errMsg string) (string, error) {
 	}
 	return res, nil
 }
-
-func postExists(apiCfg apiConfig, id string) bool {
-	_, err := apiCfg.dbClient.GetPost(id)
-	return err == nil
-}
-
-func userExists(apiCfg apiConfig, email string) bool {
-	_, err := apiCfg.dbClient.GetUser(email)
-	return err == nil
-}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// dailyStats summarizes the activity in one database over the last day.
+type dailyStats struct {
+	Users    int
+	Posts    int
+	NewUsers int
+	NewPosts int
+}
+
+// compactDatabase drops orphaned records and rewrites the database file.
+func (apiCfg apiConfig) compactDatabase() error {
+	if !apiCfg.acceptsWrites() {
+		return nil
+	}
+	report, err := apiCfg.dbClient.Compact()
+	if err != nil {
+		return err
+	}
+	log.Printf("tenant=%q compacted database: %d orphan posts, %d orphan media, %d orphan badges, %d orphan revisions, %d -> %d bytes",
+		apiCfg.tenantID, report.OrphanPosts, report.OrphanMedia, report.OrphanBadges, report.OrphanRevisions, report.BytesBefore, report.BytesAfter)
+	return nil
+}
+
+// purgeLoginAttempts drops failed logins too old to count towards a lockout
+// and lockouts that ran out.
+func (apiCfg apiConfig) purgeLoginAttempts(now time.Time) error {
+	if !apiCfg.acceptsWrites() {
+		return nil
+	}
+	purged, err := apiCfg.dbClient.PurgeLoginAttempts(now.Add(-apiCfg.auth.failureWindow), now)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("tenant=%q purged %d expired login attempt records", apiCfg.tenantID, purged)
+	}
+	return nil
+}
+
+// purgeSessions drops expired sessions.
+func (apiCfg apiConfig) purgeSessions(now time.Time) error {
+	if !apiCfg.acceptsWrites() {
+		return nil
+	}
+	purged, err := apiCfg.dbClient.PurgeSessions(now)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("tenant=%q purged %d expired sessions", apiCfg.tenantID, purged)
+	}
+	return nil
+}
+
+// purgeEmailTokens drops expired email tokens.
+func (apiCfg apiConfig) purgeEmailTokens(now time.Time) error {
+	if !apiCfg.acceptsWrites() {
+		return nil
+	}
+	purged, err := apiCfg.dbClient.PurgeEmailTokens(now)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("tenant=%q purged %d expired email tokens", apiCfg.tenantID, purged)
+	}
+	return nil
+}
+
+// purgeRevokedTokens drops revoked tokens once they expired.
+func (apiCfg apiConfig) purgeRevokedTokens(now time.Time) error {
+	if !apiCfg.acceptsWrites() {
+		return nil
+	}
+	purged, err := apiCfg.dbClient.PurgeRevokedTokens(now)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("tenant=%q purged %d expired revoked tokens", apiCfg.tenantID, purged)
+	}
+	return nil
+}
+
+// purgeSuspensions lifts suspensions once they expired. They stop applying
+// at expiry anyway, this reinstates users in the admin listing.
+func (apiCfg apiConfig) purgeSuspensions(now time.Time) error {
+	if !apiCfg.acceptsWrites() {
+		return nil
+	}
+	purged, err := apiCfg.dbClient.PurgeSuspensions(now)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("tenant=%q lifted %d expired suspensions", apiCfg.tenantID, purged)
+	}
+	return nil
+}
+
+// acceptsWrites is false on a secondary, whose database only changes through
+// replication.
+func (apiCfg apiConfig) acceptsWrites() bool {
+	return apiCfg.replication == nil || apiCfg.replication.IsPrimary()
+}
+
+func (apiCfg apiConfig) computeDailyStats(now time.Time) (dailyStats, error) {
+	users, err := apiCfg.dbClient.GetAllUsers()
+	if err != nil {
+		return dailyStats{}, err
+	}
+	posts, err := apiCfg.dbClient.GetAllPosts()
+	if err != nil {
+		return dailyStats{}, err
+	}
+	since := now.Add(-24 * time.Hour)
+	stats := dailyStats{Users: len(users), Posts: len(posts)}
+	for _, user := range users {
+		if user.CreatedAt.After(since) {
+			stats.NewUsers++
+		}
+	}
+	for _, post := range posts {
+		if post.CreatedAt.After(since) {
+			stats.NewPosts++
+		}
+	}
+	return stats, nil
+}
+
+// logDailyStats emits the daily stats as a log line.
+func (apiCfg apiConfig) logDailyStats(now time.Time) error {
+	stats, err := apiCfg.computeDailyStats(now)
+	if err != nil {
+		return err
+	}
+	log.Printf("tenant=%q daily stats: users=%d (+%d) posts=%d (+%d)",
+		apiCfg.tenantID, stats.Users, stats.NewUsers, stats.Posts, stats.NewPosts)
+	return nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/router"
+	"github.com/firyx/boot.dev-api-backend/internal/storage"
+)
+
+// messagesRoutes are the routes below /messages.
+var messagesRoutes = newRoutes([]route{
+	{http.MethodGet, "", apiConfig.handlerGetConversation},
+	{http.MethodPost, "", apiConfig.handlerSendMessage},
+	{http.MethodGet, "/unread", apiConfig.handlerGetUnreadMessages},
+	{http.MethodPost, "/{id}/read", apiConfig.handlerReadMessage},
+	{http.MethodPost, "/{id}/attachments", apiConfig.handlerAttachFile},
+	{http.MethodGet, "/{id}/attachments/{media-id}", apiConfig.handlerGetAttachment},
+	{http.MethodGet, "/{id}/attachments/{media-id}/download", apiConfig.handlerDownloadAttachment},
+})
+
+var errInvalidDownloadToken = apiError{Code: codeInvalidToken, Message: "download link is invalid or expired"}
+
+// attachmentDownload is a link to download an attachment with until it
+// expires.
+type attachmentDownload struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (apiCfg apiConfig) endpointMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(messagesRoutes, "/messages", w, r)
+}
+
+// handlerSendMessage sends a message from the logged in user.
+func (apiCfg apiConfig) handlerSendMessage(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	if r.URL.Path != "/messages" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /messages"))
+		return
+	}
+
+	// get params
+	type parameters struct {
+		// Recipient is an email or a user ID
+		Recipient string `json:"recipient"`
+		Text      string `json:"text"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if params.Recipient == "" {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("recipient is required")))
+		return
+	}
+
+	// send message
+	message, err := apiCfg.users().SendMessage(userID, params.Recipient, params.Text)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, message)
+}
+
+// handlerGetConversation returns the messages between the logged in user
+// and the user of ?with=, oldest first.
+func (apiCfg apiConfig) handlerGetConversation(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	if r.URL.Path != "/messages" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /messages?with={email}"))
+		return
+	}
+
+	// get params
+	with := r.URL.Query().Get("with")
+	if with == "" {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("with is required")))
+		return
+	}
+	pg, err := apiCfg.pagination.parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// collect messages
+	messages, err := apiCfg.users().Conversation(userID, with)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, paginate(w, r, messages, pg))
+}
+
+// handlerGetUnreadMessages counts the messages the logged in user hasn't
+// read.
+func (apiCfg apiConfig) handlerGetUnreadMessages(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// count messages
+	unread, err := apiCfg.users().UnreadMessages(userID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, unread)
+}
+
+// handlerReadMessage is the read receipt of a message to the logged in
+// user, for it and the earlier ones from the same sender.
+func (apiCfg apiConfig) handlerReadMessage(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	rest, err := trimPrefix(r.URL.Path, "/messages/", "not a valid URL: %s{id}/read")
+	messageID := strings.TrimSuffix(rest, "/read")
+	if err != nil || messageID == "" || strings.Contains(messageID, "/") {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /messages/{id}/read"))
+		return
+	}
+
+	// mark read
+	message, err := apiCfg.users().ReadMessage(userID, messageID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, message)
+}
+
+// handlerAttachFile attaches a file of any type to a message sent by the
+// logged in user, as a multipart upload with the file in the "file" field.
+// Files past the room left in the quota of the conversation are rejected.
+func (apiCfg apiConfig) handlerAttachFile(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	messageID, err := routeParam(r, "id", "not a valid URL: %s/{id}/attachments", "/messages")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /messages/{id}/attachments"))
+		return
+	}
+
+	// check message is by the user logged in and its conversation has room
+	message, room, err := apiCfg.users().AttachmentRoom(userID, messageID, apiCfg.media.attachmentQuota)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// store file
+	upload, ok := apiCfg.storeUpload(w, r, min(room, apiCfg.media.maxSize), nil)
+	if !ok {
+		return
+	}
+
+	// record attachment
+	media, err := apiCfg.dbClient.AddAttachment(message.ID, upload)
+	if err != nil {
+		apiCfg.deleteMediaFile(upload.ID)
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, media)
+}
+
+// handlerGetAttachment hands the users of a conversation a link to download
+// a file attached to one of its messages. The link works without a session
+// until it expires, so it can be opened by a browser.
+func (apiCfg apiConfig) handlerGetAttachment(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	messageID := router.Param(r, "id")
+	mediaID := router.Param(r, "media-id")
+	if messageID == "" || mediaID == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /messages/{id}/attachments/{media-id}"))
+		return
+	}
+
+	// check user is in the conversation
+	media, err := apiCfg.users().Attachment(userID, messageID, mediaID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// sign link, object storage serves the file itself
+	now := time.Now().UTC()
+	download := attachmentDownload{ExpiresAt: now.Add(apiCfg.media.presignExpiry)}
+	if presigner, ok := apiCfg.media.store.(storage.Presigner); ok {
+		download.URL, err = presigner.PresignGet(media.ID, apiCfg.media.presignExpiry)
+	} else {
+		var token string
+		token, err = auth.Sign(apiCfg.attachmentSecret(), auth.NewClaims(attachmentSubject(messageID, media.ID), now, apiCfg.media.presignExpiry))
+		download.URL = "/messages/" + messageID + "/attachments/" + media.ID + "/download?token=" + url.QueryEscape(token)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, download)
+}
+
+// handlerDownloadAttachment serves a file attached to a message, given the
+// token of a link from handlerGetAttachment.
+func (apiCfg apiConfig) handlerDownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	// check path
+	messageID := router.Param(r, "id")
+	mediaID := router.Param(r, "media-id")
+	if messageID == "" || mediaID == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /messages/{id}/attachments/{media-id}/download?token={token}"))
+		return
+	}
+
+	// check the link was handed out for this attachment
+	claims, err := auth.Verify(apiCfg.attachmentSecret(), r.URL.Query().Get("token"), time.Now())
+	if err != nil || claims.Subject != attachmentSubject(messageID, mediaID) {
+		respondWithError(w, http.StatusForbidden, errInvalidDownloadToken)
+		return
+	}
+	media, err := apiCfg.dbClient.GetMedia(mediaID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	// serve file, as a download so it never runs in the API's origin
+	apiCfg.serveMediaFile(w, media, "attachment", "private, no-store")
+}
+
+// attachmentSecret signs attachment download tokens with a key of their
+// own, so they can't pass as session tokens.
+func (apiCfg apiConfig) attachmentSecret() []byte {
+	return append([]byte("message-attachment:"), apiCfg.auth.secret...)
+}
+
+func attachmentSubject(messageID, mediaID string) string {
+	return messageID + "/" + mediaID
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+	"github.com/firyx/boot.dev-api-backend/internal/storage"
+)
+
+func TestMessages(t *testing.T) {
+	c := database.NewMemoryClient()
+	for _, email := range []string{"ann@example.com", "bob@example.com", "eve@example.com"} {
+		_, err := c.CreateUser(email, "12345", "", 18)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		pagination:  paginationConfig{defaultLimit: 20, maxLimit: 100},
+		auth:        testAuth,
+	}
+	ann, bob, eve := mediaTestLogin(t, apiCfg, "ann@example.com"), mediaTestLogin(t, apiCfg, "bob@example.com"), mediaTestLogin(t, apiCfg, "eve@example.com")
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		apiCfg.endpointMessagesHandler(w, r)
+		return w
+	}
+
+	w := request(http.MethodPost, "/messages", ann, `{"recipient": "bob@example.com", "text": "hi"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("send: got status %d: %s", w.Code, w.Body)
+	}
+	message := database.Message{}
+	err := json.NewDecoder(w.Body).Decode(&message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request(http.MethodPost, "/messages", ann, `{"recipient": "bob@example.com", "text": "still there?"}`)
+
+	w = request(http.MethodGet, "/messages?with=ann@example.com", bob, "")
+	thread := []database.Message{}
+	err = json.NewDecoder(w.Body).Decode(&thread)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thread) != 2 || thread[0].ID != message.ID || w.Header().Get(totalCountHeader) != "2" {
+		t.Errorf("got thread %+v, want both messages oldest first", thread)
+	}
+	unread := func(token string) service.UnreadMessages {
+		w := request(http.MethodGet, "/messages/unread", token, "")
+		unread := service.UnreadMessages{}
+		err := json.NewDecoder(w.Body).Decode(&unread)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return unread
+	}
+	if got := unread(bob); got.Total != 2 || got.BySender[message.SenderID] != 2 {
+		t.Errorf("got unread %+v, want 2 from ann", got)
+	}
+
+	var tests = []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		code   int
+	}{
+		{name: "logged out", method: http.MethodPost, path: "/messages", body: `{"recipient": "bob@example.com", "text": "hi"}`, code: http.StatusUnauthorized},
+		{name: "no recipient", method: http.MethodPost, path: "/messages", token: ann, body: `{"text": "hi"}`, code: http.StatusBadRequest},
+		{name: "unknown recipient", method: http.MethodPost, path: "/messages", token: ann, body: `{"recipient": "nobody@example.com", "text": "hi"}`, code: http.StatusNotFound},
+		{name: "no with", method: http.MethodGet, path: "/messages", token: ann, code: http.StatusBadRequest},
+		{name: "sender reads", method: http.MethodPost, path: "/messages/" + message.ID + "/read", token: ann, code: http.StatusForbidden},
+		{name: "stranger reads", method: http.MethodPost, path: "/messages/" + message.ID + "/read", token: eve, code: http.StatusNotFound},
+		{name: "recipient reads", method: http.MethodPost, path: "/messages/" + message.ID + "/read", token: bob, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := request(tt.method, tt.path, tt.token, tt.body); w.Code != tt.code {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.code, w.Body)
+		}
+	}
+	if got := unread(bob); got.Total != 1 {
+		t.Errorf("got unread %+v, want the later message", got)
+	}
+}
+
+func TestMessageAttachments(t *testing.T) {
+	c := database.NewMemoryClient()
+	users := map[string]database.User{}
+	for _, email := range []string{"ann@example.com", "bob@example.com", "eve@example.com"} {
+		user, err := c.CreateUser(email, "12345", "", 18)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[email] = user
+	}
+	store, err := storage.NewLocalDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		pagination:  paginationConfig{defaultLimit: 20, maxLimit: 100},
+		media: mediaConfig{
+			store:           store,
+			maxSize:         64,
+			allowedTypes:    map[string]bool{"image/png": true},
+			presignExpiry:   time.Minute,
+			attachmentQuota: 100,
+		},
+		auth: testAuth,
+	}
+	ann, bob, eve := mediaTestLogin(t, apiCfg, "ann@example.com"), mediaTestLogin(t, apiCfg, "bob@example.com"), mediaTestLogin(t, apiCfg, "eve@example.com")
+	send := func(from, to database.User, text string) database.Message {
+		message, err := c.CreateMessage(from.ID, to.ID, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	toBob := send(users["ann@example.com"], users["bob@example.com"], "files")
+	toAnn := send(users["bob@example.com"], users["ann@example.com"], "thanks")
+	toEve := send(users["ann@example.com"], users["eve@example.com"], "files too")
+	attach := func(messageID, token string, size int) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		part, err := form.CreateFormFile("file", "notes.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(bytes.Repeat([]byte("a"), size))
+		form.Close()
+		r := httptest.NewRequest(http.MethodPost, "/messages/"+messageID+"/attachments", body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		apiCfg.endpointMessagesHandler(w, r)
+		return w
+	}
+
+	// files of any type can be attached, within the quota of each
+	// conversation
+	var uploads = []struct {
+		name      string
+		messageID string
+		token     string
+		size      int
+		code      int
+		errCode   errorCode
+	}{
+		{name: "logged out", messageID: toBob.ID, size: 10, code: http.StatusUnauthorized},
+		{name: "recipient", messageID: toBob.ID, token: bob, size: 10, code: http.StatusForbidden},
+		{name: "stranger", messageID: toBob.ID, token: eve, size: 10, code: http.StatusNotFound},
+		{name: "text", messageID: toBob.ID, token: ann, size: 40, code: http.StatusCreated},
+		{name: "over the size limit", messageID: toBob.ID, token: ann, size: 65, code: http.StatusRequestEntityTooLarge, errCode: codeMediaTooLarge},
+		{name: "more text", messageID: toBob.ID, token: ann, size: 40, code: http.StatusCreated},
+		{name: "past the room left", messageID: toBob.ID, token: ann, size: 40, code: http.StatusRequestEntityTooLarge, errCode: codeMediaTooLarge},
+		{name: "reply", messageID: toAnn.ID, token: bob, size: 20, code: http.StatusCreated},
+		{name: "conversation full", messageID: toAnn.ID, token: bob, size: 1, code: http.StatusRequestEntityTooLarge, errCode: codeAttachmentQuota},
+		{name: "other conversation", messageID: toEve.ID, token: ann, size: 40, code: http.StatusCreated},
+	}
+	for _, tt := range uploads {
+		w := attach(tt.messageID, tt.token, tt.size)
+		if w.Code != tt.code {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.code, w.Body)
+		}
+		if tt.errCode != "" {
+			body := errorBody{}
+			json.NewDecoder(w.Body).Decode(&body)
+			if body.Code != tt.errCode {
+				t.Errorf("%s: got code %s, want %s", tt.name, body.Code, tt.errCode)
+			}
+		}
+	}
+
+	// attachments show in the conversation, only to its users
+	thread, err := c.GetConversation(users["ann@example.com"].ID, users["bob@example.com"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thread) != 2 || len(thread[0].Attachments) != 2 || len(thread[1].Attachments) != 1 {
+		t.Fatalf("got thread %+v, want 2 attachments to ann's message and 1 to bob's", thread)
+	}
+	mediaID := thread[0].Attachments[0]
+	w := httptest.NewRecorder()
+	apiCfg.endpointMediaHandler(w, httptest.NewRequest(http.MethodGet, "/media/"+mediaID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("public media URL: got status %d, want 404", w.Code)
+	}
+	link := func(messageID, mediaID, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/messages/"+messageID+"/attachments/"+mediaID, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		apiCfg.endpointMessagesHandler(w, r)
+		return w
+	}
+	if w := link(toBob.ID, mediaID, eve); w.Code != http.StatusNotFound {
+		t.Errorf("stranger's link: got status %d, want 404", w.Code)
+	}
+	if w := link(toAnn.ID, mediaID, bob); w.Code != http.StatusNotFound {
+		t.Errorf("link through another message: got status %d, want 404", w.Code)
+	}
+	w = link(toBob.ID, mediaID, bob)
+	download := attachmentDownload{}
+	err = json.NewDecoder(w.Body).Decode(&download)
+	if err != nil || w.Code != http.StatusOK {
+		t.Fatalf("recipient's link: got status %d, %v", w.Code, err)
+	}
+
+	// links download the file without a session until they expire
+	expired, err := auth.Sign(apiCfg.attachmentSecret(), auth.NewClaims(attachmentSubject(toBob.ID, mediaID), time.Now().Add(-time.Hour), time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := strings.TrimPrefix(download.URL, "/messages/"+toBob.ID+"/attachments/"+mediaID+"/download?token=")
+	var downloads = []struct {
+		name string
+		path string
+		code int
+	}{
+		{name: "link", path: download.URL, code: http.StatusOK},
+		{name: "other attachment", path: "/messages/" + toBob.ID + "/attachments/" + thread[0].Attachments[1] + "/download?token=" + token, code: http.StatusForbidden},
+		{name: "expired", path: "/messages/" + toBob.ID + "/attachments/" + mediaID + "/download?token=" + expired, code: http.StatusForbidden},
+		{name: "session token", path: "/messages/" + toBob.ID + "/attachments/" + mediaID + "/download?token=" + bob, code: http.StatusForbidden},
+	}
+	for _, tt := range downloads {
+		w := httptest.NewRecorder()
+		apiCfg.endpointMessagesHandler(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.code, w.Body)
+		}
+		if tt.code == http.StatusOK && (w.Body.Len() != 40 || !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment;")) {
+			t.Errorf("%s: got %d bytes served as %q, want the file as a download", tt.name, w.Body.Len(), w.Header().Get("Content-Disposition"))
+		}
+	}
+
+	// blocking stops new attachments like new messages
+	_, err = c.BlockUser(users["eve@example.com"].ID, users["ann@example.com"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := attach(toEve.ID, ann, 10); w.Code != http.StatusForbidden {
+		t.Errorf("blocked: got status %d, want 403: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// requestMetrics counts requests by method and status for GET /metrics, in
+// the Prometheus text format.
+type requestMetrics struct {
+	start time.Time
+
+	mu       sync.Mutex
+	requests map[requestMetricKey]*requestMetric
+	panics   int64
+}
+
+type requestMetricKey struct {
+	method string
+	status int
+}
+
+type requestMetric struct {
+	count   int64
+	seconds float64
+}
+
+func newRequestMetrics() *requestMetrics {
+	return &requestMetrics{
+		start:    time.Now(),
+		requests: map[requestMetricKey]*requestMetric{},
+	}
+}
+
+func (m *requestMetrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+		m.observe(r.Method, recorder.status, time.Since(start))
+	})
+}
+
+func (m *requestMetrics) observe(method string, status int, duration time.Duration) {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		// clients choose the method, keep the number of series bounded
+		method = "OTHER"
+	}
+	key := requestMetricKey{method: method, status: status}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metric, ok := m.requests[key]
+	if !ok {
+		metric = &requestMetric{}
+		m.requests[key] = metric
+	}
+	metric.count++
+	metric.seconds += duration.Seconds()
+}
+
+// observePanic counts a panic recovered while serving a request.
+func (m *requestMetrics) observePanic() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.panics++
+}
+
+// metricsSnapshot is the value of every metric at a point in time.
+type metricsSnapshot struct {
+	Time           time.Time      `json:"time"`
+	UptimeSeconds  float64        `json:"uptimeSeconds"`
+	Goroutines     int            `json:"goroutines"`
+	HeapAllocBytes uint64         `json:"heapAllocBytes"`
+	Requests       []requestCount `json:"requests"`
+	// Panics counts the panics recovered while serving requests.
+	Panics int64 `json:"panics"`
+}
+
+// requestCount is the requests served with a method and status so far.
+type requestCount struct {
+	Method  string  `json:"method"`
+	Status  int     `json:"status"`
+	Count   int64   `json:"count"`
+	Seconds float64 `json:"seconds"`
+}
+
+func (m *requestMetrics) snapshot(now time.Time) metricsSnapshot {
+	m.mu.Lock()
+	requests := make([]requestCount, 0, len(m.requests))
+	for key, metric := range m.requests {
+		requests = append(requests, requestCount{Method: key.method, Status: key.status, Count: metric.count, Seconds: metric.seconds})
+	}
+	panics := m.panics
+	m.mu.Unlock()
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].Method != requests[j].Method {
+			return requests[i].Method < requests[j].Method
+		}
+		return requests[i].Status < requests[j].Status
+	})
+	mem := runtime.MemStats{}
+	runtime.ReadMemStats(&mem)
+	return metricsSnapshot{
+		Time:           now.UTC(),
+		UptimeSeconds:  now.Sub(m.start).Seconds(),
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: mem.HeapAlloc,
+		Requests:       requests,
+		Panics:         panics,
+	}
+}
+
+func (m *requestMetrics) handlerMetrics(w http.ResponseWriter, r *http.Request) {
+	snapshot := m.snapshot(time.Now())
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "# HELP http_requests_total Requests served, by method and status.")
+	fmt.Fprintln(w, "# TYPE http_requests_total counter")
+	for _, request := range snapshot.Requests {
+		fmt.Fprintf(w, "http_requests_total{method=%q,status=\"%d\"} %d\n", request.Method, request.Status, request.Count)
+	}
+	fmt.Fprintln(w, "# HELP http_request_duration_seconds_total Time spent serving requests, by method and status.")
+	fmt.Fprintln(w, "# TYPE http_request_duration_seconds_total counter")
+	for _, request := range snapshot.Requests {
+		fmt.Fprintf(w, "http_request_duration_seconds_total{method=%q,status=\"%d\"} %g\n", request.Method, request.Status, request.Seconds)
+	}
+	fmt.Fprintln(w, "# HELP http_panics_total Panics recovered while serving requests.")
+	fmt.Fprintln(w, "# TYPE http_panics_total counter")
+	fmt.Fprintf(w, "http_panics_total %d\n", snapshot.Panics)
+	fmt.Fprintln(w, "# HELP go_goroutines Number of goroutines.")
+	fmt.Fprintln(w, "# TYPE go_goroutines gauge")
+	fmt.Fprintf(w, "go_goroutines %d\n", snapshot.Goroutines)
+	fmt.Fprintln(w, "# HELP go_memstats_heap_alloc_bytes Bytes of allocated heap objects.")
+	fmt.Fprintln(w, "# TYPE go_memstats_heap_alloc_bytes gauge")
+	fmt.Fprintf(w, "go_memstats_heap_alloc_bytes %d\n", snapshot.HeapAllocBytes)
+	fmt.Fprintln(w, "# HELP process_uptime_seconds Time since the server started.")
+	fmt.Fprintln(w, "# TYPE process_uptime_seconds gauge")
+	fmt.Fprintf(w, "process_uptime_seconds %g\n", snapshot.UptimeSeconds)
+}
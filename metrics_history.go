@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// metricsHistory keeps the latest metrics snapshots for deployments
+// without Prometheus, and appends each one as a JSON line to out.
+type metricsHistory struct {
+	size int
+	// out is nil when snapshots are only kept in memory.
+	out io.Writer
+
+	mu sync.Mutex
+	// snapshots are oldest first.
+	snapshots []metricsSnapshot
+}
+
+func newMetricsHistory(size int, out io.Writer) *metricsHistory {
+	return &metricsHistory{size: size, out: out}
+}
+
+// record keeps snapshot, dropping the oldest one past the history size,
+// and writes it out.
+func (h *metricsHistory) record(snapshot metricsSnapshot) error {
+	line, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshots = append(h.snapshots, snapshot)
+	if len(h.snapshots) > h.size {
+		h.snapshots = append([]metricsSnapshot{}, h.snapshots[len(h.snapshots)-h.size:]...)
+	}
+	if h.out == nil {
+		return nil
+	}
+	// a single write, so the file rotates between lines
+	_, err = h.out.Write(append(line, '\n'))
+	return err
+}
+
+// last returns the latest n snapshots, oldest first.
+func (h *metricsHistory) last(n int) []metricsSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n > len(h.snapshots) {
+		n = len(h.snapshots)
+	}
+	return append([]metricsSnapshot{}, h.snapshots[len(h.snapshots)-n:]...)
+}
+
+// handlerMetricsHistory returns the latest snapshots, oldest first. The
+// limit query parameter picks how many, every kept snapshot by default.
+func (h *metricsHistory) handlerMetricsHistory(w http.ResponseWriter, r *http.Request) {
+	// get params
+	n := h.size
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("limit must be a positive integer")))
+			return
+		}
+		if limit > h.size {
+			respondWithError(w, http.StatusBadRequest, validationFailed(fmt.Errorf("limit can't be more than the %d snapshots kept", h.size)))
+			return
+		}
+		n = limit
+	}
+
+	respondWithJSON(w, http.StatusOK, h.last(n))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	metrics := newRequestMetrics()
+	handler := metrics.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/users", nil),
+		httptest.NewRequest(http.MethodGet, "/users", nil),
+		httptest.NewRequest(http.MethodGet, "/missing", nil),
+		httptest.NewRequest("BREW", "/users", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	metrics.handlerMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var tests = []string{
+		`http_requests_total{method="GET",status="200"} 2`,
+		`http_requests_total{method="GET",status="404"} 1`,
+		`http_requests_total{method="OTHER",status="200"} 1`,
+	}
+	for _, line := range tests {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("got metrics without %q:\n%s", line, w.Body)
+		}
+	}
+}
+
+func TestMetricsHistory(t *testing.T) {
+	metrics := newRequestMetrics()
+	out := &bytes.Buffer{}
+	history := newMetricsHistory(2, out)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		metrics.observe(http.MethodGet, http.StatusOK, time.Millisecond)
+		err := history.record(metrics.snapshot(start.Add(time.Duration(i) * time.Minute)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d snapshot lines, want 3:\n%s", len(lines), out)
+	}
+
+	var tests = []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCounts []int64
+	}{
+		{name: "every kept snapshot", expectedStatus: 200, expectedCounts: []int64{2, 3}},
+		{name: "latest", query: "?limit=1", expectedStatus: 200, expectedCounts: []int64{3}},
+		{name: "more than kept", query: "?limit=3", expectedStatus: 400},
+		{name: "invalid limit", query: "?limit=0", expectedStatus: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			history.handlerMetricsHistory(w, httptest.NewRequest(http.MethodGet, "/admin/metrics/history"+tt.query, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.expectedStatus, w.Body)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			snapshots := []metricsSnapshot{}
+			err := json.NewDecoder(w.Body).Decode(&snapshots)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts := []int64{}
+			for _, snapshot := range snapshots {
+				counts = append(counts, snapshot.Requests[0].Count)
+			}
+			if fmt.Sprint(counts) != fmt.Sprint(tt.expectedCounts) {
+				t.Errorf("got request counts %v, want %v", counts, tt.expectedCounts)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/firyx/boot.dev-api-backend/internal/moderation"
+)
+
+// newModeration builds the moderation pipeline of cfg: the word lists,
+// then the external API. It returns nil when none is configured.
+func newModeration(cfg config) (moderation.Filter, error) {
+	pipeline := moderation.Pipeline{}
+	words := moderation.Wordlist{}
+	for _, list := range []struct {
+		key   string
+		path  string
+		words *map[string]bool
+	}{
+		{key: "MODERATION_REJECT_WORDS", path: cfg.moderationRejectWords, words: &words.Reject},
+		{key: "MODERATION_FLAG_WORDS", path: cfg.moderationFlagWords, words: &words.Flag},
+	} {
+		if list.path == "" {
+			continue
+		}
+		f, err := os.Open(list.path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", list.key, err)
+		}
+		*list.words, err = moderation.ReadWords(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", list.key, err)
+		}
+	}
+	if len(words.Reject) > 0 || len(words.Flag) > 0 {
+		pipeline = append(pipeline, words)
+	}
+	if cfg.moderationAPIURL != "" {
+		pipeline = append(pipeline, moderation.API{
+			URL:    cfg.moderationAPIURL,
+			APIKey: cfg.moderationAPIKey,
+			Client: &http.Client{Timeout: cfg.moderationAPITimeout},
+		})
+	}
+	if len(pipeline) == 0 {
+		return nil, nil
+	}
+	return pipeline, nil
+}
+
+// adminModerationRoutes are the routes below /admin/moderation.
+var adminModerationRoutes = newRoutes([]route{
+	{http.MethodGet, "", apiConfig.handlerAdminPendingPosts},
+	{http.MethodPost, "/{id}/approve", apiConfig.handlerAdminApprovePost},
+	{http.MethodPost, "/{id}/reject", apiConfig.handlerAdminRejectPost},
+})
+
+func (apiCfg apiConfig) endpointAdminModerationHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(adminModerationRoutes, "/admin/moderation", w, r)
+}
+
+// handlerAdminPendingPosts lists the posts moderation held for review,
+// oldest first.
+func (apiCfg apiConfig) handlerAdminPendingPosts(w http.ResponseWriter, r *http.Request) {
+	posts, err := apiCfg.dbClient.GetPendingPosts()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, posts)
+}
+
+// pendingPostID returns the post ID of an /admin/moderation/{id}/{action}
+// path.
+func pendingPostID(path, action string) (string, error) {
+	id, err := trimPrefix(path, "/admin/moderation/", "not a valid URL: %s{id}/"+action)
+	id = strings.TrimSuffix(id, "/"+action)
+	if err != nil || id == "" || strings.Contains(id, "/") {
+		return "", invalidPath("bad request, correct format is: /admin/moderation/{id}/" + action)
+	}
+	return id, nil
+}
+
+// handlerAdminApprovePost publishes a post held for review.
+func (apiCfg apiConfig) handlerAdminApprovePost(w http.ResponseWriter, r *http.Request) {
+	// check path
+	id, err := pendingPostID(r.URL.Path, "approve")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// approve post
+	post, err := apiCfg.dbClient.ApprovePendingPost(id)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, post)
+}
+
+// handlerAdminRejectPost drops a post held for review.
+func (apiCfg apiConfig) handlerAdminRejectPost(w http.ResponseWriter, r *http.Request) {
+	// check path
+	id, err := pendingPostID(r.URL.Path, "reject")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// reject post
+	err = apiCfg.dbClient.DeletePendingPost(id)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
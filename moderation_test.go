@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/moderation"
+)
+
+func TestModeration(t *testing.T) {
+	c := database.NewMemoryClient()
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		postsprefix: "/posts",
+		moderation: moderation.Wordlist{
+			Reject: map[string]bool{"casino": true},
+			Flag:   map[string]bool{"crypto": true},
+		},
+		auth: authConfig{secret: []byte("secret")},
+	}
+	token, err := auth.Sign(apiCfg.auth.secret, auth.NewClaims(user.ID, time.Now(), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	createPost := func(text string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		body := `{"userId": "` + user.ID + `", "text": "` + text + `"}`
+		r := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		apiCfg.endpointPostsHandler(w, r)
+		return w
+	}
+	admin := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		apiCfg.endpointAdminModerationHandler(w, r)
+		return w
+	}
+
+	if w := createPost("hello"); w.Code != http.StatusCreated {
+		t.Errorf("allowed post: got status %d: %s", w.Code, w.Body)
+	}
+	w := createPost("online casino")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), string(codePostRejected)) {
+		t.Errorf("rejected post: got status %d: %s", w.Code, w.Body)
+	}
+
+	// flagged posts wait for an admin
+	held := []database.PendingPost{}
+	for _, text := range []string{"buy crypto", "sell crypto"} {
+		w := createPost(text)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("flagged post: got status %d: %s", w.Code, w.Body)
+		}
+		post := database.PendingPost{}
+		err := json.NewDecoder(w.Body).Decode(&post)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, post)
+	}
+	w = admin(http.MethodGet, "/admin/moderation")
+	pending := []database.PendingPost{}
+	err = json.NewDecoder(w.Body).Decode(&pending)
+	if err != nil || len(pending) != 2 || pending[0].ID != held[0].ID || pending[0].Reason != `contains "crypto"` {
+		t.Fatalf("pending posts: got %+v, %v", pending, err)
+	}
+
+	var tests = []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{name: "approve", method: http.MethodPost, path: "/admin/moderation/" + held[0].ID + "/approve", expectedStatus: 201},
+		{name: "approve again", method: http.MethodPost, path: "/admin/moderation/" + held[0].ID + "/approve", expectedStatus: 404},
+		{name: "reject", method: http.MethodPost, path: "/admin/moderation/" + held[1].ID + "/reject", expectedStatus: 200},
+		{name: "reject missing post", method: http.MethodPost, path: "/admin/moderation/nope/reject", expectedStatus: 404},
+		{name: "bad path", method: http.MethodPost, path: "/admin/moderation//approve", expectedStatus: 404},
+		{name: "wrong method", method: http.MethodGet, path: "/admin/moderation/" + held[1].ID + "/approve", expectedStatus: 405},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := admin(tt.method, tt.path)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.expectedStatus, w.Body)
+			}
+		})
+	}
+
+	posts, err := c.GetPosts(user.ID)
+	if err != nil || len(posts) != 2 {
+		t.Errorf("got posts %v, %v, want the allowed and approved ones", posts, err)
+	}
+	pending, err = c.GetPendingPosts()
+	if err != nil || len(pending) != 0 {
+		t.Errorf("got pending posts %v, %v, want none", pending, err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/events"
+)
+
+// Types of notifications.
+const (
+	notifyFollower       = "follower"
+	notifyFollowRequest  = "follow-request"
+	notifyFollowAccepted = "follow-accepted"
+	notifyMention        = "mention"
+	notifyMessage        = "message"
+)
+
+// subscribeNotifications notifies users of follows, mentions and messages
+// as they're written.
+func (apiCfg apiConfig) subscribeNotifications(bus *events.Bus) {
+	bus.Subscribe(eventFollowCreated, func(event events.Event) {
+		follow := event.Data.(database.Follow)
+		notificationType := notifyFollower
+		if follow.Status == database.FollowPending {
+			notificationType = notifyFollowRequest
+		}
+		apiCfg.notify(database.Notification{UserID: follow.FolloweeID, Type: notificationType, ActorID: follow.FollowerID})
+	})
+	bus.Subscribe(eventFollowUpdated, func(event events.Event) {
+		follow := event.Data.(database.Follow)
+		if follow.Status == database.FollowApproved {
+			apiCfg.notify(database.Notification{UserID: follow.FollowerID, Type: notifyFollowAccepted, ActorID: follow.FolloweeID})
+		}
+	})
+	bus.Subscribe(eventPostCreated, func(event events.Event) {
+		post := event.Data.(database.Post)
+		for _, userID := range post.Mentions {
+			if userID == post.UserID {
+				continue
+			}
+			// users who can't see the post don't learn of it
+			_, err := apiCfg.posts().ForViewer(userID).Get(post.ID)
+			if err != nil {
+				continue
+			}
+			apiCfg.notify(database.Notification{UserID: userID, Type: notifyMention, ActorID: post.UserID, SubjectID: post.ID})
+		}
+	})
+	bus.Subscribe(eventMessageCreated, func(event events.Event) {
+		message := event.Data.(database.Message)
+		apiCfg.notify(database.Notification{UserID: message.RecipientID, Type: notifyMessage, ActorID: message.SenderID, SubjectID: message.ID})
+	})
+}
+
+func (apiCfg apiConfig) notify(notification database.Notification) {
+	_, err := apiCfg.dbClient.CreateNotification(notification)
+	if err != nil {
+		log.Printf("notifications: %v", err)
+	}
+}
+
+// notificationsRoutes are the routes below /notifications.
+var notificationsRoutes = newRoutes([]route{
+	{http.MethodGet, "", apiConfig.handlerGetNotifications},
+	{http.MethodPost, "/read", apiConfig.handlerReadNotifications},
+})
+
+func (apiCfg apiConfig) endpointNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(notificationsRoutes, "/notifications", w, r)
+}
+
+// handlerGetNotifications returns the notifications of the logged in user,
+// newest first, or only the unread ones with ?unread=true.
+func (apiCfg apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check page
+	pg, err := apiCfg.pagination.parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// collect notifications
+	notifications, err := apiCfg.dbClient.GetNotifications(userID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if r.URL.Query().Get("unread") == "true" {
+		unread := []database.Notification{}
+		for _, notification := range notifications {
+			if notification.ReadAt == nil {
+				unread = append(unread, notification)
+			}
+		}
+		notifications = unread
+	}
+	respondWithJSON(w, http.StatusOK, paginate(w, r, notifications, pg))
+}
+
+// handlerReadNotifications marks notifications of the logged in user as
+// read, all of them without ids.
+func (apiCfg apiConfig) handlerReadNotifications(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// get params
+	type parameters struct {
+		IDs []string `json:"ids"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	// the body is optional
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// mark read
+	read, err := apiCfg.dbClient.ReadNotifications(userID, params.IDs, time.Now().UTC())
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]int{"read": read})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/events"
+)
+
+func TestNotifications(t *testing.T) {
+	bus := events.NewBus()
+	c := database.NewMemoryClient().WithCommitHook(publishMutations(bus))
+	apiCfg := apiConfig{
+		dbClient:   c,
+		pagination: paginationConfig{defaultLimit: 20, maxLimit: 100},
+		auth:       testAuth,
+	}
+	apiCfg.subscribeNotifications(bus)
+	ann, err := c.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := c.CreateUser("bob@example.com", "12345", "Bob", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eve, err := c.CreateUser("eve@example.com", "12345", "Eve", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.SetUserPrivate(eve.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// everything ann hears about
+	_, err = apiCfg.users().Follow(bob.ID, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := apiCfg.posts().Create(bob.ID, "", "hi @ann@example.com and @bob@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := apiCfg.users().SendMessage(bob.ID, ann.ID, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = apiCfg.users().Follow(ann.ID, eve.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = apiCfg.users().AcceptFollower(eve.ID, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// eve's posts are hidden from bob, so he isn't told of mentions in them
+	_, err = apiCfg.posts().Create(eve.ID, "", "hi @bob@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := mediaTestLogin(t, apiCfg, "ann@example.com")
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		apiCfg.endpointNotificationsHandler(w, r)
+		return w
+	}
+	list := func(path string) []database.Notification {
+		w := request(http.MethodGet, path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", w.Code, w.Body)
+		}
+		notifications := []database.Notification{}
+		err := json.NewDecoder(w.Body).Decode(&notifications)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return notifications
+	}
+
+	notifications := list("/notifications")
+	expected := []database.Notification{
+		{UserID: ann.ID, Type: notifyFollowAccepted, ActorID: eve.ID},
+		{UserID: ann.ID, Type: notifyMessage, ActorID: bob.ID, SubjectID: message.ID},
+		{UserID: ann.ID, Type: notifyMention, ActorID: bob.ID, SubjectID: post.ID},
+		{UserID: ann.ID, Type: notifyFollower, ActorID: bob.ID},
+	}
+	if len(notifications) != len(expected) {
+		t.Fatalf("got %+v, want %d notifications", notifications, len(expected))
+	}
+	for i, notification := range notifications {
+		notification.ID, notification.CreatedAt = "", time.Time{}
+		if notification != expected[i] {
+			t.Errorf("notification %d: got %+v, want %+v", i, notification, expected[i])
+		}
+	}
+	for _, id := range []string{bob.ID, eve.ID} {
+		got, err := c.GetNotifications(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id == bob.ID && len(got) != 0 {
+			t.Errorf("bob got %+v, want no notifications", got)
+		}
+		if id == eve.ID && (len(got) != 1 || got[0].Type != notifyFollowRequest) {
+			t.Errorf("eve got %+v, want ann's follow request", got)
+		}
+	}
+
+	// read one, then the rest
+	w := request(http.MethodPost, "/notifications/read", `{"ids": ["`+notifications[0].ID+`", "unknown"]}`)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"read":1}` {
+		t.Errorf("got %d %s, want 1 read", w.Code, w.Body)
+	}
+	if unread := list("/notifications?unread=true"); len(unread) != 3 {
+		t.Errorf("got %d unread, want 3", len(unread))
+	}
+	w = request(http.MethodPost, "/notifications/read", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"read":3}` {
+		t.Errorf("got %d %s, want 3 read", w.Code, w.Body)
+	}
+	if unread := list("/notifications?unread=true"); len(unread) != 0 {
+		t.Errorf("got %d unread, want none", len(unread))
+	}
+}
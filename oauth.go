@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/oauth"
+	"github.com/firyx/boot.dev-api-backend/internal/router"
+)
+
+// oauthStateCookie holds the state sent to the provider, so the callback
+// can tell it's finishing a login this browser started. oauthSignupCookie
+// holds the age and form token the login was started with, for signing up
+// users logging in for the first time.
+const (
+	oauthStateCookie  = "oauth_state"
+	oauthSignupCookie = "oauth_signup"
+)
+
+// oauthLoginSubject prefixes the subject of login tokens, which users with
+// two-factor authentication send to POST /login with their second factor
+// to finish a provider login. They're valid for oauthLoginTokenTTL.
+const (
+	oauthLoginSubject  = "oauth-login"
+	oauthLoginTokenTTL = 5 * time.Minute
+)
+
+// oauthPendingLogin is the detail of the error answering a provider login
+// that needs a second factor.
+type oauthPendingLogin struct {
+	LoginToken string    `json:"loginToken"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// oauthConfig holds the configured providers by name. Providers send users
+// back to redirectBaseURL + /auth/{provider}/callback.
+type oauthConfig struct {
+	providers       map[string]*oauth.Provider
+	redirectBaseURL string
+}
+
+var (
+	errUnknownProvider = apiError{Code: codeNotFound, Message: "login provider doesn't exist or isn't configured"}
+	errOAuthState      = apiError{Code: codeUnauthorized, Message: "login state doesn't match, start the login again"}
+	errNoVerifiedEmail = apiError{Code: codeValidationFailed, Message: "the provider account has no verified email"}
+)
+
+// newOAuthConfig sets up the providers with a client ID configured.
+func newOAuthConfig(cfg config) oauthConfig {
+	providers := map[string]*oauth.Provider{}
+	if cfg.oauthGoogleClientID != "" {
+		providers["google"] = oauth.Google(cfg.oauthGoogleClientID, cfg.oauthGoogleClientSecret)
+	}
+	if cfg.oauthGitHubClientID != "" {
+		providers["github"] = oauth.GitHub(cfg.oauthGitHubClientID, cfg.oauthGitHubClientSecret)
+	}
+	redirectBaseURL := cfg.oauthRedirectBaseURL
+	if redirectBaseURL == "" {
+		redirectBaseURL = "http://" + cfg.addr
+	}
+	return oauthConfig{providers: providers, redirectBaseURL: redirectBaseURL}
+}
+
+func (o oauthConfig) redirectURL(provider string) string {
+	return o.redirectBaseURL + "/auth/" + provider + "/callback"
+}
+
+// oauthLoginSecret signs login tokens with a key of their own, so they
+// can't pass as session tokens.
+func (apiCfg apiConfig) oauthLoginSecret() []byte {
+	return append([]byte(oauthLoginSubject+":"), apiCfg.auth.secret...)
+}
+
+// oauthPendingUser returns the user a login token was issued to, and the
+// provider they logged in with.
+func (apiCfg apiConfig) oauthPendingUser(loginToken string, now time.Time) (database.User, string, error) {
+	claims, err := auth.Verify(apiCfg.oauthLoginSecret(), loginToken, now)
+	if err != nil {
+		return database.User{}, "", err
+	}
+	provider, userID, ok := strings.Cut(strings.TrimPrefix(claims.Subject, oauthLoginSubject+":"), ":")
+	if !ok {
+		return database.User{}, "", errUnauthorized
+	}
+	user, err := apiCfg.dbClient.GetUser(userID)
+	return user, provider, err
+}
+
+// oauthRoutes are the routes below /auth.
+var oauthRoutes = newRoutes([]route{
+	{http.MethodGet, "/{provider}", apiConfig.handlerOAuthLogin},
+	{http.MethodGet, "/{provider}/callback", apiConfig.handlerOAuthCallback},
+})
+
+func (apiCfg apiConfig) endpointOAuthHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(oauthRoutes, "/auth", w, r)
+}
+
+// oauthProvider returns the provider named in /auth/{provider}[/callback].
+func (apiCfg apiConfig) oauthProvider(r *http.Request) (*oauth.Provider, error) {
+	name := router.Param(r, "provider")
+	if name == "" {
+		return nil, invalidPath("bad request, correct format is: /auth/{provider}")
+	}
+	provider, ok := apiCfg.oauth.providers[name]
+	if !ok {
+		return nil, errUnknownProvider
+	}
+	return provider, nil
+}
+
+// handlerOAuthLogin sends the user to the provider's consent page. Users
+// logging in for the first time are signed up, which needs ?age= and takes
+// the ?formToken= of the signup form.
+func (apiCfg apiConfig) handlerOAuthLogin(w http.ResponseWriter, r *http.Request) {
+	// check path
+	provider, err := apiCfg.oauthProvider(r)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+
+	// remember signup fields
+	query := r.URL.Query()
+	signup := url.Values{}
+	for _, name := range []string{"age", "formToken"} {
+		if value := query.Get(name); value != "" {
+			signup.Set(name, value)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthSignupCookie,
+		Value:    signup.Encode(),
+		Path:     "/",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	// remember state
+	state := make([]byte, 16)
+	_, err = rand.Read(state)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    hex.EncodeToString(state),
+		Path:     "/",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// sent along when the provider redirects back
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, provider.AuthCodeURL(apiCfg.oauth.redirectURL(provider.Name), hex.EncodeToString(state)), http.StatusFound)
+}
+
+// handlerOAuthCallback finishes a provider login and starts a session for
+// the linked user, linking or creating one on first login.
+func (apiCfg apiConfig) handlerOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	// check path
+	provider, err := apiCfg.oauthProvider(r)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+
+	// check state
+	query := r.URL.Query()
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		respondWithError(w, http.StatusUnauthorized, errOAuthState)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: oauthSignupCookie, Path: "/", MaxAge: -1})
+	if reason := query.Get("error"); reason != "" {
+		respondWithError(w, http.StatusUnauthorized, apiError{Code: codeUnauthorized, Message: fmt.Sprintf("%s login failed: %s", provider.Name, reason)})
+		return
+	}
+
+	// get identity
+	token, err := provider.Exchange(r.Context(), query.Get("code"), apiCfg.oauth.redirectURL(provider.Name))
+	if err != nil {
+		log.Printf("%s login: %v", provider.Name, err)
+		respondWithError(w, http.StatusUnauthorized, apiError{Code: codeUnauthorized, Message: fmt.Sprintf("%s didn't accept the login", provider.Name)})
+		return
+	}
+	identity, err := provider.Identity(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	// find or create user
+	user, err := apiCfg.oauthUser(r, identity)
+	if errors.Is(err, errNoVerifiedEmail) {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if errors.Is(err, errSignupRejected) {
+		respondWithError(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// check account isn't locked
+	now := time.Now().UTC()
+	attempts, err := apiCfg.dbClient.GetLoginAttempts(user.ID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if now.Before(attempts.LockedUntil) {
+		respondWithAccountLocked(w, attempts.LockedUntil, now)
+		return
+	}
+
+	// check user isn't suspended
+	suspension, suspended, err := apiCfg.activeSuspension(user.ID, now)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if suspended {
+		respondWithError(w, http.StatusForbidden, suspendedError(suspension))
+		return
+	}
+
+	// check signup isn't waiting for review
+	pending, err := apiCfg.signupPending(user.ID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if pending {
+		respondWithError(w, http.StatusForbidden, errSignupPending)
+		return
+	}
+
+	// users with two-factor authentication on finish logging in with POST
+	// /login, sending the login token and their second factor
+	tf, err := apiCfg.dbClient.GetTwoFactor(user.ID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		respondWithDBError(w, err)
+		return
+	}
+	if tf.Enabled {
+		claims := auth.NewClaims(oauthLoginSubject+":"+provider.Name+":"+user.ID, now, oauthLoginTokenTTL)
+		token, err := auth.Sign(apiCfg.oauthLoginSecret(), claims)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		pendingErr := errTOTPRequired
+		pendingErr.Message = "two-factor authentication is on, send loginToken with totpCode or recoveryCode to /login"
+		pendingErr.Details = oauthPendingLogin{LoginToken: token, ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC()}
+		respondWithError(w, http.StatusUnauthorized, pendingErr)
+		return
+	}
+
+	// start session
+	apiCfg.respondWithSession(w, r, user, provider.Name, secondFactorCodes{}, attempts, now)
+}
+
+// oauthUser returns the user linked to identity. Without one, it links the
+// user with the identity's email if the provider verified it, or signs up a
+// new user with the fields the login was started with.
+func (apiCfg apiConfig) oauthUser(r *http.Request, identity oauth.Identity) (database.User, error) {
+	link, err := apiCfg.dbClient.GetIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		return apiCfg.dbClient.GetUser(link.UserID)
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		return database.User{}, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return database.User{}, errNoVerifiedEmail
+	}
+	user, err := apiCfg.dbClient.GetUserByEmail(identity.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		signup := url.Values{}
+		if cookie, err := r.Cookie(oauthSignupCookie); err == nil {
+			signup, _ = url.ParseQuery(cookie.Value)
+		}
+		// a missing age fails validation
+		age, _ := strconv.Atoi(signup.Get("age"))
+		// nobody knows this password, the user logs in through the provider
+		password := make([]byte, 32)
+		_, err = rand.Read(password)
+		if err != nil {
+			return database.User{}, err
+		}
+		user, _, err = apiCfg.signUp(r, nil, signup.Get("formToken"), identity.Email, hex.EncodeToString(password), identity.Name, "", age, database.Profile{})
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	_, err = apiCfg.dbClient.LinkIdentity(identity.Provider, identity.Subject, user.ID)
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/oauth"
+	"github.com/firyx/boot.dev-api-backend/internal/totp"
+)
+
+// fakeGitHub hands out an access token per code, named after the account
+// it signs in.
+func fakeGitHub() *httptest.Server {
+	accounts := map[string]struct {
+		id       int
+		email    string
+		verified bool
+	}{
+		"existing":   {id: 1, email: "test@example.com", verified: true},
+		"new":        {id: 2, email: "new@example.com", verified: true},
+		"unverified": {id: 3, email: "test@example.com", verified: false},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if _, ok := accounts[r.Form.Get("code")]; !ok {
+			w.Write([]byte(`{"error": "bad_verification_code"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"access_token": %q}`, r.Form.Get("code"))
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		account := accounts[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		fmt.Fprintf(w, `{"id": %d, "login": "gopher"}`, account.id)
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		account := accounts[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		fmt.Fprintf(w, `[{"email": %q, "primary": true, "verified": %t}]`, account.email, account.verified)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestHandlerOAuth(t *testing.T) {
+	c := database.NewMemoryClient()
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fakeGitHub()
+	defer server.Close()
+	github := oauth.GitHub("client", "secret")
+	github.TokenURL = server.URL + "/token"
+	github.UserInfoURL = server.URL + "/user"
+	github.EmailsURL = server.URL + "/user/emails"
+	apiCfg := apiConfig{
+		dbClient: c,
+		auth:     authConfig{secret: []byte("secret"), sessionTTL: time.Hour},
+		oauth: oauthConfig{
+			providers:       map[string]*oauth.Provider{"github": github},
+			redirectBaseURL: "http://api.example.com",
+		},
+	}
+
+	// start a login
+	w := httptest.NewRecorder()
+	apiCfg.endpointOAuthHandler(w, httptest.NewRequest(http.MethodGet, "/auth/github", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("got status %d, want a redirect: %s", w.Code, w.Body)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Query().Get("redirect_uri"); got != "http://api.example.com/auth/github/callback" {
+		t.Errorf("got redirect_uri %q", got)
+	}
+	state := location.Query().Get("state")
+	var stateCookie *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oauthStateCookie {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil || stateCookie.Value != state {
+		t.Fatalf("got cookies %v, want the state %s", w.Result().Cookies(), state)
+	}
+	// the signup fields a login was started with
+	w = httptest.NewRecorder()
+	apiCfg.endpointOAuthHandler(w, httptest.NewRequest(http.MethodGet, "/auth/github?age=30&formToken=token", nil))
+	var signupCookie *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oauthSignupCookie {
+			signupCookie = cookie
+		}
+	}
+	if signupCookie == nil || signupCookie.Value != "age=30&formToken=token" {
+		t.Fatalf("got cookies %v, want the signup fields", w.Result().Cookies())
+	}
+
+	var tests = []struct {
+		name           string
+		code           string
+		state          string
+		signup         *http.Cookie
+		expectedStatus int
+		// expectedUser is empty for a newly created user
+		expectedUser string
+	}{
+		{name: "wrong state", code: "existing", state: "other", expectedStatus: http.StatusUnauthorized},
+		{name: "bad code", code: "bad", state: state, expectedStatus: http.StatusUnauthorized},
+		{name: "links by email", code: "existing", state: state, expectedStatus: http.StatusOK, expectedUser: user.ID},
+		{name: "linked", code: "existing", state: state, expectedStatus: http.StatusOK, expectedUser: user.ID},
+		{name: "unverified email", code: "unverified", state: state, expectedStatus: http.StatusBadRequest},
+		{name: "new user without an age", code: "new", state: state, expectedStatus: http.StatusBadRequest},
+		{name: "creates user", code: "new", state: state, signup: signupCookie, expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/auth/github/callback?code="+tt.code+"&state="+tt.state, nil)
+		r.AddCookie(stateCookie)
+		if tt.signup != nil {
+			r.AddCookie(tt.signup)
+		}
+		apiCfg.endpointOAuthHandler(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		s := session{}
+		err = json.NewDecoder(w.Body).Decode(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.expectedUser != "" && s.UserID != tt.expectedUser {
+			t.Errorf("%s: got user %s, want %s", tt.name, s.UserID, tt.expectedUser)
+		}
+		if tt.expectedUser == "" && s.UserID == user.ID {
+			t.Errorf("%s: got the existing user, want a new one", tt.name)
+		}
+	}
+
+	// users with two-factor authentication on finish with their second factor
+	secret := "JBSWY3DPEHPK3PXP"
+	err = c.SaveTwoFactor(database.TwoFactor{UserID: user.ID, Secret: secret, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/auth/github/callback?code=existing&state="+state, nil)
+	r.AddCookie(stateCookie)
+	apiCfg.endpointOAuthHandler(w, r)
+	pending := struct {
+		Code    errorCode         `json:"code"`
+		Details oauthPendingLogin `json:"details"`
+	}{}
+	json.NewDecoder(w.Body).Decode(&pending)
+	if w.Code != http.StatusUnauthorized || pending.Code != codeTOTPRequired || pending.Details.LoginToken == "" {
+		t.Fatalf("two-factor: got status %d, %+v, want a login token", w.Code, pending)
+	}
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "without a second factor", body: `{"loginToken": "` + pending.Details.LoginToken + `"}`, expectedStatus: http.StatusUnauthorized},
+		{name: "forged token", body: `{"loginToken": "forged", "totpCode": "` + code + `"}`, expectedStatus: http.StatusUnauthorized},
+		{name: "second factor", body: `{"loginToken": "` + pending.Details.LoginToken + `", "totpCode": "` + code + `"}`, expectedStatus: http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		apiCfg.handlerLogin(w, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(tt.body)))
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+	logins, err := c.GetLoginEvents(user.ID)
+	if err != nil || len(logins) == 0 || logins[0].Method != "github" {
+		t.Errorf("got logins %+v, %v, want the last one through github", logins, err)
+	}
+
+	created, err := c.GetUserByEmail("new@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "gopher" || created.Age != 30 {
+		t.Errorf("got %+v, want the GitHub login and the age the login started with", created)
+	}
+	_, err = c.GetSignup(created.ID)
+	if err != nil {
+		t.Errorf("got %v, want the signup recorded", err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+const (
+	totalCountHeader = "X-Total-Count"
+	linkHeader       = "Link"
+)
+
+// paginationConfig holds the page size limits shared by every paginated
+// endpoint.
+type paginationConfig struct {
+	defaultLimit int
+	maxLimit     int
+}
+
+type page struct {
+	limit  int
+	offset int
+}
+
+// parsePage reads the limit and offset query parameters. A missing limit
+// uses the default, a limit above the maximum is rejected rather than
+// silently truncated so clients notice.
+func (p paginationConfig) parsePage(r *http.Request) (page, error) {
+	query := r.URL.Query()
+	pg := page{limit: p.defaultLimit}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return page{}, validationFailed(fmt.Errorf("limit must be a positive integer"))
+		}
+		if limit > p.maxLimit {
+			return page{}, apiError{
+				Code:    codePageSizeTooLarge,
+				Message: fmt.Sprintf("limit must be at most %d", p.maxLimit),
+				Details: map[string]int{"maxLimit": p.maxLimit},
+			}
+		}
+		pg.limit = limit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return page{}, validationFailed(fmt.Errorf("offset must be a non-negative integer"))
+		}
+		pg.offset = offset
+	}
+	return pg, nil
+}
+
+// paginate returns the items of the page and sets the X-Total-Count header,
+// plus a Link header pointing at the next page when there is one.
+func paginate[T any](w http.ResponseWriter, r *http.Request, items []T, pg page) []T {
+	total := len(items)
+	w.Header().Set(totalCountHeader, strconv.Itoa(total))
+	if pg.offset >= total {
+		return []T{}
+	}
+	end := pg.offset + pg.limit
+	if end > total {
+		end = total
+	}
+	if end < total {
+		setNextLink(w, r, map[string]string{"limit": strconv.Itoa(pg.limit), "offset": strconv.Itoa(end)})
+	}
+	return items[pg.offset:end]
+}
+
+// setNextLink points a Link header at the next page: r with the query
+// parameters of params.
+func setNextLink(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	query := r.URL.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set(linkHeader, fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
+}
+
+// postCursor is the JSON of the cursor tokens of posts. Clients only pass
+// tokens back, so its fields can change along with their encoding.
+type postCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+func encodePostCursor(cursor database.PostCursor) string {
+	b, _ := json.Marshal(postCursor{CreatedAt: cursor.CreatedAt, ID: cursor.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parsePostCursor reads a cursor token, an empty one starts from the
+// newest post.
+func parsePostCursor(token string) (*database.PostCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	cursor := postCursor{}
+	if err == nil {
+		err = json.Unmarshal(b, &cursor)
+	}
+	if err != nil || cursor.ID == "" {
+		return nil, validationFailed(errors.New("cursor is invalid"))
+	}
+	return &database.PostCursor{CreatedAt: cursor.CreatedAt, ID: cursor.ID}, nil
+}
+
+// paginatePosts returns the next limit posts, plus a Link header pointing
+// at the page after them when there is one. Unlike offset pages it doesn't
+// count the posts.
+func paginatePosts(w http.ResponseWriter, r *http.Request, posts *database.PostIterator, limit int) []database.Post {
+	page := []database.Post{}
+	for len(page) < limit {
+		post, ok := posts.Next()
+		if !ok {
+			return page
+		}
+		page = append(page, post)
+	}
+	if _, ok := posts.Next(); ok && len(page) > 0 {
+		setNextLink(w, r, map[string]string{"limit": strconv.Itoa(limit), "cursor": encodePostCursor(page[len(page)-1].Cursor())})
+	}
+	return page
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestParsePage(t *testing.T) {
+	cfg := paginationConfig{defaultLimit: 20, maxLimit: 100}
+	var tests = []struct {
+		query        string
+		expected     page
+		expectedCode errorCode
+	}{
+		{query: "", expected: page{limit: 20}},
+		{query: "limit=5&offset=10", expected: page{limit: 5, offset: 10}},
+		{query: "limit=100", expected: page{limit: 100}},
+		{query: "limit=101", expectedCode: codePageSizeTooLarge},
+		{query: "limit=0", expectedCode: codeValidationFailed},
+		{query: "offset=-1", expectedCode: codeValidationFailed},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/posts?"+test.query, nil)
+		pg, err := cfg.parsePage(r)
+		apiErr := apiError{}
+		if errors.As(err, &apiErr) {
+			if apiErr.Code != test.expectedCode {
+				t.Errorf("%q: got code %v, want %v", test.query, apiErr.Code, test.expectedCode)
+			}
+			continue
+		}
+		if err != nil || test.expectedCode != "" {
+			t.Errorf("%q: got error %v, want code %q", test.query, err, test.expectedCode)
+			continue
+		}
+		if pg != test.expected {
+			t.Errorf("%q: got %+v, want %+v", test.query, pg, test.expected)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	var tests = []struct {
+		pg           page
+		expected     []int
+		expectedLink string
+	}{
+		{pg: page{limit: 2}, expected: []int{1, 2}, expectedLink: `</posts?limit=2&offset=2>; rel="next"`},
+		{pg: page{limit: 2, offset: 4}, expected: []int{5}},
+		{pg: page{limit: 2, offset: 9}, expected: []int{}},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/posts", nil)
+		got := paginate(w, r, items, test.pg)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%+v: got %v, want %v", test.pg, got, test.expected)
+		}
+		if link := w.Header().Get(linkHeader); link != test.expectedLink {
+			t.Errorf("%+v: got link %q, want %q", test.pg, link, test.expectedLink)
+		}
+		if total := w.Header().Get(totalCountHeader); total != "5" {
+			t.Errorf("%+v: got total %q, want 5", test.pg, total)
+		}
+	}
+}
+
+func TestPostCursorPagination(t *testing.T) {
+	c := database.NewMemoryClient()
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		_, err := c.CreatePost(user.ID, fmt.Sprintf("post %d", i), []string{"go"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	it, err := c.IteratePosts(database.PostQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{}
+	for post, ok := it.Next(); ok; post, ok = it.Next() {
+		expected = append(expected, post.ID)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		postsprefix: "/posts",
+		pagination:  paginationConfig{defaultLimit: 20, maxLimit: 100},
+	}
+
+	// posts created mid-scan are newer than the cursor, so they don't
+	// shift the pages after it
+	seen := []string{}
+	next := "/posts?tag=go&limit=2&cursor="
+	for pages := 0; next != ""; pages++ {
+		if pages > 5 {
+			t.Fatal("too many pages")
+		}
+		w := httptest.NewRecorder()
+		apiCfg.handlerRetrievePosts(w, httptest.NewRequest(http.MethodGet, next, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: got status %d: %s", next, w.Code, w.Body)
+		}
+		posts := []database.Post{}
+		err := json.NewDecoder(w.Body).Decode(&posts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, post := range posts {
+			seen = append(seen, post.ID)
+		}
+		_, err = c.CreatePost(user.ID, "mid-scan", []string{"go"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		next = nextLink(w.Header().Get(linkHeader))
+	}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("got %v, want %v", seen, expected)
+	}
+
+	var tests = []struct {
+		query          string
+		expectedStatus int
+	}{
+		{query: "tag=go&cursor=not-a-cursor", expectedStatus: http.StatusBadRequest},
+		{query: "tag=go&cursor=&offset=2", expectedStatus: http.StatusBadRequest},
+		{query: "tag=go&cursor=" + encodePostCursor(database.PostCursor{CreatedAt: time.Now(), ID: "x"}), expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		apiCfg.handlerRetrievePosts(w, httptest.NewRequest(http.MethodGet, "/posts?"+tt.query, nil))
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.query, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+}
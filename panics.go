@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/firyx/boot.dev-api-backend/internal/errreport"
+)
+
+var errInternal = errors.New("internal server error")
+
+// panicRecovery turns panics in handlers into 500 responses, so a single
+// bad request can't take down the server.
+type panicRecovery struct {
+	errors  errorReporting
+	metrics *requestMetrics
+	// logStack logs the stack trace of panics along with their message.
+	logStack bool
+}
+
+// middleware recovers panics, logging them with the request ID, counting
+// them and reporting them as fatal errors.
+func (p panicRecovery) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// the server aborts the response without logging
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			stack := string(debug.Stack())
+			if p.logStack {
+				log.Printf("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, requestIDFromContext(r.Context()), rec, stack)
+			} else {
+				log.Printf("panic serving %s %s (request %s): %v", r.Method, r.URL.Path, requestIDFromContext(r.Context()), rec)
+			}
+			if p.metrics != nil {
+				p.metrics.observePanic()
+			}
+			p.errors.report(r, errreport.LevelFatal, fmt.Sprintf("panic: %v", rec), stack)
+			// too late to change a response already started
+			if !recorder.wroteHeader {
+				respondWithError(w, http.StatusInternalServerError, errInternal)
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/errreport"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	logs := &bytes.Buffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	var tests = []struct {
+		name           string
+		handler        http.HandlerFunc
+		logStack       bool
+		expectedStatus int
+		expectedStack  bool
+	}{
+		{
+			name: "no panic",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				respondWithJSON(w, http.StatusOK, struct{}{})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "panic",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			},
+			logStack:       true,
+			expectedStatus: http.StatusInternalServerError,
+			expectedStack:  true,
+		},
+		{
+			name: "panic without stack",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "panic after writing",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				panic("boom")
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			reporter := &fakeReporter{}
+			metrics := newRequestMetrics()
+			recovery := panicRecovery{
+				errors:   errorReporting{reporter: reporter, release: "test"},
+				metrics:  metrics,
+				logStack: tt.logStack,
+			}
+			handler := requestIDMiddleware(recovery.middleware(tt.handler))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.expectedStatus)
+			}
+			panics := metrics.snapshot(metrics.start).Panics
+			if tt.name == "no panic" {
+				if panics != 0 || len(reporter.events) != 0 || strings.Contains(logs.String(), "panic") {
+					t.Errorf("got %d panics, events %v and logs %q without a panic", panics, reporter.events, logs)
+				}
+				return
+			}
+			if panics != 1 {
+				t.Errorf("got %d panics counted, want 1", panics)
+			}
+			if len(reporter.events) != 1 || reporter.events[0].Level != errreport.LevelFatal || reporter.events[0].Message != "panic: boom" {
+				t.Errorf("got events %+v", reporter.events)
+			}
+			requestID := w.Header().Get(requestIDHeader)
+			if !strings.Contains(logs.String(), "request "+requestID+"): boom") {
+				t.Errorf("got logs without the request ID %s: %q", requestID, logs)
+			}
+			if strings.Contains(logs.String(), "goroutine ") != tt.expectedStack {
+				t.Errorf("got logs %q, want stack %v", logs, tt.expectedStack)
+			}
+			if tt.expectedStatus == http.StatusInternalServerError && !strings.Contains(w.Body.String(), `"requestId":"`+requestID+`"`) {
+				t.Errorf("got body %s without the request ID", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/replication"
+)
+
+type restoreChange struct {
+	Collection string `json:"collection"`
+	Key        string `json:"key"`
+	Change     string `json:"change"`
+}
+
+type restorePlan struct {
+	To      time.Time       `json:"to"`
+	Applied bool            `json:"applied"`
+	Created int             `json:"created"`
+	Updated int             `json:"updated"`
+	Deleted int             `json:"deleted"`
+	Changes []restoreChange `json:"changes"`
+}
+
+// journal is a log of every write to the database, the replication journal
+// or the write-ahead log.
+type journal interface {
+	Replay(t time.Time) ([]byte, error)
+}
+
+// walJournal replays the write-ahead log of a database.
+type walJournal struct {
+	c database.Client
+}
+
+func (j walJournal) Replay(t time.Time) ([]byte, error) {
+	return j.c.ReplayWAL(t)
+}
+
+// restoreJournal picks the journal to restore from: the replication journal
+// if the database is replicated, otherwise its write-ahead log.
+func (apiCfg apiConfig) restoreJournal() (journal, bool) {
+	if apiCfg.replication != nil {
+		return apiCfg.replication.Log(), true
+	}
+	if apiCfg.dbClient.WALPath() != "" {
+		return walJournal{c: apiCfg.dbClient}, true
+	}
+	return nil, false
+}
+
+// pointInTimeRestore rebuilds the database as it was at time to by replaying
+// a journal. Without apply it only previews the changes.
+func pointInTimeRestore(c database.Client, journal journal, to time.Time, apply bool) (restorePlan, error) {
+	// the journal must reproduce the current database, otherwise it is missing
+	// writes and the restored state would be wrong
+	current, err := journal.Replay(time.Now())
+	if err != nil {
+		return restorePlan{}, err
+	}
+	drift, err := c.DiffAgainst(current)
+	if err != nil {
+		return restorePlan{}, err
+	}
+	if len(drift) > 0 {
+		return restorePlan{}, fmt.Errorf("the journal doesn't match the current database (%d records differ), refusing to restore", len(drift))
+	}
+
+	target, err := journal.Replay(to)
+	if err != nil {
+		return restorePlan{}, err
+	}
+	var mutations []database.Mutation
+	if apply {
+		mutations, err = c.Restore(target)
+	} else {
+		mutations, err = c.DiffAgainst(target)
+	}
+	if err != nil {
+		return restorePlan{}, err
+	}
+
+	plan := restorePlan{To: to, Applied: apply, Changes: []restoreChange{}}
+	for _, mutation := range mutations {
+		change := restoreChange{Collection: mutation.Collection, Key: mutation.Key}
+		switch {
+		case mutation.Value == nil:
+			change.Change = "delete"
+			plan.Deleted++
+		case mutation.Previous == "":
+			change.Change = "create"
+			plan.Created++
+		default:
+			change.Change = "update"
+			plan.Updated++
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	return plan, nil
+}
+
+func (apiCfg apiConfig) handlerPointInTimeRestore(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		To    time.Time `json:"to"`
+		Apply bool      `json:"apply"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if params.To.IsZero() {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("to can't be empty")))
+		return
+	}
+
+	// only the primary can rewrite history, secondaries follow it
+	if !apiCfg.acceptsWrites() {
+		respondWithError(w, http.StatusConflict, errors.New("restore must run on the primary"))
+		return
+	}
+
+	// restore
+	journal, ok := apiCfg.restoreJournal()
+	if !ok {
+		respondWithError(w, http.StatusConflict, errors.New("no journal to restore from, enable the write-ahead log or replication"))
+		return
+	}
+	plan, err := pointInTimeRestore(apiCfg.dbClient, journal, params.To, params.Apply)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, plan)
+}
+
+// runRestoreCommand implements `db restore -to <time> [-apply]`, for
+// restoring while the server is stopped.
+func runRestoreCommand(cfg config, args []string) error {
+	flags := flag.NewFlagSet("db restore", flag.ContinueOnError)
+	to := flags.String("to", "", "time to restore to, RFC 3339 (e.g. 2023-04-01T12:00:00Z)")
+	apply := flags.Bool("apply", false, "apply the restore instead of previewing it")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	t, err := time.Parse(time.RFC3339, *to)
+	if err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+
+	c, err := openCLIDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	var history journal = walJournal{c: c}
+	if cfg.replicationRole != "" {
+		history, err = replication.OpenLog(cfg.replicationLog)
+		if err != nil {
+			return err
+		}
+	} else if !cfg.walEnabled {
+		return errors.New("no journal to restore from, enable the write-ahead log or replication")
+	}
+	plan, err := pointInTimeRestore(c, history, t, *apply)
+	if err != nil {
+		return err
+	}
+	return printJSON(plan)
+}
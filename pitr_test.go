@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/replication"
+)
+
+// journaledClient opens a database in a temporary directory that logs its
+// writes to the write-ahead log or, with replicated, to a primary's
+// replication journal.
+func journaledClient(t *testing.T, replicated bool) (database.Client, *replication.Node, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db.json")
+	c := database.NewClient(path)
+	var node *replication.Node
+	if replicated {
+		log, err := replication.OpenLog(path + ".replication.log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, err = replication.NewNode(log, c, replication.RolePrimary, "", time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c = c.WithMutationHook(node.Record)
+	} else {
+		c = c.WithWAL(path + ".wal")
+	}
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, node, path
+}
+
+// restoreHistory creates ann, then bob, and returns a time before ann, one
+// between them and one after bob.
+func restoreHistory(t *testing.T, c database.Client) (before, between, after time.Time) {
+	t.Helper()
+	before = time.Now()
+	time.Sleep(10 * time.Millisecond)
+	_, err := c.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	between = time.Now()
+	time.Sleep(10 * time.Millisecond)
+	_, err = c.CreateUser("bob@example.com", "12345", "Bob", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	return before, between, time.Now()
+}
+
+func userEmails(t *testing.T, c database.Client) []string {
+	t.Helper()
+	users, err := c.GetAllUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails := []string{}
+	for _, user := range users {
+		emails = append(emails, user.Email)
+	}
+	return emails
+}
+
+func TestPointInTimeRestore(t *testing.T) {
+	var tests = []struct {
+		name            string
+		replicated      bool
+		to              string
+		apply           bool
+		drift           bool
+		expectedErr     string
+		expectedDeleted int
+		expectedUsers   int
+	}{
+		{name: "preview", to: "between", expectedDeleted: 1, expectedUsers: 2},
+		{name: "apply", to: "between", apply: true, expectedDeleted: 1, expectedUsers: 1},
+		{name: "before the first entry", to: "before", apply: true, expectedDeleted: 2},
+		{name: "after the last entry", to: "after", apply: true, expectedUsers: 2},
+		{name: "drift", to: "between", apply: true, drift: true, expectedErr: "refusing to restore", expectedUsers: 3},
+		{name: "replicated preview", replicated: true, to: "between", expectedDeleted: 1, expectedUsers: 2},
+		{name: "replicated apply", replicated: true, to: "between", apply: true, expectedDeleted: 1, expectedUsers: 1},
+		{name: "replicated before the first entry", replicated: true, to: "before", apply: true, expectedDeleted: 2},
+		{name: "replicated after the last entry", replicated: true, to: "after", apply: true, expectedUsers: 2},
+		{name: "replicated drift", replicated: true, to: "between", apply: true, drift: true, expectedErr: "refusing to restore", expectedUsers: 3},
+	}
+	for _, tt := range tests {
+		c, node, path := journaledClient(t, tt.replicated)
+		before, between, after := restoreHistory(t, c)
+		to := map[string]time.Time{"before": before, "between": between, "after": after}[tt.to]
+		if tt.drift {
+			// written behind the journal's back
+			_, err := database.NewClient(path).CreateUser("eve@example.com", "12345", "Eve", 18)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		var history journal = walJournal{c: c}
+		if tt.replicated {
+			history = node.Log()
+		}
+
+		plan, err := pointInTimeRestore(c, history, to, tt.apply)
+		if tt.expectedErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.expectedErr)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if plan.Applied != tt.apply || plan.Deleted != tt.expectedDeleted || plan.Created != 0 || plan.Updated != 0 {
+			t.Errorf("%s: got plan %+v, want %d deleted", tt.name, plan, tt.expectedDeleted)
+		}
+		if emails := userEmails(t, c); len(emails) != tt.expectedUsers {
+			t.Errorf("%s: got users %v, want %d", tt.name, emails, tt.expectedUsers)
+		}
+	}
+}
+
+func TestHandlerPointInTimeRestore(t *testing.T) {
+	var tests = []struct {
+		name           string
+		journal        string
+		secondary      bool
+		body           string
+		expectedStatus int
+		expectedUsers  int
+	}{
+		{name: "wal", journal: "wal", body: `{"to": "between", "apply": true}`, expectedStatus: http.StatusOK, expectedUsers: 1},
+		{name: "replication", journal: "replication", body: `{"to": "between", "apply": true}`, expectedStatus: http.StatusOK, expectedUsers: 1},
+		{name: "preview", journal: "wal", body: `{"to": "between"}`, expectedStatus: http.StatusOK, expectedUsers: 2},
+		{name: "missing to", journal: "wal", body: `{"apply": true}`, expectedStatus: http.StatusBadRequest, expectedUsers: 2},
+		{name: "no journal", body: `{"to": "between", "apply": true}`, expectedStatus: http.StatusConflict, expectedUsers: 2},
+		{name: "secondary", journal: "replication", secondary: true, body: `{"to": "between", "apply": true}`, expectedStatus: http.StatusConflict, expectedUsers: 2},
+	}
+	for _, tt := range tests {
+		c, node, path := journaledClient(t, tt.journal == "replication")
+		_, between, _ := restoreHistory(t, c)
+		apiCfg := apiConfig{dbClient: c}
+		switch tt.journal {
+		case "":
+			apiCfg.dbClient = database.NewClient(path)
+		case "replication":
+			apiCfg.replication = node
+			if tt.secondary {
+				secondary, err := replication.NewNode(node.Log(), c, replication.RoleSecondary, "http://primary.example.com", time.Second)
+				if err != nil {
+					t.Fatal(err)
+				}
+				apiCfg.replication = secondary
+			}
+		}
+		if tt.journal == "replication" {
+			// the write-ahead log is ignored when the database is replicated
+			apiCfg.dbClient = c.WithWAL(path + ".wal")
+		}
+
+		body := strings.Replace(tt.body, `"between"`, `"`+between.Format(time.RFC3339Nano)+`"`, 1)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/admin/db/restore", strings.NewReader(body))
+		apiCfg.handlerPointInTimeRestore(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+		if emails := userEmails(t, c); len(emails) != tt.expectedUsers {
+			t.Errorf("%s: got users %v, want %d", tt.name, emails, tt.expectedUsers)
+		}
+	}
+}
+
+func TestRunRestoreCommand(t *testing.T) {
+	var tests = []struct {
+		name            string
+		cfg             config
+		args            []string
+		expectedErr     string
+		expectedDeleted int
+		expectedUsers   int
+	}{
+		{name: "preview", cfg: config{walEnabled: true}, args: []string{"-to", "between"}, expectedDeleted: 1, expectedUsers: 2},
+		{name: "apply", cfg: config{walEnabled: true}, args: []string{"-to", "between", "-apply"}, expectedDeleted: 1, expectedUsers: 1},
+		{name: "before the first entry", cfg: config{walEnabled: true}, args: []string{"-to", "before", "-apply"}, expectedDeleted: 2},
+		{name: "replication journal", cfg: config{replicationRole: "primary"}, args: []string{"-to", "between", "-apply"}, expectedDeleted: 1, expectedUsers: 1},
+		{name: "invalid time", cfg: config{walEnabled: true}, args: []string{"-to", "yesterday", "-apply"}, expectedErr: "invalid -to", expectedUsers: 2},
+		{name: "no journal", args: []string{"-to", "between", "-apply"}, expectedErr: "no journal", expectedUsers: 2},
+		{name: "secondary", cfg: config{replicationRole: "secondary"}, args: []string{"-to", "between", "-apply"}, expectedErr: "secondary", expectedUsers: 2},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		cliOut = &out
+		cfg := tt.cfg
+		cfg.dbPath = filepath.Join(t.TempDir(), "db.json")
+		cfg.replicationLog = cfg.dbPath + ".replication.log"
+		// the history is written like the server would write it
+		primary := cfg
+		if primary.replicationRole != "" {
+			primary.replicationRole = "primary"
+		}
+		c, err := openCLIDatabase(primary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before, between, _ := restoreHistory(t, c)
+
+		args := []string{"db", "restore"}
+		for _, arg := range tt.args {
+			switch arg {
+			case "before":
+				arg = before.Format(time.RFC3339Nano)
+			case "between":
+				arg = between.Format(time.RFC3339Nano)
+			}
+			args = append(args, arg)
+		}
+		err = runCLI(cfg, args)
+		if tt.expectedErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.expectedErr)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else {
+			plan := restorePlan{}
+			err = json.Unmarshal(out.Bytes(), &plan)
+			if err != nil || plan.Deleted != tt.expectedDeleted {
+				t.Errorf("%s: got plan %s, want %d deleted", tt.name, out.String(), tt.expectedDeleted)
+			}
+		}
+		if emails := userEmails(t, database.NewClient(cfg.dbPath)); len(emails) != tt.expectedUsers {
+			t.Errorf("%s: got users %v, want %d", tt.name, emails, tt.expectedUsers)
+		}
+	}
+	cliOut = os.Stdout
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// publicProfile is a user as shown to anyone, without their email, age or
+// password.
+type publicProfile struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username,omitempty"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	database.Profile
+	Streak postingStreak `json:"streak"`
+}
+
+// userForViewer leaves out of a user what only they may see. The password
+// hash never leaves the server, the recovery email is only shown to the
+// user themselves.
+func userForViewer(user database.User, viewerID string) database.User {
+	user.Password = ""
+	user.PasswordAlgorithm = ""
+	if user.ID != viewerID {
+		user.RecoveryEmail = ""
+		user.RecoveryEmailVerified = false
+	}
+	return user
+}
+
+func (apiCfg apiConfig) handlerGetUserProfile(w http.ResponseWriter, r *http.Request) {
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}/profile or /users/@{username}/profile"))
+		return
+	}
+
+	// check user exists
+	user, err := apiCfg.users().Get(ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// return profile with streak, unless the client has it already
+	now := time.Now()
+	if notModified(w, r, userModified(user, now)) {
+		return
+	}
+	posts, err := apiCfg.dbClient.GetPosts(user.ID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, publicProfile{
+		ID:        user.ID,
+		Username:  user.Username,
+		Name:      user.Name,
+		CreatedAt: user.CreatedAt,
+		Profile:   user.Profile,
+		Streak:    computeStreak(posts, userLocation(user), now),
+	})
+}
+
+// handlerUploadAvatar stores an image uploaded like post media as the
+// user's avatar, replacing the previous one.
+func (apiCfg apiConfig) handlerUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}/avatar"))
+		return
+	}
+
+	// check user is the one logged in
+	user, err := apiCfg.users().Own(ref, userID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// store file, avatars must be images
+	upload, ok := apiCfg.storeUpload(w, r, apiCfg.media.maxSize, apiCfg.checkMediaType)
+	if !ok {
+		return
+	}
+	if !strings.HasPrefix(upload.ContentType, "image/") {
+		apiCfg.deleteMediaFile(upload.ID)
+		respondWithUploadError(w, apiError{
+			Code:    codeUnsupportedMedia,
+			Message: "avatars must be images, got " + upload.ContentType,
+		})
+		return
+	}
+
+	// record avatar
+	user, previous, err := apiCfg.dbClient.SetAvatar(user.ID, upload)
+	if err != nil {
+		apiCfg.deleteMediaFile(upload.ID)
+		respondWithDBError(w, err)
+		return
+	}
+	if previous != "" {
+		apiCfg.deleteMediaFile(previous)
+	}
+	respondWithJSON(w, http.StatusCreated, userForViewer(user, userID))
+}
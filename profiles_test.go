@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/storage"
+)
+
+func TestPublicProfile(t *testing.T) {
+	c := database.NewMemoryClient()
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.UpdateUserProfile(user.ID, database.Profile{Bio: "Gopher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{dbClient: c, usersPrefix: "/users"}
+
+	w := httptest.NewRecorder()
+	apiCfg.endpointUsersHandler(w, httptest.NewRequest(http.MethodGet, "/users/"+user.ID+"/profile", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	profile := map[string]interface{}{}
+	err = json.NewDecoder(w.Body).Decode(&profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile["bio"] != "Gopher" || profile["name"] != "Test" {
+		t.Errorf("got %v, want the name and bio", profile)
+	}
+	for _, field := range []string{"email", "password", "age"} {
+		if _, ok := profile[field]; ok {
+			t.Errorf("public profile has %s: %v", field, profile)
+		}
+	}
+}
+
+func TestGetUserHidesSecrets(t *testing.T) {
+	c := database.NewMemoryClient()
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.SetRecoveryEmail(user.ID, "test@backup.example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		auth:        testAuth,
+	}
+	token := mediaTestLogin(t, apiCfg, "test@example.com")
+
+	var tests = []struct {
+		name          string
+		token         string
+		recoveryEmail bool
+	}{
+		{name: "anyone"},
+		{name: "owner", token: token, recoveryEmail: true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/users/"+user.ID, nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		apiCfg.endpointUsersHandler(w, r)
+		fields := map[string]interface{}{}
+		err = json.NewDecoder(w.Body).Decode(&fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range []string{"password", "passwordAlgorithm"} {
+			if _, ok := fields[field]; ok {
+				t.Errorf("%s: got %s: %v", tt.name, field, fields)
+			}
+		}
+		if _, ok := fields["recoveryEmail"]; ok != tt.recoveryEmail {
+			t.Errorf("%s: got recovery email %v, want %v", tt.name, ok, tt.recoveryEmail)
+		}
+	}
+}
+
+func TestHandlerUploadAvatar(t *testing.T) {
+	dir := t.TempDir()
+	c := database.NewMemoryClient()
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewLocalDisk(filepath.Join(dir, "media"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		media: mediaConfig{
+			store:        store,
+			maxSize:      64,
+			allowedTypes: map[string]bool{"image/png": true, "text/plain; charset=utf-8": true},
+		},
+		auth: testAuth,
+	}
+	token := mediaTestLogin(t, apiCfg, "test@example.com")
+
+	var tests = []struct {
+		name           string
+		content        []byte
+		expectedStatus int
+	}{
+		{name: "png", content: []byte("\x89PNG\r\n\x1a\n"), expectedStatus: http.StatusCreated},
+		{name: "replacing png", content: []byte("\x89PNG\r\n\x1a\n"), expectedStatus: http.StatusCreated},
+		// accepted as media, but not an image
+		{name: "text", content: []byte("hello"), expectedStatus: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		part, err := form.CreateFormFile("file", tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(tt.content)
+		form.Close()
+		r := httptest.NewRequest(http.MethodPost, "/users/"+user.ID+"/avatar", body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		apiCfg.endpointUsersHandler(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+
+	user, err = c.GetUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	apiCfg.endpointMediaHandler(w, httptest.NewRequest(http.MethodGet, user.AvatarURL, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("getting avatar %q: got %d %s, want the uploaded png", user.AvatarURL, w.Code, w.Header().Get("Content-Type"))
+	}
+	problems, err := c.Verify()
+	if err != nil || len(problems) != 0 {
+		t.Errorf("got problems %v, %v after replacing the avatar", problems, err)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+const (
+	tokenVerifyRecoveryEmail = "verify_recovery_email"
+	tokenPasswordReset       = "password_reset"
+
+	recoveryEmailTokenTTL = 24 * time.Hour
+	passwordResetTokenTTL = time.Hour
+)
+
+var (
+	errInvalidToken           = apiError{Code: codeInvalidToken, Message: "token is invalid or expired"}
+	errRecoveryEmailForbidden = apiError{Code: codeForbidden, Message: "users can only change their own recovery email"}
+)
+
+// issueEmailToken stores a new token for the user and returns it, for
+// emailing to email.
+func (apiCfg apiConfig) issueEmailToken(userID, purpose, email string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	err = apiCfg.dbClient.CreateEmailToken(database.EmailToken{
+		Hash:      hashEmailToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// hashEmailToken hashes a token for storage. Tokens are random, so a plain
+// hash is enough.
+func hashEmailToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
+
+// recoveryEmailUser returns the user named in a /users/{id}/recovery-email
+// request, if they are the one logged in.
+func (apiCfg apiConfig) recoveryEmailUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return database.User{}, false
+	}
+
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}/recovery-email"))
+		return database.User{}, false
+	}
+
+	// check user exists and is the one logged in
+	user, err := apiCfg.users().Get(ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return database.User{}, false
+	}
+	if user.ID != userID {
+		respondWithError(w, http.StatusForbidden, errRecoveryEmailForbidden)
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// handlerSetRecoveryEmail registers a recovery email for the logged in user
+// and emails it a token. It can't receive password resets until verified
+// with handlerVerifyRecoveryEmail.
+func (apiCfg apiConfig) handlerSetRecoveryEmail(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := apiCfg.recoveryEmailUser(w, r)
+	if !ok {
+		return
+	}
+
+	// check email
+	if _, err := netmail.ParseAddress(params.Email); err != nil {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("email must be a valid address")))
+		return
+	}
+	if strings.EqualFold(params.Email, user.Email) {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("recovery email must differ from the account's email")))
+		return
+	}
+	if !apiCfg.emailEnabled() {
+		respondWithError(w, http.StatusNotImplemented, errEmailDisabled)
+		return
+	}
+
+	// store unverified email and send token
+	user, err = apiCfg.dbClient.SetRecoveryEmail(user.ID, params.Email, false)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	token, err := apiCfg.issueEmailToken(user.ID, tokenVerifyRecoveryEmail, user.RecoveryEmail, recoveryEmailTokenTTL)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	_, err = apiCfg.sendEmail(user.RecoveryEmail, "verify_recovery_email", map[string]interface{}{
+		"Name":  user.Name,
+		"Token": token,
+	})
+	if err != nil {
+		log.Printf("recovery email verification: %v", err)
+	}
+	respondWithJSON(w, http.StatusOK, userForViewer(user, user.ID))
+}
+
+// handlerDeleteRecoveryEmail removes the logged in user's recovery email.
+func (apiCfg apiConfig) handlerDeleteRecoveryEmail(w http.ResponseWriter, r *http.Request) {
+	user, ok := apiCfg.recoveryEmailUser(w, r)
+	if !ok {
+		return
+	}
+	user, err := apiCfg.dbClient.SetRecoveryEmail(user.ID, "", false)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, userForViewer(user, user.ID))
+}
+
+// handlerVerifyRecoveryEmail verifies the logged in user's recovery email
+// with the token sent to it.
+func (apiCfg apiConfig) handlerVerifyRecoveryEmail(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		Token string `json:"token"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check token was sent to the user's current recovery email
+	token, err := apiCfg.dbClient.UseEmailToken(hashEmailToken(params.Token), tokenVerifyRecoveryEmail, time.Now())
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, errInvalidToken)
+		return
+	}
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	user, err := apiCfg.dbClient.GetUser(userID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if token.UserID != user.ID || token.Email != user.RecoveryEmail {
+		respondWithError(w, http.StatusBadRequest, errInvalidToken)
+		return
+	}
+
+	// verify
+	user, err = apiCfg.dbClient.SetRecoveryEmail(user.ID, user.RecoveryEmail, true)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, userForViewer(user, user.ID))
+}
+
+// handlerRequestPasswordReset emails a password reset token to the account
+// email or verified recovery email sent. It answers the same whether or not
+// the email belongs to a user, so callers can't look up accounts.
+func (apiCfg apiConfig) handlerRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if params.Email == "" {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("email can't be empty")))
+		return
+	}
+	if !apiCfg.emailEnabled() {
+		respondWithError(w, http.StatusNotImplemented, errEmailDisabled)
+		return
+	}
+
+	// find user, by account email first
+	to := params.Email
+	user, err := apiCfg.dbClient.GetUserByEmail(params.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		user, err = apiCfg.dbClient.GetUserByRecoveryEmail(params.Email)
+		to = user.RecoveryEmail
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithJSON(w, http.StatusAccepted, struct{}{})
+		return
+	}
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	// send token
+	token, err := apiCfg.issueEmailToken(user.ID, tokenPasswordReset, to, passwordResetTokenTTL)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	_, err = apiCfg.sendEmail(to, "password_reset", map[string]interface{}{
+		"Name":  user.Name,
+		"Token": token,
+	})
+	if err != nil {
+		log.Printf("password reset email: %v", err)
+	}
+	respondWithJSON(w, http.StatusAccepted, struct{}{})
+}
+
+// handlerConfirmPasswordReset sets a new password with a password reset
+// token. It unlocks the account and logs out every session, in case the
+// old password leaked.
+func (apiCfg apiConfig) handlerConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	err = apiCfg.users().CheckPassword(params.Password)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// check token was sent to one of the user's current emails
+	token, err := apiCfg.dbClient.UseEmailToken(hashEmailToken(params.Token), tokenPasswordReset, time.Now())
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, errInvalidToken)
+		return
+	}
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	user, err := apiCfg.dbClient.GetUser(token.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, errInvalidToken)
+		return
+	}
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if token.Email != user.Email && !(user.RecoveryEmailVerified && token.Email == user.RecoveryEmail) {
+		respondWithError(w, http.StatusBadRequest, errInvalidToken)
+		return
+	}
+
+	// set password
+	_, err = apiCfg.users().SetPassword(user.ID, params.Password)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	err = apiCfg.dbClient.SaveLoginAttempts(database.LoginAttempts{UserID: user.ID})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	err = apiCfg.revokeUserSessions(user.ID, "password reset")
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/mail"
+)
+
+func TestPasswordResetWithRecoveryEmail(t *testing.T) {
+	// nothing listens on the address, emails stay queued in the database
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	c := database.NewMemoryClient()
+	m, err := newMailer(config{jobMaxAttempts: 1}, c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.pool, err = mail.NewPool(mail.Options{Addr: listener.Addr().String(), From: "no-reply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		mailer:      m,
+		usersPrefix: "/users",
+		auth:        testAuth,
+	}
+
+	token := mediaTestLogin(t, apiCfg, "ann@example.com")
+	// emailedToken returns the token last emailed to an address
+	emailedToken := func(to string) string {
+		emails, err := c.GetEmails()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, email := range emails {
+			if email.To == to {
+				data := struct{ Token string }{}
+				json.Unmarshal(email.Data, &data)
+				return data.Token
+			}
+		}
+		return ""
+	}
+
+	var tests = []struct {
+		name           string
+		handler        http.HandlerFunc
+		method         string
+		path           string
+		auth           bool
+		body           string
+		expectedStatus int
+	}{
+		{name: "set recovery email without session", handler: apiCfg.endpointUsersHandler, method: http.MethodPut, path: "/users/" + user.ID + "/recovery-email", body: `{"email": "ann@backup.example.com"}`, expectedStatus: http.StatusUnauthorized},
+		{name: "set account email as recovery email", handler: apiCfg.endpointUsersHandler, method: http.MethodPut, path: "/users/" + user.ID + "/recovery-email", auth: true, body: `{"email": "ann@example.com"}`, expectedStatus: http.StatusBadRequest},
+		{name: "set recovery email", handler: apiCfg.endpointUsersHandler, method: http.MethodPut, path: "/users/" + user.ID + "/recovery-email", auth: true, body: `{"email": "ann@backup.example.com"}`, expectedStatus: http.StatusOK},
+		{name: "reset with unverified recovery email", handler: apiCfg.handlerRequestPasswordReset, method: http.MethodPost, path: "/password-reset", body: `{"email": "ann@backup.example.com"}`, expectedStatus: http.StatusAccepted},
+		{name: "verify with wrong token", handler: apiCfg.handlerVerifyRecoveryEmail, method: http.MethodPost, path: "/recovery-email/verify", auth: true, body: `{"token": "wrong"}`, expectedStatus: http.StatusBadRequest},
+		{name: "verify", handler: apiCfg.handlerVerifyRecoveryEmail, method: http.MethodPost, path: "/recovery-email/verify", auth: true, body: `{"token": "{token}"}`, expectedStatus: http.StatusOK},
+		{name: "reset with unknown email", handler: apiCfg.handlerRequestPasswordReset, method: http.MethodPost, path: "/password-reset", body: `{"email": "bob@example.com"}`, expectedStatus: http.StatusAccepted},
+		{name: "reset with recovery email", handler: apiCfg.handlerRequestPasswordReset, method: http.MethodPost, path: "/password-reset", body: `{"email": "ann@backup.example.com"}`, expectedStatus: http.StatusAccepted},
+		{name: "confirm with wrong token", handler: apiCfg.handlerConfirmPasswordReset, method: http.MethodPost, path: "/password-reset/confirm", body: `{"token": "wrong", "password": "54321"}`, expectedStatus: http.StatusBadRequest},
+		{name: "confirm", handler: apiCfg.handlerConfirmPasswordReset, method: http.MethodPost, path: "/password-reset/confirm", body: `{"token": "{token}", "password": "54321"}`, expectedStatus: http.StatusOK},
+		{name: "confirm again", handler: apiCfg.handlerConfirmPasswordReset, method: http.MethodPost, path: "/password-reset/confirm", body: `{"token": "{token}", "password": "abcde"}`, expectedStatus: http.StatusBadRequest},
+		{name: "session after reset", handler: apiCfg.endpointMeSessionsHandler, method: http.MethodGet, path: "/me/sessions", auth: true, expectedStatus: http.StatusUnauthorized},
+		{name: "log in with new password", handler: apiCfg.handlerLogin, method: http.MethodPost, path: "/login", body: `{"email": "ann@example.com", "password": "54321"}`, expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		// {token} is the token last emailed to the recovery email
+		body := strings.ReplaceAll(tt.body, "{token}", emailedToken("ann@backup.example.com"))
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+		if tt.auth {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		tt.handler(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+
+	emails, err := c.GetEmails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 2 || emails[0].Template != "password_reset" || emails[1].Template != "verify_recovery_email" {
+		t.Errorf("got %d emails, want a recovery email verification and one password reset", len(emails))
+	}
+}
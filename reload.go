@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// reloader re-reads the config on SIGHUP or POST /admin/reload and applies
+// what the running middleware can change: the request throttle, the sample
+// rates and the IP policy. Nothing is applied unless the whole config is
+// valid. Connections are left alone, and the other settings need a restart.
+type reloader struct {
+	throttle *costThrottle
+	sampler  *requestSampler
+	ipFilter *ipFilter
+	rollouts *rollouts
+	// load is loadConfig, replaced in tests.
+	load func() (config, error)
+
+	mu sync.Mutex
+}
+
+// reloadedSettings is what a reload applied.
+type reloadedSettings struct {
+	ReloadedAt         time.Time          `json:"reloadedAt"`
+	ThrottleBudget     int                `json:"throttleBudget"`
+	ThrottleRouteCosts map[string]int     `json:"throttleRouteCosts"`
+	SampleRate         float64            `json:"sampleRate"`
+	SampleRouteRates   map[string]float64 `json:"sampleRouteRates"`
+	// IPFilter tells whether a GeoIP table or blocklist is loaded.
+	IPFilter bool               `json:"ipFilter"`
+	Rollouts map[string]rollout `json:"rollouts"`
+}
+
+func (rl *reloader) reload() (reloadedSettings, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	cfg, err := rl.load()
+	if err != nil {
+		return reloadedSettings{}, err
+	}
+	source, err := loadIPSources(cfg)
+	if err != nil {
+		return reloadedSettings{}, err
+	}
+
+	rl.throttle.configure(cfg.throttleBudget, cfg.throttleRouteCosts)
+	rl.sampler.setRates(cfg.sampleRate, cfg.sampleRouteRates)
+	rl.ipFilter.set(source, cfg.ipPolicy)
+	rl.rollouts.set(cfg.rollouts)
+	log.Printf("config reloaded")
+	return reloadedSettings{
+		ReloadedAt:         time.Now().UTC(),
+		ThrottleBudget:     cfg.throttleBudget,
+		ThrottleRouteCosts: cfg.throttleRouteCosts,
+		SampleRate:         cfg.sampleRate,
+		SampleRouteRates:   cfg.sampleRouteRates,
+		IPFilter:           source != nil,
+		Rollouts:           cfg.rollouts,
+	}, nil
+}
+
+// watchSignals reloads the config on every SIGHUP until ctx is done.
+func (rl *reloader) watchSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				_, err := rl.reload()
+				if err != nil {
+					log.Printf("config reload failed, keeping the current settings: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (rl *reloader) handlerReload(w http.ResponseWriter, r *http.Request) {
+	settings, err := rl.reload()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, apiError{
+			Code:    codeInvalidConfig,
+			Message: "config reload failed, keeping the current settings: " + err.Error(),
+		})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, settings)
+}
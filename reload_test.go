@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.env")
+	blocklist := filepath.Join(dir, "drop.txt")
+	err := os.WriteFile(blocklist, []byte("192.0.2.0/24\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", configPath)
+	t.Setenv("THROTTLE_BUDGET", "600")
+	writeConfig := func(content string) {
+		t.Helper()
+		err := os.WriteFile(configPath, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("# starts without limits\nTHROTTLE_BUDGET=0\n")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.throttleBudget != 0 {
+		t.Fatalf("got throttle budget %d, want the file to override the environment", cfg.throttleBudget)
+	}
+
+	rl := &reloader{
+		throttle: newCostThrottle(cfg.throttleBudget, cfg.throttleRouteCosts),
+		sampler:  &requestSampler{},
+		ipFilter: &ipFilter{},
+		rollouts: newRollouts(cfg.rollouts),
+		load:     loadConfig,
+	}
+	apiCfg := apiConfig{auth: authConfig{secret: []byte("secret")}}
+	handler := rl.ipFilter.middleware(apiCfg.throttleMiddleware(rl.throttle, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/search?q=go", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	if w := request("192.0.2.1:1000"); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+		t.Fatalf("got status %d with limit %q, want no throttling", w.Code, w.Header().Get("X-RateLimit-Limit"))
+	}
+
+	writeConfig("THROTTLE_BUDGET=10\nTHROTTLE_ROUTE_COSTS=\"/search=4\"\nSAMPLE_RATE=0.5\nROLLOUTS=/messages=5%\nIP_BLOCKLISTS=" + blocklist + "\n")
+	w := httptest.NewRecorder()
+	rl.handlerReload(w, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("reload: got status %d: %s", w.Code, w.Body)
+	}
+	if w := request("192.0.2.1:1000"); w.Code != http.StatusForbidden {
+		t.Errorf("blocklisted address: got status %d, want 403", w.Code)
+	}
+	if w := request("198.51.100.1:1000"); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Cost") != "4" {
+		t.Errorf("got status %d with cost %q, want the new route costs", w.Code, w.Header().Get("X-RateLimit-Cost"))
+	}
+	if rate := rl.sampler.rate("/v1/users"); rate != 0.5 {
+		t.Errorf("got sample rate %v, want 0.5", rate)
+	}
+	if _, r, ok := rl.rollouts.lookup("/messages/unread"); !ok || r.Percent != 5 {
+		t.Errorf("got rollout %+v, want /messages rolled out to 5%%", r)
+	}
+
+	// an invalid config keeps the current settings
+	writeConfig("THROTTLE_BUDGET=10\nIP_BLOCKLISTS=" + filepath.Join(dir, "missing.txt") + "\nSAMPLE_RATE=0\n")
+	w = httptest.NewRecorder()
+	rl.handlerReload(w, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid reload: got status %d, want 400: %s", w.Code, w.Body)
+	}
+	if rate := rl.sampler.rate("/v1/users"); rate != 0.5 {
+		t.Errorf("got sample rate %v after a failed reload, want 0.5", rate)
+	}
+	if w := request("192.0.2.1:1000"); w.Code != http.StatusForbidden {
+		t.Errorf("blocklisted address after a failed reload: got status %d, want 403", w.Code)
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.env")
+	err := os.WriteFile(path, []byte("# comment\n\nexport ADDR=0.0.0.0:8080\nSAMPLE_ROUTE_RATES='/search=0.1'\nEMPTY=\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 || values["ADDR"] != "0.0.0.0:8080" || values["SAMPLE_ROUTE_RATES"] != "/search=0.1" || values["EMPTY"] != "" {
+		t.Errorf("got %v", values)
+	}
+
+	err = os.WriteFile(path, []byte("NOT A SETTING\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = readConfigFile(path)
+	if err == nil {
+		t.Error("expected an error for a line without =")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFromContext(r.Context())
+		respondWithError(w, http.StatusBadRequest, errors.New("bad"))
+	}))
+
+	var tests = []struct {
+		header    string
+		generated bool
+	}{
+		{header: "abc-123", generated: false},
+		{header: "", generated: true},
+		{header: "bad id\nwith newline", generated: true},
+		{header: strings.Repeat("a", 200), generated: true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		if tt.header != "" {
+			req.Header.Set(requestIDHeader, tt.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		echoed := w.Header().Get(requestIDHeader)
+		if echoed == "" || echoed != seen {
+			t.Errorf("got header %q and context %q, want them equal and set", echoed, seen)
+		}
+		if (echoed != tt.header) != tt.generated {
+			t.Errorf("%q: got %q, generated: %v", tt.header, echoed, tt.generated)
+		}
+		if !strings.Contains(w.Body.String(), `"requestId":"`+echoed+`"`) {
+			t.Errorf("request ID missing from error body %s", w.Body.String())
+		}
+	}
+}
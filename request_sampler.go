@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxSampledBodySize = 64 * 1024
+
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"secret":        true,
+	"authorization": true,
+	"cookie":        true,
+}
+
+// requestSampler captures a sanitized copy of a random sample of requests and
+// their responses, one JSON document per line, for offline analysis.
+type requestSampler struct {
+	out io.Writer
+
+	// ratesMu guards the rates, which change on reload.
+	ratesMu     sync.RWMutex
+	defaultRate float64
+	routeRates  map[string]float64
+
+	mu sync.Mutex
+}
+
+type sampledExchange struct {
+	Time       time.Time         `json:"time"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Query      string            `json:"query,omitempty"`
+	Headers    map[string]string `json:"headers"`
+	Body       json.RawMessage   `json:"body,omitempty"`
+	Status     int               `json:"status"`
+	Response   json.RawMessage   `json:"response,omitempty"`
+	DurationMs float64           `json:"durationMs"`
+}
+
+// parseSampleRates parses a comma separated list of route=rate pairs, e.g.
+// "/users=0.1,/posts=0.01".
+func parseSampleRates(s string) (map[string]float64, error) {
+	rates := map[string]float64{}
+	if s == "" {
+		return rates, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		route, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid sample rate: %s", pair)
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid sample rate for %s: %s", route, value)
+		}
+		rates[route] = rate
+	}
+	return rates, nil
+}
+
+// rate returns the sample rate of the longest configured route prefix that
+// matches path, or the default rate.
+func (s *requestSampler) rate(path string) float64 {
+	s.ratesMu.RLock()
+	defer s.ratesMu.RUnlock()
+	rate := s.defaultRate
+	longest := -1
+	for route, routeRate := range s.routeRates {
+		if strings.HasPrefix(path, route) && len(route) > longest {
+			rate = routeRate
+			longest = len(route)
+		}
+	}
+	return rate
+}
+
+// setRates changes the sample rates on reload.
+func (s *requestSampler) setRates(defaultRate float64, routeRates map[string]float64) {
+	s.ratesMu.Lock()
+	defer s.ratesMu.Unlock()
+	s.defaultRate = defaultRate
+	s.routeRates = routeRates
+}
+
+func (s *requestSampler) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rate := s.rate(r.URL.Path)
+		if rate <= 0 || rand.Float64() >= rate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSampledBodySize))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+		recorder := &sampleRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+
+		exchange := sampledExchange{
+			Time:       start.UTC(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      r.URL.RawQuery,
+			Headers:    sanitizeHeaders(r.Header),
+			Body:       sanitizeBody(body),
+			Status:     recorder.status,
+			Response:   sanitizeBody(recorder.body.Bytes()),
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		s.write(exchange)
+	})
+}
+
+func (s *requestSampler) write(exchange sampledExchange) {
+	data, err := json.Marshal(exchange)
+	if err != nil {
+		log.Printf("request sampler: %v", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.out.Write(append(data, '\n'))
+	if err != nil {
+		log.Printf("request sampler: %v", err)
+	}
+}
+
+func sanitizeHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for key, values := range header {
+		if sensitiveKeys[strings.ToLower(key)] {
+			headers[key] = "[REDACTED]"
+			continue
+		}
+		headers[key] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// sanitizeBody redacts sensitive fields of a JSON body. Bodies that aren't
+// valid JSON are dropped rather than stored verbatim.
+func sanitizeBody(body []byte) json.RawMessage {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	var value interface{}
+	err := json.Unmarshal(body, &value)
+	if err != nil {
+		return nil
+	}
+	data, err := json.Marshal(redact(value))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if sensitiveKeys[strings.ToLower(key)] {
+				v[key] = "[REDACTED]"
+				continue
+			}
+			v[key] = redact(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item)
+		}
+	}
+	return value
+}
+
+type sampleRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *sampleRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *sampleRecorder) Write(p []byte) (int, error) {
+	if r.body.Len() < maxSampledBodySize {
+		r.body.Write(p)
+	}
+	return r.ResponseWriter.Write(p)
+}
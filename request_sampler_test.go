@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestRequestSamplerRate(t *testing.T) {
+	rates, err := parseSampleRates("/users=0.5, /users/admin=1,/posts=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &requestSampler{defaultRate: 0.01, routeRates: rates}
+	var tests = []struct {
+		path     string
+		expected float64
+	}{
+		{path: "/users", expected: 0.5},
+		{path: "/users/test@example.com", expected: 0.5},
+		{path: "/users/admin", expected: 1},
+		{path: "/posts", expected: 0},
+		{path: "/admin/import", expected: 0.01},
+	}
+	for _, tt := range tests {
+		rate := s.rate(tt.path)
+		if rate != tt.expected {
+			t.Errorf("%s: got %v, want %v", tt.path, rate, tt.expected)
+		}
+	}
+
+	_, err = parseSampleRates("/users=2")
+	if err == nil {
+		t.Errorf("expected error for rate above 1")
+	}
+}
+
+func TestSanitizeBody(t *testing.T) {
+	var tests = []struct {
+		body     string
+		expected string
+	}{
+		{
+			body:     `{"email":"test@example.com","password":"12345"}`,
+			expected: `{"email":"test@example.com","password":"[REDACTED]"}`,
+		},
+		{
+			body:     `{"users":[{"Password":"12345"}]}`,
+			expected: `{"users":[{"Password":"[REDACTED]"}]}`,
+		},
+		{
+			body:     `not json`,
+			expected: ``,
+		},
+	}
+	for _, tt := range tests {
+		sanitized := string(sanitizeBody([]byte(tt.body)))
+		if sanitized != tt.expected {
+			t.Errorf("got %s, want %s", sanitized, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// restartListenersEnv lists the addresses of the sockets a new process
+	// inherits, in the order of their file descriptors from 3.
+	restartListenersEnv = "RESTART_LISTENERS"
+	// restartParentEnv is the PID of the process to stop once the new
+	// process serves.
+	restartParentEnv = "RESTART_PARENT_PID"
+)
+
+var errRestartInProgress = apiError{Code: codeConflict, Message: "a restart is already in progress"}
+
+// handoff passes the listening sockets of a running server to the process
+// replacing it, so deploys can restart the binary without refusing or
+// dropping connections. The new process inherits the sockets as extra
+// files and, once it serves them, sends SIGTERM to the old one, which
+// finishes the requests in flight and exits.
+type handoff struct {
+	// executable is read at startup, deploys replace the file.
+	executable string
+	// pidFile is rewritten by every process once it serves, so supervisors
+	// can follow restarts. Empty when there's none.
+	pidFile string
+	// parentPID is the process this one replaces, 0 for a fresh start.
+	parentPID int
+	// inherited are the sockets passed by the parent not listened on yet,
+	// by address.
+	inherited map[string]net.Listener
+	// drain stops the job queue and the scheduler, which the process
+	// replacing this one takes over. Nil when there's nothing to stop.
+	drain func()
+
+	mu         sync.Mutex
+	listeners  []addrListener
+	restarting bool
+}
+
+type addrListener struct {
+	addr string
+	net.Listener
+}
+
+// newHandoff takes over the sockets a parent process passed, if any.
+func newHandoff(pidFile string) (*handoff, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	h := &handoff{executable: executable, pidFile: pidFile}
+	h.inherited, err = inheritListeners(os.Getenv(restartListenersEnv), func(i int, addr string) *os.File {
+		return os.NewFile(uintptr(3+i), addr)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("inherited listeners: %w", err)
+	}
+	if v := os.Getenv(restartParentEnv); v != "" {
+		h.parentPID, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", restartParentEnv, err)
+		}
+	}
+	// not for the processes this one starts
+	os.Unsetenv(restartListenersEnv)
+	os.Unsetenv(restartParentEnv)
+	return h, nil
+}
+
+// inheritListeners turns the files listed in addrs, a space separated list,
+// back into listeners.
+func inheritListeners(addrs string, file func(i int, addr string) *os.File) (map[string]net.Listener, error) {
+	listeners := map[string]net.Listener{}
+	for i, addr := range strings.Fields(addrs) {
+		f := file(i, addr)
+		if f == nil {
+			return nil, fmt.Errorf("no file for %s", addr)
+		}
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", addr, err)
+		}
+		listeners[addr] = l
+	}
+	return listeners, nil
+}
+
+// listen takes over the inherited socket of addr, or opens it.
+func (h *handoff) listen(addr string) (net.Listener, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l, ok := h.inherited[addr]
+	if ok {
+		delete(h.inherited, addr)
+	} else {
+		var err error
+		l, err = net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	h.listeners = append(h.listeners, addrListener{addr: addr, Listener: l})
+	return l, nil
+}
+
+// ready closes the inherited sockets no longer configured, writes the PID
+// file, and stops the parent process.
+func (h *handoff) ready() error {
+	h.mu.Lock()
+	for addr, l := range h.inherited {
+		log.Printf("closing inherited listener %s, it isn't configured anymore", addr)
+		l.Close()
+	}
+	h.inherited = nil
+	h.mu.Unlock()
+
+	if h.pidFile != "" {
+		err := os.WriteFile(h.pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	// the parent may have died meanwhile, and its PID been reused
+	if h.parentPID == 0 || h.parentPID != os.Getppid() {
+		return nil
+	}
+	parent, err := os.FindProcess(h.parentPID)
+	if err != nil {
+		return err
+	}
+	log.Printf("took over the listeners of process %d, stopping it", h.parentPID)
+	return parent.Signal(syscall.SIGTERM)
+}
+
+// restart starts a new process of the executable with the same arguments,
+// passing it the listening sockets, and returns its PID. This process
+// keeps serving until the new one stops it, or exits on its own.
+func (h *handoff) restart() (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.restarting {
+		return 0, errRestartInProgress
+	}
+	files := []*os.File{}
+	addrs := []string{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range h.listeners {
+		tcp, ok := l.Listener.(*net.TCPListener)
+		if !ok {
+			return 0, fmt.Errorf("listener %s can't be passed on", l.addr)
+		}
+		f, err := tcp.File()
+		if err != nil {
+			return 0, err
+		}
+		files = append(files, f)
+		addrs = append(addrs, l.addr)
+	}
+
+	// the new process starts its own job queue and scheduler, only one
+	// process may work them at a time
+	h.stopBackground()
+	cmd := exec.Command(h.executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(),
+		restartListenersEnv+"="+strings.Join(addrs, " "),
+		restartParentEnv+"="+strconv.Itoa(os.Getpid()),
+	)
+	cmd.ExtraFiles = files
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := cmd.Start()
+	if err != nil {
+		log.Printf("restart failed, the job queue and the scheduler stay stopped until the next restart")
+		return 0, err
+	}
+	h.restarting = true
+	pid := cmd.Process.Pid
+	log.Printf("restarting: started process %d with %d listeners", pid, len(files))
+	go func() {
+		// only returns while this process still runs if the new one failed
+		err := cmd.Wait()
+		log.Printf("restart failed, process %d exited: %v", pid, err)
+		log.Printf("the job queue and the scheduler stay stopped until the next restart")
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.restarting = false
+	}()
+	return pid, nil
+}
+
+// stopBackground stops the background work of this process, if it didn't
+// already.
+func (h *handoff) stopBackground() {
+	if h.drain != nil {
+		h.drain()
+	}
+}
+
+// handlerRestart starts the process replacing this one. It answers before
+// the new process is ready, which stops this one once it is.
+func (h *handoff) handlerRestart(w http.ResponseWriter, r *http.Request) {
+	pid, err := h.restart()
+	if errors.Is(err, errRestartInProgress) {
+		respondWithError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, struct {
+		PID int `json:"pid"`
+	}{PID: pid})
+}
+
+// shutdown stops servers from accepting connections and waits up to
+// timeout for the requests in flight to finish.
+func shutdown(servers []*http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			errs <- srv.Shutdown(ctx)
+		}(srv)
+	}
+	shutdownErrs := []error{}
+	for range servers {
+		shutdownErrs = append(shutdownErrs, <-errs)
+	}
+	return errors.Join(shutdownErrs...)
+}
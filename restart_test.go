@@ -0,0 +1,154 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInheritListeners(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+	f, err := parent.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := parent.Addr().String()
+
+	inherited, err := inheritListeners(addr, func(i int, addr string) *os.File {
+		return f
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &handoff{inherited: inherited}
+	l, err := h.listen(addr)
+	if err != nil {
+		t.Fatalf("got %v, want the inherited socket while the parent still listens", err)
+	}
+	defer l.Close()
+	if l.Addr().String() != addr || len(h.inherited) != 0 || len(h.listeners) != 1 {
+		t.Errorf("got %s, inherited %v, want the socket of %s taken over", l.Addr(), h.inherited, addr)
+	}
+	// the parent stops, the socket keeps accepting connections
+	parent.Close()
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "child")
+	}))
+	resp, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "child" {
+		t.Errorf("got %q, want the child to answer", body)
+	}
+
+	_, err = inheritListeners(addr, func(i int, addr string) *os.File { return nil })
+	if err == nil {
+		t.Error("got no error for a missing file")
+	}
+}
+
+func TestShutdownFinishesRequests(t *testing.T) {
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	})}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	bodies := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			bodies <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		bodies <- string(body)
+	}()
+	<-started
+	err = shutdown([]*http.Server{srv}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := <-bodies; body != "done" {
+		t.Errorf("got %q, want the request in flight to finish", body)
+	}
+}
+
+func TestSignalStopsBackgroundFirst(t *testing.T) {
+	drained := make(chan struct{})
+	h := &handoff{drain: func() { close(drained) }}
+	started := make(chan struct{})
+	srv := &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		// the request in flight only finishes once background work stopped,
+		// so stopping it after the shutdown would time out
+		select {
+		case <-drained:
+			io.WriteString(w, "done")
+		case <-time.After(2 * time.Second):
+			io.WriteString(w, "background work still running")
+		}
+	})}
+	served := make(chan error)
+	go func() {
+		served <- serveAll([]*http.Server{srv}, config{shutdownTimeout: time.Second}, h)
+	}()
+	var addr string
+	for addr == "" {
+		time.Sleep(10 * time.Millisecond)
+		h.mu.Lock()
+		if len(h.listeners) > 0 {
+			addr = h.listeners[0].Addr().String()
+		}
+		h.mu.Unlock()
+	}
+	bodies := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			bodies <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		bodies <- string(body)
+	}()
+	<-started
+	err := syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("got %v, want the server to stop once the request finished", err)
+	}
+	if body := <-bodies; body != "done" {
+		t.Errorf("got %q, want the request in flight to finish", body)
+	}
+}
+
+func TestRestartInProgress(t *testing.T) {
+	h := &handoff{restarting: true}
+	w := httptest.NewRecorder()
+	h.handlerRestart(w, httptest.NewRequest(http.MethodPost, "/admin/restart", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusConflict)
+	}
+}
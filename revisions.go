@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/firyx/boot.dev-api-backend/internal/router"
+)
+
+// handlerGetPostRevisions lists every version of a post, oldest first, if
+// the user logged in with the request sees its author's posts.
+func (apiCfg apiConfig) handlerGetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	// check path
+	id, err := getPostUuid(apiCfg, r)
+	if err != nil || id == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /posts/{post-id}/revisions"))
+		return
+	}
+
+	// collect revisions
+	revisions, err := apiCfg.postsFor(r).Revisions(id)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	// the last revision is the current text
+	if len(revisions) > 0 && notModified(w, r, revisions[len(revisions)-1].CreatedAt) {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, revisions)
+}
+
+// handlerRevertPost restores an earlier revision of the authenticated
+// user's post.
+func (apiCfg apiConfig) handlerRevertPost(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	id, err := getPostUuid(apiCfg, r)
+	number, convErr := strconv.Atoi(router.Param(r, "revision"))
+	if err != nil || convErr != nil {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /posts/{post-id}/revert/{revision}"))
+		return
+	}
+
+	// revert post
+	post, err := apiCfg.posts().Revert(id, number, userID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, post)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// revocationList keeps the revoked token IDs of a database in memory, so
+// checking a token on every request doesn't read the database. It loads on
+// first use and then follows writes, replicated ones included, through the
+// mutation hook.
+type revocationList struct {
+	mu sync.RWMutex
+	// expiries are keyed by token ID, nil until loaded.
+	expiries map[string]time.Time
+}
+
+func newRevocationList() *revocationList {
+	return &revocationList{}
+}
+
+// applyMutations is the database mutation hook following the revocation
+// list.
+func (l *revocationList) applyMutations(mutations []database.Mutation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.expiries == nil {
+		return
+	}
+	for _, mutation := range mutations {
+		if mutation.Collection != "revokedTokens" {
+			continue
+		}
+		if mutation.Value == nil {
+			delete(l.expiries, mutation.Key)
+			continue
+		}
+		token := database.RevokedToken{}
+		err := json.Unmarshal(mutation.Value, &token)
+		if err != nil {
+			log.Printf("revocation list: token %s: %v", mutation.Key, err)
+			continue
+		}
+		l.expiries[mutation.Key] = token.ExpiresAt
+	}
+}
+
+// revoked reports whether the token with id was revoked, loading the list
+// from c the first time.
+func (l *revocationList) revoked(c database.Client, id string) (bool, error) {
+	l.mu.RLock()
+	expiries := l.expiries
+	_, ok := expiries[id]
+	l.mu.RUnlock()
+	if expiries != nil {
+		return ok, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.expiries == nil {
+		tokens, err := c.GetRevokedTokens()
+		if err != nil {
+			return false, err
+		}
+		l.expiries = make(map[string]time.Time, len(tokens))
+		for _, token := range tokens {
+			l.expiries[token.ID] = token.ExpiresAt
+		}
+	}
+	_, ok = l.expiries[id]
+	return ok, nil
+}
+
+// tokenRevoked reports whether the token with id was revoked. Without a
+// revocation list, it reads the database.
+func (apiCfg apiConfig) tokenRevoked(id string) (bool, error) {
+	if apiCfg.revocations != nil {
+		return apiCfg.revocations.revoked(apiCfg.dbClient, id)
+	}
+	tokens, err := apiCfg.dbClient.GetRevokedTokens()
+	if err != nil {
+		return false, err
+	}
+	for _, token := range tokens {
+		if token.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkNotRevoked returns errUnauthorized for revoked tokens.
+func (apiCfg apiConfig) checkNotRevoked(claims auth.Claims) error {
+	if claims.ID == "" {
+		return nil
+	}
+	revoked, err := apiCfg.tokenRevoked(claims.ID)
+	if err != nil {
+		log.Printf("revocation list: %v", err)
+		return errUnauthorized
+	}
+	if revoked {
+		return errUnauthorized
+	}
+	return nil
+}
+
+// revokeSession revokes the token issued for session, and deletes the
+// session.
+func (apiCfg apiConfig) revokeSession(session database.Session, reason string) error {
+	if session.TokenID != "" {
+		_, err := apiCfg.dbClient.RevokeToken(database.RevokedToken{
+			ID:        session.TokenID,
+			UserID:    session.UserID,
+			Reason:    reason,
+			ExpiresAt: session.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err := apiCfg.dbClient.DeleteSession(session.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// revokeUserSessions logs a user out everywhere.
+func (apiCfg apiConfig) revokeUserSessions(userID, reason string) error {
+	sessions, err := apiCfg.dbClient.GetSessions(userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		err = apiCfg.revokeSession(session, reason)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handlerLogout revokes the session token making the request.
+func (apiCfg apiConfig) handlerLogout(w http.ResponseWriter, r *http.Request) {
+	claims, err := apiCfg.authenticatedSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// revoke token
+	if claims.SessionID == "" && claims.ID == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("tokens issued before sessions were recorded can't be revoked"))
+		return
+	}
+	err = apiCfg.revokeSession(database.Session{
+		ID:        claims.SessionID,
+		UserID:    claims.Subject,
+		TokenID:   claims.ID,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+	}, "logout")
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// handlerAdminRevokeTokens logs a user out everywhere, e.g. when their
+// account was taken over.
+func (apiCfg apiConfig) handlerAdminRevokeTokens(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		Reason string `json:"reason"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	// the body is optional
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if params.Reason == "" {
+		params.Reason = "revoked by an admin"
+	}
+
+	// check path
+	ref, err := trimPrefix(r.URL.Path, "/admin/users/", "not a valid URL: %s{id}/revoke-tokens")
+	ref = strings.TrimSuffix(ref, "/revoke-tokens")
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /admin/users/{id}/revoke-tokens"))
+		return
+	}
+
+	// check user exists
+	user, err := apiCfg.users().Get(ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// revoke tokens
+	err = apiCfg.revokeUserSessions(user.ID, params.Reason)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
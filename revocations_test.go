@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestRevocations(t *testing.T) {
+	c := database.NewMemoryClient()
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations := newRevocationList()
+	apiCfg := apiConfig{
+		dbClient:    c.WithMutationHook(revocations.applyMutations),
+		revocations: revocations,
+		usersPrefix: "/users",
+		auth:        testAuth,
+	}
+
+	authorized := func(token string) bool {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/me/sessions", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		_, err := apiCfg.authenticatedSession(r)
+		return err == nil
+	}
+
+	// revoked before the list was loaded, with the session left in place
+	early := mediaTestLogin(t, apiCfg, "test@example.com")
+	claims, err := auth.Verify(apiCfg.auth.secret, early, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.RevokeToken(database.RevokedToken{ID: claims.ID, UserID: user.ID, ExpiresAt: time.Unix(claims.ExpiresAt, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorized(early) {
+		t.Error("token revoked before the list loaded is still accepted")
+	}
+
+	// logging out revokes the token making the request only
+	laptop, phone := mediaTestLogin(t, apiCfg, "test@example.com"), mediaTestLogin(t, apiCfg, "test@example.com")
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	r.Header.Set("Authorization", "Bearer "+laptop)
+	apiCfg.handlerLogout(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("logout: got status %d: %s", w.Code, w.Body)
+	}
+	if authorized(laptop) {
+		t.Error("token is still accepted after logging out")
+	}
+	if !authorized(phone) {
+		t.Error("logging out revoked the tokens of other sessions")
+	}
+
+	// admins revoke every token of a user
+	tablet := mediaTestLogin(t, apiCfg, "test@example.com")
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/admin/users/"+user.ID+"/revoke-tokens", strings.NewReader(`{"reason": "account takeover"}`))
+	apiCfg.endpointAdminUsersHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke tokens: got status %d: %s", w.Code, w.Body)
+	}
+	if authorized(phone) || authorized(tablet) {
+		t.Error("tokens are still accepted after an admin revoked them")
+	}
+	tokens, err := c.GetRevokedTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := map[string]int{}
+	for _, token := range tokens {
+		reasons[token.Reason]++
+	}
+	// the session of the first token was still there
+	if reasons["logout"] != 1 || reasons["account takeover"] != 3 {
+		t.Errorf("got revocation reasons %v", reasons)
+	}
+
+	// expired revocations are purged, their tokens fail verification anyway
+	purged, err := apiCfg.dbClient.PurgeRevokedTokens(time.Now().Add(2 * time.Hour))
+	if err != nil || purged != len(tokens) {
+		t.Errorf("purge: got %d, %v, want %d", purged, err, len(tokens))
+	}
+	if len(revocations.expiries) != 0 {
+		t.Errorf("got %d cached revocations after the purge, want 0", len(revocations.expiries))
+	}
+}
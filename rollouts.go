@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// rollout is who sees a route that isn't fully launched: a share of the
+// signed in users, and users listed by email.
+type rollout struct {
+	Percent float64  `json:"percent"`
+	Emails  []string `json:"emails"`
+}
+
+// rollouts soft-launches routes of the API. Everyone else gets the 404 of a
+// route that doesn't exist, until the route's rollout is removed.
+type rollouts struct {
+	mu     sync.RWMutex
+	routes map[string]rollout
+}
+
+// parseRollouts parses a comma separated list of route=audience pairs, where
+// an audience is a percentage of users and emails separated by ";", e.g.
+// "/messages=10%;ann@example.com,/notifications=bob@example.com".
+func parseRollouts(s string) (map[string]rollout, error) {
+	routes := map[string]rollout{}
+	if s == "" {
+		return routes, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		route, audience, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("invalid rollout: %s", pair)
+		}
+		r := rollout{Emails: []string{}}
+		for _, item := range strings.Split(audience, ";") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			if v, ok := strings.CutSuffix(item, "%"); ok {
+				percent, err := strconv.ParseFloat(v, 64)
+				if err != nil || percent < 0 || percent > 100 {
+					return nil, fmt.Errorf("invalid rollout percentage for %s: %s", route, item)
+				}
+				r.Percent = percent
+				continue
+			}
+			if !strings.Contains(item, "@") {
+				return nil, fmt.Errorf("invalid rollout email for %s: %s", route, item)
+			}
+			r.Emails = append(r.Emails, strings.ToLower(item))
+		}
+		routes[route] = r
+	}
+	return routes, nil
+}
+
+func newRollouts(routes map[string]rollout) *rollouts {
+	return &rollouts{routes: routes}
+}
+
+// set changes the rollouts on reload.
+func (rs *rollouts) set(routes map[string]rollout) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.routes = routes
+}
+
+// lookup returns the rollout of the longest route prefix that matches path,
+// false for launched routes. A nil rollouts launches every route.
+func (rs *rollouts) lookup(path string) (string, rollout, bool) {
+	if rs == nil {
+		return "", rollout{}, false
+	}
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	match := ""
+	found := false
+	for route := range rs.routes {
+		if strings.HasPrefix(path, route) && (!found || len(route) > len(match)) {
+			match = route
+			found = true
+		}
+	}
+	return match, rs.routes[match], found
+}
+
+// includes tells whether a user sees a route. Users are bucketed by a hash
+// of the route and their ID, so they keep seeing a route as its percentage
+// grows, and each route reaches a different share of the users.
+func (r rollout) includes(route, userID, email string) bool {
+	for _, e := range r.Emails {
+		if strings.EqualFold(e, email) {
+			return true
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(route + ":" + userID))
+	return float64(h.Sum32()%10000) < r.Percent*100
+}
+
+// rolloutMiddleware hides the routes being rolled out from the users outside
+// their rollout. Paths are relative to the API version root.
+func (apiCfg apiConfig) rolloutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, rollout, ok := apiCfg.rollouts.lookup(r.URL.Path)
+		if !ok || rollout.Percent >= 100 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userID, err := apiCfg.authenticatedUserID(r)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		email := ""
+		if len(rollout.Emails) > 0 {
+			user, err := apiCfg.dbClient.GetUser(userID)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			email = user.Email
+		}
+		if !rollout.includes(route, userID, email) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
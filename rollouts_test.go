@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestParseRollouts(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected map[string]rollout
+		invalid  bool
+	}{
+		{input: "", expected: map[string]rollout{}},
+		{
+			input: "/messages=10%;Ann@example.com, /notifications=bob@example.com",
+			expected: map[string]rollout{
+				"/messages":      {Percent: 10, Emails: []string{"ann@example.com"}},
+				"/notifications": {Emails: []string{"bob@example.com"}},
+			},
+		},
+		{input: "/messages=", expected: map[string]rollout{"/messages": {Emails: []string{}}}},
+		{input: "/messages", invalid: true},
+		{input: "messages=10%", invalid: true},
+		{input: "/messages=101%", invalid: true},
+		{input: "/messages=ten%", invalid: true},
+		{input: "/messages=ann", invalid: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRollouts(tt.input)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("%q: got %v, want an error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: got %+v, want %+v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestRolloutPercent(t *testing.T) {
+	// users stay in as the rollout grows, and the share is about right
+	small, large := rollout{Percent: 10}, rollout{Percent: 50}
+	included := 0
+	for i := 0; i < 10000; i++ {
+		userID := fmt.Sprintf("user-%d", i)
+		if !small.includes("/messages", userID, "") {
+			continue
+		}
+		included++
+		if !large.includes("/messages", userID, "") {
+			t.Fatalf("%s is in the 10%% rollout but not the 50%% one", userID)
+		}
+	}
+	if included < 900 || included > 1100 {
+		t.Errorf("got %d of 10000 users in a 10%% rollout", included)
+	}
+}
+
+func TestRolloutMiddleware(t *testing.T) {
+	c := database.NewMemoryClient()
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		postsprefix: "/posts",
+		pagination:  paginationConfig{defaultLimit: 20, maxLimit: 100},
+		auth:        testAuth,
+		rollouts:    newRollouts(map[string]rollout{"/notifications": {Emails: []string{"ann@example.com"}}}),
+	}
+	handler := apiCfg.v1().handler
+	tokens := map[string]string{}
+	for _, email := range []string{"ann@example.com", "bob@example.com"} {
+		_, err := c.CreateUser(email, "12345", "", 18)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email": "`+email+`", "password": "12345"}`)))
+		s := session{}
+		err = json.NewDecoder(w.Body).Decode(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[email] = s.Token
+	}
+	request := func(email, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if email != "" {
+			r.Header.Set("Authorization", "Bearer "+tokens[email])
+		}
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	var tests = []struct {
+		email          string
+		path           string
+		expectedStatus int
+	}{
+		{email: "ann@example.com", path: "/notifications", expectedStatus: 200},
+		{email: "bob@example.com", path: "/notifications", expectedStatus: 404},
+		{email: "", path: "/notifications", expectedStatus: 404},
+		{email: "bob@example.com", path: "/messages/unread", expectedStatus: 200},
+	}
+	for _, tt := range tests {
+		if w := request(tt.email, http.MethodGet, tt.path, ""); w.Code != tt.expectedStatus {
+			t.Errorf("%q %s: got status %d, want %d: %s", tt.email, tt.path, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+
+	// batches don't get around the rollout
+	w := request("bob@example.com", http.MethodPost, "/batch", `[{"method":"GET","path":"/v1/notifications"}]`)
+	responses := []batchResponse{}
+	err := json.NewDecoder(w.Body).Decode(&responses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 1 || responses[0].Status != http.StatusNotFound {
+		t.Errorf("got %+v, want the sub-request not found", responses)
+	}
+
+	// fully launched
+	apiCfg.rollouts.set(map[string]rollout{"/notifications": {Percent: 100}})
+	if w := request("bob@example.com", http.MethodGet, "/notifications", ""); w.Code != http.StatusOK {
+		t.Errorf("launched: got status %d, want 200", w.Code)
+	}
+}
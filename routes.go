@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/firyx/boot.dev-api-backend/internal/router"
+)
+
+const (
+	// latestAPIVersion is served under its own prefix and is the default for
+	// the legacy unversioned paths.
+	latestAPIVersion = "v1"
+	// acceptVersionHeader lets clients of the unversioned paths pick a version.
+	acceptVersionHeader = "Accept-Version"
+	apiVersionHeader    = "API-Version"
+)
+
+// apiVersion is the handler set for one version of the public API. Handlers
+// see paths relative to the version root (e.g. /users/{email}), so versions
+// can share the same handlers and database layer and only swap what changed.
+type apiVersion struct {
+	name    string
+	handler http.Handler
+	// legacyPaths are the version-relative paths also served without prefix.
+	legacyPaths []string
+}
+
+func (apiCfg apiConfig) apiVersions() []apiVersion {
+	return []apiVersion{
+		apiCfg.v1(),
+	}
+}
+
+func (apiCfg apiConfig) v1() apiVersion {
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiCfg.usersPrefix, apiCfg.traced(apiConfig.endpointUsersHandler))
+	mux.HandleFunc(apiCfg.usersPrefix+"/", apiCfg.traced(apiConfig.endpointUsersHandler))
+	mux.HandleFunc(apiCfg.postsprefix, apiCfg.traced(apiConfig.endpointPostsHandler))
+	mux.HandleFunc(apiCfg.postsprefix+"/", apiCfg.traced(apiConfig.endpointPostsHandler))
+	mux.HandleFunc("/tags", allowMethods(apiCfg.traced(apiConfig.handlerTagCounts), http.MethodGet))
+	mux.HandleFunc("/media/", apiCfg.traced(apiConfig.endpointMediaHandler))
+	mux.HandleFunc("/leaderboards/posters", allowMethods(apiCfg.traced(apiConfig.handlerPostersLeaderboard), http.MethodGet))
+	mux.HandleFunc("/search", allowMethods(apiCfg.traced(apiConfig.handlerSearch), http.MethodGet))
+	mux.HandleFunc("/login", allowMethods(apiCfg.traced(apiConfig.handlerLogin), http.MethodPost))
+	mux.HandleFunc("/logout", allowMethods(apiCfg.traced(apiConfig.handlerLogout), http.MethodPost))
+	mux.HandleFunc("/signup/form-token", allowMethods(apiCfg.traced(apiConfig.handlerSignupFormToken), http.MethodGet))
+	mux.HandleFunc("/2fa/verify", allowMethods(apiCfg.traced(apiConfig.handlerTwoFactorVerify), http.MethodPost))
+	mux.HandleFunc("/recovery-email/verify", allowMethods(apiCfg.traced(apiConfig.handlerVerifyRecoveryEmail), http.MethodPost))
+	mux.HandleFunc("/password-reset", allowMethods(apiCfg.traced(apiConfig.handlerRequestPasswordReset), http.MethodPost))
+	mux.HandleFunc("/password-reset/confirm", allowMethods(apiCfg.traced(apiConfig.handlerConfirmPasswordReset), http.MethodPost))
+	mux.HandleFunc("/auth/", apiCfg.traced(apiConfig.endpointOAuthHandler))
+	mux.HandleFunc("/graphql", allowMethods(apiCfg.traced(apiConfig.handlerGraphQL), http.MethodPost))
+	mux.HandleFunc("/me/sessions", apiCfg.traced(apiConfig.endpointMeSessionsHandler))
+	mux.HandleFunc("/me/sessions/", apiCfg.traced(apiConfig.endpointMeSessionsHandler))
+	mux.HandleFunc("/me/logins", allowMethods(apiCfg.traced(apiConfig.handlerGetLogins), http.MethodGet))
+	mux.HandleFunc("/me/follow-requests", apiCfg.traced(apiConfig.endpointMeFollowRequestsHandler))
+	mux.HandleFunc("/me/follow-requests/", apiCfg.traced(apiConfig.endpointMeFollowRequestsHandler))
+	mux.HandleFunc("/sync", apiCfg.traced(apiConfig.endpointSyncHandler))
+	mux.HandleFunc("/messages", apiCfg.traced(apiConfig.endpointMessagesHandler))
+	mux.HandleFunc("/messages/", apiCfg.traced(apiConfig.endpointMessagesHandler))
+	mux.HandleFunc("/notifications", apiCfg.traced(apiConfig.endpointNotificationsHandler))
+	mux.HandleFunc("/notifications/read", apiCfg.traced(apiConfig.endpointNotificationsHandler))
+	// batches can't reach the routes hidden from the user either, and each
+	// of their requests is charged and audited like one sent on its own
+	handler := apiCfg.rolloutMiddleware(mux)
+	batched := handler
+	if apiCfg.throttle != nil {
+		batched = apiCfg.throttleMiddleware(apiCfg.throttle, batched)
+	}
+	if apiCfg.audit != nil {
+		batched = auditMiddleware(apiCfg.audit, batched)
+	}
+	mux.HandleFunc("/batch", allowMethods(apiCfg.batchHandler(batched), http.MethodPost))
+	return apiVersion{
+		name:    "v1",
+		handler: handler,
+		legacyPaths: []string{
+			apiCfg.usersPrefix,
+			apiCfg.usersPrefix + "/",
+			apiCfg.postsprefix,
+			apiCfg.postsprefix + "/",
+			apiCfg.postsprefix + "/deadlinks",
+			"/tags",
+			"/media/",
+			"/leaderboards/posters",
+			"/search",
+			"/login",
+			"/logout",
+			"/signup/form-token",
+			"/2fa/verify",
+			"/recovery-email/verify",
+			"/password-reset",
+			"/password-reset/confirm",
+			"/auth/",
+			"/graphql",
+			"/me/sessions",
+			"/me/sessions/",
+			"/me/logins",
+			"/me/follow-requests",
+			"/me/follow-requests/",
+			"/sync",
+			"/messages",
+			"/messages/",
+			"/notifications",
+			"/notifications/read",
+			"/batch",
+		},
+	}
+}
+
+// routeHandler is the handler of a route under a resource prefix.
+type routeHandler func(apiConfig, http.ResponseWriter, *http.Request)
+
+// route is a row of a route table: requests with method to paths matching
+// pattern, relative to the prefix of the table, go to handler.
+type route struct {
+	method  string
+	pattern string
+	handler routeHandler
+}
+
+var errRouteNotFound = apiError{Code: codeNotFound, Message: "no route matches the path"}
+
+// usersRoutes are the routes under apiConfig.usersPrefix, and postsRoutes
+// those under apiConfig.postsprefix. Conflicting routes panic at startup,
+// and literal segments win over parameters, so no user or post ref can
+// shadow a route like /posts/deadlinks.
+var (
+	usersRoutes = newUsersRoutes([]route{
+		{http.MethodPost, "", apiConfig.handlerCreateUser},
+		{http.MethodGet, "/{ref}", apiConfig.handlerGetUser},
+		{http.MethodPut, "/{ref}", apiConfig.handlerUpdateUser},
+		{http.MethodPatch, "/{ref}", apiConfig.handlerPatchUser},
+		{http.MethodDelete, "/{ref}", apiConfig.handlerDeleteUser},
+		{http.MethodGet, "/{ref}/posts/analytics", apiConfig.handlerPostAnalytics},
+		{http.MethodGet, "/{ref}/badges", apiConfig.handlerGetBadges},
+		{http.MethodPost, "/{ref}/2fa/setup", apiConfig.handlerTwoFactorSetup},
+		{http.MethodPut, "/{ref}/recovery-email", apiConfig.handlerSetRecoveryEmail},
+		{http.MethodDelete, "/{ref}/recovery-email", apiConfig.handlerDeleteRecoveryEmail},
+		{http.MethodGet, "/{ref}/settings", apiConfig.handlerGetUserSettings},
+		{http.MethodPut, "/{ref}/settings", apiConfig.handlerUpdateUserSettings},
+		{http.MethodGet, "/{ref}/profile", apiConfig.handlerGetUserProfile},
+		{http.MethodPost, "/{ref}/avatar", apiConfig.handlerUploadAvatar},
+		{http.MethodPost, "/{ref}/block", apiConfig.handlerBlockUser},
+		{http.MethodDelete, "/{ref}/block", apiConfig.handlerUnblockUser},
+		{http.MethodPost, "/{ref}/follow", apiConfig.handlerFollowUser},
+		{http.MethodDelete, "/{ref}/follow", apiConfig.handlerUnfollowUser},
+	})
+	postsRoutes = newRoutes([]route{
+		{http.MethodGet, "", apiConfig.handlerRetrievePosts},
+		{http.MethodPost, "", apiConfig.handlerCreatePost},
+		{http.MethodGet, "/deadlinks", apiConfig.handlerDeadLinksReport},
+		{http.MethodPut, "/{id}", apiConfig.handlerUpdatePost},
+		{http.MethodDelete, "/{id}", apiConfig.handlerDeletePost},
+		{http.MethodPost, "/{id}/media", apiConfig.handlerUploadMedia},
+		{http.MethodPost, "/{id}/media/uploads", apiConfig.handlerCreateMediaUpload},
+		{http.MethodPost, "/{id}/media/uploads/{media-id}", apiConfig.handlerCompleteMediaUpload},
+		{http.MethodGet, "/{id}/translate", apiConfig.handlerTranslatePost},
+		{http.MethodGet, "/{id}/revisions", apiConfig.handlerGetPostRevisions},
+		{http.MethodPost, "/{id}/revert/{revision}", apiConfig.handlerRevertPost},
+	})
+)
+
+func newRoutes(routes []route) *router.Router[routeHandler] {
+	rt := router.New[routeHandler]()
+	for _, route := range routes {
+		rt.Handle(route.method, route.pattern, route.handler)
+	}
+	return rt
+}
+
+// newUsersRoutes also serves the routes of a user by {ref} under
+// /by-email/{email}.
+func newUsersRoutes(routes []route) *router.Router[routeHandler] {
+	rt := newRoutes(routes)
+	for _, route := range routes {
+		if rest, ok := strings.CutPrefix(route.pattern, "/{ref}"); ok {
+			rt.Handle(route.method, "/by-email/{email}"+rest, route.handler)
+		}
+	}
+	return rt
+}
+
+// serveRoute passes the request to the route of routes matching its method
+// and its path below prefix, ignoring a trailing slash, with the
+// parameters of the route for routeParam. Paths no route matches are 404
+// Not Found, and paths routed for other methods 405 Method Not Allowed.
+// HEAD requests get the headers of GET, and OPTIONS requests the methods
+// allowed.
+func (apiCfg apiConfig) serveRoute(routes *router.Router[routeHandler], prefix string, w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	handler, params, err := routes.Match(r.Method, path)
+	notAllowed := router.MethodNotAllowedError{}
+	switch {
+	case errors.As(err, &notAllowed):
+		respondMethodNotAllowed(w, r, notAllowed.Allow)
+		return
+	case err != nil:
+		respondWithError(w, http.StatusNotFound, errRouteNotFound)
+		return
+	}
+	handler(apiCfg, w, router.WithParams(r, params))
+}
+
+// allowMethods answers requests with other methods than methods with 405
+// Method Not Allowed, for handlers registered on a single path. HEAD
+// requests are served as GET, net/http drops the body, and OPTIONS requests
+// get the methods allowed.
+func allowMethods(handler http.HandlerFunc, methods ...string) http.HandlerFunc {
+	allow := router.Allow(methods...)
+	routed := map[string]bool{}
+	for _, method := range methods {
+		routed[method] = true
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		method := r.Method
+		if method == http.MethodHead && !routed[method] {
+			method = http.MethodGet
+		}
+		if !routed[method] {
+			respondMethodNotAllowed(w, r, allow)
+			return
+		}
+		if method != r.Method {
+			// the handler is the GET one
+			get := *r
+			get.Method = method
+			r = &get
+		}
+		handler(w, r)
+	}
+}
+
+// respondMethodNotAllowed answers OPTIONS requests with 204 No Content and
+// the methods allowed, and other requests with 405 Method Not Allowed.
+func respondMethodNotAllowed(w http.ResponseWriter, r *http.Request, allow []string) {
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respondWithError(w, http.StatusMethodNotAllowed, errMethodNotSupported)
+}
+
+// routeParam returns the parameter name of the route the request matched,
+// or an error formatted with prefix if it's missing.
+func routeParam(r *http.Request, name, errMsg, prefix string) (string, error) {
+	value := router.Param(r, name)
+	if value == "" {
+		return "", fmt.Errorf(errMsg, prefix)
+	}
+	return value, nil
+}
+
+// registerAPIVersions mounts every version under /{version}/ and serves the
+// legacy unversioned paths through version negotiation. Calls to the legacy
+// paths are marked deprecated and counted in deprecations.
+func registerAPIVersions(mux *http.ServeMux, versions []apiVersion, deprecations *deprecationTracker) {
+	handlers := map[string]http.Handler{}
+	legacyPaths := map[string]bool{}
+	for _, v := range versions {
+		handlers[v.name] = v.handler
+		mux.Handle("/"+v.name+"/", http.StripPrefix("/"+v.name, withAPIVersion(v.name, v.handler)))
+		for _, path := range v.legacyPaths {
+			legacyPaths[path] = true
+		}
+	}
+	negotiated := negotiateAPIVersion(handlers)
+	for path := range legacyPaths {
+		mux.Handle(path, deprecatedRoute(path, deprecations, negotiated))
+	}
+}
+
+// deprecatedRoute points clients of a legacy path at its versioned
+// successor.
+func deprecatedRoute(route string, deprecations *deprecationTracker, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deprecations.record(route, r.UserAgent())
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("</%s%s>; rel=\"successor-version\"", latestAPIVersion, r.URL.Path))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// negotiateAPIVersion dispatches unversioned requests to the version named
+// in the Accept-Version header, defaulting to the latest version.
+func negotiateAPIVersion(handlers map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.ToLower(strings.TrimSpace(r.Header.Get(acceptVersionHeader)))
+		if name == "" {
+			name = latestAPIVersion
+		}
+		handler, ok := handlers[name]
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, fmt.Errorf("unsupported API version: %s", name))
+			return
+		}
+		withAPIVersion(name, handler).ServeHTTP(w, r)
+	})
+}
+
+func withAPIVersion(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(apiVersionHeader, name)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegisterAPIVersions(t *testing.T) {
+	echo := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + " " + r.URL.Path))
+		})
+	}
+	mux := http.NewServeMux()
+	deprecations := newDeprecationTracker()
+	registerAPIVersions(mux, []apiVersion{
+		{name: "v1", handler: echo("v1"), legacyPaths: []string{"/users", "/users/"}},
+		{name: "v2", handler: echo("v2")},
+	}, deprecations)
+
+	var tests = []struct {
+		path           string
+		acceptVersion  string
+		expectedStatus int
+		expectedBody   string
+		expectedHeader string
+	}{
+		{path: "/v1/users/a@example.com", expectedStatus: 200, expectedBody: "v1 /users/a@example.com", expectedHeader: "v1"},
+		{path: "/v2/users", expectedStatus: 200, expectedBody: "v2 /users", expectedHeader: "v2"},
+		{path: "/users", expectedStatus: 200, expectedBody: "v1 /users", expectedHeader: "v1"},
+		{path: "/users/a@example.com", acceptVersion: "v2", expectedStatus: 200, expectedBody: "v2 /users/a@example.com", expectedHeader: "v2"},
+		{path: "/users", acceptVersion: "v9", expectedStatus: 400},
+		{path: "/posts", expectedStatus: 404},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.acceptVersion != "" {
+			req.Header.Set(acceptVersionHeader, tt.acceptVersion)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d", tt.path, w.Code, tt.expectedStatus)
+			continue
+		}
+		if tt.expectedStatus != 200 {
+			continue
+		}
+		if w.Body.String() != tt.expectedBody {
+			t.Errorf("%s: got %q, want %q", tt.path, w.Body.String(), tt.expectedBody)
+		}
+		if w.Header().Get(apiVersionHeader) != tt.expectedHeader {
+			t.Errorf("%s: got version %q, want %q", tt.path, w.Header().Get(apiVersionHeader), tt.expectedHeader)
+		}
+	}
+
+	// only the legacy paths are deprecated and counted
+	report := deprecations.report()
+	counts := map[string]int{}
+	for _, usage := range report.Usage {
+		counts[usage.Route] += usage.Requests
+	}
+	if len(counts) != 2 || counts["/users"] != 2 || counts["/users/"] != 1 {
+		t.Errorf("got deprecated route counts %v, want /users: 2, /users/: 1", counts)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if w.Header().Get("Deprecation") != "true" || w.Header().Get("Link") != `</v1/users>; rel="successor-version"` {
+		t.Errorf("got Deprecation %q and Link %q for a legacy path", w.Header().Get("Deprecation"), w.Header().Get("Link"))
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	if w.Header().Get("Deprecation") != "" {
+		t.Errorf("got Deprecation %q for a versioned path, want none", w.Header().Get("Deprecation"))
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	apiCfg := apiConfig{usersPrefix: "/users", postsprefix: "/posts"}
+	tags := allowMethods(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}, http.MethodGet)
+
+	var tests = []struct {
+		name           string
+		handler        http.HandlerFunc
+		method         string
+		path           string
+		expectedStatus int
+		expectedAllow  string
+	}{
+		{name: "user", handler: apiCfg.endpointUsersHandler, method: http.MethodPost, path: "/users/ann@example.com", expectedStatus: 405, expectedAllow: "DELETE, GET, HEAD, OPTIONS, PATCH, PUT"},
+		{name: "user by email", handler: apiCfg.endpointUsersHandler, method: http.MethodPost, path: "/users/by-email/ann@example.com", expectedStatus: 405, expectedAllow: "DELETE, GET, HEAD, OPTIONS, PATCH, PUT"},
+		{name: "users", handler: apiCfg.endpointUsersHandler, method: http.MethodGet, path: "/users", expectedStatus: 405, expectedAllow: "OPTIONS, POST"},
+		{name: "profile", handler: apiCfg.endpointUsersHandler, method: http.MethodDelete, path: "/users/@ann/profile", expectedStatus: 405, expectedAllow: "GET, HEAD, OPTIONS"},
+		{name: "unknown user path", handler: apiCfg.endpointUsersHandler, method: http.MethodGet, path: "/users/@ann/unknown", expectedStatus: 404},
+		{name: "posts", handler: apiCfg.endpointPostsHandler, method: http.MethodDelete, path: "/posts", expectedStatus: 405, expectedAllow: "GET, HEAD, OPTIONS, POST"},
+		{name: "dead links", handler: apiCfg.endpointPostsHandler, method: http.MethodPost, path: "/posts/deadlinks", expectedStatus: 405, expectedAllow: "GET, HEAD, OPTIONS"},
+		{name: "unknown post path", handler: apiCfg.endpointPostsHandler, method: http.MethodGet, path: "/posts/1/unknown", expectedStatus: 404},
+		{name: "messages", handler: apiCfg.endpointMessagesHandler, method: http.MethodPost, path: "/messages/unread", expectedStatus: 405, expectedAllow: "GET, HEAD, OPTIONS"},
+		{name: "oauth callback", handler: apiCfg.endpointOAuthHandler, method: http.MethodPost, path: "/auth/github/callback", expectedStatus: 405, expectedAllow: "GET, HEAD, OPTIONS"},
+		{name: "unknown oauth path", handler: apiCfg.endpointOAuthHandler, method: http.MethodGet, path: "/auth/github/unknown", expectedStatus: 404},
+		{name: "media", handler: apiCfg.endpointMediaHandler, method: http.MethodDelete, path: "/media/1", expectedStatus: 405, expectedAllow: "GET, HEAD, OPTIONS"},
+		{name: "sync", handler: apiCfg.endpointSyncHandler, method: http.MethodDelete, path: "/sync", expectedStatus: 405, expectedAllow: "GET, HEAD, OPTIONS, POST"},
+		{name: "read notifications", handler: apiCfg.endpointNotificationsHandler, method: http.MethodGet, path: "/notifications/read", expectedStatus: 405, expectedAllow: "OPTIONS, POST"},
+		{name: "tenant settings", handler: apiCfg.endpointAdminTenantsHandler, method: http.MethodDelete, path: "/admin/tenants/acme/settings", expectedStatus: 405, expectedAllow: "GET, HEAD, OPTIONS, PUT"},
+		{name: "backups", handler: apiCfg.endpointAdminBackupHandler, method: http.MethodDelete, path: "/admin/backup", expectedStatus: 405, expectedAllow: "GET, HEAD, OPTIONS, POST"},
+		{name: "single path", handler: tags, method: http.MethodPost, path: "/tags", expectedStatus: 405, expectedAllow: "GET, HEAD, OPTIONS"},
+		{name: "user options", handler: apiCfg.endpointUsersHandler, method: http.MethodOptions, path: "/users/@ann", expectedStatus: 204, expectedAllow: "DELETE, GET, HEAD, OPTIONS, PATCH, PUT"},
+		{name: "users options", handler: apiCfg.endpointUsersHandler, method: http.MethodOptions, path: "/users", expectedStatus: 204, expectedAllow: "OPTIONS, POST"},
+		{name: "unknown path options", handler: apiCfg.endpointUsersHandler, method: http.MethodOptions, path: "/users/@ann/unknown", expectedStatus: 404},
+		{name: "single path options", handler: tags, method: http.MethodOptions, path: "/tags", expectedStatus: 204, expectedAllow: "GET, HEAD, OPTIONS"},
+		{name: "single path head", handler: tags, method: http.MethodHead, path: "/tags", expectedStatus: 200},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.handler(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.expectedStatus || w.Header().Get("Allow") != tt.expectedAllow {
+			t.Errorf("%s: got status %d with Allow %q, want %d with %q: %s", tt.name, w.Code, w.Header().Get("Allow"), tt.expectedStatus, tt.expectedAllow, w.Body)
+		}
+	}
+}
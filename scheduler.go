@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// scheduledJob is background work repeated at a fixed interval.
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+// taskStatus is what GET /admin/tasks reports about a scheduled job.
+type taskStatus struct {
+	Name     string `json:"name"`
+	Interval string `json:"interval"`
+	Enabled  bool   `json:"enabled"`
+	Running  bool   `json:"running"`
+	Runs     int    `json:"runs"`
+	// LastError is empty if the last run succeeded.
+	LastError    string     `json:"lastError,omitempty"`
+	LastRunAt    *time.Time `json:"lastRunAt,omitempty"`
+	LastDuration string     `json:"lastDuration,omitempty"`
+	NextRunAt    *time.Time `json:"nextRunAt,omitempty"`
+}
+
+// scheduler tracks the status of the running jobs.
+type scheduler struct {
+	mu       sync.Mutex
+	statuses map[string]*taskStatus
+}
+
+// startScheduler runs every job right away and then once per interval, each
+// in its own goroutine, until ctx is done. Jobs with a zero interval are
+// disabled. A job that panics is logged and retried on its next tick.
+func startScheduler(ctx context.Context, jobs []scheduledJob) *scheduler {
+	s := &scheduler{statuses: map[string]*taskStatus{}}
+	for _, job := range jobs {
+		s.statuses[job.name] = &taskStatus{
+			Name:     job.name,
+			Interval: job.interval.String(),
+			Enabled:  job.interval > 0,
+		}
+	}
+	// The loops read statuses under s.mu, so start them only once the map
+	// is complete.
+	for _, job := range jobs {
+		if job.interval <= 0 {
+			continue
+		}
+		go s.loop(ctx, job)
+	}
+	return s
+}
+
+func (s *scheduler) loop(ctx context.Context, job scheduledJob) {
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+	for {
+		s.runOnce(ctx, job)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *scheduler) runOnce(ctx context.Context, job scheduledJob) {
+	start := time.Now()
+	s.update(job.name, func(status *taskStatus) {
+		status.Running = true
+	})
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("scheduler: %s panicked: %v", job.name, r)
+			err = fmt.Errorf("panic: %v", r)
+		}
+		s.update(job.name, func(status *taskStatus) {
+			status.Running = false
+			status.Runs++
+			status.LastError = ""
+			if err != nil {
+				status.LastError = err.Error()
+			}
+			lastRunAt := start.UTC()
+			nextRunAt := lastRunAt.Add(job.interval)
+			status.LastRunAt = &lastRunAt
+			status.LastDuration = time.Since(start).String()
+			status.NextRunAt = &nextRunAt
+		})
+	}()
+	err = job.run(ctx)
+	if err != nil {
+		log.Printf("scheduler: %s: %v", job.name, err)
+	}
+}
+
+func (s *scheduler) update(name string, fn func(status *taskStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.statuses[name])
+}
+
+// tasks returns a copy of every job's status, ordered by name.
+func (s *scheduler) tasks() []taskStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tasks := make([]taskStatus, 0, len(s.statuses))
+	for _, status := range s.statuses {
+		tasks = append(tasks, *status)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Name < tasks[j].Name
+	})
+	return tasks
+}
+
+func (apiCfg apiConfig) handlerAdminTasks(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, apiCfg.scheduler.tasks())
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSchedulerStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	s := startScheduler(ctx, []scheduledJob{
+		{name: "failing", interval: time.Hour, run: func(ctx context.Context) error {
+			defer close(done)
+			return errors.New("boom")
+		}},
+		{name: "disabled", run: func(ctx context.Context) error {
+			t.Error("disabled job ran")
+			return nil
+		}},
+	})
+	<-done
+
+	var tasks []taskStatus
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		tasks = s.tasks()
+		if tasks[1].Runs > 0 {
+			break
+		}
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("got %d tasks, want 2", len(tasks))
+	}
+	disabled, failing := tasks[0], tasks[1]
+	if disabled.Enabled || disabled.Runs != 0 {
+		t.Errorf("disabled task: got enabled %v, runs %d, want false, 0", disabled.Enabled, disabled.Runs)
+	}
+	if !failing.Enabled || failing.Runs != 1 || failing.LastError != "boom" {
+		t.Errorf("failing task: got enabled %v, runs %d, error %q, want true, 1, %q", failing.Enabled, failing.Runs, failing.LastError, "boom")
+	}
+	if failing.LastRunAt == nil || failing.NextRunAt == nil || failing.NextRunAt.Sub(*failing.LastRunAt) != time.Hour {
+		t.Errorf("failing task: got last run %v, next run %v, want an hour apart", failing.LastRunAt, failing.NextRunAt)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/search"
+)
+
+const (
+	searchKindUser = "user"
+	searchKindPost = "post"
+)
+
+// searchIndex keeps the full-text index in step with the database. Writes
+// through the API update it as they happen, the scheduler rebuilds it to pick
+// up writes it can't see, like replicated changes or CLI commands.
+type searchIndex struct {
+	// mu stops a rebuild from overwriting a write made while it was
+	// reading the database.
+	mu    sync.Mutex
+	index *search.Index
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{index: search.NewIndex()}
+}
+
+func userDocument(user database.User) search.Document {
+	return search.Document{Kind: searchKindUser, ID: user.ID, Text: user.Name + " " + user.Email}
+}
+
+func postDocument(post database.Post) search.Document {
+	return search.Document{Kind: searchKindPost, ID: post.ID, Text: post.Text + " " + strings.Join(post.Tags, " ")}
+}
+
+func (s *searchIndex) rebuild(c database.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users, err := c.GetAllUsers()
+	if err != nil {
+		log.Printf("search index: %v", err)
+		return
+	}
+	posts, err := c.GetAllPosts()
+	if err != nil {
+		log.Printf("search index: %v", err)
+		return
+	}
+	docs := make([]search.Document, 0, len(users)+len(posts))
+	for _, user := range users {
+		docs = append(docs, userDocument(user))
+	}
+	for _, post := range posts {
+		docs = append(docs, postDocument(post))
+	}
+	s.index.Reset(docs)
+}
+
+// applyMutations is the database mutation hook updating the index.
+func (s *searchIndex) applyMutations(mutations []database.Mutation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, mutation := range mutations {
+		var doc search.Document
+		var err error
+		switch {
+		case mutation.Collection != "users" && mutation.Collection != "posts":
+			continue
+		case mutation.Value == nil:
+			s.index.Remove(strings.TrimSuffix(mutation.Collection, "s"), mutation.Key)
+			continue
+		case mutation.Collection == "users":
+			user := database.User{}
+			err = json.Unmarshal(mutation.Value, &user)
+			doc = userDocument(user)
+		default:
+			post := database.Post{}
+			err = json.Unmarshal(mutation.Value, &post)
+			doc = postDocument(post)
+		}
+		if err != nil {
+			log.Printf("search index: %s %s: %v", mutation.Collection, mutation.Key, err)
+			continue
+		}
+		s.index.Put(doc)
+	}
+}
+
+type searchResult struct {
+	Type  string         `json:"type"`
+	Score float64        `json:"score"`
+	User  *database.User `json:"user,omitempty"`
+	Post  *database.Post `json:"post,omitempty"`
+}
+
+// handlerSearch ranks users and posts matching ?q=, optionally only one kind
+// with ?type=user or ?type=post.
+func (apiCfg apiConfig) handlerSearch(w http.ResponseWriter, r *http.Request) {
+	// get params
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("q is required")))
+		return
+	}
+	kind := query.Get("type")
+	if kind != "" && kind != searchKindUser && kind != searchKindPost {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("type must be user or post")))
+		return
+	}
+	pg, err := apiCfg.pagination.parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// rank matches
+	matches := []search.Result{}
+	for _, match := range apiCfg.search.index.Search(q) {
+		if kind == "" || match.Kind == kind {
+			matches = append(matches, match)
+		}
+	}
+
+	// look up the records of the page, skipping any deleted since indexing
+	viewerID, _ := apiCfg.authenticatedUserID(r)
+	results := []searchResult{}
+	for _, match := range paginate(w, r, matches, pg) {
+		result := searchResult{Type: match.Kind, Score: match.Score}
+		switch match.Kind {
+		case searchKindUser:
+			user, err := apiCfg.dbClient.GetUser(match.ID)
+			if err != nil {
+				continue
+			}
+			user = userForViewer(user, viewerID)
+			result.User = &user
+		case searchKindPost:
+			// the posts of suspended and blocked users are hidden
+			post, err := apiCfg.postsFor(r).Get(match.ID)
+			if err != nil {
+				continue
+			}
+			result.Post = &post
+		}
+		results = append(results, result)
+	}
+	respondWithJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestHandlerSearch(t *testing.T) {
+	index := newSearchIndex()
+	c := database.NewMemoryClient().WithMutationHook(index.applyMutations)
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.CreateUser("gopher@example.com", "12345", "Gopher", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := c.CreatePost(user.ID, "learning go today with friends", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.CreatePost(user.ID, "rust is fun", []string{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := c.CreatePost(user.ID, "go away", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.DeletePost(deleted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:   c,
+		search:     index,
+		pagination: paginationConfig{defaultLimit: 10, maxLimit: 10},
+	}
+
+	var tests = []struct {
+		query          string
+		expectedStatus int
+		expected       []string
+	}{
+		{query: "?q=go", expectedStatus: http.StatusOK, expected: []string{second.ID, first.ID}},
+		{query: "?q=gophers", expectedStatus: http.StatusOK, expected: []string{user.ID}},
+		{query: "?q=learned&type=user", expectedStatus: http.StatusOK, expected: []string{}},
+		{query: "?q=", expectedStatus: http.StatusBadRequest},
+		{query: "?q=go&type=tag", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		apiCfg.handlerSearch(w, httptest.NewRequest(http.MethodGet, "/search"+tt.query, nil))
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.query, w.Code, tt.expectedStatus, w.Body)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		results := []searchResult{}
+		err = json.NewDecoder(w.Body).Decode(&results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, result := range results {
+			if result.User != nil {
+				got = append(got, result.User.ID)
+			}
+			if result.Post != nil {
+				got = append(got, result.Post.ID)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	seedFirstNames = []string{"Ada", "Alan", "Barbara", "Dennis", "Edsger", "Frances", "Grace", "Guido", "Hedy", "John", "Ken", "Linus", "Margaret", "Niklaus", "Radia", "Rob", "Sophie", "Tim"}
+	seedLastNames  = []string{"Allen", "Dijkstra", "Hamilton", "Hopper", "Kernighan", "Lamarr", "Liskov", "Lovelace", "McCarthy", "Perlman", "Pike", "Ritchie", "Thompson", "Torvalds", "Turing", "Wilson", "Wirth"}
+	seedTags       = []string{"go", "golang", "backend", "devops", "testing", "career", "til", "release"}
+	seedWords      = []string{"api", "backend", "bug", "cache", "compiler", "database", "deploy", "function", "go", "goroutine", "interface", "latency", "merge", "pointer", "query", "refactor", "release", "server", "slice", "test", "today", "working", "on", "fixed", "shipped", "finally", "the", "a", "new", "my"}
+)
+
+// seedRecords generates users and posts from a deterministic random source,
+// so the same seed always produces the same data. Posts per user vary
+// around postsPerUser to make pagination and search more realistic.
+func seedRecords(seed int64, users, postsPerUser int, now time.Time) []database.ImportRecord {
+	rng := rand.New(rand.NewSource(seed))
+	records := []database.ImportRecord{}
+	posts := []database.ImportRecord{}
+	for i := 0; i < users; i++ {
+		first := seedFirstNames[rng.Intn(len(seedFirstNames))]
+		last := seedLastNames[rng.Intn(len(seedLastNames))]
+		id, err := uuid.NewRandomFromReader(rng)
+		if err != nil {
+			panic(err)
+		}
+		user := database.User{
+			ID:        id.String(),
+			CreatedAt: now.Add(-time.Duration(rng.Int63n(int64(365 * 24 * time.Hour)))).Truncate(time.Second),
+			Email:     fmt.Sprintf("%s.%s.%d@example.com", strings.ToLower(first), strings.ToLower(last), i),
+			Password:  fmt.Sprintf("seed-%08x", rng.Uint32()),
+			Name:      first + " " + last,
+			Age:       18 + rng.Intn(60),
+		}
+		records = append(records, database.ImportRecord{User: &user})
+
+		count := 0
+		if postsPerUser > 0 {
+			count = rng.Intn(2*postsPerUser + 1)
+		}
+		for j := 0; j < count; j++ {
+			id, err := uuid.NewRandomFromReader(rng)
+			if err != nil {
+				panic(err)
+			}
+			posts = append(posts, database.ImportRecord{Post: &database.Post{
+				ID:        id.String(),
+				CreatedAt: user.CreatedAt.Add(time.Duration(rng.Int63n(int64(now.Sub(user.CreatedAt)) + 1))).Truncate(time.Second),
+				UserID:    user.ID,
+				Text:      seedSentence(rng),
+				Tags:      seedPostTags(rng),
+			}})
+		}
+	}
+	return append(records, posts...)
+}
+
+func seedPostTags(rng *rand.Rand) []string {
+	tags := []string{}
+	for _, i := range rng.Perm(len(seedTags))[:rng.Intn(4)] {
+		tags = append(tags, seedTags[i])
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+func seedSentence(rng *rand.Rand) string {
+	words := make([]string, 4+rng.Intn(16))
+	for i := range words {
+		words[i] = seedWords[rng.Intn(len(seedWords))]
+	}
+	words[0] = strings.ToUpper(words[0][:1]) + words[0][1:]
+	return strings.Join(words, " ") + "."
+}
+
+type seedReport struct {
+	Users  int `json:"users"`
+	Posts  int `json:"posts"`
+	Failed int `json:"failed"`
+}
+
+func runDBSeed(cfg config, args []string) error {
+	flags := flag.NewFlagSet("db seed", flag.ContinueOnError)
+	users := flags.Int("n", 100, "number of users to create")
+	postsPerUser := flags.Int("posts", 5, "average number of posts per user")
+	seed := flags.Int64("seed", 1, "random seed, the same seed produces the same data")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *users < 0 || *postsPerUser < 0 {
+		return fmt.Errorf("-n and -posts can't be negative")
+	}
+
+	c, err := openCLIDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	records := seedRecords(*seed, *users, *postsPerUser, time.Now().UTC())
+	errs, err := c.Import(records)
+	if err != nil {
+		return err
+	}
+	report := seedReport{}
+	for i, err := range errs {
+		switch {
+		case err != nil:
+			report.Failed++
+		case records[i].User != nil:
+			report.Users++
+		default:
+			report.Posts++
+		}
+	}
+	return printJSON(report)
+}
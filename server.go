@@ -0,0 +1,532 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/audit"
+	"github.com/firyx/boot.dev-api-backend/internal/backup"
+	"github.com/firyx/boot.dev-api-backend/internal/botcheck"
+	"github.com/firyx/boot.dev-api-backend/internal/bundle"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/errreport"
+	"github.com/firyx/boot.dev-api-backend/internal/jobs"
+	"github.com/firyx/boot.dev-api-backend/internal/linkcheck"
+	"github.com/firyx/boot.dev-api-backend/internal/pwned"
+	"github.com/firyx/boot.dev-api-backend/internal/replication"
+	"github.com/firyx/boot.dev-api-backend/internal/rotate"
+	"github.com/firyx/boot.dev-api-backend/internal/storage"
+)
+
+func runServer(cfg config) error {
+	s, err := newServer(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.stop()
+	return serveAll(s.servers, cfg, s.handoff)
+}
+
+// server is everything runServer sets up before listening, so tests can
+// drive the same handlers.
+type server struct {
+	apiCfg apiConfig
+	// servers has one server per configured listener, in order.
+	servers []*http.Server
+	// stop ends the background work started with the server.
+	stop func()
+	// handoff passes the listeners to the process replacing this one.
+	handoff *handoff
+}
+
+func newServer(cfg config) (*server, error) {
+	c, err := openDatabase(cfg.dbBackend, cfg.dbPath, cfg.walEnabled)
+	if err != nil {
+		return nil, err
+	}
+	if c.InMemory() {
+		log.Printf("DB_BACKEND is memory, nothing written will survive a restart")
+	}
+	integrity := c.Integrity()
+	if !integrity.OK {
+		if !cfg.forceStart {
+			return nil, fmt.Errorf("database integrity check failed, restore a backup or start with -force: %s", integrity.Error)
+		}
+		log.Printf("database integrity check failed, starting anyway: %s", integrity.Error)
+		err = c.ResetChecksum()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var replicationNode *replication.Node
+	if cfg.replicationRole != "" {
+		replicationLog, err := replication.OpenLog(cfg.replicationLog)
+		if err != nil {
+			return nil, fmt.Errorf("replication log: %w", err)
+		}
+		replicationNode, err = replication.NewNode(replicationLog, c, replication.Role(cfg.replicationRole), cfg.replicationPrimaryURL, cfg.replicationPollInterval)
+		if err != nil {
+			return nil, err
+		}
+		c = c.WithMutationHook(replicationNode.Record)
+		if cfg.replicationLeaseFile != "" {
+			replicationNode.EnableFailover(replication.Failover{
+				Lease:         replication.NewLease(cfg.replicationLeaseFile, cfg.replicationNodeID, cfg.replicationLeaseTTL),
+				CheckInterval: cfg.replicationCheckInterval,
+				FailAfter:     cfg.replicationFailAfter,
+			})
+		}
+	}
+
+	mediaStore, err := newMediaStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("media storage: %w", err)
+	}
+	allowedTypes := map[string]bool{}
+	for _, contentType := range cfg.mediaAllowedTypes {
+		allowedTypes[strings.TrimSpace(contentType)] = true
+	}
+
+	secret := cfg.jwtSecret
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, err = rand.Read(secret)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("JWT_SECRET isn't set, sessions won't survive a restart")
+	}
+
+	queue := jobs.NewQueue(c, jobs.Options{
+		Workers:      cfg.jobWorkers,
+		MaxAttempts:  cfg.jobMaxAttempts,
+		Backoff:      cfg.jobBackoff,
+		MaxBackoff:   cfg.jobMaxBackoff,
+		PollInterval: cfg.jobPollInterval,
+		Retention:    cfg.jobRetention,
+	})
+
+	emails, err := newMailer(cfg, c, queue)
+	if err != nil {
+		return nil, fmt.Errorf("email: %w", err)
+	}
+	translator, err := newTranslator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ipSources, err := loadIPSources(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ipFilter := &ipFilter{source: ipSources, policy: cfg.ipPolicy}
+	moderationFilter, err := newModeration(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	apiCfg := apiConfig{
+		usersPrefix: "/users",
+		postsprefix: "/posts",
+		buildInfo:   readBuildInfo(),
+		replication: replicationNode,
+		media: mediaConfig{
+			store:           mediaStore,
+			maxSize:         int64(cfg.mediaMaxSizeMB) * 1024 * 1024,
+			allowedTypes:    allowedTypes,
+			presignExpiry:   cfg.mediaPresignExpiry,
+			attachmentQuota: int64(cfg.attachmentQuotaMB) * 1024 * 1024,
+		},
+		audit:        audit.NewLog(cfg.auditLog),
+		throttle:     newCostThrottle(cfg.throttleBudget, cfg.throttleRouteCosts),
+		deprecations: newDeprecationTracker(),
+		rollouts:     newRollouts(cfg.rollouts),
+		backups: backup.Store{
+			Dir:        cfg.backupDir,
+			Gzip:       cfg.backupGzip,
+			MaxBackups: cfg.backupMaxFiles,
+			MaxAge:     cfg.backupMaxAge,
+		},
+		jobs:       queue,
+		mailer:     emails,
+		translator: translator,
+		moderation: moderationFilter,
+		signup: signupConfig{
+			checker:        botcheck.Checker{MinFillTime: cfg.signupMinFillTime},
+			honeypotFields: cfg.signupHoneypotFields,
+			reviewScore:    cfg.signupReviewScore,
+			rejectScore:    cfg.signupRejectScore,
+		},
+		auth: authConfig{
+			secret:        secret,
+			sessionTTL:    cfg.sessionTTL,
+			maxFailures:   cfg.loginMaxFailures,
+			failureWindow: cfg.loginFailureWindow,
+			lockout:       cfg.loginLockout,
+		},
+		totpIssuer: cfg.totpIssuer,
+		breaches: breachChecker{client: pwned.Client{
+			URL:    cfg.passwordBreachURL,
+			Client: &http.Client{Timeout: 5 * time.Second},
+		}},
+		passwords:     cfg.passwordHasher,
+		postLimits:    cfg.postLimits,
+		syncConflicts: cfg.syncConflicts,
+		oauth:         newOAuthConfig(cfg),
+		pagination: paginationConfig{
+			defaultLimit: cfg.pageSizeDefault,
+			maxLimit:     cfg.pageSizeMax,
+		},
+		bundles: bundleConfig{
+			options: bundle.Options{
+				Passphrase: cfg.exportPassphrase,
+				SigningKey: cfg.exportSigningKey,
+			},
+			trustedKeys: cfg.exportTrustedKeys,
+		},
+	}
+
+	// the main database is served like a tenant without an ID
+	mainTenant := newTenant(apiCfg, "", c)
+	mainTenant.apiCfg.settings.set(database.TenantSettings{PasswordPolicy: cfg.passwordPolicy})
+	apiCfg = mainTenant.apiCfg
+	apiCfg.tenants = newTenants(mainTenant, cfg.tenantsDir, cfg.tenantBaseDomain)
+	apiCfg.tenants.walEnabled = cfg.walEnabled
+	apiCfg.tenants.backend = cfg.dbBackend
+	// background jobs cover the main database and every tenant opened since
+	// the server started
+	everyTenant := apiCfg.tenants.all
+
+	queue.Handle(jobAwardBadges, apiCfg.runAwardBadgesJob)
+	queue.Handle(jobSendEmail, emails.runSendEmailJob)
+	ctx, cancel := context.WithCancel(context.Background())
+	closers := []io.Closer{}
+	if emails.pool != nil {
+		closers = append(closers, emails.pool)
+	}
+	stop := func() {
+		cancel()
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+	// a secondary's database only changes through replication, until it's
+	// promoted
+	if replicationNode == nil || replicationNode.IsPrimary() {
+		err = queue.Start(ctx)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("job queue: %w", err)
+		}
+	} else {
+		replicationNode.OnPromote(func() {
+			// it missed the writes replicated so far
+			apiCfg.exists.rebuild(apiCfg.dbClient)
+			err := queue.Start(ctx)
+			if err != nil {
+				log.Printf("job queue: %v", err)
+			}
+		})
+	}
+	if replicationNode != nil {
+		closers = append(closers, replicationNode)
+		err = replicationNode.Start()
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("replication: %w", err)
+		}
+	}
+	reminders := newStreakReminders()
+	metrics := newRequestMetrics()
+	var snapshotFile io.Writer
+	if cfg.metricsSnapshotFile != "" {
+		file := rotate.NewWriter(cfg.metricsSnapshotFile, rotate.Options{
+			MaxSize:    int64(cfg.metricsSnapshotMaxSizeMB) * 1024 * 1024,
+			MaxBackups: cfg.metricsSnapshotMaxBackups,
+		})
+		closers = append(closers, file)
+		snapshotFile = file
+	}
+	metricsHistory := newMetricsHistory(cfg.metricsHistorySize, snapshotFile)
+	tracer := newTracer(cfg)
+	if tracer != nil {
+		closers = append(closers, tracer)
+	}
+
+	checker := linkcheck.NewChecker(10 * time.Second)
+	apiCfg.scheduler = startScheduler(ctx, []scheduledJob{
+		{name: "dead links", interval: cfg.deadLinkInterval, run: func(ctx context.Context) error {
+			for _, t := range everyTenant() {
+				t.apiCfg.checkDeadLinks(ctx, checker)
+			}
+			return nil
+		}},
+		{name: "leaderboards", interval: cfg.leaderboardInterval, run: func(ctx context.Context) error {
+			for _, t := range everyTenant() {
+				t.apiCfg.leaderboards.recompute(t.apiCfg.dbClient)
+			}
+			return nil
+		}},
+		{name: "search index", interval: cfg.searchRebuildInterval, run: func(ctx context.Context) error {
+			for _, t := range everyTenant() {
+				t.apiCfg.search.rebuild(t.apiCfg.dbClient)
+			}
+			return nil
+		}},
+		{name: "existence filters", interval: cfg.existenceRebuildInterval, run: func(ctx context.Context) error {
+			for _, t := range everyTenant() {
+				t.apiCfg.exists.rebuild(t.apiCfg.dbClient)
+			}
+			return nil
+		}},
+		{name: "streak reminders", interval: cfg.streakCheckInterval, run: func(ctx context.Context) error {
+			for _, t := range everyTenant() {
+				reminders.check(t.apiCfg.dbClient, t.bus, time.Now())
+			}
+			return nil
+		}},
+		{name: "compact database", interval: cfg.compactInterval, run: func(ctx context.Context) error {
+			errs := []error{}
+			for _, t := range everyTenant() {
+				errs = append(errs, t.apiCfg.compactDatabase())
+			}
+			return errors.Join(errs...)
+		}},
+		{name: "purge login attempts", interval: cfg.loginPurgeInterval, run: func(ctx context.Context) error {
+			errs := []error{}
+			for _, t := range everyTenant() {
+				errs = append(errs, t.apiCfg.purgeLoginAttempts(time.Now()))
+			}
+			return errors.Join(errs...)
+		}},
+		{name: "purge sessions", interval: cfg.loginPurgeInterval, run: func(ctx context.Context) error {
+			errs := []error{}
+			for _, t := range everyTenant() {
+				errs = append(errs, t.apiCfg.purgeSessions(time.Now()))
+			}
+			return errors.Join(errs...)
+		}},
+		{name: "purge email tokens", interval: cfg.loginPurgeInterval, run: func(ctx context.Context) error {
+			errs := []error{}
+			for _, t := range everyTenant() {
+				errs = append(errs, t.apiCfg.purgeEmailTokens(time.Now()))
+			}
+			return errors.Join(errs...)
+		}},
+		{name: "purge revoked tokens", interval: cfg.loginPurgeInterval, run: func(ctx context.Context) error {
+			errs := []error{}
+			for _, t := range everyTenant() {
+				errs = append(errs, t.apiCfg.purgeRevokedTokens(time.Now()))
+			}
+			return errors.Join(errs...)
+		}},
+		{name: "lift expired suspensions", interval: cfg.loginPurgeInterval, run: func(ctx context.Context) error {
+			errs := []error{}
+			for _, t := range everyTenant() {
+				errs = append(errs, t.apiCfg.purgeSuspensions(time.Now()))
+			}
+			return errors.Join(errs...)
+		}},
+		{name: "metrics snapshot", interval: cfg.metricsSnapshotInterval, run: func(ctx context.Context) error {
+			return metricsHistory.record(metrics.snapshot(time.Now()))
+		}},
+		{name: "daily stats", interval: cfg.statsInterval, run: func(ctx context.Context) error {
+			errs := []error{}
+			for _, t := range everyTenant() {
+				errs = append(errs, t.apiCfg.logDailyStats(time.Now()))
+			}
+			return errors.Join(errs...)
+		}},
+	})
+
+	versions := apiCfg.apiVersions()
+	if cfg.canaryDBPath != "" {
+		canaryClient := database.NewClient(cfg.canaryDBPath)
+		err = canaryClient.EnsureDB()
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("canary database: %w", err)
+		}
+		canaryCfg := apiCfg
+		canaryCfg.dbClient = canaryClient
+		versions = withCanary(versions, canaryCfg.apiVersions(), cfg.canaryPercent)
+	}
+	// the sample file is only created once a request is sampled, and
+	// sampling, throttling and the IP policy can be turned on by a reload
+	sampleWriter := rotate.NewWriter(cfg.sampleFile, rotate.Options{
+		MaxSize:    int64(cfg.sampleMaxSizeMB) * 1024 * 1024,
+		MaxBackups: cfg.sampleMaxFiles,
+	})
+	closers = append(closers, sampleWriter)
+	sampler := &requestSampler{
+		defaultRate: cfg.sampleRate,
+		routeRates:  cfg.sampleRouteRates,
+		out:         sampleWriter,
+	}
+	throttle := apiCfg.throttle
+	reloads := &reloader{throttle: throttle, sampler: sampler, ipFilter: ipFilter, rollouts: apiCfg.rollouts, load: loadConfig}
+	reloads.watchSignals(ctx)
+	restarts, err := newHandoff(cfg.pidFile)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	restarts.drain = cancel
+	registerRoutes := map[string]func(serveMux *http.ServeMux){
+		"api": func(serveMux *http.ServeMux) {
+			registerAPIVersions(serveMux, versions, apiCfg.deprecations)
+			serveMux.HandleFunc("/version", allowMethods(apiCfg.traced(apiConfig.handlerVersion), http.MethodGet))
+			serveMux.HandleFunc("/healthz", allowMethods(apiCfg.traced(apiConfig.handlerHealthz), http.MethodGet))
+			serveMux.HandleFunc("/docs/changelog", allowMethods(apiCfg.traced(apiConfig.handlerGetChangelog), http.MethodGet))
+		},
+		"admin": func(serveMux *http.ServeMux) {
+			serveMux.HandleFunc("/metrics", allowMethods(metrics.handlerMetrics, http.MethodGet))
+			serveMux.HandleFunc("/admin/metrics/history", allowMethods(metricsHistory.handlerMetricsHistory, http.MethodGet))
+			serveMux.HandleFunc("/admin/dashboard", allowMethods(apiCfg.traced(apiConfig.handlerAdminDashboard), http.MethodGet))
+			serveMux.HandleFunc("/admin/dashboard/data", allowMethods(apiCfg.dashboardDataHandler(metricsHistory), http.MethodGet))
+			serveMux.HandleFunc("/admin/reload", allowMethods(reloads.handlerReload, http.MethodPost))
+			serveMux.HandleFunc("/admin/restart", allowMethods(restarts.handlerRestart, http.MethodPost))
+			registerDebugRoutes(serveMux)
+			serveMux.HandleFunc("/admin/import", allowMethods(apiCfg.traced(apiConfig.handlerImport), http.MethodPost))
+			serveMux.HandleFunc("/admin/users.csv", allowMethods(apiCfg.traced(apiConfig.handlerExportUsersCSV), http.MethodGet))
+			serveMux.HandleFunc("/admin/posts.csv", allowMethods(apiCfg.traced(apiConfig.handlerExportPostsCSV), http.MethodGet))
+			serveMux.HandleFunc("/admin/export.bundle", allowMethods(apiCfg.traced(apiConfig.handlerExportBundle), http.MethodGet))
+			serveMux.HandleFunc("/admin/audit", allowMethods(apiCfg.traced(apiConfig.handlerAdminAudit), http.MethodGet))
+			serveMux.HandleFunc("/admin/stats", allowMethods(apiCfg.traced(apiConfig.handlerAdminStats), http.MethodGet))
+			serveMux.HandleFunc("/admin/query", allowMethods(apiCfg.traced(apiConfig.handlerAdminQuery), http.MethodPost))
+			serveMux.HandleFunc("/admin/storage", allowMethods(apiCfg.traced(apiConfig.handlerAdminStorage), http.MethodGet))
+			serveMux.HandleFunc("/admin/users/", apiCfg.traced(apiConfig.endpointAdminUsersHandler))
+			serveMux.HandleFunc("/admin/suspensions", allowMethods(apiCfg.traced(apiConfig.handlerAdminSuspensions), http.MethodGet))
+			serveMux.HandleFunc("/admin/moderation", apiCfg.traced(apiConfig.endpointAdminModerationHandler))
+			serveMux.HandleFunc("/admin/moderation/", apiCfg.traced(apiConfig.endpointAdminModerationHandler))
+			serveMux.HandleFunc("/admin/signups", apiCfg.traced(apiConfig.endpointAdminSignupsHandler))
+			serveMux.HandleFunc("/admin/signups/", apiCfg.traced(apiConfig.endpointAdminSignupsHandler))
+			serveMux.HandleFunc("/admin/tenants", apiCfg.traced(apiConfig.endpointAdminTenantsHandler))
+			serveMux.HandleFunc("/admin/tenants/", apiCfg.traced(apiConfig.endpointAdminTenantsHandler))
+			serveMux.HandleFunc("/admin/jobs", allowMethods(apiCfg.traced(apiConfig.handlerAdminJobs), http.MethodGet))
+			serveMux.HandleFunc("/admin/emails", allowMethods(apiCfg.traced(apiConfig.handlerAdminEmails), http.MethodGet))
+			serveMux.HandleFunc("/admin/emails/", apiCfg.traced(apiConfig.endpointAdminEmailHandler))
+			serveMux.HandleFunc("/admin/tasks", allowMethods(apiCfg.traced(apiConfig.handlerAdminTasks), http.MethodGet))
+			serveMux.HandleFunc("/admin/backup", apiCfg.traced(apiConfig.endpointAdminBackupHandler))
+			serveMux.HandleFunc("/admin/deprecations", allowMethods(apiCfg.traced(apiConfig.handlerAdminDeprecations), http.MethodGet))
+			serveMux.HandleFunc("/admin/restore", allowMethods(apiCfg.traced(apiConfig.handlerRestoreBackup), http.MethodPost))
+			if apiCfg.replication != nil {
+				serveMux.HandleFunc("/admin/replication/log", allowMethods(apiCfg.traced(apiConfig.handlerReplicationLog), http.MethodGet))
+				serveMux.HandleFunc("/admin/replication/status", allowMethods(apiCfg.traced(apiConfig.handlerReplicationStatus), http.MethodGet))
+				serveMux.HandleFunc("/admin/replication/promote", allowMethods(apiCfg.traced(apiConfig.handlerPromote), http.MethodPost))
+			}
+			if _, ok := apiCfg.restoreJournal(); ok {
+				serveMux.HandleFunc("/admin/restore/point-in-time", allowMethods(apiCfg.traced(apiConfig.handlerPointInTimeRestore), http.MethodPost))
+			}
+		},
+	}
+
+	var reporter errreport.Reporter = errreport.LogReporter{}
+	if cfg.sentryDSN != "" {
+		reporter, err = errreport.NewSentryReporter(cfg.sentryDSN, cfg.sentryEnvironment)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("invalid SENTRY_DSN: %w", err)
+		}
+	}
+	release := cfg.release
+	if release == "" {
+		release = apiCfg.buildInfo.Version
+	}
+	reporting := errorReporting{reporter: reporter, release: release}
+	recovery := panicRecovery{errors: reporting, metrics: metrics, logStack: cfg.panicLogStack}
+	// outer adds the middleware that passes every request on, gRPC calls
+	// included
+	outer := func(handler http.Handler) http.Handler {
+		// outside the reporting, audit and panic recovery, which name the user
+		handler = apiCfg.sessionMiddleware(handler)
+		handler = metrics.middleware(handler)
+		handler = versionHeaderMiddleware(apiCfg.buildInfo.Version, handler)
+		if tracer != nil {
+			handler = tracingMiddleware(tracer, handler)
+		}
+		return requestIDMiddleware(handler)
+	}
+	// wrap adds the middleware every listener shares
+	wrap := func(handler http.Handler) http.Handler {
+		if cfg.bodyMaxSizeKB > 0 || cfg.adminBodyMaxSizeMB > 0 {
+			handler = bodyLimitMiddleware(int64(cfg.bodyMaxSizeKB)*1024, int64(cfg.adminBodyMaxSizeMB)*1024*1024, handler)
+		}
+		handler = responseFormatMiddleware(handler)
+		if apiCfg.replication != nil {
+			handler = apiCfg.readOnlyReplicaMiddleware(handler)
+		}
+		handler = apiCfg.throttleMiddleware(throttle, handler)
+		handler = reporting.middleware(handler)
+		handler = sampler.middleware(handler)
+		handler = auditMiddleware(apiCfg.audit, handler)
+		// inside the metrics, so recovered requests are counted as 500s
+		if cfg.recoverPanics {
+			handler = recovery.middleware(handler)
+		}
+		return outer(handler)
+	}
+
+	servers := []*http.Server{}
+	for _, l := range configuredListeners(cfg) {
+		serveMux := http.NewServeMux()
+		for _, routes := range l.routes {
+			registerRoutes[routes](serveMux)
+		}
+		var handler http.Handler = serveMux
+		if l.serves("api") {
+			// tenants only have their own API routes
+			handler = apiCfg.tenants.middleware(handler)
+			handler = ipFilter.middleware(handler)
+		}
+		servers = append(servers, &http.Server{
+			Handler:      wrap(handler),
+			Addr:         l.addr,
+			WriteTimeout: 30 * time.Second,
+			ReadTimeout:  30 * time.Second,
+		})
+		log.Printf("serving %s (%s) on %s", apiCfg.buildInfo.Version, apiCfg.buildInfo.Commit, l)
+	}
+	if cfg.grpcAddr != "" {
+		grpcServer := apiCfg.grpcServer(cfg.grpcAddr, recovery, cfg.bodyMaxSizeKB*1024)
+		grpcServer.Handler = outer(grpcServer.Handler)
+		servers = append(servers, grpcServer)
+		log.Printf("serving gRPC on %s", cfg.grpcAddr)
+	}
+	return &server{apiCfg: apiCfg, servers: servers, stop: stop, handoff: restarts}, nil
+}
+
+// openDatabase opens a database file, first finishing any writes a crash
+// interrupted if it has a write-ahead log. The memory backend starts from
+// an empty database instead.
+func openDatabase(backend, path string, walEnabled bool) (database.Client, error) {
+	if backend == "memory" {
+		return database.NewMemoryClient(), nil
+	}
+	c := database.NewClient(path)
+	if walEnabled {
+		c = c.WithWAL(path + ".wal")
+		recovered, err := c.RecoverWAL()
+		if err != nil {
+			return database.Client{}, fmt.Errorf("recovering from the write-ahead log: %w", err)
+		}
+		if recovered > 0 {
+			log.Printf("recovered %d interrupted writes to %s from the write-ahead log", recovered, path)
+		}
+	}
+	return c, c.EnsureDB()
+}
+
+func newMediaStore(cfg config) (storage.Backend, error) {
+	if cfg.mediaStorage == "s3" {
+		return storage.NewS3(cfg.s3)
+	}
+	return storage.NewLocalDisk(cfg.mediaDir)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/pwned"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+)
+
+var errNotPostAuthor = apiError{Code: codeForbidden, Message: service.ErrNotPostAuthor.Error()}
+
+// users and posts are built for each call. They're cheap, and this way they
+// always use the database of the tenant being served.
+func (apiCfg apiConfig) users() service.UserService {
+	return service.NewUserService(apiCfg.dbClient, apiCfg.existence()).
+		WithPasswordPolicy(apiCfg.settings.get().PasswordPolicy, apiCfg.breaches).
+		WithHasher(apiCfg.passwords)
+}
+
+// breachChecker checks passwords with the Pwned Passwords API. It lets them
+// through when the API can't be reached, so an outage doesn't block signups.
+type breachChecker struct {
+	client pwned.Client
+}
+
+func (c breachChecker) Breached(ctx context.Context, password string) (bool, error) {
+	breached, err := c.client.Breached(ctx, password)
+	if err != nil {
+		log.Printf("password breach check: %v", err)
+		return false, nil
+	}
+	return breached, nil
+}
+
+func (apiCfg apiConfig) posts() service.PostService {
+	return service.NewPostService(apiCfg.dbClient, apiCfg.existence(), apiCfg.deleteMediaFile).
+		WithPolicy(apiCfg.settings.get().ContentPolicy).
+		WithLimits(apiCfg.postLimits).
+		WithModeration(apiCfg.moderation)
+}
+
+// existence returns the existence filter when its negative answers can be
+// trusted.
+func (apiCfg apiConfig) existence() service.ExistenceFilter {
+	if !apiCfg.existenceFilterTrusted() {
+		return nil
+	}
+	return apiCfg.exists
+}
+
+// serviceError turns an error of the service layer into an API error with
+// its status code.
+func serviceError(err error) (int, error) {
+	validationErr := service.ValidationError{}
+	passwordErr := service.PasswordError{}
+	tooLongErr := service.PostTooLongError{}
+	quotaErr := service.PostQuotaError{}
+	attachmentQuotaErr := service.AttachmentQuotaError{}
+	rejectedErr := service.PostRejectedError{}
+	switch {
+	case errors.As(err, &passwordErr):
+		return http.StatusBadRequest, apiError{Code: codePasswordPolicy, Message: passwordErr.Error(), Details: passwordErr.Violations}
+	case errors.As(err, &validationErr):
+		return http.StatusBadRequest, validationFailed(validationErr.Err)
+	case errors.Is(err, service.ErrUserNotFound):
+		return http.StatusNotFound, errUserNotFound
+	case errors.Is(err, service.ErrUserAlreadyExists):
+		return http.StatusConflict, errUserAlreadyExists
+	case errors.Is(err, service.ErrUsernameTaken):
+		return http.StatusConflict, apiError{Code: codeConflict, Message: err.Error()}
+	case errors.Is(err, service.ErrPostNotFound):
+		return http.StatusNotFound, errPostNotFound
+	case errors.Is(err, service.ErrRevisionNotFound):
+		return http.StatusNotFound, errRevisionNotFound
+	case errors.Is(err, service.ErrNotPostAuthor):
+		return http.StatusForbidden, errNotPostAuthor
+	case errors.As(err, &tooLongErr):
+		return http.StatusRequestEntityTooLarge, apiError{Code: codePostTooLong, Message: tooLongErr.Error(), Details: map[string]int{"maxLength": tooLongErr.MaxLength}}
+	case errors.As(err, &quotaErr):
+		return http.StatusTooManyRequests, apiError{Code: codePostQuotaExceeded, Message: quotaErr.Error(), Details: map[string]interface{}{"perDay": quotaErr.PerDay, "retryAt": quotaErr.RetryAt}}
+	case errors.As(err, &attachmentQuotaErr):
+		return http.StatusRequestEntityTooLarge, apiError{Code: codeAttachmentQuota, Message: attachmentQuotaErr.Error(), Details: map[string]int64{"quota": attachmentQuotaErr.Quota}}
+	case errors.As(err, &rejectedErr):
+		return http.StatusBadRequest, apiError{Code: codePostRejected, Message: rejectedErr.Error(), Details: map[string]string{"reason": rejectedErr.Reason}}
+	case errors.Is(err, service.ErrUserNotBlocked), errors.Is(err, service.ErrNotFollowing), errors.Is(err, service.ErrFollowRequestNotFound),
+		errors.Is(err, service.ErrMessageNotFound), errors.Is(err, service.ErrAttachmentNotFound):
+		return http.StatusNotFound, apiError{Code: codeNotFound, Message: err.Error()}
+	case errors.Is(err, service.ErrNotMessageRecipient), errors.Is(err, service.ErrRecipientBlocked), errors.Is(err, service.ErrNotAccountOwner),
+		errors.Is(err, service.ErrNotMessageSender):
+		return http.StatusForbidden, apiError{Code: codeForbidden, Message: err.Error()}
+	case errors.Is(err, service.ErrUserSuspended):
+		return http.StatusForbidden, apiError{Code: codeUserSuspended, Message: service.ErrUserSuspended.Error()}
+	}
+	return 0, err
+}
+
+func respondWithServiceError(w http.ResponseWriter, err error) {
+	quotaErr := service.PostQuotaError{}
+	if errors.As(err, &quotaErr) {
+		retryAfter := int(time.Until(quotaErr.RetryAt).Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	code, err := serviceError(err)
+	if code == 0 {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithError(w, code, err)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// sessionTouchInterval limits how often the last use of a session is
+// written, so authenticated requests don't all write to the database.
+const sessionTouchInterval = time.Minute
+
+var errSessionNotFound = apiError{Code: codeNotFound, Message: "session doesn't exist"}
+
+// sessionInfo is a session as shown to its user.
+type sessionInfo struct {
+	database.Session
+	// Current is set for the session making the request.
+	Current bool `json:"current"`
+}
+
+// touchSession records that a session was used at now, unless that was
+// recorded recently.
+func (apiCfg apiConfig) touchSession(record database.Session, now time.Time) {
+	if now.Sub(record.LastUsedAt) < sessionTouchInterval || !apiCfg.acceptsWrites() {
+		return
+	}
+	err := apiCfg.dbClient.TouchSession(record.ID, now)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		log.Printf("session %s: %v", record.ID, err)
+	}
+}
+
+// meSessionsRoutes are the routes below /me/sessions.
+var meSessionsRoutes = newRoutes([]route{
+	{http.MethodGet, "", apiConfig.handlerGetSessions},
+	{http.MethodDelete, "/{session-id}", apiConfig.handlerDeleteSession},
+})
+
+func (apiCfg apiConfig) endpointMeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(meSessionsRoutes, "/me/sessions", w, r)
+}
+
+// handlerGetSessions lists the active sessions of the authenticated user.
+func (apiCfg apiConfig) handlerGetSessions(w http.ResponseWriter, r *http.Request) {
+	claims, err := apiCfg.authenticatedSession(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	if r.URL.Path != "/me/sessions" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /me/sessions"))
+		return
+	}
+
+	// collect sessions, leaving out expired ones
+	sessions, err := apiCfg.dbClient.GetSessions(claims.Subject)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	now := time.Now()
+	active := []sessionInfo{}
+	for _, session := range sessions {
+		if session.ExpiresAt.After(now) {
+			active = append(active, sessionInfo{Session: session, Current: session.ID == claims.SessionID})
+		}
+	}
+	respondWithJSON(w, http.StatusOK, active)
+}
+
+// handlerDeleteSession revokes one of the authenticated user's sessions,
+// logging out the device using it.
+func (apiCfg apiConfig) handlerDeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	id, err := trimPrefix(r.URL.Path, "/me/sessions/", "not a valid URL: %s{session-id}")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /me/sessions/{session-id}"))
+		return
+	}
+
+	// check session is the user's, without telling others it exists
+	session, err := apiCfg.dbClient.GetSession(id)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && session.UserID != userID) {
+		respondWithError(w, http.StatusNotFound, errSessionNotFound)
+		return
+	}
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	// revoke session
+	err = apiCfg.revokeSession(session, "logout")
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
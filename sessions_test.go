@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestSessions(t *testing.T) {
+	c := database.NewMemoryClient()
+	_, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateUser("other@example.com", "12345", "Other", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient: c,
+		auth:     testAuth,
+	}
+
+	login := func(email, device string) session {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email": "`+email+`", "password": "12345"}`))
+		r.Header.Set("User-Agent", device)
+		apiCfg.handlerLogin(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("login: got status %d: %s", w.Code, w.Body)
+		}
+		s := session{}
+		err := json.NewDecoder(w.Body).Decode(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	laptop := login("test@example.com", "laptop")
+	phone := login("test@example.com", "phone")
+	other := login("other@example.com", "tablet")
+
+	do := func(method, path string, s session) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Authorization", "Bearer "+s.Token)
+		apiCfg.endpointMeSessionsHandler(w, r)
+		return w
+	}
+
+	w := do(http.MethodGet, "/me/sessions", laptop)
+	sessions := []sessionInfo{}
+	err = json.NewDecoder(w.Body).Decode(&sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := map[string]bool{}
+	for _, s := range sessions {
+		devices[s.Device] = s.Current
+	}
+	if len(sessions) != 2 || !devices["laptop"] || devices["phone"] {
+		t.Errorf("got sessions %+v, want laptop (current) and phone", sessions)
+	}
+
+	var tests = []struct {
+		name           string
+		method         string
+		path           string
+		session        session
+		expectedStatus int
+	}{
+		{name: "revoke someone else's session", method: http.MethodDelete, path: "/me/sessions/" + other.SessionID, session: laptop, expectedStatus: http.StatusNotFound},
+		{name: "revoke phone", method: http.MethodDelete, path: "/me/sessions/" + phone.SessionID, session: laptop, expectedStatus: http.StatusOK},
+		{name: "revoked token", method: http.MethodGet, path: "/me/sessions", session: phone, expectedStatus: http.StatusUnauthorized},
+		{name: "revoke phone again", method: http.MethodDelete, path: "/me/sessions/" + phone.SessionID, session: laptop, expectedStatus: http.StatusNotFound},
+		{name: "without session", method: http.MethodGet, path: "/me/sessions", expectedStatus: http.StatusUnauthorized},
+		{name: "log out", method: http.MethodDelete, path: "/me/sessions/" + laptop.SessionID, session: laptop, expectedStatus: http.StatusOK},
+		{name: "logged out", method: http.MethodGet, path: "/me/sessions", session: laptop, expectedStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := do(tt.method, tt.path, tt.session)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/botcheck"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// signupFormSubject is the subject of form tokens, which time how long the
+// signup form took to fill.
+const (
+	signupFormSubject  = "signup-form"
+	signupFormTokenTTL = time.Hour
+)
+
+var (
+	errSignupRejected = apiError{Code: codeSignupRejected, Message: "signup rejected, please try again later"}
+	errSignupPending  = apiError{Code: codeSignupPending, Message: "account awaiting review"}
+)
+
+type signupConfig struct {
+	checker        botcheck.Checker
+	honeypotFields []string
+	// reviewScore and rejectScore are 0 when signups are never held or
+	// refused.
+	reviewScore float64
+	rejectScore float64
+}
+
+// formTokenSecret signs form tokens with a key of their own, so they can't
+// pass as session tokens.
+func (apiCfg apiConfig) formTokenSecret() []byte {
+	return append([]byte(signupFormSubject+":"), apiCfg.auth.secret...)
+}
+
+// checkSignup scores the body of a signup request: its honeypot fields,
+// how long ago its form token was issued, and the user agent.
+func (apiCfg apiConfig) checkSignup(r *http.Request, fields map[string]json.RawMessage, formToken string, now time.Time) botcheck.Result {
+	submission := botcheck.Submission{UserAgent: r.UserAgent()}
+	for _, name := range apiCfg.signup.honeypotFields {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		value := ""
+		if json.Unmarshal(raw, &value) != nil && string(raw) != "null" {
+			// a number or an object, still filled in
+			value = string(raw)
+		}
+		submission.Honeypots = append(submission.Honeypots, value)
+	}
+	claims, err := auth.Verify(apiCfg.formTokenSecret(), formToken, now)
+	if err == nil && claims.Subject == signupFormSubject {
+		submission.FormAge = now.Sub(time.Unix(claims.IssuedAt, 0))
+		// a zero age means the form wasn't timed
+		if submission.FormAge <= 0 {
+			submission.FormAge = time.Nanosecond
+		}
+	}
+	return apiCfg.signup.checker.Check(submission)
+}
+
+// signUp creates a user unless their signup looks like a bot's, and
+// records its signals, holding the account for review when they're
+// suspicious. It reports whether the signup is held; users whose signup isn't
+// are welcomed. Every API that creates users goes through it.
+func (apiCfg apiConfig) signUp(r *http.Request, fields map[string]json.RawMessage, formToken, email, password, name, username string, age int, profile database.Profile) (database.User, bool, error) {
+	// check signup looks human
+	signals := apiCfg.checkSignup(r, fields, formToken, time.Now())
+	if rejectScore := apiCfg.signup.rejectScore; rejectScore > 0 && signals.Score >= rejectScore {
+		log.Printf("signup of %s rejected: score %.2f %v", email, signals.Score, signals.Signals)
+		return database.User{}, false, errSignupRejected
+	}
+
+	// create user
+	user, err := apiCfg.users().Create(email, password, name, username, age, profile)
+	if err != nil {
+		return database.User{}, false, err
+	}
+
+	// record signals
+	status := database.SignupAccepted
+	if reviewScore := apiCfg.signup.reviewScore; reviewScore > 0 && signals.Score >= reviewScore {
+		status = database.SignupPending
+	}
+	_, err = apiCfg.dbClient.RecordSignup(database.Signup{
+		UserID:  user.ID,
+		Score:   signals.Score,
+		Signals: signals.Signals,
+		Status:  status,
+	})
+	if err != nil {
+		return database.User{}, false, err
+	}
+	if status == database.SignupPending {
+		return user, true, nil
+	}
+	apiCfg.sendWelcomeEmail(user)
+	return user, false, nil
+}
+
+// signupPending reports whether the signup of a user is waiting for an
+// admin.
+func (apiCfg apiConfig) signupPending(userID string) (bool, error) {
+	signup, err := apiCfg.dbClient.GetSignup(userID)
+	if errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return signup.Status == database.SignupPending, nil
+}
+
+// handlerSignupFormToken issues the token signup forms send back as
+// formToken, when they're served.
+func (apiCfg apiConfig) handlerSignupFormToken(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	claims := auth.NewClaims(signupFormSubject, now, signupFormTokenTTL)
+	token, err := auth.Sign(apiCfg.formTokenSecret(), claims)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}{
+		Token:     token,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+	})
+}
+
+// adminSignupsRoutes are the routes below /admin/signups.
+var adminSignupsRoutes = newRoutes([]route{
+	{http.MethodGet, "", apiConfig.handlerAdminSignups},
+	{http.MethodPost, "/{id}/approve", apiConfig.handlerAdminApproveSignup},
+	{http.MethodPost, "/{id}/reject", apiConfig.handlerAdminRejectSignup},
+})
+
+func (apiCfg apiConfig) endpointAdminSignupsHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(adminSignupsRoutes, "/admin/signups", w, r)
+}
+
+// handlerAdminSignups lists signups with their bot score, oldest first.
+// The status query parameter picks pending or accepted ones.
+func (apiCfg apiConfig) handlerAdminSignups(w http.ResponseWriter, r *http.Request) {
+	// get params
+	status := r.URL.Query().Get("status")
+	if status != "" && status != database.SignupPending && status != database.SignupAccepted {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("status must be pending or accepted")))
+		return
+	}
+
+	// list signups
+	signups, err := apiCfg.dbClient.GetSignups(status)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, signups)
+}
+
+// signupUserID returns the user ID of an /admin/signups/{id}/{action} path.
+func signupUserID(path, action string) (string, error) {
+	id, err := trimPrefix(path, "/admin/signups/", "not a valid URL: %s{id}/"+action)
+	id = strings.TrimSuffix(id, "/"+action)
+	if err != nil || id == "" || strings.Contains(id, "/") {
+		return "", invalidPath("bad request, correct format is: /admin/signups/{id}/" + action)
+	}
+	return id, nil
+}
+
+var errSignupNotHeld = apiError{Code: codeConflict, Message: "signup isn't waiting for review"}
+
+// checkSignupHeld returns errSignupNotHeld unless the signup of a user is
+// waiting for review.
+func (apiCfg apiConfig) checkSignupHeld(userID string) error {
+	signup, err := apiCfg.dbClient.GetSignup(userID)
+	if err != nil {
+		return err
+	}
+	if signup.Status != database.SignupPending {
+		return errSignupNotHeld
+	}
+	return nil
+}
+
+func respondWithSignupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errSignupNotHeld) {
+		respondWithError(w, http.StatusConflict, err)
+		return
+	}
+	respondWithDBError(w, err)
+}
+
+// handlerAdminApproveSignup lets a user whose signup was held log in, and
+// welcomes them.
+func (apiCfg apiConfig) handlerAdminApproveSignup(w http.ResponseWriter, r *http.Request) {
+	// check path
+	id, err := signupUserID(r.URL.Path, "approve")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check signup is held
+	err = apiCfg.checkSignupHeld(id)
+	if err != nil {
+		respondWithSignupError(w, err)
+		return
+	}
+	user, err := apiCfg.dbClient.GetUser(id)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	// approve signup
+	signup, err := apiCfg.dbClient.SetSignupStatus(user.ID, database.SignupAccepted)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	apiCfg.sendWelcomeEmail(user)
+	respondWithJSON(w, http.StatusOK, signup)
+}
+
+// handlerAdminRejectSignup deletes the account of a held signup.
+func (apiCfg apiConfig) handlerAdminRejectSignup(w http.ResponseWriter, r *http.Request) {
+	// check path
+	id, err := signupUserID(r.URL.Path, "reject")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check signup is held
+	err = apiCfg.checkSignupHeld(id)
+	if err != nil {
+		respondWithSignupError(w, err)
+		return
+	}
+
+	// delete user
+	err = apiCfg.dbClient.DeleteUser(id)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	log.Printf("signup of user %s rejected", id)
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/botcheck"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestSignupSignals(t *testing.T) {
+	c := database.NewMemoryClient()
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		auth:        testAuth,
+		signup: signupConfig{
+			checker:        botcheck.Checker{MinFillTime: 3 * time.Second},
+			honeypotFields: []string{"fax"},
+			reviewScore:    0.5,
+			rejectScore:    1,
+		},
+	}
+	browser := "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"
+	// a form served a minute ago
+	claims := auth.NewClaims(signupFormSubject, time.Now().Add(-time.Minute), time.Hour)
+	formToken, err := auth.Sign(apiCfg.formTokenSecret(), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signup := func(email, extra, userAgent string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		body := `{"email": "` + email + `", "password": "12345", "name": "Test", "age": 18` + extra + `}`
+		r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+		r.Header.Set("User-Agent", userAgent)
+		apiCfg.endpointUsersHandler(w, r)
+		return w
+	}
+	login := func(email string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email": "`+email+`", "password": "12345"}`))
+		apiCfg.handlerLogin(w, r)
+		return w
+	}
+	admin := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		apiCfg.endpointAdminSignupsHandler(w, r)
+		return w
+	}
+	userID := func(w *httptest.ResponseRecorder) string {
+		t.Helper()
+		user := database.User{}
+		err := json.NewDecoder(w.Body).Decode(&user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.ID
+	}
+
+	// a filled honeypot is refused outright
+	w := signup("bot@example.com", `, "fax": "555-0100"`, browser)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), string(codeSignupRejected)) {
+		t.Errorf("honeypot: got status %d: %s", w.Code, w.Body)
+	}
+	if _, err := c.GetUserByEmail("bot@example.com"); err == nil {
+		t.Error("rejected signup created a user")
+	}
+
+	// a timed form from a browser is accepted
+	w = signup("person@example.com", `, "fax": "", "formToken": "`+formToken+`"`, browser)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("person: got status %d: %s", w.Code, w.Body)
+	}
+	person := userID(w)
+	if w := login("person@example.com"); w.Code != http.StatusOK {
+		t.Errorf("person login: got status %d: %s", w.Code, w.Body)
+	}
+
+	// untimed signups without a user agent wait for review
+	held := []string{}
+	for _, email := range []string{"script@example.com", "other@example.com"} {
+		w := signup(email, "", "")
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("script: got status %d: %s", w.Code, w.Body)
+		}
+		held = append(held, userID(w))
+	}
+	w = login("script@example.com")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), string(codeSignupPending)) {
+		t.Errorf("held login: got status %d: %s", w.Code, w.Body)
+	}
+	pending, err := c.GetSignups(database.SignupPending)
+	if err != nil || len(pending) != 2 || pending[0].Score != 0.5 {
+		t.Fatalf("pending signups: got %+v, %v", pending, err)
+	}
+
+	var tests = []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "approve", path: "/admin/signups/" + held[0] + "/approve", expectedStatus: 200},
+		{name: "approve again", path: "/admin/signups/" + held[0] + "/approve", expectedStatus: 409},
+		{name: "reject accepted signup", path: "/admin/signups/" + person + "/reject", expectedStatus: 409},
+		{name: "reject", path: "/admin/signups/" + held[1] + "/reject", expectedStatus: 200},
+		{name: "reject deleted user", path: "/admin/signups/" + held[1] + "/reject", expectedStatus: 404},
+		{name: "bad path", path: "/admin/signups//approve", expectedStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := admin(tt.path)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.expectedStatus, w.Body)
+			}
+		})
+	}
+	if w := login("script@example.com"); w.Code != http.StatusOK {
+		t.Errorf("approved login: got status %d: %s", w.Code, w.Body)
+	}
+	if _, err := c.GetUserByEmail("other@example.com"); err == nil {
+		t.Error("rejected signup left its user")
+	}
+
+	// GraphQL signups are checked the same way
+	graphQL := func(query string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string]string{"query": query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		apiCfg.handlerGraphQL(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+		return w
+	}
+	w = graphQL(`mutation { createUser(email: "graphql@example.com", password: "12345", age: 18) { id } }`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("graphql: got status %d: %s", w.Code, w.Body)
+	}
+	w = login("graphql@example.com")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), string(codeSignupPending)) {
+		t.Errorf("graphql login: got status %d: %s", w.Code, w.Body)
+	}
+	apiCfg.signup.rejectScore = 0.5
+	w = graphQL(`mutation { createUser(email: "graphql-bot@example.com", password: "12345", age: 18) { id } }`)
+	if !strings.Contains(w.Body.String(), errSignupRejected.Message) {
+		t.Errorf("graphql bot: got status %d: %s", w.Code, w.Body)
+	}
+	if _, err := c.GetUserByEmail("graphql-bot@example.com"); err == nil {
+		t.Error("rejected graphql signup created a user")
+	}
+}
+
+func TestSignupFormToken(t *testing.T) {
+	apiCfg := apiConfig{
+		dbClient: database.NewMemoryClient(),
+		auth:     authConfig{secret: []byte("secret"), sessionTTL: time.Hour},
+	}
+	w := httptest.NewRecorder()
+	apiCfg.handlerSignupFormToken(w, httptest.NewRequest(http.MethodGet, "/signup/form-token", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	body := struct {
+		Token string `json:"token"`
+	}{}
+	err := json.NewDecoder(w.Body).Decode(&body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// form tokens aren't session tokens
+	r := httptest.NewRequest(http.MethodGet, "/me/sessions", nil)
+	r.Header.Set("Authorization", "Bearer "+body.Token)
+	_, err = apiCfg.authenticatedSession(r)
+	if err == nil {
+		t.Error("a form token authenticated a request")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/events"
+)
+
+// streakReminderHour is the local hour from which users whose streak is at
+// risk are reminded to post.
+const streakReminderHour = 20
+
+const eventStreakAtRisk = "streak.at_risk"
+
+// postingStreak counts consecutive days with a post, in the user's time
+// zone.
+type postingStreak struct {
+	Current      int    `json:"current"`
+	Longest      int    `json:"longest"`
+	LastPostDate string `json:"lastPostDate,omitempty"`
+	// AtRisk is set when the current streak ends unless the user posts
+	// today.
+	AtRisk bool `json:"atRisk"`
+}
+
+type streakAtRisk struct {
+	UserID string
+	Streak postingStreak
+}
+
+// userProfile is a user as returned by GET /users/{id}.
+type userProfile struct {
+	database.User
+	Streak postingStreak `json:"streak"`
+}
+
+func userLocation(user database.User) *time.Location {
+	loc, err := time.LoadLocation(user.Settings.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// localDay returns the calendar day t falls on in loc, as midnight UTC so
+// days can be compared and stepped with AddDate.
+func localDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func computeStreak(posts []database.Post, loc *time.Location, now time.Time) postingStreak {
+	streak := postingStreak{}
+	days := map[time.Time]bool{}
+	var last time.Time
+	for _, post := range posts {
+		day := localDay(post.CreatedAt, loc)
+		days[day] = true
+		if day.After(last) {
+			last = day
+		}
+	}
+	if len(days) == 0 {
+		return streak
+	}
+	for day := range days {
+		// only count from the first day of each streak
+		if days[day.AddDate(0, 0, -1)] {
+			continue
+		}
+		length := 1
+		for days[day.AddDate(0, 0, length)] {
+			length++
+		}
+		if length > streak.Longest {
+			streak.Longest = length
+		}
+	}
+	streak.LastPostDate = last.Format("2006-01-02")
+	today := localDay(now, loc)
+	if last.Equal(today) || last.Equal(today.AddDate(0, 0, -1)) {
+		for days[last.AddDate(0, 0, -streak.Current)] {
+			streak.Current++
+		}
+		streak.AtRisk = !last.Equal(today)
+	}
+	return streak
+}
+
+// streakReminders publishes streak.at_risk once per local day for users who
+// haven't posted yet late in their day.
+type streakReminders struct {
+	mu sync.Mutex
+	// notified maps user IDs to the local day they were last reminded.
+	notified map[string]time.Time
+}
+
+func newStreakReminders() *streakReminders {
+	return &streakReminders{notified: map[string]time.Time{}}
+}
+
+func (sr *streakReminders) check(c database.Client, bus *events.Bus, now time.Time) {
+	users, err := c.GetAllUsers()
+	if err != nil {
+		log.Printf("streak reminders: %v", err)
+		return
+	}
+	posts, err := c.GetAllPosts()
+	if err != nil {
+		log.Printf("streak reminders: %v", err)
+		return
+	}
+	postsByUser := map[string][]database.Post{}
+	for _, post := range posts {
+		postsByUser[post.UserID] = append(postsByUser[post.UserID], post)
+	}
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	for _, user := range users {
+		loc := userLocation(user)
+		today := localDay(now, loc)
+		if now.In(loc).Hour() < streakReminderHour || sr.notified[user.ID].Equal(today) {
+			continue
+		}
+		streak := computeStreak(postsByUser[user.ID], loc, now)
+		if !streak.AtRisk {
+			continue
+		}
+		sr.notified[user.ID] = today
+		bus.Publish(events.Event{Type: eventStreakAtRisk, Data: streakAtRisk{UserID: user.ID, Streak: streak}})
+	}
+}
+
+// subscribeStreaks reminds users whose streak is at risk by email, when
+// email is enabled.
+func (apiCfg apiConfig) subscribeStreaks(bus *events.Bus) {
+	bus.Subscribe(eventStreakAtRisk, func(event events.Event) {
+		atRisk := event.Data.(streakAtRisk)
+		log.Printf("user %s hasn't posted today, their %d day streak is at risk", atRisk.UserID, atRisk.Streak.Current)
+		if !apiCfg.emailEnabled() {
+			return
+		}
+		user, err := apiCfg.dbClient.GetUser(atRisk.UserID)
+		if err != nil {
+			log.Printf("streak reminders: %v", err)
+			return
+		}
+		_, err = apiCfg.sendEmail(user.Email, "streak_at_risk", map[string]interface{}{
+			"Name":   user.Name,
+			"Streak": atRisk.Streak.Current,
+		})
+		if err != nil {
+			log.Printf("streak reminders: %v", err)
+		}
+	})
+}
+
+func (apiCfg apiConfig) handlerGetUserSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}/settings"))
+		return
+	}
+
+	// check user is the one logged in
+	user, err := apiCfg.users().Own(ref, userID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// return settings
+	if notModified(w, r, user.UpdatedAt) {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, user.Settings)
+}
+
+func (apiCfg apiConfig) handlerUpdateUserSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// get params
+	decoder := json.NewDecoder(r.Body)
+	params := database.UserSettings{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}/settings"))
+		return
+	}
+
+	// check settings
+	if _, err := time.LoadLocation(params.Timezone); err != nil || params.Timezone == "Local" {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("timezone must be an IANA time zone name like Europe/Paris")))
+		return
+	}
+
+	// check user is the one logged in
+	user, err := apiCfg.users().Own(ref, userID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// update settings
+	user, err = apiCfg.dbClient.UpdateUserSettings(user.ID, params)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, user.Settings)
+}
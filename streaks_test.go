@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/events"
+)
+
+func TestComputeStreak(t *testing.T) {
+	// 23:30 UTC is already the next day in Paris
+	now := time.Date(2023, 3, 10, 23, 30, 0, 0, time.UTC)
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name     string
+		daysAgo  []int
+		loc      *time.Location
+		expected postingStreak
+	}{
+		{name: "no posts", daysAgo: []int{}, loc: time.UTC, expected: postingStreak{}},
+		{name: "posted today", daysAgo: []int{0, 0, 1, 2}, loc: time.UTC, expected: postingStreak{Current: 3, Longest: 3, LastPostDate: "2023-03-10"}},
+		{name: "at risk", daysAgo: []int{1, 2, 4, 5, 6, 7}, loc: time.UTC, expected: postingStreak{Current: 2, Longest: 4, LastPostDate: "2023-03-09", AtRisk: true}},
+		{name: "broken", daysAgo: []int{2, 3}, loc: time.UTC, expected: postingStreak{Longest: 2, LastPostDate: "2023-03-08"}},
+		{name: "time zone", daysAgo: []int{1, 2}, loc: paris, expected: postingStreak{Current: 2, Longest: 2, LastPostDate: "2023-03-10", AtRisk: true}},
+	}
+	for _, tt := range tests {
+		posts := []database.Post{}
+		for _, d := range tt.daysAgo {
+			posts = append(posts, database.Post{CreatedAt: now.AddDate(0, 0, -d)})
+		}
+		if got := computeStreak(posts, tt.loc, now); got != tt.expected {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestStreakReminders(t *testing.T) {
+	bus := events.NewBus()
+	reminded := 0
+	bus.Subscribe(eventStreakAtRisk, func(event events.Event) {
+		reminded++
+	})
+	c := database.NewMemoryClient()
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreatePost(user.ID, "hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sr := newStreakReminders()
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	morning := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 9, 0, 0, 0, time.UTC)
+	evening := morning.Add(12 * time.Hour)
+	for _, now := range []time.Time{morning, evening, evening.Add(time.Hour)} {
+		sr.check(c, bus, now)
+	}
+	if reminded != 1 {
+		t.Errorf("got %d reminders, want 1", reminded)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+// activeSuspension returns the suspension of a user in effect at now, if
+// there is one.
+func (apiCfg apiConfig) activeSuspension(userID string, now time.Time) (database.Suspension, bool, error) {
+	suspension, err := apiCfg.dbClient.GetSuspension(userID)
+	if errors.Is(err, database.ErrNotFound) {
+		return database.Suspension{}, false, nil
+	}
+	if err != nil {
+		return database.Suspension{}, false, err
+	}
+	return suspension, suspension.Active(now), nil
+}
+
+// suspendedError tells a suspended user why they can't log in, and until
+// when.
+func suspendedError(suspension database.Suspension) apiError {
+	if suspension.Permanent {
+		return apiError{
+			Code:    codeUserSuspended,
+			Message: fmt.Sprintf("account banned: %s", suspension.Reason),
+			Details: map[string]interface{}{"reason": suspension.Reason, "permanent": true},
+		}
+	}
+	return apiError{
+		Code:    codeUserSuspended,
+		Message: fmt.Sprintf("account suspended until %s: %s", suspension.ExpiresAt.Format(time.RFC3339), suspension.Reason),
+		Details: map[string]interface{}{"reason": suspension.Reason, "expiresAt": suspension.ExpiresAt},
+	}
+}
+
+// adminUserRef returns the user reference of an /admin/users/{id}/{action}
+// path.
+func adminUserRef(path, action string) (string, error) {
+	ref, err := trimPrefix(path, "/admin/users/", "not a valid URL: %s{id}/"+action)
+	ref = strings.TrimSuffix(ref, "/"+action)
+	if err != nil || ref == "" || strings.Contains(ref, "/") {
+		return "", invalidPath("bad request, correct format is: /admin/users/{id}/" + action)
+	}
+	return ref, nil
+}
+
+// handlerAdminSuspendUser suspends a user until the given time, or bans
+// them for good when permanent. Their sessions are revoked, they can't log
+// in and their posts are hidden meanwhile.
+func (apiCfg apiConfig) handlerAdminSuspendUser(w http.ResponseWriter, r *http.Request, permanent bool) {
+	// get params
+	type parameters struct {
+		Reason    string    `json:"reason"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(params.Reason) == "" {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("reason can't be empty")))
+		return
+	}
+	switch {
+	case permanent && !params.ExpiresAt.IsZero():
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("bans don't expire, suspend the user instead")))
+		return
+	case !permanent && !params.ExpiresAt.After(time.Now()):
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("expiresAt must be in the future")))
+		return
+	}
+
+	// check path
+	action := "suspend"
+	if permanent {
+		action = "ban"
+	}
+	ref, err := adminUserRef(r.URL.Path, action)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check user exists
+	user, err := apiCfg.users().Get(ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// suspend user, logging them out everywhere
+	suspension, err := apiCfg.dbClient.SuspendUser(database.Suspension{
+		UserID:    user.ID,
+		Reason:    params.Reason,
+		Permanent: permanent,
+		ExpiresAt: params.ExpiresAt.UTC(),
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	err = apiCfg.revokeUserSessions(user.ID, "suspended: "+params.Reason)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, suspension)
+}
+
+// handlerAdminReinstateUser lifts the suspension or ban of a user.
+func (apiCfg apiConfig) handlerAdminReinstateUser(w http.ResponseWriter, r *http.Request) {
+	// check path
+	ref, err := adminUserRef(r.URL.Path, "reinstate")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check user exists
+	user, err := apiCfg.users().Get(ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// lift suspension
+	err = apiCfg.dbClient.LiftSuspension(user.ID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// handlerAdminAddAppealNote records a note on the appeal of a suspended
+// user.
+func (apiCfg apiConfig) handlerAdminAddAppealNote(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		Text string `json:"text"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(params.Text) == "" {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("text can't be empty")))
+		return
+	}
+
+	// check path
+	ref, err := adminUserRef(r.URL.Path, "appeal-notes")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check user exists
+	user, err := apiCfg.users().Get(ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// add note
+	suspension, err := apiCfg.dbClient.AddAppealNote(user.ID, params.Text)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, suspension)
+}
+
+// handlerAdminSuspensions lists suspensions and bans, newest first. Expired
+// suspensions are listed until the scheduler lifts them.
+func (apiCfg apiConfig) handlerAdminSuspensions(w http.ResponseWriter, r *http.Request) {
+	suspensions, err := apiCfg.dbClient.GetSuspensions()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, suspensions)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestSuspensions(t *testing.T) {
+	c := database.NewMemoryClient()
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		auth:        testAuth,
+	}
+	login := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email": "test@example.com", "password": "12345"}`))
+		apiCfg.handlerLogin(w, r)
+		return w
+	}
+	admin := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		apiCfg.endpointAdminUsersHandler(w, r)
+		return w
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	w := login()
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: got status %d: %s", w.Code, w.Body)
+	}
+	s := session{}
+	err = json.NewDecoder(w.Body).Decode(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "suspend without reason", path: "/admin/users/" + user.ID + "/suspend", body: `{"expiresAt": "` + future + `"}`, expectedStatus: 400},
+		{name: "suspend in the past", path: "/admin/users/" + user.ID + "/suspend", body: `{"reason": "spam", "expiresAt": "2020-01-01T00:00:00Z"}`, expectedStatus: 400},
+		{name: "ban with expiry", path: "/admin/users/" + user.ID + "/ban", body: `{"reason": "spam", "expiresAt": "` + future + `"}`, expectedStatus: 400},
+		{name: "suspend missing user", path: "/admin/users/nobody@example.com/suspend", body: `{"reason": "spam", "expiresAt": "` + future + `"}`, expectedStatus: 404},
+		{name: "appeal note without suspension", path: "/admin/users/" + user.ID + "/appeal-notes", body: `{"text": "sorry"}`, expectedStatus: 404},
+		{name: "reinstate without suspension", path: "/admin/users/" + user.ID + "/reinstate", expectedStatus: 404},
+		{name: "suspend", path: "/admin/users/" + user.ID + "/suspend", body: `{"reason": "spam", "expiresAt": "` + future + `"}`, expectedStatus: 200},
+		{name: "appeal note", path: "/admin/users/" + user.ID + "/appeal-notes", body: `{"text": "user says their account was hacked"}`, expectedStatus: 200},
+	}
+	for _, tt := range tests {
+		w := admin(tt.path, tt.body)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+
+	// suspended users are logged out and can't log back in
+	r := httptest.NewRequest(http.MethodGet, "/me/sessions", nil)
+	r.Header.Set("Authorization", "Bearer "+s.Token)
+	if _, err := apiCfg.authenticatedSession(r); err == nil {
+		t.Error("session of a suspended user is still accepted")
+	}
+	w = login()
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), string(codeUserSuspended)) {
+		t.Errorf("login while suspended: got status %d: %s", w.Code, w.Body)
+	}
+	suspension, err := c.GetSuspension(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suspension.Reason != "spam" || len(suspension.AppealNotes) != 1 {
+		t.Errorf("got suspension %+v", suspension)
+	}
+
+	// the scheduler lifts suspensions once they expired
+	err = apiCfg.purgeSuspensions(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := login(); w.Code != http.StatusOK {
+		t.Errorf("login after the suspension expired: got status %d: %s", w.Code, w.Body)
+	}
+
+	// bans last until an admin reinstates the user
+	if w := admin("/admin/users/"+user.ID+"/ban", `{"reason": "abuse"}`); w.Code != http.StatusOK {
+		t.Fatalf("ban: got status %d: %s", w.Code, w.Body)
+	}
+	err = apiCfg.purgeSuspensions(time.Now().AddDate(10, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := login(); w.Code != http.StatusForbidden {
+		t.Errorf("login while banned: got status %d: %s", w.Code, w.Body)
+	}
+	if w := admin("/admin/users/"+user.ID+"/reinstate", ""); w.Code != http.StatusOK {
+		t.Fatalf("reinstate: got status %d: %s", w.Code, w.Body)
+	}
+	if w := login(); w.Code != http.StatusOK {
+		t.Errorf("login after reinstating: got status %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+)
+
+// maxJournalChanges is how many changes the journal keeps. Clients whose
+// token is older sync from scratch.
+const maxJournalChanges = 10000
+
+var (
+	errInvalidSyncToken = validationFailed(errors.New("since isn't a sync token"))
+	errSyncTokenExpired = apiError{Code: codeSyncTokenExpired, Message: "sync token expired, sync again without since"}
+)
+
+// changeJournal numbers the writes to a database, so offline clients can
+// ask for what changed since they last synced. It follows writes,
+// replicated ones included, through the mutation hook, and only lives in
+// memory: tokens handed out before a restart expire.
+type changeJournal struct {
+	// epoch tells tokens of this journal from those of an earlier process.
+	epoch string
+
+	mu      sync.Mutex
+	changes []journalChange
+	// last is the number of the latest change, dropped the number of the
+	// latest change no longer kept.
+	last    int64
+	dropped int64
+}
+
+type journalChange struct {
+	seq        int64
+	at         time.Time
+	collection string
+	key        string
+}
+
+func newChangeJournal() *changeJournal {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &changeJournal{epoch: hex.EncodeToString(b)}
+}
+
+// applyMutations is the database mutation hook recording changes to the
+// records synced, and to what decides which posts a user sees.
+func (j *changeJournal) applyMutations(mutations []database.Mutation) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now().UTC()
+	for _, mutation := range mutations {
+		switch mutation.Collection {
+		case "users", "posts", "suspensions", "blocks", "follows":
+		default:
+			continue
+		}
+		j.last++
+		j.changes = append(j.changes, journalChange{seq: j.last, at: now, collection: mutation.Collection, key: mutation.Key})
+	}
+	// trim in chunks, not on every write
+	if len(j.changes) > 2*maxJournalChanges {
+		drop := len(j.changes) - maxJournalChanges
+		j.dropped = j.changes[drop-1].seq
+		j.changes = append([]journalChange{}, j.changes[drop:]...)
+	}
+}
+
+// token returns the position of the latest change.
+func (j *changeJournal) token() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.epoch + "." + strconv.FormatInt(j.last, 10)
+}
+
+// changedRecords is what changed since a token: the IDs of users and posts
+// written, and of the users whose posts may have been hidden or shown.
+type changedRecords struct {
+	users   map[string]bool
+	posts   map[string]bool
+	authors map[string]bool
+	// postsWrittenAt is when each post written was last written.
+	postsWrittenAt map[string]time.Time
+}
+
+// since returns the records changed after token, as seen by the user with
+// the given ID.
+func (j *changeJournal) since(token, viewerID string) (changedRecords, error) {
+	epoch, position, ok := strings.Cut(token, ".")
+	seq, err := strconv.ParseInt(position, 10, 64)
+	if !ok || err != nil || seq < 0 {
+		return changedRecords{}, errInvalidSyncToken
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if epoch != j.epoch || seq < j.dropped {
+		return changedRecords{}, errSyncTokenExpired
+	}
+	if seq > j.last {
+		return changedRecords{}, errInvalidSyncToken
+	}
+	changed := changedRecords{
+		users:          map[string]bool{},
+		posts:          map[string]bool{},
+		authors:        map[string]bool{},
+		postsWrittenAt: map[string]time.Time{},
+	}
+	for _, change := range j.changes {
+		if change.seq <= seq {
+			continue
+		}
+		switch change.collection {
+		case "users":
+			// users going private or public hide or show their posts
+			changed.users[change.key] = true
+			changed.authors[change.key] = true
+		case "posts":
+			changed.posts[change.key] = true
+			changed.postsWrittenAt[change.key] = change.at
+		case "suspensions":
+			changed.authors[change.key] = true
+		case "blocks":
+			// only the blocker's view of the blocked user's posts changed
+			blockerID, blockedID, _ := strings.Cut(change.key, ":")
+			if blockerID == viewerID {
+				changed.authors[blockedID] = true
+			}
+		case "follows":
+			// only the follower's view of the followed user's posts changed
+			followerID, followeeID, _ := strings.Cut(change.key, ":")
+			if followerID == viewerID {
+				changed.authors[followeeID] = true
+			}
+		}
+	}
+	return changed, nil
+}
+
+// syncResult is the state of the records changed since a token, and the
+// token to ask for the next changes with. Posts the user can no longer see
+// are listed as deleted.
+type syncResult struct {
+	Users        []database.User `json:"users"`
+	Posts        []database.Post `json:"posts"`
+	DeletedUsers []string        `json:"deletedUsers"`
+	DeletedPosts []string        `json:"deletedPosts"`
+	Token        string          `json:"token"`
+}
+
+// syncRoutes are the routes of /sync.
+var syncRoutes = newRoutes([]route{
+	{http.MethodGet, "", apiConfig.handlerSync},
+	{http.MethodPost, "", apiConfig.handlerSyncPush},
+})
+
+func (apiCfg apiConfig) endpointSyncHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(syncRoutes, "/sync", w, r)
+}
+
+// handlerSync returns every user and post visible to the caller without
+// ?since=, and what changed since that token with it.
+func (apiCfg apiConfig) handlerSync(w http.ResponseWriter, r *http.Request) {
+	// take the token first, changes made while reading come again next time
+	result := syncResult{
+		Users:        []database.User{},
+		Posts:        []database.Post{},
+		DeletedUsers: []string{},
+		DeletedPosts: []string{},
+		Token:        apiCfg.changes.token(),
+	}
+	viewerID, _ := apiCfg.authenticatedUserID(r)
+	posts := apiCfg.posts().ForViewer(viewerID)
+
+	// sync from scratch
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		users, err := apiCfg.users().All()
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		for _, user := range users {
+			result.Users = append(result.Users, userForViewer(user, viewerID))
+		}
+		result.Posts, err = posts.All("")
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, result)
+		return
+	}
+
+	// collect changes
+	changed, err := apiCfg.changes.since(since, viewerID)
+	if errors.Is(err, errSyncTokenExpired) {
+		respondWithError(w, http.StatusGone, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	for authorID := range changed.authors {
+		authored, err := apiCfg.dbClient.GetPosts(authorID)
+		if err != nil {
+			respondWithDBError(w, err)
+			return
+		}
+		for _, post := range authored {
+			changed.posts[post.ID] = true
+		}
+	}
+
+	// read the records as they are now
+	for _, id := range sortedIDs(changed.users) {
+		user, err := apiCfg.dbClient.GetUser(id)
+		if errors.Is(err, database.ErrNotFound) {
+			result.DeletedUsers = append(result.DeletedUsers, id)
+			continue
+		}
+		if err != nil {
+			respondWithDBError(w, err)
+			return
+		}
+		result.Users = append(result.Users, userForViewer(user, viewerID))
+	}
+	for _, id := range sortedIDs(changed.posts) {
+		post, err := posts.Get(id)
+		if errors.Is(err, service.ErrPostNotFound) {
+			result.DeletedPosts = append(result.DeletedPosts, id)
+			continue
+		}
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		result.Posts = append(result.Posts, post)
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+func sortedIDs(ids map[string]bool) []string {
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
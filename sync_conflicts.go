@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+)
+
+// maxSyncEdits is how many edits a client may push at once.
+const maxSyncEdits = 100
+
+// conflictStrategy decides between a post edited offline and the server's
+// version when the post changed on the server since the client last
+// synced.
+type conflictStrategy string
+
+const (
+	// lastWriteWins keeps the version written last, by the client's clock
+	// for its edit.
+	lastWriteWins conflictStrategy = "last-write-wins"
+	serverWins    conflictStrategy = "server-wins"
+	// manualMerge applies nothing and returns the server's version, for
+	// the user to merge.
+	manualMerge conflictStrategy = "manual"
+)
+
+func parseConflictStrategy(s string) (conflictStrategy, error) {
+	switch strategy := conflictStrategy(s); strategy {
+	case lastWriteWins, serverWins, manualMerge:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("conflict strategy must be %s, %s or %s, got %q", lastWriteWins, serverWins, manualMerge, s)
+}
+
+// Statuses of pushed edits.
+const (
+	editApplied  = "applied"
+	editConflict = "conflict"
+	// editPending edits created a post held for review by moderation.
+	editPending  = "pending"
+	editRejected = "rejected"
+)
+
+// Resolutions of conflicting edits.
+const (
+	resolvedClientWins = "client-wins"
+	resolvedServerWins = "server-wins"
+	resolvedManual     = "manual"
+)
+
+// postEdit is a change made to a post offline.
+type postEdit struct {
+	// ID is empty for posts created offline.
+	ID       string    `json:"id"`
+	Text     string    `json:"text"`
+	Tags     []string  `json:"tags"`
+	Deleted  bool      `json:"deleted"`
+	EditedAt time.Time `json:"editedAt"`
+}
+
+// editResult tells the client what became of an edit. Post is the server's
+// version once resolved, nil when the post is deleted.
+type editResult struct {
+	ID         string         `json:"id"`
+	Status     string         `json:"status"`
+	Resolution string         `json:"resolution,omitempty"`
+	Post       *database.Post `json:"post"`
+	Error      *errorBody     `json:"error,omitempty"`
+}
+
+// resolveConflict reports whether an edit conflicting with a post written
+// on the server at writtenAt is applied, and how the conflict was resolved.
+func resolveConflict(strategy conflictStrategy, edit postEdit, writtenAt time.Time) (bool, string) {
+	switch strategy {
+	case lastWriteWins:
+		if edit.EditedAt.After(writtenAt) {
+			return true, resolvedClientWins
+		}
+		return false, resolvedServerWins
+	case serverWins:
+		return false, resolvedServerWins
+	}
+	return false, resolvedManual
+}
+
+// handlerSyncPush applies the post edits a client made offline, since the
+// sync token it last got. Edits of posts changed on the server meanwhile
+// are resolved with the configured strategy, or the one the client asks
+// for.
+func (apiCfg apiConfig) handlerSyncPush(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// get params
+	type parameters struct {
+		Since    string     `json:"since"`
+		Strategy string     `json:"strategy"`
+		Posts    []postEdit `json:"posts"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	strategy := apiCfg.syncConflicts
+	switch {
+	case params.Strategy != "":
+		strategy, err = parseConflictStrategy(params.Strategy)
+	case strategy == "":
+		strategy = lastWriteWins
+	}
+	if err == nil && params.Since == "" {
+		err = errors.New("since is required")
+	}
+	if err == nil && len(params.Posts) > maxSyncEdits {
+		err = fmt.Errorf("at most %d edits can be pushed at once", maxSyncEdits)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, validationFailed(err))
+		return
+	}
+
+	// find what changed on the server
+	changed, err := apiCfg.changes.since(params.Since, userID)
+	if errors.Is(err, errSyncTokenExpired) {
+		respondWithError(w, http.StatusGone, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// apply edits in order
+	results := []editResult{}
+	now := time.Now().UTC()
+	for _, edit := range params.Posts {
+		// clients can't win every conflict with a clock set ahead
+		if edit.EditedAt.IsZero() || edit.EditedAt.After(now) {
+			edit.EditedAt = now
+		}
+		writtenAt, conflict := changed.postsWrittenAt[edit.ID]
+		if !conflict {
+			results = append(results, apiCfg.applyPostEdit(userID, edit))
+			continue
+		}
+		// posts deleted on the server stay deleted
+		post, err := apiCfg.dbClient.GetPost(edit.ID)
+		if errors.Is(err, database.ErrNotFound) {
+			results = append(results, editResult{ID: edit.ID, Status: editConflict, Resolution: resolvedServerWins})
+			continue
+		}
+		if err != nil {
+			respondWithDBError(w, err)
+			return
+		}
+		apply, resolution := resolveConflict(strategy, edit, writtenAt)
+		if !apply {
+			results = append(results, editResult{ID: edit.ID, Status: editConflict, Resolution: resolution, Post: &post})
+			continue
+		}
+		result := apiCfg.applyPostEdit(userID, edit)
+		result.Resolution = resolution
+		results = append(results, result)
+	}
+	respondWithJSON(w, http.StatusOK, results)
+}
+
+// applyPostEdit creates, updates or deletes a post of the user with the
+// given ID.
+func (apiCfg apiConfig) applyPostEdit(userID string, edit postEdit) editResult {
+	result := editResult{ID: edit.ID, Status: editApplied}
+	var post database.Post
+	var err error
+	switch {
+	case edit.ID == "" && edit.Deleted:
+		err = service.ValidationError{Err: errors.New("new posts can't be deleted")}
+	case edit.ID == "":
+		post, err = apiCfg.posts().Create(userID, "", edit.Text, edit.Tags)
+	case edit.Deleted:
+		err = apiCfg.posts().Delete(edit.ID, userID)
+	default:
+		post, err = apiCfg.posts().Update(edit.ID, userID, edit.Text, edit.Tags)
+	}
+	pendingErr := service.PostPendingError{}
+	switch {
+	case errors.As(err, &pendingErr):
+		result.Status = editPending
+		result.ID = pendingErr.Post.ID
+	case err != nil:
+		code, err := serviceError(err)
+		if code == 0 {
+			code = http.StatusInternalServerError
+		}
+		result.Status = editRejected
+		result.Error = &errorBody{Code: errorCodeFor(code, err), Message: err.Error()}
+	case !edit.Deleted:
+		result.ID = post.ID
+		result.Post = &post
+	}
+	return result
+}
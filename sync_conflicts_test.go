@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestSyncPush(t *testing.T) {
+	changes := newChangeJournal()
+	c := database.NewMemoryClient().WithMutationHook(changes.applyMutations)
+	apiCfg := apiConfig{
+		dbClient:      c,
+		changes:       changes,
+		syncConflicts: lastWriteWins,
+		auth:          testAuth,
+	}
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := c.CreateUser("other@example.com", "12345", "Other", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := mediaTestLogin(t, apiCfg, "test@example.com")
+	create := func(userID, text string) database.Post {
+		post, err := c.CreatePost(userID, text, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return post
+	}
+	untouched := create(user.ID, "untouched")
+	edited := create(user.ID, "edited")
+	deleted := create(user.ID, "deleted")
+	foreign := create(other.ID, "foreign")
+
+	// the client syncs, then the server changes two posts
+	since := changes.token()
+	offline := time.Now().UTC()
+	_, err = c.UpdatePost(edited.ID, "edited on the server", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.DeletePost(deleted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	online := time.Now().UTC().Add(time.Second)
+
+	push := func(strategy, body string) (int, []editResult) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/sync", strings.NewReader(fmt.Sprintf(`{"since": %q, "strategy": %q, "posts": [%s]}`, since, strategy, body)))
+		r.Header.Set("Authorization", "Bearer "+token)
+		apiCfg.endpointSyncHandler(w, r)
+		results := []editResult{}
+		if w.Code == http.StatusOK {
+			err := json.NewDecoder(w.Body).Decode(&results)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, results
+	}
+	edit := func(id, text string, at time.Time) string {
+		return fmt.Sprintf(`{"id": %q, "text": %q, "editedAt": %q}`, id, text, at.Format(time.RFC3339Nano))
+	}
+
+	var tests = []struct {
+		name               string
+		strategy           string
+		body               string
+		expectedStatus     string
+		expectedResolution string
+		expectedText       string
+	}{
+		{name: "no conflict", body: edit(untouched.ID, "edited offline", offline), expectedStatus: editApplied, expectedText: "edited offline"},
+		{name: "new post", body: edit("", "written offline", offline), expectedStatus: editApplied, expectedText: "written offline"},
+		{name: "post of another user", body: edit(foreign.ID, "mine now", offline), expectedStatus: editRejected},
+		{name: "deleted on the server", body: edit(deleted.ID, "edited offline", online), expectedStatus: editConflict, expectedResolution: resolvedServerWins},
+		{name: "server wrote last", strategy: "last-write-wins", body: edit(edited.ID, "edited offline", offline), expectedStatus: editConflict, expectedResolution: resolvedServerWins, expectedText: "edited on the server"},
+		{name: "server wins", strategy: "server-wins", body: edit(edited.ID, "edited offline", online), expectedStatus: editConflict, expectedResolution: resolvedServerWins, expectedText: "edited on the server"},
+		{name: "manual merge", strategy: "manual", body: edit(edited.ID, "edited offline", online), expectedStatus: editConflict, expectedResolution: resolvedManual, expectedText: "edited on the server"},
+		{name: "client wrote last", body: edit(edited.ID, "edited offline", online), expectedStatus: editApplied, expectedResolution: resolvedClientWins, expectedText: "edited offline"},
+	}
+	for _, tt := range tests {
+		code, results := push(tt.strategy, tt.body)
+		if code != http.StatusOK || len(results) != 1 {
+			t.Errorf("%s: got status %d, %d results", tt.name, code, len(results))
+			continue
+		}
+		result := results[0]
+		if result.Status != tt.expectedStatus || result.Resolution != tt.expectedResolution {
+			t.Errorf("%s: got %s resolved %q, want %s resolved %q", tt.name, result.Status, result.Resolution, tt.expectedStatus, tt.expectedResolution)
+		}
+		if tt.expectedText != "" && (result.Post == nil || result.Post.Text != tt.expectedText) {
+			t.Errorf("%s: got post %+v, want text %q", tt.name, result.Post, tt.expectedText)
+		}
+	}
+
+	code, _ := push("first-wins", edit(edited.ID, "edited offline", online))
+	if code != http.StatusBadRequest {
+		t.Errorf("unknown strategy: got status %d, want 400", code)
+	}
+}
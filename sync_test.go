@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestSync(t *testing.T) {
+	changes := newChangeJournal()
+	c := database.NewMemoryClient().WithMutationHook(changes.applyMutations)
+	apiCfg := apiConfig{dbClient: c, changes: changes}
+	ann, err := c.CreateUser("ann@example.com", "12345", "Ann", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := c.CreateUser("bob@example.com", "12345", "Bob", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := c.CreatePost(ann.ID, "first", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sync := func(since string) (int, syncResult) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/sync?since="+since, nil)
+		apiCfg.endpointSyncHandler(w, r)
+		result := syncResult{}
+		if w.Code == http.StatusOK {
+			err := json.NewDecoder(w.Body).Decode(&result)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, result
+	}
+
+	// from scratch, everything visible
+	code, full := sync("")
+	if code != http.StatusOK || len(full.Users) != 2 || len(full.Posts) != 1 {
+		t.Fatalf("full sync: got status %d, %d users and %d posts, want 2 and 1", code, len(full.Users), len(full.Posts))
+	}
+	if full.Users[0].Password != "" {
+		t.Error("full sync: got a password")
+	}
+
+	// nothing changed
+	code, result := sync(full.Token)
+	if code != http.StatusOK || len(result.Users)+len(result.Posts)+len(result.DeletedUsers)+len(result.DeletedPosts) != 0 || result.Token != full.Token {
+		t.Errorf("sync without changes: got status %d, %+v", code, result)
+	}
+
+	// writes, deletions and suspensions come as changes
+	second, err := c.CreatePost(bob.ID, "second", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.DeletePost(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.UpdateUser(bob.ID, bob.Email, bob.Password, "Robert", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, result = sync(full.Token)
+	if code != http.StatusOK {
+		t.Fatalf("sync: got status %d", code)
+	}
+	// the authors of the posts created and deleted changed too
+	names := map[string]bool{}
+	for _, user := range result.Users {
+		names[user.Name] = true
+	}
+	if len(result.Users) != 2 || !names["Robert"] || !names["Ann"] {
+		t.Errorf("sync: got users %+v, want Robert and Ann", result.Users)
+	}
+	if len(result.Posts) != 1 || result.Posts[0].ID != second.ID {
+		t.Errorf("sync: got posts %+v, want %s", result.Posts, second.ID)
+	}
+	if len(result.DeletedPosts) != 1 || result.DeletedPosts[0] != first.ID {
+		t.Errorf("sync: got deleted posts %v, want %s", result.DeletedPosts, first.ID)
+	}
+	_, err = c.SuspendUser(database.Suspension{UserID: bob.ID, Reason: "spam", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, suspended := sync(result.Token)
+	if code != http.StatusOK || len(suspended.DeletedPosts) != 1 || suspended.DeletedPosts[0] != second.ID {
+		t.Errorf("sync after suspension: got status %d, deleted posts %v, want %s", code, suspended.DeletedPosts, second.ID)
+	}
+	err = c.DeleteUser(ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, result = sync(suspended.Token)
+	if code != http.StatusOK || len(result.DeletedUsers) != 1 || result.DeletedUsers[0] != ann.ID {
+		t.Errorf("sync after deleting a user: got status %d, deleted users %v, want %s", code, result.DeletedUsers, ann.ID)
+	}
+
+	var tests = []struct {
+		name           string
+		since          string
+		expectedStatus int
+	}{
+		{name: "not a token", since: "yesterday", expectedStatus: 400},
+		{name: "token from the future", since: changes.epoch + ".1000", expectedStatus: 400},
+		{name: "token of an earlier process", since: "0123456789abcdef.1", expectedStatus: 410},
+	}
+	for _, tt := range tests {
+		code, _ := sync(tt.since)
+		if code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d", tt.name, code, tt.expectedStatus)
+		}
+	}
+}
+
+func TestChangeJournalExpiresOldTokens(t *testing.T) {
+	changes := newChangeJournal()
+	old := changes.token()
+	for i := 0; i <= 2*maxJournalChanges; i++ {
+		changes.applyMutations([]database.Mutation{{Collection: "posts", Key: "p"}})
+	}
+	_, err := changes.since(old, "")
+	if err != errSyncTokenExpired {
+		t.Errorf("got %v, want %v", err, errSyncTokenExpired)
+	}
+	_, err = changes.since(changes.token(), "")
+	if err != nil {
+		t.Errorf("latest token: %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/events"
+	"github.com/firyx/boot.dev-api-backend/internal/router"
+	"github.com/firyx/boot.dev-api-backend/internal/service"
+)
+
+const tenantHeader = "X-Tenant-ID"
+
+// tenantIDPattern keeps tenant IDs usable as a subdomain.
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+var errTenantNotFound = apiError{Code: codeTenantNotFound, Message: "tenant doesn't exist"}
+
+// tenant is the API served from one database, with its own search index,
+// caches and event bus so nothing derived from its data leaks elsewhere.
+// The main database is the tenant without an ID.
+type tenant struct {
+	apiCfg apiConfig
+	bus    *events.Bus
+	// mux serves the API versions, it's only set for tenants opened by
+	// tenants.get.
+	mux *http.ServeMux
+}
+
+// newTenant serves the public API from c, sharing everything else in base.
+func newTenant(base apiConfig, id string, c database.Client) *tenant {
+	search := newSearchIndex()
+	c = c.WithMutationHook(search.applyMutations)
+	exists := newExistenceFilter()
+	c = c.WithMutationHook(exists.applyMutations)
+	revocations := newRevocationList()
+	c = c.WithMutationHook(revocations.applyMutations)
+	changes := newChangeJournal()
+	c = c.WithMutationHook(changes.applyMutations)
+	bus := events.NewBus()
+	// subscribers only hear of writes a rolled back transaction didn't undo
+	c = c.WithCommitHook(publishMutations(bus))
+
+	apiCfg := base
+	apiCfg.tenantID = id
+	apiCfg.dbClient = c
+	apiCfg.search = search
+	apiCfg.exists = exists
+	apiCfg.revocations = revocations
+	apiCfg.changes = changes
+	apiCfg.analytics = newAnalyticsCache()
+	apiCfg.leaderboards = &leaderboards{}
+	apiCfg.settings = &tenantSettings{}
+	apiCfg.subscribeBadges(bus)
+	apiCfg.subscribeStreaks(bus)
+	apiCfg.subscribeNotifications(bus)
+	return &tenant{apiCfg: apiCfg, bus: bus}
+}
+
+// tenantSettings holds the settings of a tenant. It's shared by the copies
+// of the tenant's apiConfig, so an update applies to all of them.
+type tenantSettings struct {
+	mu       sync.RWMutex
+	settings database.TenantSettings
+}
+
+// get returns the settings, whose policies allow everything when s is nil.
+func (s *tenantSettings) get() database.TenantSettings {
+	if s == nil {
+		return database.TenantSettings{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings
+}
+
+func (s *tenantSettings) set(settings database.TenantSettings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = settings
+}
+
+// tenants routes requests carrying a tenant ID, in the X-Tenant-ID header
+// or as a subdomain of baseDomain, to that tenant's database. Requests
+// without one use the main database, as before tenants existed. Tenant
+// databases are opened on first use and aren't replicated.
+type tenants struct {
+	// main serves the main database, which also lists the tenants.
+	main       *tenant
+	dir        string
+	baseDomain string
+	walEnabled bool
+	backend    string
+
+	mu     sync.Mutex
+	loaded map[string]*tenant
+}
+
+func newTenants(main *tenant, dir, baseDomain string) *tenants {
+	return &tenants{
+		main:       main,
+		dir:        dir,
+		baseDomain: baseDomain,
+		loaded:     map[string]*tenant{},
+	}
+}
+
+// tenantID returns the tenant a request is for, empty for the main
+// database.
+func (ts *tenants) tenantID(r *http.Request) string {
+	if id := r.Header.Get(tenantHeader); id != "" {
+		return strings.ToLower(id)
+	}
+	if ts.baseDomain == "" {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	sub, ok := strings.CutSuffix(strings.ToLower(host), "."+ts.baseDomain)
+	if !ok || strings.Contains(sub, ".") {
+		return ""
+	}
+	return sub
+}
+
+// get returns the tenant with the given ID, opening its database the first
+// time. The empty ID is the main database.
+func (ts *tenants) get(id string) (*tenant, error) {
+	if id == "" {
+		return ts.main, nil
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if t, ok := ts.loaded[id]; ok {
+		return t, nil
+	}
+	record, err := ts.main.apiCfg.dbClient.GetTenant(id)
+	if err != nil {
+		return nil, err
+	}
+	if ts.backend != "memory" {
+		err = os.MkdirAll(ts.dir, 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c, err := openDatabase(ts.backend, filepath.Join(ts.dir, id+".json"), ts.walEnabled)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s database: %w", id, err)
+	}
+	t := newTenant(ts.main.apiCfg, id, c)
+	t.apiCfg.settings.set(record.Settings)
+	t.apiCfg.search.rebuild(t.apiCfg.dbClient)
+	t.apiCfg.exists.rebuild(t.apiCfg.dbClient)
+	t.apiCfg.leaderboards.recompute(t.apiCfg.dbClient)
+	t.mux = http.NewServeMux()
+	registerAPIVersions(t.mux, t.apiCfg.apiVersions(), t.apiCfg.deprecations)
+	ts.loaded[id] = t
+	log.Printf("opened database of tenant %s", id)
+	return t, nil
+}
+
+// updated applies the new settings of a tenant if its database is open.
+func (ts *tenants) updated(record database.Tenant) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if t, ok := ts.loaded[record.ID]; ok {
+		t.apiCfg.settings.set(record.Settings)
+	}
+}
+
+// all returns the main database and the tenants opened so far, for
+// background jobs.
+func (ts *tenants) all() []*tenant {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	all := []*tenant{ts.main}
+	for _, t := range ts.loaded {
+		all = append(all, t)
+	}
+	return all
+}
+
+// middleware sends tenant requests to the tenant's API. Paths outside the
+// public API, like /healthz and /admin, are shared by all tenants.
+func (ts *tenants) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := ts.tenantID(r)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		t, err := ts.get(id)
+		if errors.Is(err, database.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, errTenantNotFound)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if _, pattern := t.mux.Handler(r); pattern == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		t.mux.ServeHTTP(w, r)
+	})
+}
+
+// adminTenantsRoutes are the routes below /admin/tenants.
+var adminTenantsRoutes = newRoutes([]route{
+	{http.MethodGet, "", apiConfig.handlerGetTenants},
+	{http.MethodPost, "", apiConfig.handlerCreateTenant},
+	{http.MethodGet, "/{id}/settings", apiConfig.handlerGetTenantSettings},
+	{http.MethodPut, "/{id}/settings", apiConfig.handlerUpdateTenantSettings},
+})
+
+func (apiCfg apiConfig) endpointAdminTenantsHandler(w http.ResponseWriter, r *http.Request) {
+	apiCfg.serveRoute(adminTenantsRoutes, "/admin/tenants", w, r)
+}
+
+func (apiCfg apiConfig) handlerGetTenants(w http.ResponseWriter, r *http.Request) {
+	tenants, err := apiCfg.dbClient.GetTenants()
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, tenants)
+}
+
+func (apiCfg apiConfig) handlerCreateTenant(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !tenantIDPattern.MatchString(params.ID) {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("tenant id must be lowercase letters, digits and hyphens, as in a subdomain")))
+		return
+	}
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("name can't be empty")))
+		return
+	}
+
+	// create tenant and its database
+	tenant, err := apiCfg.dbClient.CreateTenant(params.ID, params.Name)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	_, err = apiCfg.tenants.get(tenant.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, tenant)
+}
+
+func getTenantSettingsID(r *http.Request) (string, error) {
+	id := router.Param(r, "id")
+	if id == "" {
+		return "", invalidPath("bad request, correct format is: /admin/tenants/{id}/settings")
+	}
+	return id, nil
+}
+
+func (apiCfg apiConfig) handlerGetTenantSettings(w http.ResponseWriter, r *http.Request) {
+	// check path
+	id, err := getTenantSettingsID(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check tenant exists
+	tenant, err := apiCfg.dbClient.GetTenant(id)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, errTenantNotFound)
+		return
+	}
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, tenant.Settings)
+}
+
+func (apiCfg apiConfig) handlerUpdateTenantSettings(w http.ResponseWriter, r *http.Request) {
+	// get params
+	decoder := json.NewDecoder(r.Body)
+	params := database.TenantSettings{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	// check path
+	id, err := getTenantSettingsID(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check settings
+	err = service.ValidateContentPolicy(params.ContentPolicy)
+	if err == nil {
+		err = service.ValidatePasswordPolicy(params.PasswordPolicy)
+	}
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// update settings, applying them to the open tenant
+	tenant, err := apiCfg.dbClient.UpdateTenantSettings(id, params)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, errTenantNotFound)
+		return
+	}
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if apiCfg.tenants != nil {
+		apiCfg.tenants.updated(tenant)
+	}
+	respondWithJSON(w, http.StatusOK, tenant.Settings)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/auth"
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	dir := t.TempDir()
+	c := database.NewClient(filepath.Join(dir, "db.json"))
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := apiConfig{usersPrefix: "/users", postsprefix: "/posts", auth: authConfig{secret: []byte("secret")}}
+	main := newTenant(base, "", c)
+	apiCfg := main.apiCfg
+	apiCfg.tenants = newTenants(main, filepath.Join(dir, "tenants"), "api.example.com")
+	mux := http.NewServeMux()
+	registerAPIVersions(mux, apiCfg.apiVersions(), nil)
+	mux.HandleFunc("/admin/tenants", apiCfg.endpointAdminTenantsHandler)
+	mux.HandleFunc("/admin/tenants/", apiCfg.endpointAdminTenantsHandler)
+	handler := apiCfg.tenants.middleware(mux)
+
+	var tests = []struct {
+		name           string
+		method         string
+		host           string
+		tenant         string
+		path           string
+		body           string
+		as             string
+		expectedStatus int
+	}{
+		{name: "invalid tenant id", method: http.MethodPost, path: "/admin/tenants", body: `{"id": "Acme Inc", "name": "Acme"}`, expectedStatus: http.StatusBadRequest},
+		{name: "create tenant", method: http.MethodPost, path: "/admin/tenants", body: `{"id": "acme", "name": "Acme"}`, expectedStatus: http.StatusCreated},
+		{name: "duplicate tenant", method: http.MethodPost, path: "/admin/tenants", body: `{"id": "acme", "name": "Acme"}`, expectedStatus: http.StatusConflict},
+		{name: "create in tenant", method: http.MethodPost, tenant: "acme", path: "/users", body: `{"email": "test@example.com", "password": "12345", "name": "Test", "age": 18}`, expectedStatus: http.StatusCreated},
+		{name: "found by header", method: http.MethodGet, tenant: "acme", path: "/users/test@example.com", expectedStatus: http.StatusOK},
+		{name: "found by subdomain", method: http.MethodGet, host: "acme.api.example.com", path: "/v1/users/test@example.com", expectedStatus: http.StatusOK},
+		{name: "not in main database", method: http.MethodGet, path: "/users/test@example.com", expectedStatus: http.StatusNotFound},
+		{name: "unknown tenant", method: http.MethodGet, tenant: "other", path: "/users/test@example.com", expectedStatus: http.StatusNotFound},
+		{name: "admin shared", method: http.MethodGet, tenant: "acme", path: "/admin/tenants", expectedStatus: http.StatusOK},
+		{name: "invalid content policy", method: http.MethodPut, path: "/admin/tenants/acme/settings", body: `{"contentPolicy": {"links": "nofollow"}}`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid password policy", method: http.MethodPut, path: "/admin/tenants/acme/settings", body: `{"passwordPolicy": {"minLength": -1}}`, expectedStatus: http.StatusBadRequest},
+		{name: "set content and password policy", method: http.MethodPut, path: "/admin/tenants/acme/settings", body: `{"contentPolicy": {"maxLength": 5, "links": "deny"}, "passwordPolicy": {"minLength": 8, "requireDigit": true}}`, expectedStatus: http.StatusOK},
+		{name: "signup breaking password policy", method: http.MethodPost, tenant: "acme", path: "/users", body: `{"email": "weak@example.com", "password": "12345", "name": "Weak", "age": 18}`, expectedStatus: http.StatusBadRequest},
+		{name: "signup within password policy", method: http.MethodPost, tenant: "acme", path: "/users", body: `{"email": "strong@example.com", "password": "12345678", "name": "Strong", "age": 18}`, expectedStatus: http.StatusCreated},
+		{name: "get settings", method: http.MethodGet, path: "/admin/tenants/acme/settings", expectedStatus: http.StatusOK},
+		{name: "settings of unknown tenant", method: http.MethodGet, path: "/admin/tenants/other/settings", expectedStatus: http.StatusNotFound},
+		{name: "post within policy", method: http.MethodPost, tenant: "acme", path: "/posts", body: `{"userEmail": "test@example.com", "text": "short"}`, as: "test@example.com", expectedStatus: http.StatusCreated},
+		{name: "post breaking policy", method: http.MethodPost, tenant: "acme", path: "/posts", body: `{"userEmail": "test@example.com", "text": "too long"}`, as: "test@example.com", expectedStatus: http.StatusBadRequest},
+		{name: "main database without policy", method: http.MethodPost, path: "/users", body: `{"email": "main@example.com", "password": "12345", "name": "Main", "age": 18}`, expectedStatus: http.StatusCreated},
+		{name: "post in main database", method: http.MethodPost, path: "/posts", body: `{"userEmail": "main@example.com", "text": "too long"}`, as: "main@example.com", expectedStatus: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.host != "" {
+			r.Host = tt.host
+		}
+		if tt.tenant != "" {
+			r.Header.Set(tenantHeader, tt.tenant)
+		}
+		if tt.as != "" {
+			tenant, err := apiCfg.tenants.get(tt.tenant)
+			if err != nil {
+				t.Fatal(err)
+			}
+			user, err := tenant.apiCfg.dbClient.GetUserByEmail(tt.as)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := auth.Sign(base.auth.secret, auth.NewClaims(user.ID, time.Now(), time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, w.Code, tt.expectedStatus, w.Body)
+		}
+	}
+}
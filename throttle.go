@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const throttleWindow = time.Minute
+
+var errBudgetExceeded = apiError{Code: codeTooManyRequests, Message: "request budget for this minute is spent, retry later"}
+
+// apiVersionPrefix matches the version root of a path, e.g. /v1.
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9]+/`)
+
+// costThrottle gives every caller a budget of cost units per minute. A
+// request costs the weight of the longest matching route, or defaultCost.
+// Callers are the signed in user, or the client's address without a session.
+// A budget of 0 turns the throttle off.
+type costThrottle struct {
+	defaultCost int
+	now         func() time.Time
+
+	mu         sync.Mutex
+	budget     int
+	routeCosts map[string]int
+	windows    map[string]*throttleWindowUsage
+	sweptAt    time.Time
+}
+
+type throttleWindowUsage struct {
+	start time.Time
+	spent int
+}
+
+func newCostThrottle(budget int, routeCosts map[string]int) *costThrottle {
+	return &costThrottle{
+		budget:      budget,
+		defaultCost: 1,
+		routeCosts:  routeCosts,
+		now:         time.Now,
+		windows:     map[string]*throttleWindowUsage{},
+	}
+}
+
+// parseRouteCosts parses "/search=5,/admin/export.bundle=20".
+func parseRouteCosts(s string) (map[string]int, error) {
+	costs := map[string]int{}
+	if s == "" {
+		return costs, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		route, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid route cost: %s", pair)
+		}
+		cost, err := strconv.Atoi(value)
+		if err != nil || cost < 0 {
+			return nil, fmt.Errorf("invalid cost for %s: %s", route, value)
+		}
+		costs[route] = cost
+	}
+	return costs, nil
+}
+
+// configure changes the budget and route costs on reload, keeping what
+// callers have spent in the current window.
+func (t *costThrottle) configure(budget int, routeCosts map[string]int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.budget = budget
+	t.routeCosts = routeCosts
+}
+
+func (t *costThrottle) limit() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.budget
+}
+
+// cost returns the weight of a request, ignoring the API version prefix.
+func (t *costThrottle) cost(path string) int {
+	if loc := apiVersionPrefix.FindStringIndex(path); loc != nil {
+		path = path[loc[1]-1:]
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cost := t.defaultCost
+	longest := -1
+	for route, routeCost := range t.routeCosts {
+		if strings.HasPrefix(path, route) && len(route) > longest {
+			cost = routeCost
+			longest = len(route)
+		}
+	}
+	return cost
+}
+
+// spend charges cost to caller if the budget allows it and returns what is
+// left and when the window resets.
+func (t *costThrottle) spend(caller string, cost int) (bool, int, time.Time) {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Sub(t.sweptAt) >= throttleWindow {
+		for key, usage := range t.windows {
+			if now.Sub(usage.start) >= throttleWindow {
+				delete(t.windows, key)
+			}
+		}
+		t.sweptAt = now
+	}
+	usage, ok := t.windows[caller]
+	if !ok || now.Sub(usage.start) >= throttleWindow {
+		usage = &throttleWindowUsage{start: now}
+		t.windows[caller] = usage
+	}
+	reset := usage.start.Add(throttleWindow)
+	if usage.spent+cost > t.budget {
+		return false, t.budget - usage.spent, reset
+	}
+	usage.spent += cost
+	return true, t.budget - usage.spent, reset
+}
+
+func (apiCfg apiConfig) throttleMiddleware(t *costThrottle, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget := t.limit()
+		if budget == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		caller := "addr:" + clientIP(r)
+		if userID, err := apiCfg.authenticatedUserID(r); err == nil {
+			caller = "user:" + userID
+		}
+		cost := t.cost(r.URL.Path)
+		ok, remaining, reset := t.spend(caller, cost)
+		resetIn := int(reset.Sub(t.now()).Round(time.Second).Seconds())
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(budget))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(resetIn))
+		w.Header().Set("X-RateLimit-Cost", strconv.Itoa(cost))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(resetIn))
+			respondWithError(w, http.StatusTooManyRequests, errBudgetExceeded)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
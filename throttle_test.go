@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCostThrottle(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	throttle := newCostThrottle(10, map[string]int{"/search": 4})
+	throttle.now = func() time.Time { return now }
+	apiCfg := apiConfig{auth: authConfig{secret: []byte("secret")}}
+	handler := apiCfg.throttleMiddleware(throttle, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var tests = []struct {
+		path              string
+		remoteAddr        string
+		after             time.Duration
+		expectedStatus    int
+		expectedRemaining string
+	}{
+		{path: "/v1/search?q=go", remoteAddr: "192.0.2.1:1000", expectedStatus: 200, expectedRemaining: "6"},
+		{path: "/search", remoteAddr: "192.0.2.1:1001", expectedStatus: 200, expectedRemaining: "2"},
+		{path: "/v1/search", remoteAddr: "192.0.2.1:1002", expectedStatus: 429, expectedRemaining: "2"},
+		{path: "/users", remoteAddr: "192.0.2.1:1003", expectedStatus: 200, expectedRemaining: "1"},
+		// other callers have their own budget
+		{path: "/v1/search", remoteAddr: "192.0.2.2:1000", expectedStatus: 200, expectedRemaining: "6"},
+		// the budget refills every minute
+		{path: "/v1/search", remoteAddr: "192.0.2.1:1004", after: time.Minute, expectedStatus: 200, expectedRemaining: "6"},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.after)
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.RemoteAddr = tt.remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s from %s: got status %d, want %d", tt.path, tt.remoteAddr, w.Code, tt.expectedStatus)
+		}
+		if remaining := w.Header().Get("X-RateLimit-Remaining"); remaining != tt.expectedRemaining {
+			t.Errorf("%s from %s: got remaining %s, want %s", tt.path, tt.remoteAddr, remaining, tt.expectedRemaining)
+		}
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: got no Retry-After", tt.path)
+		}
+	}
+}
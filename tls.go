@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// serve starts srv over HTTPS when a certificate or an autocert domain is
+// configured, and over plain HTTP otherwise. With HTTPS, redirectListener,
+// if not nil, redirects HTTP requests to it.
+func serve(srv *http.Server, l, redirectListener net.Listener, cfg config) error {
+	if cfg.tlsDomains == "" && cfg.tlsCertFile == "" {
+		return srv.Serve(l)
+	}
+	if cfg.tlsDomains != "" && cfg.tlsCertFile != "" {
+		return errors.New("configure either TLS_DOMAINS or TLS_CERT_FILE, not both")
+	}
+
+	var redirect http.Handler = httpsRedirectHandler(srv.Addr)
+	if cfg.tlsDomains != "" {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(cfg.tlsDomains, ",")...),
+			Cache:      autocert.DirCache(cfg.tlsCacheDir),
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		// also answers ACME http-01 challenges
+		redirect = manager.HTTPHandler(redirect)
+	}
+	if redirectListener != nil {
+		go func() {
+			log.Printf("redirecting HTTP on %s to HTTPS", cfg.httpRedirectAddr)
+			err := http.Serve(redirectListener, redirect)
+			log.Printf("HTTP redirect listener: %v", err)
+		}()
+	}
+	return srv.ServeTLS(l, cfg.tlsCertFile, cfg.tlsKeyFile)
+}
+
+// httpsRedirectHandler permanently redirects to the same URL on the HTTPS
+// listener at tlsAddr.
+func httpsRedirectHandler(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" && port != "https" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	var tests = []struct {
+		tlsAddr  string
+		host     string
+		path     string
+		expected string
+	}{
+		{tlsAddr: ":443", host: "example.com", path: "/users?x=1", expected: "https://example.com/users?x=1"},
+		{tlsAddr: ":443", host: "example.com:80", path: "/", expected: "https://example.com/"},
+		{tlsAddr: "0.0.0.0:8443", host: "localhost:8080", path: "/posts", expected: "https://localhost:8443/posts"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Host = tt.host
+		w := httptest.NewRecorder()
+		httpsRedirectHandler(tt.tlsAddr).ServeHTTP(w, req)
+		if w.Code != http.StatusPermanentRedirect {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusPermanentRedirect)
+		}
+		if location := w.Header().Get("Location"); location != tt.expected {
+			t.Errorf("got %s, want %s", location, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/tracing"
+)
+
+// newTracer exports spans to the OTLP collector of cfg. It returns nil when
+// tracing is off.
+func newTracer(cfg config) *tracing.Tracer {
+	if cfg.otlpEndpoint == "" {
+		return nil
+	}
+	return tracing.NewTracer(tracing.OTLP{
+		URL:         cfg.otlpEndpoint,
+		Headers:     cfg.otlpHeaders,
+		ServiceName: cfg.otelServiceName,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+	}, cfg.traceSampleRatio, 5*time.Second)
+}
+
+// tracingMiddleware records a span for every request, continuing the trace
+// of callers sending a traceparent header.
+func tracingMiddleware(tracer *tracing.Tracer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent, _ := tracing.ParseTraceparent(r.Header.Get("traceparent"))
+		ctx, span := tracer.Start(r.Context(), "HTTP "+r.Method, tracing.KindServer, parent)
+		defer span.Finish()
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("request.id", requestIDFromContext(ctx))
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttribute("http.response.status_code", recorder.status)
+		if recorder.status >= 500 {
+			span.SetError(httpError(recorder.status))
+		}
+	})
+}
+
+type httpError int
+
+func (e httpError) Error() string {
+	return strings.ToLower(http.StatusText(int(e)))
+}
+
+// traced binds the database client to the request context, so database
+// reads and writes show up in the request's trace, and join the transaction
+// of an atomic batch.
+func (apiCfg apiConfig) traced(handler func(apiConfig, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqCfg := apiCfg
+		reqCfg.dbClient = reqCfg.dbClient.WithContext(r.Context())
+		handler(reqCfg, w, r)
+	}
+}
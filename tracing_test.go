@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/tracing"
+)
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*tracing.Span
+}
+
+func (r *spanRecorder) Export(ctx context.Context, spans []*tracing.Span) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	exported := &spanRecorder{}
+	tracer := tracing.NewTracer(exported, 1, time.Hour)
+	apiCfg := apiConfig{dbClient: database.NewMemoryClient(), usersPrefix: "/users"}
+	handler := tracingMiddleware(tracer, apiCfg.traced(apiConfig.endpointUsersHandler))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"email": "test@example.com", "password": "12345", "name": "Test", "age": 18}`))
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	tracer.Close()
+
+	var request *tracing.Span
+	operations := map[string]bool{}
+	for _, span := range exported.spans {
+		if span.Kind == tracing.KindServer {
+			request = span
+		}
+	}
+	if request == nil || request.Attributes["http.response.status_code"] != http.StatusCreated {
+		t.Fatalf("got request span %+v", request)
+	}
+	for _, span := range exported.spans {
+		if span.Kind != tracing.KindClient {
+			continue
+		}
+		if span.TraceID != request.TraceID || span.ParentID != request.ID {
+			t.Errorf("database span %s isn't a child of the request", span.Name)
+		}
+		operations[span.Name+" "+span.Attributes["db.operation"].(string)] = true
+	}
+	for _, expected := range []string{"database.update InsertUser", "database.update RecordSignup"} {
+		if !operations[expected] {
+			t.Errorf("got database spans %v, want %q", operations, expected)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/translate"
+)
+
+var errTranslationDisabled = apiError{Code: codeNotImplemented, Message: "translation is disabled, set TRANSLATE_PROVIDER to translate posts"}
+
+// languagePattern matches ISO 639-1 language codes, optionally with a
+// region like pt-BR.
+var languagePattern = regexp.MustCompile(`^[a-z]{2}(-[A-Za-z]{2})?$`)
+
+type postTranslation struct {
+	PostID string `json:"postId"`
+	// Revision identifies the text that was translated, it changes when
+	// the post is edited.
+	Revision string `json:"revision"`
+	Language string `json:"language"`
+	Text     string `json:"text"`
+	Cached   bool   `json:"cached"`
+}
+
+// newTranslator sets up the configured translation provider behind a cache,
+// or returns nil if translation is disabled.
+func newTranslator(cfg config) (*translate.Cache, error) {
+	var provider translate.Provider
+	switch cfg.translateProvider {
+	case "":
+		return nil, nil
+	case "mock":
+		provider = translate.Mock{}
+	case "libretranslate":
+		if cfg.translateURL == "" {
+			return nil, errors.New("TRANSLATE_URL is required with TRANSLATE_PROVIDER=libretranslate")
+		}
+		provider = translate.LibreTranslate{
+			URL:    cfg.translateURL,
+			APIKey: cfg.translateAPIKey,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}
+	default:
+		return nil, fmt.Errorf("TRANSLATE_PROVIDER must be mock or libretranslate, got %q", cfg.translateProvider)
+	}
+	return translate.NewCache(provider, cfg.translateCacheSize), nil
+}
+
+// postRevision identifies the current text of a post.
+func postRevision(post database.Post) string {
+	sum := sha256.Sum256([]byte(post.Text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// handlerTranslatePost translates a post into the language in ?to=.
+func (apiCfg apiConfig) handlerTranslatePost(w http.ResponseWriter, r *http.Request) {
+	// check path
+	id, err := getPostUuid(apiCfg, r)
+	if err != nil || id == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /posts/{post-id}/translate?to={language}"))
+		return
+	}
+
+	// get params
+	to := r.URL.Query().Get("to")
+	if !languagePattern.MatchString(to) {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("to must be a language code like fr or pt-BR")))
+		return
+	}
+	if apiCfg.translator == nil {
+		respondWithError(w, http.StatusNotImplemented, errTranslationDisabled)
+		return
+	}
+
+	// check post exists
+	post, err := apiCfg.posts().Get(id)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+
+	// translate post, unless the client has the translation already
+	if notModified(w, r, post.UpdatedAt) {
+		return
+	}
+	revision := postRevision(post)
+	text, cached, err := apiCfg.translator.Translate(r.Context(), post.ID, revision, post.Text, to)
+	if errors.Is(err, translate.ErrUnsupportedLanguage) {
+		respondWithError(w, http.StatusBadRequest, validationFailed(err))
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, fmt.Errorf("translation provider: %w", err))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, postTranslation{
+		PostID:   post.ID,
+		Revision: revision,
+		Language: to,
+		Text:     text,
+		Cached:   cached,
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/translate"
+)
+
+func TestTranslatePost(t *testing.T) {
+	c := database.NewMemoryClient()
+	apiCfg := apiConfig{
+		dbClient:    c,
+		postsprefix: "/posts",
+		translator:  translate.NewCache(translate.Mock{}, 10),
+	}
+	user, err := c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := c.CreatePost(user.ID, "hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	translatePost := func() postTranslation {
+		t.Helper()
+		w := httptest.NewRecorder()
+		apiCfg.endpointPostsHandler(w, httptest.NewRequest(http.MethodGet, "/posts/"+post.ID+"/translate?to=fr", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+		res := postTranslation{}
+		err := json.NewDecoder(w.Body).Decode(&res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	first := translatePost()
+	if first.Text != "[fr] hello" || first.Cached {
+		t.Errorf("got %+v, want a fresh translation of hello", first)
+	}
+	if second := translatePost(); !second.Cached || second.Revision != first.Revision {
+		t.Errorf("got %+v, want the cached translation", second)
+	}
+	_, err = c.UpdatePost(post.ID, "hi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited := translatePost(); edited.Text != "[fr] hi" || edited.Cached || edited.Revision == first.Revision {
+		t.Errorf("got %+v, want a fresh translation of the new revision", edited)
+	}
+
+	apiCfg.translator = nil
+	w := httptest.NewRecorder()
+	apiCfg.endpointPostsHandler(w, httptest.NewRequest(http.MethodGet, "/posts/"+post.ID+"/translate?to=fr", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("got status %d without a provider, want %d", w.Code, http.StatusNotImplemented)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/totp"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	errTOTPRequired = apiError{Code: codeTOTPRequired, Message: "two-factor authentication is on, send totpCode or recoveryCode"}
+	errForbidden    = apiError{Code: codeForbidden, Message: "users can only set up two-factor authentication for themselves"}
+)
+
+type twoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauthUrl"`
+}
+
+type twoFactorEnabled struct {
+	// RecoveryCodes are only ever shown here, the database keeps hashes.
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// handlerTwoFactorSetup generates a new TOTP secret for the logged in user.
+// It isn't required at login until confirmed with handlerTwoFactorVerify.
+func (apiCfg apiConfig) handlerTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check path
+	ref, err := getUserRef(apiCfg, r)
+	if err != nil || ref == "" {
+		respondWithError(w, http.StatusBadRequest, invalidPath("bad request, correct format is: /users/{id}/2fa/setup"))
+		return
+	}
+
+	// check user exists and is the one logged in
+	user, err := apiCfg.users().Get(ref)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	if user.ID != userID {
+		respondWithError(w, http.StatusForbidden, errForbidden)
+		return
+	}
+
+	// check two-factor isn't on already
+	tf, err := apiCfg.dbClient.GetTwoFactor(user.ID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		respondWithDBError(w, err)
+		return
+	}
+	if tf.Enabled {
+		respondWithError(w, http.StatusConflict, apiError{Code: codeConflict, Message: "two-factor authentication is already on"})
+		return
+	}
+
+	// store pending secret
+	secret, err := totp.NewSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = apiCfg.dbClient.SaveTwoFactor(database.TwoFactor{UserID: user.ID, Secret: secret})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, twoFactorSetup{
+		Secret:     secret,
+		OTPAuthURL: totp.URI(apiCfg.totpIssuer, user.Email, secret),
+	})
+}
+
+// handlerTwoFactorVerify turns on two-factor authentication for the logged
+// in user once they send a valid code, and returns their recovery codes.
+func (apiCfg apiConfig) handlerTwoFactorVerify(w http.ResponseWriter, r *http.Request) {
+	// get params
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// check session
+	userID, err := apiCfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// check setup is pending
+	tf, err := apiCfg.dbClient.GetTwoFactor(userID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if tf.Enabled {
+		respondWithError(w, http.StatusConflict, apiError{Code: codeConflict, Message: "two-factor authentication is already on"})
+		return
+	}
+
+	// check code
+	if !totp.Validate(tf.Secret, params.Code, time.Now()) {
+		respondWithError(w, http.StatusBadRequest, validationFailed(errors.New("invalid code, check the authenticator app's clock")))
+		return
+	}
+
+	// enable
+	codes := make([]string, recoveryCodeCount)
+	tf.RecoveryCodes = make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		tf.RecoveryCodes[i] = hashRecoveryCode(codes[i])
+	}
+	tf.Enabled = true
+	err = apiCfg.dbClient.SaveTwoFactor(tf)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, twoFactorEnabled{RecoveryCodes: codes})
+}
+
+// secondFactorCodes are what a user logging in sends for their second
+// factor, one of them is needed once two-factor authentication is on.
+type secondFactorCodes struct {
+	TOTPCode     string `json:"totpCode"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// checkSecondFactor checks the second factor of a user logging in, if they
+// turned two-factor authentication on, and responds when it's missing or
+// wrong. respondWithSession runs it, so every way of logging in does.
+func (apiCfg apiConfig) checkSecondFactor(w http.ResponseWriter, userID string, codes secondFactorCodes, attempts database.LoginAttempts, now time.Time) bool {
+	tf, err := apiCfg.dbClient.GetTwoFactor(userID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		respondWithDBError(w, err)
+		return false
+	}
+	if !tf.Enabled {
+		return true
+	}
+	if codes.TOTPCode == "" && codes.RecoveryCode == "" {
+		respondWithError(w, http.StatusUnauthorized, errTOTPRequired)
+		return false
+	}
+	ok, err := apiCfg.validSecondFactor(tf, codes, now)
+	if err != nil {
+		respondWithDBError(w, err)
+		return false
+	}
+	if !ok {
+		apiCfg.respondWithLoginFailure(w, attempts, now)
+		return false
+	}
+	return true
+}
+
+// validSecondFactor validates a TOTP code or a recovery code at login. A
+// recovery code can only be used once.
+func (apiCfg apiConfig) validSecondFactor(tf database.TwoFactor, codes secondFactorCodes, now time.Time) (bool, error) {
+	code, recoveryCode := codes.TOTPCode, codes.RecoveryCode
+	if code != "" {
+		return totp.Validate(tf.Secret, code, now), nil
+	}
+	hash := hashRecoveryCode(recoveryCode)
+	for i, stored := range tf.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(stored)) == 1 {
+			tf.RecoveryCodes = append(tf.RecoveryCodes[:i:i], tf.RecoveryCodes[i+1:]...)
+			return true, apiCfg.dbClient.SaveTwoFactor(tf)
+		}
+	}
+	return false, nil
+}
+
+// newRecoveryCode returns a random code like "abcde-fghij".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode hashes a recovery code for storage. Codes are random, so
+// a plain hash is enough, and it ignores case and dashes like users would.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
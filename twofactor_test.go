@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+	"github.com/firyx/boot.dev-api-backend/internal/totp"
+)
+
+func TestTwoFactorLogin(t *testing.T) {
+	c := database.NewMemoryClient()
+	err := c.EnsureDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.CreateUser("test@example.com", "12345", "Test", 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCfg := apiConfig{
+		dbClient:    c,
+		usersPrefix: "/users",
+		totpIssuer:  "Example",
+		auth: authConfig{
+			secret:        []byte("secret"),
+			sessionTTL:    time.Hour,
+			maxFailures:   10,
+			failureWindow: time.Minute,
+			lockout:       time.Minute,
+		},
+	}
+	call := func(handler http.HandlerFunc, path, token, body string, expectedStatus int, v interface{}) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != expectedStatus {
+			t.Fatalf("%s %s: got status %d, want %d: %s", path, body, w.Code, expectedStatus, w.Body)
+		}
+		if v != nil {
+			err := json.NewDecoder(w.Body).Decode(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	login := `{"email": "test@example.com", "password": "12345"`
+
+	s := session{}
+	call(apiCfg.handlerLogin, "/login", "", login+"}", http.StatusOK, &s)
+	call(apiCfg.endpointUsersHandler, "/users/test@example.com/2fa/setup", "", "", http.StatusUnauthorized, nil)
+	setup := twoFactorSetup{}
+	call(apiCfg.endpointUsersHandler, "/users/test@example.com/2fa/setup", s.Token, "", http.StatusCreated, &setup)
+	if !strings.HasPrefix(setup.OTPAuthURL, "otpauth://totp/Example:test@example.com?") {
+		t.Errorf("got %s", setup.OTPAuthURL)
+	}
+
+	// not required until verified
+	call(apiCfg.handlerLogin, "/login", "", login+"}", http.StatusOK, nil)
+	call(apiCfg.handlerTwoFactorVerify, "/2fa/verify", s.Token, `{"code": "000000"}`, http.StatusBadRequest, nil)
+	code, err := totp.Code(setup.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := twoFactorEnabled{}
+	call(apiCfg.handlerTwoFactorVerify, "/2fa/verify", s.Token, `{"code": "`+code+`"}`, http.StatusOK, &enabled)
+	if len(enabled.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(enabled.RecoveryCodes), recoveryCodeCount)
+	}
+
+	recovery := enabled.RecoveryCodes[0]
+	call(apiCfg.handlerLogin, "/login", "", login+"}", http.StatusUnauthorized, nil)
+	call(apiCfg.handlerLogin, "/login", "", login+`, "totpCode": "`+code+`"}`, http.StatusOK, nil)
+	call(apiCfg.handlerLogin, "/login", "", login+`, "recoveryCode": "`+strings.ToUpper(recovery)+`"}`, http.StatusOK, nil)
+	call(apiCfg.handlerLogin, "/login", "", login+`, "recoveryCode": "`+recovery+`"}`, http.StatusUnauthorized, nil)
+}
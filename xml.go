@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// xmlName matches the JSON keys usable as XML element names.
+var xmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// xmlEncoder writes responses as XML, with an element for each JSON field
+// named like it, in the same order. Arrays hold an element per item, and
+// fields whose names aren't valid in XML become <entry key="...">.
+type xmlEncoder struct{}
+
+func (xmlEncoder) encode(w *formatWriter, code int, payload interface{}, response []byte) ([]byte, error) {
+	root, item := xmlRootNames(payload)
+	if _, ok := payload.(errorBody); ok {
+		root = "error"
+	} else if code < 300 {
+		var err error
+		response, err = selectFields(response, w.fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(buf)
+	dec := json.NewDecoder(bytes.NewReader(response))
+	dec.UseNumber()
+	err := writeXMLValue(dec, enc, root, item)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// xmlRootNames names the root element and the items of arrays after the Go
+// type of payload, e.g. <users><user>...</user></users> for a slice of
+// database.User. Unnamed types give <response><item>...</item></response>.
+func xmlRootNames(payload interface{}) (string, string) {
+	t := reflect.TypeOf(payload)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return "response", "item"
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		elem := t.Elem()
+		for elem.Kind() == reflect.Pointer {
+			elem = elem.Elem()
+		}
+		if elem.Name() == "" {
+			return "response", "item"
+		}
+		return jsonAPIType(payload, ""), xmlTypeName(elem)
+	}
+	if t.Name() == "" {
+		return "response", "item"
+	}
+	return xmlTypeName(t), "item"
+}
+
+func xmlTypeName(t reflect.Type) string {
+	return strings.ToLower(t.Name()[:1]) + t.Name()[1:]
+}
+
+// writeXMLValue writes the next JSON value of dec as an element called
+// name, naming the items of arrays item.
+func writeXMLValue(dec *json.Decoder, enc *xml.Encoder, name, item string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !xmlName.MatchString(name) || strings.HasPrefix(strings.ToLower(name), "xml") {
+		start = xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}}}
+	}
+	err = enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		for dec.More() {
+			if tok == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				err = writeXMLValue(dec, enc, fmt.Sprint(key), "item")
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			err = writeXMLValue(dec, enc, item, "item")
+			if err != nil {
+				return err
+			}
+		}
+		// the closing delimiter
+		_, err = dec.Token()
+		if err != nil {
+			return err
+		}
+	case nil:
+		// null is an empty element
+	default:
+		err = enc.EncodeToken(xml.CharData(fmt.Sprint(tok)))
+		if err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
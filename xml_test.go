@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/firyx/boot.dev-api-backend/internal/database"
+)
+
+func TestXMLResponses(t *testing.T) {
+	user := database.User{ID: "u1", CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Email: "ann@example.com", Name: "Ann & co", Age: 18}
+	handler := responseFormatMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users":
+			respondWithJSON(w, http.StatusOK, []database.User{user})
+		case "/users/u1":
+			respondWithJSON(w, http.StatusOK, user)
+		case "/counts":
+			respondWithJSON(w, http.StatusOK, map[string]int{"2024-01-02": 3})
+		default:
+			respondWithError(w, http.StatusNotFound, errUserNotFound)
+		}
+	}))
+
+	var tests = []struct {
+		path                string
+		accept              string
+		expectedContentType string
+		expected            string
+	}{
+		{
+			path:                "/users/u1?fields=id,name",
+			accept:              "application/xml",
+			expectedContentType: "application/xml; charset=utf-8",
+			expected:            xmlHeader + `<user><id>u1</id><name>Ann &amp; co</name></user>`,
+		},
+		{
+			path:                "/users?fields=email",
+			accept:              "text/html, text/xml;q=0.9, application/json;q=0.5",
+			expectedContentType: "text/xml; charset=utf-8",
+			expected:            xmlHeader + `<users><user><email>ann@example.com</email></user></users>`,
+		},
+		{
+			path:                "/counts",
+			accept:              "application/xml",
+			expectedContentType: "application/xml; charset=utf-8",
+			expected:            xmlHeader + `<response><entry key="2024-01-02">3</entry></response>`,
+		},
+		{
+			path:                "/missing",
+			accept:              "application/xml",
+			expectedContentType: "application/xml; charset=utf-8",
+			expected:            xmlHeader + `<error><code>USER_NOT_FOUND</code><message>user doesn&#39;t exist</message></error>`,
+		},
+		// JSON stays the default
+		{
+			path:                "/users/u1?fields=id",
+			accept:              "application/json, application/xml;q=0.9",
+			expectedContentType: "application/json",
+			expected:            `{"id":"u1"}`,
+		},
+		{
+			path:                "/users/u1?fields=id",
+			accept:              "*/*",
+			expectedContentType: "application/json",
+			expected:            `{"id":"u1"}`,
+		},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		r.Header.Set("Accept", tt.accept)
+		handler.ServeHTTP(w, r)
+		if w.Header().Get("Content-Type") != tt.expectedContentType || w.Body.String() != tt.expected {
+			t.Errorf("GET %s (%s): got %s %s, want %s %s", tt.path, tt.accept, w.Header().Get("Content-Type"), w.Body, tt.expectedContentType, tt.expected)
+		}
+	}
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"